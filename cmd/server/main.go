@@ -138,29 +138,48 @@ func runHTTPServer(logger *zap.Logger, cfg *config.AppConfig, clusterEnabled boo
 		serveErrCh <- nil
 	}()
 
+	// A worker started by a rolling restart reports in once its /ready probe
+	// passes, leaving the master time to act before its own deadline.
+	if err := application.Ready(cluster.ReadyTimeout - 5*time.Second); err != nil {
+		logger.Warn("readiness probe failed after listen", zap.Error(err))
+	} else if err := cluster.NotifyReady(); err != nil {
+		logger.Warn("failed to notify cluster master", zap.Error(err))
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(quit)
 
-	select {
-	case err := <-serveErrCh:
-		return err
-	case <-quit:
-		if cluster.ShouldLogServerBootstrap() {
-			logger.Info("shutting down server...")
-		}
-		application.Shutdown()
-
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(ctx); err != nil {
-			return fmt.Errorf("forced shutdown: %w", err)
-		}
-		_ = <-serveErrCh
-		if cluster.ShouldLogServerBootstrap() {
-			logger.Info("server exited")
+	// SIGHUP reloads the settings of config.yml that can change at runtime.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	for {
+		select {
+		case err := <-serveErrCh:
+			return err
+		case <-reload:
+			if _, err := application.ReloadConfig(); err != nil {
+				logger.Warn("failed to reload config, keeping the running one", zap.Error(err))
+			}
+		case <-quit:
+			if cluster.ShouldLogServerBootstrap() {
+				logger.Info("shutting down server...")
+			}
+			application.Shutdown()
+
+			ctx, cancel := context.WithTimeout(context.Background(), cluster.DrainTimeout)
+			defer cancel()
+			if err := srv.Shutdown(ctx); err != nil {
+				return fmt.Errorf("forced shutdown: %w", err)
+			}
+			_ = <-serveErrCh
+			if cluster.ShouldLogServerBootstrap() {
+				logger.Info("server exited")
+			}
+			return nil
 		}
-		return nil
 	}
 }
 
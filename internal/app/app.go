@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -14,8 +15,13 @@ import (
 	"github.com/mx-space/core/internal/database"
 	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/modules/gateway/gateway"
+	"github.com/mx-space/core/internal/modules/gateway/pageproxy"
+	"github.com/mx-space/core/internal/modules/serverless"
+	"github.com/mx-space/core/internal/modules/storage/backup"
+	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
 	"github.com/mx-space/core/internal/pkg/cluster"
 	pkgcron "github.com/mx-space/core/internal/pkg/cron"
+	"github.com/mx-space/core/internal/pkg/metrics"
 	"github.com/mx-space/core/internal/pkg/prettylog"
 	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"go.uber.org/zap"
@@ -29,8 +35,18 @@ type App struct {
 	db     *gorm.DB
 	hub    *gateway.Hub
 	logger *zap.Logger
+	ctx    context.Context
 	cancel context.CancelFunc
 	sched  *pkgcron.Scheduler
+	rc     *pkgredis.Client
+	// backupSched is the process's backup scheduler.
+	backupSched *backup.Scheduler
+
+	// Settings that a config reload can change while running.
+	reloadMu  sync.Mutex
+	running   *config.AppConfig
+	origins   *originAllowlist
+	pageProxy *pageproxy.Handler
 }
 
 // New initializes the application: config → DB → Redis → routes.
@@ -62,6 +78,11 @@ func New(logger *zap.Logger, cfg *config.AppConfig) (*App, error) {
 	if err != nil {
 		return nil, fmt.Errorf("database: %w", err)
 	}
+	if cfg.Metrics.Enable {
+		if err := db.Use(metrics.GormPlugin()); err != nil {
+			return nil, fmt.Errorf("database metrics: %w", err)
+		}
+	}
 
 	if cluster.ShouldLogServerBootstrap() {
 		dbLogger.Info(prettylog.Green("readied!"))
@@ -76,6 +97,9 @@ func New(logger *zap.Logger, cfg *config.AppConfig) (*App, error) {
 	if err != nil {
 		return nil, fmt.Errorf("redis: %w", err)
 	}
+	if cfg.Metrics.Enable {
+		rc.Raw().AddHook(metrics.RedisHook())
+	}
 
 	if cluster.ShouldLogServerBootstrap() {
 		redisLogger.Info(prettylog.Green("readied!"))
@@ -99,9 +123,13 @@ func New(logger *zap.Logger, cfg *config.AppConfig) (*App, error) {
 	if err := applyTrustedProxySettings(router, cfg); err != nil {
 		return nil, fmt.Errorf("trusted proxy settings: %w", err)
 	}
+	router.Use(middleware.RequestID())
 	router.Use(middleware.Logger(logger, cfg.IsDev()))
 	router.Use(middleware.ErrorReporter(logger))
 	router.Use(middleware.Recovery(logger))
+	if cfg.Metrics.Enable {
+		router.Use(middleware.Metrics())
+	}
 
 	corsConfig := cors.Config{
 		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
@@ -118,30 +146,38 @@ func New(logger *zap.Logger, cfg *config.AppConfig) (*App, error) {
 			"x-uuid",
 			"X-Session-UUID",
 			"x-session-uuid",
+			"X-Reveal-Secrets",
+			"X-Request-ID",
+			"X-Note-Token",
+			"X-Reader-Token",
 		},
-		ExposeHeaders:    []string{"Content-Length", "x-mx-cache", "x-mx-served-by"},
+		ExposeHeaders:    []string{"Content-Length", "x-mx-cache", "x-mx-served-by", "X-Request-ID"},
 		AllowCredentials: true,
 	}
-	if len(cfg.AllowedOrigins) > 0 && !cfg.IsDev() {
-		patterns := cfg.AllowedOrigins
-		corsConfig.AllowOriginFunc = func(origin string) bool {
-			host := extractOriginHost(origin)
-			for _, pattern := range patterns {
-				if matchOriginPattern(pattern, host) {
-					return true
-				}
-			}
-			return false
-		}
-	} else {
-		corsConfig.AllowOriginFunc = func(origin string) bool { return true }
+	origins := newOriginAllowlist(nil)
+	if !cfg.IsDev() {
+		origins.Store(cfg.AllowedOrigins)
 	}
+	corsConfig.AllowOriginFunc = origins.Allow
 	router.Use(cors.New(corsConfig))
 
-	hub := gateway.NewHub(rc, logger, func(token string) bool {
-		_, err := middleware.ValidateToken(db, token)
-		return err == nil
-	})
+	validateAdminToken := func(token string) (time.Time, bool) {
+		claims, err := middleware.ValidateTokenClaims(db, token)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if claims.ExpiresAt == nil {
+			return time.Time{}, true
+		}
+		return claims.ExpiresAt.Time, true
+	}
+	hub := gateway.NewHub(rc, logger, validateAdminToken,
+		gateway.WithHeartbeat(
+			time.Duration(cfg.Gateway.PingInterval)*time.Second,
+			time.Duration(cfg.Gateway.PingTimeout)*time.Second,
+		),
+		gateway.WithAuthGrace(time.Duration(cfg.Gateway.AuthGrace)*time.Second),
+	)
 	ctx, cancel := context.WithCancel(context.Background())
 	go hub.Run(ctx)
 
@@ -150,13 +186,33 @@ func New(logger *zap.Logger, cfg *config.AppConfig) (*App, error) {
 	sched.SetBaseContext(ctx)
 	sched.SetRedisClient(rc)
 	sched.SetEnabled(shouldRunCron)
-	registerCronJobs(sched, db, cfg, logger)
+	// One configs service, kept fresh over Redis, backs the scheduled jobs.
+	cronCfgSvc := appconfigs.NewService(db, appconfigs.WithLogger(logger), appconfigs.WithRedis(rc))
+	go cronCfgSvc.Subscribe(ctx)
+	backupSched := backup.NewScheduler(db, cronCfgSvc, rc, logger)
+	registerCronJobs(sched, db, cronCfgSvc, cfg, logger, backupSched)
 	if shouldRunCron {
 		go sched.Start(ctx)
+		go backupSched.Start(ctx)
+		scheduled := serverless.NewHandler(db, hub, rc, serverless.WithLogger(logger), serverless.WithAppConfig(cfg))
+		go scheduled.SubscribeInvalidation(ctx)
+		go scheduled.StartScheduler(ctx)
 	}
 
-	app := &App{cfg: cfg, router: router, db: db, hub: hub, logger: logger, cancel: cancel, sched: sched}
+	running := *cfg
+	app := &App{
+		cfg: cfg, router: router, db: db, hub: hub, logger: logger, ctx: ctx, cancel: cancel, sched: sched, rc: rc,
+		backupSched: backupSched, running: &running, origins: origins,
+	}
+	if cfg.Metrics.Enable {
+		if err := app.serveMetrics(); err != nil {
+			cancel()
+			return nil, fmt.Errorf("metrics: %w", err)
+		}
+	}
+	app.registerProbes()
 	app.registerRoutes(rc)
+	go app.subscribeConfigReload(ctx)
 
 	return app, nil
 }
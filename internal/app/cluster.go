@@ -0,0 +1,60 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/cluster"
+	"github.com/mx-space/core/internal/pkg/response"
+)
+
+// readyPollInterval is how often Ready retries the readiness probe.
+const readyPollInterval = 500 * time.Millisecond
+
+// Ready runs the GET /ready probe until it passes or timeout elapses. Under
+// SO_REUSEPORT a request to the shared port may land on another worker, so
+// the probe is served in-process through the router instead.
+func (a *App) Ready(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		rec := httptest.NewRecorder()
+		a.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		if rec.Code == http.StatusOK {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("readiness probe returned %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+		select {
+		case <-a.ctx.Done():
+			return a.ctx.Err()
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// GET /system/cluster — worker table kept by the cluster master. Outside cluster
+// mode the only row is this process.
+func (a *App) clusterStatus(c *gin.Context) {
+	state, err := cluster.ReadState()
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	enabled := state != nil
+	if state == nil {
+		state = &cluster.State{Workers: []cluster.WorkerInfo{{PID: os.Getpid(), StartedAt: processStart}}}
+	}
+	response.OK(c, gin.H{
+		"enabled":    enabled,
+		"master_pid": state.MasterPID,
+		"pid":        os.Getpid(),
+		"worker_id":  cluster.WorkerID(),
+		"workers":    state.Workers,
+	})
+}
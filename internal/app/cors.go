@@ -3,8 +3,40 @@ package app
 import (
 	"net/url"
 	"strings"
+	"sync/atomic"
 )
 
+// originAllowlist holds the allowed_origins patterns so a config reload can swap
+// them without rebuilding the CORS middleware. An empty list allows every origin.
+type originAllowlist struct {
+	patterns atomic.Pointer[[]string]
+}
+
+func newOriginAllowlist(patterns []string) *originAllowlist {
+	l := &originAllowlist{}
+	l.Store(patterns)
+	return l
+}
+
+func (l *originAllowlist) Store(patterns []string) {
+	cp := append([]string{}, patterns...)
+	l.patterns.Store(&cp)
+}
+
+func (l *originAllowlist) Allow(origin string) bool {
+	patterns := *l.patterns.Load()
+	if len(patterns) == 0 {
+		return true
+	}
+	host := extractOriginHost(origin)
+	for _, pattern := range patterns {
+		if matchOriginPattern(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
 // extractOriginHost returns the "host[:port]" portion of an origin URL.
 func extractOriginHost(origin string) string {
 	u, err := url.Parse(origin)
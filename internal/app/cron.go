@@ -1,12 +1,9 @@
 package app
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"strings"
 	"time"
 
 	"github.com/mx-space/core/internal/config"
@@ -14,26 +11,30 @@ import (
 	"github.com/mx-space/core/internal/modules/content/link"
 	"github.com/mx-space/core/internal/modules/content/search"
 	"github.com/mx-space/core/internal/modules/stats/aggregate"
+	"github.com/mx-space/core/internal/modules/stats/analyze"
 	"github.com/mx-space/core/internal/modules/storage/backup"
+	"github.com/mx-space/core/internal/modules/syndication/searchpush"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/modules/system/util/project"
 	pkgcron "github.com/mx-space/core/internal/pkg/cron"
+	"github.com/mx-space/core/internal/pkg/loginlog"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
-// registerCronJobs registers all scheduled background jobs.
-func registerCronJobs(sched *pkgcron.Scheduler, db *gorm.DB, runtimeCfg *config.AppConfig, logger *zap.Logger) {
-	cfgSvc := appconfigs.NewService(db, appconfigs.WithLogger(logger))
+// registerCronJobs registers all scheduled background jobs. cfgSvc is the
+// process-wide configs service the backup scheduler reads too.
+func registerCronJobs(sched *pkgcron.Scheduler, db *gorm.DB, cfgSvc *appconfigs.Service, runtimeCfg *config.AppConfig, logger *zap.Logger, backupSched *backup.Scheduler) {
 	searchSvc := search.NewService(db, cfgSvc, runtimeCfg, search.WithLogger(logger))
 	cronLogger := logger.Named("CronService")
 
 	sched.Register(pkgcron.Job{
 		Name:        "cleanup_analytics",
-		Description: "清理 90 天以上的访问记录",
+		Description: "清理过期的访问记录",
 		Interval:    24 * time.Hour,
 		Fn: func(ctx context.Context) error {
-			cutoff := time.Now().AddDate(0, 0, -90)
-			result := db.Where("created_at < ?", cutoff).Delete(&models.AnalyzeModel{})
+			cutoff := analyze.RetentionCutoff(runtimeCfg, time.Now())
+			result := db.Where("timestamp < ?", cutoff).Delete(&models.AnalyzeModel{})
 			if result.Error != nil {
 				cronLogger.Warn("清理访问记录失败", zap.Error(result.Error))
 				return result.Error
@@ -43,13 +44,35 @@ func registerCronJobs(sched *pkgcron.Scheduler, db *gorm.DB, runtimeCfg *config.
 		},
 	})
 
+	sched.Register(pkgcron.Job{
+		Name:        "cleanup_login_logs",
+		Description: "清理过期的登录记录",
+		Interval:    24 * time.Hour,
+		Fn: func(ctx context.Context) error {
+			deleted, err := loginlog.Prune(db.WithContext(ctx), time.Now())
+			if err != nil {
+				cronLogger.Warn("清理登录记录失败", zap.Error(err))
+				return err
+			}
+			cronLogger.Info(fmt.Sprintf("清理登录记录成功，共删除 %d 条", deleted))
+			return nil
+		},
+	})
+
+	// Runs on demand only; backupSched keeps the BackupOptions.Cron schedule.
+	sched.Register(pkgcron.Job{
+		Name:        "auto_backup",
+		Description: "自动备份数据库",
+		Fn:          backupSched.Run,
+	})
+
 	sched.Register(pkgcron.Job{
 		Name:        "check_links",
 		Description: "检查友链可用性",
 		Interval:    12 * time.Hour,
 		Fn: func(ctx context.Context) error {
 			svc := link.NewServiceWithLogger(db, logger)
-			results := svc.HealthCheck()
+			results := svc.HealthCheck(ctx)
 			outdated := 0
 			for _, r := range results {
 				if r.Status == 0 || r.Status >= 400 {
@@ -65,16 +88,17 @@ func registerCronJobs(sched *pkgcron.Scheduler, db *gorm.DB, runtimeCfg *config.
 	})
 
 	sched.Register(pkgcron.Job{
-		Name:        "auto_backup",
-		Description: "自动备份数据库到本地",
+		Name:        "sync_github_projects",
+		Description: "同步项目的 GitHub 仓库信息",
 		Interval:    24 * time.Hour,
 		Fn: func(ctx context.Context) error {
-			cronLogger.Info("备份数据库中...")
-			if err := backup.CreateLocalBackup(db); err != nil {
-				cronLogger.Warn("备份失败", zap.Error(err))
+			svc := project.NewService(db, project.WithConfig(cfgSvc), project.WithLogger(logger))
+			result, err := svc.SyncAllGitHub(ctx)
+			if err != nil {
+				cronLogger.Warn("同步 GitHub 项目信息失败", zap.Error(err))
 				return err
 			}
-			cronLogger.Info("备份成功")
+			cronLogger.Info(fmt.Sprintf("GitHub 项目同步完成，成功 %d 个，仓库不存在 %d 个，失败 %d 个", result.Synced, result.Missing, result.Failed))
 			return nil
 		},
 	})
@@ -105,43 +129,45 @@ func registerCronJobs(sched *pkgcron.Scheduler, db *gorm.DB, runtimeCfg *config.
 		},
 	})
 
+	pushSvc := searchpush.NewService(db, cfgSvc, searchpush.WithLogger(logger))
+	pushSitemap := func(ctx context.Context, engine, label string) error {
+		cfg, err := cfgSvc.Get()
+		if err != nil {
+			return err
+		}
+		if enabled := map[string]bool{
+			searchpush.EngineBaidu: cfg.BaiduSearchOptions.Enable,
+			searchpush.EngineBing:  cfg.BingSearchOptions.Enable,
+		}[engine]; !enabled {
+			return nil
+		}
+		urls, err := aggregate.GetSitemapURLs(db, cfgSvc)
+		if err != nil {
+			return err
+		}
+		if len(urls) == 0 {
+			return nil
+		}
+		cronLogger.Info(fmt.Sprintf("推送 %d 条 URL 到%s...", len(urls), label))
+		result := pushSvc.PushEngine(ctx, cfg, engine, urls)
+		switch {
+		case result.Error != "":
+			cronLogger.Warn(label+"推送失败", zap.String("error", result.Error))
+			return errors.New(result.Error)
+		case result.Skipped != "":
+			cronLogger.Info(label+"推送跳过", zap.String("reason", result.Skipped))
+		default:
+			cronLogger.Info(label + "推送完成")
+		}
+		return nil
+	}
+
 	sched.Register(pkgcron.Job{
 		Name:        "push_baidu_search",
 		Description: "推送站点 URL 到百度搜索",
 		Interval:    24 * time.Hour,
 		Fn: func(ctx context.Context) error {
-			cfg, err := cfgSvc.Get()
-			if err != nil {
-				return err
-			}
-			if !cfg.BaiduSearchOptions.Enable || cfg.BaiduSearchOptions.Token == nil || *cfg.BaiduSearchOptions.Token == "" {
-				return nil
-			}
-			urls, err := aggregate.GetSitemapURLs(db, cfgSvc)
-			if err != nil {
-				return err
-			}
-			if len(urls) == 0 {
-				return nil
-			}
-			cronLogger.Info(fmt.Sprintf("推送 %d 条 URL 到百度搜索...", len(urls)))
-			webURL := strings.TrimRight(cfg.URL.WebURL, "/")
-			apiURL := fmt.Sprintf("http://data.zz.baidu.com/urls?site=%s&token=%s", webURL, *cfg.BaiduSearchOptions.Token)
-			body := strings.Join(urls, "\n")
-			req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(body))
-			if err != nil {
-				return err
-			}
-			req.Header.Set("Content-Type", "text/plain")
-			client := &http.Client{Timeout: 30 * time.Second}
-			resp, err := client.Do(req)
-			if err != nil {
-				cronLogger.Warn("百度搜索推送失败", zap.Error(err))
-				return err
-			}
-			resp.Body.Close()
-			cronLogger.Info("百度搜索推送完成")
-			return nil
+			return pushSitemap(ctx, searchpush.EngineBaidu, "百度搜索")
 		},
 	})
 
@@ -150,41 +176,7 @@ func registerCronJobs(sched *pkgcron.Scheduler, db *gorm.DB, runtimeCfg *config.
 		Description: "推送站点 URL 到 Bing 搜索",
 		Interval:    24 * time.Hour,
 		Fn: func(ctx context.Context) error {
-			cfg, err := cfgSvc.Get()
-			if err != nil {
-				return err
-			}
-			if !cfg.BingSearchOptions.Enable || cfg.BingSearchOptions.Token == nil || *cfg.BingSearchOptions.Token == "" {
-				return nil
-			}
-			urls, err := aggregate.GetSitemapURLs(db, cfgSvc)
-			if err != nil {
-				return err
-			}
-			if len(urls) == 0 {
-				return nil
-			}
-			cronLogger.Info(fmt.Sprintf("推送 %d 条 URL 到 Bing 搜索...", len(urls)))
-			webURL := strings.TrimRight(cfg.URL.WebURL, "/")
-			payload, _ := json.Marshal(map[string]interface{}{
-				"siteUrl": webURL,
-				"urlList": urls,
-			})
-			apiURL := fmt.Sprintf("https://ssl.bing.com/webmaster/api.svc/json/SubmitUrlbatch?apikey=%s", *cfg.BingSearchOptions.Token)
-			req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(payload))
-			if err != nil {
-				return err
-			}
-			req.Header.Set("Content-Type", "application/json")
-			client := &http.Client{Timeout: 30 * time.Second}
-			resp, err := client.Do(req)
-			if err != nil {
-				cronLogger.Warn("Bing 搜索推送失败", zap.Error(err))
-				return err
-			}
-			resp.Body.Close()
-			cronLogger.Info("Bing 搜索推送完成")
-			return nil
+			return pushSitemap(ctx, searchpush.EngineBing, "Bing 搜索")
 		},
 	})
 }
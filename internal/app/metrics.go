@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/modules/gateway/gateway"
+	"github.com/mx-space/core/internal/pkg/cluster"
+	"github.com/mx-space/core/internal/pkg/httpserver"
+	"github.com/mx-space/core/internal/pkg/metrics"
+	"github.com/mx-space/core/internal/pkg/taskqueue"
+	"go.uber.org/zap"
+)
+
+// registerMetricGauges exposes gauges read from live state on every scrape.
+func registerMetricGauges(hub *gateway.Hub, tasks *taskqueue.Service) {
+	metrics.NewGaugeFunc("mx_gateway_clients", "Connected websocket clients by room.", []string{"room"},
+		func() []metrics.Sample {
+			return []metrics.Sample{
+				{Labels: []string{gateway.RoomAdmin}, Value: float64(hub.ClientCount(gateway.RoomAdmin))},
+				{Labels: []string{gateway.RoomPublic}, Value: float64(hub.ClientCount(gateway.RoomPublic))},
+			}
+		})
+	metrics.NewGaugeFunc("mx_taskqueue_tasks", "Queued tasks by type and status.", []string{"type", "status"},
+		func() []metrics.Sample {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			counts, err := tasks.CountByStatus(ctx)
+			if err != nil {
+				return nil
+			}
+			var samples []metrics.Sample
+			for taskType, byStatus := range counts {
+				for _, status := range []taskqueue.TaskStatus{taskqueue.TaskPending, taskqueue.TaskRunning, taskqueue.TaskFailed} {
+					samples = append(samples, metrics.Sample{
+						Labels: []string{taskType, string(status)},
+						Value:  float64(byStatus[status]),
+					})
+				}
+			}
+			return samples
+		})
+}
+
+// serveMetrics mounts GET /metrics on the main router, or on its own listener
+// when metrics.listen is set. Every process serves its own numbers. Cluster
+// workers share the main port through SO_REUSEPORT, so a scrape there would
+// hit a random worker; instead worker N listens on the metrics.listen port
+// plus N-1 and each worker is scraped as its own target.
+func (a *App) serveMetrics() error {
+	handler := metrics.Default.Handler(a.cfg.Metrics.Token)
+	if a.cfg.Metrics.Listen == "" {
+		if cluster.IsWorker() {
+			if cluster.ShouldLogServerBootstrap() {
+				a.logger.Named("Metrics").Warn("集群模式下 /metrics 需要配置 metrics.listen，已跳过")
+			}
+			return nil
+		}
+		a.router.GET("/metrics", gin.WrapH(handler))
+		return nil
+	}
+
+	addr := a.cfg.Metrics.Listen
+	if cluster.IsWorker() {
+		var err error
+		if addr, err = workerMetricsAddr(addr, cluster.WorkerID()); err != nil {
+			return err
+		}
+	}
+	// Reusing the port lets a restarted worker bind before its predecessor exits.
+	listener, err := cluster.ListenTCP(addr, cluster.IsWorker())
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	srv := httpserver.New(addr, mux)
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Named("Metrics").Warn("metrics 服务已停止", zap.Error(err))
+		}
+	}()
+	go func() {
+		<-a.ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	return nil
+}
+
+// workerMetricsAddr offsets the port of addr by the worker ID, so worker 1
+// uses addr itself.
+func workerMetricsAddr(addr string, workerID int) (string, error) {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return "", fmt.Errorf("invalid metrics.listen port %q", portText)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port+max(workerID, 1)-1)), nil
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/cluster"
+	"go.uber.org/zap"
+)
+
+// probeTimeout bounds each dependency check of the readiness probe.
+const probeTimeout = 2 * time.Second
+
+// registerProbes mounts GET /health (liveness) and GET /ready (readiness) on
+// the root router. They are registered before the rate limiter and analytics
+// middleware so load balancer probes stay cheap and uncounted. In cluster
+// mode each worker answers for itself.
+func (a *App) registerProbes() {
+	cfgSvc := appconfigs.NewService(a.db)
+
+	a.router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, a.probeBody("ok", nil))
+	})
+
+	a.router.GET("/ready", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), probeTimeout)
+		defer cancel()
+
+		// Failures report "down" only: the probes are public, and driver
+		// errors can carry hosts and credentials.
+		checks := gin.H{"database": "ok", "redis": "ok", "config": "ok"}
+		ready := true
+		fail := func(name string, err error) {
+			a.logger.Debug("readiness check failed", zap.String("check", name), zap.Error(err))
+			checks[name] = "down"
+			ready = false
+		}
+		if sqlDB, err := a.db.DB(); err != nil {
+			fail("database", err)
+		} else if err := sqlDB.PingContext(ctx); err != nil {
+			fail("database", err)
+		}
+		if err := a.rc.Raw().Ping(ctx).Err(); err != nil {
+			fail("redis", err)
+		}
+		// The config service caches after the first successful load.
+		if _, err := cfgSvc.Get(); err != nil {
+			fail("config", err)
+		}
+
+		if !ready {
+			c.JSON(http.StatusServiceUnavailable, a.probeBody("unavailable", checks))
+			return
+		}
+		c.JSON(http.StatusOK, a.probeBody("ok", checks))
+	})
+}
+
+func (a *App) probeBody(status string, checks gin.H) gin.H {
+	body := gin.H{"status": status, "pid": os.Getpid()}
+	if cluster.IsWorker() {
+		body["worker"] = cluster.WorkerID()
+	}
+	if checks != nil {
+		body["checks"] = checks
+	}
+	return body
+}
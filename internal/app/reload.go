@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/pkg/nativelog"
+	"github.com/mx-space/core/internal/pkg/response"
+	"go.uber.org/zap"
+)
+
+// configReloadChannel tells the other cluster workers to reload config.yml. The
+// payload is the pid of the worker that already reloaded.
+const configReloadChannel = "mx:config:reload"
+
+// hotReloadKeys are the config.yml keys applied without a restart.
+var hotReloadKeys = map[string]bool{
+	"allowed_origins":    true,
+	"log_rotate_size_mb": true,
+	"log_rotate_keep":    true,
+	"mx-admin":           true,
+}
+
+// ReloadResult lists the config.yml keys that changed since the running config.
+type ReloadResult struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requires_restart"`
+}
+
+// ReloadConfig re-reads config.yml and applies the settings that can change at
+// runtime: allowed_origins, log rotation and the mx-admin asset path. Other changes
+// are only reported. On error the running config stays active.
+func (a *App) ReloadConfig() (*ReloadResult, error) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	next, err := config.Load(a.cfg.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReloadResult{Applied: []string{}, RequiresRestart: []string{}}
+	for _, key := range diffAppConfig(a.running, next) {
+		if hotReloadKeys[key] {
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.RequiresRestart = append(result.RequiresRestart, key)
+		}
+	}
+
+	running := *a.running
+	running.AllowedOrigins = next.AllowedOrigins
+	running.LogRotateSize = next.LogRotateSize
+	running.LogRotateKeep = next.LogRotateKeep
+	running.MXAdmin = next.MXAdmin
+
+	if !running.IsDev() {
+		a.origins.Store(running.AllowedOrigins)
+	}
+	setOrUnsetEnv(nativelog.EnvLogRotateSizeMB, running.LogRotateSizeMB)
+	setOrUnsetEnv(nativelog.EnvLogRotateKeep, running.LogRotateKeepCount)
+	nativelog.ReloadRotateSettings()
+	if a.pageProxy != nil {
+		a.pageProxy.SetAdminAssetPath(&running)
+	}
+	a.running = &running
+
+	logger := a.logger.Named("System")
+	logger.Info("配置已重新加载", zap.Strings("applied", result.Applied))
+	if len(result.RequiresRestart) > 0 {
+		logger.Warn("以下配置需要重启后生效", zap.Strings("requires_restart", result.RequiresRestart))
+	}
+	return result, nil
+}
+
+func setOrUnsetEnv(key string, value func() (int, bool)) {
+	if v, ok := value(); ok {
+		_ = os.Setenv(key, strconv.Itoa(v))
+		return
+	}
+	_ = os.Unsetenv(key)
+}
+
+// diffAppConfig returns the yaml keys of the top-level fields that differ.
+func diffAppConfig(prev, next *config.AppConfig) []string {
+	var keys []string
+	pv, nv := reflect.ValueOf(prev).Elem(), reflect.ValueOf(next).Elem()
+	t := pv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		if !reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// POST /system/reload-config — same as sending SIGHUP; other workers follow via Redis.
+func (a *App) reloadConfig(c *gin.Context) {
+	result, err := a.ReloadConfig()
+	if err != nil {
+		a.logger.Named("System").Warn("重新加载配置失败", zap.Error(err))
+		response.UnprocessableEntity(c, fmt.Sprintf("重新加载配置失败: %v", err))
+		return
+	}
+	if a.rc != nil {
+		if err := a.rc.Publish(c.Request.Context(), configReloadChannel, strconv.Itoa(os.Getpid())); err != nil {
+			a.logger.Named("System").Warn("广播配置重载失败", zap.Error(err))
+		}
+	}
+	response.OK(c, result)
+}
+
+// subscribeConfigReload reloads config.yml when another worker asks for it.
+func (a *App) subscribeConfigReload(ctx context.Context) {
+	if a.rc == nil {
+		return
+	}
+	pubsub := a.rc.Subscribe(ctx, configReloadChannel)
+	defer pubsub.Close()
+
+	self := strconv.Itoa(os.Getpid())
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if msg.Payload == self {
+				continue
+			}
+			if _, err := a.ReloadConfig(); err != nil {
+				a.logger.Named("System").Warn("重新加载配置失败", zap.Error(err))
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -30,6 +31,7 @@ import (
 	"github.com/mx-space/core/internal/modules/gateway/pageproxy"
 	"github.com/mx-space/core/internal/modules/gateway/webhook"
 	"github.com/mx-space/core/internal/modules/processing/ai"
+	"github.com/mx-space/core/internal/modules/processing/imagemeta"
 	"github.com/mx-space/core/internal/modules/processing/markdown"
 	"github.com/mx-space/core/internal/modules/processing/render"
 	"github.com/mx-space/core/internal/modules/processing/say"
@@ -43,6 +45,7 @@ import (
 	"github.com/mx-space/core/internal/modules/storage/imagesync"
 	"github.com/mx-space/core/internal/modules/syndication/feed"
 	"github.com/mx-space/core/internal/modules/syndication/reader"
+	"github.com/mx-space/core/internal/modules/syndication/searchpush"
 	"github.com/mx-space/core/internal/modules/syndication/sitemap"
 	"github.com/mx-space/core/internal/modules/syndication/subscribe"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
@@ -61,6 +64,8 @@ import (
 	"github.com/mx-space/core/internal/modules/tasks/ack"
 	"github.com/mx-space/core/internal/modules/tasks/crontask"
 	"github.com/mx-space/core/internal/pkg/bark"
+	"github.com/mx-space/core/internal/pkg/geoip"
+	"github.com/mx-space/core/internal/pkg/loginlog"
 	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
 	"github.com/mx-space/core/internal/pkg/taskqueue"
@@ -89,12 +94,15 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 		"issues":   "https://github.com/BLxcwg666/mx-core-go/issues",
 	}
 
-	r.Use(analyze.Middleware(db))
+	analyzeRecorder := analyze.NewRecorder(db)
+	go analyzeRecorder.Run(a.ctx)
+	r.Use(analyze.Middleware(analyzeRecorder))
 
 	apiPrefix := "/api/v2"
 
 	// Shared services
-	cfgSvc := appconfigs.NewService(db, appconfigs.WithLogger(a.logger))
+	cfgSvc := appconfigs.NewService(db, appconfigs.WithLogger(a.logger), appconfigs.WithRedis(rc))
+	go cfgSvc.Subscribe(a.ctx)
 	searchSvc := search2.NewService(db, cfgSvc, a.cfg, search2.WithLogger(a.logger))
 
 	// Bark push service for rate-limit alerts.
@@ -110,10 +118,15 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 	r.Use(middleware.RateLimit(rc.Raw(), barkSvc))
 	r.Use(middleware.Idempotence(rc.Raw()))
 
-	taskSvc := taskqueue.NewService(rc)
+	taskSvc := taskqueue.NewService(rc, taskqueue.WithLogger(a.logger), taskqueue.WithBroadcaster(a.hub.BroadcastAdmin))
+	go taskSvc.Run(a.ctx)
+	if a.cfg.Metrics.Enable {
+		registerMetricGauges(a.hub, taskSvc)
+	}
 
 	// Webhook service (used by notify).
-	webhookSvc := webhook.NewService(db)
+	webhookSvc := webhook.NewService(db, webhook.WithLogger(a.logger))
+	go webhookSvc.Run(a.ctx)
 
 	// Subscribe service (used by notify).
 	subscribeSvc := subscribe.NewService(db)
@@ -122,7 +135,7 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 	notifySvc := notify.New(db, cfgSvc, webhookSvc, barkSvc, subscribeSvc, notify.WithLogger(a.logger))
 
 	// Image sync service.
-	imageSyncSvc := imagesync.NewService(db, cfgSvc)
+	imageSyncSvc := imagesync.NewService(db, cfgSvc, imagesync.WithLogger(a.logger))
 	notifySvc.SetImageSync(imageSyncSvc.SyncContentImages)
 
 	// Text macro service.
@@ -133,11 +146,13 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 	sitemap.RegisterRoutes(root, db, cfgSvc)
 	feed.RegisterRoutes(root, db, cfgSvc) // /feed.xml, /atom.xml
 	render.NewHandler(db, cfgSvc).RegisterRoutes(root, authMW)
-	pageproxy.NewHandler(cfgSvc, a.cfg).RegisterRoutes(root)
+	a.pageProxy = pageproxy.NewHandler(cfgSvc, a.cfg)
+	a.pageProxy.RegisterRoutes(root)
 
 	// Versioned API
 	api := r.Group(apiPrefix)
 	routesLogger := a.logger.Named("AppRoutes")
+	go middleware.SubscribeAPITokenRevocations(a.ctx, a.logger.Named("APIToken"))
 	api.Use(middleware.OptionalAuth(db))
 	api.Use(middleware.HTTPCache(rc.Raw(), middleware.HTTPCacheOptions{
 		TTL:                    15 * time.Second,
@@ -149,7 +164,7 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 
 	// Infrastructure
 	health.RegisterRoutes(api, db, a.sched, cfgSvc, authMW, a.logger)
-	aggregate.RegisterRoutes(api, db, cfgSvc, a.hub, rc)
+	aggregate.RegisterRoutes(api, db, cfgSvc, a.cfg, a.hub, rc, authMW)
 	ack.NewHandler(db, a.hub).RegisterRoutes(api)
 	if apiPrefix != "" {
 		feed.RegisterRoutes(api, db, cfgSvc) // also at /api/v2/feed
@@ -158,7 +173,7 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 	servertime.RegisterRoutes(api)
 
 	// Init (setup wizard)
-	init_.NewHandler(db, cfgSvc).RegisterRoutes(api)
+	init_.NewHandler(db, cfgSvc, init_.WithSearchReindex(searchSvc.ReindexIfEnabled)).RegisterRoutes(api)
 
 	// App info endpoint
 	api.GET("", func(c *gin.Context) { c.PureJSON(http.StatusOK, appInfo) })
@@ -248,27 +263,120 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 	appconfigs.NewHandler(cfgSvc).RegisterRoutes(api, authMW)
 
 	// Auth & User
-	auth.NewHandler(auth.NewService(db)).RegisterRoutes(api, authMW)
+	locator, err := geoip.New(geoip.Options{
+		MMDBPath: a.cfg.IPLocation.MMDBPath,
+		APIURL:   a.cfg.IPLocation.APIURL,
+		Language: a.cfg.IPLocation.Language,
+	})
+	if err != nil {
+		routesLogger.Warn("IP 归属地查询不可用", zap.Error(err))
+	}
+	ipLocator := geoip.Cached(locator, rc)
+	loginRecorder := loginlog.New(db,
+		loginlog.WithRedis(rc),
+		loginlog.WithLocator(ipLocator),
+		loginlog.WithNewIPNotifier(notifySvc.OnNewLoginIP),
+		loginlog.WithLogger(a.logger),
+	)
+	auth.NewHandler(auth.NewService(db), auth.WithLoginRecorder(loginRecorder)).RegisterRoutes(api, authMW)
 	auth.NewOAuthHandler(db, cfgSvc).RegisterRoutes(api)
-	authn.NewHandler(db).RegisterRoutes(api, authMW)
-	user.NewHandler(user.NewService(db), cfgSvc).RegisterRoutes(api, authMW)
+	authn.NewHandler(db, cfgSvc).RegisterRoutes(api, authMW)
+	user.NewHandler(user.NewService(db), cfgSvc, user.WithLoginRecorder(loginRecorder)).RegisterRoutes(api, authMW)
 	reader.NewHandler(db).RegisterRoutes(api, authMW)
 
 	// Content
 	postSvc := post.NewService(db)
 	pageSvc := page.NewService(db)
 	slugTrackerSvc := slugtracker.NewService(db)
+	slugTrackerSvc.SetConfigService(cfgSvc)
 	postSvc.SetSlugTracker(slugTrackerSvc)
+	postSvc.SetRedis(rc)
+	postSvc.SetConfigService(cfgSvc)
 	pageSvc.SetSlugTracker(slugTrackerSvc)
 
+	// /aggregate is cached in Redis; drop it whenever content it lists changes.
+	bustAggregate := func() {
+		if err := aggregate.InvalidateCache(context.Background(), rc); err != nil {
+			a.logger.Warn("failed to invalidate aggregate cache", zap.Error(err))
+		}
+	}
+	noteSvc := note.NewService(db)
+	noteSvc.SetRedis(rc)
+	categorySvc := category.NewService(db)
+	postSvc.SetOnChange(bustAggregate)
+	noteSvc.SetOnChange(bustAggregate)
+	pageSvc.SetOnChange(bustAggregate)
+	categorySvc.SetOnChange(bustAggregate)
+	adjustSiteWords := func(delta int64) {
+		if err := aggregate.AdjustSiteWords(context.Background(), rc, delta); err != nil {
+			a.logger.Warn("failed to adjust site word count", zap.Error(err))
+		}
+	}
+	postSvc.SetOnTextChange(adjustSiteWords)
+	imageMetaOpts := []imagemeta.Option{imagemeta.WithLogger(a.logger)}
+	if n, ok := a.cfg.ImageMetaConcurrency(); ok {
+		imageMetaOpts = append(imageMetaOpts, imagemeta.WithConcurrency(n))
+	}
+	imageMetaSvc := imagemeta.NewService(db, imageMetaOpts...)
+	postSvc.SetImageMeta(imageMetaSvc)
+	noteSvc.SetImageMeta(imageMetaSvc)
+	noteSvc.SetOnTextChange(adjustSiteWords)
+	// Publishing a draft uploads its local images to object storage.
+	syncOnPublish := func(contentType string) func(id string) {
+		return func(id string) {
+			if err := imageSyncSvc.SyncContentImages(id, contentType); err != nil {
+				routesLogger.Warn("image sync on publish failed",
+					zap.String("type", contentType), zap.String("id", id), zap.Error(err))
+			}
+		}
+	}
+	postSvc.SetOnPublish(func(id string) {
+		syncOnPublish("post")(id)
+		// A published draft goes live like a new post.
+		if post, err := postSvc.GetByID(id); err == nil && post != nil {
+			webhookSvc.Dispatch("POST_CREATE", post)
+		}
+	})
+	noteSvc.SetOnPublish(func(id string) {
+		syncOnPublish("note")(id)
+		if note, err := noteSvc.GetByID(id); err == nil && note != nil {
+			webhookSvc.Dispatch("NOTE_CREATE", note)
+		}
+	})
+	// Newly public URLs are submitted to Baidu and Bing.
+	searchPushSvc := searchpush.NewService(db, cfgSvc, searchpush.WithLogger(a.logger))
+	pushURL := func(refType string) func(id string) {
+		return func(id string) {
+			if err := searchPushSvc.PushRef(context.Background(), refType, id); err != nil {
+				routesLogger.Warn("search engine push failed",
+					zap.String("type", refType), zap.String("id", id), zap.Error(err))
+			}
+		}
+	}
+	postSvc.SetOnPublicURL(pushURL("post"))
+	noteSvc.SetOnPublicURL(pushURL("note"))
+	pageSvc.SetOnPublicURL(pushURL("page"))
+	postSvc.SetOnIndexChange(func(id string) { searchSvc.SyncDocument("post", id) })
+	noteSvc.SetOnIndexChange(func(id string) { searchSvc.SyncDocument("note", id) })
+	pageSvc.SetOnIndexChange(func(id string) { searchSvc.SyncDocument("page", id) })
+	pageSvc.SetOnTextChange(adjustSiteWords)
+
 	post.NewHandler(postSvc, notifySvc, macroSvc, a.hub).RegisterRoutes(api, authMW)
-	note.NewHandler(note.NewService(db), notifySvc, macroSvc, a.hub).RegisterRoutes(api, authMW)
+	note.NewHandler(noteSvc, notifySvc, macroSvc, a.hub).RegisterRoutes(api, authMW)
 	page.NewHandler(pageSvc, a.hub, macroSvc).RegisterRoutes(api, authMW)
-	recently.NewHandler(recently.NewService(db), a.hub).RegisterRoutes(api, authMW)
-	draft.NewHandler(draft.NewService(db)).RegisterRoutes(api, authMW)
+	recentlySvc := recently.NewService(db)
+	recentlySvc.SetRedis(rc)
+	recentlySvc.SetOnCreate(notifySvc.OnRecentlyCreate)
+	recently.NewHandler(recentlySvc, a.hub).RegisterRoutes(api, authMW)
+	draftSvc := draft.NewService(db)
+	if n, ok := a.cfg.DraftMaxVersions(); ok {
+		draftSvc.SetMaxVersions(n)
+	}
+	draft.NewHandler(draftSvc).RegisterRoutes(api, authMW)
+	draft.NewArticleHandler(draftSvc).RegisterRoutes(api, authMW)
 
 	// Taxonomy
-	category.NewHandler(category.NewService(db)).RegisterRoutes(api, authMW)
+	category.NewHandler(categorySvc).RegisterRoutes(api, authMW)
 	topic.NewHandler(topic.NewService(db)).RegisterRoutes(api, authMW)
 
 	// Comments
@@ -277,18 +385,24 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 		notifySvc,
 		comment.WithLogger(a.logger),
 		comment.WithHub(a.hub),
+		comment.WithRedis(rc),
+		comment.WithLocator(ipLocator),
 	).RegisterRoutes(api, authMW)
 
 	// Extras
-	say.NewHandler(say.NewService(db), a.hub).RegisterRoutes(api, authMW)
-	link.NewHandler(link.NewService(db, link.WithLogger(a.logger)), cfgSvc, a.hub).RegisterRoutes(api, authMW)
+	saySvc := say.NewService(db)
+	saySvc.SetOnCreate(notifySvc.OnSayCreate)
+	say.NewHandler(saySvc, a.hub).RegisterRoutes(api, authMW)
+	link.NewHandler(link.NewService(db, link.WithLogger(a.logger)), cfgSvc, a.hub, link.WithWebhooks(webhookSvc)).RegisterRoutes(api, authMW)
 	subscribe.NewHandler(subscribeSvc, cfgSvc, subscribe.WithLogger(a.logger)).RegisterRoutes(api, authMW)
-	snippet.NewHandler(snippet.NewService(db)).RegisterRoutes(api, authMW)
-	project.NewHandler(project.NewService(db)).RegisterRoutes(api, authMW)
+	snippet.NewHandler(snippet.NewService(db, snippet.WithRedis(rc))).RegisterRoutes(api, authMW)
+	project.NewHandler(project.NewService(db, project.WithConfig(cfgSvc), project.WithLogger(a.logger))).RegisterRoutes(api, authMW)
 	helper.NewHandler(db, cfgSvc).RegisterRoutes(api, authMW)
 	activity.NewHandler(db, a.hub).RegisterRoutes(api, authMW)
 	metapreset.NewHandler(db).RegisterRoutes(api, authMW)
-	serverless.NewHandler(db, a.hub, rc).RegisterRoutes(api, authMW)
+	serverlessHandler := serverless.NewHandler(db, a.hub, rc, serverless.WithLogger(a.logger), serverless.WithAppConfig(a.cfg))
+	serverlessHandler.RegisterRoutes(api, authMW)
+	go serverlessHandler.SubscribeInvalidation(a.ctx)
 	dependency.NewHandler().RegisterRoutes(api, authMW)
 	update.NewHandler().RegisterRoutes(api, authMW)
 	debug.NewHandler(a.hub).RegisterRoutes(api, authMW)
@@ -300,12 +414,15 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 	// Markdown import/export
 	markdown.NewHandler(db).RegisterRoutes(api, authMW)
 	file.NewHandler(db, cfgSvc).RegisterRoutes(api, authMW)
+	imagesync.NewHandler(imageSyncSvc).RegisterRoutes(api, authMW)
+	textmacro.NewHandler(macroSvc, db).RegisterRoutes(api, authMW)
+	searchpush.NewHandler(searchPushSvc).RegisterRoutes(api, authMW)
 
 	// Backups
-	backup.NewHandler(db, cfgSvc, rc, backup.WithLogger(a.logger)).RegisterRoutes(api, authMW)
+	backup.NewHandler(db, cfgSvc, rc, backup.WithLogger(a.logger), backup.WithHub(a.hub), backup.WithScheduler(a.backupSched), backup.WithSearchReindex(searchSvc.ReindexIfEnabled)).RegisterRoutes(api, authMW)
 
 	// Analytics (admin)
-	analyze.NewHandler(db).RegisterRoutes(api, authMW)
+	analyze.NewHandler(db, a.cfg).RegisterRoutes(api, authMW)
 
 	// Options (key-value store)
 	option.NewHandler(db).RegisterRoutes(api, authMW)
@@ -313,6 +430,10 @@ func (a *App) registerRoutes(rc *pkgredis.Client) {
 	// Slug tracker (admin + public redirect)
 	slugtracker.NewHandler(slugTrackerSvc).RegisterRoutes(api, authMW)
 
+	// Runtime config reload and cluster workers (admin)
+	api.POST("/system/reload-config", authMW, a.reloadConfig)
+	api.GET("/system/cluster", authMW, a.clusterStatus)
+
 	// Cron task management (admin)
 	crontask.NewHandler(a.sched, taskSvc).RegisterRoutes(api, authMW)
 
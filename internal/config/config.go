@@ -27,8 +27,12 @@ func Load(configPath string) (*AppConfig, error) {
 	if err := decoder.Decode(&raw); err != nil {
 		return nil, fmt.Errorf("parse config file %q: %w", path, err)
 	}
+	if err := resolveRawSecretFiles(&raw); err != nil {
+		return nil, fmt.Errorf("load secrets for config file %q: %w", path, err)
+	}
 
 	applyRawAppConfig(&cfg, raw)
+	cfg.Source = path
 	if cfg.Port < 1 || cfg.Port > 65535 {
 		return nil, fmt.Errorf("invalid port %d in %q, expected 1-65535", cfg.Port, path)
 	}
@@ -82,6 +86,7 @@ func defaultAppConfig() AppConfig {
 			Port:      defaultMeiliPort,
 			IndexName: defaultMeiliIndex,
 		},
+		Metrics: MetricsRuntimeConfig{Enable: true},
 	}
 	cfg.Database = normalizeDatabaseConfig(cfg.Database)
 	cfg.Redis = normalizeRedisConfig(cfg.Redis)
@@ -150,6 +155,25 @@ func applyRawAppConfig(cfg *AppConfig, raw rawAppConfig) {
 		v := *raw.LogRotateKeep
 		cfg.LogRotateKeep = &v
 	}
+	if raw.FetchMaxSize != nil {
+		v := *raw.FetchMaxSize
+		cfg.FetchMaxSize = &v
+	}
+	if raw.SlowFunction != nil {
+		v := *raw.SlowFunction
+		cfg.SlowFunction = &v
+	}
+	if raw.FnMaxMemory != nil {
+		v := *raw.FnMaxMemory
+		cfg.FnMaxMemory = &v
+	}
+	if raw.FnMaxResponse != nil {
+		v := *raw.FnMaxResponse
+		cfg.FnMaxResponse = &v
+	}
+	if raw.FnModules != nil {
+		cfg.FnModules = append([]string{}, raw.FnModules...)
+	}
 	if raw.TrustedProxy.Enable != nil {
 		cfg.TrustedProxy.Enable = *raw.TrustedProxy.Enable
 	}
@@ -159,6 +183,30 @@ func applyRawAppConfig(cfg *AppConfig, raw rawAppConfig) {
 	if raw.TrustedProxy.Proxies != nil {
 		cfg.TrustedProxy.Proxies = normalizeStringList(raw.TrustedProxy.Proxies)
 	}
+	if raw.Metrics.Enable != nil {
+		cfg.Metrics.Enable = *raw.Metrics.Enable
+	}
+	if v := strings.TrimSpace(raw.Metrics.Listen); v != "" {
+		cfg.Metrics.Listen = v
+	}
+	if v := strings.TrimSpace(raw.Metrics.Token); v != "" {
+		cfg.Metrics.Token = v
+	}
+	cfg.StatCacheTTL = raw.StatCacheTTL
+	if raw.AnalyzeKeep != nil {
+		v := *raw.AnalyzeKeep
+		cfg.AnalyzeKeep = &v
+	}
+	if raw.DraftVersions != nil {
+		v := *raw.DraftVersions
+		cfg.DraftVersions = &v
+	}
+	if raw.ImageFetches != nil {
+		v := *raw.ImageFetches
+		cfg.ImageFetches = &v
+	}
+	cfg.IPLocation = raw.IPLocation
+	cfg.Gateway = raw.Gateway
 
 	switch {
 	case raw.AllowedOrigins != nil:
@@ -398,6 +446,94 @@ func (c *AppConfig) LogRotateKeepCount() (int, bool) {
 	return *c.LogRotateKeep, true
 }
 
+// ServerlessFetchMaxSizeMB is the response size cap for fetch() in serverless snippets.
+func (c *AppConfig) ServerlessFetchMaxSizeMB() (int, bool) {
+	if c == nil || c.FetchMaxSize == nil || *c.FetchMaxSize <= 0 {
+		return 0, false
+	}
+	return *c.FetchMaxSize, true
+}
+
+// ServerlessSlowThresholdMs is the execution time above which a snippet run is logged as slow.
+func (c *AppConfig) ServerlessSlowThresholdMs() (int, bool) {
+	if c == nil || c.SlowFunction == nil || *c.SlowFunction <= 0 {
+		return 0, false
+	}
+	return *c.SlowFunction, true
+}
+
+// ServerlessMaxMemoryMB is how much a single snippet run may hold on top of a
+// fresh runtime before it is interrupted.
+func (c *AppConfig) ServerlessMaxMemoryMB() (int, bool) {
+	if c == nil || c.FnMaxMemory == nil || *c.FnMaxMemory <= 0 {
+		return 0, false
+	}
+	return *c.FnMaxMemory, true
+}
+
+// ServerlessMaxResponseMB is the largest serialized result a snippet may return.
+func (c *AppConfig) ServerlessMaxResponseMB() (int, bool) {
+	if c == nil || c.FnMaxResponse == nil || *c.FnMaxResponse <= 0 {
+		return 0, false
+	}
+	return *c.FnMaxResponse, true
+}
+
+// ServerlessRequireAllowlist lists the modules snippets may require(). An explicit
+// empty list disables require() entirely.
+func (c *AppConfig) ServerlessRequireAllowlist() ([]string, bool) {
+	if c == nil || c.FnModules == nil {
+		return nil, false
+	}
+	return c.FnModules, true
+}
+
+// StatCacheTTLSeconds is the configured cache lifetime of an /aggregate stat
+// endpoint ("stat", "tag_cloud" or "count_site_words"). 0 means uncached.
+func (c *AppConfig) StatCacheTTLSeconds(endpoint string) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	var v *int
+	switch endpoint {
+	case "stat":
+		v = c.StatCacheTTL.Stat
+	case "tag_cloud":
+		v = c.StatCacheTTL.TagCloud
+	case "count_site_words":
+		v = c.StatCacheTTL.SiteWords
+	}
+	if v == nil || *v < 0 {
+		return 0, false
+	}
+	return *v, true
+}
+
+// AnalyzeRetentionDays is how many days of page-view analytics are kept.
+func (c *AppConfig) AnalyzeRetentionDays() (int, bool) {
+	if c == nil || c.AnalyzeKeep == nil || *c.AnalyzeKeep <= 0 {
+		return 0, false
+	}
+	return *c.AnalyzeKeep, true
+}
+
+// DraftMaxVersions is how many autosaved versions are kept per post or note.
+func (c *AppConfig) DraftMaxVersions() (int, bool) {
+	if c == nil || c.DraftVersions == nil || *c.DraftVersions <= 0 {
+		return 0, false
+	}
+	return *c.DraftVersions, true
+}
+
+// ImageMetaConcurrency is how many article images are fetched at once when
+// reading their dimensions and accent color.
+func (c *AppConfig) ImageMetaConcurrency() (int, bool) {
+	if c == nil || c.ImageFetches == nil || *c.ImageFetches <= 0 {
+		return 0, false
+	}
+	return *c.ImageFetches, true
+}
+
 func (c *AppConfig) BackupDir() string {
 	if c == nil {
 		return ResolveRuntimePath("", "backups")
@@ -454,11 +590,15 @@ func DefaultFullConfig() FullConfig {
 			AntiSpam:           false,
 			AIReview:           false,
 			RecordIPLocation:   true,
+			RenderMarkdown:     false,
+			RateLimitCount:     5,
+			RateLimitWindow:    60,
 			AIReviewType:       "binary",
 			AIReviewThreshold:  5,
 			TestAIReview:       "__action__",
 			DisableComment:     false,
 			BlockIPs:           []string{},
+			BlockMailDomains:   []string{},
 			DisableNoChinese:   false,
 			SpamKeywords:       []string{},
 			CommentShouldAudit: false,
@@ -476,17 +616,25 @@ func DefaultFullConfig() FullConfig {
 			EnableAvatarInternalization: true,
 		},
 		S3Options: S3Options{
-			Endpoint:        "",
-			AccessKeyID:     "",
-			SecretAccessKey: "",
-			Bucket:          "",
-			Region:          "",
-			CustomDomain:    "",
-			PathStyleAccess: false,
+			Endpoint:             "",
+			AccessKeyID:          "",
+			SecretAccessKey:      "",
+			Bucket:               "",
+			Region:               "",
+			CustomDomain:         "",
+			PathStyleAccess:      false,
+			StorageClass:         "",
+			ServerSideEncryption: "",
+			SSEKMSKeyID:          "",
 		},
 		BackupOptions: BackupOptions{
-			Enable: false,
-			Path:   "backups/{Y}/{m}/backup-{Y}{m}{d}-{h}{i}{s}.zip",
+			Enable:        false,
+			Path:          "backups/{Y}/{m}/backup-{Y}{m}{d}-{h}{i}{s}.zip",
+			Cron:          "0 1 * * *",
+			Retention:     0,
+			RetentionDays: 0,
+			Compress:      false,
+			Passphrase:    "",
 		},
 		ImageBedOptions: ImageBedOptions{
 			Enable:         false,
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// resolveRawSecretFiles replaces inline secrets with the contents of their
+// `*_file` counterparts (Docker/K8s secret mounts). The file wins over every
+// inline spelling of the same secret, nested or flat; setting two files for
+// one secret is an error.
+func resolveRawSecretFiles(raw *rawAppConfig) error {
+	if raw == nil {
+		return nil
+	}
+
+	secrets := []struct {
+		files []secretFile
+		// inline are all the keys holding the secret itself.
+		inline []*string
+	}{
+		{
+			files:  []secretFile{{"jwt_secret_file", raw.JWTSecretFile}},
+			inline: []*string{&raw.JWTSecret, &raw.JWTSecretLegacy},
+		},
+		{
+			files:  []secretFile{{"database.password_file", raw.Database.PasswordFile}, {"db_password_file", raw.DBPasswordFile}},
+			inline: []*string{&raw.Database.Password, &raw.DBPassword},
+		},
+		{
+			files:  []secretFile{{"redis.password_file", raw.Redis.PasswordFile}, {"redis_password_file", raw.RedisPasswordFile}},
+			inline: []*string{&raw.Redis.Password, &raw.RedisPassword},
+		},
+		{
+			files:  []secretFile{{"meilisearch.api_key_file", raw.MeiliSearch.APIKeyFile}, {"meili_api_key_file", raw.MeiliAPIKeyFile}},
+			inline: []*string{&raw.MeiliSearch.APIKey, &raw.MeiliAPIKey},
+		},
+		{
+			files:  []secretFile{{"metrics.token_file", raw.Metrics.TokenFile}},
+			inline: []*string{&raw.Metrics.Token},
+		},
+	}
+
+	for _, secret := range secrets {
+		var chosen *secretFile
+		for i := range secret.files {
+			f := &secret.files[i]
+			if strings.TrimSpace(f.path) == "" {
+				continue
+			}
+			if chosen != nil {
+				return fmt.Errorf("%s and %s are both set", chosen.key, f.key)
+			}
+			chosen = f
+		}
+		if chosen == nil {
+			continue
+		}
+		value, err := readSecretFile(strings.TrimSpace(chosen.path))
+		if err != nil {
+			return fmt.Errorf("%s: %w", chosen.key, err)
+		}
+		// Flat keys are applied after nested ones, so every spelling gets
+		// the file's value.
+		for _, target := range secret.inline {
+			*target = value
+		}
+	}
+	return nil
+}
+
+type secretFile struct {
+	key  string
+	path string
+}
+
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(ResolveRuntimePath(path, ""))
+	if err != nil {
+		return "", fmt.Errorf("read secret file %q: %w", path, err)
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", fmt.Errorf("secret file %q is empty", path)
+	}
+	return value, nil
+}
@@ -15,10 +15,24 @@ type AppConfig struct {
 	Paths          RuntimePathsConfig        `yaml:"paths"`
 	LogRotateSize  *int                      `yaml:"log_rotate_size_mb"`
 	LogRotateKeep  *int                      `yaml:"log_rotate_keep"`
+	FetchMaxSize   *int                      `yaml:"serverless_fetch_max_size_mb"`
+	SlowFunction   *int                      `yaml:"serverless_slow_threshold_ms"`
+	FnMaxMemory    *int                      `yaml:"serverless_max_memory_mb"`
+	FnMaxResponse  *int                      `yaml:"serverless_max_response_mb"`
+	FnModules      []string                  `yaml:"serverless_require_allowlist"`
 	AllowedOrigins []string                  `yaml:"allowed_origins"`
 	JWTSecret      string                    `yaml:"jwt_secret"`
 	Timezone       string                    `yaml:"timezone"`
 	MeiliSearch    MeiliSearchRuntimeConfig  `yaml:"meilisearch"`
+	Metrics        MetricsRuntimeConfig      `yaml:"metrics"`
+	StatCacheTTL   StatCacheTTLConfig        `yaml:"stat_cache_ttl"`
+	AnalyzeKeep    *int                      `yaml:"analyze_retention_days"`
+	DraftVersions  *int                      `yaml:"draft_max_versions"`
+	ImageFetches   *int                      `yaml:"image_meta_concurrency"`
+	IPLocation     IPLocationConfig          `yaml:"ip_location"`
+	Gateway        GatewayRuntimeConfig      `yaml:"gateway"`
+	// Source is the file this config was loaded from, used to reload it.
+	Source string `yaml:"-"`
 }
 
 type DatabaseRuntimeConfig struct {
@@ -55,6 +69,36 @@ type TrustedProxyRuntimeConfig struct {
 	Proxies []string `yaml:"proxies"`
 }
 
+// StatCacheTTLConfig sets how long, in seconds, each /aggregate stat endpoint is
+// cached in Redis. Unset keeps the default; 0 disables the cache.
+type StatCacheTTLConfig struct {
+	Stat      *int `yaml:"stat"`
+	TagCloud  *int `yaml:"tag_cloud"`
+	SiteWords *int `yaml:"count_site_words"`
+}
+
+// GatewayRuntimeConfig tunes the websocket gateway. Durations are in
+// seconds; zero keeps the defaults.
+type GatewayRuntimeConfig struct {
+	PingInterval int `yaml:"ping_interval"`
+	PingTimeout  int `yaml:"ping_timeout"`
+	AuthGrace    int `yaml:"auth_grace"`
+}
+
+// IPLocationConfig selects how comment IPs are resolved to locations. A local
+// mmdb file wins over the HTTP service.
+type IPLocationConfig struct {
+	MMDBPath string `yaml:"mmdb_path"`
+	APIURL   string `yaml:"api_url"` // must contain {ip}
+	Language string `yaml:"language"`
+}
+
+type MetricsRuntimeConfig struct {
+	Enable bool   `yaml:"enable"`
+	Listen string `yaml:"listen"` // empty serves /metrics on the main port
+	Token  string `yaml:"token"`
+}
+
 type MeiliSearchRuntimeConfig struct {
 	Enable    bool   `yaml:"enable"`
 	HasEnable bool   `yaml:"-"`
@@ -83,6 +127,7 @@ type rawAppConfig struct {
 	DBPort             int                   `yaml:"db_port"`
 	DBUser             string                `yaml:"db_user"`
 	DBPassword         string                `yaml:"db_password"`
+	DBPasswordFile     string                `yaml:"db_password_file"`
 	DBName             string                `yaml:"db_name"`
 	DBCharset          string                `yaml:"db_charset"`
 	DBLoc              string                `yaml:"db_loc"`
@@ -91,6 +136,7 @@ type rawAppConfig struct {
 	RedisPort          int                   `yaml:"redis_port"`
 	RedisUsername      string                `yaml:"redis_username"`
 	RedisPassword      string                `yaml:"redis_password"`
+	RedisPasswordFile  string                `yaml:"redis_password_file"`
 	RedisDB            *int                  `yaml:"redis_db"`
 	RedisTLS           *bool                 `yaml:"redis_tls"`
 	Env                string                `yaml:"env"`
@@ -104,6 +150,11 @@ type rawAppConfig struct {
 	LogsDir            string                `yaml:"logs_dir"`
 	LogRotateSize      *int                  `yaml:"log_rotate_size_mb"`
 	LogRotateKeep      *int                  `yaml:"log_rotate_keep"`
+	FetchMaxSize       *int                  `yaml:"serverless_fetch_max_size_mb"`
+	SlowFunction       *int                  `yaml:"serverless_slow_threshold_ms"`
+	FnMaxMemory        *int                  `yaml:"serverless_max_memory_mb"`
+	FnMaxResponse      *int                  `yaml:"serverless_max_response_mb"`
+	FnModules          []string              `yaml:"serverless_require_allowlist"`
 	BackupDir          string                `yaml:"backup_dir"`
 	BackupsDir         string                `yaml:"backups_dir"`
 	StaticDir          string                `yaml:"static_dir"`
@@ -111,6 +162,7 @@ type rawAppConfig struct {
 	AllowedOrigins     []string              `yaml:"allowed_origins"`
 	CORSAllowedOrigins []string              `yaml:"cors_allowed_origins"`
 	JWTSecret          string                `yaml:"jwt_secret"`
+	JWTSecretFile      string                `yaml:"jwt_secret_file"`
 	JWTSecretLegacy    string                `yaml:"jwtsecret"`
 	Timezone           string                `yaml:"timezone"`
 	TimeZone           string                `yaml:"time_zone"`
@@ -121,36 +173,46 @@ type rawAppConfig struct {
 	MeiliHost          string                `yaml:"meili_host"`
 	MeiliPort          int                   `yaml:"meili_port"`
 	MeiliAPIKey        string                `yaml:"meili_api_key"`
+	MeiliAPIKeyFile    string                `yaml:"meili_api_key_file"`
 	MeiliMasterKey     string                `yaml:"meili_master_key"`
 	MeiliIndexName     string                `yaml:"meili_index_name"`
+	Metrics            rawMetricsConfig      `yaml:"metrics"`
+	StatCacheTTL       StatCacheTTLConfig    `yaml:"stat_cache_ttl"`
+	AnalyzeKeep        *int                  `yaml:"analyze_retention_days"`
+	DraftVersions      *int                  `yaml:"draft_max_versions"`
+	ImageFetches       *int                  `yaml:"image_meta_concurrency"`
+	IPLocation         IPLocationConfig      `yaml:"ip_location"`
+	Gateway            GatewayRuntimeConfig  `yaml:"gateway"`
 }
 
 type rawDatabaseConfig struct {
-	DSN       string            `yaml:"dsn"`
-	URL       string            `yaml:"url"`
-	Host      string            `yaml:"host"`
-	Port      int               `yaml:"port"`
-	User      string            `yaml:"user"`
-	Username  string            `yaml:"username"`
-	Password  string            `yaml:"password"`
-	Name      string            `yaml:"name"`
-	DBName    string            `yaml:"db_name"`
-	Charset   string            `yaml:"charset"`
-	ParseTime *bool             `yaml:"parse_time"`
-	Loc       string            `yaml:"loc"`
-	Params    map[string]string `yaml:"params"`
+	DSN          string            `yaml:"dsn"`
+	URL          string            `yaml:"url"`
+	Host         string            `yaml:"host"`
+	Port         int               `yaml:"port"`
+	User         string            `yaml:"user"`
+	Username     string            `yaml:"username"`
+	Password     string            `yaml:"password"`
+	PasswordFile string            `yaml:"password_file"`
+	Name         string            `yaml:"name"`
+	DBName       string            `yaml:"db_name"`
+	Charset      string            `yaml:"charset"`
+	ParseTime    *bool             `yaml:"parse_time"`
+	Loc          string            `yaml:"loc"`
+	Params       map[string]string `yaml:"params"`
 }
 
 type rawRedisConfig struct {
-	URL      string            `yaml:"url"`
-	Host     string            `yaml:"host"`
-	Port     int               `yaml:"port"`
-	Username string            `yaml:"username"`
-	Password string            `yaml:"password"`
-	DB       *int              `yaml:"db"`
-	TLS      *bool             `yaml:"tls"`
-	Scheme   string            `yaml:"scheme"`
-	Params   map[string]string `yaml:"params"`
+	URL          string            `yaml:"url"`
+	Host         string            `yaml:"host"`
+	Port         int               `yaml:"port"`
+	Username     string            `yaml:"username"`
+	Password     string            `yaml:"password"`
+	PasswordFile string            `yaml:"password_file"`
+	DB           *int              `yaml:"db"`
+	TLS          *bool             `yaml:"tls"`
+	Scheme       string            `yaml:"scheme"`
+	Params       map[string]string `yaml:"params"`
 }
 
 type rawTrustedProxyConfig struct {
@@ -159,14 +221,22 @@ type rawTrustedProxyConfig struct {
 	Proxies []string `yaml:"proxies"`
 }
 
-type rawMeiliSearchConfig struct {
+type rawMetricsConfig struct {
 	Enable    *bool  `yaml:"enable"`
-	URL       string `yaml:"url"`
-	Host      string `yaml:"host"`
-	Port      int    `yaml:"port"`
-	APIKey    string `yaml:"api_key"`
-	MasterKey string `yaml:"master_key"`
-	IndexName string `yaml:"index_name"`
+	Listen    string `yaml:"listen"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+type rawMeiliSearchConfig struct {
+	Enable     *bool  `yaml:"enable"`
+	URL        string `yaml:"url"`
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port"`
+	APIKey     string `yaml:"api_key"`
+	APIKeyFile string `yaml:"api_key_file"`
+	MasterKey  string `yaml:"master_key"`
+	IndexName  string `yaml:"index_name"`
 }
 
 type rawPathsConfig struct {
@@ -256,14 +326,25 @@ type CommentOptions struct {
 	DisableComment     bool     `json:"disable_comment"`
 	SpamKeywords       []string `json:"spam_keywords"`
 	BlockIPs           []string `json:"block_ips"`
+	BlockMailDomains   []string `json:"block_mail_domains"` // "example.com" or "*.example.com" for its subdomains
 	DisableNoChinese   bool     `json:"disable_no_chinese"`
 	CommentShouldAudit bool     `json:"comment_should_audit"`
 	RecordIPLocation   bool     `json:"record_ip_location"`
+	RenderMarkdown     bool     `json:"render_markdown"`   // add sanitized html next to text in comment responses
+	RateLimitCount     int      `json:"rate_limit_count"`  // anonymous comments per IP per window, 0 disables
+	RateLimitWindow    int      `json:"rate_limit_window"` // seconds, default 60
+	HoneypotField      string   `json:"honeypot_field"`    // meta key of a hidden form field bots fill in; empty disables
+	MinDwellSeconds    int      `json:"min_dwell_seconds"` // minimum seconds between meta.rendered_at and submit (required when set), 0 disables
 }
 
 type BackupOptions struct {
-	Enable bool   `json:"enable"`
-	Path   string `json:"path"`
+	Enable        bool   `json:"enable"`
+	Path          string `json:"path"`
+	Cron          string `json:"cron"`           // five-field cron expression, e.g. "0 1 * * *"
+	Retention     int    `json:"retention"`      // local backups to keep, 0 keeps all
+	RetentionDays int    `json:"retention_days"` // drop local backups older than N days, 0 keeps all
+	Compress      bool   `json:"compress"`       // store tables as gzipped .bson.gz entries
+	Passphrase    string `json:"passphrase"`     // encrypt archives (AES-256-GCM) into .zip.enc when set
 }
 
 type BaiduSearchOptions struct {
@@ -300,6 +381,13 @@ type S3Options struct {
 	Region          string `json:"region"`
 	CustomDomain    string `json:"custom_domain"`
 	PathStyleAccess bool   `json:"path_style_access"`
+	// StorageClass is sent with uploads, e.g. STANDARD_IA; empty keeps the
+	// bucket default.
+	StorageClass string `json:"storage_class"`
+	// ServerSideEncryption is AES256, aws:kms or aws:kms:dsse; empty sends
+	// no encryption headers. SSEKMSKeyID selects the KMS key for aws:kms.
+	ServerSideEncryption string `json:"server_side_encryption"`
+	SSEKMSKeyID          string `json:"sse_kms_key_id"`
 }
 
 type ImageBedOptions struct {
@@ -307,6 +395,7 @@ type ImageBedOptions struct {
 	Path           string `json:"path"`
 	AllowedFormats string `json:"allowed_formats"`
 	MaxSizeMB      int    `json:"max_size_mb"`
+	StripEXIF      bool   `json:"strip_exif"` // re-encode JPEG and PNG uploads to drop metadata
 }
 
 type ImageStorageOptions struct {
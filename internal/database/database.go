@@ -80,6 +80,7 @@ func migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&models.UserModel{},
 		&models.UserSession{},
+		&models.LoginLog{},
 		&models.APIToken{},
 		&models.OAuth2Token{},
 		&models.AuthnModel{},
@@ -102,6 +103,7 @@ func migrate(db *gorm.DB) error {
 		&models.WebhookModel{},
 		&models.WebhookEventModel{},
 		&models.SnippetModel{},
+		&models.SnippetRunModel{},
 		&models.ProjectModel{},
 		&models.LinkModel{},
 		&models.SayModel{},
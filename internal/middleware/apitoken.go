@@ -0,0 +1,315 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// API token scopes. A token without scopes has full access.
+const (
+	APITokenScopeRead             = "read"
+	APITokenScopePostsWrite       = "posts:write"
+	APITokenScopeCommentsModerate = "comments:moderate"
+	APITokenScopeBackups          = "backups"
+	APITokenScopeServerless       = "serverless"
+)
+
+// APITokenScopes lists every scope a token may be granted.
+var APITokenScopes = []string{
+	APITokenScopeRead,
+	APITokenScopePostsWrite,
+	APITokenScopeCommentsModerate,
+	APITokenScopeBackups,
+	APITokenScopeServerless,
+}
+
+const (
+	// apiTokenCacheTTL bounds how stale a cached token may get when a
+	// revocation broadcast is missed.
+	apiTokenCacheTTL        = time.Minute
+	apiTokenCacheMax        = 1024
+	apiTokenTouchInterval   = time.Minute
+	apiTokenRevokeChannel   = "mx:auth:api-token:revoke"
+	apiTokenResubscribeMin  = time.Second
+	apiTokenResubscribeMax  = 30 * time.Second
+	apiTokenRedisOpsTimeout = 2 * time.Second
+)
+
+var (
+	errAPITokenNotFound = errors.New("api token not found")
+	errAPITokenExpired  = errors.New("api token expired")
+	errAPITokenScope    = errors.New("api token scope not allowed")
+)
+
+// readScopeGroups are the route groups serving site content, the only ones
+// whose GET endpoints the read scope covers. Groups exposing logs, secrets,
+// personal data or side effects stay out, as does anything added later
+// until it is listed here.
+var readScopeGroups = map[string]bool{
+	"posts": true, "notes": true, "pages": true, "categories": true, "topics": true,
+	"says": true, "recently": true, "shorthand": true, "links": true, "friends": true,
+	"projects": true, "aggregate": true, "search": true,
+	"feed": true, "feed.xml": true, "atom.xml": true, "sitemap": true, "sitemap.xml": true,
+}
+
+var apiVersionSegment = regexp.MustCompile(`^v\d+$`)
+
+type apiTokenEntry struct {
+	id        string
+	userID    string
+	scopes    []string
+	expiredAt *time.Time
+	loadedAt  time.Time
+	touchedAt time.Time
+}
+
+func (e *apiTokenEntry) restricted() bool { return len(e.scopes) > 0 }
+
+func (e *apiTokenEntry) hasScope(scope string) bool {
+	if !e.restricted() {
+		return true
+	}
+	for _, s := range e.scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the token may call the route matched by c.
+func (e *apiTokenEntry) allows(c *gin.Context) bool {
+	if !e.restricted() {
+		return true
+	}
+	scope := requiredAPITokenScope(c.Request.Method, c.FullPath())
+	return scope != "" && e.hasScope(scope)
+}
+
+var apiTokenCache = struct {
+	sync.Mutex
+	entries map[string]*apiTokenEntry
+}{entries: map[string]*apiTokenEntry{}}
+
+// IsValidAPITokenScope reports whether scope is one of APITokenScopes.
+func IsValidAPITokenScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HashAPIToken returns the digest stored for a raw API token.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIToken reports whether token has the API token format rather than a JWT.
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
+
+// RevokeAPIToken drops the token from this worker's cache and tells the
+// other workers to do the same, so a deleted token stops working at once.
+func RevokeAPIToken(tokenID string) {
+	forgetAPIToken(tokenID)
+	if pkgredis.Default == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), apiTokenRedisOpsTimeout)
+	defer cancel()
+	_ = pkgredis.Default.Publish(ctx, apiTokenRevokeChannel, tokenID)
+}
+
+// SubscribeAPITokenRevocations applies revocations published by other
+// workers until ctx is done, reconnecting with backoff.
+func SubscribeAPITokenRevocations(ctx context.Context, logger *zap.Logger) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	backoff := apiTokenResubscribeMin
+	for {
+		if pkgredis.Default == nil {
+			return
+		}
+		if listenAPITokenRevocations(ctx, pkgredis.Default.Subscribe(ctx, apiTokenRevokeChannel)) {
+			backoff = apiTokenResubscribeMin
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		logger.Info("API Token 吊销订阅已断开，正在重连")
+		backoff *= 2
+		if backoff > apiTokenResubscribeMax {
+			backoff = apiTokenResubscribeMax
+		}
+	}
+}
+
+func listenAPITokenRevocations(ctx context.Context, pubsub *redis.PubSub) bool {
+	defer pubsub.Close()
+
+	established := false
+	ch := pubsub.ChannelWithSubscriptions()
+	for {
+		select {
+		case <-ctx.Done():
+			return established
+		case raw, ok := <-ch:
+			if !ok {
+				return established
+			}
+			switch msg := raw.(type) {
+			case *redis.Subscription:
+				if msg.Kind != "subscribe" {
+					continue
+				}
+				// Revocations published while disconnected were missed.
+				if established {
+					clearAPITokenCache()
+				}
+				established = true
+			case *redis.Message:
+				forgetAPIToken(msg.Payload)
+			}
+		}
+	}
+}
+
+// lookupAPIToken resolves a raw API token, serving repeat lookups from the
+// cache. Tokens are matched by digest, or by raw value for legacy rows.
+func lookupAPIToken(db *gorm.DB, token string) (*apiTokenEntry, error) {
+	hash := HashAPIToken(token)
+	now := time.Now()
+
+	apiTokenCache.Lock()
+	entry, ok := apiTokenCache.entries[hash]
+	apiTokenCache.Unlock()
+
+	if !ok || now.Sub(entry.loadedAt) >= apiTokenCacheTTL {
+		var row models.APIToken
+		res := db.Where("token IN ?", []string{hash, token}).Limit(1).Find(&row)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			apiTokenCache.Lock()
+			delete(apiTokenCache.entries, hash)
+			apiTokenCache.Unlock()
+			return nil, errAPITokenNotFound
+		}
+		entry = &apiTokenEntry{
+			id:        row.ID,
+			userID:    row.UserID,
+			scopes:    row.Scopes,
+			expiredAt: row.ExpiredAt,
+			loadedAt:  now,
+		}
+		if row.LastUsedAt != nil {
+			entry.touchedAt = *row.LastUsedAt
+		}
+		apiTokenCache.Lock()
+		if len(apiTokenCache.entries) >= apiTokenCacheMax {
+			apiTokenCache.entries = map[string]*apiTokenEntry{}
+		}
+		apiTokenCache.entries[hash] = entry
+		apiTokenCache.Unlock()
+	}
+
+	if entry.expiredAt != nil && !entry.expiredAt.After(now) {
+		return nil, errAPITokenExpired
+	}
+	return entry, nil
+}
+
+// touchAPIToken records the token as used, writing at most once per
+// apiTokenTouchInterval per worker.
+func touchAPIToken(db *gorm.DB, entry *apiTokenEntry) {
+	now := time.Now()
+	apiTokenCache.Lock()
+	due := now.Sub(entry.touchedAt) >= apiTokenTouchInterval
+	if due {
+		entry.touchedAt = now
+	}
+	apiTokenCache.Unlock()
+	if !due {
+		return
+	}
+	_ = db.Model(&models.APIToken{}).Where("id = ?", entry.id).UpdateColumn("last_used_at", now).Error
+}
+
+func forgetAPIToken(tokenID string) {
+	apiTokenCache.Lock()
+	defer apiTokenCache.Unlock()
+	for hash, entry := range apiTokenCache.entries {
+		if entry.id == tokenID {
+			delete(apiTokenCache.entries, hash)
+		}
+	}
+}
+
+func clearAPITokenCache() {
+	apiTokenCache.Lock()
+	apiTokenCache.entries = map[string]*apiTokenEntry{}
+	apiTokenCache.Unlock()
+}
+
+// requiredAPITokenScope maps a route to the scope a restricted token needs
+// for it, or "" when no scope grants access.
+func requiredAPITokenScope(method, fullPath string) string {
+	group := apiRouteGroup(fullPath)
+	switch group {
+	case "":
+		return ""
+	case "backups":
+		return APITokenScopeBackups
+	case "serverless", "fn":
+		return APITokenScopeServerless
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		if readScopeGroups[group] {
+			return APITokenScopeRead
+		}
+		return ""
+	}
+	switch group {
+	case "posts":
+		return APITokenScopePostsWrite
+	case "comments":
+		return APITokenScopeCommentsModerate
+	}
+	return ""
+}
+
+// apiRouteGroup returns the first segment of a route after the API prefix,
+// e.g. "posts" for /api/v2/posts/:id.
+func apiRouteGroup(fullPath string) string {
+	segments := strings.Split(strings.Trim(fullPath, "/"), "/")
+	for len(segments) > 0 && (segments[0] == "api" || apiVersionSegment.MatchString(segments[0])) {
+		segments = segments[1:]
+	}
+	if len(segments) == 0 {
+		return ""
+	}
+	return segments[0]
+}
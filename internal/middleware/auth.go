@@ -20,11 +20,15 @@ const (
 // Auth returns a middleware that enforces JWT or API token authentication.
 func Auth(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		claims, err := ValidateTokenClaims(db, extractToken(c))
+		claims, apiToken, err := authenticate(db, extractToken(c))
 		if err != nil {
 			response.Unauthorized(c)
 			return
 		}
+		if apiToken != nil && !apiToken.allows(c) {
+			response.ForbiddenMsg(c, "API Token 没有访问该接口的权限")
+			return
+		}
 		c.Set(ContextKeyUserID, claims.UserID)
 		if claims.SessionID != "" {
 			c.Set(ContextKeySID, claims.SessionID)
@@ -37,7 +41,9 @@ func Auth(db *gorm.DB) gin.HandlerFunc {
 // OptionalAuth sets the user ID if a valid token is present, but does not block the request.
 func OptionalAuth(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if claims, err := ValidateTokenClaims(db, extractToken(c)); err == nil && claims.UserID != "" {
+		// A restricted API token outside its scopes is treated as a guest.
+		claims, apiToken, err := authenticate(db, extractToken(c))
+		if err == nil && claims.UserID != "" && (apiToken == nil || apiToken.allows(c)) {
 			c.Set(ContextKeyUserID, claims.UserID)
 			if claims.SessionID != "" {
 				c.Set(ContextKeySID, claims.SessionID)
@@ -57,36 +63,64 @@ func ValidateToken(db *gorm.DB, rawToken string) (string, error) {
 	return claims.UserID, nil
 }
 
-// ValidateTokenClaims validates JWT/API token and returns claims.
+// ValidateTokenClaims validates JWT/API token and returns claims. API tokens
+// restricted to scopes are rejected, as the caller cannot check them.
 func ValidateTokenClaims(db *gorm.DB, rawToken string) (*jwt.Claims, error) {
+	claims, apiToken, err := authenticate(db, rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if apiToken != nil && apiToken.restricted() {
+		return nil, errAPITokenScope
+	}
+	return claims, nil
+}
+
+// ValidateScopedToken is ValidateTokenClaims for callers guarding a single
+// scope: restricted API tokens holding scope are accepted too.
+func ValidateScopedToken(db *gorm.DB, rawToken, scope string) (*jwt.Claims, error) {
+	claims, apiToken, err := authenticate(db, rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if apiToken != nil && !apiToken.hasScope(scope) {
+		return nil, errAPITokenScope
+	}
+	return claims, nil
+}
+
+// authenticate validates a JWT or API token. For API tokens it also returns
+// the token entry so callers can enforce its scopes.
+func authenticate(db *gorm.DB, rawToken string) (*jwt.Claims, *apiTokenEntry, error) {
 	token := NormalizeToken(rawToken)
 	if token == "" {
-		return nil, errors.New("token is required")
+		return nil, nil, errors.New("token is required")
 	}
 
-	if strings.HasPrefix(token, apiTokenPrefix) {
-		userID, err := validateAPIToken(db, token)
+	if IsAPIToken(token) {
+		entry, err := lookupAPIToken(db, token)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return &jwt.Claims{UserID: userID}, nil
+		touchAPIToken(db, entry)
+		return &jwt.Claims{UserID: entry.userID}, entry, nil
 	}
 
 	claims, err := jwt.Parse(token)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if strings.TrimSpace(claims.UserID) == "" {
-		return nil, errors.New("invalid token user")
+		return nil, nil, errors.New("invalid token user")
 	}
 	active, err := sessionpkg.IsActive(db, claims.UserID, claims.SessionID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if !active {
-		return nil, errors.New("session expired or revoked")
+		return nil, nil, errors.New("session expired or revoked")
 	}
-	return claims, nil
+	return claims, nil, nil
 }
 
 // CurrentUserID extracts the authenticated user ID from context.
@@ -108,6 +142,12 @@ func IsAuthenticated(c *gin.Context) bool {
 	return CurrentUserID(c) != ""
 }
 
+// HasToken reports whether the request carries an auth token, without
+// validating it.
+func HasToken(c *gin.Context) bool {
+	return extractToken(c) != ""
+}
+
 func extractToken(c *gin.Context) string {
 	auth := c.GetHeader("Authorization")
 	if auth != "" {
@@ -137,20 +177,3 @@ func NormalizeToken(raw string) string {
 	}
 	return token
 }
-
-func validateAPIToken(db *gorm.DB, token string) (string, error) {
-	var row struct {
-		UserID string
-	}
-	err := db.Table("api_tokens").
-		Select("user_id").
-		Where("token = ? AND (expired_at IS NULL OR expired_at > NOW()) AND deleted_at IS NULL", token).
-		Scan(&row).Error
-	if err != nil {
-		return "", err
-	}
-	if row.UserID == "" {
-		return "", errors.New("api token not found")
-	}
-	return row.UserID, nil
-}
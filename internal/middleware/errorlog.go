@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	"go.uber.org/zap"
 )
 
@@ -32,6 +33,7 @@ func ErrorReporter(log *zap.Logger) gin.HandlerFunc {
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.RequestURI()),
 			zap.String("ip", c.ClientIP()),
+			zap.String(tracing.GinKey, tracing.TraceID(c)),
 		}
 		if route := c.FullPath(); route != "" {
 			fields = append(fields, zap.String("route", route))
@@ -6,33 +6,45 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/pkg/prettylog"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	"go.uber.org/zap"
 )
 
-// Logger returns a Gin middleware that logs each request
+// Logger returns a Gin middleware that logs each request. In development it
+// prints a start and an end line; in production it writes one structured line
+// per request with the trace ID, status and latency.
 func Logger(log *zap.Logger, isDev bool) gin.HandlerFunc {
 	named := log.Named("LoggingInterceptor")
 	return func(c *gin.Context) {
-		if !isDev {
-			c.Next()
-			return
-		}
-
 		start := time.Now()
 		path := c.Request.URL.Path
 		if raw := c.Request.URL.RawQuery; raw != "" {
 			path = path + "?" + raw
 		}
+		traceField := zap.String(tracing.GinKey, tracing.TraceID(c.Request.Context()))
+
+		if !isDev {
+			c.Next()
+			named.Info("request completed",
+				traceField,
+				zap.String("method", c.Request.Method),
+				zap.String("path", path),
+				zap.Int("status", c.Writer.Status()),
+				zap.Int64("latency_ms", time.Since(start).Milliseconds()),
+			)
+			return
+		}
+
 		content := fmt.Sprintf("%s -> %s", c.Request.Method, path)
 
-		named.Debug(fmt.Sprintf("+++ 收到请求：%s", content))
+		named.Debug(fmt.Sprintf("+++ 收到请求：%s", content), traceField)
 
 		c.Next()
 
 		elapsed := time.Since(start).Milliseconds()
 		named.Debug(fmt.Sprintf("--- 响应请求：%s%s",
 			content,
-			prettylog.Yellow(fmt.Sprintf(" +%dms", elapsed)),
-		))
+			prettylog.Yellow(fmt.Sprintf(" +%dms %d", elapsed, c.Writer.Status())),
+		), traceField)
 	}
 }
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("mx_http_requests_total",
+		"HTTP requests by method, route template and status code.", "method", "route", "status")
+	httpDuration = metrics.NewHistogram("mx_http_request_duration_seconds",
+		"HTTP request latency by method and route template.", nil, "method", "route")
+)
+
+// Metrics records request count and latency. Routes are labelled by their
+// template (/api/v2/posts/:id) so path parameters don't explode the series.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+		httpDuration.Observe(time.Since(start).Seconds(), method, route)
+	}
+}
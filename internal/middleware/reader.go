@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/jwt"
+	"github.com/mx-space/core/internal/pkg/response"
+	"gorm.io/gorm"
+)
+
+const (
+	ContextKeyReaderID = "reader_id"
+	// ReaderTokenHeader carries a reader token alongside any admin
+	// Authorization header.
+	ReaderTokenHeader = "X-Reader-Token"
+	ReaderTokenCookie = "mx-reader-token"
+)
+
+// ReaderAuth returns a middleware that requires a valid reader token for an
+// existing reader.
+func ReaderAuth(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		readerID, ok := validateReaderToken(db, extractReaderToken(c))
+		if !ok {
+			response.Unauthorized(c)
+			return
+		}
+		c.Set(ContextKeyReaderID, readerID)
+		c.Next()
+	}
+}
+
+// OptionalReaderAuth sets the reader ID if a valid reader token is present,
+// but does not block the request.
+func OptionalReaderAuth(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if readerID, ok := validateReaderToken(db, extractReaderToken(c)); ok {
+			c.Set(ContextKeyReaderID, readerID)
+		}
+		c.Next()
+	}
+}
+
+// CurrentReaderID extracts the authenticated reader ID from context.
+func CurrentReaderID(c *gin.Context) string {
+	v, _ := c.Get(ContextKeyReaderID)
+	id, _ := v.(string)
+	return id
+}
+
+func validateReaderToken(db *gorm.DB, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	claims, err := jwt.ParseReader(token)
+	if err != nil {
+		return "", false
+	}
+	var count int64
+	if err := db.Model(&models.ReaderModel{}).Where("id = ?", claims.ReaderID).Count(&count).Error; err != nil || count == 0 {
+		return "", false
+	}
+	return claims.ReaderID, true
+}
+
+func extractReaderToken(c *gin.Context) string {
+	if token := NormalizeToken(c.GetHeader(ReaderTokenHeader)); token != "" {
+		return token
+	}
+	if raw, err := c.Cookie(ReaderTokenCookie); err == nil {
+		if token := NormalizeToken(raw); token != "" {
+			return token
+		}
+	}
+	if auth := c.GetHeader("Authorization"); strings.TrimSpace(auth) != "" {
+		return NormalizeToken(auth)
+	}
+	return ""
+}
@@ -3,11 +3,12 @@ package middleware
 import (
 	"errors"
 	"net"
-	"net/http"
 	"runtime/debug"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	"go.uber.org/zap"
 )
 
@@ -22,6 +23,7 @@ func Recovery(log *zap.Logger) gin.HandlerFunc {
 		defer func() {
 			if recovered := recover(); recovered != nil {
 				fields := []zap.Field{
+					zap.String(tracing.GinKey, tracing.TraceID(c)),
 					zap.String("method", c.Request.Method),
 					zap.String("path", c.Request.URL.RequestURI()),
 					zap.String("ip", c.ClientIP()),
@@ -42,7 +44,7 @@ func Recovery(log *zap.Logger) gin.HandlerFunc {
 
 				fields = append(fields, zap.ByteString("stack", debug.Stack()))
 				logger.Error("panic recovered", fields...)
-				c.AbortWithStatus(http.StatusInternalServerError)
+				response.InternalError(c, nil)
 			}
 		}()
 
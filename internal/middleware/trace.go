@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/tracing"
+)
+
+// RequestID assigns every request a trace ID, reusing a valid incoming
+// X-Request-ID. The ID is echoed in the response, stored in the gin context and
+// the request context, and picked up by tracing.GetLogger and outbound calls.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := tracing.Sanitize(c.GetHeader(tracing.Header))
+		if id == "" {
+			id = tracing.NewID()
+		}
+		c.Set(tracing.GinKey, id)
+		c.Request = c.Request.WithContext(tracing.WithTraceID(c.Request.Context(), id))
+		c.Header(tracing.Header, id)
+		c.Next()
+	}
+}
@@ -33,6 +33,7 @@ type CommentModel struct {
 	State         CommentState           `json:"state"          gorm:"default:0;index"`
 	ParentID      *string                `json:"parent_id"      gorm:"index"`
 	Children      []CommentModel         `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+	ChildrenCount int                    `json:"children_count,omitempty" gorm:"-"` // direct replies, when Children is truncated
 	CommentsIndex int                    `json:"comments_index" gorm:"default:0"`
 	Key           string                 `json:"key"`
 	IP            string                 `json:"ip"`
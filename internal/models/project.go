@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // ProjectModel stores personal projects.
 type ProjectModel struct {
 	Base
@@ -11,6 +13,15 @@ type ProjectModel struct {
 	Description string      `json:"description"`
 	Avatar      string      `json:"avatar"`
 	Text        string      `json:"text"        gorm:"type:text"`
+
+	// GitHub metadata, refreshed from RepoURL by the project sync job.
+	RepoURL      string     `json:"repo_url"`
+	Stars        int        `json:"stars"         gorm:"default:0;index"`
+	Forks        int        `json:"forks"         gorm:"default:0"`
+	Language     string     `json:"language"`
+	PushedAt     *time.Time `json:"pushed_at"`
+	RepoMissing  bool       `json:"repo_missing"  gorm:"default:false"`
+	RepoSyncedAt *time.Time `json:"repo_synced_at"`
 }
 
 func (ProjectModel) TableName() string { return "projects" }
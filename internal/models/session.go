@@ -13,3 +13,18 @@ type UserSession struct {
 }
 
 func (UserSession) TableName() string { return "user_sessions" }
+
+// LoginLog records an owner password login attempt. Failed attempts carry
+// the reason and no UserID when the username was unknown.
+type LoginLog struct {
+	Base
+	UserID   string `json:"user_id"  gorm:"index"`
+	Username string `json:"username"`
+	IP       string `json:"ip"       gorm:"index"`
+	UA       string `json:"ua"       gorm:"type:text"`
+	Location string `json:"location"`
+	Success  bool   `json:"success"  gorm:"index"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (LoginLog) TableName() string { return "login_logs" }
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // SnippetType represents the language/format of a snippet.
 type SnippetType string
 
@@ -26,6 +28,30 @@ type SnippetModel struct {
 	Secret    string      `json:"-"` // encrypted
 	Enable    bool        `json:"enable"     gorm:"default:true"`
 	BuiltIn   bool        `json:"built_in"   gorm:"default:false"`
+	// Schedule is a cron expression; function snippets run on it when EnableSchedule is set.
+	Schedule       string `json:"schedule"`
+	EnableSchedule bool   `json:"enable_schedule" gorm:"default:false"`
 }
 
 func (SnippetModel) TableName() string { return "snippets" }
+
+// SnippetRunStatus is the outcome of a scheduled snippet run.
+type SnippetRunStatus string
+
+const (
+	SnippetRunSuccess SnippetRunStatus = "success"
+	SnippetRunError   SnippetRunStatus = "error"
+)
+
+// SnippetRunModel records one scheduled execution of a function snippet.
+type SnippetRunModel struct {
+	Base
+	SnippetID  string           `json:"snippet_id"  gorm:"type:char(36);not null;index"`
+	Status     SnippetRunStatus `json:"status"      gorm:"size:16;not null"`
+	Result     string           `json:"result"      gorm:"type:longtext"`
+	Error      string           `json:"error"       gorm:"type:text"`
+	DurationMs int64            `json:"duration_ms"`
+	StartedAt  time.Time        `json:"started_at"`
+}
+
+func (SnippetRunModel) TableName() string { return "snippet_runs" }
@@ -22,17 +22,25 @@ type UserModel struct {
 func (UserModel) TableName() string { return "users" }
 
 // APIToken represents a personal API token for programmatic access.
+//
+// Token holds the SHA-256 hex digest of the raw token; rows created before
+// hashing was introduced still hold the raw value and have no Prefix. Empty
+// Scopes grant full access, as legacy tokens always did.
 type APIToken struct {
 	Base
-	UserID    string     `json:"-"          gorm:"index;not null"`
-	Token     string     `json:"token"      gorm:"uniqueIndex;not null"`
-	Name      string     `json:"name"`
-	ExpiredAt *time.Time `json:"expired_at"`
+	UserID     string      `json:"-"            gorm:"index;not null"`
+	Token      string      `json:"token"        gorm:"uniqueIndex;not null"`
+	Prefix     string      `json:"prefix"       gorm:"size:16"`
+	Name       string      `json:"name"`
+	Scopes     StringSlice `json:"scopes"       gorm:"type:json;serializer:json"`
+	ExpiredAt  *time.Time  `json:"expired_at"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
 }
 
 func (APIToken) TableName() string { return "api_tokens" }
 
-// OAuth2Token holds OAuth2 account info linked to a user.
+// OAuth2Token holds OAuth2 account info linked to a user. For reader
+// sign-ins UserID holds the reader ID.
 type OAuth2Token struct {
 	Base
 	UserID      string     `json:"-"           gorm:"index;not null"`
@@ -47,14 +55,18 @@ func (OAuth2Token) TableName() string { return "oauth2_tokens" }
 // AuthnModel stores WebAuthn/passkey credentials.
 type AuthnModel struct {
 	Base
-	UserID               string `json:"-"                       gorm:"index"`
-	Name                 string `json:"name"                    gorm:"uniqueIndex;not null"`
-	CredentialID         []byte `json:"-"                       gorm:"type:blob"`
-	CredentialPublicKey  []byte `json:"-"                       gorm:"type:blob"`
-	CredentialJSON       string `json:"-"                       gorm:"type:longtext"`
-	Counter              uint32 `json:"counter"`
-	CredentialDeviceType string `json:"credential_device_type"`
-	CredentialBackedUp   bool   `json:"credential_backed_up"`
+	UserID               string      `json:"-"                       gorm:"index"`
+	Name                 string      `json:"name"                    gorm:"uniqueIndex;not null"`
+	CredentialID         []byte      `json:"-"                       gorm:"type:blob"`
+	CredentialPublicKey  []byte      `json:"-"                       gorm:"type:blob"`
+	CredentialJSON       string      `json:"-"                       gorm:"type:longtext"`
+	Counter              uint32      `json:"counter"`
+	CredentialDeviceType string      `json:"credential_device_type"`
+	CredentialBackedUp   bool        `json:"credential_backed_up"`
+	Transports           StringSlice `json:"transports"              gorm:"type:json;serializer:json"`
+	// InvalidatedAt is set when the authenticator reported a sign count that
+	// went backwards, a sign it may have been cloned. It can no longer log in.
+	InvalidatedAt *time.Time `json:"invalidated_at"`
 }
 
 func (AuthnModel) TableName() string { return "authn_credentials" }
@@ -62,11 +74,38 @@ func (AuthnModel) TableName() string { return "authn_credentials" }
 // ReaderModel tracks OAuth comment readers.
 type ReaderModel struct {
 	Base
-	Email   string `json:"email"    gorm:"uniqueIndex"`
-	Name    string `json:"name"`
-	Handle  string `json:"handle"`
-	Image   string `json:"image"`
-	IsOwner bool   `json:"is_owner"`
+	Email    string `json:"email"    gorm:"uniqueIndex"`
+	Name     string `json:"name"`
+	Handle   string `json:"handle"`
+	Image    string `json:"image"`
+	IsOwner  bool   `json:"is_owner"`
+	Provider string `json:"provider" gorm:"uniqueIndex:idx_reader_provider_account"`
+	// ProviderAccountID is the user ID at Provider; nil for readers created
+	// before OAuth sign-in.
+	ProviderAccountID *string `json:"-" gorm:"uniqueIndex:idx_reader_provider_account"`
 }
 
 func (ReaderModel) TableName() string { return "readers" }
+
+// PublicReader is the reader profile shown to other visitors, without the
+// email address.
+type PublicReader struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Handle   string `json:"handle"`
+	Image    string `json:"image"`
+	Provider string `json:"provider"`
+	IsOwner  bool   `json:"is_owner"`
+}
+
+// Public returns the profile of r that is safe to show publicly.
+func (r ReaderModel) Public() PublicReader {
+	return PublicReader{
+		ID:       r.ID,
+		Name:     r.Name,
+		Handle:   r.Handle,
+		Image:    r.Image,
+		Provider: r.Provider,
+		IsOwner:  r.IsOwner,
+	}
+}
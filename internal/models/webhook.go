@@ -16,17 +16,30 @@ type WebhookModel struct {
 
 func (WebhookModel) TableName() string { return "webhooks" }
 
-// WebhookEventModel is the audit trail of webhook deliveries.
+// Webhook delivery states.
+const (
+	WebhookDeliveryPending  = "pending"
+	WebhookDeliveryRetrying = "retrying"
+	WebhookDeliverySuccess  = "success"
+	WebhookDeliveryFailed   = "failed"
+)
+
+// WebhookEventModel is the audit trail of webhook deliveries. One row covers
+// every attempt at delivering an event to a hook; a failed delivery waits in
+// the retrying state until NextRetryAt.
 type WebhookEventModel struct {
 	Base
-	HookID    string    `json:"hookId"   gorm:"index;not null"`
-	Event     string    `json:"event"     gorm:"not null"`
-	Headers   string    `json:"headers"   gorm:"type:longtext"`
-	Payload   string    `json:"payload"   gorm:"type:longtext"`
-	Response  string    `json:"response"  gorm:"type:longtext"`
-	Success   bool      `json:"success"`
-	Status    int       `json:"status"`
-	Timestamp time.Time `json:"timestamp" gorm:"index"`
+	HookID      string     `json:"hookId"      gorm:"index;not null"`
+	Event       string     `json:"event"       gorm:"not null"`
+	Headers     string     `json:"headers"     gorm:"type:longtext"`
+	Payload     string     `json:"payload"     gorm:"type:longtext"`
+	Response    string     `json:"response"    gorm:"type:longtext"`
+	Success     bool       `json:"success"`
+	Status      int        `json:"status"`
+	State       string     `json:"state"       gorm:"index"`
+	Attempts    int        `json:"attempts"`
+	NextRetryAt *time.Time `json:"nextRetryAt" gorm:"index"`
+	Timestamp   time.Time  `json:"timestamp"   gorm:"index"`
 }
 
 func (WebhookEventModel) TableName() string { return "webhook_events" }
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/middleware"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/response"
+)
+
+// GET /auth/tokens
+//
+// Lists the caller's API tokens. Raw tokens are never returned here; the
+// prefix is enough to tell them apart.
+func (h *Handler) listAPITokens(c *gin.Context) {
+	tokens, err := h.svc.ListTokens(middleware.CurrentUserID(c))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	items := make([]apiTokenResponse, len(tokens))
+	for i := range tokens {
+		items[i] = newAPITokenResponse(&tokens[i])
+	}
+	response.OK(c, gin.H{"data": items})
+}
+
+// POST /auth/tokens
+//
+// Creates a scoped API token. The raw token is in this response only.
+func (h *Handler) createAPIToken(c *gin.Context) {
+	var dto CreateTokenDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if len(dto.Scopes) == 0 {
+		response.BadRequest(c, "至少需要一个权限范围")
+		return
+	}
+	t, token, err := h.svc.CreateToken(middleware.CurrentUserID(c), &dto)
+	if err != nil {
+		respondCreateTokenError(c, err)
+		return
+	}
+	item := newAPITokenResponse(t)
+	item.Token = token
+	response.Created(c, item)
+}
+
+func newAPITokenResponse(t *models.APIToken) apiTokenResponse {
+	scopes := []string(t.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return apiTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     scopes,
+		ExpiredAt:  t.ExpiredAt,
+		LastUsedAt: t.LastUsedAt,
+		Created:    t.CreatedAt,
+	}
+}
+
+// storedTokenDisplay returns what the legacy token endpoints show as the
+// token: legacy rows still hold the raw value, hashed ones only the prefix.
+func storedTokenDisplay(t *models.APIToken) string {
+	if t.Prefix == "" {
+		return t.Token
+	}
+	return t.Prefix
+}
+
+func respondCreateTokenError(c *gin.Context, err error) {
+	if errors.Is(err, errTokenExpiryInPast) || errors.Is(err, errInvalidTokenScope) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.InternalError(c, err)
+}
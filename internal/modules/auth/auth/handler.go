@@ -9,21 +9,35 @@ import (
 	"github.com/mx-space/core/internal/models"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
 	jwtpkg "github.com/mx-space/core/internal/pkg/jwt"
+	"github.com/mx-space/core/internal/pkg/loginlog"
 	"github.com/mx-space/core/internal/pkg/response"
 	sessionpkg "github.com/mx-space/core/internal/pkg/session"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	svc    *Service
-	cfgSvc *appconfigs.Service
+	svc      *Service
+	cfgSvc   *appconfigs.Service
+	loginLog *loginlog.Recorder
 }
 
-func NewHandler(svc *Service) *Handler {
-	return &Handler{
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// WithLoginRecorder records password logins and locks out failing IPs.
+func WithLoginRecorder(r *loginlog.Recorder) HandlerOption {
+	return func(h *Handler) { h.loginLog = r }
+}
+
+func NewHandler(svc *Service, opts ...HandlerOption) *Handler {
+	h := &Handler{
 		svc:    svc,
 		cfgSvc: appconfigs.NewService(svc.db),
 	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
 }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
@@ -41,78 +55,85 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	a.GET("/session", middleware.OptionalAuth(h.svc.db), h.session)
 	a.PATCH("/as-owner", authMW, h.asOwner)
 
+	a.GET("/login-logs", authMW, h.listLoginLogs)
+
+	sessions := a.Group("/sessions", authMW)
+	sessions.GET("", h.listSessions)
+	sessions.DELETE("", h.deleteSessions)
+	sessions.DELETE("/:id", h.deleteSession)
+
 	tok := a.Group("/token", authMW)
 	tok.GET("", h.listTokens)
 	tok.POST("", h.createToken)
 	tok.DELETE("", h.deleteTokenByQuery) // legacy compatibility: DELETE /auth/token?id=...
 	tok.DELETE("/:id", h.deleteToken)
+
+	toks := a.Group("/tokens", authMW)
+	toks.GET("", h.listAPITokens)
+	toks.POST("", h.createAPIToken)
+	toks.DELETE("/:id", h.deleteToken)
 }
 
 func (h *Handler) login(c *gin.Context) {
-	var dto LoginDTO
-	if err := c.ShouldBindJSON(&dto); err != nil {
-		response.BadRequest(c, err.Error())
-		return
-	}
-	disabled, err := h.isPasswordLoginDisabled()
-	if err != nil {
-		response.InternalError(c, err)
-		return
-	}
-	if disabled {
-		response.BadRequest(c, "密码登录已禁用")
-		return
-	}
-	token, err := h.svc.Login(dto.Username, dto.Password, c.ClientIP(), c.Request.UserAgent())
-	if err != nil {
-		if errors.Is(err, errAuthUserNotFound) {
-			response.ForbiddenMsg(c, "用户名不正确")
-			return
-		}
-		if errors.Is(err, errAuthWrongPassword) {
-			response.ForbiddenMsg(c, "密码不正确")
-			return
-		}
-		response.InternalError(c, err)
+	token, ok := h.passwordLogin(c)
+	if !ok {
 		return
 	}
-	setAuthTokenCookie(c, token)
 	response.OK(c, loginResponse{Token: token})
 }
 
 func (h *Handler) signInUsername(c *gin.Context) {
+	token, ok := h.passwordLogin(c)
+	if !ok {
+		return
+	}
+	response.OK(c, gin.H{
+		"token":   token,
+		"success": true,
+	})
+}
+
+// passwordLogin signs the owner in with a username and password, recording
+// the attempt. It writes the error response itself and returns ok=false on
+// failure.
+func (h *Handler) passwordLogin(c *gin.Context) (string, bool) {
 	var dto LoginDTO
 	if err := c.ShouldBindJSON(&dto); err != nil {
 		response.BadRequest(c, err.Error())
-		return
+		return "", false
 	}
 	disabled, err := h.isPasswordLoginDisabled()
 	if err != nil {
 		response.InternalError(c, err)
-		return
+		return "", false
 	}
 	if disabled {
 		response.BadRequest(c, "密码登录已禁用")
-		return
+		return "", false
 	}
-	token, err := h.svc.Login(dto.Username, dto.Password, c.ClientIP(), c.Request.UserAgent())
+	ip, ua := c.ClientIP(), c.Request.UserAgent()
+	if !h.loginLog.Attempt(ip) {
+		response.TooManyRequests(c, "登录失败次数过多，请稍后再试")
+		return "", false
+	}
+	token, u, err := h.svc.Login(dto.Username, dto.Password, ip, ua)
 	if err != nil {
 		if errors.Is(err, errAuthUserNotFound) {
+			h.loginLog.Failed(ip, dto.Username, ua, loginlog.ReasonUnknownUser)
 			response.ForbiddenMsg(c, "用户名不正确")
-			return
+			return "", false
 		}
 		if errors.Is(err, errAuthWrongPassword) {
+			h.loginLog.Failed(ip, dto.Username, ua, loginlog.ReasonWrongPassword)
 			response.ForbiddenMsg(c, "密码不正确")
-			return
+			return "", false
 		}
 		response.InternalError(c, err)
-		return
+		return "", false
 	}
+	h.loginLog.Succeeded(ip, u.Username, ua, u.ID)
 	setAuthTokenCookie(c, token)
-	response.OK(c, gin.H{
-		"token":   token,
-		"success": true,
-	})
+	return token, true
 }
 
 func (h *Handler) register(c *gin.Context) {
@@ -157,7 +178,7 @@ func (h *Handler) listTokens(c *gin.Context) {
 		response.OK(c, tokenResponse{
 			ID:      t.ID,
 			Name:    t.Name,
-			Token:   t.Token,
+			Token:   storedTokenDisplay(t),
 			Expired: t.ExpiredAt,
 			Created: t.CreatedAt,
 		})
@@ -172,7 +193,7 @@ func (h *Handler) listTokens(c *gin.Context) {
 	items := make([]tokenResponse, len(tokens))
 	for i, t := range tokens {
 		items[i] = tokenResponse{
-			ID: t.ID, Name: t.Name, Token: t.Token,
+			ID: t.ID, Name: t.Name, Token: storedTokenDisplay(&t),
 			Expired: t.ExpiredAt, Created: t.CreatedAt,
 		}
 	}
@@ -185,13 +206,13 @@ func (h *Handler) createToken(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
-	t, err := h.svc.CreateToken(middleware.CurrentUserID(c), &dto)
+	t, token, err := h.svc.CreateToken(middleware.CurrentUserID(c), &dto)
 	if err != nil {
-		response.InternalError(c, err)
+		respondCreateTokenError(c, err)
 		return
 	}
 	response.Created(c, tokenResponse{
-		ID: t.ID, Name: t.Name, Token: t.Token,
+		ID: t.ID, Name: t.Name, Token: token,
 		Expired: t.ExpiredAt, Created: t.CreatedAt,
 	})
 }
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/pagination"
+	"github.com/mx-space/core/internal/pkg/response"
+)
+
+// GET /auth/login-logs?page=&size=&success=&ip=
+func (h *Handler) listLoginLogs(c *gin.Context) {
+	var success *bool
+	if raw := c.Query("success"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			response.BadRequest(c, "success 参数无效")
+			return
+		}
+		success = &v
+	}
+	items, pag, err := h.svc.ListLoginLogs(pagination.FromContext(c), success, strings.TrimSpace(c.Query("ip")))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.Paged(c, items, pag)
+}
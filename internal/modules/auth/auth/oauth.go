@@ -44,6 +44,14 @@ func (h *OAuthHandler) RegisterRoutes(rg *gin.RouterGroup) {
 	g.GET("/redirect/:provider", h.redirectToProvider)
 	g.GET("/callback/:provider", h.handleCallback)
 	g.DELETE("/social/:provider", middleware.Auth(h.db), h.unlinkSocial)
+
+	r := rg.Group("/readers/oauth")
+	r.GET("/:provider/authorize", h.readerAuthorize)
+	r.GET("/:provider/callback", h.readerCallback)
+
+	o := rg.Group("/oauth")
+	o.GET("/:provider", h.readerAuthorize)
+	o.GET("/:provider/callback", h.readerCallback)
 }
 
 type signInSocialDTO struct {
@@ -250,7 +258,10 @@ type socialUserInfo struct {
 	ID    string
 	Login string
 	Email string
-	Name  string
+	// EmailVerified is set when the provider vouches that the user owns Email.
+	EmailVerified bool
+	Name          string
+	Avatar        string
 }
 
 func callbackURI(c *gin.Context, provider string) string {
@@ -263,8 +274,7 @@ func callbackURI(c *gin.Context, provider string) string {
 	return fmt.Sprintf("%s://%s%s/callback/%s", scheme, c.Request.Host, basePath, provider)
 }
 
-func oauthDef(providerID, clientID, stateToken string, c *gin.Context) *oauthProviderDef {
-	redirectURI := callbackURI(c, providerID)
+func oauthDef(providerID, clientID, stateToken, redirectURI string) *oauthProviderDef {
 	switch providerID {
 	case "github":
 		params := url.Values{}
@@ -312,7 +322,7 @@ func (h *OAuthHandler) resolveProvider(c *gin.Context, providerID, callbackURL s
 			if err != nil {
 				return nil, err
 			}
-			return oauthDef(providerType, clientID, stateToken, c), nil
+			return oauthDef(providerType, clientID, stateToken, callbackURI(c, providerType)), nil
 		}
 	}
 	return nil, nil
@@ -623,19 +633,29 @@ func fetchSocialUser(providerID, accessToken string) (*socialUserInfo, error) {
 		defer resp.Body.Close()
 
 		var u struct {
-			ID    int64  `json:"id"`
-			Login string `json:"login"`
-			Email string `json:"email"`
-			Name  string `json:"name"`
+			ID        int64  `json:"id"`
+			Login     string `json:"login"`
+			Email     string `json:"email"`
+			Name      string `json:"name"`
+			AvatarURL string `json:"avatar_url"`
 		}
 		if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
 			return nil, err
 		}
+		// The profile email is not necessarily verified, and users who keep
+		// their email private only expose it through /user/emails, which the
+		// user:email scope allows.
+		primary, verified := fetchGitHubVerifiedEmails(client, accessToken)
+		if u.Email == "" {
+			u.Email = primary
+		}
 		return &socialUserInfo{
-			ID:    fmt.Sprintf("%d", u.ID),
-			Login: u.Login,
-			Email: u.Email,
-			Name:  u.Name,
+			ID:            fmt.Sprintf("%d", u.ID),
+			Login:         u.Login,
+			Email:         u.Email,
+			EmailVerified: u.Email != "" && verified[strings.ToLower(u.Email)],
+			Name:          u.Name,
+			Avatar:        u.AvatarURL,
 		}, nil
 
 	case "google":
@@ -649,23 +669,66 @@ func fetchSocialUser(providerID, accessToken string) (*socialUserInfo, error) {
 		defer resp.Body.Close()
 
 		var u struct {
-			ID    string `json:"id"`
-			Email string `json:"email"`
-			Name  string `json:"name"`
+			ID            string `json:"id"`
+			Email         string `json:"email"`
+			VerifiedEmail bool   `json:"verified_email"`
+			Name          string `json:"name"`
+			Picture       string `json:"picture"`
 		}
 		if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
 			return nil, err
 		}
 		return &socialUserInfo{
-			ID:    u.ID,
-			Email: u.Email,
-			Name:  u.Name,
+			ID:            u.ID,
+			Email:         u.Email,
+			EmailVerified: u.VerifiedEmail,
+			Name:          u.Name,
+			Avatar:        u.Picture,
 		}, nil
 	}
 
 	return nil, fmt.Errorf("unsupported provider: %s", providerID)
 }
 
+// fetchGitHubVerifiedEmails returns the primary verified email of the user
+// and the set of all verified emails, lower-cased. Both are empty when they
+// cannot be read.
+func fetchGitHubVerifiedEmails(client *http.Client, accessToken string) (string, map[string]bool) {
+	req, _ := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		return "", nil
+	}
+	primary := ""
+	verified := make(map[string]bool, len(emails))
+	for _, e := range emails {
+		if !e.Verified {
+			continue
+		}
+		verified[strings.ToLower(e.Email)] = true
+		if e.Primary {
+			primary = e.Email
+		}
+	}
+	return primary, verified
+}
+
 func oauthClientID(public map[string]interface{}, providerType string) string {
 	return oauthClientField(public, providerType, "client_id", "clientId")
 }
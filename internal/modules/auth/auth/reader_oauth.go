@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/middleware"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/jwt"
+	"github.com/mx-space/core/internal/pkg/response"
+	sessionpkg "github.com/mx-space/core/internal/pkg/session"
+	"gorm.io/gorm"
+)
+
+// readerTokenTTL is how long a reader stays signed in after OAuth login.
+const readerTokenTTL = 30 * 24 * time.Hour
+
+// GET /readers/oauth/:provider/authorize?callback_url=...
+// GET /oauth/:provider?callback_url=...
+//
+// Starts reader sign-in: any GitHub or Google user can sign in to comment.
+func (h *OAuthHandler) readerAuthorize(c *gin.Context) {
+	cfg, err := h.cfgSvc.Get()
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	callbackURL, err := validateOAuthCallbackURL(c.Query("callback_url"), cfg)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	providerType, clientID, clientSecret, err := h.providerCredentials(c.Param("provider"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if clientID == "" || clientSecret == "" {
+		response.NotFoundMsg(c, "OAuth 提供商未找到或未配置")
+		return
+	}
+	stateToken, err := buildOAuthState(providerType, callbackURL, clientSecret)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	def := oauthDef(providerType, clientID, stateToken, readerCallbackURI(c, providerType))
+	if def == nil {
+		response.NotFoundMsg(c, "OAuth 提供商未找到或未配置")
+		return
+	}
+	c.Redirect(http.StatusTemporaryRedirect, def.AuthURL)
+}
+
+// GET /readers/oauth/:provider/callback?code=...&state=...
+// GET /oauth/:provider/callback?code=...&state=...
+//
+// Creates or updates the reader and issues a reader token. When the social
+// account is the one linked to the owner, an owner session is issued as
+// well, so the owner can sign in without a password when password login is
+// disabled. With a callback URL in the state the browser is sent back there
+// with the tokens in the fragment; otherwise they are returned as JSON.
+func (h *OAuthHandler) readerCallback(c *gin.Context) {
+	code := c.Query("code")
+	if code == "" {
+		response.BadRequest(c, "missing code")
+		return
+	}
+	providerType, clientID, clientSecret, err := h.providerCredentials(c.Param("provider"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if clientID == "" || clientSecret == "" {
+		response.NotFoundMsg(c, "OAuth 提供商未配置")
+		return
+	}
+	state, err := parseOAuthState(c.Query("state"), providerType, clientSecret)
+	if err != nil {
+		response.BadRequest(c, "invalid oauth state")
+		return
+	}
+
+	accessToken, err := exchangeCode(providerType, code, clientID, clientSecret, readerCallbackURI(c, providerType))
+	if err != nil {
+		response.InternalError(c, fmt.Errorf("token exchange failed: %w", err))
+		return
+	}
+	socialUser, err := fetchSocialUser(providerType, accessToken)
+	if err != nil {
+		response.InternalError(c, fmt.Errorf("failed to fetch user info: %w", err))
+		return
+	}
+	if strings.TrimSpace(socialUser.ID) == "" {
+		response.ForbiddenMsg(c, "OAuth 账号信息无效")
+		return
+	}
+
+	reader, err := h.upsertReader(providerType, socialUser)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if err := h.saveOAuthToken(reader.ID, providerType, socialUser.ID, accessToken); err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	token, err := jwt.SignReader(reader.ID, readerTokenTTL)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	setReaderTokenCookie(c, token)
+
+	ownerToken, err := h.ownerSessionFor(c, reader, providerType, socialUser.ID, accessToken)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+
+	if state.CallbackURL != "" {
+		if target, err := url.Parse(state.CallbackURL); err == nil {
+			fragment := url.Values{"reader_token": {token}}
+			if ownerToken != "" {
+				fragment.Set("token", ownerToken)
+			}
+			target.Fragment = fragment.Encode()
+			c.Redirect(http.StatusTemporaryRedirect, target.String())
+			return
+		}
+	}
+	res := gin.H{
+		"token":  token,
+		"reader": reader.Public(),
+	}
+	if ownerToken != "" {
+		res["owner_token"] = ownerToken
+	}
+	response.OK(c, res)
+}
+
+// ownerSessionFor signs the owner in when the social account is the one
+// linked to the owner, by an earlier /auth/callback login or the owner's
+// social IDs. It returns "" for every other account.
+func (h *OAuthHandler) ownerSessionFor(c *gin.Context, reader *models.ReaderModel, provider, accountID, accessToken string) (string, error) {
+	var owner models.UserModel
+	res := h.db.Limit(1).Find(&owner)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return "", res.Error
+	}
+	var linked int64
+	err := h.db.Model(&models.OAuth2Token{}).
+		Where("user_id = ? AND provider = ? AND provider_uid = ?", owner.ID, provider, accountID).
+		Count(&linked).Error
+	if err != nil {
+		return "", err
+	}
+	if linked == 0 && !ownerHasLinkedSocialID(owner.SocialIDs, provider, accountID) {
+		return "", nil
+	}
+
+	if err := h.saveOAuthToken(owner.ID, provider, accountID, accessToken); err != nil {
+		return "", err
+	}
+	if !reader.IsOwner {
+		if err := h.db.Model(reader).Update("is_owner", true).Error; err != nil {
+			return "", err
+		}
+	}
+	token, _, err := sessionpkg.Issue(h.db, owner.ID, c.ClientIP(), c.Request.UserAgent(), sessionpkg.DefaultTTL)
+	if err != nil {
+		return "", err
+	}
+	setAuthTokenCookie(c, token)
+	return token, nil
+}
+
+// saveOAuthToken stores the provider access token of userID's account in
+// oauth2_tokens, replacing the previous one.
+func (h *OAuthHandler) saveOAuthToken(userID, provider, accountID, accessToken string) error {
+	now := time.Now()
+	var existing models.OAuth2Token
+	res := h.db.Where("user_id = ? AND provider = ?", userID, provider).Limit(1).Find(&existing)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return h.db.Model(&existing).Updates(map[string]interface{}{
+			"provider_uid": accountID,
+			"access_token": accessToken,
+			"last_used":    now,
+		}).Error
+	}
+	return h.db.Create(&models.OAuth2Token{
+		UserID:      userID,
+		Provider:    provider,
+		ProviderUID: accountID,
+		AccessToken: accessToken,
+		LastUsed:    &now,
+	}).Error
+}
+
+// providerCredentials returns the configured type, client ID and secret of
+// an enabled provider, or empty strings when it is not set up.
+func (h *OAuthHandler) providerCredentials(providerID string) (string, string, string, error) {
+	cfg, err := h.cfgSvc.Get()
+	if err != nil {
+		return "", "", "", err
+	}
+	for _, p := range cfg.OAuth.Providers {
+		providerType := strings.ToLower(strings.TrimSpace(p.Type))
+		if p.Enabled && providerType != "" && strings.EqualFold(providerType, strings.TrimSpace(providerID)) {
+			return providerType, oauthClientID(cfg.OAuth.Public, providerType), oauthClientSecret(cfg.OAuth.Secrets, providerType), nil
+		}
+	}
+	return "", "", "", nil
+}
+
+// upsertReader finds the reader by provider account, then by email so a
+// reader signing in with a second provider keeps one profile, and creates it
+// otherwise. Only an email the provider has verified links accounts; anyone
+// can put someone else's address on an unverified profile. Profile fields
+// are refreshed on every sign-in.
+func (h *OAuthHandler) upsertReader(provider string, u *socialUserInfo) (*models.ReaderModel, error) {
+	accountID := strings.TrimSpace(u.ID)
+	// readers.email is unique, so accounts without a usable email get a
+	// stable placeholder.
+	placeholder := fmt.Sprintf("%s+%s@users.noreply.%s", accountID, provider, provider)
+	email := strings.ToLower(strings.TrimSpace(u.Email))
+	if email == "" {
+		email = placeholder
+	}
+	name := firstNonBlank(u.Name, u.Login, strings.SplitN(email, "@", 2)[0])
+	handle := provider + ":" + firstNonBlank(u.Login, accountID)
+
+	var reader models.ReaderModel
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("provider = ? AND provider_account_id = ?", provider, accountID).Limit(1).Find(&reader)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 && email != placeholder {
+			var owner models.ReaderModel
+			taken := tx.Where("email = ?", email).Limit(1).Find(&owner)
+			if taken.Error != nil {
+				return taken.Error
+			}
+			switch {
+			case taken.RowsAffected == 0:
+			case u.EmailVerified:
+				reader, res = owner, taken
+			default:
+				email = placeholder
+			}
+		}
+		if res.RowsAffected == 0 {
+			reader = models.ReaderModel{
+				Email:             email,
+				Name:              name,
+				Handle:            handle,
+				Image:             u.Avatar,
+				Provider:          provider,
+				ProviderAccountID: &accountID,
+			}
+			return tx.Create(&reader).Error
+		}
+		updates := map[string]interface{}{
+			"name":   name,
+			"handle": handle,
+			"image":  u.Avatar,
+		}
+		if reader.ProviderAccountID == nil {
+			updates["provider"] = provider
+			updates["provider_account_id"] = accountID
+		}
+		return tx.Model(&reader).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reader.ID == "" {
+		return nil, errors.New("reader upsert failed")
+	}
+	return &reader, nil
+}
+
+// readerCallbackURI is the callback next to the route serving the request,
+// so each sign-in entry point gets back to its own callback.
+func readerCallbackURI(c *gin.Context, provider string) string {
+	basePath := c.FullPath()
+	for _, suffix := range []string{"/:provider/authorize", "/:provider/callback", "/:provider"} {
+		if strings.HasSuffix(basePath, suffix) {
+			basePath = strings.TrimSuffix(basePath, suffix)
+			break
+		}
+	}
+	return fmt.Sprintf("%s://%s%s/%s/callback", requestScheme(c), c.Request.Host, basePath, provider)
+}
+
+func setReaderTokenCookie(c *gin.Context, token string) {
+	secure := requestScheme(c) == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.ReaderTokenCookie, token, int(readerTokenTTL/time.Second), "/", "", secure, true)
+}
+
+func firstNonBlank(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -5,9 +5,13 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/pagination"
+	"github.com/mx-space/core/internal/pkg/response"
 	sessionpkg "github.com/mx-space/core/internal/pkg/session"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -17,22 +21,32 @@ type Service struct{ db *gorm.DB }
 
 func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 
-func (s *Service) Login(username, password, ip, ua string) (string, error) {
+// Login checks the owner's password and issues a session, keeping
+// last_login_time/last_login_ip current for the serverless master info.
+func (s *Service) Login(username, password, ip, ua string) (string, *models.UserModel, error) {
 	var u models.UserModel
-	if err := s.db.Select("id, password").
+	if err := s.db.Select("id, username, password").
 		Where("username = ?", username).First(&u).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			time.Sleep(3 * time.Second)
-			return "", errAuthUserNotFound
+			return "", nil, errAuthUserNotFound
 		}
-		return "", err
+		return "", nil, err
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
 		time.Sleep(3 * time.Second)
-		return "", errAuthWrongPassword
+		return "", nil, errAuthWrongPassword
 	}
+	now := time.Now()
+	s.db.Model(&u).Updates(map[string]interface{}{
+		"last_login_time": now,
+		"last_login_ip":   ip,
+	})
+	u.LastLoginTime = &now
+	u.LastLoginIP = ip
+
 	token, _, err := sessionpkg.Issue(s.db, u.ID, ip, ua, sessionpkg.DefaultTTL)
-	return token, err
+	return token, &u, err
 }
 
 func (s *Service) Register(dto *RegisterDTO) (*models.UserModel, error) {
@@ -76,7 +90,7 @@ func (s *Service) GetToken(userID, tokenID string) (*models.APIToken, error) {
 func (s *Service) VerifyTokenString(token string) (bool, error) {
 	var count int64
 	err := s.db.Model(&models.APIToken{}).
-		Where("token = ? AND (expired_at IS NULL OR expired_at > ?)", token, time.Now()).
+		Where("token IN ? AND (expired_at IS NULL OR expired_at > ?)", []string{middleware.HashAPIToken(token), token}, time.Now()).
 		Count(&count).Error
 	if err != nil {
 		return false, err
@@ -84,27 +98,80 @@ func (s *Service) VerifyTokenString(token string) (bool, error) {
 	return count > 0, nil
 }
 
-func (s *Service) CreateToken(userID string, dto *CreateTokenDTO) (*models.APIToken, error) {
+// CreateToken issues an API token and returns the row with the raw token,
+// which is not stored and cannot be shown again.
+func (s *Service) CreateToken(userID string, dto *CreateTokenDTO) (*models.APIToken, string, error) {
+	expiredAt := firstNonNilTime(dto.Expired, dto.ExpiredAt)
+	if expiredAt != nil && !expiredAt.After(time.Now()) {
+		return nil, "", errTokenExpiryInPast
+	}
+	scopes, err := normalizeTokenScopes(dto.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
 	b := make([]byte, 20)
 	if _, err := rand.Read(b); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	token := "txo" + hex.EncodeToString(b)
 
 	t := models.APIToken{
 		UserID:    userID,
-		Token:     token,
+		Token:     middleware.HashAPIToken(token),
+		Prefix:    token[:tokenPrefixLength],
 		Name:      dto.Name,
-		ExpiredAt: firstNonNilTime(dto.Expired, dto.ExpiredAt),
+		Scopes:    scopes,
+		ExpiredAt: expiredAt,
+	}
+	if err := s.db.Create(&t).Error; err != nil {
+		return nil, "", err
 	}
-	return &t, s.db.Create(&t).Error
+	return &t, token, nil
 }
 
 func (s *Service) DeleteToken(userID, tokenID string) error {
 	result := s.db.Where("id = ? AND user_id = ?", tokenID, userID).
 		Delete(&models.APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
 		return fmt.Errorf("token not found")
 	}
-	return result.Error
+	middleware.RevokeAPIToken(tokenID)
+	return nil
+}
+
+// normalizeTokenScopes validates and de-duplicates the requested scopes.
+func normalizeTokenScopes(scopes []string) (models.StringSlice, error) {
+	seen := make(map[string]bool, len(scopes))
+	out := make(models.StringSlice, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !middleware.IsValidAPITokenScope(scope) {
+			return nil, fmt.Errorf("%w: %s", errInvalidTokenScope, scope)
+		}
+		seen[scope] = true
+		out = append(out, scope)
+	}
+	return out, nil
+}
+
+// ListLoginLogs returns login attempts, newest first, optionally filtered by
+// outcome and IP.
+func (s *Service) ListLoginLogs(q pagination.Query, success *bool, ip string) ([]models.LoginLog, response.Pagination, error) {
+	tx := s.db.Model(&models.LoginLog{}).Order("created_at DESC")
+	if success != nil {
+		tx = tx.Where("success = ?", *success)
+	}
+	if ip != "" {
+		tx = tx.Where("ip = ?", ip)
+	}
+	var items []models.LoginLog
+	pag, err := pagination.Paginate(tx, q, &items)
+	return items, pag, err
 }
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/middleware"
+	"github.com/mx-space/core/internal/pkg/response"
+	sessionpkg "github.com/mx-space/core/internal/pkg/session"
+	"gorm.io/gorm"
+)
+
+// GET /auth/sessions
+func (h *Handler) listSessions(c *gin.Context) {
+	sessions, err := sessionpkg.ListActive(h.svc.db, middleware.CurrentUserID(c))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	current := middleware.CurrentSessionID(c)
+	items := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, gin.H{
+			"id":         s.ID,
+			"ip":         s.IP,
+			"ua":         s.UA,
+			"created":    s.CreatedAt,
+			"last_seen":  s.UpdatedAt,
+			"expires_at": s.ExpiresAt,
+			"current":    s.ID == current,
+		})
+	}
+	response.OK(c, gin.H{"data": items})
+}
+
+// DELETE /auth/sessions/:id
+func (h *Handler) deleteSession(c *gin.Context) {
+	err := sessionpkg.Revoke(h.svc.db, middleware.CurrentUserID(c), c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.NotFoundMsg(c, "会话不存在")
+		return
+	}
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.NoContent(c)
+}
+
+// DELETE /auth/sessions?others=true
+//
+// Revokes every session of the caller, or with others=true every session
+// except the one making the request.
+func (h *Handler) deleteSessions(c *gin.Context) {
+	keep := ""
+	if others, _ := strconv.ParseBool(c.Query("others")); others {
+		keep = middleware.CurrentSessionID(c)
+	}
+	if err := sessionpkg.RevokeAllExcept(h.svc.db, middleware.CurrentUserID(c), keep); err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.NoContent(c)
+}
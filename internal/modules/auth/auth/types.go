@@ -21,6 +21,7 @@ type CreateTokenDTO struct {
 	Name      string     `json:"name"       binding:"required"`
 	Expired   *time.Time `json:"expired"`
 	ExpiredAt *time.Time `json:"expired_at"`
+	Scopes    []string   `json:"scopes"`
 }
 
 type loginResponse struct {
@@ -35,10 +36,27 @@ type tokenResponse struct {
 	Created time.Time  `json:"created"`
 }
 
+// tokenPrefixLength is how much of a raw API token is kept to identify it.
+const tokenPrefixLength = 10
+
+type apiTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiredAt  *time.Time `json:"expired_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Created    time.Time  `json:"created"`
+	// Token is only set in the creation response.
+	Token string `json:"token,omitempty"`
+}
+
 var (
 	errAuthUserNotFound       = errors.New("auth user not found")
 	errAuthWrongPassword      = errors.New("auth wrong password")
 	errOwnerAlreadyRegistered = errors.New("owner already registered")
+	errTokenExpiryInPast      = errors.New("过期时间必须晚于当前时间")
+	errInvalidTokenScope      = errors.New("未知的权限范围")
 )
 
 func firstNonNilTime(values ...*time.Time) *time.Time {
@@ -14,18 +14,24 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-webauthn/webauthn/protocol"
 	gowauthn "github.com/go-webauthn/webauthn/webauthn"
+	"github.com/mx-space/core/internal/config"
 	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/system/core/configs"
 	"github.com/mx-space/core/internal/pkg/response"
 	sessionpkg "github.com/mx-space/core/internal/pkg/session"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cfgSvc *configs.Service
 }
 
-func NewHandler(db *gorm.DB) *Handler { return &Handler{db: db} }
+func NewHandler(db *gorm.DB, cfgSvc *configs.Service) *Handler {
+	return &Handler{db: db, cfgSvc: cfgSvc}
+}
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g := rg.Group("/passkey")
@@ -35,6 +41,14 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g.POST("/authentication/verify", h.authenticationVerify)
 	g.GET("/items", authMW, h.listItems)
 	g.DELETE("/items/:id", authMW, h.deleteItem)
+
+	w := rg.Group("/auth/webauthn")
+	w.POST("/register/options", authMW, h.registerOptions)
+	w.POST("/register/verify", authMW, h.registerVerify)
+	w.POST("/login/options", h.authenticationOptions)
+	w.POST("/login/verify", h.authenticationVerify)
+	w.GET("/credentials", authMW, h.listCredentials)
+	w.DELETE("/credentials/:id", authMW, h.deleteItem)
 }
 
 func (h *Handler) registerOptions(c *gin.Context) {
@@ -62,7 +76,7 @@ func (h *Handler) registerOptions(c *gin.Context) {
 
 	creation, sessionData, err := wa.BeginRegistration(
 		user,
-		gowauthn.WithExclusions(gowauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+		gowauthn.WithExclusions(gowauthn.Credentials(user.enrolled).CredentialDescriptors()),
 	)
 	if err != nil {
 		response.BadRequest(c, err.Error())
@@ -135,6 +149,7 @@ func (h *Handler) registerVerify(c *gin.Context) {
 		Counter:              credential.Authenticator.SignCount,
 		CredentialDeviceType: string(credential.Authenticator.Attachment),
 		CredentialBackedUp:   credential.Flags.BackupState,
+		Transports:           credentialTransports(credential),
 	}
 	if err := h.db.Create(&authnItem).Error; err != nil {
 		response.InternalError(c, err)
@@ -206,6 +221,19 @@ func (h *Handler) authenticationVerify(c *gin.Context) {
 		response.BadRequest(c, "认证失败")
 		return
 	}
+	authnSessions.del("authentication:" + user.user.ID)
+	if credential.Authenticator.CloneWarning {
+		// The sign count went backwards: another copy of this authenticator
+		// has been used, so neither copy is trusted any more.
+		if err := h.invalidateCredential(user.user.ID, credential.ID); err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		authnSessionLogger().Warn("passkey sign count regressed, credential invalidated",
+			zap.String("user", user.user.ID), zap.Uint32("stored", credential.Authenticator.SignCount))
+		response.ForbiddenMsg(c, "Passkey 签名计数异常，该凭据已被停用")
+		return
+	}
 	if err := h.updateStoredCredential(user.user.ID, credential); err != nil {
 		response.InternalError(c, err)
 		return
@@ -222,7 +250,6 @@ func (h *Handler) authenticationVerify(c *gin.Context) {
 		res["token"] = token
 	}
 
-	authnSessions.del("authentication:" + user.user.ID)
 	response.OK(c, res)
 }
 
@@ -234,8 +261,26 @@ func (h *Handler) listItems(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, credentialViews(items))
+}
+
+// GET /auth/webauthn/credentials
+func (h *Handler) listCredentials(c *gin.Context) {
+	items, err := h.loadAuthnItems(middleware.CurrentUserID(c), true)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, gin.H{"data": credentialViews(items)})
+}
+
+func credentialViews(items []models.AuthnModel) []gin.H {
 	out := make([]gin.H, 0, len(items))
 	for _, item := range items {
+		transports := []string(item.Transports)
+		if transports == nil {
+			transports = []string{}
+		}
 		out = append(out, gin.H{
 			"id":                   item.ID,
 			"name":                 item.Name,
@@ -244,23 +289,79 @@ func (h *Handler) listItems(c *gin.Context) {
 			"counter":              item.Counter,
 			"credentialDeviceType": item.CredentialDeviceType,
 			"credentialBackedUp":   item.CredentialBackedUp,
+			"transports":           transports,
+			"invalidatedAt":        item.InvalidatedAt,
 			"created":              item.CreatedAt,
 		})
 	}
-	c.JSON(http.StatusOK, out)
+	return out
 }
 
 func (h *Handler) deleteItem(c *gin.Context) {
 	userID := middleware.CurrentUserID(c)
-	if err := h.db.
-		Where("id = ? AND (user_id = ? OR user_id = '' OR user_id IS NULL)", c.Param("id"), userID).
-		Delete(&models.AuthnModel{}).Error; err != nil {
+	var item models.AuthnModel
+	res := h.db.Where("id = ? AND (user_id = ? OR user_id = '' OR user_id IS NULL)", c.Param("id"), userID).
+		Limit(1).Find(&item)
+	if res.Error != nil {
+		response.InternalError(c, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		response.NoContent(c)
+		return
+	}
+	if item.InvalidatedAt == nil {
+		locked, err := h.wouldLockOut(userID)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		if locked {
+			response.BadRequest(c, "已禁用密码登录，不能删除最后一个可用的 Passkey")
+			return
+		}
+	}
+	if err := h.db.Delete(&item).Error; err != nil {
 		response.InternalError(c, err)
 		return
 	}
 	response.NoContent(c)
 }
 
+// wouldLockOut reports whether removing one usable passkey would leave the
+// owner with no way to sign in, i.e. password login is disabled and no
+// other usable passkey remains.
+func (h *Handler) wouldLockOut(userID string) (bool, error) {
+	cfg, err := h.cfgSvc.Get()
+	if err != nil {
+		return false, err
+	}
+	if !cfg.AuthSecurity.DisablePasswordLogin {
+		return false, nil
+	}
+	var count int64
+	err = h.db.Model(&models.AuthnModel{}).
+		Where("(user_id = ? OR user_id = '' OR user_id IS NULL) AND invalidated_at IS NULL", userID).
+		Count(&count).Error
+	return count <= 1, err
+}
+
+// invalidateCredential stops a credential from being used to log in while
+// keeping it listed so the owner can see what happened.
+func (h *Handler) invalidateCredential(userID string, credentialID []byte) error {
+	return h.db.Model(&models.AuthnModel{}).
+		Where("(user_id = ? OR user_id = '' OR user_id IS NULL) AND credential_id = ?", userID, credentialID).
+		Update("invalidated_at", time.Now()).Error
+}
+
+func credentialTransports(credential *gowauthn.Credential) models.StringSlice {
+	transports := make(models.StringSlice, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	return transports
+}
+
 func (h *Handler) ensureUniqueName(base string) string {
 	name := base
 	for i := 1; i < 1000; i++ {
@@ -277,8 +378,8 @@ func (h *Handler) ensureUniqueName(base string) string {
 func (h *Handler) newWebAuthn(c *gin.Context) (*gowauthn.WebAuthn, error) {
 	return gowauthn.New(&gowauthn.Config{
 		RPDisplayName:         "MixSpace",
-		RPID:                  deriveRPID(c, h.db),
-		RPOrigins:             deriveRPOrigins(c, h.db),
+		RPID:                  h.deriveRPID(c),
+		RPOrigins:             h.deriveRPOrigins(c),
 		AttestationPreference: protocol.PreferNoAttestation,
 		AuthenticatorSelection: protocol.AuthenticatorSelection{
 			AuthenticatorAttachment: protocol.Platform,
@@ -331,15 +432,20 @@ func (h *Handler) buildWebAuthnUser(user *models.UserModel, includeLegacy bool)
 	if err != nil {
 		return nil, err
 	}
-	credentials := make([]gowauthn.Credential, 0, len(items))
+	u := &webAuthnUser{user: *user}
 	for _, item := range items {
 		credential, ok := parseStoredCredential(item.CredentialJSON)
 		if !ok {
 			continue
 		}
-		credentials = append(credentials, credential)
+		// CloneWarning must only reflect the ceremony in progress.
+		credential.Authenticator.CloneWarning = false
+		u.enrolled = append(u.enrolled, credential)
+		if item.InvalidatedAt == nil {
+			u.credentials = append(u.credentials, credential)
+		}
 	}
-	return &webAuthnUser{user: *user, credentials: credentials}, nil
+	return u, nil
 }
 
 func (h *Handler) loadAuthnItems(userID string, includeLegacy bool) ([]models.AuthnModel, error) {
@@ -371,6 +477,7 @@ func (h *Handler) updateStoredCredential(userID string, credential *gowauthn.Cre
 		"counter":                credential.Authenticator.SignCount,
 		"credential_device_type": string(credential.Authenticator.Attachment),
 		"credential_backed_up":   credential.Flags.BackupState,
+		"transports":             credentialTransports(credential),
 	}
 	res := h.db.Model(&models.AuthnModel{}).
 		Where("user_id = ? AND credential_id = ?", userID, credential.ID).
@@ -394,8 +501,11 @@ func (h *Handler) updateStoredCredential(userID string, credential *gowauthn.Cre
 }
 
 type webAuthnUser struct {
-	user        models.UserModel
+	user models.UserModel
+	// credentials can log in; enrolled also includes invalidated ones, which
+	// must not be registered again.
 	credentials []gowauthn.Credential
+	enrolled    []gowauthn.Credential
 }
 
 func (u *webAuthnUser) WebAuthnID() []byte {
@@ -462,33 +572,17 @@ func strAny(v interface{}) string {
 	return ""
 }
 
-func deriveRPID(c *gin.Context, db *gorm.DB) string {
-	origin := c.GetHeader("Origin")
-	if origin != "" {
-		if u, err := url.Parse(origin); err == nil && u.Hostname() != "" {
+// deriveRPID returns the relying party ID: the host of the admin URL, or of
+// the web or server URL when it is unset. The request host is only used
+// before any URL is configured. The Origin header is never trusted here.
+func (h *Handler) deriveRPID(c *gin.Context) string {
+	urls := h.siteURLs()
+	if raw := firstNonEmpty(urls.AdminURL, urls.WebURL, urls.ServerURL); raw != "" {
+		if u, err := url.Parse(strings.TrimSpace(raw)); err == nil && u.Hostname() != "" {
 			return u.Hostname()
 		}
 	}
 
-	var opt models.OptionModel
-	if err := db.Where("name = ?", "configs").First(&opt).Error; err == nil && opt.Value != "" {
-		cfg := struct {
-			URL struct {
-				WebURL    string `json:"web_url"`
-				AdminURL  string `json:"admin_url"`
-				ServerURL string `json:"server_url"`
-			} `json:"url"`
-		}{}
-		if json.Unmarshal([]byte(opt.Value), &cfg) == nil {
-			adminURL := firstNonEmpty(cfg.URL.AdminURL, cfg.URL.WebURL, cfg.URL.ServerURL)
-			if adminURL != "" {
-				if u, err := url.Parse(adminURL); err == nil && u.Hostname() != "" {
-					return u.Hostname()
-				}
-			}
-		}
-	}
-
 	host := c.Request.Host
 	if strings.Contains(host, ":") {
 		host = strings.Split(host, ":")[0]
@@ -499,7 +593,9 @@ func deriveRPID(c *gin.Context, db *gorm.DB) string {
 	return host
 }
 
-func deriveRPOrigins(c *gin.Context, db *gorm.DB) []string {
+// deriveRPOrigins returns the origins allowed to run WebAuthn ceremonies,
+// taken from the configured admin, web and server URLs.
+func (h *Handler) deriveRPOrigins(c *gin.Context) []string {
 	originSet := map[string]struct{}{}
 	addOrigin := func(raw string) {
 		text := strings.TrimSpace(raw)
@@ -516,29 +612,18 @@ func deriveRPOrigins(c *gin.Context, db *gorm.DB) []string {
 		originSet[strings.ToLower(u.Scheme)+"://"+strings.ToLower(u.Host)] = struct{}{}
 	}
 
-	addOrigin(c.GetHeader("Origin"))
-
-	var opt models.OptionModel
-	if err := db.Where("name = ?", "configs").First(&opt).Error; err == nil && opt.Value != "" {
-		cfg := struct {
-			URL struct {
-				WebURL    string `json:"web_url"`
-				AdminURL  string `json:"admin_url"`
-				ServerURL string `json:"server_url"`
-			} `json:"url"`
-		}{}
-		if json.Unmarshal([]byte(opt.Value), &cfg) == nil {
-			addOrigin(cfg.URL.AdminURL)
-			addOrigin(cfg.URL.WebURL)
-			addOrigin(cfg.URL.ServerURL)
-		}
-	}
+	urls := h.siteURLs()
+	addOrigin(urls.AdminURL)
+	addOrigin(urls.WebURL)
+	addOrigin(urls.ServerURL)
 
-	scheme := "https"
-	if c.Request.TLS == nil {
-		scheme = "http"
+	if len(originSet) == 0 {
+		scheme := "https"
+		if c.Request.TLS == nil {
+			scheme = "http"
+		}
+		addOrigin(scheme + "://" + c.Request.Host)
 	}
-	addOrigin(scheme + "://" + c.Request.Host)
 
 	origins := make([]string, 0, len(originSet))
 	for origin := range originSet {
@@ -550,6 +635,17 @@ func deriveRPOrigins(c *gin.Context, db *gorm.DB) []string {
 	return origins
 }
 
+func (h *Handler) siteURLs() config.URLConfig {
+	if h.cfgSvc == nil {
+		return config.URLConfig{}
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return config.URLConfig{}
+	}
+	return cfg.URL
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if strings.TrimSpace(v) != "" {
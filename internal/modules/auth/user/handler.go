@@ -10,18 +10,32 @@ import (
 	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/loginlog"
 	"github.com/mx-space/core/internal/pkg/response"
 	sessionpkg "github.com/mx-space/core/internal/pkg/session"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	svc    *Service
-	cfgSvc *appconfigs.Service
+	svc      *Service
+	cfgSvc   *appconfigs.Service
+	loginLog *loginlog.Recorder
 }
 
-func NewHandler(svc *Service, cfgSvc *appconfigs.Service) *Handler {
-	return &Handler{svc: svc, cfgSvc: cfgSvc}
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// WithLoginRecorder records password logins and locks out failing IPs.
+func WithLoginRecorder(r *loginlog.Recorder) HandlerOption {
+	return func(h *Handler) { h.loginLog = r }
+}
+
+func NewHandler(svc *Service, cfgSvc *appconfigs.Service, opts ...HandlerOption) *Handler {
+	h := &Handler{svc: svc, cfgSvc: cfgSvc}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
 }
 
 // RegisterRoutes registers routes under BOTH /master and /user for admin panel compatibility.
@@ -158,19 +172,27 @@ func (h *Handler) login(c *gin.Context) {
 			return
 		}
 	}
-	token, u, err := h.svc.Login(dto.Username, dto.Password, c.ClientIP(), c.Request.UserAgent())
+	ip, ua := c.ClientIP(), c.Request.UserAgent()
+	if !h.loginLog.Attempt(ip) {
+		response.TooManyRequests(c, "登录失败次数过多，请稍后再试")
+		return
+	}
+	token, u, err := h.svc.Login(dto.Username, dto.Password, ip, ua)
 	if err != nil {
 		if errors.Is(err, errUserNotFound) {
+			h.loginLog.Failed(ip, dto.Username, ua, loginlog.ReasonUnknownUser)
 			response.ForbiddenMsg(c, "用户名不正确")
 			return
 		}
 		if errors.Is(err, errWrongPassword) {
+			h.loginLog.Failed(ip, dto.Username, ua, loginlog.ReasonWrongPassword)
 			response.ForbiddenMsg(c, "密码不正确")
 			return
 		}
 		response.InternalError(c, err)
 		return
 	}
+	h.loginLog.Succeeded(ip, u.Username, ua, u.ID)
 	response.OK(c, loginResponse{Token: token, User: toResponse(u)})
 }
 
@@ -32,6 +32,8 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 
 	g.POST("/presence/update", h.updatePresence)
 	g.GET("/presence", h.getPresence)
+	g.POST("/presence", h.heartbeat)
+	g.GET("/presence/:refId", h.listReaders)
 
 	g.GET("/rooms", h.getRooms)
 	g.GET("/online-count", h.getOnlineCount)
@@ -44,6 +46,8 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 
 	g.DELETE("/all", authMW, h.deleteAll)
 	g.DELETE("/:type", authMW, h.deleteByType)
+
+	rg.GET("/activities", authMW, h.list)
 }
 
 func (h *Handler) like(c *gin.Context) {
@@ -106,10 +110,10 @@ func (h *Handler) list(c *gin.Context) {
 	switch c.DefaultQuery("type", "0") {
 	case "0", "like":
 		h.listLikePaged(c)
-	case "1", "read_duration":
+	case "1", "read_duration", "read":
 		h.listReadDurationPaged(c)
 	default:
-		response.BadRequest(c, "type must be 0|1")
+		response.BadRequest(c, "type must be 0|1|like|read")
 	}
 }
 
@@ -406,7 +410,7 @@ func (h *Handler) loadReadersByIDs(ids []string) (gin.H, error) {
 			"isOwner":  reader.IsOwner,
 			"image":    reader.Image,
 			"name":     reader.Name,
-			"provider": "",
+			"provider": reader.Provider,
 			"handle":   reader.Handle,
 		}
 	}
@@ -0,0 +1,337 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/response"
+	redis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Reader presence is heartbeat based: a reader is listed on an article for
+// readerPresenceTTL after its last POST /activity/presence. Each article has
+// a sorted set of identities scored by last heartbeat plus a hash holding
+// the entries; both expire with the TTL so abandoned articles vanish.
+const (
+	readerPresenceTTL           = 60 * time.Second
+	readerPresenceMaxPerIP      = 10
+	readerPresenceMaxIdentity   = 64
+	readerPresenceMaxName       = 32
+	redisReaderPresencePrefix   = "mx:activity:presence:ref:"
+	redisReaderPresenceIPPrefix = "mx:activity:presence:ip:"
+	// readActivityPersistInterval is the least time between two writes of a
+	// reader's read_duration activity for the same article.
+	readActivityPersistInterval = time.Minute
+)
+
+var errPresenceUnavailable = errors.New("presence store unavailable")
+
+type readerHeartbeatDTO struct {
+	Identity    string `json:"identity" binding:"required"`
+	Position    int    `json:"position"`
+	RefID       string `json:"ref_id" binding:"required"`
+	DisplayName string `json:"display_name"`
+}
+
+type readerPresence struct {
+	Identity    string `json:"identity"`
+	RefID       string `json:"refId"`
+	Position    int    `json:"position"`
+	DisplayName string `json:"displayName,omitempty"`
+	JoinedAt    int64  `json:"joinedAt"`
+	UpdatedAt   int64  `json:"updatedAt"`
+	ActivityID  string `json:"activityId,omitempty"`
+	PersistedAt int64  `json:"persistedAt,omitempty"`
+}
+
+// POST /activity/presence
+func (h *Handler) heartbeat(c *gin.Context) {
+	var dto readerHeartbeatDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	identity := strings.TrimSpace(dto.Identity)
+	refID := normalizeRefID(dto.RefID)
+	displayName := strings.TrimSpace(dto.DisplayName)
+	switch {
+	case identity == "" || refID == "":
+		response.BadRequest(c, "identity and ref_id are required")
+		return
+	case len(identity) > readerPresenceMaxIdentity:
+		response.BadRequest(c, "identity is too long")
+		return
+	case utf8.RuneCountInString(displayName) > readerPresenceMaxName:
+		response.BadRequest(c, "display_name is too long")
+		return
+	}
+	if dto.Position < 0 {
+		dto.Position = 0
+	}
+
+	rdb := presenceRedis()
+	if rdb == nil {
+		response.InternalError(c, errPresenceUnavailable)
+		return
+	}
+	ctx, cancel := presenceContext()
+	defer cancel()
+
+	allowed, err := admitReaderIdentity(ctx, rdb, c.ClientIP(), identity)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if !allowed {
+		response.TooManyRequests(c, "同一 IP 在线身份过多")
+		return
+	}
+
+	now := nowMillis()
+	entry, known := readerPresenceOf(ctx, rdb, refID, identity)
+	if !known {
+		exists, err := h.refExists(refID)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		if !exists {
+			response.NotFoundMsg(c, "内容不存在")
+			return
+		}
+		entry = readerPresence{Identity: identity, RefID: refID, JoinedAt: now}
+	}
+	entry.Position = dto.Position
+	entry.DisplayName = displayName
+	entry.UpdatedAt = now
+	h.persistReadActivity(&entry, c.ClientIP())
+
+	if err := saveReaderPresence(ctx, rdb, entry); err != nil {
+		response.InternalError(c, err)
+		return
+	}
+
+	view := readerPresenceView(entry)
+	if h.hub != nil {
+		h.hub.BroadcastRoom("ACTIVITY_UPDATE_PRESENCE", view, articleRoomName(refID))
+	}
+	response.OK(c, view)
+}
+
+// GET /activity/presence/:refId
+func (h *Handler) listReaders(c *gin.Context) {
+	refID := normalizeRefID(c.Param("refId"))
+	if refID == "" {
+		response.BadRequest(c, "refId is required")
+		return
+	}
+	rdb := presenceRedis()
+	if rdb == nil {
+		response.OK(c, gin.H{"data": []gin.H{}, "count": 0})
+		return
+	}
+	ctx, cancel := presenceContext()
+	defer cancel()
+
+	entries, err := listReaderPresence(ctx, rdb, refID)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	data := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		data = append(data, readerPresenceView(entry))
+	}
+	response.OK(c, gin.H{"data": data, "count": len(data)})
+}
+
+// refExists reports whether refID names a post, note or page.
+func (h *Handler) refExists(refID string) (bool, error) {
+	for _, model := range []interface{}{&models.PostModel{}, &models.NoteModel{}, &models.PageModel{}} {
+		var count int64
+		if err := h.db.Model(model).Where("id = ?", refID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// persistReadActivity records the visit as a read_duration activity: one row
+// per presence session, created on the first heartbeat and kept current by
+// the following ones at most once per readActivityPersistInterval.
+func (h *Handler) persistReadActivity(entry *readerPresence, ip string) {
+	if entry.ActivityID != "" && entry.UpdatedAt-entry.PersistedAt < readActivityPersistInterval.Milliseconds() {
+		return
+	}
+	payload := map[string]interface{}{
+		"identity":    entry.Identity,
+		"position":    entry.Position,
+		"roomName":    articleRoomName(entry.RefID),
+		"refId":       entry.RefID,
+		"displayName": entry.DisplayName,
+		"connectedAt": entry.JoinedAt,
+		"joinedAt":    entry.JoinedAt,
+		"updatedAt":   entry.UpdatedAt,
+		"ip":          ip,
+	}
+	if entry.ActivityID != "" {
+		err := h.db.Model(&models.ActivityModel{}).Where("id = ?", entry.ActivityID).
+			Select("payload").Updates(&models.ActivityModel{Payload: payload}).Error
+		if err != nil {
+			presenceLogger().Warn("update read activity failed", zap.String("id", entry.ActivityID), zap.Error(err))
+			return
+		}
+		entry.PersistedAt = entry.UpdatedAt
+		return
+	}
+	row := models.ActivityModel{
+		Type:    fmt.Sprintf("%d", activityTypeReadDuration),
+		Payload: payload,
+	}
+	if err := h.db.Create(&row).Error; err != nil {
+		presenceLogger().Warn("create read activity failed", zap.String("ref", entry.RefID), zap.Error(err))
+		return
+	}
+	entry.ActivityID = row.ID
+	entry.PersistedAt = entry.UpdatedAt
+}
+
+// admitReaderIdentity tracks the identities seen from ip and refuses a new
+// one once readerPresenceMaxPerIP are active.
+func admitReaderIdentity(ctx context.Context, rdb *redis.Client, ip, identity string) (bool, error) {
+	key := redisReaderPresenceIPPrefix + ip
+	now := nowMillis()
+	cutoff := strconv.FormatInt(now-readerPresenceTTL.Milliseconds(), 10)
+	if err := rdb.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff).Err(); err != nil {
+		return false, err
+	}
+	if _, err := rdb.ZScore(ctx, key, identity).Result(); err == redis.Nil {
+		count, err := rdb.ZCard(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+		if count >= readerPresenceMaxPerIP {
+			return false, nil
+		}
+	} else if err != nil {
+		return false, err
+	}
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now), Member: identity})
+	pipe.Expire(ctx, key, readerPresenceTTL)
+	_, err := pipe.Exec(ctx)
+	return err == nil, err
+}
+
+func readerPresenceOf(ctx context.Context, rdb *redis.Client, refID, identity string) (readerPresence, bool) {
+	raw, err := rdb.HGet(ctx, readerPresenceDataKey(refID), identity).Result()
+	if err != nil {
+		return readerPresence{}, false
+	}
+	var entry readerPresence
+	if json.Unmarshal([]byte(raw), &entry) != nil || entry.UpdatedAt < nowMillis()-readerPresenceTTL.Milliseconds() {
+		return readerPresence{}, false
+	}
+	return entry, true
+}
+
+func saveReaderPresence(ctx context.Context, rdb *redis.Client, entry readerPresence) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	key := readerPresenceKey(entry.RefID)
+	dataKey := readerPresenceDataKey(entry.RefID)
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(entry.UpdatedAt), Member: entry.Identity})
+	pipe.HSet(ctx, dataKey, entry.Identity, payload)
+	pipe.Expire(ctx, key, readerPresenceTTL)
+	pipe.Expire(ctx, dataKey, readerPresenceTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// listReaderPresence returns the live readers of refID, most recent first,
+// dropping the entries whose heartbeat is older than readerPresenceTTL.
+func listReaderPresence(ctx context.Context, rdb *redis.Client, refID string) ([]readerPresence, error) {
+	key := readerPresenceKey(refID)
+	dataKey := readerPresenceDataKey(refID)
+	cutoff := strconv.FormatInt(nowMillis()-readerPresenceTTL.Milliseconds(), 10)
+
+	stale, err := rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: "(" + cutoff}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(stale) > 0 {
+		members := make([]interface{}, len(stale))
+		for i, s := range stale {
+			members[i] = s
+		}
+		pipe := rdb.TxPipeline()
+		pipe.ZRem(ctx, key, members...)
+		pipe.HDel(ctx, dataKey, stale...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			presenceLogger().Warn("prune reader presence failed", zap.String("ref", refID), zap.Error(err))
+		}
+	}
+
+	identities, err := rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: cutoff, Max: "+inf"}).Result()
+	if err != nil || len(identities) == 0 {
+		return nil, err
+	}
+	values, err := rdb.HMGet(ctx, dataKey, identities...).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]readerPresence, 0, len(values))
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var entry readerPresence
+		if json.Unmarshal([]byte(raw), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].UpdatedAt > entries[j].UpdatedAt })
+	return entries, nil
+}
+
+func readerPresenceView(entry readerPresence) gin.H {
+	return gin.H{
+		"identity":    entry.Identity,
+		"refId":       entry.RefID,
+		"roomName":    articleRoomName(entry.RefID),
+		"position":    entry.Position,
+		"displayName": entry.DisplayName,
+		"joinedAt":    entry.JoinedAt,
+		"updatedAt":   entry.UpdatedAt,
+	}
+}
+
+func readerPresenceKey(refID string) string {
+	return redisReaderPresencePrefix + refID
+}
+
+func readerPresenceDataKey(refID string) string {
+	return redisReaderPresencePrefix + refID + ":data"
+}
+
+// articleRoomName is the public gateway room readers of an article join.
+func articleRoomName(refID string) string {
+	return "article-" + refID
+}
@@ -32,7 +32,8 @@ type UpdateCategoryDTO struct {
 }
 
 type Service struct {
-	db *gorm.DB
+	db       *gorm.DB
+	onChange func()
 }
 
 type CategoryListItem struct {
@@ -88,6 +89,16 @@ func NewService(db *gorm.DB) *Service {
 	return &Service{db: db}
 }
 
+// SetOnChange registers a callback run after content is created, updated or
+// deleted, e.g. to drop cached aggregates (optional).
+func (s *Service) SetOnChange(fn func()) { s.onChange = fn }
+
+func (s *Service) changed() {
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
 func (s *Service) ListCategories() ([]CategoryListItem, error) {
 	var cats []models.CategoryModel
 	if err := s.db.
@@ -342,7 +353,11 @@ func (s *Service) Create(dto *CreateCategoryDTO) (*models.CategoryModel, error)
 	if dto.Type != nil {
 		cat.Type = *dto.Type
 	}
-	return &cat, s.db.Create(&cat).Error
+	if err := s.db.Create(&cat).Error; err != nil {
+		return &cat, err
+	}
+	s.changed()
+	return &cat, nil
 }
 
 func (s *Service) Update(id string, dto *UpdateCategoryDTO) (*models.CategoryModel, error) {
@@ -360,10 +375,18 @@ func (s *Service) Update(id string, dto *UpdateCategoryDTO) (*models.CategoryMod
 	if dto.Type != nil {
 		updates["type"] = *dto.Type
 	}
-	return cat, s.db.Model(cat).Updates(updates).Error
+	if err := s.db.Model(cat).Updates(updates).Error; err != nil {
+		return cat, err
+	}
+	s.changed()
+	return cat, nil
 }
 
 func (s *Service) Delete(id string) error {
 	s.db.Model(&models.PostModel{}).Where("category_id = ?", id).Update("category_id", nil)
-	return s.db.Delete(&models.CategoryModel{}, "id = ?", id).Error
+	if err := s.db.Delete(&models.CategoryModel{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	s.changed()
+	return nil
 }
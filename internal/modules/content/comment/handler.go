@@ -1,6 +1,7 @@
 package comment
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
@@ -11,10 +12,14 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/content/note"
 	"github.com/mx-space/core/internal/modules/gateway/gateway"
 	"github.com/mx-space/core/internal/modules/gateway/notify"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/dialect"
+	"github.com/mx-space/core/internal/pkg/geoip"
 	"github.com/mx-space/core/internal/pkg/pagination"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -26,6 +31,8 @@ type Handler struct {
 	notifySvc *notify.Service
 	logger    *zap.Logger
 	hub       *gateway.Hub
+	rc        *pkgredis.Client
+	locator   geoip.Locator
 }
 
 func NewHandler(svc *Service, notifySvc *notify.Service, opts ...HandlerOption) *Handler {
@@ -53,6 +60,42 @@ func WithLogger(l *zap.Logger) HandlerOption {
 	}
 }
 
+// WithLocator enables IP location lookups for new comments.
+func WithLocator(l geoip.Locator) HandlerOption {
+	return func(h *Handler) {
+		h.locator = l
+	}
+}
+
+// recordLocation fills in the location of a new comment in the background
+// when RecordIPLocation is on, so lookups never delay the response.
+func (h *Handler) recordLocation(cm *models.CommentModel) {
+	if h.locator == nil || h.cfgSvc == nil || cm == nil || cm.Location != "" || !geoip.IsPublic(cm.IP) {
+		return
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil || cfg == nil || !cfg.CommentOptions.RecordIPLocation {
+		return
+	}
+	id, ip := cm.ID, cm.IP
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		location, err := h.locator.Locate(ctx, ip)
+		if err != nil {
+			h.logger.Warn("comment ip location lookup failed", zap.String("ip", ip), zap.Error(err))
+			return
+		}
+		if location == "" {
+			return
+		}
+		if err := h.svc.db.Model(&models.CommentModel{}).Where("id = ?", id).
+			Update("location", location).Error; err != nil {
+			h.logger.Warn("save comment location failed", zap.String("id", id), zap.Error(err))
+		}
+	}()
+}
+
 // WithHub sets gateway hub for comment websocket events.
 func WithHub(hub *gateway.Hub) HandlerOption {
 	return func(h *Handler) {
@@ -63,25 +106,32 @@ func WithHub(hub *gateway.Hub) HandlerOption {
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g := rg.Group("/comments")
 
+	readerMW := middleware.OptionalReaderAuth(h.svc.db)
+
 	g.GET("/ref/:refId", h.listByRef)
-	g.POST("/reply/:id", h.reply)
+	g.GET("/ref/:refId/:parentId/children", h.listChildren)
+	g.POST("/reply/:id", readerMW, h.reply)
 	g.POST("/owner/reply/:id", authMW, h.masterReply)
 	g.POST("/master/reply/:id", authMW, h.masterReply)
 	g.POST("/owner/comment/:id", authMW, h.masterComment)
 	g.POST("/master/comment/:id", authMW, h.masterComment)
 
 	g.GET("", authMW, h.list)
+	g.GET("/search", authMW, h.search)
+	g.GET("/mine", middleware.ReaderAuth(h.svc.db), h.mine)
 	g.GET("/:id", h.get)
-	g.POST("", h.create)
-	g.POST("/:refId", h.createOnRef)
+	g.POST("", readerMW, h.create)
+	g.POST("/:refId", readerMW, h.createOnRef)
+	// The owner updates the state; a reader edits or deletes their own comment.
+	g.PATCH("/:id", readerMW, h.patch)
+	g.DELETE("/:id", readerMW, h.remove)
 
 	a := g.Group("", authMW)
 	a.PATCH("/batch/state", h.batchUpdateState)
 	a.DELETE("/batch", h.batchDelete)
 	a.PATCH("/edit/:id", h.edit)
-	a.PATCH("/:id", h.updateStateCompat)
 	a.PATCH("/:id/state", h.updateState)
-	a.DELETE("/:id", h.delete)
+	a.PATCH("/:id/pin", h.pin)
 }
 
 func (h *Handler) isCommentDisabled() (bool, error) {
@@ -131,18 +181,44 @@ func (h *Handler) emitCommentCreate(cm *models.CommentModel, isAuthenticated, is
 	adminPayload := legacyCommentPayload(cm, true)
 
 	if isAuthenticated {
-		h.hub.BroadcastPublic("COMMENT_CREATE", publicPayload)
+		if !h.onLockedNote(cm) {
+			h.hub.BroadcastPublic("COMMENT_CREATE", publicPayload)
+		}
 		return
 	}
 
 	h.hub.BroadcastAdmin("COMMENT_CREATE", adminPayload)
-	if isSpam || cm.IsWhispers || cm.State == models.CommentJunk || h.shouldAuditComment() {
+	if isSpam || cm.IsWhispers || cm.State == models.CommentJunk || h.shouldAuditComment() || h.onLockedNote(cm) {
 		return
 	}
 
 	h.hub.BroadcastPublic("COMMENT_CREATE", publicPayload)
 }
 
+// emitCommentUpdate tells the admin room about a changed comment and, once it
+// is approved, not a whisper and not on a locked note, updates public readers
+// as well.
+func (h *Handler) emitCommentUpdate(cm *models.CommentModel) {
+	if h.hub == nil || cm == nil {
+		return
+	}
+	h.hub.BroadcastAdmin("COMMENT_UPDATE", legacyCommentPayload(cm, true))
+	if cm.State != models.CommentRead || cm.IsWhispers || h.onLockedNote(cm) {
+		return
+	}
+	h.hub.BroadcastPublic("COMMENT_UPDATE", legacyCommentPayload(cm, false))
+}
+
+// onLockedNote reports whether cm belongs to a password-protected note, whose
+// comments must not reach the public room. Lookup errors count as locked.
+func (h *Handler) onLockedNote(cm *models.CommentModel) bool {
+	if cm.RefType != models.RefTypeNote {
+		return false
+	}
+	locked, err := h.svc.LockedNote(cm.RefID)
+	return err != nil || locked != nil
+}
+
 // checkSpamAndMark checks anti-spam rules and marks the comment as junk when
 // matched. It returns true when the comment is detected as spam.
 func (h *Handler) checkSpamAndMark(cm *models.CommentModel) bool {
@@ -181,6 +257,40 @@ func (h *Handler) ensureCommentAllowed(c *gin.Context, refType models.RefType, r
 	return true
 }
 
+// ensureCommentAcceptable rejects malformed mail addresses with 400, anonymous
+// comments from blocked IPs with 403 and, with 400, anonymous comments from
+// blocked mail domains or, when DisableNoChinese is on, without Chinese.
+func (h *Handler) ensureCommentAcceptable(c *gin.Context, text, mail string) bool {
+	if !validMail(mail) {
+		response.BadRequest(c, "邮箱格式不正确")
+		return false
+	}
+	if middleware.IsAuthenticated(c) || h.cfgSvc == nil {
+		return true
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil {
+		response.InternalError(c, err)
+		return false
+	}
+	if cfg == nil {
+		return true
+	}
+	if ipBlocked(c.ClientIP(), cfg.CommentOptions.BlockIPs) {
+		response.ForbiddenMsg(c, "你的 IP 已被禁止评论")
+		return false
+	}
+	if mailDomainBlocked(mail, cfg.CommentOptions.BlockMailDomains) {
+		response.BadRequest(c, "该邮箱域名已被禁止评论")
+		return false
+	}
+	if cfg.CommentOptions.DisableNoChinese && !hasChinese(text) {
+		response.BadRequest(c, "评论需要包含中文")
+		return false
+	}
+	return true
+}
+
 func (h *Handler) handleCreateError(c *gin.Context, err error) bool {
 	if errors.Is(err, errCommentRefNotFound) {
 		response.BadRequest(c, "评论文章不存在")
@@ -241,8 +351,9 @@ func (h *Handler) loadParentMap(comments []models.CommentModel) (map[string]comm
 
 	if len(parentKeys) > 0 {
 		var parentsByKey []models.CommentModel
-		if err := h.svc.db.Select("id, ref_type, ref_id, `key`, author, text, created_at").
-			Where("`key` IN ?", parentKeys).
+		keyColumn := dialect.Quote(h.svc.db, "key")
+		if err := h.svc.db.Select("id, ref_type, ref_id, "+keyColumn+", author, text, created_at").
+			Where(keyColumn+" IN ?", parentKeys).
 			Find(&parentsByKey).Error; err != nil {
 			return nil, nil, err
 		}
@@ -360,7 +471,7 @@ func (h *Handler) loadReadersMap(comments []models.CommentModel) (gin.H, error)
 		return nil, err
 	}
 	for _, row := range rows {
-		readers[row.ID] = row
+		readers[row.ID] = row.Public()
 	}
 	return readers, nil
 }
@@ -465,7 +576,7 @@ func (h *Handler) buildReplyPayload(commentID string, isAdmin bool) (gin.H, erro
 		}
 	} else if parentKey := parentKeyFromCommentKey(cm.Key); parentKey != "" {
 		if err := h.svc.db.Preload("Children").
-			Where("ref_type = ? AND ref_id = ? AND `key` = ?", normalizeRefType(string(cm.RefType)), cm.RefID, parentKey).
+			Where("ref_type = ? AND ref_id = ? AND "+dialect.Quote(h.svc.db, "key")+" = ?", normalizeRefType(string(cm.RefType)), cm.RefID, parentKey).
 			First(&parent).Error; err != nil {
 			if !errors.Is(err, gorm.ErrRecordNotFound) {
 				return nil, err
@@ -483,7 +594,10 @@ func (h *Handler) buildReplyPayload(commentID string, isAdmin bool) (gin.H, erro
 }
 
 func (h *Handler) list(c *gin.Context) {
-	q := pagination.FromContext(c)
+	q, ok := pagination.FromContextWithCursor(c)
+	if !ok {
+		return
+	}
 
 	refType := c.Query("ref_type")
 	refID := c.Query("ref_id")
@@ -504,13 +618,59 @@ func (h *Handler) list(c *gin.Context) {
 		}
 	}
 
+	if q.Cursor != nil {
+		comments, pag, err := h.svc.ListAfter(q, rtPtr, ridPtr, statePtr)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		h.writeAdminList(c, comments, pag, middleware.IsAuthenticated(c))
+		return
+	}
 	comments, pag, err := h.svc.List(q, rtPtr, ridPtr, statePtr)
 	if err != nil {
 		response.InternalError(c, err)
 		return
 	}
+	h.writeAdminList(c, comments, pag, middleware.IsAuthenticated(c))
+}
 
-	isAdmin := middleware.IsAuthenticated(c)
+// GET /comments/search?keyword=&state=&ref_type= — match author, mail, text and IP
+func (h *Handler) search(c *gin.Context) {
+	q := pagination.FromContext(c)
+	opts := SearchOptions{Keyword: strings.TrimSpace(c.Query("keyword"))}
+	if refType := c.Query("ref_type"); refType != "" {
+		opts.RefType = &refType
+	}
+	if state := c.Query("state"); state != "" {
+		if parsed, err := strconv.Atoi(state); err == nil {
+			opts.State = &parsed
+		}
+	}
+
+	comments, pag, err := h.svc.Search(q, opts)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	h.writeAdminList(c, comments, pag, true)
+}
+
+// GET /comments/mine [reader] — the current reader's comments with their refs
+func (h *Handler) mine(c *gin.Context) {
+	q := pagination.FromContext(c)
+	comments, pag, err := h.svc.ListByReader(q, middleware.CurrentReaderID(c))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	h.writeAdminList(c, comments, pag, false)
+}
+
+// writeAdminList renders a flat comment page with parent, ref and reader
+// lookups, as used by the admin list views and the reader history. pag is a
+// response.Pagination or, in cursor mode, a response.CursorPagination.
+func (h *Handler) writeAdminList(c *gin.Context, comments []models.CommentModel, pag interface{}, isAdmin bool) {
 	parentMap, parentByKey, err := h.loadParentMap(comments)
 	if err != nil {
 		response.InternalError(c, err)
@@ -529,7 +689,7 @@ func (h *Handler) list(c *gin.Context) {
 	items := make([]commentResponse, len(comments))
 	for i, cm := range comments {
 		h.fillAvatarTree(&cm)
-		item := toResponse(&cm, isAdmin)
+		item := h.buildResponse(&cm, isAdmin)
 		if cm.ParentID != nil {
 			if parent, ok := parentMap[*cm.ParentID]; ok {
 				item.Parent = parent
@@ -562,7 +722,7 @@ func (h *Handler) get(c *gin.Context) {
 		return
 	}
 	h.fillAvatarTree(cm)
-	response.OK(c, toResponse(cm, middleware.IsAuthenticated(c)))
+	response.OK(c, h.buildResponse(cm, middleware.IsAuthenticated(c)))
 }
 
 func (h *Handler) create(c *gin.Context) {
@@ -574,10 +734,23 @@ func (h *Handler) create(c *gin.Context) {
 	if !h.ensureCommentEnabled(c) {
 		return
 	}
+	if !h.ensureCommentRate(c) {
+		return
+	}
+	if !h.attributeToReader(c, &dto) {
+		return
+	}
+	if !h.ensureCommentAcceptable(c, dto.Text, dto.Mail) {
+		return
+	}
 	isAuthenticated := middleware.IsAuthenticated(c)
 	if !isAuthenticated && !h.ensureCommentAllowed(c, dto.RefType, dto.RefID) {
 		return
 	}
+	if h.looksLikeBot(c, dto.Meta) {
+		h.dropBotComment(c, &dto)
+		return
+	}
 	cm, err := h.svc.Create(&dto, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
 		if h.handleCreateError(c, err) {
@@ -586,13 +759,14 @@ func (h *Handler) create(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
+	h.recordLocation(cm)
 	h.fillAvatarForComment(cm)
 	isSpam := h.checkSpamAndMark(cm)
 	if !isSpam && !isAuthenticated && h.notifySvc != nil {
 		go h.notifySvc.OnCommentCreate(cm, true)
 	}
 	h.emitCommentCreate(cm, isAuthenticated, isSpam)
-	response.Created(c, toResponse(cm, false))
+	response.Created(c, h.buildResponse(cm, false))
 }
 
 func (h *Handler) updateState(c *gin.Context) {
@@ -610,7 +784,28 @@ func (h *Handler) updateState(c *gin.Context) {
 		response.NotFoundMsg(c, "评论不存在")
 		return
 	}
-	response.OK(c, toResponse(cm, true))
+	h.emitCommentUpdate(cm)
+	response.OK(c, h.buildResponse(cm, true))
+}
+
+// PATCH /comments/:id/pin
+func (h *Handler) pin(c *gin.Context) {
+	var dto PinCommentDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	cm, err := h.svc.SetPin(c.Param("id"), *dto.Pin)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if cm == nil {
+		response.NotFoundMsg(c, "评论不存在")
+		return
+	}
+	h.emitCommentUpdate(cm)
+	response.OK(c, h.buildResponse(cm, true))
 }
 
 func (h *Handler) updateStateCompat(c *gin.Context) {
@@ -665,10 +860,12 @@ func (h *Handler) batchUpdateState(c *gin.Context) {
 		if id == "" {
 			continue
 		}
-		if _, err := h.svc.UpdateState(id, body.State); err != nil {
+		cm, err := h.svc.UpdateState(id, body.State)
+		if err != nil {
 			response.InternalError(c, err)
 			return
 		}
+		h.emitCommentUpdate(cm)
 	}
 	response.NoContent(c)
 }
@@ -677,6 +874,9 @@ func (h *Handler) batchUpdateState(c *gin.Context) {
 func (h *Handler) listByRef(c *gin.Context) {
 	q := pagination.FromContext(c)
 	isAdmin := middleware.IsAuthenticated(c)
+	if !h.ensureRefReadable(c, isAdmin) {
+		return
+	}
 	comments, pag, err := h.svc.ListByRef(c.Param("refId"), q, ListByRefOptions{
 		IsAdmin:       isAdmin,
 		IncludeUnread: !h.shouldAuditComment(),
@@ -685,6 +885,49 @@ func (h *Handler) listByRef(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
+	h.writeCommentPage(c, comments, pag, isAdmin)
+}
+
+// GET /comments/ref/:refId/:parentId/children — page through the replies of a comment
+func (h *Handler) listChildren(c *gin.Context) {
+	q := pagination.FromContext(c)
+	isAdmin := middleware.IsAuthenticated(c)
+	if !h.ensureRefReadable(c, isAdmin) {
+		return
+	}
+	comments, pag, err := h.svc.ListChildren(c.Param("refId"), c.Param("parentId"), q, ListByRefOptions{
+		IsAdmin:       isAdmin,
+		IncludeUnread: !h.shouldAuditComment(),
+	})
+	if err != nil {
+		if errors.Is(err, errCommentParentNotFound) {
+			response.NotFoundMsg(c, "评论不存在")
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	h.writeCommentPage(c, comments, pag, isAdmin)
+}
+
+// ensureRefReadable rejects visitors without access to a password-protected note.
+func (h *Handler) ensureRefReadable(c *gin.Context, isAdmin bool) bool {
+	if isAdmin {
+		return true
+	}
+	locked, err := h.svc.LockedNote(c.Param("refId"))
+	if err != nil {
+		response.InternalError(c, err)
+		return false
+	}
+	if locked != nil && !note.HasAccess(c, locked) {
+		note.RequirePassword(c)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) writeCommentPage(c *gin.Context, comments []models.CommentModel, pag response.Pagination, isAdmin bool) {
 	readers, err := h.loadReadersMap(comments)
 	if err != nil {
 		response.InternalError(c, err)
@@ -693,7 +936,7 @@ func (h *Handler) listByRef(c *gin.Context) {
 	items := make([]commentResponse, len(comments))
 	for i, cm := range comments {
 		h.fillAvatarTree(&cm)
-		items[i] = toResponse(&cm, isAdmin)
+		items[i] = h.buildResponse(&cm, isAdmin)
 	}
 	c.JSON(200, gin.H{
 		"data":       items,
@@ -712,6 +955,9 @@ func (h *Handler) reply(c *gin.Context) {
 	if !h.ensureCommentEnabled(c) {
 		return
 	}
+	if !h.ensureCommentRate(c) {
+		return
+	}
 	createDTO := &CreateCommentDTO{
 		Author: dto.Author,
 		Mail:   dto.Mail,
@@ -719,6 +965,12 @@ func (h *Handler) reply(c *gin.Context) {
 		Text:   dto.Text,
 		Meta:   dto.Meta,
 	}
+	if !h.attributeToReader(c, createDTO) {
+		return
+	}
+	if !h.ensureCommentAcceptable(c, createDTO.Text, createDTO.Mail) {
+		return
+	}
 	cm, err := h.svc.Reply(c.Param("id"), createDTO, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
 		if h.handleReplyError(c, err) {
@@ -727,6 +979,7 @@ func (h *Handler) reply(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
+	h.recordLocation(cm)
 	h.fillAvatarForComment(cm)
 	isAuthenticated := middleware.IsAuthenticated(c)
 	isSpam := h.checkSpamAndMark(cm)
@@ -786,6 +1039,7 @@ func (h *Handler) masterReply(c *gin.Context) {
 		return
 	}
 	_, _ = h.svc.UpdateState(cm.ID, models.CommentRead)
+	h.recordLocation(cm)
 	h.fillAvatarForComment(cm)
 	h.emitCommentCreate(cm, true, false)
 	if h.notifySvc != nil {
@@ -844,9 +1098,10 @@ func (h *Handler) masterComment(c *gin.Context) {
 		return
 	}
 	_, _ = h.svc.UpdateState(cm.ID, models.CommentRead)
+	h.recordLocation(cm)
 	h.fillAvatarForComment(cm)
 	h.emitCommentCreate(cm, true, false)
-	response.Created(c, toResponse(cm, true))
+	response.Created(c, h.buildResponse(cm, true))
 }
 
 // PATCH /comments/edit/:id
@@ -867,23 +1122,45 @@ func (h *Handler) edit(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
+	h.saveText(c, &cm, body.Text, false)
+}
+
+// saveText replaces the text of cm, marks it edited and tells both rooms. A
+// reader's edit is moderated again: spam goes to junk and, when comments are
+// audited, an approved comment goes back to pending.
+func (h *Handler) saveText(c *gin.Context, cm *models.CommentModel, text string, moderate bool) {
 	now := time.Now()
 	if err := h.svc.db.Model(&models.CommentModel{}).
-		Where("id = ?", c.Param("id")).
+		Where("id = ?", cm.ID).
 		Updates(map[string]interface{}{
-			"text":      body.Text,
+			"text":      text,
 			"edited_at": &now,
 		}).Error; err != nil {
 		response.InternalError(c, err)
 		return
 	}
-	if h.hub != nil {
-		payload := gin.H{"id": cm.ID, "text": body.Text}
-		h.hub.BroadcastAdmin("COMMENT_UPDATE", payload)
-		if !cm.IsWhispers {
-			h.hub.BroadcastPublic("COMMENT_UPDATE", payload)
+	updated, err := h.svc.GetByID(cm.ID)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if updated == nil {
+		response.NotFoundMsg(c, "评论不存在")
+		return
+	}
+	if moderate {
+		switch {
+		case h.checkSpamAndMark(updated):
+			updated.State = models.CommentJunk
+		case updated.State == models.CommentRead && h.shouldAuditComment():
+			if _, err := h.svc.UpdateState(updated.ID, models.CommentUnread); err != nil {
+				response.InternalError(c, err)
+				return
+			}
+			updated.State = models.CommentUnread
 		}
 	}
+	h.emitCommentUpdate(updated)
 	response.NoContent(c)
 }
 
@@ -898,6 +1175,15 @@ func (h *Handler) createOnRef(c *gin.Context) {
 	if !h.ensureCommentEnabled(c) {
 		return
 	}
+	if !h.ensureCommentRate(c) {
+		return
+	}
+	if !h.attributeToReader(c, &dto) {
+		return
+	}
+	if !h.ensureCommentAcceptable(c, dto.Text, dto.Mail) {
+		return
+	}
 	dto.RefID = refID
 	if dto.RefType != "" {
 		dto.RefType = normalizeRefType(string(dto.RefType))
@@ -909,6 +1195,10 @@ func (h *Handler) createOnRef(c *gin.Context) {
 	if !isAuthenticated && !h.ensureCommentAllowed(c, dto.RefType, dto.RefID) {
 		return
 	}
+	if h.looksLikeBot(c, dto.Meta) {
+		h.dropBotComment(c, &dto)
+		return
+	}
 	cm, err := h.svc.Create(&dto, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
 		if h.handleCreateError(c, err) {
@@ -917,11 +1207,12 @@ func (h *Handler) createOnRef(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
+	h.recordLocation(cm)
 	h.fillAvatarForComment(cm)
 	isSpam := h.checkSpamAndMark(cm)
 	if !isSpam && !isAuthenticated && h.notifySvc != nil {
 		go h.notifySvc.OnCommentCreate(cm, true)
 	}
 	h.emitCommentCreate(cm, isAuthenticated, isSpam)
-	response.Created(c, toResponse(cm, false))
+	response.Created(c, h.buildResponse(cm, false))
 }
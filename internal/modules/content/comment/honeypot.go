@@ -0,0 +1,118 @@
+package comment
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mx-space/core/internal/middleware"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/response"
+	"go.uber.org/zap"
+)
+
+// renderedAtMetaKey is the meta key carrying when the client rendered the
+// comment form, as a Unix timestamp in seconds or milliseconds.
+const renderedAtMetaKey = "rendered_at"
+
+// looksLikeBot reports whether an anonymous submission filled the honeypot
+// field or arrived sooner after the form rendered than MinDwellSeconds allows.
+// Either check is off while its option is unset; once the dwell check is on,
+// a missing or unparsable render timestamp fails it. The anti-bot keys are
+// removed from meta so they are never stored.
+func (h *Handler) looksLikeBot(c *gin.Context, meta map[string]interface{}) bool {
+	honeypot, renderedAt := "", meta[renderedAtMetaKey]
+	delete(meta, renderedAtMetaKey)
+	if middleware.IsAuthenticated(c) || h.cfgSvc == nil {
+		return false
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return false
+	}
+	opts := cfg.CommentOptions
+
+	if field := strings.TrimSpace(opts.HoneypotField); field != "" {
+		if v, ok := meta[field]; ok {
+			honeypot = strings.TrimSpace(metaString(v))
+			delete(meta, field)
+		}
+		if honeypot != "" {
+			return true
+		}
+	}
+
+	if opts.MinDwellSeconds > 0 {
+		rendered, ok := metaTime(renderedAt)
+		if !ok || time.Since(rendered) < time.Duration(opts.MinDwellSeconds)*time.Second {
+			return true
+		}
+	}
+	return false
+}
+
+// dropBotComment answers a bot submission with a plausible 201 without saving
+// anything, so the bot cannot tell it was caught.
+func (h *Handler) dropBotComment(c *gin.Context, dto *CreateCommentDTO) {
+	h.logger.Info("dropped suspected bot comment",
+		zap.String("ip", c.ClientIP()),
+		zap.String("author", dto.Author),
+		zap.String("ref_id", dto.RefID))
+	now := time.Now()
+	cm := &models.CommentModel{
+		Base:       models.Base{ID: uuid.NewString(), CreatedAt: now, UpdatedAt: now},
+		RefType:    dto.RefType,
+		RefID:      dto.RefID,
+		Author:     dto.Author,
+		URL:        dto.URL,
+		Text:       dto.Text,
+		ParentID:   dto.ParentID,
+		IsWhispers: dto.IsWhisperEnabled(),
+	}
+	response.Created(c, h.buildResponse(cm, false))
+}
+
+func metaString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return ""
+	case bool:
+		if t {
+			return "true"
+		}
+		return ""
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return "set"
+	}
+}
+
+// metaTime parses a Unix timestamp in seconds or milliseconds from a JSON
+// number or numeric string.
+func metaTime(v interface{}) (time.Time, bool) {
+	var n float64
+	switch t := v.(type) {
+	case float64:
+		n = t
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		n = parsed
+	default:
+		return time.Time{}, false
+	}
+	if n <= 0 {
+		return time.Time{}, false
+	}
+	if n < 1e12 {
+		return time.Unix(int64(n), 0), true
+	}
+	return time.UnixMilli(int64(n)), true
+}
@@ -0,0 +1,98 @@
+package comment
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/middleware"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	commentRatePrefix = "mx:comment:rate:"
+	// defaultCommentRateWindow applies when only the count is configured.
+	defaultCommentRateWindow = 60 * time.Second
+)
+
+// commentRateScript is a token bucket holding up to ARGV[1] tokens that refills
+// completely over ARGV[2] milliseconds. It returns {allowed, wait_ms}.
+var commentRateScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * capacity / window)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) * window / capacity)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, wait}
+`)
+
+// WithRedis enables per-IP rate limiting of anonymous comments.
+func WithRedis(rc *pkgredis.Client) HandlerOption {
+	return func(h *Handler) {
+		h.rc = rc
+	}
+}
+
+// commentRateLimit returns the configured bucket size and refill window; a
+// count of zero disables limiting.
+func (h *Handler) commentRateLimit() (int, time.Duration) {
+	if h.cfgSvc == nil {
+		return 0, 0
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return 0, 0
+	}
+	window := time.Duration(cfg.CommentOptions.RateLimitWindow) * time.Second
+	if window <= 0 {
+		window = defaultCommentRateWindow
+	}
+	return cfg.CommentOptions.RateLimitCount, window
+}
+
+// ensureCommentRate rejects anonymous visitors who have used up their comment
+// budget with 429. Owners are never limited, and Redis errors let the comment
+// through.
+func (h *Handler) ensureCommentRate(c *gin.Context) bool {
+	if h.rc == nil || middleware.IsAuthenticated(c) {
+		return true
+	}
+	count, window := h.commentRateLimit()
+	if count <= 0 {
+		return true
+	}
+	ip := c.ClientIP()
+	res, err := commentRateScript.Run(c.Request.Context(), h.rc.Raw(),
+		[]string{commentRatePrefix + ip},
+		count, window.Milliseconds(), time.Now().UnixMilli(),
+	).Int64Slice()
+	if err != nil || len(res) != 2 {
+		h.logger.Warn("comment rate limit check failed", zap.String("ip", ip), zap.Error(err))
+		return true
+	}
+	if res[0] == 1 {
+		return true
+	}
+	retryAfter := int((time.Duration(res[1])*time.Millisecond + time.Second - 1) / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	response.TooManyRequests(c, fmt.Sprintf("评论太频繁了，请 %d 秒后再试", retryAfter))
+	return false
+}
@@ -0,0 +1,102 @@
+package comment
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/middleware"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/response"
+	"gorm.io/gorm"
+)
+
+// attributeToReader links a new comment to the signed-in reader, taking the
+// author, mail and avatar from their profile. Anonymous comments must name
+// an author. It reports false after writing an error response.
+func (h *Handler) attributeToReader(c *gin.Context, dto *CreateCommentDTO) bool {
+	readerID := middleware.CurrentReaderID(c)
+	if readerID == "" || middleware.IsAuthenticated(c) {
+		if strings.TrimSpace(dto.Author) == "" {
+			response.BadRequest(c, "昵称不能为空")
+			return false
+		}
+		return true
+	}
+
+	var reader models.ReaderModel
+	if err := h.svc.db.First(&reader, "id = ?", readerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Unauthorized(c)
+			return false
+		}
+		response.InternalError(c, err)
+		return false
+	}
+	dto.ReaderID = &reader.ID
+	dto.Author = reader.Name
+	if dto.Author == "" {
+		dto.Author = reader.Handle
+	}
+	dto.Mail = reader.Email
+	dto.Avatar = reader.Image
+	return true
+}
+
+// PATCH /comments/:id — the owner changes the state; a reader may edit the
+// text of their own comment.
+func (h *Handler) patch(c *gin.Context) {
+	if middleware.IsAuthenticated(c) {
+		h.updateStateCompat(c)
+		return
+	}
+	var body struct {
+		Text string `json:"text" binding:"required"`
+	}
+	cm, ok := h.ownComment(c)
+	if !ok {
+		return
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if !h.ensureCommentAcceptable(c, body.Text, cm.Mail) {
+		return
+	}
+	h.saveText(c, cm, body.Text, true)
+}
+
+// DELETE /comments/:id — the owner deletes any comment, a reader their own.
+func (h *Handler) remove(c *gin.Context) {
+	if !middleware.IsAuthenticated(c) {
+		if _, ok := h.ownComment(c); !ok {
+			return
+		}
+	}
+	h.delete(c)
+}
+
+// ownComment loads the comment in the path if it belongs to the signed-in
+// reader. It reports false after writing an error response.
+func (h *Handler) ownComment(c *gin.Context) (*models.CommentModel, bool) {
+	readerID := middleware.CurrentReaderID(c)
+	if readerID == "" {
+		response.Unauthorized(c)
+		return nil, false
+	}
+	var cm models.CommentModel
+	if err := h.svc.db.Select("id, mail, is_whispers, reader_id").First(&cm, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFoundMsg(c, "评论不存在")
+			return nil, false
+		}
+		response.InternalError(c, err)
+		return nil, false
+	}
+	if cm.ReaderID == nil || *cm.ReaderID != readerID {
+		response.ForbiddenMsg(c, "只能修改自己的评论")
+		return nil, false
+	}
+	return &cm, true
+}
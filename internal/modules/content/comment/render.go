@@ -0,0 +1,67 @@
+package comment
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/safehtml"
+)
+
+// renderCacheMax bounds the rendered HTML kept in memory; the cache starts over
+// once it is full.
+const renderCacheMax = 4096
+
+// renderCache memoizes rendered comment HTML keyed by the comment text, so an
+// edited comment simply renders afresh.
+var renderCache = struct {
+	sync.Mutex
+	items map[[sha256.Size]byte]string
+}{items: make(map[[sha256.Size]byte]string)}
+
+func renderCommentHTML(text string) string {
+	key := sha256.Sum256([]byte(text))
+	renderCache.Lock()
+	rendered, ok := renderCache.items[key]
+	renderCache.Unlock()
+	if ok {
+		return rendered
+	}
+
+	rendered = safehtml.Markdown(text)
+	renderCache.Lock()
+	if len(renderCache.items) >= renderCacheMax {
+		renderCache.items = make(map[[sha256.Size]byte]string)
+	}
+	renderCache.items[key] = rendered
+	renderCache.Unlock()
+	return rendered
+}
+
+func (h *Handler) shouldRenderMarkdown() bool {
+	if h.cfgSvc == nil {
+		return false
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return false
+	}
+	return cfg.CommentOptions.RenderMarkdown
+}
+
+// buildResponse is toResponse plus the sanitized html field when comment
+// markdown rendering is enabled.
+func (h *Handler) buildResponse(cm *models.CommentModel, isAdmin bool) commentResponse {
+	resp := toResponse(cm, isAdmin)
+	if h.shouldRenderMarkdown() {
+		attachHTML(&resp)
+	}
+	return resp
+}
+
+func attachHTML(resp *commentResponse) {
+	resp.HTML = renderCommentHTML(resp.Text)
+	for i := range resp.Children {
+		attachHTML(&resp.Children[i])
+	}
+}
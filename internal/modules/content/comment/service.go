@@ -20,7 +20,38 @@ type ListByRefOptions struct {
 	IncludeUnread bool
 }
 
+// LockedNote returns the password-protected note refID points to, or nil when
+// refID is not a note or the note has no password.
+func (s *Service) LockedNote(refID string) (*models.NoteModel, error) {
+	var n models.NoteModel
+	if err := s.db.Select("id, n_id, password_hash").
+		Where("id = ? AND password_hash <> ''", refID).
+		Limit(1).Find(&n).Error; err != nil {
+		return nil, err
+	}
+	if n.ID == "" {
+		return nil, nil
+	}
+	return &n, nil
+}
+
 func (s *Service) List(q pagination.Query, refType *string, refID *string, state *int) ([]models.CommentModel, response.Pagination, error) {
+	var comments []models.CommentModel
+	pag, err := pagination.Paginate(s.listQuery(refType, refID, state), q, &comments)
+	return comments, pag, err
+}
+
+// ListAfter is List in cursor mode: it loads the page after q.Cursor.
+func (s *Service) ListAfter(q pagination.Query, refType *string, refID *string, state *int) ([]models.CommentModel, response.CursorPagination, error) {
+	var comments []models.CommentModel
+	pag, err := pagination.PaginateKeyset(s.listQuery(refType, refID, state), q, true, &comments,
+		func(cm models.CommentModel) pagination.Cursor {
+			return pagination.Cursor{CreatedAt: cm.CreatedAt, ID: cm.ID}
+		})
+	return comments, pag, err
+}
+
+func (s *Service) listQuery(refType *string, refID *string, state *int) *gorm.DB {
 	tx := s.db.Model(&models.CommentModel{}).
 		Order("created_at DESC")
 
@@ -36,6 +67,45 @@ func (s *Service) List(q pagination.Query, refType *string, refID *string, state
 	if state != nil {
 		tx = tx.Where("state = ?", *state)
 	}
+	return tx
+}
+
+// SearchOptions narrows a comment search; nil filters are ignored.
+type SearchOptions struct {
+	Keyword string
+	State   *int
+	RefType *string
+}
+
+// Search pages through comments whose author, mail, text or IP contains the
+// keyword, newest first.
+func (s *Service) Search(q pagination.Query, opts SearchOptions) ([]models.CommentModel, response.Pagination, error) {
+	tx := s.db.Model(&models.CommentModel{}).
+		Order("created_at DESC")
+
+	if opts.Keyword != "" {
+		like := "%" + opts.Keyword + "%"
+		tx = tx.Where("author LIKE ? OR mail LIKE ? OR text LIKE ? OR ip LIKE ?", like, like, like, like)
+	}
+	if opts.RefType != nil {
+		if normalized := normalizeRefType(*opts.RefType); normalized != "" {
+			tx = tx.Where("ref_type = ?", normalized)
+		}
+	}
+	if opts.State != nil {
+		tx = tx.Where("state = ?", *opts.State)
+	}
+
+	var comments []models.CommentModel
+	pag, err := pagination.Paginate(tx, q, &comments)
+	return comments, pag, err
+}
+
+// ListByReader pages through the comments left by a reader, newest first.
+func (s *Service) ListByReader(q pagination.Query, readerID string) ([]models.CommentModel, response.Pagination, error) {
+	tx := s.db.Model(&models.CommentModel{}).
+		Where("reader_id = ?", readerID).
+		Order("created_at DESC")
 
 	var comments []models.CommentModel
 	pag, err := pagination.Paginate(tx, q, &comments)
@@ -98,6 +168,8 @@ func (s *Service) Create(dto *CreateCommentDTO, ip, agent string) (*models.Comme
 		IP:         ip,
 		Agent:      agent,
 		Meta:       dto.Meta,
+		Avatar:     dto.Avatar,
+		ReaderID:   dto.ReaderID,
 		IsWhispers: dto.IsWhisperEnabled(),
 		State:      models.CommentUnread,
 		Key:        fmt.Sprintf("#%d", commentsIndex+1),
@@ -157,6 +229,8 @@ func (s *Service) Reply(parentID string, dto *CreateCommentDTO, ip, agent string
 		IP:         ip,
 		Agent:      agent,
 		Meta:       dto.Meta,
+		Avatar:     dto.Avatar,
+		ReaderID:   dto.ReaderID,
 		IsWhispers: parent.IsWhispers,
 		State:      models.CommentUnread,
 		Key:        fmt.Sprintf("%s#%d", parentKey, parent.CommentsIndex),
@@ -304,6 +378,40 @@ type commentTreeNode struct {
 }
 
 func (s *Service) ListByRef(refID string, q pagination.Query, opts ListByRefOptions) ([]models.CommentModel, response.Pagination, error) {
+	roots, _, err := s.loadRefTree(refID, opts)
+	if err != nil {
+		return nil, response.Pagination{}, err
+	}
+	start, end, pag := pageBounds(len(roots), q)
+	page := make([]models.CommentModel, 0, end-start)
+	for _, root := range roots[start:end] {
+		page = append(page, buildCommentTree(root))
+	}
+	return page, pag, nil
+}
+
+// ListChildren pages through the direct replies of parentID, each with its own
+// replies truncated like ListByRef.
+func (s *Service) ListChildren(refID, parentID string, q pagination.Query, opts ListByRefOptions) ([]models.CommentModel, response.Pagination, error) {
+	_, byID, err := s.loadRefTree(refID, opts)
+	if err != nil {
+		return nil, response.Pagination{}, err
+	}
+	parent, ok := byID[strings.TrimSpace(parentID)]
+	if !ok {
+		return nil, response.Pagination{}, errCommentParentNotFound
+	}
+	start, end, pag := pageBounds(len(parent.children), q)
+	page := make([]models.CommentModel, 0, end-start)
+	for _, child := range parent.children[start:end] {
+		page = append(page, buildCommentTree(child))
+	}
+	return page, pag, nil
+}
+
+// loadRefTree loads the visible comments of refID and links them into trees,
+// returning the roots and every node by ID.
+func (s *Service) loadRefTree(refID string, opts ListByRefOptions) ([]*commentTreeNode, map[string]*commentTreeNode, error) {
 	refID = strings.TrimSpace(refID)
 	tx := s.db.Model(&models.CommentModel{}).
 		Where("ref_id = ?", refID).
@@ -320,7 +428,7 @@ func (s *Service) ListByRef(refID string, q pagination.Query, opts ListByRefOpti
 
 	var rows []models.CommentModel
 	if err := tx.Find(&rows).Error; err != nil {
-		return nil, response.Pagination{}, err
+		return nil, nil, err
 	}
 
 	nodes := make([]*commentTreeNode, 0, len(rows))
@@ -355,13 +463,11 @@ func (s *Service) ListByRef(refID string, q pagination.Query, opts ListByRefOpti
 		}
 		parent.children = append(parent.children, node)
 	}
+	return roots, byID, nil
+}
 
-	allRoots := make([]models.CommentModel, len(roots))
-	for i, root := range roots {
-		allRoots[i] = buildCommentTree(root)
-	}
-
-	total := len(allRoots)
+// pageBounds slices total items into page q.
+func pageBounds(total int, q pagination.Query) (int, int, response.Pagination) {
 	start := (q.Page - 1) * q.Size
 	if start > total {
 		start = total
@@ -376,14 +482,13 @@ func (s *Service) ListByRef(refID string, q pagination.Query, opts ListByRefOpti
 		totalPage = (total + q.Size - 1) / q.Size
 	}
 
-	pag := response.Pagination{
+	return start, end, response.Pagination{
 		Total:       int64(total),
 		CurrentPage: q.Page,
 		TotalPage:   totalPage,
 		Size:        q.Size,
 		HasNextPage: q.Page < totalPage,
 	}
-	return allRoots[start:end], pag, nil
 }
 
 func findCommentParentNode(node *commentTreeNode, byID map[string]*commentTreeNode, byKey map[string]*commentTreeNode) (*commentTreeNode, bool) {
@@ -409,14 +514,21 @@ func findCommentParentNode(node *commentTreeNode, byID map[string]*commentTreeNo
 	return nil, hasParent
 }
 
+// buildCommentTree inlines the first childrenPreviewSize replies of each
+// comment and records the full count in ChildrenCount.
 func buildCommentTree(node *commentTreeNode) models.CommentModel {
 	comment := node.model
+	comment.ChildrenCount = len(node.children)
 	if len(node.children) == 0 {
 		comment.Children = nil
 		return comment
 	}
-	children := make([]models.CommentModel, len(node.children))
-	for i, child := range node.children {
+	preview := node.children
+	if len(preview) > childrenPreviewSize {
+		preview = preview[:childrenPreviewSize]
+	}
+	children := make([]models.CommentModel, len(preview))
+	for i, child := range preview {
 		children[i] = buildCommentTree(child)
 	}
 	comment.Children = children
@@ -428,7 +540,36 @@ func (s *Service) UpdateState(id string, state models.CommentState) (*models.Com
 	if err != nil || c == nil {
 		return c, err
 	}
-	return c, s.db.Model(c).Update("state", state).Error
+	if err := s.db.Model(c).Update("state", state).Error; err != nil {
+		return nil, err
+	}
+	c.State = state
+	return c, nil
+}
+
+// SetPin pins or unpins a comment. Pinning unpins every other comment on the
+// same ref, so each ref has at most one pinned comment. It returns nil when the
+// comment does not exist.
+func (s *Service) SetPin(id string, pin bool) (*models.CommentModel, error) {
+	c, err := s.GetByID(id)
+	if err != nil || c == nil {
+		return c, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if pin {
+			if err := tx.Model(&models.CommentModel{}).
+				Where("ref_id = ? AND id <> ? AND pin = ?", c.RefID, c.ID, true).
+				Update("pin", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(c).Update("pin", pin).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Pin = pin
+	return c, nil
 }
 
 func (s *Service) Delete(id string) error {
@@ -1,6 +1,7 @@
 package comment
 
 import (
+	netmail "net/mail"
 	"regexp"
 	"strings"
 	"unicode"
@@ -32,49 +33,111 @@ func hasChinese(s string) bool {
 }
 
 // checkSpam determines whether a comment should be flagged as spam.
-// Returns true if the comment is spam.
+// Returns true if the comment is spam. Configured spam keywords always apply;
+// the built-in rules only when AntiSpam is on.
 func checkSpam(cm *models.CommentModel, opts *config.CommentOptions, masterName string) bool {
-	if !opts.AntiSpam {
+	// Master (admin) comments are never spam.
+	if strings.TrimSpace(masterName) != "" && strings.EqualFold(cm.Author, masterName) {
 		return false
 	}
 
-	// Master (admin) comments are never spam.
-	if strings.TrimSpace(masterName) != "" && strings.EqualFold(cm.Author, masterName) {
+	text := cm.Text
+	if matchesKeyword(text, opts.SpamKeywords) {
+		return true
+	}
+	if !opts.AntiSpam {
 		return false
 	}
 
-	// Check blocked IPs (supports regex patterns).
-	ip := strings.TrimSpace(cm.IP)
-	if ip != "" {
-		for _, pattern := range opts.BlockIPs {
-			pattern = strings.TrimSpace(pattern)
-			if pattern == "" {
-				continue
-			}
-			if pattern == ip {
+	if ipBlocked(cm.IP, opts.BlockIPs) {
+		return true
+	}
+	if matchesKeyword(text, defaultBlockedKeywords) {
+		return true
+	}
+
+	// Reject comments without Chinese characters if DisableNoChinese is set.
+	if opts.DisableNoChinese && !hasChinese(text) {
+		return true
+	}
+
+	return false
+}
+
+// ipBlocked reports whether ip equals or matches (as a regex) any pattern.
+func ipBlocked(ip string, patterns []string) bool {
+	ip = strings.TrimSpace(ip)
+	if ip == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if pattern == ip {
+			return true
+		}
+		if re, err := regexp.Compile(pattern); err == nil {
+			if re.MatchString(ip) {
 				return true
 			}
-			if re, err := regexp.Compile(pattern); err == nil {
-				if re.MatchString(ip) {
-					return true
-				}
-			}
 		}
 	}
+	return false
+}
 
-	// Check text against spam keywords (config + defaults).
-	text := cm.Text
-	allKeywords := make([]string, 0, len(opts.SpamKeywords)+len(defaultBlockedKeywords))
-	allKeywords = append(allKeywords, opts.SpamKeywords...)
-	allKeywords = append(allKeywords, defaultBlockedKeywords...)
+// validMail reports whether mail is empty or a single bare address.
+func validMail(mail string) bool {
+	mail = strings.TrimSpace(mail)
+	if mail == "" {
+		return true
+	}
+	addr, err := netmail.ParseAddress(mail)
+	return err == nil && addr.Address == mail && addr.Name == ""
+}
 
-	for _, kw := range allKeywords {
+// mailDomainBlocked reports whether the domain of mail equals a blocked domain,
+// case-insensitively. A "*.example.com" entry blocks every subdomain of
+// example.com but not example.com itself.
+func mailDomainBlocked(mail string, domains []string) bool {
+	at := strings.LastIndex(mail, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSpace(mail[at+1:]))
+	if domain == "" {
+		return false
+	}
+	for _, blocked := range domains {
+		blocked = strings.ToLower(strings.TrimSpace(blocked))
+		if blocked == "" {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(blocked, "*."); ok {
+			if strings.HasSuffix(domain, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if domain == strings.TrimPrefix(blocked, "@") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesKeyword reports whether text contains any keyword, case-insensitively,
+// or matches it as a regex.
+func matchesKeyword(text string, keywords []string) bool {
+	lower := strings.ToLower(text)
+	for _, kw := range keywords {
 		kw = strings.TrimSpace(kw)
 		if kw == "" {
 			continue
 		}
 		// Try exact substring first (fast path).
-		if strings.Contains(strings.ToLower(text), strings.ToLower(kw)) {
+		if strings.Contains(lower, strings.ToLower(kw)) {
 			return true
 		}
 		// Try as regex pattern.
@@ -84,11 +147,5 @@ func checkSpam(cm *models.CommentModel, opts *config.CommentOptions, masterName
 			}
 		}
 	}
-
-	// Reject comments without Chinese characters if DisableNoChinese is set.
-	if opts.DisableNoChinese && !hasChinese(text) {
-		return true
-	}
-
 	return false
 }
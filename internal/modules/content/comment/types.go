@@ -9,6 +9,10 @@ import (
 
 const nestedReplyMax = 10
 
+// childrenPreviewSize is how many replies per comment ListByRef inlines; the
+// rest are paged through ListChildren.
+const childrenPreviewSize = 5
+
 var (
 	errCommentParentNotFound = errors.New("parent comment not found")
 	errCommentRefNotFound    = errors.New("comment ref model not found")
@@ -18,7 +22,7 @@ var (
 type CreateCommentDTO struct {
 	RefType         models.RefType         `json:"ref_type"`
 	RefID           string                 `json:"ref_id"`
-	Author          string                 `json:"author"    binding:"required"`
+	Author          string                 `json:"author"`
 	Mail            string                 `json:"mail"`
 	URL             string                 `json:"url"`
 	Text            string                 `json:"text"      binding:"required"`
@@ -26,6 +30,10 @@ type CreateCommentDTO struct {
 	Meta            map[string]interface{} `json:"meta"`
 	IsWhispers      bool                   `json:"isWhispers"`
 	IsWhispersSnake bool                   `json:"is_whispers"`
+
+	// ReaderID and Avatar come from the signed-in reader, never the body.
+	ReaderID *string `json:"-"`
+	Avatar   string  `json:"-"`
 }
 
 func (d *CreateCommentDTO) IsWhisperEnabled() bool {
@@ -39,6 +47,10 @@ type UpdateCommentStateDTO struct {
 	State models.CommentState `json:"state" binding:"required"`
 }
 
+type PinCommentDTO struct {
+	Pin *bool `json:"pin" binding:"required"`
+}
+
 type ReplyCommentDTO struct {
 	Author string                 `json:"author"`
 	Mail   string                 `json:"mail"`
@@ -55,10 +67,12 @@ type commentResponse struct {
 	Mail          string                 `json:"mail,omitempty"`
 	URL           string                 `json:"url"`
 	Text          string                 `json:"text"`
+	HTML          string                 `json:"html,omitempty"`
 	State         models.CommentState    `json:"state"`
 	ParentID      *string                `json:"parent_id"`
 	Parent        interface{}            `json:"parent,omitempty"`
 	Children      []commentResponse      `json:"children"`
+	ChildrenCount int                    `json:"children_count"`
 	CommentsIndex int                    `json:"comments_index"`
 	Key           string                 `json:"key"`
 	IP            string                 `json:"ip,omitempty"`
@@ -88,11 +102,16 @@ func toResponse(c *models.CommentModel, isAdmin bool) commentResponse {
 	for i, ch := range c.Children {
 		children[i] = toResponse(&ch, isAdmin)
 	}
+	childrenCount := c.ChildrenCount
+	if childrenCount < len(children) {
+		childrenCount = len(children)
+	}
 	modified := models.NullableModified(c.CreatedAt, c.UpdatedAt)
 	r := commentResponse{
 		ID: c.ID, RefType: refTypeForResponse(c.RefType), RefID: c.RefID,
 		Author: c.Author, URL: c.URL, Text: c.Text,
-		State: c.State, ParentID: c.ParentID, Children: children,
+		State: c.State, ParentID: c.ParentID,
+		Children: children, ChildrenCount: childrenCount,
 		CommentsIndex: c.CommentsIndex, Key: c.Key,
 		Pin: c.Pin, IsWhispers: c.IsWhispers, Avatar: c.Avatar,
 		Meta: c.Meta, ReaderID: c.ReaderID, Source: c.Source,
@@ -0,0 +1,392 @@
+package draft
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/readtime"
+	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/mx-space/core/internal/pkg/textdiff"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMaxVersions = 20
+	// autosaveMergeWindow folds saves closer together than this into one version.
+	autosaveMergeWindow = 60 * time.Second
+)
+
+// AutosaveDTO is the request body for PUT /posts/:id/draft and /notes/:id/draft.
+type AutosaveDTO struct {
+	Title *string `json:"title"`
+	Text  *string `json:"text"`
+}
+
+type versionSummary struct {
+	ID        string    `json:"id"`
+	Version   int       `json:"version"`
+	Title     string    `json:"title"`
+	WordCount int       `json:"wordCount"`
+	SavedAt   time.Time `json:"savedAt"`
+	Current   bool      `json:"current"`
+}
+
+type versionDetail struct {
+	versionSummary
+	Text string `json:"text"`
+	// Diff is a unified diff from the published text to this version.
+	Diff string `json:"diff"`
+}
+
+// SetMaxVersions sets how many history versions are kept per article draft.
+func (s *Service) SetMaxVersions(n int) {
+	if n > 0 {
+		s.maxVersions = n
+	}
+}
+
+func (s *Service) versionLimit() int {
+	if s.maxVersions > 0 {
+		return s.maxVersions
+	}
+	return defaultMaxVersions
+}
+
+func refTypes(refType models.DraftRefType) []models.DraftRefType {
+	switch refType {
+	case models.DraftRefPost:
+		return []models.DraftRefType{models.DraftRefPost, models.DraftRefPostLegacy}
+	case models.DraftRefNote:
+		return []models.DraftRefType{models.DraftRefNote, models.DraftRefNoteLegacy}
+	default:
+		return []models.DraftRefType{refType}
+	}
+}
+
+// findArticleDraft returns the working draft of an article, or nil.
+func (s *Service) findArticleDraft(refType models.DraftRefType, refID string) (*models.DraftModel, error) {
+	var d models.DraftModel
+	if err := s.db.Where("ref_type IN ? AND ref_id = ?", refTypes(refType), refID).
+		Order("version DESC").First(&d).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Autosave stores title and text as the working draft of an article without
+// touching the published content. The previous draft becomes a history version
+// unless the last version is less than a minute old.
+func (s *Service) Autosave(refType models.DraftRefType, refID string, dto *AutosaveDTO) (*models.DraftModel, error) {
+	d, err := s.findArticleDraft(refType, refID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		created := models.DraftModel{RefType: refType, RefID: &refID, Version: 1}
+		if dto.Title != nil {
+			created.Title = *dto.Title
+		}
+		if dto.Text != nil {
+			created.Text = *dto.Text
+		}
+		return &created, s.db.Create(&created).Error
+	}
+
+	updates := map[string]interface{}{}
+	if dto.Title != nil && *dto.Title != d.Title {
+		updates["title"] = *dto.Title
+	}
+	if dto.Text != nil && *dto.Text != d.Text {
+		updates["text"] = *dto.Text
+	}
+	if len(updates) == 0 {
+		return d, nil
+	}
+
+	lastSaved, err := s.lastVersionAt(d)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(lastSaved) >= autosaveMergeWindow {
+		history := models.DraftHistoryModel{
+			DraftID:          d.ID,
+			Version:          d.Version,
+			Title:            d.Title,
+			Text:             d.Text,
+			TypeSpecificData: d.TypeSpecificData,
+			SavedAt:          time.Now(),
+			IsFullSnapshot:   true,
+		}
+		if err := s.db.Create(&history).Error; err != nil {
+			return nil, err
+		}
+		updates["version"] = d.Version + 1
+	}
+	if err := s.db.Model(d).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	go s.pruneHistory(d.ID)
+	return d, nil
+}
+
+// lastVersionAt is when the newest history version of d was taken, or when d
+// was created if it has none.
+func (s *Service) lastVersionAt(d *models.DraftModel) (time.Time, error) {
+	var latest models.DraftHistoryModel
+	err := s.db.Select("saved_at").Where("draft_id = ?", d.ID).
+		Order("saved_at DESC").Limit(1).Find(&latest).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	if latest.SavedAt.IsZero() {
+		return d.CreatedAt, nil
+	}
+	return latest.SavedAt, nil
+}
+
+// pruneHistory drops all but the newest versions of a draft.
+func (s *Service) pruneHistory(draftID string) {
+	var stale []string
+	if err := s.db.Model(&models.DraftHistoryModel{}).
+		Where("draft_id = ?", draftID).
+		Order("version DESC").
+		Offset(s.versionLimit()).
+		Pluck("id", &stale).Error; err != nil {
+		s.logger().Warn("list stale draft versions failed", zap.String("draft_id", draftID), zap.Error(err))
+		return
+	}
+	if len(stale) == 0 {
+		return
+	}
+	if err := s.db.Where("id IN ?", stale).Delete(&models.DraftHistoryModel{}).Error; err != nil {
+		s.logger().Warn("prune draft versions failed", zap.String("draft_id", draftID), zap.Error(err))
+	}
+}
+
+func (s *Service) logger() *zap.Logger {
+	return zap.L().Named("DraftService")
+}
+
+// ListVersions returns the working draft followed by its history, newest first.
+func (s *Service) ListVersions(refType models.DraftRefType, refID string) ([]versionSummary, error) {
+	d, err := s.findArticleDraft(refType, refID)
+	if err != nil || d == nil {
+		return []versionSummary{}, err
+	}
+	history, err := s.GetHistory(d.ID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]versionSummary, 0, len(history)+1)
+	out = append(out, currentSummary(d))
+	for _, h := range history {
+		out = append(out, historySummary(&h))
+	}
+	return out, nil
+}
+
+// GetVersion returns one version by its ID (the draft ID for the working draft)
+// with a diff against publishedText. It returns nil when the version does not
+// belong to the article.
+func (s *Service) GetVersion(refType models.DraftRefType, refID, versionID, publishedText string) (*versionDetail, error) {
+	d, err := s.findArticleDraft(refType, refID)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	var detail versionDetail
+	if versionID == d.ID {
+		detail = versionDetail{versionSummary: currentSummary(d), Text: d.Text}
+	} else {
+		h, err := s.findHistory(d.ID, versionID)
+		if err != nil || h == nil {
+			return nil, err
+		}
+		detail = versionDetail{versionSummary: historySummary(h), Text: h.Text}
+	}
+	detail.Diff = textdiff.Unified("published", fmt.Sprintf("version %d", detail.Version), publishedText, detail.Text)
+	return &detail, nil
+}
+
+// RestoreArticleVersion copies a history version back into the working draft.
+func (s *Service) RestoreArticleVersion(refType models.DraftRefType, refID, versionID string) (*models.DraftModel, error) {
+	d, err := s.findArticleDraft(refType, refID)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	h, err := s.findHistory(d.ID, versionID)
+	if err != nil || h == nil {
+		return nil, err
+	}
+	restored, err := s.RestoreVersion(d.ID, h.Version)
+	if err != nil {
+		return nil, err
+	}
+	go s.pruneHistory(d.ID)
+	return s.GetByID(restored.ID)
+}
+
+func (s *Service) findHistory(draftID, id string) (*models.DraftHistoryModel, error) {
+	var h models.DraftHistoryModel
+	if err := s.db.Where("draft_id = ? AND id = ?", draftID, id).First(&h).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &h, nil
+}
+
+func currentSummary(d *models.DraftModel) versionSummary {
+	return versionSummary{
+		ID:        d.ID,
+		Version:   d.Version,
+		Title:     d.Title,
+		WordCount: readtime.Estimate(d.Text).WordCount,
+		SavedAt:   d.UpdatedAt,
+		Current:   true,
+	}
+}
+
+func historySummary(h *models.DraftHistoryModel) versionSummary {
+	return versionSummary{
+		ID:        h.ID,
+		Version:   h.Version,
+		Title:     h.Title,
+		WordCount: readtime.Estimate(h.Text).WordCount,
+		SavedAt:   h.SavedAt,
+	}
+}
+
+// DeleteForRef removes every draft of an article along with its history. Post
+// and note services call it when the article is deleted.
+func DeleteForRef(db *gorm.DB, refType models.DraftRefType, refID string) error {
+	ids := db.Model(&models.DraftModel{}).Select("id").Where("ref_type IN ? AND ref_id = ?", refTypes(refType), refID)
+	if err := db.Where("draft_id IN (?)", ids).Delete(&models.DraftHistoryModel{}).Error; err != nil {
+		return err
+	}
+	return db.Where("ref_type IN ? AND ref_id = ?", refTypes(refType), refID).Delete(&models.DraftModel{}).Error
+}
+
+// ArticleHandler mounts draft versioning under /posts/:id and /notes/:id.
+type ArticleHandler struct{ svc *Service }
+
+func NewArticleHandler(svc *Service) *ArticleHandler { return &ArticleHandler{svc: svc} }
+
+func (h *ArticleHandler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
+	for _, article := range []struct {
+		path    string
+		refType models.DraftRefType
+		// getParam matches the wildcard name of the article's public GET routes.
+		getParam string
+	}{
+		{"/posts", models.DraftRefPost, "identifier"},
+		{"/notes", models.DraftRefNote, "id"},
+	} {
+		g := rg.Group(article.path, authMW)
+		refType, getParam := article.refType, article.getParam
+		g.PUT("/:id/draft", func(c *gin.Context) { h.autosave(c, refType, c.Param("id")) })
+		g.GET("/:"+getParam+"/drafts", func(c *gin.Context) { h.versions(c, refType, c.Param(getParam)) })
+		g.GET("/:"+getParam+"/drafts/:versionId", func(c *gin.Context) { h.version(c, refType, c.Param(getParam)) })
+		g.POST("/:id/drafts/:versionId/restore", func(c *gin.Context) { h.restore(c, refType, c.Param("id")) })
+	}
+}
+
+// publishedText loads the article text, reporting false when it does not exist.
+func (h *ArticleHandler) publishedText(refType models.DraftRefType, id string) (string, bool, error) {
+	var text struct{ Text string }
+	var model interface{} = &models.PostModel{}
+	if refType == models.DraftRefNote {
+		model = &models.NoteModel{}
+	}
+	result := h.svc.db.Model(model).Select("text").Where("id = ?", id).Limit(1).Scan(&text)
+	if result.Error != nil {
+		return "", false, result.Error
+	}
+	return text.Text, result.RowsAffected > 0, nil
+}
+
+func (h *ArticleHandler) articleExists(c *gin.Context, refType models.DraftRefType, id string) (string, bool) {
+	text, ok, err := h.publishedText(refType, id)
+	if err != nil {
+		response.InternalError(c, err)
+		return "", false
+	}
+	if !ok {
+		if refType == models.DraftRefNote {
+			response.NotFoundMsg(c, "日记不存在")
+		} else {
+			response.NotFoundMsg(c, "文章不存在")
+		}
+		return "", false
+	}
+	return text, true
+}
+
+func (h *ArticleHandler) autosave(c *gin.Context, refType models.DraftRefType, id string) {
+	var dto AutosaveDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if _, ok := h.articleExists(c, refType, id); !ok {
+		return
+	}
+	d, err := h.svc.Autosave(refType, id, &dto)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, toResponse(d))
+}
+
+func (h *ArticleHandler) versions(c *gin.Context, refType models.DraftRefType, id string) {
+	if _, ok := h.articleExists(c, refType, id); !ok {
+		return
+	}
+	items, err := h.svc.ListVersions(refType, id)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, items)
+}
+
+func (h *ArticleHandler) version(c *gin.Context, refType models.DraftRefType, id string) {
+	published, ok := h.articleExists(c, refType, id)
+	if !ok {
+		return
+	}
+	detail, err := h.svc.GetVersion(refType, id, c.Param("versionId"), published)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if detail == nil {
+		response.NotFoundMsg(c, "历史版本不存在")
+		return
+	}
+	response.OK(c, detail)
+}
+
+func (h *ArticleHandler) restore(c *gin.Context, refType models.DraftRefType, id string) {
+	if _, ok := h.articleExists(c, refType, id); !ok {
+		return
+	}
+	d, err := h.svc.RestoreArticleVersion(refType, id, c.Param("versionId"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if d == nil {
+		response.NotFoundMsg(c, "历史版本不存在")
+		return
+	}
+	response.OK(c, toResponse(d))
+}
@@ -72,7 +72,10 @@ func toResponse(d *models.DraftModel) draftResponse {
 	}
 }
 
-type Service struct{ db *gorm.DB }
+type Service struct {
+	db          *gorm.DB
+	maxVersions int
+}
 
 func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 
@@ -0,0 +1,133 @@
+package link
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	appcfg "github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/netguard"
+	"go.uber.org/zap"
+)
+
+const (
+	avatarFileType     = "avatar"
+	avatarMaxBytes     = 2 << 20
+	avatarFetchTimeout = 15 * time.Second
+	// localAvatarMarker identifies avatars already served from the static dir.
+	localAvatarMarker = "/objects/" + avatarFileType + "/"
+)
+
+// avatarExts maps accepted avatar content types to file extensions.
+var avatarExts = map[string]string{
+	"image/png":                ".png",
+	"image/jpeg":               ".jpg",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"image/avif":               ".avif",
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+	"image/svg+xml":            ".svg",
+}
+
+// avatarClient fetches avatars submitted with link applications; it refuses
+// loopback and internal addresses.
+var avatarClient = netguard.NewClient(0)
+
+// staticDir mirrors the file module: MX_STATIC_DIR or "static" next to the
+// executable.
+func staticDir() string {
+	return appcfg.ResolveRuntimePath(os.Getenv("MX_STATIC_DIR"), "static")
+}
+
+// internalizeAvatar copies the avatar of an approved link into the static dir
+// and points the link at the local copy, when EnableAvatarInternalization is on.
+func (h *Handler) internalizeAvatar(l models.LinkModel) {
+	if l.State != models.LinkPass || h.cfgSvc == nil {
+		return
+	}
+	avatar := strings.TrimSpace(l.Avatar)
+	if avatar == "" || strings.Contains(avatar, localAvatarMarker) ||
+		!(strings.HasPrefix(avatar, "http://") || strings.HasPrefix(avatar, "https://")) {
+		return
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil || cfg == nil || !cfg.FriendLinkOptions.EnableAvatarInternalization {
+		return
+	}
+
+	name, err := downloadAvatar(avatar, l.ID)
+	if err != nil {
+		h.svc.logger.Warn("友链头像转存失败", zap.String("link", l.Name), zap.String("avatar", avatar), zap.Error(err))
+		return
+	}
+	base := strings.TrimRight(firstNonEmpty(cfg.URL.ServerURL, cfg.URL.WebURL), "/")
+	localURL := base + "/api/v2" + localAvatarMarker + name
+	if err := h.svc.db.Model(&models.LinkModel{}).Where("id = ?", l.ID).
+		Update("avatar", localURL).Error; err != nil {
+		h.svc.logger.Warn("更新友链头像失败", zap.String("link", l.Name), zap.Error(err))
+	}
+}
+
+// downloadAvatar saves the image at rawURL as <static>/avatar/<id>.<ext> and
+// returns the file name.
+func downloadAvatar(rawURL, id string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), avatarFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", linkCheckerUA)
+	resp, err := avatarClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext, ok := avatarExts[strings.ToLower(mediaType)]
+	if !ok {
+		return "", fmt.Errorf("unsupported content type %q", mediaType)
+	}
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, avatarMaxBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(payload) > avatarMaxBytes {
+		return "", fmt.Errorf("avatar larger than %d bytes", avatarMaxBytes)
+	}
+
+	dir := filepath.Join(staticDir(), avatarFileType)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := "link-" + id + ext
+	tmp := filepath.Join(dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, payload, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return name, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
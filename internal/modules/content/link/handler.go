@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +16,7 @@ import (
 	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/modules/gateway/gateway"
+	"github.com/mx-space/core/internal/modules/gateway/webhook"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
 	pkgmail "github.com/mx-space/core/internal/pkg/mail"
 	"github.com/mx-space/core/internal/pkg/pagination"
@@ -21,13 +24,26 @@ import (
 )
 
 type Handler struct {
-	svc    *Service
-	cfgSvc *appconfigs.Service
-	hub    *gateway.Hub
+	svc      *Service
+	cfgSvc   *appconfigs.Service
+	hub      *gateway.Hub
+	webhooks *webhook.Service
 }
 
-func NewHandler(svc *Service, cfgSvc *appconfigs.Service, hub *gateway.Hub) *Handler {
-	return &Handler{svc: svc, cfgSvc: cfgSvc, hub: hub}
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// WithWebhooks dispatches LINK_APPLY to webhooks on public applications.
+func WithWebhooks(svc *webhook.Service) HandlerOption {
+	return func(h *Handler) { h.webhooks = svc }
+}
+
+func NewHandler(svc *Service, cfgSvc *appconfigs.Service, hub *gateway.Hub, opts ...HandlerOption) *Handler {
+	h := &Handler{svc: svc, cfgSvc: cfgSvc, hub: hub}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
 }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
@@ -50,6 +66,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 		a.POST("/avatar/migrate", h.migrateAvatars)
 		a.PUT("/:id", h.update)
 		a.PATCH("/:id", h.patch)
+		a.PATCH("/:id/state", h.setState)
 		a.DELETE("/:id", h.delete)
 	}
 }
@@ -176,9 +193,15 @@ func (h *Handler) create(c *gin.Context) {
 	if !isAdmin && h.hub != nil {
 		h.hub.BroadcastAdmin("LINK_APPLY", toResponse(l, true))
 	}
+	if !isAdmin && h.webhooks != nil {
+		go h.webhooks.Dispatch("LINK_APPLY", toResponse(l, true))
+	}
 	if !isAdmin && h.cfgSvc != nil {
 		go h.sendApplyNotification(l, dto.Author)
 	}
+	if isAdmin {
+		go h.internalizeAvatar(*l)
+	}
 	response.Created(c, toResponse(l, isAdmin))
 }
 
@@ -197,7 +220,7 @@ func (h *Handler) get(c *gin.Context) {
 
 // GET /links/health — health check
 func (h *Handler) health(c *gin.Context) {
-	result := h.svc.HealthCheck()
+	result := h.svc.HealthCheck(c.Request.Context())
 	response.OK(c, result)
 }
 
@@ -215,9 +238,41 @@ func (h *Handler) audit(c *gin.Context) {
 	if l.Email != "" && h.cfgSvc != nil {
 		go h.sendPassNotification(l)
 	}
+	go h.internalizeAvatar(*l)
 	response.NoContent(c)
 }
 
+// PATCH /links/:id/state — approve or reject a link, mailing the applicant
+func (h *Handler) setState(c *gin.Context) {
+	var dto UpdateLinkStateDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if *dto.State < models.LinkPass || *dto.State > models.LinkReject {
+		response.BadRequest(c, "无效的友链状态")
+		return
+	}
+	l, err := h.svc.SetState(c.Param("id"), *dto.State)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if l == nil {
+		response.NotFoundMsg(c, "友链不存在")
+		return
+	}
+	if l.Email != "" && h.cfgSvc != nil {
+		if l.State == models.LinkPass && strings.TrimSpace(dto.Reason) == "" {
+			go h.sendPassNotification(l)
+		} else {
+			go h.sendAuditNotification(l, l.State, dto.Reason)
+		}
+	}
+	go h.internalizeAvatar(*l)
+	response.OK(c, toResponse(l, true))
+}
+
 // POST /links/audit/reason/:id — send audit result with reason
 func (h *Handler) auditReason(c *gin.Context) {
 	var dto AuditReasonDTO
@@ -238,9 +293,12 @@ func (h *Handler) auditReason(c *gin.Context) {
 		return
 	}
 
+	l.State = dto.State
+
 	if l.Email != "" && h.cfgSvc != nil {
 		go h.sendAuditNotification(l, dto.State, dto.Reason)
 	}
+	go h.internalizeAvatar(*l)
 	response.NoContent(c)
 }
 
@@ -250,25 +308,37 @@ func (h *Handler) migrateAvatars(c *gin.Context) {
 	h.svc.db.Where("state = ? AND (avatar = '' OR avatar IS NULL)", models.LinkPass).Find(&links)
 
 	client := &http.Client{Timeout: 10 * time.Second}
-	updated := 0
+	var updated int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthCheckConcurrency)
 	for _, l := range links {
 		domain := extractDomain(l.URL)
 		if domain == "" {
 			continue
 		}
 
-		avatarURL := "https://icons.duckduckgo.com/ip3/" + domain + ".ico"
-		resp, err := client.Get(avatarURL)
-		if err != nil || resp.StatusCode >= 400 {
-			if resp != nil {
-				resp.Body.Close()
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(l models.LinkModel, domain string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			avatarURL := "https://icons.duckduckgo.com/ip3/" + domain + ".ico"
+			resp, err := client.Get(avatarURL)
+			if err != nil {
+				return
 			}
-			continue
-		}
-		resp.Body.Close()
-		h.svc.db.Model(&l).Update("avatar", avatarURL)
-		updated++
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				return
+			}
+			if h.svc.db.Model(&l).Update("avatar", avatarURL).Error == nil {
+				atomic.AddInt64(&updated, 1)
+				l.Avatar = avatarURL
+				h.internalizeAvatar(l)
+			}
+		}(l, domain)
 	}
+	wg.Wait()
 	response.OK(c, gin.H{"message": "avatar migration completed", "updated": updated})
 }
 
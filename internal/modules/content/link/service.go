@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/mx-space/core/internal/models"
@@ -14,6 +15,13 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	// healthCheckConcurrency bounds outbound requests during a health check.
+	healthCheckConcurrency = 8
+	healthCheckTimeout     = 10 * time.Second
+	linkCheckerUA          = "Mozilla/5.0 (compatible; Mix-Space Friend Link Checker; +https://github.com/BLxcwg666/mx-core-go)"
+)
+
 type Service struct {
 	db     *gorm.DB
 	logger *zap.Logger
@@ -161,14 +169,20 @@ func (s *Service) Delete(id string) error {
 
 // Approve sets link state to Pass and returns the updated link.
 func (s *Service) Approve(id string) (*models.LinkModel, error) {
+	return s.SetState(id, models.LinkPass)
+}
+
+// SetState moves a link to state and returns the updated link, or nil when it
+// does not exist.
+func (s *Service) SetState(id string, state models.LinkState) (*models.LinkModel, error) {
 	l, err := s.GetByID(id)
 	if err != nil || l == nil {
 		return l, err
 	}
-	if err := s.db.Model(l).Update("state", models.LinkPass).Error; err != nil {
+	if err := s.db.Model(l).Update("state", state).Error; err != nil {
 		return nil, err
 	}
-	l.State = models.LinkPass
+	l.State = state
 	return l, nil
 }
 
@@ -214,38 +228,65 @@ func (s *Service) StateCount() map[string]int64 {
 	return counts
 }
 
-func (s *Service) HealthCheck() map[string]HealthResult {
+// HealthCheck HEADs every approved link, healthCheckConcurrency at a time,
+// keyed by link ID. Unreachable links have status 0 or an HTTP error status and
+// a message.
+func (s *Service) HealthCheck(ctx context.Context) map[string]HealthResult {
 	var links []models.LinkModel
 	s.db.Where("state = ?", models.LinkPass).Find(&links)
 
 	result := make(map[string]HealthResult, len(links))
-	client := &http.Client{Timeout: 10 * time.Second}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthCheckConcurrency)
+	client := &http.Client{Timeout: healthCheckTimeout}
 
 	for _, l := range links {
-		s.logger.Debug(fmt.Sprintf("检查友链 %s 的健康状态：GET -> %s", l.Name, l.URL))
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.URL, nil)
-		cancel()
-		if err != nil {
-			s.logger.Debug(fmt.Sprintf("友链 %s 检查失败", l.Name), zap.Error(err))
-			result[l.ID] = HealthResult{ID: l.ID, Status: 0, Message: err.Error()}
-			continue
-		}
-		req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Mix-Space Friend Link Checker; +https://github.com/BLxcwg666/mx-core-go)")
-		resp, err := client.Do(req)
-		if err != nil {
-			s.logger.Debug(fmt.Sprintf("友链 %s 检查失败", l.Name), zap.Error(err))
-			result[l.ID] = HealthResult{ID: l.ID, Status: 0, Message: err.Error()}
-			continue
-		}
-		resp.Body.Close()
-		if resp.StatusCode >= 400 {
-			s.logger.Debug(fmt.Sprintf("友链 %s 不可用：HTTP %d", l.Name, resp.StatusCode))
-			result[l.ID] = HealthResult{ID: l.ID, Status: resp.StatusCode,
-				Message: fmt.Sprintf("HTTP %d", resp.StatusCode)}
-		} else {
-			result[l.ID] = HealthResult{ID: l.ID, Status: resp.StatusCode}
-		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(l models.LinkModel) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r := s.checkLink(ctx, client, &l)
+			mu.Lock()
+			result[l.ID] = r
+			mu.Unlock()
+		}(l)
 	}
+	wg.Wait()
 	return result
 }
+
+func (s *Service) checkLink(ctx context.Context, client *http.Client, l *models.LinkModel) HealthResult {
+	s.logger.Debug(fmt.Sprintf("检查友链 %s 的健康状态：HEAD -> %s", l.Name, l.URL))
+	status, err := probeLink(ctx, client, http.MethodHead, l.URL)
+	// Some servers refuse HEAD outright; ask again with GET before giving up.
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = probeLink(ctx, client, http.MethodGet, l.URL)
+	}
+	if err != nil {
+		s.logger.Debug(fmt.Sprintf("友链 %s 检查失败", l.Name), zap.Error(err))
+		return HealthResult{ID: l.ID, Status: 0, Message: err.Error()}
+	}
+	if status >= 400 {
+		s.logger.Debug(fmt.Sprintf("友链 %s 不可用：HTTP %d", l.Name, status))
+		return HealthResult{ID: l.ID, Status: status, Message: fmt.Sprintf("HTTP %d", status)}
+	}
+	return HealthResult{ID: l.ID, Status: status}
+}
+
+func probeLink(ctx context.Context, client *http.Client, method, target string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", linkCheckerUA)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -33,6 +33,13 @@ type AuditReasonDTO struct {
 	Reason string           `json:"reason"`
 }
 
+// UpdateLinkStateDTO approves or rejects a link; Reason is mailed to the
+// applicant along with the result.
+type UpdateLinkStateDTO struct {
+	State  *models.LinkState `json:"state"  binding:"required"`
+	Reason string            `json:"reason"`
+}
+
 type linkResponse struct {
 	ID          string           `json:"id"`
 	Name        string           `json:"name"`
@@ -0,0 +1,155 @@
+package note
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/middleware"
+	"github.com/mx-space/core/internal/models"
+	jwtpkg "github.com/mx-space/core/internal/pkg/jwt"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/mx-space/core/internal/pkg/response"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// AccessTokenHeader carries a note access token issued by POST /notes/nid/:nid/verify.
+	AccessTokenHeader  = "X-Note-Token"
+	accessCookiePrefix = "mx-note-token-"
+	accessTokenTTL     = time.Hour
+
+	passwordFailPrefix = "mx:note:password_fail:"
+	passwordFailLimit  = 5
+	passwordFailWindow = 15 * time.Minute
+)
+
+// IsLocked reports whether n is password protected.
+func IsLocked(n *models.NoteModel) bool {
+	return n != nil && n.Password != ""
+}
+
+// HasAccess reports whether the request may read n: the note is not locked,
+// the caller is an admin, or it presents a valid access token for n. A token
+// grant marks the response private so the API cache never stores it.
+func HasAccess(c *gin.Context, n *models.NoteModel) bool {
+	if !IsLocked(n) || middleware.IsAuthenticated(c) {
+		return true
+	}
+	token := strings.TrimSpace(c.GetHeader(AccessTokenHeader))
+	if token == "" {
+		token, _ = c.Cookie(accessCookieName(n))
+	}
+	if token == "" || !verifyAccessToken(n, token) {
+		return false
+	}
+	c.Header("Cache-Control", "private, no-store")
+	return true
+}
+
+// RequirePassword aborts with 403 and {"require_password": true}.
+func RequirePassword(c *gin.Context) {
+	const message = "这篇日记需要密码才能查看"
+	response.SetResponseMessage(c, message)
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"ok":               0,
+		"code":             http.StatusForbidden,
+		"message":          message,
+		"require_password": true,
+	})
+}
+
+// toAccessibleResponse is toResponse with the text of a locked note withheld
+// unless the request may read it.
+func toAccessibleResponse(c *gin.Context, n *models.NoteModel) noteResponse {
+	resp := toResponse(n)
+	if !HasAccess(c, n) {
+		resp.Text = ""
+	}
+	return resp
+}
+
+// toPublicResponse withholds the text of a locked note, for broadcasts to
+// every visitor.
+func toPublicResponse(n *models.NoteModel) noteResponse {
+	resp := toResponse(n)
+	if IsLocked(n) {
+		resp.Text = ""
+	}
+	return resp
+}
+
+func accessCookieName(n *models.NoteModel) string {
+	return accessCookiePrefix + strconv.Itoa(n.NID)
+}
+
+// issueAccessToken returns a token for n valid until expires. The password hash
+// is part of the MAC, so changing the password revokes issued tokens.
+func issueAccessToken(n *models.NoteModel, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + base64.RawURLEncoding.EncodeToString(accessTokenMAC(n, exp))
+}
+
+func verifyAccessToken(n *models.NoteModel, token string) bool {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, accessTokenMAC(n, exp)) == 1
+}
+
+func accessTokenMAC(n *models.NoteModel, exp string) []byte {
+	return jwtpkg.Sum(fmt.Sprintf("note:%s:%s:%s", n.ID, exp, n.Password))
+}
+
+// checkPassword compares password with a bcrypt hash, or with the hex md5
+// stored by notes migrated from the Node core.
+func checkPassword(hash, password string) bool {
+	if strings.HasPrefix(hash, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	sum := md5.Sum([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(hash)), []byte(hex.EncodeToString(sum[:]))) == 1
+}
+
+// SetRedis enables per-IP limiting of wrong note passwords (optional).
+func (s *Service) SetRedis(rc *pkgredis.Client) { s.rc = rc }
+
+// passwordBlocked reports whether ip has used up its wrong password attempts.
+func (s *Service) passwordBlocked(ctx context.Context, ip string) bool {
+	if s.rc == nil {
+		return false
+	}
+	raw, err := s.rc.Get(ctx, passwordFailPrefix+ip)
+	if err != nil || raw == "" {
+		return false
+	}
+	n, _ := strconv.Atoi(raw)
+	return n >= passwordFailLimit
+}
+
+func (s *Service) recordPasswordFailure(ctx context.Context, ip string) {
+	if s.rc == nil {
+		return
+	}
+	key := passwordFailPrefix + ip
+	if n, err := s.rc.Raw().Incr(ctx, key).Result(); err == nil && n == 1 {
+		_ = s.rc.Raw().Expire(ctx, key, passwordFailWindow).Err()
+	}
+}
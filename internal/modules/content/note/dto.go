@@ -38,6 +38,17 @@ type UpdateNoteDTO struct {
 	Images       []models.Image   `json:"images"`
 }
 
+// SetTopicDTO is the request body for PATCH /notes/:id/topic; a null or
+// missing topicId detaches the note.
+type SetTopicDTO struct {
+	TopicID *string `json:"topicId"`
+}
+
+// VerifyPasswordDTO is the request body for unlocking a password-protected note.
+type VerifyPasswordDTO struct {
+	Password string `json:"password" binding:"required"`
+}
+
 type ListQuery struct {
 	Year      *int    `form:"year"`
 	SortBy    *string `form:"sortBy"`
@@ -3,6 +3,7 @@ package note
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/mx-space/core/internal/modules/processing/textmacro"
 	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -37,6 +39,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	notes.GET("/list/:id", h.listAround)
 	notes.GET("/topics/:id", h.listByTopic)
 	notes.GET("/nid/:nid", h.getByNID)
+	notes.POST("/nid/:nid/verify", h.verifyPassword)
 	notes.GET("/:id", h.getByID)
 	notes.POST("/:id/like", h.like)
 
@@ -45,6 +48,8 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	authed.PUT("/:id", h.update)
 	authed.PATCH("/:id", h.update)         // legacy compatibility
 	authed.PATCH("/:id/publish", h.update) // legacy compatibility
+	authed.PATCH("/:id/topic", h.setTopic)
+	authed.POST("/:id/refresh-images", h.refreshImages)
 	authed.DELETE("/:id", h.delete)
 }
 
@@ -62,7 +67,7 @@ func (h *Handler) list(c *gin.Context) {
 	}
 	items := make([]noteResponse, len(notes))
 	for i, n := range notes {
-		items[i] = toResponse(&n)
+		items[i] = toAccessibleResponse(c, &n)
 	}
 	response.Paged(c, items, pag)
 }
@@ -83,9 +88,15 @@ func (h *Handler) getByNID(c *gin.Context) {
 		response.NotFoundMsg(c, "日记不存在")
 		return
 	}
+	if !HasAccess(c, note) {
+		RequirePassword(c)
+		return
+	}
+	// c is recycled once the request ends; take what the goroutine needs now.
+	logger, id := tracing.GetLogger(c).Named("NoteService"), note.ID
 	go func() {
-		if err := h.svc.IncrementReadCount(note.ID); err != nil {
-			zap.L().Named("NoteService").Warn("increment note read count failed", zap.String("id", note.ID), zap.Error(err))
+		if err := h.svc.IncrementReadCount(id); err != nil {
+			logger.Warn("increment note read count failed", zap.String("id", id), zap.Error(err))
 		}
 	}()
 	resp := toResponse(note)
@@ -127,13 +138,22 @@ func (h *Handler) getByID(c *gin.Context) {
 		response.ForbiddenMsg(c, "不要偷看人家的小心思啦~")
 		return
 	}
+	if !HasAccess(c, note) {
+		RequirePassword(c)
+		return
+	}
+	// c is recycled once the request ends; take what the goroutine needs now.
+	logger, id := tracing.GetLogger(c).Named("NoteService"), note.ID
 	go func() {
-		if err := h.svc.IncrementReadCount(note.ID); err != nil {
-			zap.L().Named("NoteService").Warn("increment note read count failed", zap.String("id", note.ID), zap.Error(err))
+		if err := h.svc.IncrementReadCount(id); err != nil {
+			logger.Warn("increment note read count failed", zap.String("id", id), zap.Error(err))
 		}
 	}()
 	resp := toResponse(note)
-	h.applyMacros(&resp, middleware.IsAuthenticated(c))
+	// Lookups by ID serve the admin editor, which must see the raw text.
+	if !middleware.IsAuthenticated(c) {
+		h.applyMacros(&resp, false)
+	}
 	response.OK(c, resp)
 }
 
@@ -148,7 +168,7 @@ func (h *Handler) latest(c *gin.Context) {
 		return
 	}
 	isAdmin := middleware.IsAuthenticated(c)
-	resp := toResponse(note)
+	resp := toAccessibleResponse(c, note)
 	next, err := h.findAdjacentNoteByCreated(resp.Created, isAdmin, false)
 	if err != nil {
 		response.InternalError(c, err)
@@ -174,7 +194,7 @@ func (h *Handler) listByTopic(c *gin.Context) {
 	}
 	out := make([]noteResponse, len(items))
 	for i, n := range items {
-		out[i] = toResponse(&n)
+		out[i] = toAccessibleResponse(c, &n)
 	}
 	response.Paged(c, out, pag)
 }
@@ -221,6 +241,54 @@ func (h *Handler) listAround(c *gin.Context) {
 	})
 }
 
+// verifyPassword POST /notes/nid/:nid/verify
+func (h *Handler) verifyPassword(c *gin.Context) {
+	nid, err := strconv.Atoi(c.Param("nid"))
+	if err != nil {
+		response.BadRequest(c, "invalid nid")
+		return
+	}
+	var dto VerifyPasswordDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	note, err := h.svc.GetByNID(nid, middleware.IsAuthenticated(c))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if note == nil {
+		response.NotFoundMsg(c, "日记不存在")
+		return
+	}
+	if !IsLocked(note) {
+		response.BadRequest(c, "这篇日记没有设置密码")
+		return
+	}
+
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+	if h.svc.passwordBlocked(ctx, ip) {
+		response.TooManyRequests(c, "密码错误次数过多，请稍后再试")
+		return
+	}
+	if !checkPassword(note.Password, dto.Password) {
+		h.svc.recordPasswordFailure(ctx, ip)
+		response.ForbiddenMsg(c, "密码错误")
+		return
+	}
+
+	expires := time.Now().Add(accessTokenTTL)
+	token := issueAccessToken(note, expires)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(accessCookieName(note), token, int(accessTokenTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	response.OK(c, gin.H{
+		"token":     token,
+		"expiresAt": expires,
+	})
+}
+
 func (h *Handler) like(c *gin.Context) {
 	id := c.Param("id")
 	if err := h.svc.IncrementLikeCount(id); err != nil {
@@ -235,7 +303,7 @@ func (h *Handler) like(c *gin.Context) {
 			"ip":   c.ClientIP(),
 		},
 	}).Error; err != nil {
-		zap.L().Named("NoteService").Warn("create note like activity failed", zap.String("id", id), zap.String("ip", c.ClientIP()), zap.Error(err))
+		tracing.GetLogger(c).Named("NoteService").Warn("create note like activity failed", zap.String("id", id), zap.String("ip", c.ClientIP()), zap.Error(err))
 	}
 	response.NoContent(c)
 }
@@ -255,7 +323,7 @@ func (h *Handler) create(c *gin.Context) {
 		go h.notifySvc.OnNoteCreate(note)
 	}
 	if h.hub != nil && note.IsPublished {
-		h.hub.BroadcastPublic("NOTE_CREATE", toResponse(note))
+		h.hub.BroadcastPublic("NOTE_CREATE", toPublicResponse(note))
 	}
 	response.Created(c, toResponse(note))
 }
@@ -276,11 +344,52 @@ func (h *Handler) update(c *gin.Context) {
 		return
 	}
 	if h.hub != nil && note.IsPublished {
-		h.hub.BroadcastPublic("NOTE_UPDATE", toResponse(note))
+		h.hub.BroadcastPublic("NOTE_UPDATE", toPublicResponse(note))
 	}
 	response.OK(c, toResponse(note))
 }
 
+// PATCH /notes/:id/topic — attach a note to a topic or detach it
+func (h *Handler) setTopic(c *gin.Context) {
+	var dto SetTopicDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	note, err := h.svc.SetTopic(c.Param("id"), dto.TopicID)
+	if err != nil {
+		if errors.Is(err, errTopicNotFound) {
+			response.NotFoundMsg(c, "主题不存在")
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	if note == nil {
+		response.NotFoundMsg(c, "日记不存在")
+		return
+	}
+	if h.hub != nil && note.IsPublished {
+		h.hub.BroadcastPublic("NOTE_UPDATE", toPublicResponse(note))
+	}
+	response.OK(c, toResponse(note))
+}
+
+// refreshImages POST /notes/:id/refresh-images  [auth]
+// Re-fetches every image in the note text, including ones already measured.
+func (h *Handler) refreshImages(c *gin.Context) {
+	images, err := h.svc.RefreshImages(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if images == nil {
+		response.NotFoundMsg(c, "日记不存在")
+		return
+	}
+	response.OK(c, gin.H{"images": images})
+}
+
 func (h *Handler) delete(c *gin.Context) {
 	id := c.Param("id")
 	note, err := h.svc.GetByID(id)
@@ -293,7 +402,7 @@ func (h *Handler) delete(c *gin.Context) {
 		return
 	}
 	if h.hub != nil && note != nil && note.IsPublished {
-		h.hub.BroadcastPublic("NOTE_DELETE", toResponse(note))
+		h.hub.BroadcastPublic("NOTE_DELETE", toPublicResponse(note))
 	}
 	response.NoContent(c)
 }
@@ -1,28 +1,95 @@
 package note
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
 	mysqlDriver "github.com/go-sql-driver/mysql"
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/content/draft"
+	"github.com/mx-space/core/internal/modules/processing/imagemeta"
 	"github.com/mx-space/core/internal/pkg/pagination"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+var errTopicNotFound = errors.New("topic not found")
+
 type Service struct {
-	db *gorm.DB
+	db           *gorm.DB
+	onChange     func()
+	onTextChange func(delta int64)
+	onPublish    func(id string)
+	onPublicURL  func(id string)
+	onIndex      func(id string)
+	rc           *pkgredis.Client
+	imageMeta    *imagemeta.Service
 }
 
 func NewService(db *gorm.DB) *Service {
 	return &Service{db: db}
 }
 
+// SetImageMeta fills in image dimensions and accent colors after saves (optional).
+func (s *Service) SetImageMeta(im *imagemeta.Service) { s.imageMeta = im }
+
+// RefreshImages re-reads every image of a note, returning nil when it does not exist.
+func (s *Service) RefreshImages(ctx context.Context, id string) ([]models.Image, error) {
+	if s.imageMeta == nil {
+		return nil, errors.New("image metadata is not configured")
+	}
+	return s.imageMeta.Refresh(ctx, &models.NoteModel{}, id, true)
+}
+
+// SetOnChange registers a callback run after content is created, updated or
+// deleted, e.g. to drop cached aggregates (optional).
+func (s *Service) SetOnChange(fn func()) { s.onChange = fn }
+
+func (s *Service) changed() {
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// SetOnPublish registers a callback run in the background when an update
+// turns an unpublished note into a published one (optional).
+func (s *Service) SetOnPublish(fn func(id string)) { s.onPublish = fn }
+
+// SetOnPublicURL registers a callback run in the background when a note is
+// created published or an update publishes it (optional).
+func (s *Service) SetOnPublicURL(fn func(id string)) { s.onPublicURL = fn }
+
+// SetOnIndexChange registers a callback run in the background with the ID of
+// a note that was created, updated or deleted, e.g. to keep search indexes
+// current (optional).
+func (s *Service) SetOnIndexChange(fn func(id string)) { s.onIndex = fn }
+
+func (s *Service) indexChanged(id string) {
+	if s.onIndex != nil {
+		go s.onIndex(id)
+	}
+}
+
+// SetOnTextChange registers a callback receiving how many characters of text a
+// create, update or delete added or removed (optional).
+func (s *Service) SetOnTextChange(fn func(delta int64)) { s.onTextChange = fn }
+
+func (s *Service) textChanged(before, after string) {
+	if s.onTextChange == nil {
+		return
+	}
+	if delta := int64(utf8.RuneCountInString(after) - utf8.RuneCountInString(before)); delta != 0 {
+		s.onTextChange(delta)
+	}
+}
+
 func (s *Service) List(q pagination.Query, lq ListQuery, isAdmin bool) ([]models.NoteModel, response.Pagination, error) {
 	tx := s.db.Model(&models.NoteModel{}).
 		Preload("Topic")
@@ -255,6 +322,13 @@ func (s *Service) Create(dto *CreateNoteDTO) (*models.NoteModel, error) {
 			}
 			return nil, err
 		}
+		s.changed()
+		s.textChanged("", note.Text)
+		s.indexChanged(note.ID)
+		s.imageMeta.Enqueue(context.Background(), &models.NoteModel{}, note.ID)
+		if note.IsPublished && s.onPublicURL != nil {
+			go s.onPublicURL(note.ID)
+		}
 		return &note, nil
 	}
 
@@ -275,11 +349,38 @@ func isDuplicateNIDError(err error) bool {
 	return strings.Contains(msg, "duplicate entry") && strings.Contains(msg, "n_id")
 }
 
+// SetTopic attaches a note to topicID, or detaches it when topicID is nil or
+// empty. It returns nil when the note does not exist.
+func (s *Service) SetTopic(id string, topicID *string) (*models.NoteModel, error) {
+	n, err := s.GetByID(id)
+	if err != nil || n == nil {
+		return n, err
+	}
+	var value interface{}
+	if topicID != nil && strings.TrimSpace(*topicID) != "" {
+		var count int64
+		if err := s.db.Model(&models.TopicModel{}).Where("id = ?", strings.TrimSpace(*topicID)).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, errTopicNotFound
+		}
+		value = strings.TrimSpace(*topicID)
+	}
+	if err := s.db.Model(n).Update("topic_id", value).Error; err != nil {
+		return nil, err
+	}
+	s.changed()
+	return s.GetByID(id)
+}
+
 func (s *Service) Update(id string, dto *UpdateNoteDTO) (*models.NoteModel, error) {
 	note, err := s.GetByID(id)
 	if err != nil || note == nil {
 		return note, err
 	}
+	oldText := note.Text
 
 	updates := map[string]interface{}{}
 	if dto.Title != nil {
@@ -338,14 +439,42 @@ func (s *Service) Update(id string, dto *UpdateNoteDTO) (*models.NoteModel, erro
 		}
 	}
 
+	wasPublished := note.IsPublished
 	if err := s.db.Model(note).Updates(updates).Error; err != nil {
 		return nil, err
 	}
+	if !wasPublished && dto.IsPublished != nil && *dto.IsPublished {
+		if s.onPublish != nil {
+			go s.onPublish(note.ID)
+		}
+		if s.onPublicURL != nil {
+			go s.onPublicURL(note.ID)
+		}
+	}
+	s.changed()
+	s.indexChanged(note.ID)
+	if dto.Text != nil {
+		s.textChanged(oldText, *dto.Text)
+		s.imageMeta.Enqueue(context.Background(), &models.NoteModel{}, note.ID)
+	}
 	return note, nil
 }
 
 func (s *Service) Delete(id string) error {
-	return s.db.Delete(&models.NoteModel{}, "id = ?", id).Error
+	var removed models.NoteModel
+	if s.onTextChange != nil {
+		s.db.Select("text").First(&removed, "id = ?", id)
+	}
+	if err := s.db.Delete(&models.NoteModel{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if err := draft.DeleteForRef(s.db, models.DraftRefNote, id); err != nil {
+		return err
+	}
+	s.changed()
+	s.textChanged(removed.Text, "")
+	s.indexChanged(id)
+	return nil
 }
 
 func (s *Service) IncrementReadCount(id string) error {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/middleware"
@@ -74,8 +75,12 @@ func toResponse(p *models.PageModel) pageResponse {
 }
 
 type Service struct {
-	db          *gorm.DB
-	slugTracker *slugtracker.Service
+	db           *gorm.DB
+	slugTracker  *slugtracker.Service
+	onChange     func()
+	onTextChange func(delta int64)
+	onPublicURL  func(id string)
+	onIndex      func(id string)
 }
 
 func NewService(db *gorm.DB) *Service { return &Service{db: db} }
@@ -83,6 +88,44 @@ func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 // SetSlugTracker wires up slug change tracking (optional).
 func (s *Service) SetSlugTracker(st *slugtracker.Service) { s.slugTracker = st }
 
+// SetOnChange registers a callback run after content is created, updated or
+// deleted, e.g. to drop cached aggregates (optional).
+func (s *Service) SetOnChange(fn func()) { s.onChange = fn }
+
+func (s *Service) changed() {
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// SetOnPublicURL registers a callback run in the background when a page is
+// created or its slug changes (optional).
+func (s *Service) SetOnPublicURL(fn func(id string)) { s.onPublicURL = fn }
+
+// SetOnIndexChange registers a callback run in the background with the ID of
+// a page that was created, updated or deleted, e.g. to keep search indexes
+// current (optional).
+func (s *Service) SetOnIndexChange(fn func(id string)) { s.onIndex = fn }
+
+func (s *Service) indexChanged(id string) {
+	if s.onIndex != nil {
+		go s.onIndex(id)
+	}
+}
+
+// SetOnTextChange registers a callback receiving how many characters of text a
+// create, update or delete added or removed (optional).
+func (s *Service) SetOnTextChange(fn func(delta int64)) { s.onTextChange = fn }
+
+func (s *Service) textChanged(before, after string) {
+	if s.onTextChange == nil {
+		return
+	}
+	if delta := int64(utf8.RuneCountInString(after) - utf8.RuneCountInString(before)); delta != 0 {
+		s.onTextChange(delta)
+	}
+}
+
 func (s *Service) List(q pagination.Query, lq ListQuery) ([]models.PageModel, response.Pagination, error) {
 	tx := s.db.Model(&models.PageModel{})
 	for _, order := range pageListOrders(lq) {
@@ -178,7 +221,20 @@ func (s *Service) Create(dto *CreatePageDTO) (*models.PageModel, error) {
 	} else {
 		p.AllowComment = true
 	}
-	return &p, s.db.Create(&p).Error
+	if err := s.db.Create(&p).Error; err != nil {
+		return &p, err
+	}
+	s.changed()
+	s.textChanged("", p.Text)
+	s.indexChanged(p.ID)
+	if s.slugTracker != nil {
+		// A tracker for the new slug would redirect this page away from itself.
+		go s.slugTracker.Untrack("page", p.Slug) //nolint:errcheck
+	}
+	if s.onPublicURL != nil {
+		go s.onPublicURL(p.ID)
+	}
+	return &p, nil
 }
 
 func (s *Service) Update(id string, dto *UpdatePageDTO) (*models.PageModel, error) {
@@ -186,6 +242,7 @@ func (s *Service) Update(id string, dto *UpdatePageDTO) (*models.PageModel, erro
 	if err != nil || p == nil {
 		return p, err
 	}
+	oldText := p.Text
 	updates := map[string]interface{}{}
 	var oldSlug string
 	if dto.Slug != nil && *dto.Slug != p.Slug {
@@ -224,8 +281,20 @@ func (s *Service) Update(id string, dto *UpdatePageDTO) (*models.PageModel, erro
 	if err := s.db.Model(p).Updates(updates).Error; err != nil {
 		return nil, err
 	}
+	s.changed()
+	s.indexChanged(p.ID)
+	if dto.Text != nil {
+		s.textChanged(oldText, *dto.Text)
+	}
 	if oldSlug != "" && s.slugTracker != nil {
-		go s.slugTracker.Track(oldSlug, "page", p.ID) //nolint:errcheck
+		newSlug := *dto.Slug
+		go func() {
+			_ = s.slugTracker.Untrack("page", newSlug)
+			_ = s.slugTracker.Track(oldSlug, "page", p.ID)
+		}()
+	}
+	if oldSlug != "" && s.onPublicURL != nil {
+		go s.onPublicURL(p.ID)
 	}
 	return p, nil
 }
@@ -234,11 +303,23 @@ func (s *Service) Delete(id string) error {
 	if s.slugTracker != nil {
 		go s.slugTracker.DeleteByTargetID(id) //nolint:errcheck
 	}
-	return s.db.Delete(&models.PageModel{}, "id = ?", id).Error
+	var removed models.PageModel
+	if s.onTextChange != nil {
+		s.db.Select("text").First(&removed, "id = ?", id)
+	}
+	if err := s.db.Delete(&models.PageModel{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	s.changed()
+	s.textChanged(removed.Text, "")
+	s.indexChanged(id)
+	return nil
 }
 
 func (s *Service) Reorder(id string, order int) {
-	s.db.Model(&models.PageModel{}).Where("id = ?", id).Update("order_num", order)
+	if s.db.Model(&models.PageModel{}).Where("id = ?", id).Update("order_num", order).Error == nil {
+		s.changed()
+	}
 }
 
 type Handler struct {
@@ -295,6 +376,9 @@ func (h *Handler) getBySlug(c *gin.Context) {
 		return
 	}
 	if p == nil {
+		if h.svc.slugTracker.RedirectIfTracked(c, "page", c.Param("slug")) {
+			return
+		}
 		response.NotFoundMsg(c, "页面不存在")
 		return
 	}
@@ -304,7 +388,8 @@ func (h *Handler) getBySlug(c *gin.Context) {
 }
 
 func (h *Handler) getByIdentifier(c *gin.Context) {
-	p, err := h.svc.GetByIdentifier(c.Param("identifier"))
+	identifier := c.Param("identifier")
+	p, err := h.svc.GetByIdentifier(identifier)
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -314,7 +399,10 @@ func (h *Handler) getByIdentifier(c *gin.Context) {
 		return
 	}
 	resp := toResponse(p)
-	h.applyMacros(&resp, middleware.IsAuthenticated(c))
+	// Lookups by ID serve the admin editor, which must see the raw text.
+	if isAdmin := middleware.IsAuthenticated(c); !isAdmin || p.ID != identifier {
+		h.applyMacros(&resp, isAdmin)
+	}
 	response.OK(c, resp)
 }
 
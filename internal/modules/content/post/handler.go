@@ -1,14 +1,18 @@
 package post
 
 import (
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/modules/gateway/gateway"
 	"github.com/mx-space/core/internal/modules/gateway/notify"
 	"github.com/mx-space/core/internal/modules/processing/textmacro"
+	"github.com/mx-space/core/internal/modules/system/util/slugtracker"
 	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	"go.uber.org/zap"
 )
 
@@ -31,6 +35,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	posts.GET("", h.list)
 	posts.GET("/latest", h.latest)
 	posts.GET("/get-url/:slug", h.getURLBySlug)
+	posts.GET("/:identifier/related", h.related)
 	posts.GET("/:identifier/:slug", h.getByCategoryAndSlug)
 	posts.GET("/:identifier", h.getByIdentifier)
 	posts.POST("/:id/like", h.like)
@@ -40,6 +45,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	authed.PUT("/:id", h.update)
 	authed.PATCH("/:id", h.update)          // legacy compatibility
 	authed.PATCH("/:id/publish", h.publish) // returns {success:true} for TS compatibility
+	authed.POST("/:id/refresh-images", h.refreshImages)
 	authed.DELETE("/:id", h.delete)
 }
 
@@ -101,14 +107,19 @@ func (h *Handler) getByIdentifier(c *gin.Context) {
 		return
 	}
 
+	// c is recycled once the request ends; take what the goroutine needs now.
+	logger, id := tracing.GetLogger(c).Named("PostService"), post.ID
 	go func() {
-		if err := h.svc.IncrementReadCount(post.ID); err != nil {
-			zap.L().Named("PostService").Warn("increment post read count failed", zap.String("id", post.ID), zap.Error(err))
+		if err := h.svc.IncrementReadCount(id); err != nil {
+			logger.Warn("increment post read count failed", zap.String("id", id), zap.Error(err))
 		}
 	}()
 
 	resp := toResponse(post)
-	h.applyMacros(&resp, isAdmin)
+	// Lookups by ID serve the admin editor, which must see the raw text.
+	if !isAdmin || post.ID != identifier {
+		h.applyMacros(&resp, isAdmin)
+	}
 	response.OK(c, resp)
 }
 
@@ -147,13 +158,19 @@ func (h *Handler) getByCategoryAndSlug(c *gin.Context) {
 		return
 	}
 	if post == nil {
+		// Older rows tracked the bare slug rather than the category path.
+		if h.svc.slugTracker.RedirectIfTracked(c, "post", slugtracker.PostPath(category, slug), slug) {
+			return
+		}
 		response.NotFoundMsg(c, "文章不存在")
 		return
 	}
 
+	// c is recycled once the request ends; take what the goroutine needs now.
+	logger, id := tracing.GetLogger(c).Named("PostService"), post.ID
 	go func() {
-		if err := h.svc.IncrementReadCount(post.ID); err != nil {
-			zap.L().Named("PostService").Warn("increment post read count failed", zap.String("id", post.ID), zap.Error(err))
+		if err := h.svc.IncrementReadCount(id); err != nil {
+			logger.Warn("increment post read count failed", zap.String("id", id), zap.Error(err))
 		}
 	}()
 
@@ -162,6 +179,26 @@ func (h *Handler) getByCategoryAndSlug(c *gin.Context) {
 	response.OK(c, resp)
 }
 
+// related GET /posts/:id/related
+func (h *Handler) related(c *gin.Context) {
+	size := 0
+	if raw := c.Query("size"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			size = parsed
+		}
+	}
+	items, err := h.svc.Related(c.Request.Context(), c.Param("identifier"), size)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if items == nil {
+		response.NotFoundMsg(c, "文章不存在")
+		return
+	}
+	response.OK(c, gin.H{"data": items})
+}
+
 // latest GET /posts/latest
 func (h *Handler) latest(c *gin.Context) {
 	post, err := h.svc.GetLatest(middleware.IsAuthenticated(c))
@@ -191,7 +228,7 @@ func (h *Handler) like(c *gin.Context) {
 			"ip":   c.ClientIP(),
 		},
 	}).Error; err != nil {
-		zap.L().Named("PostService").Warn("create post like activity failed", zap.String("id", id), zap.String("ip", c.ClientIP()), zap.Error(err))
+		tracing.GetLogger(c).Named("PostService").Warn("create post like activity failed", zap.String("id", id), zap.String("ip", c.ClientIP()), zap.Error(err))
 	}
 	response.NoContent(c)
 }
@@ -280,6 +317,21 @@ func (h *Handler) publish(c *gin.Context) {
 	response.OK(c, gin.H{"success": true})
 }
 
+// refreshImages POST /posts/:id/refresh-images  [auth]
+// Re-fetches every image in the post text, including ones already measured.
+func (h *Handler) refreshImages(c *gin.Context) {
+	images, err := h.svc.RefreshImages(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if images == nil {
+		response.NotFoundMsg(c, "文章不存在")
+		return
+	}
+	response.OK(c, gin.H{"images": images})
+}
+
 // delete DELETE /posts/:id  [auth]
 func (h *Handler) delete(c *gin.Context) {
 	id := c.Param("id")
@@ -0,0 +1,273 @@
+package post
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mx-space/core/internal/models"
+	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/dialect"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"gorm.io/gorm"
+)
+
+const (
+	relatedCachePrefix = "mx:cache:post_related:"
+	relatedCacheTTL    = 10 * time.Minute
+
+	relatedDefaultSize = 6
+	relatedMaxSize     = 20
+	// relatedCandidateLimit bounds how many posts are scored per request.
+	relatedCandidateLimit = 200
+	// relatedMaxTags caps the tags matched against, keeping the query small.
+	relatedMaxTags = 10
+
+	relatedTagWeight      = 2.0
+	relatedCategoryWeight = 3.0
+	// relatedRecencyDays is the age at which the recency bonus halves.
+	relatedRecencyDays = 180.0
+)
+
+// RelatedPost is the compact shape returned by GET /posts/:id/related.
+type RelatedPost struct {
+	ID           string         `json:"id"`
+	Title        string         `json:"title"`
+	Slug         string         `json:"slug"`
+	CategorySlug string         `json:"categorySlug"`
+	Created      time.Time      `json:"created"`
+	Images       []models.Image `json:"images"`
+	Summary      string         `json:"summary,omitempty"`
+}
+
+// SetRedis enables caching of related posts (optional).
+func (s *Service) SetRedis(rc *pkgredis.Client) { s.rc = rc }
+
+// SetConfigService picks the AI summary language of related posts (optional).
+func (s *Service) SetConfigService(cfgSvc *appconfigs.Service) { s.cfgSvc = cfgSvc }
+
+// Related returns up to size published posts related to the post id, scored by
+// shared tags, same category and recency. It returns nil when the post does not
+// exist or is unpublished.
+func (s *Service) Related(ctx context.Context, id string, size int) ([]RelatedPost, error) {
+	if size <= 0 {
+		size = relatedDefaultSize
+	}
+	if size > relatedMaxSize {
+		size = relatedMaxSize
+	}
+
+	key := fmt.Sprintf("%s%s:%d", relatedCachePrefix, id, size)
+	if s.rc != nil {
+		if raw, err := s.rc.Get(ctx, key); err == nil && raw != "" {
+			var cached []RelatedPost
+			if err := json.Unmarshal([]byte(raw), &cached); err == nil {
+				return cached, nil
+			}
+		}
+	}
+
+	var post models.PostModel
+	if err := s.db.Select("id, category_id, tags").
+		Where("id = ? AND is_published = ?", id, true).
+		Limit(1).Find(&post).Error; err != nil {
+		return nil, err
+	}
+	if post.ID == "" {
+		return nil, nil
+	}
+
+	tags := normalizeTags(post.Tags)
+	if len(tags) > relatedMaxTags {
+		tags = tags[:relatedMaxTags]
+	}
+
+	// Candidates share the category or at least one tag.
+	match := s.db.Where("1 = 0")
+	if post.CategoryID != nil {
+		match = match.Or("category_id = ?", *post.CategoryID)
+	}
+	for _, tag := range tags {
+		query, arg := tagMatch(s.db, tag)
+		match = match.Or(query, arg)
+	}
+	var candidates []models.PostModel
+	if err := s.db.Model(&models.PostModel{}).
+		Preload("Category").
+		Select("id, title, slug, category_id, tags, images, created_at").
+		Where("is_published = ? AND id <> ?", true, post.ID).
+		Where(match).
+		Order("created_at DESC").
+		Limit(relatedCandidateLimit).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		post  *models.PostModel
+		score float64
+	}
+	now := time.Now()
+	ranked := make([]scored, 0, len(candidates))
+	for i := range candidates {
+		c := &candidates[i]
+		score := relatedTagWeight * float64(countSharedTags(tags, c.Tags))
+		if post.CategoryID != nil && c.CategoryID != nil && *c.CategoryID == *post.CategoryID {
+			score += relatedCategoryWeight
+		}
+		ageDays := now.Sub(c.CreatedAt).Hours() / 24
+		score += math.Pow(0.5, math.Max(ageDays, 0)/relatedRecencyDays)
+		ranked = append(ranked, scored{post: c, score: score})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+	if len(ranked) > size {
+		ranked = ranked[:size]
+	}
+
+	ids := make([]string, 0, len(ranked))
+	for _, r := range ranked {
+		ids = append(ids, r.post.ID)
+	}
+	summaries, err := s.defaultSummaries(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]RelatedPost, 0, len(ranked))
+	for _, r := range ranked {
+		images := r.post.Images
+		if images == nil {
+			images = []models.Image{}
+		}
+		item := RelatedPost{
+			ID:      r.post.ID,
+			Title:   r.post.Title,
+			Slug:    r.post.Slug,
+			Created: r.post.CreatedAt,
+			Images:  images,
+			Summary: summaries[r.post.ID],
+		}
+		if r.post.Category != nil {
+			item.CategorySlug = r.post.Category.Slug
+		}
+		out = append(out, item)
+	}
+
+	if s.rc != nil {
+		if body, err := json.Marshal(out); err == nil {
+			_ = s.rc.Set(ctx, key, body, relatedCacheTTL)
+		}
+	}
+	return out, nil
+}
+
+// defaultSummaries returns the newest AI summary per post in the configured
+// AISummaryTargetLanguage, matching either the full tag or its base language.
+func (s *Service) defaultSummaries(ids []string) (map[string]string, error) {
+	out := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	var rows []models.AISummaryModel
+	if err := s.db.Select("ref_id, summary").
+		Where("ref_id IN ?", ids).
+		Where("LOWER(lang) IN ?", s.summaryLangs()).
+		Order("created_at DESC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if _, ok := out[row.RefID]; !ok {
+			out[row.RefID] = row.Summary
+		}
+	}
+	return out, nil
+}
+
+// summaryLangs lists the lowercased lang values of the summaries shown with
+// related posts, e.g. "zh-cn" and "zh".
+func (s *Service) summaryLangs() []string {
+	lang := ""
+	if s.cfgSvc != nil {
+		if cfg, err := s.cfgSvc.Get(); err == nil && cfg != nil {
+			lang = cfg.AI.AISummaryTargetLanguage
+		}
+	}
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		lang = "auto"
+	}
+	langs := []string{lang}
+	if base, _, ok := strings.Cut(lang, "-"); ok && base != "" {
+		langs = append(langs, base)
+	}
+	return langs
+}
+
+// dropRelatedCache clears every cached related list, since a changed post can
+// appear in, or drop out of, any other post's list.
+func (s *Service) dropRelatedCache() {
+	if s.rc == nil {
+		return
+	}
+	ctx := context.Background()
+	iter := s.rc.Raw().Scan(ctx, 0, relatedCachePrefix+"*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if len(keys) > 0 {
+		_ = s.rc.Del(ctx, keys...)
+	}
+}
+
+// tagMatch is the condition matching posts whose JSON tags array holds tag.
+func tagMatch(db *gorm.DB, tag string) (string, any) {
+	switch dialect.Name(db) {
+	case dialect.Postgres:
+		return "tags::jsonb @> ?::jsonb", jsonString(tag)
+	case dialect.SQLite:
+		return "EXISTS (SELECT 1 FROM json_each(tags) WHERE json_each.value = ?)", tag
+	default:
+		return "JSON_CONTAINS(tags, ?)", jsonString(tag)
+	}
+}
+
+func jsonString(s string) string {
+	raw, _ := json.Marshal(s)
+	return string(raw)
+}
+
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		tag := strings.TrimSpace(t)
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		out = append(out, tag)
+	}
+	return out
+}
+
+func countSharedTags(tags, other []string) int {
+	n := 0
+	for _, t := range normalizeTags(other) {
+		for _, tag := range tags {
+			if t == tag {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
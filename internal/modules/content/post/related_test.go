@@ -0,0 +1,72 @@
+package post
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mx-space/core/internal/pkg/dialect"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// namedDialector reports another dialect name; tagMatch only looks at the name.
+type namedDialector struct {
+	gorm.Dialector
+	name string
+}
+
+func (d namedDialector) Name() string { return d.name }
+
+func TestTagMatchEncodesNonASCIITags(t *testing.T) {
+	const tag = `日本語 "引用"`
+	cases := []struct {
+		dialect string
+		query   string
+		arg     string
+	}{
+		{dialect.MySQL, "JSON_CONTAINS(tags, ?)", `"日本語 \"引用\""`},
+		{dialect.Postgres, "tags::jsonb @> ?::jsonb", `"日本語 \"引用\""`},
+		{dialect.SQLite, "EXISTS (SELECT 1 FROM json_each(tags) WHERE json_each.value = ?)", tag},
+	}
+	for _, tc := range cases {
+		db := &gorm.DB{Config: &gorm.Config{Dialector: namedDialector{name: tc.dialect}}}
+		query, arg := tagMatch(db, tag)
+		if query != tc.query || arg != tc.arg {
+			t.Errorf("%s: tagMatch = %q, %q; want %q, %q", tc.dialect, query, arg, tc.query, tc.arg)
+		}
+	}
+}
+
+func TestRelatedQueriesNonASCIITag(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, category_id, tags FROM `posts`")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "category_id", "tags"}).
+			AddRow("p1", nil, `["日本語"]`))
+	mock.ExpectQuery(regexp.QuoteMeta("JSON_CONTAINS(tags, ?)")).
+		WithArgs(true, "p1", `"日本語"`, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	related, err := NewService(db).Related(context.Background(), "p1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) != 0 {
+		t.Fatalf("related = %+v, want none", related)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,22 +1,36 @@
 package post
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/content/draft"
+	"github.com/mx-space/core/internal/modules/processing/imagemeta"
+	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
 	"github.com/mx-space/core/internal/modules/system/util/slugtracker"
 	"github.com/mx-space/core/internal/pkg/pagination"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
 	"gorm.io/gorm"
 )
 
 // Service handles post business logic.
 type Service struct {
-	db          *gorm.DB
-	slugTracker *slugtracker.Service
+	db           *gorm.DB
+	slugTracker  *slugtracker.Service
+	onChange     func()
+	onTextChange func(delta int64)
+	onPublish    func(id string)
+	onPublicURL  func(id string)
+	onIndex      func(id string)
+	rc           *pkgredis.Client
+	imageMeta    *imagemeta.Service
+	cfgSvc       *appconfigs.Service
 }
 
 func NewService(db *gorm.DB) *Service {
@@ -26,6 +40,61 @@ func NewService(db *gorm.DB) *Service {
 // SetSlugTracker wires up slug change tracking (optional).
 func (s *Service) SetSlugTracker(st *slugtracker.Service) { s.slugTracker = st }
 
+// SetImageMeta fills in image dimensions and accent colors after saves (optional).
+func (s *Service) SetImageMeta(im *imagemeta.Service) { s.imageMeta = im }
+
+// RefreshImages re-reads every image of a post, returning nil when it does not exist.
+func (s *Service) RefreshImages(ctx context.Context, id string) ([]models.Image, error) {
+	if s.imageMeta == nil {
+		return nil, errors.New("image metadata is not configured")
+	}
+	return s.imageMeta.Refresh(ctx, &models.PostModel{}, id, true)
+}
+
+// SetOnChange registers a callback run after content is created, updated or
+// deleted, e.g. to drop cached aggregates (optional).
+func (s *Service) SetOnChange(fn func()) { s.onChange = fn }
+
+func (s *Service) changed() {
+	s.dropRelatedCache()
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// SetOnPublish registers a callback run in the background when an update
+// turns an unpublished post into a published one (optional).
+func (s *Service) SetOnPublish(fn func(id string)) { s.onPublish = fn }
+
+// SetOnPublicURL registers a callback run in the background when a published
+// post appears at a new URL: on create, on publishing, and when its slug or
+// category changes (optional).
+func (s *Service) SetOnPublicURL(fn func(id string)) { s.onPublicURL = fn }
+
+// SetOnIndexChange registers a callback run in the background with the ID of
+// a post that was created, updated or deleted, e.g. to keep search indexes
+// current (optional).
+func (s *Service) SetOnIndexChange(fn func(id string)) { s.onIndex = fn }
+
+func (s *Service) indexChanged(id string) {
+	if s.onIndex != nil {
+		go s.onIndex(id)
+	}
+}
+
+// SetOnTextChange registers a callback receiving how many characters of text a
+// create, update or delete added or removed (optional).
+func (s *Service) SetOnTextChange(fn func(delta int64)) { s.onTextChange = fn }
+
+func (s *Service) textChanged(before, after string) {
+	if s.onTextChange == nil {
+		return
+	}
+	if delta := int64(utf8.RuneCountInString(after) - utf8.RuneCountInString(before)); delta != 0 {
+		s.onTextChange(delta)
+	}
+}
+
 // List returns a paginated list of posts.
 func (s *Service) List(q pagination.Query, lq ListQuery) ([]models.PostModel, response.Pagination, error) {
 	tx := s.db.Model(&models.PostModel{}).
@@ -243,6 +312,17 @@ func (s *Service) Create(dto *CreatePostDTO) (*models.PostModel, error) {
 	if err := s.db.Create(&post).Error; err != nil {
 		return nil, err
 	}
+	s.changed()
+	s.textChanged("", post.Text)
+	s.indexChanged(post.ID)
+	s.imageMeta.Enqueue(context.Background(), &models.PostModel{}, post.ID)
+	if post.IsPublished && s.onPublicURL != nil {
+		go s.onPublicURL(post.ID)
+	}
+	if s.slugTracker != nil {
+		// A tracker for the new path would redirect this post away from itself.
+		go s.slugTracker.Untrack("post", slugtracker.PostPath(category.Slug, post.Slug), post.Slug) // nolint:errcheck
+	}
 	if err := s.db.Preload("Category").First(&post, "id = ?", post.ID).Error; err != nil {
 		return nil, err
 	}
@@ -258,11 +338,10 @@ func (s *Service) Update(id string, dto *UpdatePostDTO) (*models.PostModel, erro
 	if post == nil {
 		return nil, nil
 	}
+	oldText := post.Text
 
 	updates := map[string]interface{}{}
-	var oldSlug string
 	if dto.Slug != nil && *dto.Slug != post.Slug {
-		oldSlug = post.Slug
 		updates["slug"] = *dto.Slug
 	}
 	if dto.Title != nil {
@@ -319,14 +398,54 @@ func (s *Service) Update(id string, dto *UpdatePostDTO) (*models.PostModel, erro
 		updates["images"] = string(encodedImages)
 	}
 
+	wasPublished := post.IsPublished
 	if err := s.db.Model(post).Updates(updates).Error; err != nil {
 		return nil, err
 	}
+	if !wasPublished && dto.IsPublished != nil && *dto.IsPublished && s.onPublish != nil {
+		go s.onPublish(post.ID)
+	}
+
+	s.changed()
+	s.indexChanged(post.ID)
+	if dto.Text != nil {
+		s.textChanged(oldText, *dto.Text)
+		s.imageMeta.Enqueue(context.Background(), &models.PostModel{}, post.ID)
+	}
+	updated, err := s.GetByID(post.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.trackMove(post, updated)
+	if updated != nil && updated.IsPublished && s.onPublicURL != nil &&
+		(!wasPublished || postPath(post) != postPath(updated)) {
+		go s.onPublicURL(updated.ID)
+	}
+	return updated, nil
+}
 
-	if oldSlug != "" && s.slugTracker != nil {
-		go s.slugTracker.Track(oldSlug, "post", post.ID) // nolint:errcheck
+func postPath(p *models.PostModel) string {
+	if p.Category == nil {
+		return p.Slug
 	}
-	return s.GetByID(post.ID)
+	return slugtracker.PostPath(p.Category.Slug, p.Slug)
+}
+
+// trackMove records a redirect from the old path of a post whose slug or
+// category changed.
+func (s *Service) trackMove(before, after *models.PostModel) {
+	if s.slugTracker == nil || after == nil || before.Category == nil || after.Category == nil {
+		return
+	}
+	oldPath := slugtracker.PostPath(before.Category.Slug, before.Slug)
+	newPath := slugtracker.PostPath(after.Category.Slug, after.Slug)
+	if oldPath == newPath {
+		return
+	}
+	go func() {
+		_ = s.slugTracker.Untrack("post", newPath, after.Slug)
+		_ = s.slugTracker.Track(oldPath, "post", after.ID)
+	}()
 }
 
 // Delete soft-deletes a post by ID.
@@ -334,7 +453,20 @@ func (s *Service) Delete(id string) error {
 	if s.slugTracker != nil {
 		go s.slugTracker.DeleteByTargetID(id) // nolint:errcheck
 	}
-	return s.db.Delete(&models.PostModel{}, "id = ?", id).Error
+	var removed models.PostModel
+	if s.onTextChange != nil {
+		s.db.Select("text").First(&removed, "id = ?", id)
+	}
+	if err := s.db.Delete(&models.PostModel{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if err := draft.DeleteForRef(s.db, models.DraftRefPost, id); err != nil {
+		return err
+	}
+	s.changed()
+	s.textChanged(removed.Text, "")
+	s.indexChanged(id)
+	return nil
 }
 
 // IncrementReadCount atomically increments the read counter.
@@ -0,0 +1,291 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// algoliaBatchSize is how many objects one saveObjects batch carries.
+	algoliaBatchSize = 500
+	algoliaAttempts  = 3
+	// algoliaMaxRetryAfter caps how long a Retry-After reply can stall a call.
+	algoliaMaxRetryAfter = 30 * time.Second
+	algoliaTaskTimeout   = 2 * time.Minute
+)
+
+type algoliaClient struct {
+	appID     string
+	apiKey    string
+	indexName string
+}
+
+type algoliaHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *algoliaHTTPError) Error() string {
+	return fmt.Sprintf("algolia error %d: %s", e.StatusCode, e.Body)
+}
+
+func newAlgoliaClient(appID, apiKey, indexName string) *algoliaClient {
+	if indexName == "" {
+		indexName = "mx-space"
+	}
+	return &algoliaClient{appID: appID, apiKey: apiKey, indexName: indexName}
+}
+
+func (a *algoliaClient) Search(q string) ([]SearchResult, error) {
+	body, _ := json.Marshal(map[string]interface{}{"query": q, "hitsPerPage": 20})
+	data, err := a.do(true, http.MethodPost, a.indexPath(a.indexName, "/query"), body)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Hits []map[string]interface{} `json:"hits"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	var results []SearchResult
+	for _, hit := range resp.Hits {
+		r := SearchResult{}
+		if v, _ := hit["objectID"].(string); v != "" {
+			r.ID = v
+		}
+		if v, _ := hit["title"].(string); v != "" {
+			r.Title = v
+		}
+		if v, _ := hit["summary"].(string); v != "" {
+			r.Summary = v
+		}
+		if v, _ := hit["type"].(string); v != "" {
+			r.Type = v
+		}
+		if v, _ := hit["slug"].(string); v != "" {
+			r.Slug = v
+		}
+		if v, _ := hit["nid"].(float64); v > 0 {
+			r.NID = int(v)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// SaveObjects upserts objects into the index in batches.
+func (a *algoliaClient) SaveObjects(objects []map[string]interface{}) error {
+	_, err := a.saveObjects(a.indexName, objects)
+	return err
+}
+
+func (a *algoliaClient) saveObjects(index string, objects []map[string]interface{}) (int64, error) {
+	var lastTask int64
+	for start := 0; start < len(objects); start += algoliaBatchSize {
+		end := start + algoliaBatchSize
+		if end > len(objects) {
+			end = len(objects)
+		}
+		requests := make([]map[string]interface{}, 0, end-start)
+		for _, obj := range objects[start:end] {
+			requests = append(requests, map[string]interface{}{"action": "updateObject", "body": obj})
+		}
+		body, _ := json.Marshal(map[string]interface{}{"requests": requests})
+		data, err := a.do(false, http.MethodPost, a.indexPath(index, "/batch"), body)
+		if err != nil {
+			return 0, err
+		}
+		if lastTask, err = parseAlgoliaTaskID(data); err != nil {
+			return 0, err
+		}
+	}
+	return lastTask, nil
+}
+
+// ReplaceAllObjects rebuilds the index from objects without an empty window:
+// objects go into a temporary copy of the index, which then replaces it.
+func (a *algoliaClient) ReplaceAllObjects(objects []map[string]interface{}) error {
+	tmp := fmt.Sprintf("%s_tmp_%d", a.indexName, time.Now().UnixNano())
+
+	// Copying only settings, synonyms and rules creates the temporary index
+	// with the live configuration but none of the live records.
+	copyBody, _ := json.Marshal(map[string]interface{}{
+		"operation":   "copy",
+		"destination": tmp,
+		"scope":       []string{"settings", "synonyms", "rules"},
+	})
+	data, err := a.do(false, http.MethodPost, a.indexPath(a.indexName, "/operation"), copyBody)
+	var he *algoliaHTTPError
+	switch {
+	case errors.As(err, &he) && he.StatusCode == http.StatusNotFound:
+		// No live index yet: the temporary one starts empty.
+	case err != nil:
+		return err
+	default:
+		if err := a.waitData(tmp, data); err != nil {
+			return err
+		}
+	}
+
+	task, err := a.saveObjects(tmp, objects)
+	if err != nil {
+		_, _ = a.do(false, http.MethodDelete, a.indexPath(tmp, ""), nil)
+		return err
+	}
+	if task > 0 {
+		if err := a.waitTask(tmp, task); err != nil {
+			return err
+		}
+	}
+
+	moveBody, _ := json.Marshal(map[string]interface{}{"operation": "move", "destination": a.indexName})
+	data, err = a.do(false, http.MethodPost, a.indexPath(tmp, "/operation"), moveBody)
+	if err != nil {
+		return err
+	}
+	return a.waitData(a.indexName, data)
+}
+
+func (a *algoliaClient) DeleteObject(id string) error {
+	_, err := a.do(false, http.MethodDelete, a.indexPath(a.indexName, "/"+url.PathEscape(id)), nil)
+	return err
+}
+
+func (a *algoliaClient) waitData(index string, data []byte) error {
+	task, err := parseAlgoliaTaskID(data)
+	if err != nil || task == 0 {
+		return err
+	}
+	return a.waitTask(index, task)
+}
+
+// waitTask polls an indexing task until Algolia reports it published.
+func (a *algoliaClient) waitTask(index string, task int64) error {
+	deadline := time.Now().Add(algoliaTaskTimeout)
+	for delay := 100 * time.Millisecond; ; {
+		data, err := a.do(true, http.MethodGet, a.indexPath(index, "/task/"+strconv.FormatInt(task, 10)), nil)
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return err
+		}
+		if resp.Status == "published" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("algolia task %d on %q did not finish", task, index)
+		}
+		time.Sleep(delay)
+		if delay < 2*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+func parseAlgoliaTaskID(data []byte) (int64, error) {
+	var resp struct {
+		TaskID int64 `json:"taskID"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return 0, err
+	}
+	return resp.TaskID, nil
+}
+
+func (a *algoliaClient) indexPath(index, suffix string) string {
+	return "/1/indexes/" + url.PathEscape(index) + suffix
+}
+
+// do sends one request, waiting out 429 replies per Retry-After and retrying
+// server errors. Reads go to the DSN host, writes to the main host.
+func (a *algoliaClient) do(read bool, method, path string, body []byte) ([]byte, error) {
+	host := "https://" + a.appID + ".algolia.net"
+	if read {
+		host = "https://" + a.appID + "-dsn.algolia.net"
+	}
+	var lastErr error
+	for attempt := 1; attempt <= algoliaAttempts; attempt++ {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, host+path, bodyReader)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Algolia-Application-Id", a.appID)
+		req.Header.Set("X-Algolia-API-Key", a.apiKey)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			time.Sleep(time.Duration(attempt) * time.Second)
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			lastErr = &algoliaHTTPError{StatusCode: resp.StatusCode, Body: string(data)}
+			time.Sleep(retryAfter(resp.Header.Get("Retry-After"), attempt))
+		case resp.StatusCode >= 500:
+			lastErr = &algoliaHTTPError{StatusCode: resp.StatusCode, Body: string(data)}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		case resp.StatusCode >= 400:
+			return nil, &algoliaHTTPError{StatusCode: resp.StatusCode, Body: string(data)}
+		default:
+			return data, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// retryAfter reads a Retry-After header in seconds or as an HTTP date,
+// falling back to a growing delay.
+func retryAfter(header string, attempt int) time.Duration {
+	wait := time.Duration(attempt) * time.Second
+	header = strings.TrimSpace(header)
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		wait = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = time.Until(at)
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > algoliaMaxRetryAfter {
+		wait = algoliaMaxRetryAfter
+	}
+	return wait
+}
+
+// truncateUTF8 cuts s to at most max bytes without splitting a character.
+// A non-positive max leaves s unchanged.
+func truncateUTF8(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -2,6 +2,7 @@ package search
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -22,10 +23,11 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g.GET("/type/:type", h.searchByType)
 	g.POST("/index", authMW, h.reindex)
 	g.POST("/meili/push", authMW, h.reindex)
+	g.POST("/reindex", authMW, h.reindexAll)
 
-	// Algolia-compatible stubs (reuse MeiliSearch implementation)
 	g.GET("/algolia", h.search)
-	g.POST("/algolia/push", authMW, h.reindex)
+	g.POST("/algolia/push", authMW, h.algoliaReindex)
+	g.POST("/algolia/reindex", authMW, h.algoliaReindex)
 	g.GET("/algolia/import-json", authMW, h.algoliaExportJSON)
 }
 
@@ -55,6 +57,34 @@ func (h *Handler) reindex(c *gin.Context) {
 	response.OK(c, gin.H{"message": "indexing started"})
 }
 
+// POST /search/reindex — clear the MeiliSearch index and rebuild it from the database
+func (h *Handler) reindexAll(c *gin.Context) {
+	report, err := h.svc.Reindex()
+	if errors.Is(err, ErrMeiliDisabled) {
+		response.BadRequest(c, "MeiliSearch 搜索未开启")
+		return
+	}
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, report)
+}
+
+// POST /search/algolia/reindex — rebuild the Algolia index from the database
+func (h *Handler) algoliaReindex(c *gin.Context) {
+	count, err := h.svc.IndexAlgolia()
+	if errors.Is(err, errAlgoliaDisabled) {
+		response.BadRequest(c, "Algolia 搜索未开启或未配置")
+		return
+	}
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, gin.H{"count": count})
+}
+
 func (h *Handler) algoliaExportJSON(c *gin.Context) {
 	docs, err := h.svc.GetAllDocuments()
 	if err != nil {
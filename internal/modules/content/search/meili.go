@@ -95,6 +95,17 @@ func (m *meiliClient) DeleteDocument(id string) error {
 	return err
 }
 
+// DeleteAllDocuments empties the index. A missing index is already empty.
+// MeiliSearch runs index tasks in order, so documents added afterwards are
+// not caught by the deletion.
+func (m *meiliClient) DeleteAllDocuments() error {
+	_, err := m.do("DELETE", fmt.Sprintf("/indexes/%s/documents", url.PathEscape(m.indexName)), nil)
+	if isMeiliIndexNotFoundErr(err) {
+		return nil
+	}
+	return err
+}
+
 func (m *meiliClient) ensureIndex() error {
 	_, err := m.do("GET", fmt.Sprintf("/indexes/%s", url.PathEscape(m.indexName)), nil)
 	if err == nil {
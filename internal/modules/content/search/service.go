@@ -1,8 +1,11 @@
 package search
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	appcfg "github.com/mx-space/core/internal/config"
 	"github.com/mx-space/core/internal/models"
@@ -17,8 +20,11 @@ type Service struct {
 	db      *gorm.DB
 	cfgSvc  *configs.Service
 	runtime *appcfg.AppConfig
-	meili   *meiliClient
 	logger  *zap.Logger
+
+	mu      sync.Mutex
+	meili   *meiliClient
+	algolia *algoliaClient
 }
 
 func NewService(db *gorm.DB, cfgSvc *configs.Service, runtime *appcfg.AppConfig, opts ...ServiceOption) *Service {
@@ -67,16 +73,54 @@ func (s *Service) ensureClient() (*meiliClient, error) {
 		}
 	}
 	if !enable {
-		return nil, fmt.Errorf("MeiliSearch is disabled")
+		return nil, ErrMeiliDisabled
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.meili == nil || s.meili.host != host || s.meili.apiKey != apiKey || s.meili.indexName != indexName {
 		s.meili = newMeiliClient(host, apiKey, indexName)
 	}
 	return s.meili, nil
 }
 
-// Search queries MeiliSearch, with MySQL LIKE fallback.
+// ErrMeiliDisabled is returned when MeiliSearch is turned off.
+var ErrMeiliDisabled = errors.New("MeiliSearch is disabled")
+
+// errAlgoliaDisabled is returned when Algolia is off or not configured.
+var errAlgoliaDisabled = errors.New("Algolia is disabled")
+
+func (s *Service) ensureAlgolia() (*algoliaClient, int, error) {
+	cfg, err := s.cfgSvc.Get()
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := cfg.AlgoliaSearchOptions
+	appID := strings.TrimSpace(opts.AppID)
+	apiKey := strings.TrimSpace(opts.APIKey)
+	indexName := strings.TrimSpace(opts.IndexName)
+	if !opts.Enable || appID == "" || apiKey == "" {
+		return nil, 0, errAlgoliaDisabled
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.algolia == nil || s.algolia.appID != appID || s.algolia.apiKey != apiKey || s.algolia.indexName != indexName {
+		s.algolia = newAlgoliaClient(appID, apiKey, indexName)
+	}
+	return s.algolia, opts.MaxTruncateSize, nil
+}
+
+// Search queries Algolia or MeiliSearch, whichever is enabled, with MySQL
+// LIKE fallback.
 func (s *Service) Search(q string) ([]SearchResult, string, error) {
+	if client, _, err := s.ensureAlgolia(); err == nil {
+		if results, err := client.Search(q); err == nil {
+			s.hydrateSearchResults(results)
+			s.logger.Debug(fmt.Sprintf("Algolia 搜索命中 %d 条结果", len(results)))
+			return results, servedByAlgolia, nil
+		} else {
+			s.logger.Debug("Algolia 搜索失败，回退", zap.Error(err))
+		}
+	}
 	if client, err := s.ensureClient(); err == nil {
 		if results, err := client.Search(q); err == nil {
 			s.hydrateSearchResults(results)
@@ -325,48 +369,102 @@ func (s *Service) SearchByType(docType, keyword string, page, size int, isAdmin
 	return results, pag, nil
 }
 
-// IndexAll rebuilds the full MeiliSearch index from the database.
+// IndexAll pushes every published post, note and page to MeiliSearch.
+// Documents of deleted content stay in the index; see Reindex.
 func (s *Service) IndexAll() error {
 	client, err := s.ensureClient()
 	if err != nil {
 		return err
 	}
+	docs, _, err := s.meiliDocuments()
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info(fmt.Sprintf("推送 %d 条文档到 MeiliSearch 索引...", len(docs)))
+	if err := client.AddDocuments(docs); err != nil {
+		s.logger.Warn("MeiliSearch 索引推送失败", zap.Error(err))
+		return err
+	}
+	s.logger.Info("MeiliSearch 索引推送完成")
+	return nil
+}
+
+// Reindex clears the MeiliSearch index and pushes every published post,
+// note and page again, so the index matches the database exactly, e.g.
+// after a backup restore replaced the content tables.
+func (s *Service) Reindex() (*ReindexReport, error) {
+	client, err := s.ensureClient()
+	if err != nil {
+		return nil, err
+	}
+	docs, report, err := s.meiliDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info(fmt.Sprintf("重建 MeiliSearch 索引，共 %d 条文档...", report.Total))
+	if err := client.DeleteAllDocuments(); err != nil {
+		s.logger.Warn("清空 MeiliSearch 索引失败", zap.Error(err))
+		return nil, err
+	}
+	if len(docs) > 0 {
+		if err := client.AddDocuments(docs); err != nil {
+			s.logger.Warn("MeiliSearch 索引推送失败", zap.Error(err))
+			return nil, err
+		}
+	}
+	s.logger.Info("MeiliSearch 索引重建完成")
+	return report, nil
+}
+
+// ReindexIfEnabled runs Reindex when MeiliSearch is on and reports how many
+// documents were pushed; it is a no-op otherwise.
+func (s *Service) ReindexIfEnabled() (int, error) {
+	report, err := s.Reindex()
+	if errors.Is(err, ErrMeiliDisabled) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return report.Total, nil
+}
+
+// meiliDocuments loads the searchable fields of all published content.
+func (s *Service) meiliDocuments() ([]map[string]interface{}, *ReindexReport, error) {
 	var docs []map[string]interface{}
+	report := &ReindexReport{}
 
 	var posts []models.PostModel
-	s.db.Where("is_published = ?", true).Find(&posts)
+	if err := s.db.Where("is_published = ?", true).Find(&posts).Error; err != nil {
+		return nil, nil, err
+	}
 	for _, p := range posts {
-		docs = append(docs, map[string]interface{}{
-			"id": p.ID, "title": p.Title, "text": p.Text,
-			"summary": p.Summary, "type": "post", "slug": p.Slug,
-		})
+		docs = append(docs, meiliDocument(postObject(&p, 0)))
 	}
+	report.Posts = len(posts)
 
 	var notes []models.NoteModel
-	s.db.Where("is_published = ?", true).Find(&notes)
+	if err := s.db.Where("is_published = ?", true).Find(&notes).Error; err != nil {
+		return nil, nil, err
+	}
 	for _, n := range notes {
-		docs = append(docs, map[string]interface{}{
-			"id": n.ID, "title": n.Title, "text": n.Text,
-			"type": "note", "nid": n.NID,
-		})
+		docs = append(docs, meiliDocument(noteObject(&n, 0)))
 	}
+	report.Notes = len(notes)
 
 	var pages []models.PageModel
-	s.db.Find(&pages)
+	if err := s.db.Find(&pages).Error; err != nil {
+		return nil, nil, err
+	}
 	for _, pg := range pages {
-		docs = append(docs, map[string]interface{}{
-			"id": pg.ID, "title": pg.Title, "text": pg.Text,
-			"type": "page", "slug": pg.Slug,
-		})
+		docs = append(docs, meiliDocument(pageObject(&pg, 0)))
 	}
+	report.Pages = len(pages)
 
-	s.logger.Info(fmt.Sprintf("推送 %d 条文档到 MeiliSearch 索引...", len(docs)))
-	if err := client.AddDocuments(docs); err != nil {
-		s.logger.Warn("MeiliSearch 索引推送失败", zap.Error(err))
-		return err
-	}
-	s.logger.Info("MeiliSearch 索引推送完成")
-	return nil
+	report.Total = len(docs)
+	return docs, report, nil
 }
 
 // IndexDocument upserts one document into MeiliSearch (call after create/update).
@@ -439,3 +537,142 @@ func (s *Service) DeleteDocument(id string) {
 		s.logger.Warn("MeiliSearch document delete failed", zap.String("id", id), zap.Error(err))
 	}
 }
+
+// IndexAlgolia rebuilds the full Algolia index from the database and returns
+// how many objects it holds.
+func (s *Service) IndexAlgolia() (int, error) {
+	client, maxTruncate, err := s.ensureAlgolia()
+	if err != nil {
+		return 0, err
+	}
+	var objects []map[string]interface{}
+
+	var posts []models.PostModel
+	if err := s.db.Where("is_published = ?", true).Find(&posts).Error; err != nil {
+		return 0, err
+	}
+	for _, p := range posts {
+		objects = append(objects, postObject(&p, maxTruncate))
+	}
+
+	var notes []models.NoteModel
+	if err := s.db.Where("is_published = ?", true).Find(&notes).Error; err != nil {
+		return 0, err
+	}
+	for _, n := range notes {
+		objects = append(objects, noteObject(&n, maxTruncate))
+	}
+
+	var pages []models.PageModel
+	if err := s.db.Find(&pages).Error; err != nil {
+		return 0, err
+	}
+	for _, pg := range pages {
+		objects = append(objects, pageObject(&pg, maxTruncate))
+	}
+
+	s.logger.Info(fmt.Sprintf("推送 %d 条文档到 Algolia 索引...", len(objects)))
+	if err := client.ReplaceAllObjects(objects); err != nil {
+		s.logger.Warn("Algolia 索引推送失败", zap.Error(err))
+		return 0, err
+	}
+	s.logger.Info("Algolia 索引推送完成")
+	return len(objects), nil
+}
+
+// SyncDocument re-reads a post, note or page and upserts it into the enabled
+// search indexes, or removes it when it is gone or no longer published.
+func (s *Service) SyncDocument(refType, id string) {
+	algolia, maxTruncate, algoliaErr := s.ensureAlgolia()
+	meili, meiliErr := s.ensureClient()
+	if algoliaErr != nil && meiliErr != nil {
+		return
+	}
+
+	var object map[string]interface{}
+	switch refType {
+	case "post":
+		var p models.PostModel
+		if res := s.db.Where("id = ? AND is_published = ?", id, true).Limit(1).Find(&p); res.Error == nil && res.RowsAffected > 0 {
+			object = postObject(&p, 0)
+		}
+	case "note":
+		var n models.NoteModel
+		if res := s.db.Where("id = ? AND is_published = ?", id, true).Limit(1).Find(&n); res.Error == nil && res.RowsAffected > 0 {
+			object = noteObject(&n, 0)
+		}
+	case "page":
+		var pg models.PageModel
+		if res := s.db.Where("id = ?", id).Limit(1).Find(&pg); res.Error == nil && res.RowsAffected > 0 {
+			object = pageObject(&pg, 0)
+		}
+	default:
+		return
+	}
+
+	if algoliaErr == nil {
+		var err error
+		if object == nil {
+			err = algolia.DeleteObject(id)
+		} else {
+			truncated := make(map[string]interface{}, len(object))
+			for k, v := range object {
+				truncated[k] = v
+			}
+			truncated["text"] = truncateUTF8(object["text"].(string), maxTruncate)
+			err = algolia.SaveObjects([]map[string]interface{}{truncated})
+		}
+		if err != nil {
+			s.logger.Warn("Algolia incremental index failed", zap.String("id", id), zap.String("type", refType), zap.Error(err))
+		}
+	}
+	if meiliErr == nil {
+		var err error
+		if object == nil {
+			err = meili.DeleteDocument(id)
+		} else {
+			err = meili.AddDocuments([]map[string]interface{}{meiliDocument(object)})
+		}
+		if err != nil {
+			s.logger.Warn("MeiliSearch incremental index failed", zap.String("id", id), zap.String("type", refType), zap.Error(err))
+		}
+	}
+}
+
+// meiliDocument strips the Algolia-only fields from a record built by
+// postObject, noteObject or pageObject.
+func meiliDocument(object map[string]interface{}) map[string]interface{} {
+	doc := make(map[string]interface{}, len(object))
+	for k, v := range object {
+		if k != "objectID" && k != "created" {
+			doc[k] = v
+		}
+	}
+	return doc
+}
+
+// postObject, noteObject and pageObject build the Algolia record of a row,
+// with the text cut to maxTruncate bytes when it is positive.
+func postObject(p *models.PostModel, maxTruncate int) map[string]interface{} {
+	return map[string]interface{}{
+		"objectID": p.ID, "id": p.ID, "type": "post",
+		"title": p.Title, "text": truncateUTF8(p.Text, maxTruncate),
+		"summary": p.Summary, "slug": p.Slug, "created": p.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func noteObject(n *models.NoteModel, maxTruncate int) map[string]interface{} {
+	return map[string]interface{}{
+		"objectID": n.ID, "id": n.ID, "type": "note",
+		"title": n.Title, "text": truncateUTF8(n.Text, maxTruncate),
+		"nid": n.NID, "created": n.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func pageObject(pg *models.PageModel, maxTruncate int) map[string]interface{} {
+	return map[string]interface{}{
+		"objectID": pg.ID, "id": pg.ID, "type": "page",
+		"title": pg.Title, "text": truncateUTF8(pg.Text, maxTruncate),
+		"slug": pg.Slug, "created": pg.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -10,10 +10,19 @@ import (
 var httpClient = &http.Client{Timeout: 10 * time.Second}
 
 const (
-	servedByMeili = "meilisearch"
-	servedByMySQL = "mysql"
+	servedByMeili   = "meilisearch"
+	servedByAlgolia = "algolia"
+	servedByMySQL   = "mysql"
 )
 
+// ReindexReport counts the documents pushed by a full reindex.
+type ReindexReport struct {
+	Posts int `json:"posts"`
+	Notes int `json:"notes"`
+	Pages int `json:"pages"`
+	Total int `json:"total"`
+}
+
 // SearchResult is a single search hit returned to the client.
 type SearchResult struct {
 	ID      string `json:"id"`
@@ -0,0 +1,193 @@
+package snippet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/serverless"
+	"github.com/mx-space/core/internal/pkg/response"
+	"gorm.io/gorm"
+)
+
+const bundleVersion = 1
+
+// snippetBundle is the export format used to move snippets between instances.
+// Secrets are instance-specific and never part of a bundle.
+type snippetBundle struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Snippets   []bundleSnippet `json:"snippets"`
+	Packages   []string        `json:"packages,omitempty"` // Node.js packages — ignored in Go
+}
+
+type bundleSnippet struct {
+	Reference      string             `json:"reference"`
+	Name           string             `json:"name"`
+	Type           models.SnippetType `json:"type"`
+	Raw            string             `json:"raw"`
+	Comment        string             `json:"comment"`
+	Private        bool               `json:"private"`
+	Enable         *bool              `json:"enable"`
+	Schema         string             `json:"schema"`
+	Metatype       string             `json:"metatype"`
+	Method         string             `json:"method"`
+	Schedule       string             `json:"schedule"`
+	EnableSchedule bool               `json:"enable_schedule"`
+}
+
+const (
+	importConflictSkip      = "skip"
+	importConflictOverwrite = "overwrite"
+)
+
+type importItemError struct {
+	Reference string `json:"reference"`
+	Name      string `json:"name"`
+	Error     string `json:"error"`
+}
+
+type importReport struct {
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Skipped int               `json:"skipped"`
+	Failed  int               `json:"failed"`
+	Errors  []importItemError `json:"errors"`
+}
+
+// Export returns user snippets as bundle items, optionally limited to one reference.
+// Built-in snippets are left out since every instance ships its own.
+func (s *Service) Export(reference string) ([]bundleSnippet, error) {
+	var items []models.SnippetModel
+	tx := s.db.Where("built_in = ?", false).Order("reference ASC, name ASC")
+	if reference = strings.TrimSpace(reference); reference != "" {
+		tx = tx.Where("reference = ?", reference)
+	}
+	if err := tx.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	out := make([]bundleSnippet, len(items))
+	for i, item := range items {
+		enable := item.Enable
+		out[i] = bundleSnippet{
+			Reference: item.Reference, Name: item.Name, Type: normalizeSnippetType(item.Type),
+			Raw: item.Raw, Comment: item.Comment, Private: item.Private, Enable: &enable,
+			Schema: item.Schema, Metatype: item.Metatype, Method: item.Method,
+			Schedule: item.Schedule, EnableSchedule: item.EnableSchedule,
+		}
+	}
+	return out, nil
+}
+
+// Import upserts bundle items by (reference, name). Function snippets must compile.
+// Existing snippets are skipped or overwritten depending on conflict; overwriting
+// keeps the target's secret, new snippets start without one.
+func (s *Service) Import(items []bundleSnippet, conflict string) (*importReport, error) {
+	report := &importReport{Errors: []importItemError{}}
+	fail := func(item bundleSnippet, err error) {
+		report.Failed++
+		report.Errors = append(report.Errors, importItemError{Reference: item.Reference, Name: item.Name, Error: err.Error()})
+	}
+
+	for _, item := range items {
+		item.Reference = strings.TrimSpace(item.Reference)
+		item.Name = strings.TrimSpace(item.Name)
+		item.Type = normalizeSnippetType(item.Type)
+		if item.Reference == "" || item.Name == "" {
+			fail(item, errors.New("reference and name are required"))
+			continue
+		}
+		if err := validateSchedule(item.Schedule); err != nil {
+			fail(item, err)
+			continue
+		}
+		if item.Type == models.SnippetTypeFunction {
+			if err := serverless.CheckSnippetSource(item.Reference, item.Name, item.Raw); err != nil {
+				fail(item, err)
+				continue
+			}
+		}
+		enable := true
+		if item.Enable != nil {
+			enable = *item.Enable
+		}
+
+		var existing models.SnippetModel
+		tx := s.db.Where("reference = ? AND name = ?", item.Reference, item.Name)
+		if serverless.IsNativeBuiltIn(item.Reference, item.Name) {
+			tx = tx.Where("built_in = ?", false)
+		}
+		err := tx.First(&existing).Error
+		switch {
+		case err == nil:
+			if conflict != importConflictOverwrite {
+				report.Skipped++
+				continue
+			}
+			err = s.db.Model(&existing).Updates(map[string]interface{}{
+				"type": item.Type, "raw": item.Raw, "comment": item.Comment,
+				"private": item.Private, "enable": enable, "schema": item.Schema,
+				"metatype": item.Metatype, "method": item.Method,
+				"schedule": strings.TrimSpace(item.Schedule), "enable_schedule": item.EnableSchedule,
+			}).Error
+			if err != nil {
+				fail(item, err)
+				continue
+			}
+			s.invalidate(existing.ID)
+			report.Updated++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			created := models.SnippetModel{
+				Type: item.Type, Name: item.Name, Reference: item.Reference,
+				Raw: item.Raw, Comment: item.Comment, Private: item.Private, Enable: enable,
+				Schema: item.Schema, Metatype: item.Metatype, Method: item.Method,
+				Schedule: strings.TrimSpace(item.Schedule), EnableSchedule: item.EnableSchedule,
+			}
+			if err := s.db.Create(&created).Error; err != nil {
+				fail(item, err)
+				continue
+			}
+			report.Created++
+		default:
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// GET /snippets/export?reference=
+func (h *Handler) exportSnippets(c *gin.Context) {
+	items, err := h.svc.Export(c.Query("reference"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, snippetBundle{Version: bundleVersion, ExportedAt: time.Now(), Snippets: items})
+}
+
+// POST /snippets/import?conflict=skip|overwrite — accepts a bundle from GET /snippets/export
+func (h *Handler) importSnippets(c *gin.Context) {
+	conflict := strings.ToLower(strings.TrimSpace(c.DefaultQuery("conflict", importConflictSkip)))
+	if conflict != importConflictSkip && conflict != importConflictOverwrite {
+		response.BadRequest(c, fmt.Sprintf("invalid conflict mode: %s", conflict))
+		return
+	}
+	var bundle snippetBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if bundle.Version > bundleVersion {
+		response.BadRequest(c, fmt.Sprintf("unsupported bundle version: %d", bundle.Version))
+		return
+	}
+	report, err := h.svc.Import(bundle.Snippets, conflict)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, report)
+}
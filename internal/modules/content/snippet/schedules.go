@@ -0,0 +1,74 @@
+package snippet
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	pkgcron "github.com/mx-space/core/internal/pkg/cron"
+	"github.com/mx-space/core/internal/pkg/response"
+	"gorm.io/gorm"
+)
+
+type scheduleItem struct {
+	ID             string                  `json:"id"`
+	Reference      string                  `json:"reference"`
+	Name           string                  `json:"name"`
+	Schedule       string                  `json:"schedule"`
+	Enable         bool                    `json:"enable"`
+	EnableSchedule bool                    `json:"enable_schedule"`
+	NextRunAt      *time.Time              `json:"next_run_at"`
+	LastRun        *models.SnippetRunModel `json:"last_run"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+// Schedules lists function snippets that have a schedule with their next fire
+// time. Disabled snippets are listed too, without a next run.
+func (s *Service) Schedules(now time.Time) ([]scheduleItem, error) {
+	var items []models.SnippetModel
+	err := s.db.
+		Where("LOWER(type) = ?", string(models.SnippetTypeFunction)).
+		Where("schedule <> ''").
+		Order("reference ASC, name ASC").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]scheduleItem, 0, len(items))
+	for _, item := range items {
+		entry := scheduleItem{
+			ID: item.ID, Reference: item.Reference, Name: item.Name,
+			Schedule: item.Schedule, Enable: item.Enable, EnableSchedule: item.EnableSchedule,
+		}
+		if schedule, err := pkgcron.ParseExpr(item.Schedule); err != nil {
+			entry.Error = err.Error()
+		} else if item.Enable && item.EnableSchedule {
+			if next := schedule.Next(now); !next.IsZero() {
+				entry.NextRunAt = &next
+			}
+		}
+
+		var run models.SnippetRunModel
+		err := s.db.Where("snippet_id = ?", item.ID).Order("started_at DESC").First(&run).Error
+		switch {
+		case err == nil:
+			entry.LastRun = &run
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, err
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// GET /snippets/schedules — scheduled functions with their next run time
+func (h *Handler) listSchedules(c *gin.Context) {
+	items, err := h.svc.Schedules(time.Now())
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, items)
+}
@@ -1,6 +1,7 @@
 package snippet
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -8,7 +9,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/serverless"
+	pkgcron "github.com/mx-space/core/internal/pkg/cron"
 	"github.com/mx-space/core/internal/pkg/pagination"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
 	"gorm.io/gorm"
 )
@@ -24,6 +28,9 @@ type CreateSnippetDTO struct {
 	Schema    string             `json:"schema"`
 	Metatype  string             `json:"metatype"`
 	Method    string             `json:"method"`
+	// Schedule is a cron expression for function snippets.
+	Schedule       string `json:"schedule"`
+	EnableSchedule *bool  `json:"enable_schedule"`
 }
 
 type UpdateSnippetDTO struct {
@@ -37,6 +44,9 @@ type UpdateSnippetDTO struct {
 	Schema    *string             `json:"schema"`
 	Metatype  *string             `json:"metatype"`
 	Method    *string             `json:"method"`
+	// Schedule is a cron expression for function snippets.
+	Schedule       *string `json:"schedule"`
+	EnableSchedule *bool   `json:"enable_schedule"`
 }
 
 type snippetResponse struct {
@@ -54,6 +64,9 @@ type snippetResponse struct {
 	BuiltIn   bool               `json:"built_in"`
 	Created   time.Time          `json:"created"`
 	Updated   *time.Time         `json:"updated"`
+
+	Schedule       string `json:"schedule"`
+	EnableSchedule bool   `json:"enable_schedule"`
 }
 
 func toResponse(s *models.SnippetModel) snippetResponse {
@@ -63,6 +76,7 @@ func toResponse(s *models.SnippetModel) snippetResponse {
 		Raw: s.Raw, Comment: s.Comment, Private: s.Private, Enable: s.Enable,
 		Schema: s.Schema, Metatype: s.Metatype, Method: s.Method, BuiltIn: s.BuiltIn,
 		Created: s.CreatedAt, Updated: updated,
+		Schedule: s.Schedule, EnableSchedule: s.EnableSchedule,
 	}
 }
 
@@ -86,9 +100,26 @@ func normalizeSnippetType(t models.SnippetType) models.SnippetType {
 	}
 }
 
-type Service struct{ db *gorm.DB }
+type Service struct {
+	db *gorm.DB
+	rc *pkgredis.Client
+}
+
+// ServiceOption configures a snippet Service.
+type ServiceOption func(*Service)
+
+// WithRedis sets the Redis client that holds function execution metrics.
+func WithRedis(rc *pkgredis.Client) ServiceOption {
+	return func(s *Service) { s.rc = rc }
+}
 
-func NewService(db *gorm.DB) *Service { return &Service{db: db} }
+func NewService(db *gorm.DB, opts ...ServiceOption) *Service {
+	s := &Service{db: db}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
 
 func (s *Service) List(q pagination.Query, private bool) ([]models.SnippetModel, response.Pagination, error) {
 	tx := s.db.Model(&models.SnippetModel{}).Order("reference ASC, name ASC")
@@ -102,7 +133,8 @@ func (s *Service) List(q pagination.Query, private bool) ([]models.SnippetModel,
 
 func (s *Service) GetByReferenceAndName(reference, name string) (*models.SnippetModel, error) {
 	var item models.SnippetModel
-	if err := s.db.Where("reference = ? AND name = ?", reference, name).First(&item).Error; err != nil {
+	// User overrides of a built-in function shadow the preset.
+	if err := s.db.Where("reference = ? AND name = ?", reference, name).Order("built_in ASC").First(&item).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -122,10 +154,35 @@ func (s *Service) GetByID(id string) (*models.SnippetModel, error) {
 	return &item, nil
 }
 
+// errNativeBuiltIn is returned when changing a built-in function served natively;
+// those can only be shadowed by a user snippet with the same reference and name.
+var errNativeBuiltIn = errors.New("built-in function cannot be modified")
+
+// errInvalidSchedule wraps cron parse errors so handlers can answer 400.
+var errInvalidSchedule = errors.New("invalid schedule")
+
+func validateSchedule(spec string) error {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil
+	}
+	if _, err := pkgcron.ParseExpr(spec); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidSchedule, err)
+	}
+	return nil
+}
+
 func (s *Service) Create(dto *CreateSnippetDTO) (*models.SnippetModel, error) {
 	dto.Type = normalizeSnippetType(dto.Type)
+	if err := validateSchedule(dto.Schedule); err != nil {
+		return nil, err
+	}
 	var count int64
-	s.db.Model(&models.SnippetModel{}).Where("reference = ? AND name = ?", dto.Reference, dto.Name).Count(&count)
+	tx := s.db.Model(&models.SnippetModel{}).Where("reference = ? AND name = ?", dto.Reference, dto.Name)
+	if serverless.IsNativeBuiltIn(dto.Reference, dto.Name) {
+		tx = tx.Where("built_in = ?", false)
+	}
+	tx.Count(&count)
 	if count > 0 {
 		return nil, fmt.Errorf("snippet already exists")
 	}
@@ -135,6 +192,10 @@ func (s *Service) Create(dto *CreateSnippetDTO) (*models.SnippetModel, error) {
 		Raw: dto.Raw, Comment: dto.Comment, Schema: dto.Schema,
 		Metatype: dto.Metatype, Method: dto.Method,
 		Enable: true, Private: false,
+		Schedule: strings.TrimSpace(dto.Schedule),
+	}
+	if dto.EnableSchedule != nil {
+		item.EnableSchedule = *dto.EnableSchedule
 	}
 	if dto.Private != nil {
 		item.Private = *dto.Private
@@ -150,6 +211,9 @@ func (s *Service) Update(id string, dto *UpdateSnippetDTO) (*models.SnippetModel
 	if err != nil || item == nil {
 		return item, err
 	}
+	if item.BuiltIn && serverless.IsNativeBuiltIn(item.Reference, item.Name) {
+		return nil, errNativeBuiltIn
+	}
 	updates := map[string]interface{}{}
 	if dto.Type != nil {
 		updates["type"] = normalizeSnippetType(*dto.Type)
@@ -181,11 +245,53 @@ func (s *Service) Update(id string, dto *UpdateSnippetDTO) (*models.SnippetModel
 	if dto.Method != nil {
 		updates["method"] = *dto.Method
 	}
-	return item, s.db.Model(item).Updates(updates).Error
+	if dto.Schedule != nil {
+		if err := validateSchedule(*dto.Schedule); err != nil {
+			return nil, err
+		}
+		updates["schedule"] = strings.TrimSpace(*dto.Schedule)
+	}
+	if dto.EnableSchedule != nil {
+		updates["enable_schedule"] = *dto.EnableSchedule
+	}
+	if err := s.db.Model(item).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	s.invalidate(item.ID)
+	return item, nil
+}
+
+// invalidate drops the compiled code of a changed function snippet on every
+// worker. Best effort: workers still recompile once they see the new UpdatedAt.
+func (s *Service) invalidate(id string) {
+	_ = serverless.PublishSnippetInvalidation(context.Background(), s.rc, id)
 }
 
 func (s *Service) Delete(id string) error {
-	return s.db.Delete(&models.SnippetModel{}, "id = ?", id).Error
+	item, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if item != nil && item.BuiltIn && serverless.IsNativeBuiltIn(item.Reference, item.Name) {
+		return errNativeBuiltIn
+	}
+	if err := s.db.Delete(&models.SnippetModel{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	_ = serverless.PublishSnippetDeletion(context.Background(), s.rc, id)
+	return s.db.Unscoped().Delete(&models.SnippetRunModel{}, "snippet_id = ?", id).Error
+}
+
+// ListRuns returns the retained run history of a snippet, newest first.
+func (s *Service) ListRuns(snippetID string) ([]models.SnippetRunModel, error) {
+	runs := make([]models.SnippetRunModel, 0)
+	err := s.db.Where("snippet_id = ?", snippetID).Order("started_at DESC").Find(&runs).Error
+	return runs, err
+}
+
+// Metrics returns execution metrics of a function snippet for the last 24h and 7d.
+func (s *Service) Metrics(ctx context.Context, snippetID string) (*serverless.SnippetMetrics, error) {
+	return serverless.LoadSnippetMetrics(ctx, s.rc, snippetID)
 }
 
 type Handler struct{ svc *Service }
@@ -194,7 +300,7 @@ func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g := rg.Group("/snippets")
-	g.GET("/:id/:name", h.getByRef)
+	g.GET("/:id/:name", h.getByRefOrStats(authMW))
 
 	a := g.Group("", authMW)
 	a.GET("", h.list)
@@ -205,6 +311,8 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	a.GET("/:id", h.getByID)
 	a.POST("", h.create)
 	a.POST("/aggregate", h.aggregate)
+	a.GET("/export", h.exportSnippets)
+	a.GET("/schedules", h.listSchedules)
 	a.POST("/import", h.importSnippets)
 	a.PUT("/:id", h.update)
 	a.PATCH("/:id", h.update) // legacy compatibility
@@ -239,12 +347,40 @@ func (h *Handler) listAll(c *gin.Context) {
 	response.Paged(c, out, pag)
 }
 
-func (h *Handler) getByRef(c *gin.Context) {
-	reference := c.Param("reference")
-	if reference == "" {
-		reference = c.Param("id")
+// snippetStatsViews are the admin views served under /snippets/:id/<name>.
+var snippetStatsViews = map[string]func(h *Handler, c *gin.Context, item *models.SnippetModel){
+	"runs":    (*Handler).listRuns,
+	"metrics": (*Handler).metrics,
+}
+
+// getByRefOrStats serves GET /snippets/:reference/:name, and the admin views
+// GET /snippets/:id/runs and /snippets/:id/metrics, which share the pattern.
+// When the first segment is the ID of an existing snippet and the name is one of
+// the views, the view wins and requires authMW; otherwise the request is a
+// reference lookup.
+func (h *Handler) getByRefOrStats(authMW gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, name := c.Param("id"), c.Param("name")
+		if view, ok := snippetStatsViews[name]; ok {
+			item, err := h.svc.GetByID(id)
+			if err != nil {
+				response.InternalError(c, err)
+				return
+			}
+			if item != nil {
+				if authMW(c); c.IsAborted() {
+					return
+				}
+				view(h, c, item)
+				return
+			}
+		}
+		h.getByReferenceAndName(c, id, name)
 	}
-	item, err := h.svc.GetByReferenceAndName(reference, c.Param("name"))
+}
+
+func (h *Handler) getByReferenceAndName(c *gin.Context, reference, name string) {
+	item, err := h.svc.GetByReferenceAndName(reference, name)
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -260,6 +396,26 @@ func (h *Handler) getByRef(c *gin.Context) {
 	response.OK(c, toResponse(item))
 }
 
+// GET /snippets/:id/runs — scheduled run history, newest first
+func (h *Handler) listRuns(c *gin.Context, item *models.SnippetModel) {
+	runs, err := h.svc.ListRuns(item.ID)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, runs)
+}
+
+// GET /snippets/:id/metrics — execution metrics of a function snippet
+func (h *Handler) metrics(c *gin.Context, item *models.SnippetModel) {
+	metrics, err := h.svc.Metrics(c.Request.Context(), item.ID)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, metrics)
+}
+
 func (h *Handler) create(c *gin.Context) {
 	var dto CreateSnippetDTO
 	if err := c.ShouldBindJSON(&dto); err != nil {
@@ -272,6 +428,10 @@ func (h *Handler) create(c *gin.Context) {
 			response.Conflict(c, "Snippet 已存在")
 			return
 		}
+		if errors.Is(err, errInvalidSchedule) {
+			response.BadRequest(c, err.Error())
+			return
+		}
 		response.InternalError(c, err)
 		return
 	}
@@ -299,6 +459,14 @@ func (h *Handler) update(c *gin.Context) {
 	}
 	item, err := h.svc.Update(c.Param("id"), &dto)
 	if err != nil {
+		if errors.Is(err, errNativeBuiltIn) {
+			response.BadRequest(c, "内置函数不可修改")
+			return
+		}
+		if errors.Is(err, errInvalidSchedule) {
+			response.BadRequest(c, err.Error())
+			return
+		}
 		response.InternalError(c, err)
 		return
 	}
@@ -311,6 +479,10 @@ func (h *Handler) update(c *gin.Context) {
 
 func (h *Handler) delete(c *gin.Context) {
 	if err := h.svc.Delete(c.Param("id")); err != nil {
+		if errors.Is(err, errNativeBuiltIn) {
+			response.BadRequest(c, "内置函数不可删除")
+			return
+		}
 		response.InternalError(c, err)
 		return
 	}
@@ -373,55 +545,6 @@ func (h *Handler) listGroupByReferenceWithValue(c *gin.Context, ref string) {
 	response.OK(c, out)
 }
 
-// POST /snippets/import — bulk import snippets
-type importSnippetItem struct {
-	Name      string             `json:"name"      binding:"required"`
-	Reference string             `json:"reference" binding:"required"`
-	Raw       string             `json:"raw"`
-	Private   bool               `json:"private"`
-	Type      models.SnippetType `json:"type"`
-	Comment   string             `json:"comment"`
-	Enable    *bool              `json:"enable"`
-}
-
-type importSnippetsDTO struct {
-	Snippets []importSnippetItem `json:"snippets" binding:"required"`
-	Packages []string            `json:"packages"` // Node.js packages — ignored in Go
-}
-
-func (h *Handler) importSnippets(c *gin.Context) {
-	var dto importSnippetsDTO
-	if err := c.ShouldBindJSON(&dto); err != nil {
-		response.BadRequest(c, err.Error())
-		return
-	}
-	for _, item := range dto.Snippets {
-		var count int64
-		h.svc.db.Model(&models.SnippetModel{}).
-			Where("name = ? AND reference = ?", item.Name, item.Reference).
-			Count(&count)
-		if count > 0 {
-			continue
-		}
-		snippetType := normalizeSnippetType(item.Type)
-		enable := true
-		if item.Enable != nil {
-			enable = *item.Enable
-		}
-		s := models.SnippetModel{
-			Name:      item.Name,
-			Reference: item.Reference,
-			Raw:       item.Raw,
-			Private:   item.Private,
-			Type:      snippetType,
-			Comment:   item.Comment,
-			Enable:    enable,
-		}
-		h.svc.db.Create(&s)
-	}
-	response.OK(c, "OK")
-}
-
 func (h *Handler) aggregate(c *gin.Context) {
 	var pipeline []map[string]interface{}
 	if err := c.ShouldBindJSON(&pipeline); err != nil {
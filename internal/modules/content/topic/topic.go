@@ -3,9 +3,12 @@ package topic
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
 	"gorm.io/gorm"
 )
@@ -26,13 +29,95 @@ type UpdateTopicDTO struct {
 	Icon        *string `json:"icon"`
 }
 
+// TopicListItem is a topic with the number of its published notes.
+type TopicListItem struct {
+	models.TopicModel
+	Count int64 `json:"count"`
+}
+
+// TopicNote is the compact note shape listed under a topic.
+type TopicNote struct {
+	ID      string    `json:"id"`
+	NID     int       `json:"nid"`
+	Title   string    `json:"title"`
+	Created time.Time `json:"created"`
+}
+
+// TopicDetail is a topic with one page of its notes.
+type TopicDetail struct {
+	TopicListItem
+	Notes      []TopicNote         `json:"notes"`
+	Pagination response.Pagination `json:"pagination"`
+}
+
 type Service struct{ db *gorm.DB }
 
 func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 
-func (s *Service) List() ([]models.TopicModel, error) {
+func (s *Service) List() ([]TopicListItem, error) {
 	var topics []models.TopicModel
-	return topics, s.db.Order("created_at ASC").Find(&topics).Error
+	if err := s.db.Order("created_at ASC").Find(&topics).Error; err != nil {
+		return nil, err
+	}
+	counts, err := s.countPublishedNotes()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]TopicListItem, 0, len(topics))
+	for _, t := range topics {
+		items = append(items, TopicListItem{TopicModel: t, Count: counts[t.ID]})
+	}
+	return items, nil
+}
+
+func (s *Service) countPublishedNotes(topicIDs ...string) (map[string]int64, error) {
+	var rows []struct {
+		TopicID string
+		Count   int64
+	}
+	tx := s.db.Model(&models.NoteModel{}).
+		Select("topic_id, COUNT(*) AS count").
+		Where("topic_id IS NOT NULL AND is_published = ?", true)
+	if len(topicIDs) > 0 {
+		tx = tx.Where("topic_id IN ?", topicIDs)
+	}
+	if err := tx.Group("topic_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.TopicID] = row.Count
+	}
+	return counts, nil
+}
+
+// Detail returns t with a page of its notes, newest first. Visitors only see
+// published notes.
+func (s *Service) Detail(t *models.TopicModel, q pagination.Query, isAdmin bool) (*TopicDetail, error) {
+	counts, err := s.countPublishedNotes(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	tx := s.db.Model(&models.NoteModel{}).
+		Where("topic_id = ?", t.ID).
+		Order("created_at DESC")
+	if !isAdmin {
+		tx = tx.Where("is_published = ?", true)
+	}
+	var notes []models.NoteModel
+	pag, err := pagination.Paginate(tx, q, &notes)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]TopicNote, 0, len(notes))
+	for _, n := range notes {
+		items = append(items, TopicNote{ID: n.ID, NID: n.NID, Title: n.Title, Created: n.CreatedAt})
+	}
+	return &TopicDetail{
+		TopicListItem: TopicListItem{TopicModel: *t, Count: counts[t.ID]},
+		Notes:         items,
+		Pagination:    pag,
+	}, nil
 }
 
 func (s *Service) GetByID(id string) (*models.TopicModel, error) {
@@ -46,6 +131,15 @@ func (s *Service) GetByID(id string) (*models.TopicModel, error) {
 	return &t, nil
 }
 
+// GetByIdentifier looks a topic up by ID, then by slug.
+func (s *Service) GetByIdentifier(identifier string) (*models.TopicModel, error) {
+	t, err := s.GetByID(identifier)
+	if err != nil || t != nil {
+		return t, err
+	}
+	return s.GetBySlug(identifier)
+}
+
 func (s *Service) GetBySlug(slug string) (*models.TopicModel, error) {
 	var t models.TopicModel
 	if err := s.db.Where("slug = ?", slug).First(&t).Error; err != nil {
@@ -94,9 +188,15 @@ func (s *Service) Update(id string, dto *UpdateTopicDTO) (*models.TopicModel, er
 	return t, s.db.Model(t).Updates(updates).Error
 }
 
+// Delete removes a topic and detaches its notes, which stay published.
 func (s *Service) Delete(id string) error {
-	s.db.Model(&models.NoteModel{}).Where("topic_id = ?", id).Update("topic_id", nil)
-	return s.db.Delete(&models.TopicModel{}, "id = ?", id).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.NoteModel{}).Where("topic_id = ?", id).
+			Update("topic_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.TopicModel{}, "id = ?", id).Error
+	})
 }
 
 type Handler struct{ svc *Service }
@@ -135,21 +235,18 @@ func (h *Handler) listAll(c *gin.Context) {
 	response.OK(c, topics)
 }
 
+// GET /topics/:id — by ID or slug, with a page of the topic's notes
 func (h *Handler) get(c *gin.Context) {
-	t, err := h.svc.GetByID(c.Param("id"))
-	if err != nil {
-		response.InternalError(c, err)
-		return
-	}
-	if t == nil {
-		response.NotFoundMsg(c, "主题不存在")
-		return
-	}
-	response.OK(c, t)
+	t, err := h.svc.GetByIdentifier(c.Param("id"))
+	h.respondDetail(c, t, err)
 }
 
 func (h *Handler) getBySlug(c *gin.Context) {
 	t, err := h.svc.GetBySlug(c.Param("slug"))
+	h.respondDetail(c, t, err)
+}
+
+func (h *Handler) respondDetail(c *gin.Context, t *models.TopicModel, err error) {
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -158,7 +255,12 @@ func (h *Handler) getBySlug(c *gin.Context) {
 		response.NotFoundMsg(c, "主题不存在")
 		return
 	}
-	response.OK(c, t)
+	detail, err := h.svc.Detail(t, pagination.FromContext(c), middleware.IsAuthenticated(c))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, detail)
 }
 
 func (h *Handler) create(c *gin.Context) {
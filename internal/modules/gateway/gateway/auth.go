@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	socketio "github.com/zishang520/socket.io/v2/socket"
+	"go.uber.org/zap"
+)
+
+// Admin sockets stay authorized only while their token does. The sweep
+// re-checks every admin socket's token, so revoked sessions are caught too;
+// once a token has been invalid for longer than the auth grace period the
+// socket leaves the admin room and gets auth#expired. It stays connected and
+// rejoins after presenting a valid token with token#refresh.
+const (
+	eventTokenRefresh  = "token#refresh"
+	eventAuthExpired   = "auth#expired"
+	eventAuthRefreshed = "auth#refreshed"
+
+	defaultAuthGrace  = time.Minute
+	authSweepInterval = 10 * time.Second
+)
+
+type adminAuth struct {
+	client *socketio.Socket
+	token  string
+	// expiresAt is when the token stopped or stops being valid; zero when
+	// it does not expire.
+	expiresAt time.Time
+	demoted   bool
+}
+
+// AdminTokenValidator checks an admin token and returns when it expires, or
+// the zero time for tokens without an expiry.
+type AdminTokenValidator func(token string) (expiresAt time.Time, ok bool)
+
+func (h *Hub) validateAdminToken(token string) (time.Time, bool) {
+	if token == "" || h.adminTokenValidator == nil {
+		return time.Time{}, false
+	}
+	return h.adminTokenValidator(token)
+}
+
+func (h *Hub) trackAdmin(sid string, client *socketio.Socket, token string, expiresAt time.Time) {
+	h.adminAuthMu.Lock()
+	h.adminAuths[sid] = &adminAuth{client: client, token: token, expiresAt: expiresAt}
+	h.adminAuthMu.Unlock()
+}
+
+func (h *Hub) untrackAdmin(sid string) {
+	h.adminAuthMu.Lock()
+	delete(h.adminAuths, sid)
+	h.adminAuthMu.Unlock()
+}
+
+// adminActive reports whether sid is an admin socket still in the admin room.
+func (h *Hub) adminActive(sid string) bool {
+	h.adminAuthMu.Lock()
+	defer h.adminAuthMu.Unlock()
+	a, ok := h.adminAuths[sid]
+	return ok && !a.demoted
+}
+
+// refreshAdminToken handles token#refresh: a valid token extends the
+// socket's authorization and brings a demoted socket back to the admin room.
+func (h *Hub) refreshAdminToken(client *socketio.Socket, args []any) {
+	sid := string(client.Id())
+	token := normalizeToken(parseTokenOption(args))
+	expiresAt, ok := h.validateAdminToken(token)
+	if !ok {
+		_ = client.Emit("message", h.gatewayMessageFormat("AUTH_FAILED", "auth failed", nil))
+		return
+	}
+
+	h.adminAuthMu.Lock()
+	a, tracked := h.adminAuths[sid]
+	if !tracked {
+		h.adminAuthMu.Unlock()
+		return
+	}
+	a.token = token
+	a.expiresAt = expiresAt
+	rejoin := a.demoted
+	a.demoted = false
+	h.adminAuthMu.Unlock()
+
+	if rejoin {
+		client.Join(socketio.Room(RoomAdmin))
+		h.register <- clientMeta{sid: sid, room: RoomAdmin}
+	}
+	payload := map[string]interface{}{}
+	if !expiresAt.IsZero() {
+		payload["expiresAt"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	_ = client.Emit("message", h.gatewayMessageFormat(eventAuthRefreshed, payload, nil))
+}
+
+// runAuthSweep demotes admin sockets with lapsed tokens until ctx is done.
+func (h *Hub) runAuthSweep(ctx context.Context) {
+	ticker := time.NewTicker(authSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.sweepAdminAuth()
+		}
+	}
+}
+
+func (h *Hub) sweepAdminAuth() {
+	type check struct {
+		sid   string
+		token string
+	}
+	h.adminAuthMu.Lock()
+	checks := make([]check, 0, len(h.adminAuths))
+	for sid, a := range h.adminAuths {
+		if !a.demoted {
+			checks = append(checks, check{sid: sid, token: a.token})
+		}
+	}
+	h.adminAuthMu.Unlock()
+
+	for _, c := range checks {
+		// Validate outside the lock: it may hit the database.
+		expiresAt, ok := h.validateAdminToken(c.token)
+		now := h.now()
+
+		h.adminAuthMu.Lock()
+		a, tracked := h.adminAuths[c.sid]
+		if !tracked || a.demoted || a.token != c.token {
+			h.adminAuthMu.Unlock()
+			continue
+		}
+		switch {
+		case ok:
+			a.expiresAt = expiresAt
+		case a.expiresAt.IsZero() || a.expiresAt.After(now):
+			// Revoked before its expiry: the grace period starts now.
+			a.expiresAt = now
+		}
+		expired := !a.expiresAt.IsZero() && !now.Before(a.expiresAt.Add(h.authGrace))
+		if expired {
+			a.demoted = true
+		}
+		client := a.client
+		h.adminAuthMu.Unlock()
+
+		if expired {
+			h.demoteAdmin(c.sid, client)
+		}
+	}
+}
+
+func (h *Hub) demoteAdmin(sid string, client *socketio.Socket) {
+	client.Leave(socketio.Room(RoomAdmin))
+	h.unsubscribeStdout(sid)
+	h.unsubscribeLogLines(sid)
+	h.unregister <- clientMeta{sid: sid, room: RoomAdmin}
+	_ = client.Emit("message", h.gatewayMessageFormat(eventAuthExpired, "token expired", nil))
+	if h.logger != nil {
+		h.logger.Debug("gateway admin socket demoted", zap.String("sid", sid))
+	}
+}
+
+func parseTokenOption(args []any) string {
+	if len(args) == 0 {
+		return ""
+	}
+	switch v := args[0].(type) {
+	case string:
+		payload := make(map[string]any)
+		if err := json.Unmarshal([]byte(v), &payload); err == nil {
+			return strFromAny(payload["token"])
+		}
+		return strings.TrimSpace(v)
+	default:
+		return strFromAny(mapFromAny(v)["token"])
+	}
+}
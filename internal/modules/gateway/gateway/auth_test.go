@@ -0,0 +1,291 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+)
+
+// fakeClock is the hub's now() in tests.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// testTokens is an AdminTokenValidator whose tokens expire on the fake clock.
+type testTokens struct {
+	clock *fakeClock
+	mu    sync.Mutex
+	exp   map[string]time.Time
+}
+
+func (v *testTokens) issue(token string, ttl time.Duration) {
+	v.mu.Lock()
+	v.exp[token] = v.clock.Now().Add(ttl)
+	v.mu.Unlock()
+}
+
+func (v *testTokens) validate(token string) (time.Time, bool) {
+	v.mu.Lock()
+	exp, ok := v.exp[token]
+	v.mu.Unlock()
+	if !ok || !v.clock.Now().Before(exp) {
+		return time.Time{}, false
+	}
+	return exp, true
+}
+
+func newTestHub(t *testing.T, opts ...HubOption) (*Hub, *fakeClock, *testTokens, string) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := pkgredis.Connect("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tokens := &testTokens{clock: clock, exp: map[string]time.Time{}}
+	h := NewHub(rc, nil, tokens.validate, opts...)
+	h.now = clock.Now
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go h.Run(ctx)
+	srv := httptest.NewServer(h.Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+		_ = rc.Raw().Close()
+	})
+	return h, clock, tokens, "ws" + strings.TrimPrefix(srv.URL, "http") + "/socket.io/?EIO=4&transport=websocket"
+}
+
+// testSocket speaks just enough of the engine.io v4 / socket.io v5 wire
+// protocol to join a namespace, send events and read "message" events.
+type testSocket struct {
+	t    *testing.T
+	conn *websocket.Conn
+	nsp  string
+	pong bool
+}
+
+func dialSocket(t *testing.T, url, nsp string, pong bool) *testSocket {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	s := &testSocket{t: t, conn: conn, nsp: nsp, pong: pong}
+	if open := s.read(); !strings.HasPrefix(open, "0") {
+		t.Fatalf("expected engine.io open packet, got %q", open)
+	}
+	s.write("40" + nsp + ",")
+	if ack := s.read(); !strings.HasPrefix(ack, "40"+nsp+",") {
+		t.Fatalf("joining %s: got %q", nsp, ack)
+	}
+	return s
+}
+
+func (s *testSocket) write(packet string) {
+	s.t.Helper()
+	if err := s.conn.WriteMessage(websocket.TextMessage, []byte(packet)); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// read returns the next packet other than a ping, answering pings when the
+// socket plays a live peer.
+func (s *testSocket) read() string {
+	s.t.Helper()
+	for {
+		_ = s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		if string(data) == "2" {
+			if s.pong {
+				s.write("3")
+			}
+			continue
+		}
+		return string(data)
+	}
+}
+
+func (s *testSocket) emit(event string, payload interface{}) {
+	s.t.Helper()
+	data, _ := json.Marshal([]interface{}{event, payload})
+	s.write("42" + s.nsp + "," + string(data))
+}
+
+// nextMessage returns the type of the next gateway "message" event.
+func (s *testSocket) nextMessage() string {
+	s.t.Helper()
+	prefix := "42" + s.nsp + ","
+	for {
+		packet := s.read()
+		if !strings.HasPrefix(packet, prefix) {
+			continue
+		}
+		var args []json.RawMessage
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(packet, prefix)), &args); err != nil || len(args) < 2 {
+			s.t.Fatalf("bad event packet %q", packet)
+		}
+		var msg gatewayPayload
+		if err := json.Unmarshal(args[1], &msg); err != nil {
+			s.t.Fatalf("bad message payload %q", packet)
+		}
+		return msg.Type
+	}
+}
+
+func (s *testSocket) expectMessage(want string) {
+	s.t.Helper()
+	if got := s.nextMessage(); got != want {
+		s.t.Fatalf("message = %q, want %q", got, want)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdminSocketDemotedAfterGrace(t *testing.T) {
+	h, clock, tokens, url := newTestHub(t, WithAuthGrace(time.Minute))
+	tokens.issue("t1", 10*time.Minute)
+	admin := dialSocket(t, url+"&token=t1", namespaceAdmin, true)
+	admin.expectMessage("GATEWAY_CONNECT")
+	waitFor(t, "admin to register", func() bool { return h.ClientCount(RoomAdmin) == 1 })
+
+	// Expired, but still inside the grace period.
+	clock.Advance(10*time.Minute + 30*time.Second)
+	h.sweepAdminAuth()
+	if h.ClientCount(RoomAdmin) != 1 {
+		t.Fatal("socket demoted before the grace period ended")
+	}
+
+	clock.Advance(31 * time.Second)
+	h.sweepAdminAuth()
+	admin.expectMessage(eventAuthExpired)
+	waitFor(t, "admin to leave the room", func() bool { return h.ClientCount(RoomAdmin) == 0 })
+
+	// Demoted sockets no longer get admin broadcasts.
+	h.BroadcastAdmin("ADMIN_ONLY", nil)
+	admin.emit(eventTokenRefresh, map[string]string{"token": "t1"})
+	admin.expectMessage("AUTH_FAILED")
+}
+
+func TestAdminSocketRefreshExtendsAndRestores(t *testing.T) {
+	h, clock, tokens, url := newTestHub(t, WithAuthGrace(time.Minute))
+	tokens.issue("t1", 10*time.Minute)
+	admin := dialSocket(t, url+"&token=t1", namespaceAdmin, true)
+	admin.expectMessage("GATEWAY_CONNECT")
+
+	// Refreshing before expiry keeps the socket past the first token.
+	clock.Advance(9 * time.Minute)
+	tokens.issue("t2", 10*time.Minute)
+	admin.emit(eventTokenRefresh, map[string]string{"token": "t2"})
+	admin.expectMessage(eventAuthRefreshed)
+	clock.Advance(5 * time.Minute)
+	h.sweepAdminAuth()
+	h.BroadcastAdmin("STILL_ADMIN", nil)
+	admin.expectMessage("STILL_ADMIN")
+
+	// Once demoted, a fresh token brings the socket back.
+	clock.Advance(10 * time.Minute)
+	h.sweepAdminAuth()
+	admin.expectMessage(eventAuthExpired)
+	tokens.issue("t3", 10*time.Minute)
+	admin.emit(eventTokenRefresh, map[string]string{"token": "t3"})
+	admin.expectMessage(eventAuthRefreshed)
+	waitFor(t, "admin to rejoin", func() bool { return h.ClientCount(RoomAdmin) == 1 })
+	h.BroadcastAdmin("BACK", nil)
+	admin.expectMessage("BACK")
+}
+
+func TestRevokedTokenDemotedAfterGrace(t *testing.T) {
+	h, clock, tokens, url := newTestHub(t, WithAuthGrace(time.Minute))
+	tokens.issue("t1", time.Hour)
+	admin := dialSocket(t, url+"&token=t1", namespaceAdmin, true)
+	admin.expectMessage("GATEWAY_CONNECT")
+	waitFor(t, "admin to register", func() bool { return h.ClientCount(RoomAdmin) == 1 })
+
+	tokens.mu.Lock()
+	delete(tokens.exp, "t1")
+	tokens.mu.Unlock()
+	h.sweepAdminAuth() // the grace period starts at the first failed check
+	clock.Advance(59 * time.Second)
+	h.sweepAdminAuth()
+	if h.ClientCount(RoomAdmin) != 1 {
+		t.Fatal("revoked socket demoted before the grace period ended")
+	}
+	clock.Advance(time.Second)
+	h.sweepAdminAuth()
+	admin.expectMessage(eventAuthExpired)
+}
+
+func TestDeadPeerLeavesPublicCount(t *testing.T) {
+	h, _, _, url := newTestHub(t, WithHeartbeat(50*time.Millisecond, 50*time.Millisecond))
+	live := dialSocket(t, url+"&socket_session_id=live", namespaceWeb, true)
+	live.expectMessage("GATEWAY_CONNECT")
+	dead := dialSocket(t, url+"&socket_session_id=dead", namespaceWeb, false)
+	dead.expectMessage("GATEWAY_CONNECT")
+	waitFor(t, "both readers to register", func() bool { return h.ClientCount(RoomPublic) == 2 })
+
+	// The silent peer misses its pong and is dropped; the live one stays.
+	go func() {
+		for {
+			_ = live.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, data, err := live.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) == "2" {
+				_ = live.conn.WriteMessage(websocket.TextMessage, []byte("3"))
+			}
+		}
+	}()
+	waitFor(t, "the dead peer to be dropped", func() bool { return h.ClientCount(RoomPublic) == 1 })
+	if !h.HasSID(h.onlySID(t)) {
+		t.Fatal("live socket was dropped")
+	}
+}
+
+// onlySID returns the one registered socket ID.
+func (h *Hub) onlySID(t *testing.T) string {
+	t.Helper()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sid := range h.sidRoom {
+		return sid
+	}
+	t.Fatal("no registered sockets")
+	return ""
+}
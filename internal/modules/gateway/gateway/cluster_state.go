@@ -23,6 +23,14 @@ const (
 	redisKeyGatewayInstanceSIDsPref  = "mx:gateway:instance:sids:"
 	redisKeyGatewaySIDRoomsPref      = "mx:gateway:sid:rooms:"
 	redisKeyGatewayRoomMembersPref   = "mx:gateway:public:room_members:"
+	redisKeyGatewayInstances         = "mx:gateway:instances"
+	redisKeyGatewayInstanceAlivePref = "mx:gateway:instance:alive:"
+
+	// Every instance refreshes a heartbeat key; the sockets of an instance
+	// whose heartbeat expired, such as a crashed worker that was not
+	// restarted, are removed from the shared state by the other instances.
+	gatewayInstanceHeartbeatInterval = 10 * time.Second
+	gatewayInstanceHeartbeatTTL      = 3 * gatewayInstanceHeartbeatInterval
 )
 
 func gatewayInstanceKey() string {
@@ -40,6 +48,10 @@ func gatewayInstanceSIDsKey(instanceKey string) string {
 	return redisKeyGatewayInstanceSIDsPref + instanceKey
 }
 
+func gatewayInstanceAliveKey(instanceKey string) string {
+	return redisKeyGatewayInstanceAlivePref + instanceKey
+}
+
 func gatewaySIDRoomsKey(sid string) string {
 	return redisKeyGatewaySIDRoomsPref + strings.TrimSpace(sid)
 }
@@ -103,11 +115,90 @@ func (h *Hub) cleanupClusterState() {
 			h.clusterWarn("gateway sid shutdown cleanup failed", zap.String("instance", instanceKey), zap.String("sid", sid), zap.Error(err))
 		}
 	}
-	if err := h.rc.Raw().Del(ctx, gatewayInstanceSIDsKey(instanceKey)).Err(); err != nil {
+	pipe := h.rc.Raw().TxPipeline()
+	pipe.Del(ctx, gatewayInstanceSIDsKey(instanceKey))
+	pipe.Del(ctx, gatewayInstanceAliveKey(instanceKey))
+	pipe.SRem(ctx, redisKeyGatewayInstances, instanceKey)
+	if _, err := pipe.Exec(ctx); err != nil {
 		h.clusterWarn("gateway instance state delete failed", zap.String("instance", instanceKey), zap.Error(err))
 	}
 }
 
+// runClusterHeartbeat keeps this instance's heartbeat alive and removes the
+// sockets of instances whose heartbeat expired, until ctx is done.
+func (h *Hub) runClusterHeartbeat(ctx context.Context) {
+	if !h.clusterStateEnabled() {
+		return
+	}
+	ticker := time.NewTicker(gatewayInstanceHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		h.clusterHeartbeat()
+		h.sweepDeadInstances()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Hub) clusterHeartbeat() {
+	ctx, cancel := h.clusterContext()
+	defer cancel()
+
+	instanceKey := gatewayInstanceKey()
+	pipe := h.rc.Raw().TxPipeline()
+	pipe.SAdd(ctx, redisKeyGatewayInstances, instanceKey)
+	pipe.Set(ctx, gatewayInstanceAliveKey(instanceKey), time.Now().Unix(), gatewayInstanceHeartbeatTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		h.clusterWarn("gateway instance heartbeat failed", zap.String("instance", instanceKey), zap.Error(err))
+	}
+}
+
+func (h *Hub) sweepDeadInstances() {
+	// A dead instance may have left many sockets behind, more than the
+	// usual cluster state timeout allows for.
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayInstanceHeartbeatInterval)
+	defer cancel()
+
+	self := gatewayInstanceKey()
+	instances, err := h.rc.Raw().SMembers(ctx, redisKeyGatewayInstances).Result()
+	if err != nil {
+		h.clusterWarn("gateway instance list lookup failed", zap.Error(err))
+		return
+	}
+	for _, instanceKey := range filterNonEmptyStrings(instances) {
+		if instanceKey == self {
+			continue
+		}
+		alive, err := h.rc.Raw().Exists(ctx, gatewayInstanceAliveKey(instanceKey)).Result()
+		if err != nil || alive > 0 {
+			continue
+		}
+		// Removing the instance from the set claims the cleanup, so the
+		// session refs of its sockets are released only once.
+		claimed, err := h.rc.Raw().SRem(ctx, redisKeyGatewayInstances, instanceKey).Result()
+		if err != nil || claimed == 0 {
+			continue
+		}
+		sids, err := h.rc.Raw().SMembers(ctx, gatewayInstanceSIDsKey(instanceKey)).Result()
+		if err != nil {
+			h.clusterWarn("gateway dead instance lookup failed", zap.String("instance", instanceKey), zap.Error(err))
+			continue
+		}
+		for _, sid := range sids {
+			if err := h.clusterRemoveSIDWithContext(ctx, sid); err != nil {
+				h.clusterWarn("gateway dead instance sid cleanup failed", zap.String("instance", instanceKey), zap.String("sid", sid), zap.Error(err))
+			}
+		}
+		_ = h.rc.Raw().Del(ctx, gatewayInstanceSIDsKey(instanceKey)).Err()
+		if h.logger != nil && len(sids) > 0 {
+			h.logger.Info("gateway removed sockets of dead instance", zap.String("instance", instanceKey), zap.Int("sockets", len(sids)))
+		}
+	}
+}
+
 func (h *Hub) clusterUpsertClient(sid, room, sessionID string) (int, bool) {
 	if !h.clusterStateEnabled() {
 		return 0, false
@@ -14,8 +14,33 @@ import (
 	"go.uber.org/zap"
 )
 
-func NewHub(rc *pkgredis.Client, logger *zap.Logger, adminTokenValidator func(string) bool) *Hub {
-	sio := socketio.NewServer(nil, nil)
+// HubOption configures a Hub.
+type HubOption func(*Hub)
+
+// WithHeartbeat sets how often sockets are pinged and how long a pong may
+// take before the socket is closed as dead. Zero keeps the default.
+func WithHeartbeat(interval, timeout time.Duration) HubOption {
+	return func(h *Hub) {
+		if interval > 0 {
+			h.pingInterval = interval
+		}
+		if timeout > 0 {
+			h.pingTimeout = timeout
+		}
+	}
+}
+
+// WithAuthGrace sets how long an admin socket keeps the admin room after its
+// token expired. Zero keeps the default.
+func WithAuthGrace(d time.Duration) HubOption {
+	return func(h *Hub) {
+		if d > 0 {
+			h.authGrace = d
+		}
+	}
+}
+
+func NewHub(rc *pkgredis.Client, logger *zap.Logger, adminTokenValidator AdminTokenValidator, opts ...HubOption) *Hub {
 	h := &Hub{
 		sidRoom:             make(map[string]string),
 		sidSession:          make(map[string]string),
@@ -25,14 +50,26 @@ func NewHub(rc *pkgredis.Client, logger *zap.Logger, adminTokenValidator func(st
 		sidJoinedRooms:      make(map[string]map[string]struct{}),
 		joinedRoomCount:     make(map[string]int),
 		logSubs:             make(map[string]adminLogSubscription),
+		logLineSubs:         make(map[string]logLineSubscription),
 		broadcast:           make(chan Message, 256),
 		register:            make(chan clientMeta, 256),
 		unregister:          make(chan clientMeta, 256),
 		rc:                  rc,
 		logger:              logger,
-		sio:                 sio,
 		adminTokenValidator: adminTokenValidator,
-	}
+		adminAuths:          make(map[string]*adminAuth),
+		authGrace:           defaultAuthGrace,
+		now:                 time.Now,
+		pingInterval:        defaultPingInterval,
+		pingTimeout:         defaultPingTimeout,
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	sioOpts := socketio.DefaultServerOptions()
+	sioOpts.SetPingInterval(h.pingInterval)
+	sioOpts.SetPingTimeout(h.pingTimeout)
+	h.sio = socketio.NewServer(nil, sioOpts)
 	h.registerNamespaces()
 	return h
 }
@@ -40,12 +77,16 @@ func NewHub(rc *pkgredis.Client, logger *zap.Logger, adminTokenValidator func(st
 // Run starts the hub loop and Redis subscriber.
 func (h *Hub) Run(ctx context.Context) {
 	h.initializeClusterState()
+	go h.runClusterHeartbeat(ctx)
 	go h.subscribeRedis(ctx)
+	go h.forwardLogLines(ctx)
+	go h.runAuthSweep(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
 			h.sio.Close(nil)
+			h.stopRemoteLogLines()
 			h.cleanupClusterState()
 			return
 
@@ -489,6 +530,12 @@ func (h *Hub) BroadcastPublic(event string, payload interface{}) {
 	h.Broadcast(event, payload, RoomPublic)
 }
 
+// BroadcastRoom sends to the public clients that joined roomName, such as
+// the readers of one article.
+func (h *Hub) BroadcastRoom(event string, payload interface{}, roomName string) {
+	h.broadcast <- Message{Event: event, Payload: payload, Room: RoomPublic, Channel: roomName}
+}
+
 // ClientCount returns the number of connected clients (optionally filtered by room).
 func (h *Hub) ClientCount(room string) int {
 	if h.clusterStateEnabled() {
@@ -0,0 +1,254 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mx-space/core/internal/pkg/cluster"
+	"github.com/mx-space/core/internal/pkg/nativelog"
+	socketio "github.com/zishang520/socket.io/v2/socket"
+	"go.uber.org/zap/zapcore"
+)
+
+// Structured log streaming for the admin console. An admin socket sends
+// log#subscribe, optionally with {"level": "warn"}, receives the buffered
+// recent entries and then every new one as a log#line message until it sends
+// log#unsubscribe or disconnects.
+//
+// In cluster mode every worker tags its entries with its worker ID and, while
+// some worker has a subscriber, also publishes them on redisChanLogLines so
+// the socket's worker can relay the other workers' entries.
+const (
+	eventLogSubscribe   = "log#subscribe"
+	eventLogUnsubscribe = "log#unsubscribe"
+	eventLogLine        = "log#line"
+
+	redisChanLogLines        = "mx:gateway:log:lines"
+	logLineSubscriptionBuf   = 512
+	logLineListenerCheckFreq = 2 * time.Second
+)
+
+type logLineSubscription struct {
+	client   *socketio.Socket
+	streamID int
+	minLevel zapcore.Level
+	stopCh   chan struct{}
+}
+
+func parseLogLevelOption(args []any) zapcore.Level {
+	if len(args) == 0 {
+		return zapcore.DebugLevel
+	}
+	var raw string
+	switch v := args[0].(type) {
+	case string:
+		payload := make(map[string]any)
+		if err := json.Unmarshal([]byte(v), &payload); err == nil {
+			raw = strFromAny(payload["level"])
+		} else {
+			raw = strings.TrimSpace(v)
+		}
+	default:
+		raw = strFromAny(mapFromAny(v)["level"])
+	}
+	level, err := zapcore.ParseLevel(strings.ToLower(raw))
+	if raw == "" || err != nil {
+		return zapcore.DebugLevel
+	}
+	return level
+}
+
+func (h *Hub) subscribeLogLines(client *socketio.Socket, minLevel zapcore.Level) {
+	sid := string(client.Id())
+	if sid == "" {
+		return
+	}
+
+	h.logLineMu.Lock()
+	if sub, exists := h.logLineSubs[sid]; exists {
+		sub.minLevel = minLevel
+		h.logLineSubs[sid] = sub
+		h.logLineMu.Unlock()
+		return
+	}
+	streamID, stream, backlog := nativelog.SubscribeEntries(logLineSubscriptionBuf)
+	stopCh := make(chan struct{})
+	h.logLineSubs[sid] = logLineSubscription{
+		client:   client,
+		streamID: streamID,
+		minLevel: minLevel,
+		stopCh:   stopCh,
+	}
+	first := len(h.logLineSubs) == 1
+	h.logLineMu.Unlock()
+
+	if first {
+		h.startRemoteLogLines()
+	}
+
+	workerID := cluster.WorkerID()
+	for _, entry := range backlog {
+		if entry.LevelEnabled(minLevel) {
+			entry.Worker = workerID
+			_ = client.Emit("message", h.gatewayMessageFormat(eventLogLine, entry, nil))
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case <-stopCh:
+				return
+			case entry, ok := <-stream:
+				if !ok {
+					return
+				}
+				if !entry.LevelEnabled(h.logLineLevel(sid)) {
+					continue
+				}
+				entry.Worker = workerID
+				_ = client.Emit("message", h.gatewayMessageFormat(eventLogLine, entry, nil))
+			}
+		}
+	}()
+}
+
+func (h *Hub) unsubscribeLogLines(sid string) {
+	if sid == "" {
+		return
+	}
+
+	h.logLineMu.Lock()
+	sub, exists := h.logLineSubs[sid]
+	if exists {
+		delete(h.logLineSubs, sid)
+	}
+	last := exists && len(h.logLineSubs) == 0
+	h.logLineMu.Unlock()
+	if !exists {
+		return
+	}
+
+	close(sub.stopCh)
+	nativelog.UnsubscribeEntries(sub.streamID)
+	if last {
+		h.stopRemoteLogLines()
+	}
+}
+
+func (h *Hub) logLineLevel(sid string) zapcore.Level {
+	h.logLineMu.Lock()
+	defer h.logLineMu.Unlock()
+	return h.logLineSubs[sid].minLevel
+}
+
+// startRemoteLogLines relays the entries other workers publish to the local
+// subscribers. It is a no-op outside cluster mode.
+func (h *Hub) startRemoteLogLines() {
+	if !cluster.IsWorker() || !h.clusterStateEnabled() {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.logLineMu.Lock()
+	if h.logLineRemoteStop != nil {
+		h.logLineMu.Unlock()
+		cancel()
+		return
+	}
+	h.logLineRemoteStop = cancel
+	h.logLineMu.Unlock()
+
+	pubsub := h.rc.Subscribe(ctx, redisChanLogLines)
+	go func() {
+		defer pubsub.Close()
+		self := cluster.WorkerID()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case raw, ok := <-ch:
+				if !ok {
+					return
+				}
+				var entry nativelog.Entry
+				if json.Unmarshal([]byte(raw.Payload), &entry) != nil || entry.Worker == self {
+					continue
+				}
+				h.emitRemoteLogLine(entry)
+			}
+		}
+	}()
+}
+
+func (h *Hub) stopRemoteLogLines() {
+	h.logLineMu.Lock()
+	stop := h.logLineRemoteStop
+	h.logLineRemoteStop = nil
+	h.logLineMu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+func (h *Hub) emitRemoteLogLine(entry nativelog.Entry) {
+	h.logLineMu.Lock()
+	targets := make([]*socketio.Socket, 0, len(h.logLineSubs))
+	for _, sub := range h.logLineSubs {
+		if entry.LevelEnabled(sub.minLevel) {
+			targets = append(targets, sub.client)
+		}
+	}
+	h.logLineMu.Unlock()
+
+	for _, client := range targets {
+		_ = client.Emit("message", h.gatewayMessageFormat(eventLogLine, entry, nil))
+	}
+}
+
+// forwardLogLines publishes this worker's entries for the other workers
+// while any of them relays them. It runs for the life of the hub in cluster
+// mode only. Publish errors are not logged, as that would feed the stream.
+func (h *Hub) forwardLogLines(ctx context.Context) {
+	if !cluster.IsWorker() || !h.clusterStateEnabled() {
+		return
+	}
+	streamID, stream, _ := nativelog.SubscribeEntries(logLineSubscriptionBuf)
+	defer nativelog.UnsubscribeEntries(streamID)
+
+	workerID := cluster.WorkerID()
+	listening := false
+	var checkedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry, ok := <-stream:
+			if !ok {
+				return
+			}
+			if time.Since(checkedAt) >= logLineListenerCheckFreq {
+				listening = h.remoteLogListeners(ctx)
+				checkedAt = time.Now()
+			}
+			if !listening {
+				continue
+			}
+			entry.Worker = workerID
+			data, err := json.Marshal(entry)
+			if err != nil {
+				continue
+			}
+			_ = h.rc.Publish(ctx, redisChanLogLines, string(data))
+		}
+	}
+}
+
+func (h *Hub) remoteLogListeners(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, gatewayClusterStateTimeout)
+	defer cancel()
+	counts, err := h.rc.Raw().PubSubNumSub(ctx, redisChanLogLines).Result()
+	return err == nil && counts[redisChanLogLines] > 0
+}
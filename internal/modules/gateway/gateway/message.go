@@ -3,6 +3,8 @@ package gateway
 import (
 	"context"
 	"encoding/json"
+
+	socketio "github.com/zishang520/socket.io/v2/socket"
 )
 
 func (h *Hub) gatewayMessageFormat(event string, payload interface{}, code *int) gatewayPayload {
@@ -17,14 +19,24 @@ func (h *Hub) emitNamespace(nsp string, msg Message) {
 	h.sio.Of(nsp, nil).Emit("message", h.gatewayMessageFormat(msg.Event, msg.Payload, msg.Code))
 }
 
+// emitAdmin sends msg to the admin sockets still authorized, which are the
+// members of the RoomAdmin room of the admin namespace.
+func (h *Hub) emitAdmin(msg Message) {
+	h.sio.Of(namespaceAdmin, nil).To(socketio.Room(RoomAdmin)).Emit("message", h.gatewayMessageFormat(msg.Event, msg.Payload, msg.Code))
+}
+
 func (h *Hub) deliver(msg Message) {
 	switch msg.Room {
 	case RoomAdmin:
-		h.emitNamespace(namespaceAdmin, msg)
+		h.emitAdmin(msg)
 	case RoomPublic:
+		if msg.Channel != "" {
+			h.sio.Of(namespaceWeb, nil).To(socketio.Room(msg.Channel)).Emit("message", h.gatewayMessageFormat(msg.Event, msg.Payload, msg.Code))
+			return
+		}
 		h.emitNamespace(namespaceWeb, msg)
 	case "":
-		h.emitNamespace(namespaceAdmin, msg)
+		h.emitAdmin(msg)
 		h.emitNamespace(namespaceWeb, msg)
 	}
 }
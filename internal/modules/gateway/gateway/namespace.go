@@ -21,6 +21,9 @@ func (h *Hub) registerNamespaces() {
 		}
 		sid := string(client.Id())
 		sessionID := normalizeSessionID(extractSessionID(client, sid), sid)
+		// Web sockets are anonymous: whatever token they carry, they only
+		// ever join RoomPublic. Admin events go through the admin namespace.
+		client.Join(socketio.Room(RoomPublic))
 		h.register <- clientMeta{sid: sid, room: RoomPublic, sessionID: sessionID}
 		_ = client.Emit("message", h.gatewayMessageFormat("GATEWAY_CONNECT", "WebSocket connected", nil))
 		_ = client.On("message", func(eventArgs ...any) {
@@ -35,7 +38,7 @@ func (h *Hub) registerNamespaces() {
 					strFromAny(msg.Payload["roomName"]),
 					strFromAny(msg.Payload["room_name"]),
 				)
-				if roomName == "" {
+				if roomName == "" || reservedRoomName(roomName) {
 					return
 				}
 				client.Join(socketio.Room(roomName))
@@ -83,37 +86,69 @@ func (h *Hub) registerNamespaces() {
 	})
 
 	adminNS := h.sio.Of(namespaceAdmin, nil)
+	// Credentials are checked during the namespace handshake, so a socket
+	// without a valid owner token never connects and never joins RoomAdmin.
+	adminNS.Use(func(client *socketio.Socket, next func(*socketio.ExtendedError)) {
+		token := normalizeToken(extractToken(client))
+		expiresAt, ok := h.validateAdminToken(token)
+		if !ok {
+			next(socketio.NewExtendedError("auth failed", map[string]any{"type": "AUTH_FAILED"}))
+			return
+		}
+		h.trackAdmin(string(client.Id()), client, token, expiresAt)
+		next(nil)
+	})
 	_ = adminNS.On("connection", func(args ...any) {
 		client, ok := args[0].(*socketio.Socket)
 		if !ok {
 			return
 		}
 
-		token := normalizeToken(extractToken(client))
-		if token == "" || h.adminTokenValidator == nil || !h.adminTokenValidator(token) {
+		sid := string(client.Id())
+		if !h.adminActive(sid) {
 			_ = client.Emit("message", h.gatewayMessageFormat("AUTH_FAILED", "auth failed", nil))
 			client.Disconnect(true)
 			return
 		}
-
-		sid := string(client.Id())
+		client.Join(socketio.Room(RoomAdmin))
 		h.register <- clientMeta{sid: sid, room: RoomAdmin}
 		_ = client.Emit("message", h.gatewayMessageFormat("GATEWAY_CONNECT", "WebSocket connected", nil))
 
 		_ = client.On("log", func(eventArgs ...any) {
-			h.subscribeStdout(client, parsePrevLogOption(eventArgs))
+			if h.adminActive(sid) {
+				h.subscribeStdout(client, parsePrevLogOption(eventArgs))
+			}
 		})
 		_ = client.On("unlog", func(_ ...any) {
 			h.unsubscribeStdout(sid)
 		})
+		_ = client.On(eventLogSubscribe, func(eventArgs ...any) {
+			if h.adminActive(sid) {
+				h.subscribeLogLines(client, parseLogLevelOption(eventArgs))
+			}
+		})
+		_ = client.On(eventLogUnsubscribe, func(_ ...any) {
+			h.unsubscribeLogLines(sid)
+		})
+		_ = client.On(eventTokenRefresh, func(eventArgs ...any) {
+			h.refreshAdminToken(client, eventArgs)
+		})
 
 		_ = client.On("disconnect", func(_ ...any) {
+			h.untrackAdmin(sid)
 			h.unsubscribeStdout(sid)
+			h.unsubscribeLogLines(sid)
 			h.unregister <- clientMeta{sid: sid, room: RoomAdmin}
 		})
 	})
 }
 
+// reservedRoomName reports whether roomName is one of the hub's own rooms,
+// which web clients may not join themselves.
+func reservedRoomName(roomName string) bool {
+	return roomName == RoomAdmin || roomName == RoomPublic
+}
+
 func extractToken(client *socketio.Socket) string {
 	handshake := client.Handshake()
 	if handshake == nil {
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -28,6 +29,11 @@ const (
 	messageUpdateSID  = "updateSid"
 	messageUpdateLang = "updateLang"
 
+	// Engine.IO defaults; a socket missing a pong within the timeout is
+	// closed, which removes it from the online counts.
+	defaultPingInterval = 25 * time.Second
+	defaultPingTimeout  = 20 * time.Second
+
 	nativeLogSnapshotChunkSize = 32 * 1024
 	onlineStatsFlushDelay      = time.Second
 )
@@ -38,6 +44,8 @@ type Message struct {
 	Payload interface{} `json:"payload"`
 	Code    *int        `json:"code,omitempty"`
 	Room    string      `json:"room,omitempty"`
+	// Channel narrows a public message to the web clients that joined it.
+	Channel string `json:"channel,omitempty"`
 }
 
 type gatewayPayload struct {
@@ -72,6 +80,15 @@ type Hub struct {
 	logSubMu sync.Mutex
 	logSubs  map[string]adminLogSubscription
 
+	adminAuthMu sync.Mutex
+	adminAuths  map[string]*adminAuth
+	authGrace   time.Duration
+	now         func() time.Time
+
+	logLineMu         sync.Mutex
+	logLineSubs       map[string]logLineSubscription
+	logLineRemoteStop context.CancelFunc
+
 	onlineStatsMu           sync.Mutex
 	onlineStatsTimer        *time.Timer
 	onlineStatsPendingMax   int
@@ -84,5 +101,7 @@ type Hub struct {
 	rc                  *pkgredis.Client
 	logger              *zap.Logger
 	sio                 *socketio.Server
-	adminTokenValidator func(string) bool
+	adminTokenValidator AdminTokenValidator
+	pingInterval        time.Duration
+	pingTimeout         time.Duration
 }
@@ -174,7 +174,7 @@ func (s *Service) OnPostCreate(post *models.PostModel) {
 	}
 
 	detailURL := s.buildPostURL(cfg, post)
-	s.sendNewsletter(cfg, post.Title, post.Text, detailURL, subscribe.SubscribePostCreateBit)
+	s.sendNewsletter(cfg, post.Title, post.Text, detailURL, post.ID, post.CreatedAt, subscribe.SubscribePostCreateBit)
 }
 
 // OnNoteCreate is called when a new note is published.
@@ -208,10 +208,88 @@ func (s *Service) OnNoteCreate(note *models.NoteModel) {
 	if note.PublicAt != nil && note.PublicAt.After(time.Now()) {
 		return
 	}
-	s.sendNewsletter(cfg, note.Title, note.Text, detailURL, subscribe.SubscribeNoteCreateBit)
+	s.sendNewsletter(cfg, note.Title, note.Text, detailURL, note.ID, note.CreatedAt, subscribe.SubscribeNoteCreateBit)
 }
 
-func (s *Service) sendNewsletter(cfg *config.FullConfig, title, text, detailURL string, bit int) {
+const (
+	// newsletterBatchSize is how many newsletter emails go out before pausing.
+	newsletterBatchSize = 20
+	// newsletterBatchDelay spaces batches out so SMTP providers don't throttle.
+	newsletterBatchDelay = 5 * time.Second
+	newsletterPreviewLen = 300
+)
+
+// OnSayCreate is called when a new say is created.
+// It sends newsletters to subscribers of says.
+func (s *Service) OnSayCreate(say *models.SayModel) {
+	cfg, err := s.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return
+	}
+	title := "一言"
+	if author := strings.TrimSpace(say.Author); author != "" {
+		title += " · " + author
+	}
+	detailURL := strings.TrimRight(cfg.URL.WebURL, "/") + "/says"
+	s.sendNewsletter(cfg, title, say.Text, detailURL, say.ID, say.CreatedAt, subscribe.SubscribeSayCreateBit)
+}
+
+// OnRecentlyCreate is called when a new recently (thinking) is created.
+// It sends newsletters to subscribers of recentlies.
+func (s *Service) OnRecentlyCreate(r *models.RecentlyModel) {
+	cfg, err := s.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return
+	}
+	detailURL := strings.TrimRight(cfg.URL.WebURL, "/") + "/thinking"
+	s.sendNewsletter(cfg, "速记", r.Content, detailURL, r.ID, r.CreatedAt, subscribe.SubscribeRecentCreateBit)
+}
+
+// OnNewLoginIP is called when the owner signs in from an IP with no earlier
+// successful login. It alerts the owner via email and Bark.
+func (s *Service) OnNewLoginIP(l *models.LoginLog) {
+	cfg, err := s.cfgSvc.Get()
+	if err != nil {
+		s.logger.Warn("load config for login notification failed", zap.Error(err))
+		return
+	}
+	if cfg == nil {
+		return
+	}
+	location := l.Location
+	if location == "" {
+		location = "未知位置"
+	}
+
+	if s.barkSvc != nil && cfg.BarkOptions.Enable {
+		title := fmt.Sprintf("新 IP 登录 (%s)", l.IP)
+		body := fmt.Sprintf("%s 于 %s 从 %s 登录\n%s", l.Username, l.CreatedAt.Format("2006-01-02 15:04:05"), location, l.UA)
+		if err := s.barkSvc.Push(title, body); err != nil {
+			s.logger.Warn("login bark notification failed", zap.String("ip", l.IP), zap.Error(err))
+		}
+	}
+
+	master, masterMail, _ := s.getMasterInfo()
+	if cfg.MailOptions.Enable && masterMail != "" {
+		sender := pkgmail.New(pkgmail.BuildMailConfig(cfg), pkgmail.WithLogger(s.logger))
+		err := sender.SendLoginAlert(masterMail, pkgmail.LoginAlertData{
+			Master:   master,
+			Username: l.Username,
+			SiteName: cfg.SEO.Title,
+			Time:     l.CreatedAt.Format("2006-01-02 15:04:05"),
+			IP:       l.IP,
+			Location: l.Location,
+			UA:       l.UA,
+		})
+		if err != nil {
+			s.logger.Warn("login mail notification failed", zap.String("ip", l.IP), zap.Error(err))
+		}
+	}
+}
+
+// sendNewsletter mails confirmed subscribers of bit in batches, rendering the
+// email_template_newsletter option when one is saved.
+func (s *Service) sendNewsletter(cfg *config.FullConfig, title, text, detailURL, refID string, created time.Time, bit int) {
 	if !cfg.MailOptions.Enable || !cfg.FeatureList.EmailSubscribe {
 		return
 	}
@@ -231,18 +309,27 @@ func (s *Service) sendNewsletter(cfg *config.FullConfig, title, text, detailURL
 
 	// Truncate text for newsletter preview.
 	preview := text
-	if len(preview) > 300 {
-		preview = preview[:300] + "..."
+	if runes := []rune(preview); len(runes) > newsletterPreviewLen {
+		preview = string(runes[:newsletterPreviewLen]) + "..."
+	}
+
+	var tpl models.OptionModel
+	if err := s.db.Where("name = ?", "email_template_newsletter").Limit(1).Find(&tpl).Error; err != nil {
+		s.logger.Warn("load newsletter template failed", zap.Error(err))
 	}
 
 	sender := pkgmail.New(pkgmail.BuildMailConfig(cfg), pkgmail.WithLogger(s.logger))
-	for _, sub := range subs {
-		unsubBaseURL := s.buildSubscribeActionURL(cfg, "/subscribe/unsubscribe")
+	unsubBaseURL := s.buildSubscribeActionURL(cfg, "/subscribe/unsubscribe")
+	failed := 0
+	for i, sub := range subs {
+		if i > 0 && i%newsletterBatchSize == 0 {
+			time.Sleep(newsletterBatchDelay)
+		}
 		unsubURL := ""
 		if unsubBaseURL != "" {
 			unsubURL = fmt.Sprintf("%s?token=%s", unsubBaseURL, sub.CancelToken)
 		}
-		_ = sender.SendNewsletter(sub.Email, pkgmail.NewsletterData{
+		err := sender.SendNewsletter(sub.Email, pkgmail.NewsletterData{
 			OwnerName:      master,
 			OwnerAvatar:    masterAvatar,
 			Title:          title,
@@ -250,8 +337,19 @@ func (s *Service) sendNewsletter(cfg *config.FullConfig, title, text, detailURL
 			DetailURL:      detailURL,
 			UnsubscribeURL: unsubURL,
 			SiteName:       cfg.SEO.Title,
+			Template:       tpl.Value,
+			RefID:          refID,
+			Created:        created,
+			Subscribe:      sub.Subscribe,
 		})
+		if err != nil {
+			failed++
+		}
 	}
+	s.logger.Info("newsletter sent",
+		zap.String("ref_id", refID),
+		zap.Int("subscribers", len(subs)),
+		zap.Int("failed", failed))
 }
 
 func (s *Service) buildCommentURL(cfg *config.FullConfig, refType models.RefType, refID, commentID string) string {
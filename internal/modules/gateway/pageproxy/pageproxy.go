@@ -8,25 +8,38 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	appcfg "github.com/mx-space/core/internal/config"
 	"github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	"go.uber.org/zap"
 )
 
 // Handler serves locally bundled admin dashboard assets under /proxy/*.
 type Handler struct {
-	cfgSvc    *configs.Service
-	runtime   *appcfg.AppConfig
-	adminPath string
+	cfgSvc  *configs.Service
+	runtime *appcfg.AppConfig
+	// adminDir holds the admin asset directory; it is swapped on config reload.
+	adminDir atomic.Value
 }
 
 func NewHandler(cfgSvc *configs.Service, runtime *appcfg.AppConfig) *Handler {
+	h := &Handler{
+		cfgSvc:  cfgSvc,
+		runtime: runtime,
+	}
+	h.SetAdminAssetPath(runtime)
+	return h
+}
+
+// SetAdminAssetPath points the admin proxy at the mx-admin path of cfg.
+func (h *Handler) SetAdminAssetPath(cfg *appcfg.AppConfig) {
 	adminPath := ""
-	if runtime != nil {
-		adminPath = strings.TrimSpace(runtime.AdminAssetPath())
+	if cfg != nil {
+		adminPath = strings.TrimSpace(cfg.AdminAssetPath())
 	}
 	if adminPath == "" {
 		adminPath = strings.TrimSpace(os.Getenv("MX_ADMIN_ASSET_PATH"))
@@ -34,12 +47,11 @@ func NewHandler(cfgSvc *configs.Service, runtime *appcfg.AppConfig) *Handler {
 	if adminPath == "" {
 		adminPath = "admin"
 	}
-	adminPath = filepath.Clean(adminPath)
-	return &Handler{
-		cfgSvc:    cfgSvc,
-		runtime:   runtime,
-		adminPath: adminPath,
-	}
+	h.adminDir.Store(filepath.Clean(adminPath))
+}
+
+func (h *Handler) adminPath() string {
+	return h.adminDir.Load().(string)
 }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
@@ -85,7 +97,7 @@ func (h *Handler) getLocalBundledAdmin(c *gin.Context) {
 		return
 	}
 
-	entryPath := filepath.Join(h.adminPath, "index.html")
+	entryPath := filepath.Join(h.adminPath(), "index.html")
 	content, err := os.ReadFile(entryPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -208,9 +220,9 @@ func (h *Handler) proxyCompatAssetRoute(c *gin.Context) {
 
 func (h *Handler) serveAssetRelative(c *gin.Context, relative string) {
 	cleanRel := strings.TrimPrefix(filepath.Clean("/"+relative), "/")
-	fullPath := filepath.Join(h.adminPath, cleanRel)
+	fullPath := filepath.Join(h.adminPath(), cleanRel)
 
-	adminRoot, err := filepath.Abs(h.adminPath)
+	adminRoot, err := filepath.Abs(h.adminPath())
 	if err != nil {
 		h.logProxyError(c, "resolve admin root", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
@@ -250,10 +262,10 @@ func (h *Handler) logProxyError(c *gin.Context, operation string, err error) {
 	if err == nil {
 		return
 	}
-	zap.L().Named("PageProxy").Error("admin proxy operation failed",
+	tracing.GetLogger(c).Named("PageProxy").Error("admin proxy operation failed",
 		zap.String("operation", operation),
 		zap.String("path", c.Request.URL.RequestURI()),
-		zap.String("admin_path", h.adminPath),
+		zap.String("admin_path", h.adminPath()),
 		zap.Error(err),
 	)
 }
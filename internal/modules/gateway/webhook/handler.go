@@ -21,6 +21,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 
 	g.GET("/events", h.listEventsEnum)
 	g.GET("/dispatches", h.listEvents)
+	g.GET("/dispatches/:id", h.getEvent)
 	g.POST("/redispatch/:id", h.redispatch)
 	g.DELETE("/clear/:id", h.clearEvents)
 	g.GET("/:id", h.listEventsByHook)
@@ -90,7 +91,7 @@ func (h *Handler) listEvents(c *gin.Context) {
 	if hookID != "" {
 		hookIDPtr = &hookID
 	}
-	items, pag, err := h.svc.ListEvents(q, hookIDPtr)
+	items, pag, err := h.svc.ListEvents(q, hookIDPtr, c.Query("state"))
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -98,10 +99,24 @@ func (h *Handler) listEvents(c *gin.Context) {
 	response.Paged(c, items, pag)
 }
 
+// GET /webhooks/dispatches/:id reports the delivery state of one event.
+func (h *Handler) getEvent(c *gin.Context) {
+	item, err := h.svc.GetEventByID(c.Param("id"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if item == nil {
+		response.NotFoundMsg(c, "Webhook 事件不存在")
+		return
+	}
+	response.OK(c, item)
+}
+
 func (h *Handler) listEventsByHook(c *gin.Context) {
 	q := pagination.FromContext(c)
 	hookID := c.Param("id")
-	items, pag, err := h.svc.ListEvents(q, &hookID)
+	items, pag, err := h.svc.ListEvents(q, &hookID, c.Query("state"))
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -1,10 +1,9 @@
 package webhook
 
 import (
-	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -19,13 +18,51 @@ import (
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+const (
+	// maxDeliveryAttempts bounds how often an event is sent to a hook
+	// before its delivery is marked failed.
+	maxDeliveryAttempts = 6
+	retryBaseDelay      = 30 * time.Second
+	retryMaxDelay       = time.Hour
+	retryPollInterval   = 15 * time.Second
+	retryBatchSize      = 50
+	deliveryTimeout     = 10 * time.Second
+	// stalePendingAfter is how long a delivery may stay pending before it is
+	// assumed lost, e.g. to a restart mid-attempt, and picked up again.
+	stalePendingAfter = 5 * time.Minute
+)
+
+var deliveryClient = &http.Client{Timeout: deliveryTimeout}
+
 // Service handles webhook CRUD and delivery.
-type Service struct{ db *gorm.DB }
+type Service struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// ServiceOption configures a webhook Service.
+type ServiceOption func(*Service)
+
+// WithLogger sets the logger for the webhook service.
+func WithLogger(l *zap.Logger) ServiceOption {
+	return func(s *Service) {
+		if l != nil {
+			s.logger = l.Named("WebhookService")
+		}
+	}
+}
 
-func NewService(db *gorm.DB) *Service { return &Service{db: db} }
+func NewService(db *gorm.DB, opts ...ServiceOption) *Service {
+	s := &Service{db: db, logger: zap.NewNop()}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
 
 func (s *Service) List() ([]models.WebhookModel, error) {
 	var items []models.WebhookModel
@@ -107,83 +144,196 @@ func (s *Service) Delete(id string) error {
 	return s.db.Delete(&models.WebhookModel{}, "id = ?", id).Error
 }
 
-// Dispatch sends an event payload to all matching, enabled webhooks.
+// Dispatch sends an event payload to all matching, enabled webhooks. Each
+// delivery is recorded in webhook_events before it is attempted, so failed
+// ones are retried by Run even across restarts.
 func (s *Service) Dispatch(event string, payload interface{}) {
 	var hooks []models.WebhookModel
-	s.db.Where("enabled = ?", true).Find(&hooks)
+	if err := s.db.Where("enabled = ?", true).Find(&hooks).Error; err != nil {
+		s.logger.Warn("load webhooks failed", zap.String("event", event), zap.Error(err))
+		return
+	}
 
+	body, err := json.Marshal(payload)
+	if err != nil {
+		s.logger.Warn("encode webhook payload failed", zap.String("event", event), zap.Error(err))
+		return
+	}
 	for _, hook := range hooks {
 		if !webhookContainsEvent(hook.Events, event) {
 			continue
 		}
-		go s.deliver(hook, event, payload)
+		s.enqueue(hook, event, string(body))
+	}
+}
+
+// Run retries due deliveries until ctx is done. Deliveries are claimed with
+// a conditional update, so several instances can run it side by side.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retryDue()
+		}
+	}
+}
+
+// retryDue attempts the deliveries whose retry is due, along with pending
+// ones nobody has touched for stalePendingAfter.
+func (s *Service) retryDue() {
+	now := time.Now()
+	var due []models.WebhookEventModel
+	err := s.db.Where("(state = ? AND next_retry_at <= ?) OR (state = ? AND updated_at <= ?)",
+		models.WebhookDeliveryRetrying, now, models.WebhookDeliveryPending, now.Add(-stalePendingAfter)).
+		Order("updated_at ASC").Limit(retryBatchSize).Find(&due).Error
+	if err != nil {
+		s.logger.Warn("load due webhook deliveries failed", zap.Error(err))
+		return
+	}
+	for i := range due {
+		ev := &due[i]
+		claim := s.db.Model(&models.WebhookEventModel{}).Where("id = ? AND state = ?", ev.ID, ev.State)
+		if ev.State == models.WebhookDeliveryRetrying {
+			claim = claim.Where("next_retry_at = ?", ev.NextRetryAt)
+		} else {
+			claim = claim.Where("updated_at = ?", ev.UpdatedAt)
+		}
+		res := claim.Updates(map[string]interface{}{
+			"state":         models.WebhookDeliveryPending,
+			"next_retry_at": nil,
+			"updated_at":    now,
+		})
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+		hook, err := s.GetByID(ev.HookID)
+		if err != nil {
+			s.logger.Warn("load webhook for retry failed", zap.String("hook", ev.HookID), zap.Error(err))
+			continue
+		}
+		if hook == nil || !hook.Enabled {
+			s.db.Model(ev).Updates(map[string]interface{}{"state": models.WebhookDeliveryFailed})
+			continue
+		}
+		go s.attempt(*hook, ev)
 	}
 }
 
-func (s *Service) deliver(hook models.WebhookModel, event string, payload interface{}) {
-	body, _ := json.Marshal(payload)
-	payloadString := string(body)
+// enqueue records a new delivery of payload to hook and attempts it.
+func (s *Service) enqueue(hook models.WebhookModel, event, payload string) {
+	ev := models.WebhookEventModel{
+		HookID:    hook.ID,
+		Event:     event,
+		Headers:   "{}",
+		Payload:   payload,
+		Response:  "{}",
+		State:     models.WebhookDeliveryPending,
+		Timestamp: time.Now(),
+	}
+	if err := s.db.Create(&ev).Error; err != nil {
+		s.logger.Warn("record webhook delivery failed", zap.String("hook", hook.ID), zap.String("event", event), zap.Error(err))
+		return
+	}
+	go s.attempt(hook, &ev)
+}
 
-	signature := signWithHash(sha1.New, hook.Secret, payloadString)
-	signature256 := signWithHash(sha256.New, hook.Secret, payloadString)
+// attempt sends ev to hook once and records the outcome, scheduling the next
+// attempt with exponential backoff when it failed. The signature covers
+// "<timestamp>.<payload>" so a captured delivery cannot be replayed later
+// under a fresh timestamp.
+func (s *Service) attempt(hook models.WebhookModel, ev *models.WebhookEventModel) {
 	timestamp := fmt.Sprintf("%d", time.Now().UnixMilli())
+	signature := signWithHash(sha256.New, hook.Secret, timestamp+"."+ev.Payload)
 	headers := map[string]string{
 		"X-Webhook-Signature":    signature,
-		"X-Webhook-Event":        event,
+		"X-Webhook-Signature256": signature,
+		"X-Webhook-Event":        ev.Event,
 		"X-Webhook-Id":           hook.ID,
+		"X-Webhook-Delivery":     ev.ID,
 		"X-Webhook-Timestamp":    timestamp,
-		"X-Webhook-Signature256": signature256,
 	}
 
-	req, err := http.NewRequest("POST", hook.PayloadURL, bytes.NewReader(body))
+	status, respData, err := send(hook.PayloadURL, headers, ev.Payload)
+	success := err == nil && status >= 200 && status < 300
 	if err != nil {
-		s.logEvent(hook.ID, event, headers, payloadString, nil, false, 0, err.Error())
-		return
+		respData = map[string]interface{}{"error": err.Error()}
+	}
+
+	attempts := ev.Attempts + 1
+	updates := map[string]interface{}{
+		"headers":       toJSONString(headers),
+		"response":      toJSONString(respData),
+		"success":       success,
+		"status":        status,
+		"attempts":      attempts,
+		"timestamp":     time.Now(),
+		"next_retry_at": nil,
+	}
+	switch {
+	case success:
+		updates["state"] = models.WebhookDeliverySuccess
+	case attempts < maxDeliveryAttempts:
+		next := time.Now().Add(retryDelay(attempts))
+		updates["state"] = models.WebhookDeliveryRetrying
+		updates["next_retry_at"] = next
+	default:
+		updates["state"] = models.WebhookDeliveryFailed
+		s.logger.Warn("webhook delivery failed",
+			zap.String("hook", hook.ID), zap.String("event", ev.Event), zap.Int("attempts", attempts), zap.Int("status", status))
+	}
+	if err := s.db.Model(&models.WebhookEventModel{}).Where("id = ?", ev.ID).Updates(updates).Error; err != nil {
+		s.logger.Warn("update webhook delivery failed", zap.String("id", ev.ID), zap.Error(err))
+	}
+}
+
+// send posts payload to url and returns the status and a summary of the
+// response for the delivery log.
+func send(url string, headers map[string]string, payload string) (int, map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(payload))
+	if err != nil {
+		return 0, nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := deliveryClient.Do(req)
 	if err != nil {
-		s.logEvent(hook.ID, event, headers, payloadString, nil, false, 0, err.Error())
-		return
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	s.logEvent(hook.ID, event, headers, payloadString, map[string]interface{}{
+	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, map[string]interface{}{
 		"headers":   resp.Header,
 		"data":      parseJSONOrString(bodyBytes),
 		"timestamp": time.Now().UnixMilli(),
 		"status":    resp.Status,
-	}, resp.StatusCode >= 200 && resp.StatusCode < 300, resp.StatusCode, "")
+	}, nil
 }
 
-func (s *Service) logEvent(hookID, event string, headers map[string]string, payload string, respData interface{}, success bool, status int, errMsg string) {
-	log := models.WebhookEventModel{
-		HookID:    hookID,
-		Event:     event,
-		Headers:   toJSONString(headers),
-		Payload:   payload,
-		Response:  toJSONString(respData),
-		Success:   success,
-		Status:    status,
-		Timestamp: time.Now(),
-	}
-	if errMsg != "" {
-		log.Response = toJSONString(map[string]interface{}{"error": errMsg})
-	}
-	s.db.Create(&log)
+// retryDelay is the wait before the attempt following the given number of
+// attempts: 30s, 1m, 2m and so on, capped at retryMaxDelay.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay << (attempts - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
 }
 
-func (s *Service) ListEvents(q pagination.Query, hookID *string) ([]models.WebhookEventModel, response.Pagination, error) {
+func (s *Service) ListEvents(q pagination.Query, hookID *string, state string) ([]models.WebhookEventModel, response.Pagination, error) {
 	tx := s.db.Model(&models.WebhookEventModel{}).Order("timestamp DESC")
 	if hookID != nil {
 		tx = tx.Where("hook_id = ?", *hookID)
 	}
+	if state != "" {
+		tx = tx.Where("state = ?", state)
+	}
 	var items []models.WebhookEventModel
 	pag, err := pagination.Paginate(tx, q, &items)
 	return items, pag, err
@@ -218,11 +368,7 @@ func (s *Service) Redispatch(eventID string) error {
 	if !hook.Enabled {
 		return fmt.Errorf("hook is disabled")
 	}
-	var payload interface{}
-	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
-		payload = event.Payload
-	}
-	go s.deliver(*hook, event.Event, payload)
+	s.enqueue(*hook, event.Event, event.Payload)
 	return nil
 }
 
@@ -13,6 +13,9 @@ type Service struct {
 	taskSvc *taskqueue.Service
 }
 
+// NewService creates the AI service and registers its task handlers.
 func NewService(db *gorm.DB, cfgSvc *configs.Service, taskSvc *taskqueue.Service) *Service {
-	return &Service{db: db, cfgSvc: cfgSvc, taskSvc: taskSvc}
+	s := &Service{db: db, cfgSvc: cfgSvc, taskSvc: taskSvc}
+	taskqueue.Register(TaskTypeSummary, s.runSummaryTask, taskqueue.WithConcurrency(summaryConcurrency))
+	return s
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	appcfg "github.com/mx-space/core/internal/config"
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/system/core/configs"
 	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
 	"gorm.io/gorm"
@@ -116,11 +117,22 @@ func (h *Handler) generateSummary(c *gin.Context) {
 
 // GET /ai/summaries  [auth]
 func (h *Handler) listSummaries(c *gin.Context) {
-	q := pagination.FromContext(c)
+	q, ok := pagination.FromContextWithCursor(c)
+	if !ok {
+		return
+	}
 
 	tx := h.svc.db.Model(&models.AISummaryModel{}).Order("created_at DESC")
 	var items []models.AISummaryModel
-	pag, err := pagination.Paginate(tx, q, &items)
+	var pag interface{}
+	var err error
+	if q.Cursor != nil {
+		pag, err = pagination.PaginateKeyset(tx, q, true, &items, func(s models.AISummaryModel) pagination.Cursor {
+			return pagination.Cursor{CreatedAt: s.CreatedAt, ID: s.ID}
+		})
+	} else {
+		pag, err = pagination.Paginate(tx, q, &items)
+	}
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -233,7 +245,7 @@ func (h *Handler) generateSummaryNow(ctx context.Context, refID, lang string) (*
 		return nil, errors.New("no enabled AI provider")
 	}
 
-	summaryText, err := callAI(provider, title, text, lang)
+	summaryText, err := callAI(ctx, provider, title, text, lang)
 	if err != nil {
 		return nil, err
 	}
@@ -418,7 +430,7 @@ func (h *Handler) fetchModelsList(c *gin.Context) {
 					if provider.Type == "" {
 						provider.Type = p.Type
 					}
-					if provider.APIKey == "" {
+					if provider.APIKey == "" || configs.IsMaskedSecret(provider.APIKey) {
 						provider.APIKey = p.APIKey
 					}
 					if provider.Endpoint == "" {
@@ -444,7 +456,7 @@ func (h *Handler) fetchModelsList(c *gin.Context) {
 		return
 	}
 
-	fetchedModels, err := fetchModelsFromProvider(provider)
+	fetchedModels, err := fetchModelsFromProvider(c.Request.Context(), provider)
 	if err != nil {
 		fallback := modelsFromProvider(provider)
 		response.OK(c, gin.H{
@@ -469,6 +481,9 @@ func (h *Handler) testProviderConnection(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
+	if configs.IsMaskedSecret(dto.APIKey) {
+		dto.APIKey = "" // the dashboard echoes the masked key; use the stored one
+	}
 	if dto.ProviderID != "" && (dto.Type == "" || dto.APIKey == "" || dto.Model == "") {
 		if cfg, err := h.svc.cfgSvc.Get(); err == nil {
 			for _, p := range cfg.AI.Providers {
@@ -503,7 +518,7 @@ func (h *Handler) testProviderConnection(c *gin.Context) {
 		Enabled:      true,
 	}
 
-	result, err := callAI(&provider, "Connection Test", "Say OK", "English")
+	result, err := callAI(c.Request.Context(), &provider, "Connection Test", "Say OK", "English")
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -589,7 +604,7 @@ func (h *Handler) testCommentReview(c *gin.Context) {
 
 	if reviewType == "score" {
 		systemPrompt, prompt := buildCommentScorePrompt(text)
-		raw, err := callAIWithSystemPrompt(provider, systemPrompt, prompt)
+		raw, err := callAIWithSystemPrompt(c.Request.Context(), provider, systemPrompt, prompt)
 		if err != nil {
 			response.InternalError(c, err)
 			return
@@ -625,7 +640,7 @@ func (h *Handler) testCommentReview(c *gin.Context) {
 	}
 
 	systemPrompt, prompt := buildCommentSpamPrompt(text)
-	raw, err := callAIWithSystemPrompt(provider, systemPrompt, prompt)
+	raw, err := callAIWithSystemPrompt(c.Request.Context(), provider, systemPrompt, prompt)
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -15,6 +15,7 @@ import (
 	anthropicclient "github.com/anthropics/anthropic-sdk-go"
 	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
 	appcfg "github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	openaiclient "github.com/openai/openai-go/v2"
 	openaioption "github.com/openai/openai-go/v2/option"
 	jetai "go.jetify.com/ai"
@@ -44,23 +45,23 @@ func normalizeProviderType(raw string) string {
 }
 
 // callAI calls the AI provider to generate a summary.
-func callAI(provider *appcfg.AIProvider, title, text, lang string) (string, error) {
+func callAI(ctx context.Context, provider *appcfg.AIProvider, title, text, lang string) (string, error) {
 	_ = title
 	systemPrompt, prompt := buildSummaryPrompt(lang, text)
-	raw, err := callAIWithSystemPrompt(provider, systemPrompt, prompt)
+	raw, err := callAIWithSystemPrompt(ctx, provider, systemPrompt, prompt)
 	if err != nil {
 		return "", err
 	}
 	return extractSummaryFromAIResponse(raw)
 }
 
-func callAIWithPrompt(provider *appcfg.AIProvider, prompt string) (string, error) {
-	return callAIWithSystemPrompt(provider, "", prompt)
+func callAIWithPrompt(ctx context.Context, provider *appcfg.AIProvider, prompt string) (string, error) {
+	return callAIWithSystemPrompt(ctx, provider, "", prompt)
 }
 
-func callAIWithSystemPrompt(provider *appcfg.AIProvider, systemPrompt, prompt string) (string, error) {
+func callAIWithSystemPrompt(ctx context.Context, provider *appcfg.AIProvider, systemPrompt, prompt string) (string, error) {
 	if isOpenAICompatibleProviderType(provider.Type) {
-		return callOpenAICompatibleChatCompletions(provider, systemPrompt, prompt)
+		return callOpenAICompatibleChatCompletions(ctx, provider, systemPrompt, prompt)
 	}
 
 	model, _, err := buildLanguageModel(provider)
@@ -68,7 +69,7 @@ func callAIWithSystemPrompt(provider *appcfg.AIProvider, systemPrompt, prompt st
 		return "", err
 	}
 	resp, err := jetai.GenerateText(
-		context.Background(),
+		ctx,
 		buildAIPromptMessages(systemPrompt, prompt),
 		jetai.WithModel(model),
 		jetai.WithMaxOutputTokens(300),
@@ -80,12 +81,12 @@ func callAIWithSystemPrompt(provider *appcfg.AIProvider, systemPrompt, prompt st
 }
 
 // callAIStream calls AI with streaming and invokes onToken for each chunk.
-func callAIStream(provider *appcfg.AIProvider, title, text, lang string, onToken func(string)) (string, error) {
+func callAIStream(ctx context.Context, provider *appcfg.AIProvider, title, text, lang string, onToken func(string)) (string, error) {
 	_ = title
 	systemPrompt, prompt := buildSummaryStreamPrompt(lang, text)
 
 	if isOpenAICompatibleProviderType(provider.Type) {
-		return callOpenAICompatibleChatCompletionsStream(provider, systemPrompt, prompt, onToken)
+		return callOpenAICompatibleChatCompletionsStream(ctx, provider, systemPrompt, prompt, onToken)
 	}
 
 	model, streamEnabled, err := buildLanguageModel(provider)
@@ -94,7 +95,7 @@ func callAIStream(provider *appcfg.AIProvider, title, text, lang string, onToken
 	}
 
 	if !streamEnabled {
-		result, err := callAIWithSystemPrompt(provider, systemPrompt, prompt)
+		result, err := callAIWithSystemPrompt(ctx, provider, systemPrompt, prompt)
 		if err != nil {
 			return "", err
 		}
@@ -105,7 +106,7 @@ func callAIStream(provider *appcfg.AIProvider, title, text, lang string, onToken
 	}
 
 	streamResp, err := jetai.StreamText(
-		context.Background(),
+		ctx,
 		buildAIPromptMessages(systemPrompt, prompt),
 		jetai.WithModel(model),
 		jetai.WithMaxOutputTokens(300),
@@ -138,7 +139,7 @@ func callAIStream(provider *appcfg.AIProvider, title, text, lang string, onToken
 	return result, nil
 }
 
-func callOpenAICompatibleChatCompletions(provider *appcfg.AIProvider, systemPrompt, prompt string) (string, error) {
+func callOpenAICompatibleChatCompletions(ctx context.Context, provider *appcfg.AIProvider, systemPrompt, prompt string) (string, error) {
 	if provider == nil {
 		return "", errors.New("AI provider is nil")
 	}
@@ -170,12 +171,13 @@ func callOpenAICompatibleChatCompletions(provider *appcfg.AIProvider, systemProm
 		"max_tokens": 300,
 	})
 
-	req, err := http.NewRequest(http.MethodPost, endpoint+"/v1/chat/completions", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v1/chat/completions", bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(provider.APIKey))
 	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(req)
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
@@ -218,7 +220,7 @@ func callOpenAICompatibleChatCompletions(provider *appcfg.AIProvider, systemProm
 	return result.Choices[0].Message.Content, nil
 }
 
-func callOpenAICompatibleChatCompletionsStream(provider *appcfg.AIProvider, systemPrompt, prompt string, onToken func(string)) (string, error) {
+func callOpenAICompatibleChatCompletionsStream(ctx context.Context, provider *appcfg.AIProvider, systemPrompt, prompt string, onToken func(string)) (string, error) {
 	if provider == nil {
 		return "", errors.New("AI provider is nil")
 	}
@@ -251,12 +253,13 @@ func callOpenAICompatibleChatCompletionsStream(provider *appcfg.AIProvider, syst
 		"stream":     true,
 	})
 
-	req, err := http.NewRequest(http.MethodPost, endpoint+"/v1/chat/completions", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v1/chat/completions", bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(provider.APIKey))
 	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(req)
 	req.Header.Set("Accept", "text/event-stream")
 
 	client := &http.Client{Timeout: 60 * time.Second}
@@ -416,6 +419,9 @@ func extractTextFromAIResponse(resp *jetapi.Response) (string, error) {
 	return text, nil
 }
 
+// tracedHTTPClient forwards the trace ID of each SDK request as X-Request-ID.
+var tracedHTTPClient = &http.Client{Transport: tracing.Transport(nil)}
+
 func buildLanguageModel(provider *appcfg.AIProvider) (jetapi.LanguageModel, bool, error) {
 	if provider == nil {
 		return nil, false, errors.New("AI provider is nil")
@@ -438,6 +444,7 @@ func buildLanguageModel(provider *appcfg.AIProvider) (jetapi.LanguageModel, bool
 		opts := []anthropicoption.RequestOption{
 			anthropicoption.WithAPIKey(apiKey),
 			anthropicoption.WithMaxRetries(0),
+			anthropicoption.WithHTTPClient(tracedHTTPClient),
 		}
 		if endpoint != "" {
 			opts = append(opts, anthropicoption.WithBaseURL(strings.TrimRight(endpoint, "/")))
@@ -455,6 +462,7 @@ func buildLanguageModel(provider *appcfg.AIProvider) (jetapi.LanguageModel, bool
 	opts := []openaioption.RequestOption{
 		openaioption.WithAPIKey(apiKey),
 		openaioption.WithMaxRetries(0),
+		openaioption.WithHTTPClient(tracedHTTPClient),
 	}
 	if normalized := normalizeOpenAIBaseURL(endpoint); normalized != "" {
 		opts = append(opts, openaioption.WithBaseURL(normalized))
@@ -567,7 +575,7 @@ func modelsFromProvider(provider appcfg.AIProvider) []modelInfo {
 	return models
 }
 
-func fetchModelsFromProvider(provider appcfg.AIProvider) ([]modelInfo, error) {
+func fetchModelsFromProvider(ctx context.Context, provider appcfg.AIProvider) ([]modelInfo, error) {
 	switch {
 	case isAnthropicProviderType(provider.Type):
 		endpoint := normalizeAnthropicModelsEndpoint(provider.Endpoint)
@@ -577,26 +585,26 @@ func fetchModelsFromProvider(provider appcfg.AIProvider) ([]modelInfo, error) {
 			"content-type":      "application/json",
 			"accept":            "application/json",
 		}
-		return fetchModelsByEndpoint(endpoint, headers, parseAnthropicModels)
+		return fetchModelsByEndpoint(ctx, endpoint, headers, parseAnthropicModels)
 	case isOpenRouterProviderType(provider.Type):
 		endpoint := normalizeOpenRouterModelsEndpoint(provider.Endpoint)
 		headers := map[string]string{
 			"authorization": "Bearer " + strings.TrimSpace(provider.APIKey),
 			"accept":        "application/json",
 		}
-		return fetchModelsByEndpoint(endpoint, headers, parseOpenAIStyleModels)
+		return fetchModelsByEndpoint(ctx, endpoint, headers, parseOpenAIStyleModels)
 	default:
 		endpoint := normalizeOpenAIModelsEndpoint(provider.Endpoint)
 		headers := map[string]string{
 			"authorization": "Bearer " + strings.TrimSpace(provider.APIKey),
 			"accept":        "application/json",
 		}
-		return fetchModelsByEndpoint(endpoint, headers, parseOpenAIStyleModels)
+		return fetchModelsByEndpoint(ctx, endpoint, headers, parseOpenAIStyleModels)
 	}
 }
 
-func fetchModelsByEndpoint(endpoint string, headers map[string]string, parser func([]byte) ([]modelInfo, error)) ([]modelInfo, error) {
-	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+func fetchModelsByEndpoint(ctx context.Context, endpoint string, headers map[string]string, parser func([]byte) ([]modelInfo, error)) ([]modelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -606,6 +614,7 @@ func fetchModelsByEndpoint(endpoint string, headers map[string]string, parser fu
 		}
 		req.Header.Set(k, v)
 	}
+	tracing.Inject(req)
 
 	client := &http.Client{Timeout: 20 * time.Second}
 	resp, err := client.Do(req)
@@ -0,0 +1,38 @@
+package ai
+
+import (
+	"context"
+	"errors"
+
+	appcfg "github.com/mx-space/core/internal/config"
+)
+
+// ErrNoProvider is returned when no enabled AI provider is configured.
+var ErrNoProvider = errors.New("no enabled AI provider")
+
+// Summarize summarizes text in lang with the summary model assignment, the same
+// way article summaries are generated. An empty lang falls back to the configured
+// target language. Used by serverless snippets.
+func Summarize(ctx context.Context, cfg appcfg.AIConfig, text, lang string) (string, error) {
+	if lang == "" {
+		lang = cfg.AISummaryTargetLanguage
+	}
+	if lang == "" {
+		lang = "zh-CN"
+	}
+	provider := selectAIProvider(cfg, cfg.SummaryModel)
+	if provider == nil {
+		return "", ErrNoProvider
+	}
+	return callAI(ctx, provider, "", text, lang)
+}
+
+// Complete sends a single prompt to the first enabled provider and returns the
+// reply text. Used by serverless snippets.
+func Complete(ctx context.Context, cfg appcfg.AIConfig, systemPrompt, prompt string) (string, error) {
+	provider := selectAIProvider(cfg, nil)
+	if provider == nil {
+		return "", ErrNoProvider
+	}
+	return callAIWithSystemPrompt(ctx, provider, systemPrompt, prompt)
+}
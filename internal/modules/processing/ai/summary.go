@@ -3,19 +3,35 @@ package ai
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/pkg/taskqueue"
+	"github.com/mx-space/core/internal/pkg/tracing"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 const (
 	TaskTypeSummary = "ai:summary"
+
+	// summaryConcurrency caps the summary tasks each process runs at once.
+	summaryConcurrency = 2
+
+	// Progress milestones of a summary task. Generation fills the range
+	// between provider called and persisting, by the streamed length against
+	// summaryExpectedRunes.
+	summaryProgressFetched    = 10
+	summaryProgressCalling    = 20
+	summaryProgressPersisting = 90
+	summaryExpectedRunes      = summaryMaxWords * 2
 )
 
 var errSummaryArticleNotFound = errors.New("article not found or empty")
@@ -146,17 +162,7 @@ func (s *Service) EnqueueSummary(ctx context.Context, refID, refType, title, lan
 	}
 
 	payload := SummaryPayload{RefID: refID, RefType: refType, Title: title, Lang: lang}
-	task, err := s.taskSvc.Enqueue(ctx, TaskTypeSummary, payload, summaryKey(refID, lang), refID)
-	if err != nil {
-		return nil, err
-	}
-
-	// Execute immediately in a goroutine (in production use a worker pool)
-	if task.Status == taskqueue.TaskPending {
-		go s.executeSummary(context.Background(), task.ID, payload)
-	}
-
-	return task, nil
+	return s.taskSvc.Enqueue(ctx, TaskTypeSummary, payload, summaryKey(refID, lang), refID)
 }
 
 // GenerateSummaryStream generates a summary via SSE streaming.
@@ -201,7 +207,7 @@ func (s *Service) GenerateSummaryStream(c *gin.Context, articleID, lang string)
 		return
 	}
 
-	rawSummary, err := callAIStream(provider, title, text, lang, func(token string) {
+	rawSummary, err := callAIStream(c.Request.Context(), provider, title, text, lang, func(token string) {
 		tokenJSON, _ := jsonMarshal(token)
 		sendEvent("token", string(tokenJSON))
 	})
@@ -229,32 +235,54 @@ func (s *Service) GenerateSummaryStream(c *gin.Context, articleID, lang string)
 	sendEvent("done", "null")
 }
 
-func (s *Service) executeSummary(ctx context.Context, taskID string, payload SummaryPayload) {
-	s.taskSvc.UpdateStatus(ctx, taskID, taskqueue.TaskRunning, nil, "")
+// runSummaryTask is the task queue handler for TaskTypeSummary.
+func (s *Service) runSummaryTask(ctx context.Context, task *taskqueue.Task) (interface{}, error) {
+	var payload SummaryPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid task payload: %w", err)
+	}
+
+	// The task keeps the trace ID of the request that enqueued it, so every
+	// failure is logged with it as well.
+	logger := tracing.GetLogger(ctx).Named("AIService")
+	fail := func(reason string, err error) (interface{}, error) {
+		logger.Warn("AI 摘要生成失败", zap.String("task_id", task.ID), zap.String("ref_id", payload.RefID),
+			zap.String("reason", reason), zap.Error(err))
+		return nil, errors.New(reason)
+	}
 
 	cfg, err := s.cfgSvc.Get()
 	if err != nil || !cfg.AI.EnableSummary {
-		s.taskSvc.UpdateStatus(ctx, taskID, taskqueue.TaskFailed, nil, "AI summary is disabled")
-		return
+		return fail("AI summary is disabled", err)
 	}
 
 	provider := selectAIProvider(cfg.AI, cfg.AI.SummaryModel)
 	if provider == nil {
-		s.taskSvc.UpdateStatus(ctx, taskID, taskqueue.TaskFailed, nil, "no enabled AI provider")
-		return
+		return fail("no enabled AI provider", nil)
 	}
 
 	text, err := s.fetchArticleText(payload.RefID, payload.RefType)
 	if err != nil || text == "" {
-		s.taskSvc.UpdateStatus(ctx, taskID, taskqueue.TaskFailed, nil, "article not found or empty")
-		return
+		return fail("article not found or empty", err)
 	}
+	s.reportProgress(ctx, task.ID, summaryProgressFetched, "article fetched")
 
-	summary, err := callAI(provider, payload.Title, text, payload.Lang)
+	started := time.Now()
+	s.reportProgress(ctx, task.ID, summaryProgressCalling, "calling AI provider")
+	streamed := 0
+	raw, err := callAIStream(ctx, provider, payload.Title, text, payload.Lang, func(token string) {
+		streamed += utf8.RuneCountInString(token)
+		share := min(streamed, summaryExpectedRunes) * (summaryProgressPersisting - summaryProgressCalling) / summaryExpectedRunes
+		s.reportProgress(ctx, task.ID, summaryProgressCalling+share, "generating summary")
+	})
 	if err != nil {
-		s.taskSvc.UpdateStatus(ctx, taskID, taskqueue.TaskFailed, nil, err.Error())
-		return
+		return fail(err.Error(), err)
 	}
+	summary, err := extractSummaryFromAIResponse(raw)
+	if err != nil {
+		return fail(err.Error(), err)
+	}
+	s.reportProgress(ctx, task.ID, summaryProgressPersisting, "saving summary")
 
 	hash := hashKey(payload.RefID, payload.Lang)
 	summaryModel := models.AISummaryModel{
@@ -265,7 +293,17 @@ func (s *Service) executeSummary(ctx context.Context, taskID string, payload Sum
 	}
 	s.db.Where("hash = ?", hash).Assign(summaryModel).FirstOrCreate(&summaryModel)
 
-	s.taskSvc.UpdateStatus(ctx, taskID, taskqueue.TaskCompleted, gin.H{"summary": summary}, "")
+	logger.Info("AI 摘要生成完成", zap.String("task_id", task.ID), zap.String("ref_id", payload.RefID),
+		zap.Int64("latency_ms", time.Since(started).Milliseconds()))
+	return gin.H{"summary": summary}, nil
+}
+
+// reportProgress records task progress. Failures only cost the progress
+// display, so they are logged at debug level.
+func (s *Service) reportProgress(ctx context.Context, taskID string, progress int, message string) {
+	if err := s.taskSvc.UpdateProgress(ctx, taskID, progress, message); err != nil {
+		tracing.GetLogger(ctx).Debug("update task progress failed", zap.String("task_id", taskID), zap.Error(err))
+	}
 }
 
 // fetchArticleInfo returns (refType, title, text) for an article by ID.
@@ -1,7 +1,6 @@
 package ai
 
 import (
-	"encoding/json"
 	"errors"
 	"strconv"
 	"strings"
@@ -15,7 +14,10 @@ import (
 
 // GET /ai/tasks  [auth]
 func (h *Handler) listTasks(c *gin.Context) {
-	q := pagination.FromContext(c)
+	q, ok := pagination.FromContextWithCursor(c)
+	if !ok {
+		return
+	}
 	taskType := c.Query("type")
 	statusStr := c.Query("status")
 
@@ -30,6 +32,16 @@ func (h *Handler) listTasks(c *gin.Context) {
 		statusPtr = &s
 	}
 
+	if q.Cursor != nil {
+		tasks, pag, err := h.svc.taskSvc.ListAfter(c.Request.Context(), q, taskTypePtr, statusPtr)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		response.CursorPaged(c, tasks, pag)
+		return
+	}
+
 	tasks, total, err := h.svc.taskSvc.List(c.Request.Context(), q.Page, q.Size, taskTypePtr, statusPtr)
 	if err != nil {
 		response.InternalError(c, err)
@@ -129,13 +141,7 @@ func (h *Handler) retryTask(c *gin.Context) {
 		return
 	}
 
-	var payload SummaryPayload
-	if err := json.Unmarshal(task.Payload, &payload); err != nil {
-		response.BadRequest(c, "invalid task payload")
-		return
-	}
-
-	newTask, err := h.svc.EnqueueSummary(c.Request.Context(), payload.RefID, payload.RefType, payload.Title, payload.Lang)
+	newTask, err := h.svc.taskSvc.Retry(c.Request.Context(), task)
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -184,23 +190,18 @@ func (h *Handler) getSummaryTask(c *gin.Context) {
 		return
 	}
 
-	dedupKey := refID + ":" + lang
-	tasks, _, err := h.svc.taskSvc.List(c.Request.Context(), 1, 100, strPtr(TaskTypeSummary), nil)
+	task, err := h.svc.taskSvc.GetByDedupKey(c.Request.Context(), TaskTypeSummary, refID+":"+lang)
 	if err != nil {
 		response.InternalError(c, err)
 		return
 	}
-	for _, t := range tasks {
-		if t.DedupKey == dedupKey {
-			response.OK(c, t)
-			return
-		}
+	if task == nil {
+		response.NotFoundMsg(c, "AI 任务不存在")
+		return
 	}
-	response.NotFoundMsg(c, "AI 任务不存在")
+	response.OK(c, task)
 }
 
-func strPtr(s string) *string { return &s }
-
 // GET /ai/tasks/group/:groupKey  [auth]
 func (h *Handler) getTasksByGroup(c *gin.Context) {
 	groupKey := c.Param("groupKey")
@@ -213,33 +214,14 @@ func (h *Handler) getTasksByGroup(c *gin.Context) {
 	}
 	q := pagination.FromContext(c)
 
-	all, _, err := h.svc.taskSvc.List(c.Request.Context(), 1, 1000, nil, nil)
+	tasks, total, err := h.svc.taskSvc.ListByGroup(c.Request.Context(), groupKey, q.Page, q.Size)
 	if err != nil {
 		response.InternalError(c, err)
 		return
 	}
 
-	var filtered []*taskqueue.Task
-	for _, t := range all {
-		if t.GroupKey == groupKey {
-			filtered = append(filtered, t)
-		}
-	}
-
-	total := int64(len(filtered))
-	start := (q.Page - 1) * q.Size
-	end := start + q.Size
-	if start >= len(filtered) {
-		filtered = []*taskqueue.Task{}
-	} else {
-		if end > len(filtered) {
-			end = len(filtered)
-		}
-		filtered = filtered[start:end]
-	}
-
 	totalPages := int((total + int64(q.Size) - 1) / int64(q.Size))
-	response.Paged(c, filtered, response.Pagination{
+	response.Paged(c, tasks, response.Pagination{
 		Total:       total,
 		CurrentPage: q.Page,
 		TotalPage:   totalPages,
@@ -259,28 +241,11 @@ func (h *Handler) cancelTasksByGroup(c *gin.Context) {
 		return
 	}
 
-	all, _, err := h.svc.taskSvc.List(c.Request.Context(), 1, 1000, nil, nil)
+	cancelled, err := h.svc.taskSvc.CancelGroup(c.Request.Context(), groupKey)
 	if err != nil {
 		response.InternalError(c, err)
 		return
 	}
 
-	cancelled := 0
-	for _, t := range all {
-		if t.GroupKey != groupKey {
-			continue
-		}
-		switch t.Status {
-		case taskqueue.TaskPending:
-			if err := h.svc.taskSvc.Cancel(c.Request.Context(), t.ID); err == nil {
-				cancelled++
-			}
-		case taskqueue.TaskRunning:
-			if err := h.svc.taskSvc.UpdateStatus(c.Request.Context(), t.ID, taskqueue.TaskCancelled, nil, "cancelled by group"); err == nil {
-				cancelled++
-			}
-		}
-	}
-
 	response.OK(c, gin.H{"cancelled": cancelled})
 }
@@ -0,0 +1,266 @@
+// Package imagemeta fills in the width, height, type and accent color of the
+// images referenced by post and note markdown.
+package imagemeta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/tracing"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultConcurrency = 4
+	fetchTimeout       = 15 * time.Second
+	maxImageBytes      = 10 << 20
+	// maxImagePixels bounds width*height so a small, highly compressed file
+	// cannot expand into a huge bitmap when decoded.
+	maxImagePixels = 40_000_000
+	// accentSamples bounds how many pixels are averaged for the accent color.
+	accentSamples = 64 * 64
+)
+
+var (
+	markdownImagePattern = regexp.MustCompile(`!\[[^\]]*\]\(\s*<?([^\s)>]+)>?(?:\s+["'][^"']*["'])?\s*\)`)
+	htmlImagePattern     = regexp.MustCompile(`(?i)<img\b[^>]*?\bsrc\s*=\s*["']([^"']+)["']`)
+)
+
+// Service extracts image metadata for posts and notes.
+type Service struct {
+	db          *gorm.DB
+	logger      *zap.Logger
+	client      *http.Client
+	concurrency int
+}
+
+// Option configures a Service.
+type Option func(*Service)
+
+// WithLogger sets the logger for the image metadata service.
+func WithLogger(l *zap.Logger) Option {
+	return func(s *Service) {
+		if l != nil {
+			s.logger = l.Named("ImageMetaService")
+		}
+	}
+}
+
+// WithConcurrency sets how many images are fetched at once.
+func WithConcurrency(n int) Option {
+	return func(s *Service) {
+		if n > 0 {
+			s.concurrency = n
+		}
+	}
+}
+
+func NewService(db *gorm.DB, opts ...Option) *Service {
+	s := &Service{
+		db:          db,
+		logger:      zap.NewNop(),
+		client:      &http.Client{Timeout: fetchTimeout, Transport: tracing.Transport(nil)},
+		concurrency: defaultConcurrency,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// ExtractURLs returns the distinct http(s) image URLs referenced by markdown
+// image syntax or <img> tags, in order of appearance. data: URIs are skipped.
+func ExtractURLs(text string) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(matches [][]string) {
+		for _, m := range matches {
+			u := strings.TrimSpace(m[1])
+			lower := strings.ToLower(u)
+			if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+				continue
+			}
+			if !seen[u] {
+				seen[u] = true
+				out = append(out, u)
+			}
+		}
+	}
+	add(markdownImagePattern.FindAllStringSubmatch(text, -1))
+	add(htmlImagePattern.FindAllStringSubmatch(text, -1))
+	return out
+}
+
+// Enqueue refreshes the images of the row in the background. model is a
+// pointer to the row's model type, e.g. &models.PostModel{}.
+func (s *Service) Enqueue(ctx context.Context, model interface{}, id string) {
+	if s == nil {
+		return
+	}
+	ctx = tracing.Detach(ctx)
+	go func() {
+		if _, err := s.Refresh(ctx, model, id, false); err != nil {
+			tracing.GetLogger(ctx).Named("ImageMetaService").Warn("提取图片信息失败", zap.String("id", id), zap.Error(err))
+		}
+	}()
+}
+
+// Refresh rebuilds the Images of the row from the images in its text. Images
+// already carrying dimensions are reused unless force is set. It returns nil
+// when the row does not exist.
+func (s *Service) Refresh(ctx context.Context, model interface{}, id string, force bool) ([]models.Image, error) {
+	var row struct {
+		Text   string
+		Images *string
+	}
+	res := s.db.Model(model).Select("text", "images").Where("id = ?", id).Limit(1).Find(&row)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var existing []models.Image
+	if row.Images != nil && *row.Images != "" {
+		_ = json.Unmarshal([]byte(*row.Images), &existing)
+	}
+	known := make(map[string]models.Image, len(existing))
+	for _, img := range existing {
+		known[img.Src] = img
+	}
+	urls := ExtractURLs(row.Text)
+	images := make([]models.Image, len(urls))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.concurrency)
+	for i, u := range urls {
+		if prev, ok := known[u]; ok && !force && prev.Width > 0 && prev.Height > 0 {
+			images[i] = prev
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, u string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			img, err := s.inspect(ctx, u)
+			if err != nil {
+				s.logger.Debug("读取图片信息失败", zap.String("src", u), zap.Error(err))
+				img = models.Image{Src: u}
+				if prev, ok := known[u]; ok {
+					img = prev
+				}
+			}
+			images[i] = img
+		}(i, u)
+	}
+	wg.Wait()
+
+	encoded, err := json.Marshal(images)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(model).Where("id = ?", id).
+		UpdateColumn("images", string(encoded)).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// inspect downloads src and reads its dimensions, type and accent color.
+func (s *Service) inspect(ctx context.Context, src string) (models.Image, error) {
+	img := models.Image{Src: src}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return img, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return img, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return img, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxImageBytes {
+		return img, errors.New("image too large")
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return img, err
+	}
+	if len(data) > maxImageBytes {
+		return img, errors.New("image too large")
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return img, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return img, fmt.Errorf("image dimensions %dx%d exceed the limit", cfg.Width, cfg.Height)
+	}
+	img.Width, img.Height = cfg.Width, cfg.Height
+	img.Type = mimeType(format, resp.Header.Get("Content-Type"))
+	if decoded, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+		img.Accent = accentColor(decoded)
+	}
+	return img, nil
+}
+
+func mimeType(format, contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && strings.HasPrefix(mediaType, "image/") {
+		return mediaType
+	}
+	if format == "" {
+		return ""
+	}
+	return "image/" + format
+}
+
+// accentColor averages a grid of at most accentSamples pixels of img into a
+// #rrggbb hex color.
+func accentColor(img image.Image) string {
+	b := img.Bounds()
+	if b.Empty() {
+		return ""
+	}
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > accentSamples {
+		step++
+	}
+	var r, g, bl, n uint64
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			cr, cg, cb, ca := img.At(x, y).RGBA()
+			if ca == 0 {
+				continue
+			}
+			r += uint64(cr >> 8)
+			g += uint64(cg >> 8)
+			bl += uint64(cb >> 8)
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r/n, g/n, bl/n)
+}
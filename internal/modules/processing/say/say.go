@@ -2,6 +2,8 @@ package say
 
 import (
 	"errors"
+	"math/rand/v2"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,16 +14,27 @@ import (
 	"gorm.io/gorm"
 )
 
+// CreateSayDTO also takes the legacy content field sent by the old admin
+// panel; text wins when both are set.
 type CreateSayDTO struct {
-	Text   string `json:"text"   binding:"required"`
-	Source string `json:"source"`
-	Author string `json:"author"`
+	Text    string `json:"text"`
+	Content string `json:"content"`
+	Source  string `json:"source"`
+	Author  string `json:"author"`
+}
+
+func (dto *CreateSayDTO) text() string {
+	if strings.TrimSpace(dto.Text) != "" {
+		return dto.Text
+	}
+	return dto.Content
 }
 
 type UpdateSayDTO struct {
-	Text   *string `json:"text"`
-	Source *string `json:"source"`
-	Author *string `json:"author"`
+	Text    *string `json:"text"`
+	Content *string `json:"content"`
+	Source  *string `json:"source"`
+	Author  *string `json:"author"`
 }
 
 type sayResponse struct {
@@ -41,12 +54,23 @@ func toResponse(s *models.SayModel) sayResponse {
 	}
 }
 
-type Service struct{ db *gorm.DB }
+type Service struct {
+	db       *gorm.DB
+	onCreate func(*models.SayModel)
+}
 
 func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 
-func (s *Service) List(q pagination.Query) ([]models.SayModel, response.Pagination, error) {
+// SetOnCreate registers a callback run in the background after a say is
+// created.
+func (s *Service) SetOnCreate(fn func(*models.SayModel)) { s.onCreate = fn }
+
+// List pages says newest first, limited to one author when author is set.
+func (s *Service) List(q pagination.Query, author string) ([]models.SayModel, response.Pagination, error) {
 	tx := s.db.Model(&models.SayModel{}).Order("created_at DESC")
+	if author != "" {
+		tx = tx.Where("author = ?", author)
+	}
 	var items []models.SayModel
 	pag, err := pagination.Paginate(tx, q, &items)
 	return items, pag, err
@@ -58,9 +82,19 @@ func (s *Service) ListAll() ([]models.SayModel, error) {
 	return items, err
 }
 
+// Random picks one say at a random offset, avoiding a full-table ORDER BY
+// RAND(). It returns nil when there are none.
 func (s *Service) Random() (*models.SayModel, error) {
+	var total int64
+	if err := s.db.Model(&models.SayModel{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, nil
+	}
 	var item models.SayModel
-	if err := s.db.Order("RAND()").First(&item).Error; err != nil {
+	offset := rand.IntN(int(total))
+	if err := s.db.Order("created_at DESC").Offset(offset).Limit(1).Take(&item).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -81,8 +115,14 @@ func (s *Service) GetByID(id string) (*models.SayModel, error) {
 }
 
 func (s *Service) Create(dto *CreateSayDTO) (*models.SayModel, error) {
-	item := models.SayModel{Text: dto.Text, Source: dto.Source, Author: dto.Author}
-	return &item, s.db.Create(&item).Error
+	item := models.SayModel{Text: dto.text(), Source: dto.Source, Author: dto.Author}
+	if err := s.db.Create(&item).Error; err != nil {
+		return nil, err
+	}
+	if s.onCreate != nil {
+		go s.onCreate(&item)
+	}
+	return &item, nil
 }
 
 func (s *Service) Update(id string, dto *UpdateSayDTO) (*models.SayModel, error) {
@@ -93,6 +133,8 @@ func (s *Service) Update(id string, dto *UpdateSayDTO) (*models.SayModel, error)
 	updates := map[string]interface{}{}
 	if dto.Text != nil {
 		updates["text"] = *dto.Text
+	} else if dto.Content != nil {
+		updates["text"] = *dto.Content
 	}
 	if dto.Source != nil {
 		updates["source"] = *dto.Source
@@ -103,8 +145,10 @@ func (s *Service) Update(id string, dto *UpdateSayDTO) (*models.SayModel, error)
 	return item, s.db.Model(item).Updates(updates).Error
 }
 
-func (s *Service) Delete(id string) error {
-	return s.db.Delete(&models.SayModel{}, "id = ?", id).Error
+// Delete reports whether a say was removed.
+func (s *Service) Delete(id string) (bool, error) {
+	res := s.db.Delete(&models.SayModel{}, "id = ?", id)
+	return res.RowsAffected > 0, res.Error
 }
 
 type Handler struct {
@@ -130,7 +174,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 
 func (h *Handler) list(c *gin.Context) {
 	q := pagination.FromContext(c)
-	items, pag, err := h.svc.List(q)
+	items, pag, err := h.svc.List(q, strings.TrimSpace(c.Query("author")))
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -187,6 +231,10 @@ func (h *Handler) create(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
+	if strings.TrimSpace(dto.text()) == "" {
+		response.BadRequest(c, "内容不能为空")
+		return
+	}
 	item, err := h.svc.Create(&dto)
 	if err != nil {
 		response.InternalError(c, err)
@@ -221,11 +269,12 @@ func (h *Handler) update(c *gin.Context) {
 
 func (h *Handler) delete(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.svc.Delete(id); err != nil {
+	deleted, err := h.svc.Delete(id)
+	if err != nil {
 		response.InternalError(c, err)
 		return
 	}
-	if h.hub != nil {
+	if deleted && h.hub != nil {
 		h.hub.BroadcastPublic("SAY_DELETE", id)
 		h.hub.BroadcastAdmin("SAY_DELETE", id)
 	}
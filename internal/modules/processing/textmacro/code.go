@@ -0,0 +1,126 @@
+package textmacro
+
+import "strings"
+
+// mapProse applies fn to the parts of markdown text outside fenced code
+// blocks and inline code spans, so macro syntax shown as code is kept as
+// written. An unclosed fence runs to the end of the text, as in CommonMark.
+func mapProse(text string, fn func(string) string) string {
+	var out, prose strings.Builder
+	flush := func() {
+		if prose.Len() > 0 {
+			out.WriteString(mapInlineProse(prose.String(), fn))
+			prose.Reset()
+		}
+	}
+
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if fence != "" {
+			out.WriteString(line)
+			if closesFence(line, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if f := openingFence(line); f != "" {
+			flush()
+			fence = f
+			out.WriteString(line)
+			continue
+		}
+		prose.WriteString(line)
+	}
+	flush()
+	return out.String()
+}
+
+// openingFence returns the ``` or ~~~ run opening a fenced code block on
+// line, or "" when line does not open one.
+func openingFence(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || trimmed == "" {
+		return ""
+	}
+	c := trimmed[0]
+	if c != '`' && c != '~' {
+		return ""
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == c {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	// A backtick fence's info string may not contain backticks.
+	if c == '`' && strings.ContainsRune(trimmed[n:], '`') {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+// closesFence reports whether line closes a block opened with fence: the
+// same character, at least as many times, and nothing else on the line.
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	trimmed = strings.TrimRight(trimmed, " \t\r\n")
+	if len(trimmed) < len(fence) {
+		return false
+	}
+	return strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// mapInlineProse applies fn to text outside inline code spans. A span opens
+// with a run of backticks and closes with the next run of the same length;
+// a run without a match is literal text.
+func mapInlineProse(text string, fn func(string) string) string {
+	var out strings.Builder
+	start := 0 // beginning of the prose not yet written
+	for i := 0; i < len(text); {
+		if text[i] != '`' {
+			i++
+			continue
+		}
+		n := backtickRun(text, i)
+		end := closingRun(text, i+n, n)
+		if end < 0 {
+			i += n
+			continue
+		}
+		out.WriteString(fn(text[start:i]))
+		out.WriteString(text[i : end+n])
+		i = end + n
+		start = i
+	}
+	out.WriteString(fn(text[start:]))
+	return out.String()
+}
+
+func backtickRun(text string, i int) int {
+	n := 0
+	for i+n < len(text) && text[i+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// closingRun returns the index of the next run of exactly n backticks at or
+// after from, or -1.
+func closingRun(text string, from, n int) int {
+	for i := from; i < len(text); {
+		if text[i] != '`' {
+			i++
+			continue
+		}
+		m := backtickRun(text, i)
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
@@ -0,0 +1,463 @@
+package textmacro
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// exprPattern matches {{ ... }} expressions in text.
+var exprPattern = regexp.MustCompile(`\{\{\s*(.*?)\s*\}\}`)
+
+// defaultDateLayout is used by the format filter when no layout is given.
+const defaultDateLayout = "YYYY-MM-DD"
+
+// maxExprLength bounds a single {{ }} expression so hostile input cannot make
+// the parser do unbounded work.
+const maxExprLength = 512
+
+var errExpr = errors.New("invalid macro expression")
+
+// evalExpr evaluates one {{ }} expression against fields. The language is a
+// small closed set — literals, field lookups, arithmetic, a few functions and
+// pipe filters — so nothing in an article can run arbitrary code:
+//
+//	now                       current time
+//	created | format "YYYY"   field through a filter
+//	ref.title / ref("title")  field of the current model
+//	random("a", "b", "c")     one of the arguments
+//	dice(6)                   integer in [1, 6]
+//	(wordCount + 199) / 200   arithmetic over numbers and fields
+func evalExpr(src string, fields Fields) (string, error) {
+	if len(src) > maxExprLength {
+		return "", errExpr
+	}
+	toks, err := tokenize(src)
+	if err != nil {
+		return "", err
+	}
+	p := &exprParser{toks: toks, fields: fields}
+	v, err := p.pipeline()
+	if err != nil {
+		return "", err
+	}
+	if p.peek().kind != tokEOF {
+		return "", errExpr
+	}
+	return formatValue(v), nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	num  float64
+}
+
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(string(rs[i:j]), 64)
+			if err != nil {
+				return nil, errExpr
+			}
+			toks = append(toks, token{kind: tokNumber, num: n})
+			i = j
+		case r == '"' || r == '\'':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(rs) && rs[j] != r; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				b.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, errExpr
+			}
+			toks = append(toks, token{kind: tokString, text: b.String()})
+			i = j + 1
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_' || rs[j] == '$' || rs[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: string(rs[i:j])})
+			i = j
+		case strings.ContainsRune("+-*/%()|,", r):
+			toks = append(toks, token{kind: tokOp, text: string(r)})
+			i++
+		default:
+			return nil, errExpr
+		}
+	}
+	return append(toks, token{kind: tokEOF}), nil
+}
+
+type exprParser struct {
+	toks   []token
+	pos    int
+	fields Fields
+}
+
+func (p *exprParser) peek() token { return p.toks[p.pos] }
+
+func (p *exprParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.isOp(op) {
+		return errExpr
+	}
+	p.next()
+	return nil
+}
+
+// pipeline := sum ( "|" filter )*
+func (p *exprParser) pipeline() (interface{}, error) {
+	v, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("|") {
+		p.next()
+		name := p.next()
+		if name.kind != tokIdent {
+			return nil, errExpr
+		}
+		var args []interface{}
+		if p.isOp("(") {
+			if args, err = p.args(); err != nil {
+				return nil, err
+			}
+		} else {
+			// Filter arguments may also be written without parentheses:
+			// created | format "YYYY-MM-DD".
+			for k := p.peek().kind; k == tokNumber || k == tokString; k = p.peek().kind {
+				t := p.next()
+				if k == tokNumber {
+					args = append(args, t.num)
+				} else {
+					args = append(args, t.text)
+				}
+			}
+		}
+		if v, err = applyFilter(name.text, v, args); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// sum := product ( ("+" | "-") product )*
+func (p *exprParser) sum() (interface{}, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().text
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = arith(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+// product := unary ( ("*" | "/" | "%") unary )*
+func (p *exprParser) product() (interface{}, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		op := p.next().text
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = arith(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) unary() (interface{}, error) {
+	if p.isOp("-") {
+		p.next()
+		v, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		f, ok := asNumber(v)
+		if !ok {
+			return nil, errExpr
+		}
+		return -f, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return t.num, nil
+	case tokString:
+		return t.text, nil
+	case tokIdent:
+		if p.isOp("(") {
+			args, err := p.args()
+			if err != nil {
+				return nil, err
+			}
+			return p.call(t.text, args)
+		}
+		return p.lookup(t.text)
+	case tokOp:
+		if t.text == "(" {
+			v, err := p.pipeline()
+			if err != nil {
+				return nil, err
+			}
+			return v, p.expect(")")
+		}
+	}
+	return nil, errExpr
+}
+
+// args := "(" [ pipeline ( "," pipeline )* ] ")"
+func (p *exprParser) args() ([]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	if p.isOp(")") {
+		p.next()
+		return args, nil
+	}
+	for {
+		v, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+		if p.isOp(",") {
+			p.next()
+			continue
+		}
+		return args, p.expect(")")
+	}
+}
+
+// lookup resolves a bare identifier: now, true/false, ref.<field> or a field
+// of the current model. Unknown names are errors so the macro is left as is.
+func (p *exprParser) lookup(name string) (interface{}, error) {
+	switch name {
+	case "now":
+		return time.Now(), nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "$"), "ref.")
+	return p.field(name)
+}
+
+// field returns a model field. Internal keys starting with "_" are hidden.
+func (p *exprParser) field(name string) (interface{}, error) {
+	if name == "" || strings.HasPrefix(name, "_") || strings.Contains(name, ".") {
+		return nil, errExpr
+	}
+	v, ok := p.fields[name]
+	if !ok {
+		return nil, errExpr
+	}
+	return v, nil
+}
+
+func (p *exprParser) call(name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "now":
+		return time.Now(), nil
+	case "ref":
+		if len(args) != 1 {
+			return nil, errExpr
+		}
+		return p.field(stringify(args[0]))
+	case "random":
+		if len(args) == 0 {
+			return nil, errExpr
+		}
+		return args[rand.Intn(len(args))], nil
+	case "dice":
+		sides := 6.0
+		if len(args) > 0 {
+			f, ok := asNumber(args[0])
+			if !ok {
+				return nil, errExpr
+			}
+			sides = f
+		}
+		if sides < 1 || sides > math.MaxInt32 {
+			return nil, errExpr
+		}
+		return float64(rand.Intn(int(sides)) + 1), nil
+	}
+	return nil, errExpr
+}
+
+func applyFilter(name string, v interface{}, args []interface{}) (interface{}, error) {
+	switch name {
+	case "format":
+		if isNilValue(v) {
+			return "", nil
+		}
+		t, ok := parseTimeValue(v)
+		if !ok {
+			return nil, errExpr
+		}
+		layout := defaultDateLayout
+		if len(args) > 0 {
+			layout = stringify(args[0])
+		}
+		return formatTimeByDayjsLayout(t, layout), nil
+	case "fromNow":
+		if isNilValue(v) {
+			return "", nil
+		}
+		t, ok := parseTimeValue(v)
+		if !ok {
+			return nil, errExpr
+		}
+		return fromNowString(t, time.Now()), nil
+	case "upper":
+		return strings.ToUpper(formatValue(v)), nil
+	case "lower":
+		return strings.ToLower(formatValue(v)), nil
+	case "default":
+		if len(args) != 1 {
+			return nil, errExpr
+		}
+		if !truthy(v) {
+			return args[0], nil
+		}
+		return v, nil
+	case "round":
+		f, ok := asNumber(v)
+		if !ok {
+			return nil, errExpr
+		}
+		digits := 0.0
+		if len(args) > 0 {
+			if digits, ok = asNumber(args[0]); !ok || digits < 0 || digits > 10 {
+				return nil, errExpr
+			}
+		}
+		pow := math.Pow(10, digits)
+		return math.Round(f*pow) / pow, nil
+	}
+	return nil, errExpr
+}
+
+// arith applies a binary operator. "+" concatenates when either side is not
+// a number; the other operators are numeric only.
+func arith(op string, left, right interface{}) (interface{}, error) {
+	lf, lok := asNumber(left)
+	rf, rok := asNumber(right)
+	if !lok || !rok {
+		if op == "+" {
+			return formatValue(left) + formatValue(right), nil
+		}
+		return nil, errExpr
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errExpr
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, errExpr
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, errExpr
+}
+
+// asNumber is asFloat limited to real numeric values, so strings that happen
+// to hold digits are concatenated rather than added.
+func asNumber(v interface{}) (float64, bool) {
+	switch v.(type) {
+	case string, nil, bool, time.Time, *time.Time:
+		return 0, false
+	}
+	return asFloat(v)
+}
+
+// isNilValue reports nil, including an unset *time.Time such as modified.
+func isNilValue(v interface{}) bool {
+	t, ok := v.(*time.Time)
+	return v == nil || ok && t == nil
+}
+
+func formatValue(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return ""
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case bool:
+		return fmt.Sprint(n)
+	}
+	return stringify(v)
+}
@@ -0,0 +1,137 @@
+package textmacro
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/response"
+	"gorm.io/gorm"
+)
+
+var errRefNotFound = errors.New("ref not found")
+
+// Handler exposes macro previews for the editor.
+type Handler struct {
+	svc *Service
+	db  *gorm.DB
+}
+
+func NewHandler(svc *Service, db *gorm.DB) *Handler {
+	return &Handler{svc: svc, db: db}
+}
+
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
+	g := rg.Group("/text/macro", authMW)
+	g.POST("/preview", h.preview)
+}
+
+type previewDTO struct {
+	Text    string                 `json:"text"`
+	RefType string                 `json:"ref_type"`
+	RefID   string                 `json:"ref_id"`
+	Model   map[string]interface{} `json:"model"`
+}
+
+// POST /text/macro/preview
+//
+// Renders text against a stored post, note or page (ref_type/ref_id) and/or
+// an unsaved model, whose fields take precedence. Macros are rendered even
+// when TextOptions.Macros is off; enabled tells the editor whether readers
+// will see them.
+func (h *Handler) preview(c *gin.Context) {
+	var dto previewDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	fields := Fields{}
+	if id := strings.TrimSpace(dto.RefID); id != "" {
+		var err error
+		fields, err = h.refFields(strings.TrimSpace(dto.RefType), id)
+		switch {
+		case errors.Is(err, errRefNotFound):
+			response.NotFoundMsg(c, "文章不存在")
+			return
+		case err != nil:
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+	for k, v := range dto.Model {
+		if k != "text" && !strings.HasPrefix(k, "_") {
+			fields[k] = v
+		}
+	}
+	fields["_isAuthenticated"] = true
+
+	response.OK(c, gin.H{
+		"text":    Render(dto.Text, fields),
+		"enabled": h.svc.Enabled(),
+	})
+}
+
+// refFields loads the fields a public GET would expose to macros. An empty
+// refType tries posts, notes and pages in turn.
+func (h *Handler) refFields(refType, id string) (Fields, error) {
+	types := []string{refType}
+	if refType == "" {
+		types = []string{"post", "note", "page"}
+	}
+	for _, t := range types {
+		var (
+			fields Fields
+			res    *gorm.DB
+		)
+		switch t {
+		case "post":
+			var p models.PostModel
+			res = h.db.Where("id = ?", id).Limit(1).Find(&p)
+			fields = Fields{
+				"title":       p.Title,
+				"slug":        p.Slug,
+				"summary":     p.Summary,
+				"id":          p.ID,
+				"created":     p.CreatedAt,
+				"modified":    models.NullableModified(p.CreatedAt, p.UpdatedAt),
+				"isPublished": p.IsPublished,
+			}
+		case "note":
+			var n models.NoteModel
+			res = h.db.Where("id = ?", id).Limit(1).Find(&n)
+			fields = Fields{
+				"title":       n.Title,
+				"nid":         n.NID,
+				"id":          n.ID,
+				"created":     n.CreatedAt,
+				"modified":    models.NullableModified(n.CreatedAt, n.UpdatedAt),
+				"isPublished": n.IsPublished,
+				"nid_str":     fmt.Sprintf("%d", n.NID),
+			}
+		case "page":
+			var p models.PageModel
+			res = h.db.Where("id = ?", id).Limit(1).Find(&p)
+			fields = Fields{
+				"title":    p.Title,
+				"slug":     p.Slug,
+				"subtitle": p.Subtitle,
+				"id":       p.ID,
+				"created":  p.CreatedAt,
+				"modified": models.NullableModified(p.CreatedAt, p.UpdatedAt),
+				"order":    p.Order,
+			}
+		default:
+			return nil, fmt.Errorf("unsupported ref_type %q", t)
+		}
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			return fields, nil
+		}
+	}
+	return nil, errRefNotFound
+}
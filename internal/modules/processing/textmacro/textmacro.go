@@ -28,13 +28,40 @@ func NewService(cfgSvc *appconfigs.Service) *Service {
 // Fields stores macro context variables.
 type Fields map[string]interface{}
 
-// Process expands all [[ ... ]] macros in text.
+// Enabled reports whether TextOptions.Macros is on.
+func (s *Service) Enabled() bool {
+	cfg, err := s.cfgSvc.Get()
+	return err == nil && cfg != nil && cfg.TextOptions.Macros
+}
+
+// Process expands all [[ ... ]] and {{ ... }} macros in text.
 // If macros are disabled in TextOptions, it returns text unchanged.
 func (s *Service) Process(text string, fields Fields) string {
-	cfg, err := s.cfgSvc.Get()
-	if err != nil || cfg == nil || !cfg.TextOptions.Macros {
+	if !s.Enabled() {
 		return text
 	}
+	return Render(text, fields)
+}
+
+// Render expands macros regardless of TextOptions. Macros that fail to
+// evaluate, and macros inside code blocks or inline code, are left in the
+// text as written.
+func Render(text string, fields Fields) string {
+	return mapProse(text, func(prose string) string { return renderProse(prose, fields) })
+}
+
+func renderProse(text string, fields Fields) string {
+	text = exprPattern.ReplaceAllStringFunc(text, func(match string) string {
+		inner := exprPattern.FindStringSubmatch(match)
+		if len(inner) < 2 || inner[1] == "" {
+			return match
+		}
+		out, err := evalExpr(inner[1], fields)
+		if err != nil {
+			return match
+		}
+		return out
+	})
 
 	return macroPattern.ReplaceAllStringFunc(text, func(match string) string {
 		inner := macroPattern.FindStringSubmatch(match)
@@ -0,0 +1,68 @@
+package serverless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/processing/ai"
+	"gorm.io/gorm"
+)
+
+// createAIService backs getService('ai'). Providers and their API keys come from
+// the stored config, so snippets never handle the keys themselves.
+func (h *Handler) createAIService(ctx context.Context, vm *goja.Runtime) *goja.Object {
+	obj := vm.NewObject()
+	_ = obj.Set("summarize", func(call goja.FunctionCall) goja.Value {
+		text := call.Argument(0).String()
+		lang := ""
+		if arg := call.Argument(1); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			lang = strings.TrimSpace(arg.String())
+		}
+		return h.aiPromise(vm, func(cfg config.AIConfig) (string, error) {
+			return ai.Summarize(ctx, cfg, text, lang)
+		})
+	})
+	_ = obj.Set("complete", func(call goja.FunctionCall) goja.Value {
+		systemPrompt := ""
+		if arg := call.Argument(0); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			systemPrompt = arg.String()
+		}
+		prompt := call.Argument(1).String()
+		return h.aiPromise(vm, func(cfg config.AIConfig) (string, error) {
+			return ai.Complete(ctx, cfg, systemPrompt, prompt)
+		})
+	})
+	return obj
+}
+
+func (h *Handler) aiPromise(vm *goja.Runtime, fn func(config.AIConfig) (string, error)) goja.Value {
+	cfg, err := h.loadAIConfig()
+	if err != nil {
+		return h.rejectedPromise(vm, map[string]interface{}{"message": err.Error()})
+	}
+	text, err := fn(cfg)
+	if err != nil {
+		return h.rejectedPromise(vm, map[string]interface{}{"message": err.Error()})
+	}
+	return h.resolvedPromise(vm, text)
+}
+
+func (h *Handler) loadAIConfig() (config.AIConfig, error) {
+	cfg := config.DefaultFullConfig()
+	var opt models.OptionModel
+	if err := h.db.Where("name = ?", "configs").First(&opt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return cfg.AI, nil
+		}
+		return cfg.AI, err
+	}
+	if err := json.Unmarshal([]byte(opt.Value), &cfg); err != nil {
+		return cfg.AI, err
+	}
+	return cfg.AI, nil
+}
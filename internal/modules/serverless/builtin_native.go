@@ -0,0 +1,160 @@
+package serverless
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/netguard"
+)
+
+const (
+	builtInAvatarMaxBytes = 2 << 20
+	builtInAvatarTTL      = 24 * time.Hour
+)
+
+func abortBuiltIn(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"message":     message,
+		"status_code": status,
+	})
+}
+
+type builtInIPInfo struct {
+	IP          string `json:"ip"`
+	CountryName string `json:"countryName"`
+	RegionName  string `json:"regionName"`
+	CityName    string `json:"cityName"`
+	OwnerDomain string `json:"ownerDomain"`
+	ISPDomain   string `json:"ispDomain"`
+}
+
+// GET /fn/built-in/ip?ip= — geo info of ?ip or the caller, cached like the
+// former JS implementation under the function's storage cache.
+func (h *Handler) builtInIP(c *gin.Context) {
+	ip := strings.TrimSpace(c.Query("ip"))
+	if ip == "" {
+		ip = c.ClientIP()
+	}
+	if net.ParseIP(ip) == nil {
+		abortBuiltIn(c, http.StatusUnprocessableEntity, "ip is invalid")
+		return
+	}
+
+	const namespace = "built-in/ip"
+	if h.rc != nil {
+		if cached, ok := h.cacheGet(namespace, ip).(map[string]interface{}); ok {
+			c.JSON(http.StatusOK, cached)
+			return
+		}
+	}
+
+	info := builtInIPInfo{IP: ip}
+	resp, body, err := h.doHTTPRequest(c.Request.Context(), http.MethodGet, "http://ip-api.com/json/"+url.PathEscape(ip)+"?lang=zh-CN", http.Header{}, nil, "follow")
+	if err == nil && resp.StatusCode == http.StatusOK {
+		var data struct {
+			Query      string `json:"query"`
+			Country    string `json:"country"`
+			RegionName string `json:"regionName"`
+			City       string `json:"city"`
+			Org        string `json:"org"`
+			ISP        string `json:"isp"`
+		}
+		if json.Unmarshal(body, &data) == nil {
+			if data.Query != "" {
+				info.IP = data.Query
+			}
+			info.CountryName = data.Country
+			info.RegionName = data.RegionName
+			info.CityName = data.City
+			info.OwnerDomain = data.Org
+			info.ISPDomain = data.ISP
+		}
+	}
+
+	if h.rc != nil {
+		h.cacheSet(namespace, ip, map[string]interface{}{
+			"ip":          info.IP,
+			"countryName": info.CountryName,
+			"regionName":  info.RegionName,
+			"cityName":    info.CityName,
+			"ownerDomain": info.OwnerDomain,
+			"ispDomain":   info.ISPDomain,
+		}, 0)
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// GET /fn/built-in/avatar?url= | ?github= — proxies an avatar image, passing its
+// content type through. Only image responses from public hosts are served, so
+// this is not a general purpose proxy.
+func (h *Handler) builtInAvatar(c *gin.Context) {
+	target := strings.TrimSpace(c.Query("url"))
+	if username := strings.TrimSpace(c.Query("github")); username != "" {
+		target = "https://github.com/" + url.PathEscape(username) + ".png"
+	}
+	parsed, err := url.Parse(target)
+	if target == "" || err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		abortBuiltIn(c, http.StatusBadRequest, "url or github is required")
+		return
+	}
+	// The snippet HTTP client refuses internal addresses on connect, redirects
+	// included; checking here too gives callers a clear error.
+	if err := netguard.CheckHost(c.Request.Context(), parsed.Hostname()); err != nil {
+		abortBuiltIn(c, http.StatusBadRequest, "url must point to a public host")
+		return
+	}
+
+	const namespace = "built-in/avatar"
+	sum := sha256.Sum256([]byte(parsed.String()))
+	cacheKey := hex.EncodeToString(sum[:])
+	if h.rc != nil {
+		if cached, ok := h.cacheGet(namespace, cacheKey).(map[string]interface{}); ok {
+			contentType, _ := cached["content_type"].(string)
+			encoded, _ := cached["data"].(string)
+			if data, err := base64.StdEncoding.DecodeString(encoded); err == nil && contentType != "" {
+				writeAvatar(c, contentType, data)
+				return
+			}
+		}
+	}
+
+	resp, body, err := h.doHTTPRequest(c.Request.Context(), http.MethodGet, parsed.String(), http.Header{}, nil, "follow")
+	if err != nil {
+		abortBuiltIn(c, http.StatusBadGateway, fmt.Sprintf("fetch avatar failed: %s", err.Error()))
+		return
+	}
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case resp.StatusCode != http.StatusOK:
+		abortBuiltIn(c, http.StatusBadGateway, fmt.Sprintf("fetch avatar failed with status %d", resp.StatusCode))
+		return
+	case !strings.HasPrefix(strings.ToLower(contentType), "image/"):
+		abortBuiltIn(c, http.StatusBadGateway, "remote resource is not an image")
+		return
+	case len(body) > builtInAvatarMaxBytes:
+		abortBuiltIn(c, http.StatusBadGateway, "avatar is too large")
+		return
+	}
+
+	if h.rc != nil {
+		h.cacheSet(namespace, cacheKey, map[string]interface{}{
+			"content_type": contentType,
+			"data":         base64.StdEncoding.EncodeToString(body),
+		}, int64(builtInAvatarTTL.Seconds()))
+	}
+	writeAvatar(c, contentType, body)
+}
+
+func writeAvatar(c *gin.Context, contentType string, data []byte) {
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(builtInAvatarTTL.Seconds())))
+	c.Data(http.StatusOK, contentType, data)
+}
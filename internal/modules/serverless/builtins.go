@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/models"
 )
 
@@ -14,6 +15,10 @@ type builtInSnippet struct {
 	Name      string
 	Method    string
 	Code      string
+	// Native, when set, serves the function in Go and Code only documents it.
+	// Native built-ins cannot be edited; a user snippet with the same
+	// reference/name overrides them.
+	Native func(h *Handler, c *gin.Context)
 }
 
 var builtInSnippets = []builtInSnippet{
@@ -22,61 +27,24 @@ var builtInSnippets = []builtInSnippet{
 		Name:      "ip",
 		Method:    "GET",
 		Code: strings.TrimSpace(`
-const DEFAULT_TIMEOUT = 5000
-
-function pickString(value) {
-  if (Array.isArray(value)) {
-    return String(value[0] ?? '').trim()
-  }
-  if (value === undefined || value === null) {
-    return ''
-  }
-  return String(value).trim()
-}
-
-export default async function handler(ctx) {
-  const queryIP = pickString(ctx?.query?.ip || ctx?.req?.query?.ip)
-  const ip = queryIP || pickString(ctx?.ip || ctx?.req?.ip)
-
-  if (!ip) {
-    ctx.throws(422, 'ip is empty')
-  }
-
-  const cache = ctx.storage.cache
-  const cached = await cache.get(ip)
-  if (cached) {
-    return cached
-  }
-
-  const result = {
-    ip,
-    countryName: '',
-    regionName: '',
-    cityName: '',
-    ownerDomain: '',
-    ispDomain: '',
-  }
-
-  const { axios } = await ctx.getService('http')
-  const { data } = await axios
-    .get('http://ip-api.com/json/' + encodeURIComponent(ip) + '?lang=zh-CN', {
-      timeout: DEFAULT_TIMEOUT,
-    })
-    .catch(() => ({ data: null }))
-
-  if (data && typeof data === 'object') {
-    if (data.query) result.ip = data.query
-    if (data.country) result.countryName = data.country
-    if (data.regionName) result.regionName = data.regionName
-    if (data.city) result.cityName = data.city
-    if (data.org) result.ownerDomain = data.org
-    if (data.isp) result.ispDomain = data.isp
-  }
-
-  await cache.set(ip, result)
-  return result
-}
+// Native built-in function, served by the server.
+// GET /fn/built-in/ip?ip=<address>
+// Returns geo info of ?ip, or of the caller when omitted:
+// { ip, countryName, regionName, cityName, ownerDomain, ispDomain }
+`),
+		Native: (*Handler).builtInIP,
+	},
+	{
+		Reference: "built-in",
+		Name:      "avatar",
+		Method:    "GET",
+		Code: strings.TrimSpace(`
+// Native built-in function, served by the server.
+// GET /fn/built-in/avatar?url=<image url>
+// GET /fn/built-in/avatar?github=<username>
+// Fetches the avatar, caches it for a day and responds with the image.
 `),
+		Native: (*Handler).builtInAvatar,
 	},
 	{
 		Reference: "built-in",
@@ -270,11 +238,27 @@ func (h *Handler) ensureBuiltInSnippets() error {
 	for i := range existing {
 		current := &existing[i]
 		identity := normalizeBuiltInIdentity(current.Reference, current.Name)
-		if _, ok := pending[identity]; !ok {
+		preset, ok := pending[identity]
+		if !ok {
 			continue
 		}
-		delete(pending, identity)
 
+		if preset.Native != nil {
+			// User snippets with a native built-in's name are overrides; the
+			// built-in keeps its own row, whose code always documents the native one.
+			if !current.BuiltIn {
+				continue
+			}
+			delete(pending, identity)
+			if current.Raw != preset.Code {
+				if err := h.resetBuiltInSnippet(current); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		delete(pending, identity)
 		if current.BuiltIn {
 			continue
 		}
@@ -308,6 +292,13 @@ func (h *Handler) ensureBuiltInSnippets() error {
 	return nil
 }
 
+// IsNativeBuiltIn reports whether reference/name is a built-in function served
+// in Go. Such snippets are read-only.
+func IsNativeBuiltIn(reference, name string) bool {
+	preset := findBuiltInSnippet(reference, name)
+	return preset != nil && preset.Native != nil
+}
+
 func isDuplicateSnippetError(err error) bool {
 	if err == nil {
 		return false
@@ -334,5 +325,9 @@ func (h *Handler) resetBuiltInSnippet(snippet *models.SnippetModel) error {
 		"private":  false,
 		"built_in": true,
 	}
-	return h.db.Model(snippet).Updates(updates).Error
+	if err := h.db.Model(snippet).Updates(updates).Error; err != nil {
+		return err
+	}
+	h.publishInvalidation(snippet.ID)
+	return nil
 }
@@ -1,38 +1,214 @@
 package serverless
 
 import (
+	"container/list"
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/evanw/esbuild/pkg/api"
 	"github.com/mx-space/core/internal/models"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"go.uber.org/zap"
 )
 
-func (h *Handler) compileSnippet(snippet *models.SnippetModel) (string, error) {
-	h.compiledMu.RLock()
-	if cached, ok := h.compiled[snippet.ID]; ok && cached.UpdatedAt.Equal(snippet.UpdatedAt) {
-		h.compiledMu.RUnlock()
-		return cached.Code, nil
+// compileCacheLimit bounds how many compiled snippets a worker keeps.
+const compileCacheLimit = 256
+
+// compileCache is an LRU of compiled snippets keyed by snippet ID.
+type compileCache struct {
+	mu    sync.Mutex
+	limit int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type compileCacheEntry struct {
+	id       string
+	compiled compiledSnippet
+}
+
+func newCompileCache(limit int) *compileCache {
+	return &compileCache{limit: limit, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *compileCache) get(id string) (compiledSnippet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[id]
+	if !ok {
+		return compiledSnippet{}, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*compileCacheEntry).compiled, true
+}
+
+func (c *compileCache) put(id string, compiled compiledSnippet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[id]; ok {
+		el.Value.(*compileCacheEntry).compiled = compiled
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[id] = c.ll.PushFront(&compileCacheEntry{id: id, compiled: compiled})
+	for c.ll.Len() > c.limit {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*compileCacheEntry).id)
+	}
+}
+
+func (c *compileCache) evict(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[id]; ok {
+		c.ll.Remove(el)
+		delete(c.items, id)
 	}
-	h.compiledMu.RUnlock()
+}
 
-	result := api.Transform(snippet.Raw, api.TransformOptions{
+// compileSnippet transpiles the snippet to CommonJS and reports whether the
+// cached output was reused.
+func (h *Handler) compileSnippet(snippet *models.SnippetModel) (string, bool, error) {
+	if cached, ok := h.compiled.get(snippet.ID); ok && cached.UpdatedAt.Equal(snippet.UpdatedAt) {
+		return cached.Code, true, nil
+	}
+
+	code, err := transformSnippet(snippet.Reference, snippet.Name, snippet.Raw)
+	if err != nil {
+		return "", false, err
+	}
+
+	h.compiled.put(snippet.ID, compiledSnippet{
+		UpdatedAt: snippet.UpdatedAt,
+		Code:      code,
+	})
+
+	return code, false, nil
+}
+
+// snippetInvalidateChannel carries IDs of snippets changed on any worker, so
+// every worker drops their compiled code instead of relying on UpdatedAt alone.
+const snippetInvalidateChannel = "mx:snippet:invalidate"
+
+// PublishSnippetInvalidation tells every worker to drop the compiled code of
+// snippet id. Call it after a snippet is updated or deleted.
+func PublishSnippetInvalidation(ctx context.Context, rc *pkgredis.Client, id string) error {
+	if rc == nil || id == "" {
+		return nil
+	}
+	return rc.Publish(ctx, snippetInvalidateChannel, id)
+}
+
+// snippetDeleteChannel carries IDs of deleted snippets, whose compiled code
+// and console buffers every worker drops.
+const snippetDeleteChannel = "mx:snippet:deleted"
+
+// PublishSnippetDeletion tells every worker that snippet id was deleted.
+func PublishSnippetDeletion(ctx context.Context, rc *pkgredis.Client, id string) error {
+	if rc == nil || id == "" {
+		return nil
+	}
+	return rc.Publish(ctx, snippetDeleteChannel, id)
+}
+
+func (h *Handler) publishInvalidation(id string) {
+	h.compiled.evict(id)
+	if err := PublishSnippetInvalidation(context.Background(), h.rc, id); err != nil {
+		h.logger.Warn("广播函数缓存失效失败", zap.String("snippet_id", id), zap.Error(err))
+	}
+}
+
+// SubscribeInvalidation blocks until ctx is done, evicting compiled snippets
+// named on snippetInvalidateChannel, and the console buffers too for those
+// named on snippetDeleteChannel. Without Redis it returns immediately.
+func (h *Handler) SubscribeInvalidation(ctx context.Context) {
+	if h.rc == nil {
+		return
+	}
+	pubsub := h.rc.Subscribe(ctx, snippetInvalidateChannel, snippetDeleteChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			h.compiled.evict(msg.Payload)
+			if msg.Channel == snippetDeleteChannel {
+				consoleLogs.forget(msg.Payload)
+			}
+		}
+	}
+}
+
+// CheckSnippetSource reports whether raw transpiles as a function snippet, using
+// the same transform as execution.
+func CheckSnippetSource(reference, name, raw string) error {
+	_, err := transformSnippet(reference, name, raw)
+	return err
+}
+
+// CompileErrorDetail is one esbuild diagnostic with its position in the source.
+// Line is 1-based and Column is 0-based, as esbuild reports them.
+type CompileErrorDetail struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column"`
+	LineText string `json:"line_text,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (d CompileErrorDetail) String() string {
+	if d.File == "" {
+		return d.Message
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// CompileError carries every error esbuild reported for a snippet.
+type CompileError struct {
+	Errors []CompileErrorDetail
+}
+
+func (e *CompileError) Error() string {
+	msg := "transform failed: " + e.Errors[0].String()
+	if more := len(e.Errors) - 1; more > 0 {
+		msg += fmt.Sprintf(" (and %d more)", more)
+	}
+	return msg
+}
+
+func newCompileError(messages []api.Message) *CompileError {
+	out := &CompileError{Errors: make([]CompileErrorDetail, 0, len(messages))}
+	for _, m := range messages {
+		detail := CompileErrorDetail{Message: m.Text}
+		if m.Location != nil {
+			detail.File = m.Location.File
+			detail.Line = m.Location.Line
+			detail.Column = m.Location.Column
+			detail.LineText = m.Location.LineText
+		}
+		out.Errors = append(out.Errors, detail)
+	}
+	return out
+}
+
+func transformSnippet(reference, name, raw string) (string, error) {
+	result := api.Transform(raw, api.TransformOptions{
 		Loader:     api.LoaderTS,
 		Format:     api.FormatCommonJS,
 		Target:     api.ES2020,
-		Sourcefile: fmt.Sprintf("%s/%s.ts", snippet.Reference, snippet.Name),
+		Sourcefile: fmt.Sprintf("%s/%s.ts", reference, name),
 		Charset:    api.CharsetUTF8,
 	})
 	if len(result.Errors) > 0 {
-		return "", fmt.Errorf("transform failed: %s", result.Errors[0].Text)
+		return "", newCompileError(result.Errors)
 	}
-
-	code := string(result.Code)
-	h.compiledMu.Lock()
-	h.compiled[snippet.ID] = compiledSnippet{
-		UpdatedAt: snippet.UpdatedAt,
-		Code:      code,
-	}
-	h.compiledMu.Unlock()
-
-	return code, nil
+	return instrumentSnippet(string(result.Code))
 }
@@ -0,0 +1,115 @@
+package serverless
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mx-space/core/internal/models"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+)
+
+// newWorkers returns two Handlers sharing one Redis, as two cluster workers
+// would, both subscribed to snippet invalidations.
+func newWorkers(t *testing.T) (*Handler, *Handler) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var workers []*Handler
+	for i := 0; i < 2; i++ {
+		rc, err := pkgredis.Connect("redis://" + mr.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := NewHandler(nil, nil, rc)
+		go h.SubscribeInvalidation(ctx)
+		workers = append(workers, h)
+		t.Cleanup(func() { _ = rc.Raw().Close() })
+	}
+	t.Cleanup(cancel)
+	waitUntil(t, "both workers to subscribe", func() bool {
+		subs := mr.PubSubNumSub(snippetInvalidateChannel, snippetDeleteChannel)
+		return subs[snippetInvalidateChannel] == 2 && subs[snippetDeleteChannel] == 2
+	})
+	return workers[0], workers[1]
+}
+
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func testSnippet() *models.SnippetModel {
+	s := &models.SnippetModel{
+		Reference: "demo",
+		Name:      "hello",
+		Raw:       "export default async function handler() { return 'hi' }",
+	}
+	s.ID = "snippet-1"
+	s.UpdatedAt = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	return s
+}
+
+func TestInvalidationReachesOtherWorker(t *testing.T) {
+	a, b := newWorkers(t)
+	snippet := testSnippet()
+	for _, h := range []*Handler{a, b} {
+		if _, _, err := h.compileSnippet(snippet); err != nil {
+			t.Fatal(err)
+		}
+		if _, hit, _ := h.compileSnippet(snippet); !hit {
+			t.Fatal("second compile missed the cache")
+		}
+	}
+
+	// Worker a saves the snippet; b must drop its copy even though it never
+	// saw the new UpdatedAt.
+	a.publishInvalidation(snippet.ID)
+	if _, ok := a.compiled.get(snippet.ID); ok {
+		t.Fatal("publishing worker kept its compiled copy")
+	}
+	waitUntil(t, "worker b to evict the snippet", func() bool {
+		_, ok := b.compiled.get(snippet.ID)
+		return !ok
+	})
+}
+
+func TestDeletionClearsConsoleLogs(t *testing.T) {
+	a, b := newWorkers(t)
+	snippet := testSnippet()
+	if _, _, err := b.compileSnippet(snippet); err != nil {
+		t.Fatal(err)
+	}
+	consoleLogs.append(snippet.ID, ConsoleLogEntry{Time: time.Now(), Level: "log", Message: "hi"})
+
+	if err := PublishSnippetDeletion(context.Background(), a.rc, snippet.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, "the deleted snippet to be dropped", func() bool {
+		_, ok := b.compiled.get(snippet.ID)
+		return !ok && len(consoleLogs.list(snippet.ID, 0)) == 0
+	})
+}
+
+func TestCompileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newCompileCache(2)
+	c.put("a", compiledSnippet{Code: "a"})
+	c.put("b", compiledSnippet{Code: "b"})
+	c.get("a")
+	c.put("c", compiledSnippet{Code: "c"})
+	if _, ok := c.get("b"); ok {
+		t.Fatal("least recently used entry was kept")
+	}
+	for _, id := range []string{"a", "c"} {
+		if _, ok := c.get(id); !ok {
+			t.Fatalf("entry %s was evicted", id)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/pkg/requestbody"
+	"github.com/mx-space/core/internal/pkg/tracing"
 )
 
 func (h *Handler) buildRuntimeContext(c *gin.Context, snippet *models.SnippetModel) runtimeContext {
@@ -61,11 +62,44 @@ func (h *Handler) buildRuntimeContext(c *gin.Context, snippet *models.SnippetMod
 		Body:            body,
 		IsAuthenticated: h.hasFunctionAccess(c),
 		Secret:          parseSnippetSecret(snippet.Secret),
-		Model: map[string]interface{}{
-			"id":        snippet.ID,
-			"name":      snippet.Name,
-			"reference": snippet.Reference,
+		Model:           snippetModelInfo(snippet),
+		TraceID:         tracing.TraceID(c.Request.Context()),
+	}
+}
+
+// scheduledRuntimeContext is the context for cron-triggered runs: there is no
+// request, so query, headers and body are empty and the caller counts as the owner.
+func scheduledRuntimeContext(snippet *models.SnippetModel) runtimeContext {
+	query := map[string]interface{}{}
+	headers := map[string]string{}
+	params := map[string]interface{}{}
+	return runtimeContext{
+		Req: map[string]interface{}{
+			"method":  scheduledRunMethod,
+			"path":    "",
+			"query":   query,
+			"body":    nil,
+			"headers": headers,
+			"params":  params,
+			"url":     "",
+			"ip":      "",
 		},
+		Query:           query,
+		Headers:         headers,
+		Params:          params,
+		Method:          scheduledRunMethod,
+		IsAuthenticated: true,
+		Secret:          parseSnippetSecret(snippet.Secret),
+		Model:           snippetModelInfo(snippet),
+		TraceID:         tracing.NewID(),
+	}
+}
+
+func snippetModelInfo(snippet *models.SnippetModel) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        snippet.ID,
+		"name":      snippet.Name,
+		"reference": snippet.Reference,
 	}
 }
 
@@ -0,0 +1,246 @@
+package serverless
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// eventLoop gives one snippet execution timers and background work such as
+// fetch(). It is created per execution and only touched from the goroutine
+// running the VM; timer and worker goroutines just queue what finished. goja
+// drains promise jobs (microtasks) itself whenever control returns from JS, so
+// the loop only has to run timer callbacks and settle background work.
+type eventLoop struct {
+	vm     *goja.Runtime
+	timers map[int64]*loopTimer
+	nextID int64
+	// pending counts background work whose result has not been settled yet.
+	pending int
+
+	mu      sync.Mutex
+	ready   []*loopTimer
+	settled []func() error
+	wakeup  chan struct{}
+
+	// ctx is canceled by dispose, stopping background work nobody waits for.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopErr  error
+
+	// uncaught is the first exception thrown by a queueMicrotask callback.
+	uncaught error
+}
+
+type loopTimer struct {
+	id       int64
+	fn       goja.Callable
+	args     []goja.Value
+	delay    time.Duration
+	interval bool
+	timer    *time.Timer
+}
+
+func newEventLoop(vm *goja.Runtime) *eventLoop {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &eventLoop{
+		vm:     vm,
+		timers: map[int64]*loopTimer{},
+		wakeup: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// install defines setTimeout, setInterval, their clear functions, queueMicrotask
+// and sleep(ms).
+func (l *eventLoop) install() {
+	_ = l.vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
+		return l.vm.ToValue(l.schedule(call, false))
+	})
+	_ = l.vm.Set("setInterval", func(call goja.FunctionCall) goja.Value {
+		return l.vm.ToValue(l.schedule(call, true))
+	})
+	clear := func(call goja.FunctionCall) goja.Value {
+		l.clear(call.Argument(0).ToInteger())
+		return goja.Undefined()
+	}
+	_ = l.vm.Set("clearTimeout", clear)
+	_ = l.vm.Set("clearInterval", clear)
+	_ = l.vm.Set("queueMicrotask", func(call goja.FunctionCall) goja.Value {
+		fn, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(l.vm.NewTypeError("callback must be a function"))
+		}
+		// A resolved promise's reaction is a goja job, i.e. a microtask.
+		promise, resolve, _ := l.vm.NewPromise()
+		_ = resolve(goja.Undefined())
+		then, _ := goja.AssertFunction(l.vm.ToValue(promise).ToObject(l.vm).Get("then"))
+		_, _ = then(l.vm.ToValue(promise), l.vm.ToValue(func(goja.FunctionCall) goja.Value {
+			if _, err := fn(goja.Undefined()); err != nil && l.uncaught == nil {
+				l.uncaught = err
+			}
+			return goja.Undefined()
+		}))
+		return goja.Undefined()
+	})
+	_ = l.vm.Set("sleep", func(call goja.FunctionCall) goja.Value {
+		promise, resolve, _ := l.vm.NewPromise()
+		fn := func(goja.Value, ...goja.Value) (goja.Value, error) {
+			_ = resolve(goja.Undefined())
+			return goja.Undefined(), nil
+		}
+		l.add(fn, nil, timerDelay(call.Argument(0)), false)
+		return l.vm.ToValue(promise)
+	})
+}
+
+func (l *eventLoop) schedule(call goja.FunctionCall, interval bool) int64 {
+	fn, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		panic(l.vm.NewTypeError("callback must be a function"))
+	}
+	var args []goja.Value
+	if len(call.Arguments) > 2 {
+		args = append(args, call.Arguments[2:]...)
+	}
+	return l.add(fn, args, timerDelay(call.Argument(1)), interval)
+}
+
+// timerDelay follows Node: anything below 1ms or above int32 range becomes 1ms.
+func timerDelay(value goja.Value) time.Duration {
+	ms := value.ToFloat()
+	if math.IsNaN(ms) || ms < 1 || ms > math.MaxInt32 {
+		ms = 1
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func (l *eventLoop) add(fn goja.Callable, args []goja.Value, delay time.Duration, interval bool) int64 {
+	l.nextID++
+	t := &loopTimer{id: l.nextID, fn: fn, args: args, delay: delay, interval: interval}
+	l.timers[t.id] = t
+	l.arm(t)
+	return t.id
+}
+
+func (l *eventLoop) arm(t *loopTimer) {
+	t.timer = time.AfterFunc(t.delay, func() {
+		l.mu.Lock()
+		l.ready = append(l.ready, t)
+		l.mu.Unlock()
+		l.wake()
+	})
+}
+
+// spawn runs work on its own goroutine with a context derived from parent that
+// is canceled once the execution ends. work must not touch the VM; it returns
+// the function that settles the result, which the loop runs on the VM's
+// goroutine. An error from settle, such as an interrupt, fails the run.
+func (l *eventLoop) spawn(parent context.Context, work func(ctx context.Context) (settle func() error)) {
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(l.ctx, cancel)
+	l.pending++
+	go func() {
+		defer cancel()
+		defer stop()
+		settle := work(ctx)
+		l.mu.Lock()
+		l.settled = append(l.settled, settle)
+		l.mu.Unlock()
+		l.wake()
+	}()
+}
+
+func (l *eventLoop) wake() {
+	select {
+	case l.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (l *eventLoop) clear(id int64) {
+	if t, ok := l.timers[id]; ok {
+		t.timer.Stop()
+		delete(l.timers, id)
+	}
+}
+
+// run settles the handler result: when it is a pending promise, background work
+// is settled and timers run until it settles, nothing is left that could settle
+// it, or the loop is interrupted (returning the interrupt cause). An exception
+// from a timer or microtask fails the run.
+func (l *eventLoop) run(result goja.Value) error {
+	p, ok := result.Export().(*goja.Promise)
+	for ok && p.State() == goja.PromiseStatePending && (len(l.timers) > 0 || l.pending > 0) && l.uncaught == nil {
+		select {
+		case <-l.stop:
+			return l.stopErr
+		case <-l.wakeup:
+		}
+
+		l.mu.Lock()
+		ready, settled := l.ready, l.settled
+		l.ready, l.settled = nil, nil
+		l.mu.Unlock()
+
+		for _, settle := range settled {
+			l.pending--
+			if err := settle(); err != nil {
+				return err
+			}
+		}
+		for _, t := range ready {
+			if err := l.fire(t); err != nil {
+				return err
+			}
+			if p.State() != goja.PromiseStatePending || l.uncaught != nil {
+				break
+			}
+		}
+	}
+	return l.uncaught
+}
+
+// fire runs a due timer unless it was cleared meanwhile. An exception thrown by
+// the callback fails the execution, like an uncaught exception in Node.
+func (l *eventLoop) fire(t *loopTimer) error {
+	if _, ok := l.timers[t.id]; !ok {
+		return nil
+	}
+	if !t.interval {
+		delete(l.timers, t.id)
+	}
+	if _, err := t.fn(goja.Undefined(), t.args...); err != nil {
+		return err
+	}
+	if _, ok := l.timers[t.id]; ok && t.interval {
+		l.arm(t)
+	}
+	return nil
+}
+
+// interrupt stops a waiting run with cause; safe to call from any goroutine.
+// Only the first cause is kept.
+func (l *eventLoop) interrupt(cause error) {
+	l.stopOnce.Do(func() {
+		l.stopErr = cause
+		close(l.stop)
+	})
+}
+
+// dispose cancels every pending timer and background work.
+func (l *eventLoop) dispose() {
+	for id, t := range l.timers {
+		t.timer.Stop()
+		delete(l.timers, id)
+	}
+	l.cancel()
+}
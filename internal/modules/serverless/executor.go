@@ -1,6 +1,7 @@
 package serverless
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,28 +15,46 @@ import (
 	"github.com/dop251/goja"
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/tracing"
 )
 
-func (h *Handler) executeSnippet(snippet *models.SnippetModel, ctx runtimeContext) (*executorResult, error) {
-	compiledCode, err := h.compileSnippet(snippet)
+func (h *Handler) executeSnippet(snippet *models.SnippetModel, ctx runtimeContext) (out *executorResult, err error) {
+	startedAt := time.Now()
+	cacheHit := false
+	defer func() { h.recordExecution(snippet, startedAt, out, err, cacheHit) }()
+
+	compiledCode, cacheHit, err := h.compileSnippet(snippet)
 	if err != nil {
-		return nil, &runtimeExecError{
+		execErr := &runtimeExecError{
 			Status:  http.StatusInternalServerError,
 			Message: err.Error(),
 		}
+		var compileErr *CompileError
+		if errors.As(err, &compileErr) {
+			execErr.CompileErrors = compileErr.Errors
+		}
+		return nil, execErr
 	}
 
 	vm := goja.New()
 	meta := runtimeResponseMeta{StatusCode: http.StatusOK}
 	timeoutReason := "serverless-timeout"
+	vm.SetMaxCallStackSize(serverlessMaxCallStack)
+	loop := newEventLoop(vm)
+	meter := newMemoryMeter(vm, loop, h.maxMemoryBytes)
 	timer := time.AfterFunc(serverlessExecutionTimeout, func() {
 		vm.Interrupt(timeoutReason)
+		loop.interrupt(errExecutionTimeout)
 	})
 	defer timer.Stop()
+	defer loop.dispose()
 
-	if err := h.installRuntimeGlobals(vm, snippet, ctx, &meta); err != nil {
+	if err := h.installRuntimeGlobals(vm, loop, snippet, ctx, &meta); err != nil {
 		return nil, err
 	}
+	loop.install()
+	meter.install()
+	meter.start()
 
 	bootstrap := "var module={exports:{}}; var exports=module.exports;\n" +
 		compiledCode +
@@ -60,6 +79,12 @@ func (h *Handler) executeSnippet(snippet *models.SnippetModel, ctx runtimeContex
 	if err != nil {
 		return nil, h.normalizeRuntimeError(err, timeoutReason)
 	}
+	// Async handlers may wait on timers; run them until the returned promise settles.
+	if resultValue != nil {
+		if err := loop.run(resultValue); err != nil {
+			return nil, h.normalizeRuntimeError(err, timeoutReason)
+		}
+	}
 
 	result, hasData, err := h.resolveResultValue(resultValue)
 	if err != nil {
@@ -69,31 +94,44 @@ func (h *Handler) executeSnippet(snippet *models.SnippetModel, ctx runtimeContex
 		result = meta.SentData
 		hasData = meta.SentHasData
 	}
+	encoded, err := h.encodeResponse(result)
+	if err != nil {
+		return nil, err
+	}
 
 	return &executorResult{
 		data:    result,
+		encoded: encoded,
 		hasData: hasData,
 		meta:    meta,
 	}, nil
 }
 
+// snippetNamespace is the "reference/name" label used in logs.
+func snippetNamespace(snippet *models.SnippetModel) string {
+	namespace := strings.TrimSpace(snippet.Reference) + "/" + strings.TrimSpace(snippet.Name)
+	if namespace == "/" {
+		return "unknown"
+	}
+	return namespace
+}
+
 func (h *Handler) installRuntimeGlobals(
 	vm *goja.Runtime,
+	loop *eventLoop,
 	snippet *models.SnippetModel,
 	ctx runtimeContext,
 	meta *runtimeResponseMeta,
 ) error {
-	namespace := strings.TrimSpace(snippet.Reference) + "/" + strings.TrimSpace(snippet.Name)
-	if namespace == "/" {
-		namespace = "unknown"
-	}
+	namespace := snippetNamespace(snippet)
+	traceCtx := tracing.WithTraceID(context.Background(), ctx.TraceID)
 
 	console := vm.NewObject()
-	_ = console.Set("log", h.createRuntimeConsoleMethod(namespace, "log"))
-	_ = console.Set("info", h.createRuntimeConsoleMethod(namespace, "info"))
-	_ = console.Set("warn", h.createRuntimeConsoleMethod(namespace, "warn"))
-	_ = console.Set("error", h.createRuntimeConsoleMethod(namespace, "error"))
-	_ = console.Set("debug", h.createRuntimeConsoleMethod(namespace, "debug"))
+	_ = console.Set("log", h.createRuntimeConsoleMethod(snippet.ID, namespace, ctx.TraceID, "log"))
+	_ = console.Set("info", h.createRuntimeConsoleMethod(snippet.ID, namespace, ctx.TraceID, "info"))
+	_ = console.Set("warn", h.createRuntimeConsoleMethod(snippet.ID, namespace, ctx.TraceID, "warn"))
+	_ = console.Set("error", h.createRuntimeConsoleMethod(snippet.ID, namespace, ctx.TraceID, "error"))
+	_ = console.Set("debug", h.createRuntimeConsoleMethod(snippet.ID, namespace, ctx.TraceID, "debug"))
 	_ = vm.Set("console", console)
 	_ = vm.Set("logger", console)
 
@@ -113,17 +151,17 @@ func (h *Handler) installRuntimeGlobals(
 		}
 	}
 
+	_ = vm.Set("fetch", func(call goja.FunctionCall) goja.Value {
+		return h.fetch(traceCtx, vm, loop, call.Argument(0), call.Argument(1))
+	})
+
 	_ = vm.Set("require", func(call goja.FunctionCall) goja.Value {
 		moduleName := strings.TrimSpace(call.Argument(0).String())
-		switch moduleName {
-		case "url", "node:url":
-			out := vm.NewObject()
-			_ = out.Set("URLSearchParams", vm.Get("__mx_URLSearchParams"))
-			return out
-		default:
-			h.throwJS(vm, http.StatusInternalServerError, fmt.Sprintf("module %q is not allowed", moduleName))
-			return goja.Undefined()
+		if module, ok := h.requireModule(vm, moduleName); ok {
+			return module
 		}
+		h.throwJS(vm, http.StatusInternalServerError, fmt.Sprintf("module %q is not allowed", moduleName))
+		return goja.Undefined()
 	})
 
 	contextObj := vm.NewObject()
@@ -168,6 +206,30 @@ func (h *Handler) installRuntimeGlobals(
 		meta.SentHasData = hasData
 		return call.Argument(0)
 	})
+	// res.redirect(url, status?) also accepts Express' redirect(status, url) order.
+	_ = resObj.Set("redirect", func(call goja.FunctionCall) goja.Value {
+		target, statusArg := call.Argument(0), call.Argument(1)
+		if _, isNumber := target.Export().(int64); isNumber && len(call.Arguments) > 1 {
+			target, statusArg = statusArg, target
+		}
+		location := strings.TrimSpace(target.String())
+		if goja.IsUndefined(target) || goja.IsNull(target) || location == "" {
+			panic(vm.NewTypeError("res.redirect requires a url"))
+		}
+		code := http.StatusFound
+		if !goja.IsUndefined(statusArg) {
+			code = int(statusArg.ToInteger())
+			if code < 300 || code > 399 {
+				panic(vm.NewTypeError(fmt.Sprintf("invalid redirect status %d", code)))
+			}
+		}
+		meta.StatusCode = code
+		meta.RedirectURL = location
+		meta.Sent = true
+		meta.SentData = nil
+		meta.SentHasData = false
+		return goja.Undefined()
+	})
 	_ = resObj.Set("throws", throwsFn)
 
 	_ = contextObj.Set("req", ctx.Req)
@@ -254,9 +316,11 @@ func (h *Handler) installRuntimeGlobals(
 		serviceName := strings.TrimSpace(call.Argument(0).String())
 		switch serviceName {
 		case "http":
-			return h.resolvedPromise(vm, h.createHTTPService(vm))
+			return h.resolvedPromise(vm, h.createHTTPService(traceCtx, vm))
 		case "config":
 			return h.resolvedPromise(vm, h.createConfigService(vm))
+		case "ai":
+			return h.resolvedPromise(vm, h.createAIService(traceCtx, vm))
 		default:
 			return h.rejectedPromise(vm, map[string]interface{}{
 				"message": fmt.Sprintf("service %q is not available", serviceName),
@@ -334,17 +398,41 @@ func (h *Handler) resolveResultValue(value goja.Value) (interface{}, bool, error
 }
 
 func (h *Handler) normalizeRuntimeError(err error, timeoutReason string) error {
+	if errors.Is(err, errExecutionTimeout) {
+		return &runtimeExecError{
+			Status:      http.StatusGatewayTimeout,
+			Message:     errExecutionTimeout.Error(),
+			Interrupted: true,
+		}
+	}
+	if errors.Is(err, errMemoryLimit) {
+		return &runtimeExecError{
+			Status:      http.StatusRequestEntityTooLarge,
+			Message:     errMemoryLimit.Error(),
+			Interrupted: true,
+		}
+	}
+
 	var interrupted *goja.InterruptedError
 	if errors.As(err, &interrupted) {
+		if interrupted.Value() == memoryLimitReason {
+			return h.normalizeRuntimeError(errMemoryLimit, timeoutReason)
+		}
 		if interrupted.Value() == timeoutReason {
-			return &runtimeExecError{
-				Status:  http.StatusGatewayTimeout,
-				Message: "serverless function execution timeout",
-			}
+			return h.normalizeRuntimeError(errExecutionTimeout, timeoutReason)
 		}
+		return &runtimeExecError{
+			Status:      http.StatusInternalServerError,
+			Message:     "serverless execution interrupted",
+			Interrupted: true,
+		}
+	}
+
+	var overflow *goja.StackOverflowError
+	if errors.As(err, &overflow) {
 		return &runtimeExecError{
 			Status:  http.StatusInternalServerError,
-			Message: "serverless execution interrupted",
+			Message: "maximum call stack size exceeded",
 		}
 	}
 
@@ -382,6 +470,12 @@ func parseRuntimeErrorValue(value goja.Value) (string, int) {
 		if msg == "" {
 			msg = toString(v["error"])
 		}
+		// Error instances export as an empty map: message is not enumerable.
+		if obj, ok := value.(*goja.Object); ok && msg == "" {
+			if m := obj.Get("message"); m != nil && !goja.IsUndefined(m) {
+				msg = m.String()
+			}
+		}
 		if msg == "" {
 			msg = fmt.Sprintf("%v", exported)
 		}
@@ -469,20 +563,27 @@ func exportMapValue(value goja.Value) map[string]interface{} {
 	return asMap
 }
 
-func (h *Handler) createRuntimeConsoleMethod(namespace, level string) func(goja.FunctionCall) goja.Value {
+func (h *Handler) createRuntimeConsoleMethod(snippetID, namespace, traceID, level string) func(goja.FunctionCall) goja.Value {
 	return func(call goja.FunctionCall) goja.Value {
-		h.runtimeConsolePrint(namespace, level, call.Arguments)
+		h.runtimeConsolePrint(snippetID, namespace, traceID, level, call.Arguments)
 		return goja.Undefined()
 	}
 }
 
-func (h *Handler) runtimeConsolePrint(namespace, level string, args []goja.Value) {
-	parts := make([]string, 0, len(args)+1)
-	parts = append(parts, fmt.Sprintf("[sandbox:%s]", namespace))
+// runtimeConsolePrint writes a console call to stdout/stderr and keeps it in the
+// snippet's log buffer.
+func (h *Handler) runtimeConsolePrint(snippetID, namespace, traceID, level string, args []goja.Value) {
+	parts := make([]string, 0, len(args))
 	for _, arg := range args {
 		parts = append(parts, runtimeConsoleValueToString(exportJSValue(arg)))
 	}
-	line := strings.Join(parts, " ")
+	message := strings.Join(parts, " ")
+	consoleLogs.append(snippetID, ConsoleLogEntry{Time: time.Now(), Level: level, Message: message, TraceID: traceID})
+
+	line := fmt.Sprintf("[sandbox:%s] %s", namespace, message)
+	if traceID != "" {
+		line = fmt.Sprintf("[sandbox:%s] [%s] %s", namespace, traceID, message)
+	}
 	switch level {
 	case "warn", "error":
 		_, _ = fmt.Fprintln(os.Stderr, line)
@@ -542,6 +643,12 @@ func (h *Handler) writeServerlessResponse(c *gin.Context, out *executorResult) {
 		c.Header("Content-Type", contentType)
 	}
 
+	if out != nil && out.meta.RedirectURL != "" {
+		c.Header("Location", out.meta.RedirectURL)
+		c.Status(statusCode)
+		return
+	}
+
 	if out == nil || !out.hasData {
 		c.Status(statusCode)
 		return
@@ -556,7 +663,10 @@ func (h *Handler) writeServerlessResponse(c *gin.Context, out *executorResult) {
 	case string:
 		c.String(statusCode, payload)
 	default:
-		c.JSON(statusCode, payload)
+		if contentType == "" {
+			contentType = "application/json; charset=utf-8"
+		}
+		c.Data(statusCode, contentType, out.encoded)
 	}
 }
 
@@ -2,6 +2,7 @@ package serverless
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,24 +15,24 @@ import (
 	"gorm.io/gorm"
 )
 
-func (h *Handler) createHTTPService(vm *goja.Runtime) *goja.Object {
+func (h *Handler) createHTTPService(ctx context.Context, vm *goja.Runtime) *goja.Object {
 	serviceObj := vm.NewObject()
 	axiosObj := vm.NewObject()
 
 	_ = axiosObj.Set("get", func(call goja.FunctionCall) goja.Value {
-		return h.axiosPromise(vm, http.MethodGet, call.Argument(0), goja.Undefined(), call.Argument(1))
+		return h.axiosPromise(ctx, vm, http.MethodGet, call.Argument(0), goja.Undefined(), call.Argument(1))
 	})
 	_ = axiosObj.Set("delete", func(call goja.FunctionCall) goja.Value {
-		return h.axiosPromise(vm, http.MethodDelete, call.Argument(0), goja.Undefined(), call.Argument(1))
+		return h.axiosPromise(ctx, vm, http.MethodDelete, call.Argument(0), goja.Undefined(), call.Argument(1))
 	})
 	_ = axiosObj.Set("post", func(call goja.FunctionCall) goja.Value {
-		return h.axiosPromise(vm, http.MethodPost, call.Argument(0), call.Argument(1), call.Argument(2))
+		return h.axiosPromise(ctx, vm, http.MethodPost, call.Argument(0), call.Argument(1), call.Argument(2))
 	})
 	_ = axiosObj.Set("put", func(call goja.FunctionCall) goja.Value {
-		return h.axiosPromise(vm, http.MethodPut, call.Argument(0), call.Argument(1), call.Argument(2))
+		return h.axiosPromise(ctx, vm, http.MethodPut, call.Argument(0), call.Argument(1), call.Argument(2))
 	})
 	_ = axiosObj.Set("patch", func(call goja.FunctionCall) goja.Value {
-		return h.axiosPromise(vm, http.MethodPatch, call.Argument(0), call.Argument(1), call.Argument(2))
+		return h.axiosPromise(ctx, vm, http.MethodPatch, call.Argument(0), call.Argument(1), call.Argument(2))
 	})
 	_ = axiosObj.Set("request", func(call goja.FunctionCall) goja.Value {
 		cfg := exportMapValue(call.Argument(0))
@@ -46,7 +47,7 @@ func (h *Handler) createHTTPService(vm *goja.Runtime) *goja.Object {
 		if rawURL == "" {
 			return h.rejectedPromise(vm, map[string]interface{}{"message": "request url is required"})
 		}
-		return h.axiosPromiseFromParts(vm, method, rawURL, cfg["data"], cfg)
+		return h.axiosPromiseFromParts(ctx, vm, method, rawURL, cfg["data"], cfg)
 	})
 
 	_ = serviceObj.Set("axios", axiosObj)
@@ -54,6 +55,7 @@ func (h *Handler) createHTTPService(vm *goja.Runtime) *goja.Object {
 }
 
 func (h *Handler) axiosPromise(
+	ctx context.Context,
 	vm *goja.Runtime,
 	method string,
 	urlValue goja.Value,
@@ -70,17 +72,18 @@ func (h *Handler) axiosPromise(
 		data = exportJSValue(dataValue)
 	}
 	config := exportMapValue(configValue)
-	return h.axiosPromiseFromParts(vm, method, rawURL, data, config)
+	return h.axiosPromiseFromParts(ctx, vm, method, rawURL, data, config)
 }
 
 func (h *Handler) axiosPromiseFromParts(
+	ctx context.Context,
 	vm *goja.Runtime,
 	method string,
 	rawURL string,
 	data interface{},
 	config map[string]interface{},
 ) goja.Value {
-	result, err := h.doAxiosRequest(method, rawURL, data, config)
+	result, err := h.doAxiosRequest(ctx, method, rawURL, data, config)
 	if err != nil {
 		if reqErr, ok := err.(*axiosRequestError); ok {
 			return h.rejectedPromise(vm, map[string]interface{}{
@@ -94,6 +97,7 @@ func (h *Handler) axiosPromiseFromParts(
 }
 
 func (h *Handler) doAxiosRequest(
+	ctx context.Context,
 	method string,
 	rawURL string,
 	data interface{},
@@ -144,21 +148,12 @@ func (h *Handler) doAxiosRequest(
 		}
 	}
 
-	req, err := http.NewRequest(method, parsedURL.String(), bodyReader)
-	if err != nil {
-		return nil, err
-	}
+	header := http.Header{}
 	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+		header.Set(k, v)
 	}
-	defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	resp, bodyBytes, err := h.doHTTPRequest(ctx, method, parsedURL.String(), header, bodyReader, "follow")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,275 @@
+package serverless
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/mx-space/core/internal/pkg/tracing"
+)
+
+const (
+	defaultFetchMaxBytes int64 = 10 << 20
+	fetchMaxRedirects          = 20
+)
+
+type fetchRequest struct {
+	method   string
+	url      string
+	headers  http.Header
+	body     []byte
+	hasBody  bool
+	redirect string
+}
+
+// fetch implements the WHATWG fetch() global on top of h.httpClient. The request
+// runs off the VM's goroutine and the returned promise settles through loop, so
+// timers and other requests proceed meanwhile. Network failures reject with a
+// TypeError like browsers do, HTTP error statuses resolve.
+func (h *Handler) fetch(ctx context.Context, vm *goja.Runtime, loop *eventLoop, input goja.Value, init goja.Value) goja.Value {
+	req, err := parseFetchRequest(vm, input, init)
+	if err != nil {
+		return h.rejectedPromise(vm, vm.NewTypeError(err.Error()))
+	}
+
+	promise, resolve, reject := vm.NewPromise()
+	loop.spawn(ctx, func(ctx context.Context) func() error {
+		var bodyReader io.Reader
+		if req.hasBody {
+			bodyReader = bytes.NewReader(req.body)
+		}
+		resp, body, err := h.doHTTPRequest(ctx, req.method, req.url, req.headers, bodyReader, req.redirect)
+		return func() error {
+			if err != nil {
+				return reject(vm.NewTypeError("fetch failed: " + err.Error()))
+			}
+			return resolve(h.newFetchResponse(vm, resp, req.url, body))
+		}
+	})
+	return vm.ToValue(promise)
+}
+
+// doHTTPRequest sends a snippet request through h.httpClient with the serverless
+// execution timeout and reads at most fetchMaxBytes of the response. fetch() and
+// the axios service both go through it. The body is already drained and closed.
+func (h *Handler) doHTTPRequest(parent context.Context, method, rawURL string, header http.Header, body io.Reader, redirect string) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(parent, serverlessExecutionTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header = header
+	tracing.Inject(req)
+
+	client := *h.httpClient
+	client.Timeout = 0
+	client.CheckRedirect = func(_ *http.Request, via []*http.Request) error {
+		switch redirect {
+		case "manual":
+			return http.ErrUseLastResponse
+		case "error":
+			return errors.New("unexpected redirect")
+		}
+		if len(via) >= fetchMaxRedirects {
+			return errors.New("too many redirects")
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	maxBytes := h.fetchMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultFetchMaxBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, nil, fmt.Errorf("response body exceeds %d bytes", maxBytes)
+	}
+	return resp, data, nil
+}
+
+func parseFetchRequest(vm *goja.Runtime, input goja.Value, init goja.Value) (*fetchRequest, error) {
+	req := &fetchRequest{method: http.MethodGet, headers: http.Header{}, redirect: "follow"}
+
+	// Accept a string, a URL-like object with href, or a Request-like object with url.
+	rawURL := ""
+	if obj, ok := input.(*goja.Object); ok {
+		for _, key := range []string{"href", "url"} {
+			if v := obj.Get(key); v != nil && !goja.IsUndefined(v) {
+				rawURL = v.String()
+				break
+			}
+		}
+	}
+	if rawURL == "" && input != nil && !goja.IsUndefined(input) && !goja.IsNull(input) {
+		rawURL = input.String()
+	}
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url: %s", rawURL)
+	}
+	req.url = parsed.String()
+
+	opts, ok := init.(*goja.Object)
+	if !ok || goja.IsNull(init) {
+		return req, nil
+	}
+	if v := opts.Get("method"); v != nil && !goja.IsUndefined(v) {
+		req.method = strings.ToUpper(strings.TrimSpace(v.String()))
+	}
+	if v := opts.Get("headers"); v != nil {
+		for k, value := range toStringMap(exportMapValue(v)) {
+			req.headers.Set(k, value)
+		}
+	}
+	if v := opts.Get("redirect"); v != nil && !goja.IsUndefined(v) {
+		switch mode := v.String(); mode {
+		case "follow", "manual", "error":
+			req.redirect = mode
+		default:
+			return nil, fmt.Errorf("invalid redirect mode: %s", mode)
+		}
+	}
+
+	bodyValue := opts.Get("body")
+	if bodyValue == nil || goja.IsUndefined(bodyValue) || goja.IsNull(bodyValue) {
+		return req, nil
+	}
+	if req.method == http.MethodGet || req.method == http.MethodHead {
+		return nil, fmt.Errorf("request with %s method cannot have body", req.method)
+	}
+	req.hasBody = true
+	contentType := ""
+	if data, ok := bufferBytes(bodyValue); ok {
+		req.body = data
+	} else {
+		switch v := bodyValue.Export().(type) {
+		case string:
+			req.body = []byte(v)
+			contentType = "text/plain;charset=UTF-8"
+		case goja.ArrayBuffer:
+			req.body = v.Bytes()
+		default:
+			payload, err := json.Marshal(exportJSValue(bodyValue))
+			if err != nil {
+				return nil, err
+			}
+			req.body = payload
+			contentType = "application/json"
+		}
+	}
+	if contentType != "" && req.headers.Get("Content-Type") == "" {
+		req.headers.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+func (h *Handler) newFetchResponse(vm *goja.Runtime, resp *http.Response, requestURL string, body []byte) *goja.Object {
+	finalURL := requestURL
+	if resp.Request != nil && resp.Request.URL != nil {
+		finalURL = resp.Request.URL.String()
+	}
+
+	out := vm.NewObject()
+	_ = out.Set("status", resp.StatusCode)
+	_ = out.Set("statusText", http.StatusText(resp.StatusCode))
+	_ = out.Set("ok", resp.StatusCode >= 200 && resp.StatusCode < 300)
+	_ = out.Set("url", finalURL)
+	_ = out.Set("redirected", finalURL != requestURL)
+	_ = out.Set("headers", newFetchHeaders(vm, resp.Header))
+
+	bodyUsed := false
+	consume := func(fn func() goja.Value) goja.Value {
+		if bodyUsed {
+			return h.rejectedPromise(vm, vm.NewTypeError("body has already been consumed"))
+		}
+		bodyUsed = true
+		_ = out.Set("bodyUsed", true)
+		return fn()
+	}
+	_ = out.Set("bodyUsed", false)
+	_ = out.Set("text", func(goja.FunctionCall) goja.Value {
+		return consume(func() goja.Value {
+			return h.resolvedPromise(vm, strings.ToValidUTF8(string(body), "�"))
+		})
+	})
+	_ = out.Set("json", func(goja.FunctionCall) goja.Value {
+		return consume(func() goja.Value {
+			parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+			value, err := parse(goja.Undefined(), vm.ToValue(string(body)))
+			if err != nil {
+				var ex *goja.Exception
+				if errors.As(err, &ex) {
+					return h.rejectedPromise(vm, ex.Value())
+				}
+				return h.rejectedPromise(vm, vm.NewTypeError(err.Error()))
+			}
+			return h.resolvedPromise(vm, value)
+		})
+	})
+	_ = out.Set("arrayBuffer", func(goja.FunctionCall) goja.Value {
+		return consume(func() goja.Value {
+			return h.resolvedPromise(vm, vm.NewArrayBuffer(body))
+		})
+	})
+	return out
+}
+
+// newFetchHeaders exposes response headers with the read-only part of the Headers API.
+func newFetchHeaders(vm *goja.Runtime, header http.Header) *goja.Object {
+	obj := vm.NewObject()
+	get := func(name string) (string, bool) {
+		values := header.Values(name)
+		if len(values) == 0 {
+			return "", false
+		}
+		return strings.Join(values, ", "), true
+	}
+	_ = obj.Set("get", func(call goja.FunctionCall) goja.Value {
+		if value, ok := get(call.Argument(0).String()); ok {
+			return vm.ToValue(value)
+		}
+		return goja.Null()
+	})
+	_ = obj.Set("has", func(call goja.FunctionCall) goja.Value {
+		_, ok := get(call.Argument(0).String())
+		return vm.ToValue(ok)
+	})
+	_ = obj.Set("forEach", func(call goja.FunctionCall) goja.Value {
+		fn, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(vm.NewTypeError("callback is not a function"))
+		}
+		names := make([]string, 0, len(header))
+		for name := range header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value, _ := get(name)
+			if _, err := fn(call.Argument(1), vm.ToValue(value), vm.ToValue(strings.ToLower(name)), obj); err != nil {
+				panic(err)
+			}
+		}
+		return goja.Undefined()
+	})
+	return obj
+}
@@ -0,0 +1,54 @@
+package serverless
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchDoesNotBlockTheEventLoop(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	h := NewHandler(nil, nil, nil)
+	// The default transport refuses loopback addresses.
+	h.httpClient.Transport = http.DefaultTransport
+
+	out, err := runSnippet(t, h, `export default async function handler() {
+  const order = []
+  const req = fetch("`+srv.URL+`").then((r) => r.text()).then((t) => order.push("fetch:" + t))
+  await new Promise((resolve) => setTimeout(() => { order.push("timer"); resolve() }, 10))
+  await req
+  return order.join(",")
+}`)
+	if err != nil {
+		t.Fatalf("executeSnippet: %v", err)
+	}
+	if out.data != "timer,fetch:ok" {
+		t.Fatalf("data = %v, want the timer to fire while the request is in flight", out.data)
+	}
+}
+
+func TestFetchRejectsNetworkErrors(t *testing.T) {
+	h := NewHandler(nil, nil, nil)
+	h.httpClient.Transport = http.DefaultTransport
+
+	out, err := runSnippet(t, h, `export default async function handler() {
+  try {
+    await fetch("http://127.0.0.1:1/")
+    return "resolved"
+  } catch (e) {
+    return e instanceof TypeError ? "TypeError" : String(e)
+  }
+}`)
+	if err != nil {
+		t.Fatalf("executeSnippet: %v", err)
+	}
+	if out.data != "TypeError" {
+		t.Fatalf("data = %v, want TypeError", out.data)
+	}
+}
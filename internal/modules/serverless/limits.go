@@ -0,0 +1,75 @@
+package serverless
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	defaultMaxMemoryBytes   int64 = 128 << 20
+	defaultMaxResponseBytes int64 = 10 << 20
+	serverlessMaxCallStack        = 1024
+)
+
+var (
+	errExecutionTimeout = errors.New("serverless function execution timeout")
+	errMemoryLimit      = errors.New("serverless function exceeded the memory limit")
+)
+
+// errResponseTooLarge is returned by limitWriter once the limit is crossed, which
+// aborts JSON encoding early instead of serializing the whole value.
+var errResponseTooLarge = errors.New("response too large")
+
+type limitWriter struct {
+	buf   bytes.Buffer
+	limit int64
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if int64(w.buf.Len()+len(p)) > w.limit {
+		return 0, errResponseTooLarge
+	}
+	return w.buf.Write(p)
+}
+
+// encodeResponse enforces the response limit and serializes results that are
+// not already a string or []byte, so writeServerlessResponse can send the bytes
+// as they are instead of encoding the value a second time.
+func (h *Handler) encodeResponse(data interface{}) ([]byte, error) {
+	limit := h.maxResponseBytes
+	if limit <= 0 {
+		limit = defaultMaxResponseBytes
+	}
+	tooLarge := &runtimeExecError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: fmt.Sprintf("serverless function response exceeds %d bytes", limit),
+	}
+	switch v := data.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if int64(len(v)) > limit {
+			return nil, tooLarge
+		}
+		return nil, nil
+	case []byte:
+		if int64(len(v)) > limit {
+			return nil, tooLarge
+		}
+		return nil, nil
+	}
+	w := &limitWriter{limit: limit}
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		if errors.Is(err, errResponseTooLarge) {
+			return nil, tooLarge
+		}
+		return nil, &runtimeExecError{
+			Status:  http.StatusInternalServerError,
+			Message: fmt.Sprintf("failed to encode serverless function response: %v", err),
+		}
+	}
+	return bytes.TrimSuffix(w.buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,132 @@
+package serverless
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/response"
+	"gorm.io/gorm"
+)
+
+const (
+	// consoleLogLimit is how many console lines are kept per snippet.
+	consoleLogLimit = 200
+	// consoleMessageLimit caps the bytes kept of one console line.
+	consoleMessageLimit = 4 << 10
+	// consoleSnippetLimit caps how many snippets have a buffer; the one
+	// written least recently is dropped to make room.
+	consoleSnippetLimit = 256
+)
+
+// ConsoleLogEntry is one console call made by a snippet.
+type ConsoleLogEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	// TraceID is the request, or scheduled run, that printed the line.
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// consoleLogStore keeps the latest console lines of every snippet in per-snippet
+// ring buffers. It lives in process memory, so each cluster worker only sees the
+// executions it ran.
+type consoleLogStore struct {
+	mu    sync.Mutex
+	limit int
+	rings map[string]*consoleRing
+}
+
+type consoleRing struct {
+	entries   []ConsoleLogEntry
+	next      int
+	full      bool
+	writtenAt time.Time
+}
+
+// consoleLogs is shared by every Handler so scheduled runs show up next to HTTP ones.
+var consoleLogs = newConsoleLogStore(consoleLogLimit)
+
+func newConsoleLogStore(limit int) *consoleLogStore {
+	return &consoleLogStore{limit: limit, rings: map[string]*consoleRing{}}
+}
+
+func (s *consoleLogStore) append(snippetID string, entry ConsoleLogEntry) {
+	if snippetID == "" {
+		return
+	}
+	if len(entry.Message) > consoleMessageLimit {
+		entry.Message = strings.ToValidUTF8(entry.Message[:consoleMessageLimit], "") + "…(truncated)"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring := s.rings[snippetID]
+	if ring == nil {
+		if len(s.rings) >= consoleSnippetLimit {
+			s.evictOldestLocked()
+		}
+		ring = &consoleRing{entries: make([]ConsoleLogEntry, s.limit)}
+		s.rings[snippetID] = ring
+	}
+	ring.writtenAt = entry.Time
+	ring.entries[ring.next] = entry
+	ring.next = (ring.next + 1) % s.limit
+	if ring.next == 0 {
+		ring.full = true
+	}
+}
+
+func (s *consoleLogStore) evictOldestLocked() {
+	oldest := ""
+	for id, ring := range s.rings {
+		if oldest == "" || ring.writtenAt.Before(s.rings[oldest].writtenAt) {
+			oldest = id
+		}
+	}
+	delete(s.rings, oldest)
+}
+
+// forget drops the buffer of a deleted snippet.
+func (s *consoleLogStore) forget(snippetID string) {
+	s.mu.Lock()
+	delete(s.rings, snippetID)
+	s.mu.Unlock()
+}
+
+// list returns up to limit of the latest entries, oldest first.
+func (s *consoleLogStore) list(snippetID string, limit int) []ConsoleLogEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []ConsoleLogEntry{}
+	ring := s.rings[snippetID]
+	if ring == nil {
+		return out
+	}
+	if ring.full {
+		out = append(out, ring.entries[ring.next:]...)
+	}
+	out = append(out, ring.entries[:ring.next]...)
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// GET /serverless/logs/:id?limit= — latest console output of a function.
+func (h *Handler) listLogs(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+	var snippet models.SnippetModel
+	if err := h.db.Select("id").First(&snippet, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.NotFoundMsg(c, "函数不存在")
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	response.OK(c, consoleLogs.list(snippet.ID, limit))
+}
@@ -0,0 +1,347 @@
+package serverless
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+const (
+	// memoryCheckInterval is the least time between two measurements; a
+	// measurement that took long pushes the next one further out.
+	memoryCheckInterval = 10 * time.Millisecond
+	memoryLimitReason   = "serverless-memory-limit"
+
+	// memoryTickName is the global the instrumented code calls at every loop
+	// iteration and function entry.
+	memoryTickName = "__mx_tick"
+)
+
+// memoryMeter enforces the per-execution memory limit. Go cannot attribute heap
+// allocations to one goroutine, so instead every value the execution's VM can
+// reach is sized. That is only safe on the goroutine running the VM, which is
+// why snippets are instrumented to call back into the meter (see
+// instrumentSnippet) rather than being sampled from a watchdog.
+type memoryMeter struct {
+	vm    *goja.Runtime
+	loop  *eventLoop
+	limit int64
+
+	baseline int64
+	next     time.Time
+	sizer    heapSizer
+}
+
+func newMemoryMeter(vm *goja.Runtime, loop *eventLoop, limit int64) *memoryMeter {
+	if limit <= 0 {
+		limit = defaultMaxMemoryBytes
+	}
+	return &memoryMeter{vm: vm, loop: loop, limit: limit}
+}
+
+// install defines the tick function, read-only so snippets cannot replace it.
+func (m *memoryMeter) install() {
+	_ = m.vm.GlobalObject().DefineDataProperty(memoryTickName, m.vm.ToValue(func(goja.FunctionCall) goja.Value {
+		m.tick()
+		return goja.Undefined()
+	}), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+}
+
+// start records what the VM holds before the snippet runs; the limit applies to
+// growth past it.
+func (m *memoryMeter) start() {
+	m.baseline = m.measure()
+	m.next = time.Now().Add(memoryCheckInterval)
+}
+
+func (m *memoryMeter) tick() {
+	now := time.Now()
+	if now.Before(m.next) {
+		return
+	}
+	used := m.measure()
+	took := time.Since(now)
+	m.next = time.Now().Add(max(memoryCheckInterval, 4*took))
+	if used-m.baseline > m.limit {
+		m.vm.Interrupt(memoryLimitReason)
+		m.loop.interrupt(errMemoryLimit)
+	}
+}
+
+// measure sizes the VM plus the arguments of pending timers, which the VM
+// itself does not reference.
+func (m *memoryMeter) measure() int64 {
+	roots := []reflect.Value{reflect.ValueOf(m.vm)}
+	for _, t := range m.loop.timers {
+		roots = append(roots, reflect.ValueOf(t.args))
+	}
+	return m.sizer.size(roots)
+}
+
+// gojaPkg prefixes the packages whose types heapSizer descends into. Anything
+// else a goja value refers to (wrapped Go values, reflect metadata, regexp and
+// collation state) is shared with the host or bounded, so it is not counted.
+const gojaPkg = "github.com/dop251/goja"
+
+// heapSizer approximates the bytes reachable from a set of roots, counting each
+// pointer target, slice backing array, map and string once.
+type heapSizer struct {
+	seen  map[uintptr]struct{}
+	stack []reflect.Value
+}
+
+func (s *heapSizer) size(roots []reflect.Value) int64 {
+	if s.seen == nil {
+		s.seen = map[uintptr]struct{}{}
+	}
+	clear(s.seen)
+	s.stack = append(s.stack[:0], roots...)
+
+	var total int64
+	for len(s.stack) > 0 {
+		v := s.stack[len(s.stack)-1]
+		s.stack = s.stack[:len(s.stack)-1]
+		if !v.IsValid() || !sizerFollows(v.Type()) {
+			continue
+		}
+		switch v.Kind() {
+		case reflect.Pointer:
+			if v.IsNil() || !s.mark(v.Pointer()) {
+				continue
+			}
+			total += int64(v.Type().Elem().Size())
+			s.push(v.Elem())
+		case reflect.Interface:
+			if !v.IsNil() {
+				s.stack = append(s.stack, v.Elem())
+			}
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				s.push(v.Field(i))
+			}
+		case reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				s.push(v.Index(i))
+			}
+		case reflect.Slice:
+			if v.IsNil() || !s.mark(v.Pointer()) {
+				continue
+			}
+			total += int64(v.Cap()) * int64(v.Type().Elem().Size())
+			for i := 0; i < v.Len(); i++ {
+				s.push(v.Index(i))
+			}
+		case reflect.Map:
+			if v.IsNil() || !s.mark(v.Pointer()) {
+				continue
+			}
+			t := v.Type()
+			total += int64(v.Len()) * int64(t.Key().Size()+t.Elem().Size())
+			iter := v.MapRange()
+			for iter.Next() {
+				s.push(iter.Key())
+				s.push(iter.Value())
+			}
+		case reflect.String:
+			str := v.String()
+			if len(str) > 0 && s.mark(uintptr(unsafe.Pointer(unsafe.StringData(str)))) {
+				total += int64(len(str))
+			}
+		}
+	}
+	return total
+}
+
+// push queues v unless it cannot refer to anything.
+func (s *heapSizer) push(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Struct, reflect.Array,
+		reflect.Slice, reflect.Map, reflect.String:
+		s.stack = append(s.stack, v)
+	}
+}
+
+func (s *heapSizer) mark(p uintptr) bool {
+	if _, ok := s.seen[p]; ok {
+		return false
+	}
+	s.seen[p] = struct{}{}
+	return true
+}
+
+var sizerFollowsCache sync.Map // reflect.Type -> bool
+
+// sizerFollows reports whether values of type t belong to the VM: goja's own
+// types and unnamed composites of them.
+func sizerFollows(t reflect.Type) bool {
+	if follows, ok := sizerFollowsCache.Load(t); ok {
+		return follows.(bool)
+	}
+	var follows bool
+	switch {
+	case t.Name() != "" && t.PkgPath() != "":
+		follows = strings.HasPrefix(t.PkgPath(), gojaPkg)
+	case t.Kind() == reflect.Pointer, t.Kind() == reflect.Slice, t.Kind() == reflect.Array:
+		follows = sizerFollows(t.Elem())
+	case t.Kind() == reflect.Map:
+		follows = sizerFollows(t.Key()) && sizerFollows(t.Elem())
+	default:
+		follows = t.Kind() != reflect.Func && t.Kind() != reflect.Chan && t.Kind() != reflect.UnsafePointer
+	}
+	sizerFollowsCache.Store(t, follows)
+	return follows
+}
+
+// instrumentSnippet inserts a call to the memory meter's tick at the start of
+// every loop body and function body, so a snippet cannot allocate for long
+// without the meter getting a chance to measure it.
+func instrumentSnippet(code string) (string, error) {
+	if strings.Contains(code, memoryTickName) {
+		return "", fmt.Errorf("identifier %s is reserved", memoryTickName)
+	}
+	program, err := parser.ParseFile(nil, "", code, 0)
+	if err != nil {
+		// Leave the syntax error to the VM, which reports it like any other.
+		return code, nil
+	}
+
+	var edits []sourceEdit
+	tick := memoryTickName + "();"
+	wrapBody := func(body ast.Statement) {
+		if block, ok := body.(*ast.BlockStatement); ok {
+			edits = append(edits, sourceEdit{at: int(block.LeftBrace), text: tick})
+			return
+		}
+		edits = append(edits,
+			sourceEdit{at: statementStart(code, body), text: "{" + tick},
+			sourceEdit{at: statementEnd(code, body), text: "}"},
+		)
+	}
+	visitAST(reflect.ValueOf(program), map[uintptr]bool{}, func(node any) {
+		switch n := node.(type) {
+		case *ast.ForStatement:
+			wrapBody(n.Body)
+		case *ast.ForInStatement:
+			wrapBody(n.Body)
+		case *ast.ForOfStatement:
+			wrapBody(n.Body)
+		case *ast.WhileStatement:
+			wrapBody(n.Body)
+		case *ast.DoWhileStatement:
+			wrapBody(n.Body)
+		case *ast.FunctionLiteral:
+			edits = append(edits, functionEntry(n.Body, tick))
+		case *ast.ArrowFunctionLiteral:
+			switch body := n.Body.(type) {
+			case *ast.BlockStatement:
+				edits = append(edits, functionEntry(body, tick))
+			case *ast.ExpressionBody:
+				edits = append(edits,
+					sourceEdit{at: int(body.Expression.Idx0()) - 1, text: "(" + memoryTickName + "(),"},
+					sourceEdit{at: int(body.Expression.Idx1()) - 1, text: ")"},
+				)
+			}
+		}
+	})
+	return applySourceEdits(code, edits), nil
+}
+
+// functionEntry places the tick after the body's directive prologue, so a
+// "use strict" keeps its meaning.
+func functionEntry(body *ast.BlockStatement, tick string) sourceEdit {
+	at := int(body.LeftBrace)
+	for _, stmt := range body.List {
+		expr, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			break
+		}
+		if _, ok := expr.Expression.(*ast.StringLiteral); !ok {
+			break
+		}
+		at = int(stmt.Idx1()) - 1
+		tick = ";" + tick
+	}
+	return sourceEdit{at: at, text: tick}
+}
+
+// statementStart is the offset where stmt begins. goja leaves the position of
+// an if statement unset, so that one is found before its test.
+func statementStart(code string, stmt ast.Statement) int {
+	if n, ok := stmt.(*ast.IfStatement); ok {
+		return strings.LastIndex(code[:int(n.Test.Idx0())-1], "if")
+	}
+	return int(stmt.Idx0()) - 1
+}
+
+// statementEnd is the offset just past stmt, including the semicolon that goja
+// leaves out of expression, variable and jump statements.
+func statementEnd(code string, stmt ast.Statement) int {
+	end := int(stmt.Idx1()) - 1
+	rest := strings.TrimLeft(code[end:], " \t")
+	if strings.HasPrefix(rest, ";") {
+		end = len(code) - len(rest) + 1
+	}
+	return end
+}
+
+// sourceEdit inserts text before the byte at offset at.
+type sourceEdit struct {
+	at   int
+	text string
+}
+
+func applySourceEdits(code string, edits []sourceEdit) string {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].at < edits[j].at })
+	var b strings.Builder
+	b.Grow(len(code) + len(edits)*len(memoryTickName))
+	last := 0
+	for _, e := range edits {
+		b.WriteString(code[last:e.at])
+		b.WriteString(e.text)
+		last = e.at
+	}
+	b.WriteString(code[last:])
+	return b.String()
+}
+
+var astNodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// visitAST calls fn once for every node below v; goja's ast package has no
+// walker. Function declarations are reachable twice, from the statement list
+// and the hoisted declaration list, hence the seen set.
+func visitAST(v reflect.Value, seen map[uintptr]bool, fn func(any)) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Pointer {
+			if seen[v.Pointer()] {
+				return
+			}
+			seen[v.Pointer()] = true
+			if v.Type().Implements(astNodeType) {
+				fn(v.Interface())
+			}
+		}
+		visitAST(v.Elem(), seen, fn)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				visitAST(v.Field(i), seen, fn)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			visitAST(v.Index(i), seen, fn)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package serverless
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+func runSnippet(t *testing.T, h *Handler, raw string) (*executorResult, error) {
+	t.Helper()
+	snippet := testSnippet()
+	snippet.Raw = raw
+	return h.executeSnippet(snippet, runtimeContext{})
+}
+
+func TestMemoryLimitInterruptsSnippet(t *testing.T) {
+	h := NewHandler(nil, nil, nil)
+	h.maxMemoryBytes = 8 << 20
+
+	_, err := runSnippet(t, h, `export default function handler() {
+  const keep = []
+  for (let i = 0; i < 1000; i++) keep.push(String(i).repeat(1 << 20))
+  return keep.length
+}`)
+	var execErr *runtimeExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("err = %v, want a runtimeExecError", err)
+	}
+	if execErr.Status != http.StatusRequestEntityTooLarge || !execErr.Interrupted {
+		t.Fatalf("err = %+v, want an interrupted 413", execErr)
+	}
+}
+
+func TestMemoryLimitCountsOnlyWhatTheRunHolds(t *testing.T) {
+	h := NewHandler(nil, nil, nil)
+	h.maxMemoryBytes = 8 << 20
+
+	// Each string is garbage once the next iteration starts.
+	out, err := runSnippet(t, h, `export default function handler() {
+  let total = 0
+  for (let i = 0; i < 64; i++) total += "x".repeat(1 << 20).length
+  return total
+}`)
+	if err != nil {
+		t.Fatalf("executeSnippet: %v", err)
+	}
+	if out.data != int64(64<<20) {
+		t.Fatalf("data = %v, want %d", out.data, 64<<20)
+	}
+}
+
+func TestInstrumentSnippetKeepsSemantics(t *testing.T) {
+	src := `"use strict";
+var log = [];
+function visit(n) {
+  "use strict"
+  for (var i = 0; i < n; i++)
+    if (i % 2) log.push("odd" + i); else log.push("even" + i)
+  var j = 0
+  while (j < 2) j++
+  do j--; while (j > 0)
+  for (var k in { a: 1 }) log.push(k);
+  for (var v of [1, 2]) log.push(v)
+  return j
+}
+var twice = (x) => x * 2, pair = () => ({ a: 1 });
+class C { m() { return "m" } }
+visit(3);
+log.push(twice(2), pair().a, new C().m(), (function () { return this })() === undefined);
+log.join(",")`
+	want := "even0,odd1,even2,a,1,2,4,1,m,true"
+
+	instrumented, err := instrumentSnippet(src)
+	if err != nil {
+		t.Fatalf("instrumentSnippet: %v", err)
+	}
+	for _, code := range []string{src, instrumented} {
+		vm := goja.New()
+		ticks := 0
+		_ = vm.Set(memoryTickName, func() { ticks++ })
+		got, err := vm.RunString(code)
+		if err != nil {
+			t.Fatalf("run %q: %v", code, err)
+		}
+		if got.String() != want {
+			t.Fatalf("result = %q, want %q (code %q)", got, want, code)
+		}
+		if code == instrumented && ticks == 0 {
+			t.Fatalf("instrumented code never ticked: %q", code)
+		}
+	}
+}
+
+func TestInstrumentSnippetReservesTickName(t *testing.T) {
+	if _, err := instrumentSnippet("var " + memoryTickName + " = 1"); err == nil {
+		t.Fatal("expected the tick name to be reserved")
+	}
+}
@@ -0,0 +1,370 @@
+package serverless
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/models"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Execution metrics are kept per snippet in hourly Redis hashes holding counters
+// and a latency histogram, so percentiles over any window are a merge of buckets.
+const (
+	metricsKeyPrefix       = "mx:serverless:metrics:"
+	metricsRetention       = 8 * 24 * time.Hour
+	metricsFlushInterval   = 5 * time.Second
+	metricsBufferSize      = 1024
+	defaultSlowThreshold   = 3 * time.Second
+	metricsFieldCount      = "count"
+	metricsFieldErrors     = "errors"
+	metricsFieldCacheHits  = "cache_hits"
+	metricsFieldInterrupts = "interrupted"
+	metricsFieldTotalMs    = "total_ms"
+	metricsFieldLastError  = "last_error"
+	metricsFieldLastErrAt  = "last_error_at"
+	metricsFieldStatus     = "status:"
+	metricsFieldBucket     = "bucket:"
+	metricsFieldOverflowed = "bucket:+inf"
+)
+
+// metricsBucketsMs are the upper bounds of the latency histogram buckets.
+var metricsBucketsMs = []int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+type executionMetric struct {
+	snippetID string
+	at        time.Time
+	duration  time.Duration
+	status    int
+	err       string
+	cacheHit  bool
+	// interrupted marks executions stopped by the timeout or memory limit.
+	interrupted bool
+}
+
+// metricsRecorder batches execution metrics in memory and writes them to Redis
+// every metricsFlushInterval. Recording never blocks: when the buffer is full
+// the sample is dropped.
+type metricsRecorder struct {
+	rc     *pkgredis.Client
+	logger *zap.Logger
+	ch     chan executionMetric
+	once   sync.Once
+}
+
+func newMetricsRecorder(rc *pkgredis.Client, logger *zap.Logger) *metricsRecorder {
+	return &metricsRecorder{rc: rc, logger: logger, ch: make(chan executionMetric, metricsBufferSize)}
+}
+
+func (r *metricsRecorder) record(m executionMetric) {
+	if r == nil || r.rc == nil || m.snippetID == "" {
+		return
+	}
+	r.once.Do(func() { go r.loop() })
+	select {
+	case r.ch <- m:
+	default:
+	}
+}
+
+func (r *metricsRecorder) loop() {
+	ticker := time.NewTicker(metricsFlushInterval)
+	defer ticker.Stop()
+
+	pending := make([]executionMetric, 0, metricsBufferSize)
+	for {
+		select {
+		case m := <-r.ch:
+			pending = append(pending, m)
+			if len(pending) < metricsBufferSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(pending) == 0 {
+				continue
+			}
+		}
+		r.flush(pending)
+		pending = pending[:0]
+	}
+}
+
+type metricsLastError struct {
+	message string
+	at      time.Time
+}
+
+func (r *metricsRecorder) flush(batch []executionMetric) {
+	incr := map[string]map[string]int64{}
+	lastErr := map[string]metricsLastError{}
+	for _, m := range batch {
+		key := metricsKey(m.snippetID, m.at)
+		fields := incr[key]
+		if fields == nil {
+			fields = map[string]int64{}
+			incr[key] = fields
+		}
+		ms := m.duration.Milliseconds()
+		fields[metricsFieldCount]++
+		fields[metricsFieldTotalMs] += ms
+		fields[metricsBucketField(ms)]++
+		fields[metricsFieldStatus+strconv.Itoa(m.status)]++
+		if m.cacheHit {
+			fields[metricsFieldCacheHits]++
+		}
+		if m.interrupted {
+			fields[metricsFieldInterrupts]++
+		}
+		if m.err != "" {
+			fields[metricsFieldErrors]++
+			lastErr[key] = metricsLastError{message: m.err, at: m.at}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pipe := r.rc.Raw().Pipeline()
+	for key, fields := range incr {
+		for field, n := range fields {
+			pipe.HIncrBy(ctx, key, field, n)
+		}
+		if e, ok := lastErr[key]; ok {
+			pipe.HSet(ctx, key, metricsFieldLastError, e.message, metricsFieldLastErrAt, e.at.UTC().Format(time.RFC3339))
+		}
+		pipe.Expire(ctx, key, metricsRetention)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logger.Warn("写入函数执行指标失败", zap.Error(err))
+	}
+}
+
+func metricsKey(snippetID string, at time.Time) string {
+	return metricsKeyPrefix + snippetID + ":" + at.UTC().Format("2006010215")
+}
+
+func metricsBucketField(ms int64) string {
+	for _, bound := range metricsBucketsMs {
+		if ms <= bound {
+			return metricsFieldBucket + strconv.FormatInt(bound, 10)
+		}
+	}
+	return metricsFieldOverflowed
+}
+
+// recordExecution stores the metrics of one execution and logs it when slow.
+func (h *Handler) recordExecution(snippet *models.SnippetModel, startedAt time.Time, out *executorResult, err error, cacheHit bool) {
+	duration := time.Since(startedAt)
+	status := 0
+	message := ""
+	interrupted := false
+	if err != nil {
+		status = http.StatusInternalServerError
+		message = err.Error()
+		var execErr *runtimeExecError
+		if asRuntimeExecError(err, &execErr) {
+			status = execErr.Status
+			message = execErr.Message
+			interrupted = execErr.Interrupted
+		}
+	} else if out != nil {
+		status = out.meta.StatusCode
+	}
+
+	h.metrics.record(executionMetric{
+		snippetID:   snippet.ID,
+		at:          startedAt,
+		duration:    duration,
+		status:      status,
+		err:         message,
+		cacheHit:    cacheHit,
+		interrupted: interrupted,
+	})
+
+	threshold := h.slowThreshold
+	if threshold <= 0 {
+		threshold = defaultSlowThreshold
+	}
+	if duration >= threshold {
+		h.logger.Warn("函数执行缓慢",
+			zap.String("namespace", snippetNamespace(snippet)),
+			zap.String("snippet_id", snippet.ID),
+			zap.Int64("duration_ms", duration.Milliseconds()),
+			zap.Int("status", status),
+			zap.Bool("cache_hit", cacheHit),
+		)
+	}
+}
+
+// MetricsWindow summarizes executions of a snippet over a time window.
+type MetricsWindow struct {
+	Invocations int64            `json:"invocations"`
+	Errors      int64            `json:"errors"`
+	CacheHits   int64            `json:"cache_hits"`
+	Interrupted int64            `json:"interrupted"`
+	ErrorRate   float64          `json:"error_rate"`
+	AvgMs       float64          `json:"avg_ms"`
+	P50Ms       float64          `json:"p50_ms"`
+	P95Ms       float64          `json:"p95_ms"`
+	Status      map[string]int64 `json:"status"`
+}
+
+// SnippetMetrics is the payload of GET /snippets/:id/metrics.
+type SnippetMetrics struct {
+	Last24h     MetricsWindow `json:"last_24h"`
+	Last7d      MetricsWindow `json:"last_7d"`
+	LastError   string        `json:"last_error,omitempty"`
+	LastErrorAt *time.Time    `json:"last_error_at,omitempty"`
+}
+
+// LoadSnippetMetrics reads the hourly buckets of the last 7 days for snippetID.
+// Metrics are only collected when Redis is available; without it the result is empty.
+func LoadSnippetMetrics(ctx context.Context, rc *pkgredis.Client, snippetID string) (*SnippetMetrics, error) {
+	out := &SnippetMetrics{
+		Last24h: MetricsWindow{Status: map[string]int64{}},
+		Last7d:  MetricsWindow{Status: map[string]int64{}},
+	}
+	if rc == nil {
+		return out, nil
+	}
+
+	now := time.Now()
+	const hours = 7 * 24
+	pipe := rc.Raw().Pipeline()
+	results := make([]*redis.MapStringStringCmd, 0, hours)
+	for i := 0; i < hours; i++ {
+		results = append(results, pipe.HGetAll(ctx, metricsKey(snippetID, now.Add(-time.Duration(i)*time.Hour))))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	day := newHistogram()
+	week := newHistogram()
+	for i, res := range results {
+		fields := res.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		week.add(fields, &out.Last7d)
+		if i < 24 {
+			day.add(fields, &out.Last24h)
+		}
+		if out.LastError == "" && fields[metricsFieldLastError] != "" {
+			out.LastError = fields[metricsFieldLastError]
+			if at, err := time.Parse(time.RFC3339, fields[metricsFieldLastErrAt]); err == nil {
+				out.LastErrorAt = &at
+			}
+		}
+	}
+	day.summarize(&out.Last24h)
+	week.summarize(&out.Last7d)
+	return out, nil
+}
+
+type histogram struct {
+	buckets  map[string]int64
+	totalMs  int64
+	observed int64
+}
+
+func newHistogram() *histogram {
+	return &histogram{buckets: map[string]int64{}}
+}
+
+func (h *histogram) add(fields map[string]string, w *MetricsWindow) {
+	for field, raw := range fields {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case field == metricsFieldCount:
+			w.Invocations += n
+		case field == metricsFieldErrors:
+			w.Errors += n
+		case field == metricsFieldCacheHits:
+			w.CacheHits += n
+		case field == metricsFieldInterrupts:
+			w.Interrupted += n
+		case field == metricsFieldTotalMs:
+			h.totalMs += n
+		case strings.HasPrefix(field, metricsFieldStatus):
+			w.Status[strings.TrimPrefix(field, metricsFieldStatus)] += n
+		case strings.HasPrefix(field, metricsFieldBucket):
+			h.buckets[field] += n
+			h.observed += n
+		}
+	}
+}
+
+func (h *histogram) summarize(w *MetricsWindow) {
+	if h.observed > 0 {
+		w.AvgMs = float64(h.totalMs) / float64(h.observed)
+	}
+	if w.Invocations > 0 {
+		w.ErrorRate = float64(w.Errors) / float64(w.Invocations)
+	}
+	w.P50Ms = h.quantile(0.5)
+	w.P95Ms = h.quantile(0.95)
+}
+
+// quantile interpolates linearly inside the bucket holding the q-th sample.
+// Samples beyond the last bound report that bound.
+func (h *histogram) quantile(q float64) float64 {
+	if h.observed == 0 {
+		return 0
+	}
+	rank := q * float64(h.observed)
+	var seen int64
+	var lower int64
+	for _, bound := range metricsBucketsMs {
+		n := h.buckets[metricsFieldBucket+strconv.FormatInt(bound, 10)]
+		if n > 0 && float64(seen+n) >= rank {
+			frac := (rank - float64(seen)) / float64(n)
+			return float64(lower) + frac*float64(bound-lower)
+		}
+		seen += n
+		lower = bound
+	}
+	return float64(metricsBucketsMs[len(metricsBucketsMs)-1])
+}
+
+type snippetStats struct {
+	ID        string `json:"id"`
+	Reference string `json:"reference"`
+	Name      string `json:"name"`
+	SnippetMetrics
+}
+
+// GET /serverless/stats — metrics of every function snippet, slowest (24h p95) first.
+func (h *Handler) stats(c *gin.Context) {
+	var snippets []models.SnippetModel
+	err := h.db.Select("id", "reference", "name").
+		Where("LOWER(type) = ?", string(snippetTypeFunction)).
+		Find(&snippets).Error
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+
+	out := make([]snippetStats, 0, len(snippets))
+	for _, snippet := range snippets {
+		metrics, err := LoadSnippetMetrics(c.Request.Context(), h.rc, snippet.ID)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		out = append(out, snippetStats{ID: snippet.ID, Reference: snippet.Reference, Name: snippet.Name, SnippetMetrics: *metrics})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Last24h.P95Ms > out[j].Last24h.P95Ms })
+	response.OK(c, out)
+}
@@ -0,0 +1,579 @@
+package serverless
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/google/uuid"
+	"golang.org/x/net/idna"
+)
+
+// sandboxModules are the Go-backed modules require() can resolve. Which of them a
+// deployment exposes is decided by the serverless_require_allowlist config key.
+var sandboxModules = map[string]func(h *Handler, vm *goja.Runtime) goja.Value{
+	"url": func(_ *Handler, vm *goja.Runtime) goja.Value {
+		out := vm.NewObject()
+		_ = out.Set("URLSearchParams", vm.Get("__mx_URLSearchParams"))
+		return out
+	},
+	"crypto": func(h *Handler, vm *goja.Runtime) goja.Value {
+		return h.newCryptoModule(vm)
+	},
+	"querystring": func(_ *Handler, vm *goja.Runtime) goja.Value {
+		return newQuerystringModule(vm)
+	},
+	"path": func(_ *Handler, vm *goja.Runtime) goja.Value {
+		return newPathModule(vm)
+	},
+	"buffer": func(_ *Handler, vm *goja.Runtime) goja.Value {
+		out := vm.NewObject()
+		_ = out.Set("Buffer", newBufferClass(vm))
+		return out
+	},
+	"punycode": func(_ *Handler, vm *goja.Runtime) goja.Value {
+		return newPunycodeModule(vm)
+	},
+}
+
+// defaultSandboxModules is the allowlist used when the config does not set one.
+var defaultSandboxModules = []string{"url", "crypto", "querystring", "path", "buffer"}
+
+func normalizeModuleName(name string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "node:")
+}
+
+// newModuleAllowlist resolves names against sandboxModules and returns the unknown ones.
+func newModuleAllowlist(names []string) (map[string]bool, []string) {
+	allowed := make(map[string]bool, len(names))
+	var unknown []string
+	for _, name := range names {
+		key := normalizeModuleName(name)
+		if key == "" {
+			continue
+		}
+		if _, ok := sandboxModules[key]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		allowed[key] = true
+	}
+	return allowed, unknown
+}
+
+// requireModule resolves the modules snippets may require(). Every shim is backed
+// by Go code; anything not on the allowlist keeps throwing "module is not allowed".
+func (h *Handler) requireModule(vm *goja.Runtime, name string) (goja.Value, bool) {
+	key := normalizeModuleName(name)
+	if !h.allowedModules[key] {
+		return nil, false
+	}
+	build, ok := sandboxModules[key]
+	if !ok {
+		return nil, false
+	}
+	return build(h, vm), true
+}
+
+// --- punycode ---
+
+// newPunycodeModule exposes toASCII/toUnicode for domain names and the raw
+// encode/decode of a single label.
+func newPunycodeModule(vm *goja.Runtime) *goja.Object {
+	out := vm.NewObject()
+	convert := func(fn func(string) (string, error)) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			result, err := fn(call.Argument(0).String())
+			if err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			return vm.ToValue(result)
+		}
+	}
+	_ = out.Set("toASCII", convert(idna.Punycode.ToASCII))
+	_ = out.Set("toUnicode", convert(idna.Punycode.ToUnicode))
+	_ = out.Set("encode", convert(func(label string) (string, error) {
+		encoded, err := idna.Punycode.ToASCII(label)
+		return strings.TrimPrefix(encoded, "xn--"), err
+	}))
+	_ = out.Set("decode", convert(func(label string) (string, error) {
+		return idna.Punycode.ToUnicode("xn--" + label)
+	}))
+	return out
+}
+
+// --- buffer ---
+
+const bufferBytesKey = "__mx_bytes"
+
+// newBufferClass returns a minimal Buffer: from/isBuffer/byteLength/concat and
+// instances exposing length and toString(encoding).
+func newBufferClass(vm *goja.Runtime) *goja.Object {
+	class := vm.NewObject()
+	_ = class.Set("from", func(call goja.FunctionCall) goja.Value {
+		data, err := jsBytes(vm, call.Argument(0), call.Argument(1).String())
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		return newBuffer(vm, data)
+	})
+	_ = class.Set("isBuffer", func(call goja.FunctionCall) goja.Value {
+		_, ok := bufferBytes(call.Argument(0))
+		return vm.ToValue(ok)
+	})
+	_ = class.Set("byteLength", func(call goja.FunctionCall) goja.Value {
+		data, err := jsBytes(vm, call.Argument(0), call.Argument(1).String())
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		return vm.ToValue(len(data))
+	})
+	_ = class.Set("concat", func(call goja.FunctionCall) goja.Value {
+		var out []byte
+		list, _ := call.Argument(0).Export().([]interface{})
+		for _, item := range list {
+			data, err := jsBytes(vm, vm.ToValue(item), "")
+			if err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			out = append(out, data...)
+		}
+		return newBuffer(vm, out)
+	})
+	return class
+}
+
+func newBuffer(vm *goja.Runtime, data []byte) goja.Value {
+	buf := vm.NewObject()
+	_ = buf.DefineDataProperty(bufferBytesKey, vm.ToValue(vm.NewArrayBuffer(data)), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	_ = buf.Set("length", len(data))
+	_ = buf.Set("toString", func(call goja.FunctionCall) goja.Value {
+		text, err := encodeBytes(data, call.Argument(0).String())
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		return vm.ToValue(text)
+	})
+	_ = buf.Set("toJSON", func(goja.FunctionCall) goja.Value {
+		values := make([]interface{}, len(data))
+		for i, b := range data {
+			values[i] = int(b)
+		}
+		return vm.ToValue(map[string]interface{}{"type": "Buffer", "data": values})
+	})
+	return buf
+}
+
+func bufferBytes(value goja.Value) ([]byte, bool) {
+	obj, ok := value.(*goja.Object)
+	if !ok {
+		return nil, false
+	}
+	raw := obj.Get(bufferBytesKey)
+	if raw == nil {
+		return nil, false
+	}
+	ab, ok := raw.Export().(goja.ArrayBuffer)
+	if !ok {
+		return nil, false
+	}
+	return ab.Bytes(), true
+}
+
+// jsBytes converts a string (decoded with encoding), Buffer, ArrayBuffer or
+// array of byte values into bytes.
+func jsBytes(vm *goja.Runtime, value goja.Value, encoding string) ([]byte, error) {
+	if data, ok := bufferBytes(value); ok {
+		return append([]byte(nil), data...), nil
+	}
+	switch v := value.Export().(type) {
+	case string:
+		return decodeString(v, encoding)
+	case goja.ArrayBuffer:
+		return append([]byte(nil), v.Bytes()...), nil
+	case []byte:
+		return append([]byte(nil), v...), nil
+	case []interface{}:
+		out := make([]byte, len(v))
+		for i, item := range v {
+			out[i] = byte(vm.ToValue(item).ToInteger())
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("argument must be a string, Buffer or array")
+	}
+}
+
+func normalizeEncoding(encoding string) string {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "undefined", "utf8", "utf-8":
+		return "utf8"
+	case "binary", "latin1":
+		return "latin1"
+	default:
+		return strings.ToLower(strings.TrimSpace(encoding))
+	}
+}
+
+func decodeString(text, encoding string) ([]byte, error) {
+	switch normalizeEncoding(encoding) {
+	case "utf8":
+		return []byte(text), nil
+	case "hex":
+		// Node stops at the first invalid pair instead of failing.
+		text = text[:len(text)-len(text)%2]
+		out := make([]byte, 0, len(text)/2)
+		for i := 0; i < len(text); i += 2 {
+			b, err := hex.DecodeString(text[i : i+2])
+			if err != nil {
+				break
+			}
+			out = append(out, b...)
+		}
+		return out, nil
+	case "base64", "base64url":
+		// Node accepts both alphabets, with or without padding.
+		text = strings.NewReplacer("-", "+", "_", "/").Replace(strings.TrimRight(text, "="))
+		return base64.RawStdEncoding.DecodeString(text)
+	case "latin1":
+		out := make([]byte, 0, len(text))
+		for _, r := range text {
+			out = append(out, byte(r))
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding: %s", encoding)
+	}
+}
+
+func encodeBytes(data []byte, encoding string) (string, error) {
+	switch normalizeEncoding(encoding) {
+	case "utf8":
+		return strings.ToValidUTF8(string(data), "�"), nil
+	case "hex":
+		return hex.EncodeToString(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	case "latin1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	default:
+		return "", fmt.Errorf("unknown encoding: %s", encoding)
+	}
+}
+
+// --- crypto ---
+
+var cryptoHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+func (h *Handler) newCryptoModule(vm *goja.Runtime) *goja.Object {
+	module := vm.NewObject()
+	newHash := func(call goja.FunctionCall, keyed bool) goja.Value {
+		algorithm := strings.ToLower(strings.TrimSpace(call.Argument(0).String()))
+		factory, ok := cryptoHashes[algorithm]
+		if !ok {
+			h.throwJS(vm, http.StatusInternalServerError, fmt.Sprintf("digest method not supported: %s", algorithm))
+			return goja.Undefined()
+		}
+		var hasher hash.Hash
+		if keyed {
+			key, err := jsBytes(vm, call.Argument(1), "")
+			if err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			hasher = hmac.New(factory, key)
+		} else {
+			hasher = factory()
+		}
+		return newHashObject(vm, hasher)
+	}
+	_ = module.Set("createHash", func(call goja.FunctionCall) goja.Value { return newHash(call, false) })
+	_ = module.Set("createHmac", func(call goja.FunctionCall) goja.Value { return newHash(call, true) })
+	_ = module.Set("randomUUID", func(goja.FunctionCall) goja.Value {
+		return vm.ToValue(uuid.NewString())
+	})
+	// timingSafeEqual is what webhook signature checks should compare digests with.
+	_ = module.Set("timingSafeEqual", func(call goja.FunctionCall) goja.Value {
+		a, err := jsBytes(vm, call.Argument(0), "")
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		b, err := jsBytes(vm, call.Argument(1), "")
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		if len(a) != len(b) {
+			panic(vm.NewTypeError("input buffers must have the same byte length"))
+		}
+		return vm.ToValue(subtle.ConstantTimeCompare(a, b) == 1)
+	})
+	return module
+}
+
+func newHashObject(vm *goja.Runtime, hasher hash.Hash) *goja.Object {
+	obj := vm.NewObject()
+	digested := false
+	_ = obj.Set("update", func(call goja.FunctionCall) goja.Value {
+		if digested {
+			panic(vm.NewGoError(fmt.Errorf("digest already called")))
+		}
+		data, err := jsBytes(vm, call.Argument(0), call.Argument(1).String())
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		hasher.Write(data)
+		return obj
+	})
+	_ = obj.Set("digest", func(call goja.FunctionCall) goja.Value {
+		if digested {
+			panic(vm.NewGoError(fmt.Errorf("digest already called")))
+		}
+		digested = true
+		sum := hasher.Sum(nil)
+		if goja.IsUndefined(call.Argument(0)) {
+			return newBuffer(vm, sum)
+		}
+		text, err := encodeBytes(sum, call.Argument(0).String())
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		return vm.ToValue(text)
+	})
+	return obj
+}
+
+// --- querystring ---
+
+func newQuerystringModule(vm *goja.Runtime) *goja.Object {
+	module := vm.NewObject()
+	separators := func(call goja.FunctionCall) (string, string) {
+		sep, eq := "&", "="
+		if v := call.Argument(1); !goja.IsUndefined(v) && !goja.IsNull(v) && v.String() != "" {
+			sep = v.String()
+		}
+		if v := call.Argument(2); !goja.IsUndefined(v) && !goja.IsNull(v) && v.String() != "" {
+			eq = v.String()
+		}
+		return sep, eq
+	}
+	_ = module.Set("parse", func(call goja.FunctionCall) goja.Value {
+		sep, eq := separators(call)
+		return querystringParse(vm, call.Argument(0).String(), sep, eq)
+	})
+	_ = module.Set("stringify", func(call goja.FunctionCall) goja.Value {
+		sep, eq := separators(call)
+		return vm.ToValue(querystringStringify(vm, call.Argument(0), sep, eq))
+	})
+	_ = module.Set("escape", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(querystringEscape(call.Argument(0).String()))
+	})
+	_ = module.Set("unescape", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(querystringUnescape(call.Argument(0).String()))
+	})
+	_ = module.Set("decode", module.Get("parse"))
+	_ = module.Set("encode", module.Get("stringify"))
+	return module
+}
+
+// querystringParse keeps key order and turns repeated keys into arrays, as Node does.
+func querystringParse(vm *goja.Runtime, text, sep, eq string) goja.Value {
+	out := vm.NewObject()
+	if text == "" {
+		return out
+	}
+	values := map[string][]string{}
+	var order []string
+	for _, pair := range strings.Split(text, sep) {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, eq)
+		key, value = querystringUnescape(key), querystringUnescape(value)
+		if _, seen := values[key]; !seen {
+			order = append(order, key)
+		}
+		values[key] = append(values[key], value)
+	}
+	for _, key := range order {
+		if list := values[key]; len(list) == 1 {
+			_ = out.Set(key, list[0])
+		} else {
+			_ = out.Set(key, list)
+		}
+	}
+	return out
+}
+
+func querystringStringify(vm *goja.Runtime, value goja.Value, sep, eq string) string {
+	obj, ok := value.(*goja.Object)
+	if !ok || goja.IsNull(value) {
+		return ""
+	}
+	parts := make([]string, 0)
+	for _, key := range obj.Keys() {
+		encodedKey := querystringEscape(key) + eq
+		item := obj.Get(key)
+		if arr, ok := item.(*goja.Object); ok && arr.ClassName() == "Array" {
+			for _, idx := range arr.Keys() {
+				parts = append(parts, encodedKey+querystringEscape(querystringPrimitive(arr.Get(idx))))
+			}
+			continue
+		}
+		parts = append(parts, encodedKey+querystringEscape(querystringPrimitive(item)))
+	}
+	return strings.Join(parts, sep)
+}
+
+// querystringPrimitive mirrors Node: strings, finite numbers, bigints and booleans
+// are kept, anything else becomes an empty value.
+func querystringPrimitive(value goja.Value) string {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return ""
+	}
+	switch v := value.Export().(type) {
+	case string, bool, int64:
+		return value.String()
+	case float64:
+		if v != v || v > 1.7976931348623157e308 || v < -1.7976931348623157e308 {
+			return ""
+		}
+		return value.String()
+	default:
+		return ""
+	}
+}
+
+// querystringEscape percent-encodes like encodeURIComponent.
+func querystringEscape(text string) string {
+	var b strings.Builder
+	for _, c := range []byte(text) {
+		if isURIUnreserved(c) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func isURIUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("-_.!~*'()", c) >= 0
+}
+
+func querystringUnescape(text string) string {
+	text = strings.ReplaceAll(text, "+", " ")
+	if decoded, err := url.PathUnescape(text); err == nil {
+		return decoded
+	}
+	return text
+}
+
+// --- path (posix) ---
+
+func newPathModule(vm *goja.Runtime) *goja.Object {
+	module := vm.NewObject()
+	_ = module.Set("sep", "/")
+	_ = module.Set("delimiter", ":")
+	_ = module.Set("join", func(call goja.FunctionCall) goja.Value {
+		parts := make([]string, 0, len(call.Arguments))
+		for _, arg := range call.Arguments {
+			if s := arg.String(); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return vm.ToValue(posixNormalize(strings.Join(parts, "/")))
+	})
+	_ = module.Set("normalize", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(posixNormalize(call.Argument(0).String()))
+	})
+	_ = module.Set("basename", func(call goja.FunctionCall) goja.Value {
+		ext := ""
+		if v := call.Argument(1); !goja.IsUndefined(v) {
+			ext = v.String()
+		}
+		return vm.ToValue(posixBasename(call.Argument(0).String(), ext))
+	})
+	_ = module.Set("extname", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(posixExtname(call.Argument(0).String()))
+	})
+	_ = module.Set("dirname", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(posixDirname(call.Argument(0).String()))
+	})
+	_ = module.Set("isAbsolute", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(strings.HasPrefix(call.Argument(0).String(), "/"))
+	})
+	_ = module.Set("posix", module)
+	return module
+}
+
+// posixNormalize is path.Clean except that a trailing slash survives and "" is ".".
+func posixNormalize(p string) string {
+	if p == "" {
+		return "."
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// posixBasename follows Node, which only strips an ext that is the whole base
+// when the path is nothing but that ext.
+func posixBasename(p, ext string) string {
+	if ext != "" && p == ext {
+		return ""
+	}
+	p = strings.TrimRight(p, "/")
+	if p == "" {
+		return ""
+	}
+	base := p[strings.LastIndex(p, "/")+1:]
+	if ext != "" && base != ext && strings.HasSuffix(base, ext) {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base
+}
+
+func posixExtname(p string) string {
+	base := posixBasename(p, "")
+	idx := strings.LastIndex(base, ".")
+	if idx <= 0 || base == ".." {
+		return ""
+	}
+	return base[idx:]
+}
+
+func posixDirname(p string) string {
+	if p == "" {
+		return "."
+	}
+	trimmed := strings.TrimRight(p, "/")
+	if trimmed == "" {
+		return "/"
+	}
+	return path.Dir(trimmed)
+}
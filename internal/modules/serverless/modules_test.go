@@ -0,0 +1,76 @@
+package serverless
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+// TestModuleShimsMatchNode compares the require() shims with what Node 20
+// returns for the same expressions.
+func TestModuleShimsMatchNode(t *testing.T) {
+	h := NewHandler(nil, nil, nil)
+	vm := goja.New()
+	for _, name := range []string{"crypto", "querystring", "path", "buffer"} {
+		module, ok := h.requireModule(vm, name)
+		if !ok {
+			t.Fatalf("module %q is not available", name)
+		}
+		_ = vm.Set(name, module)
+	}
+	_ = vm.Set("Buffer", vm.Get("buffer").ToObject(vm).Get("Buffer"))
+
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{`crypto.createHmac('sha256', 'secret').update('hello world').digest('hex')`, `734cc62f32841568f45715aeb9f4d7891324e6d948e4c6c60c0621cdac48623a`},
+		{`crypto.createHmac('sha256', 'secret').update('hello world').digest('base64')`, `c0zGLzKEFWj0VxWuufTXiRMk5tlI5MbGDAYhzaxIYjo=`},
+		{`crypto.createHmac('sha256', '').update('').digest('hex')`, `b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad`},
+		{`crypto.createHmac('sha256', 'ключ').update('héllo').update(' 世界').digest('base64')`, `b4rhsl/cgTPzA6bxpMq/0a0ONQ7BKpt+PEi46HszdPs=`},
+		{`crypto.createHmac('sha256', Buffer.from('00ff', 'hex')).update(Buffer.from('abc')).digest('hex')`, `95e9ac7e35b5708a9d182dc0d1dd37e43b53361dbee57cb76389d80de4114601`},
+		{`JSON.stringify(querystring.parse('a=1&a=2&b=3&a=4'))`, `{"a":["1","2","4"],"b":"3"}`},
+		{`JSON.stringify(querystring.parse('x=%E4%BD%A0%E5%A5%BD&y=a+b&z=%2B&w&=v&e='))`, `{"x":"你好","y":"a b","z":"+","w":"","":"v","e":""}`},
+		{`JSON.stringify(querystring.parse('a:1;b:2;a:3', ';', ':'))`, `{"a":["1","3"],"b":"2"}`},
+		{`querystring.stringify({ a: ['1', '2'], b: 'x y', c: 'ä&=+/', d: '' })`, `a=1&a=2&b=x%20y&c=%C3%A4%26%3D%2B%2F&d=`},
+		{`querystring.stringify({ n: 1, t: true, u: undefined, o: {}, nan: NaN, s: "-_.!~*'()" })`, `n=1&t=true&u=&o=&nan=&s=-_.!~*'()`},
+		{`querystring.stringify({ a: 1, b: 2 }, ';', ':')`, `a:1;b:2`},
+		{`path.join('/a/b', '../c', './d')`, `/a/c/d`},
+		{`path.join('a', '', 'b/')`, `a/b/`},
+		{`path.join('')`, `.`},
+		{`path.join('/', '..', 'x')`, `/x`},
+		{`path.join('a//b', '/c')`, `a/b/c`},
+		{`path.basename('/a/b/c.txt')`, `c.txt`},
+		{`path.basename('/a/b/c.txt', '.txt')`, `c`},
+		{`path.basename('/a/b/')`, `b`},
+		{`path.basename('.txt', '.txt')`, ``},
+		{`path.basename('/')`, ``},
+		{`path.basename('/x/aaa', 'aaa')`, `aaa`},
+		{`path.basename('file.js', 'js')`, `file.`},
+		{`path.extname('index.html')`, `.html`},
+		{`path.extname('index.coffee.md')`, `.md`},
+		{`path.extname('index.')`, `.`},
+		{`path.extname('index')`, ``},
+		{`path.extname('.index')`, ``},
+		{`path.extname('.index.md')`, `.md`},
+		{`path.extname('a/b.c/')`, `.c`},
+		{`Buffer.from('hello, 世界').toString('base64')`, `aGVsbG8sIOS4lueVjA==`},
+		{`Buffer.from('hello, 世界').toString('hex')`, `68656c6c6f2c20e4b896e7958c`},
+		{`Buffer.from(Buffer.from('hello, 世界').toString('base64'), 'base64').toString()`, `hello, 世界`},
+		{`Buffer.from(Buffer.from('hello, 世界').toString('hex'), 'hex').toString()`, `hello, 世界`},
+		{`Buffer.from('aGk', 'base64').toString()`, `hi`},
+		{`Buffer.from('', 'base64').toString('hex')`, ``},
+		{`Buffer.from([0, 255, 16]).toString('base64')`, `AP8Q`},
+		{`Buffer.from('AP8Q', 'base64').toString('hex')`, `00ff10`},
+	}
+	for _, tc := range cases {
+		got, err := vm.RunString(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got.String() != tc.want {
+			t.Errorf("%s = %q, want %q", tc.expr, got.String(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package serverless
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mx-space/core/internal/models"
+	pkgcron "github.com/mx-space/core/internal/pkg/cron"
+	"go.uber.org/zap"
+)
+
+const (
+	scheduledRunMethod = "SCHEDULE"
+	// snippetRunHistoryLimit is how many runs are kept per snippet.
+	snippetRunHistoryLimit = 20
+	// snippetRunResultLimit caps the stored result so a chatty function cannot bloat the table.
+	snippetRunResultLimit = 64 << 10
+)
+
+// StartScheduler blocks until ctx is done, running function snippets whose
+// schedule is due. Start it on the main cluster instance only.
+func (h *Handler) StartScheduler(ctx context.Context) {
+	last := time.Now()
+	for {
+		wait := time.Until(last.Truncate(time.Minute).Add(time.Minute))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		now := time.Now()
+		h.runDueSnippets(last, now)
+		last = now
+	}
+}
+
+// runDueSnippets starts every scheduled snippet with a fire time in (from, to].
+func (h *Handler) runDueSnippets(from, to time.Time) {
+	var snippets []models.SnippetModel
+	err := h.db.
+		Where("enable = ? AND enable_schedule = ?", true, true).
+		Where("LOWER(type) = ?", string(snippetTypeFunction)).
+		Where("schedule <> ''").
+		Find(&snippets).Error
+	if err != nil {
+		h.logger.Warn("加载定时函数失败", zap.Error(err))
+		return
+	}
+
+	for i := range snippets {
+		snippet := snippets[i]
+		schedule, err := pkgcron.ParseExpr(snippet.Schedule)
+		if err != nil {
+			h.logger.Warn("定时函数表达式无效", zap.String("snippet", snippet.Reference+"/"+snippet.Name), zap.Error(err))
+			continue
+		}
+		if next := schedule.Next(from); next.IsZero() || next.After(to) {
+			continue
+		}
+		if !h.beginScheduledRun(snippet.ID) {
+			h.logger.Info(fmt.Sprintf("定时函数仍在运行，跳过本次：%s/%s", snippet.Reference, snippet.Name))
+			continue
+		}
+		go func() {
+			defer h.endScheduledRun(snippet.ID)
+			h.runScheduledSnippet(&snippet)
+		}()
+	}
+}
+
+func (h *Handler) beginScheduledRun(id string) bool {
+	h.scheduledMu.Lock()
+	defer h.scheduledMu.Unlock()
+	if h.scheduledRun[id] {
+		return false
+	}
+	h.scheduledRun[id] = true
+	return true
+}
+
+func (h *Handler) endScheduledRun(id string) {
+	h.scheduledMu.Lock()
+	delete(h.scheduledRun, id)
+	h.scheduledMu.Unlock()
+}
+
+// runScheduledSnippet executes the snippet and records the outcome in its run history.
+func (h *Handler) runScheduledSnippet(snippet *models.SnippetModel) {
+	startedAt := time.Now()
+	out, err := h.executeSnippet(snippet, scheduledRuntimeContext(snippet))
+
+	run := models.SnippetRunModel{
+		SnippetID:  snippet.ID,
+		Status:     models.SnippetRunSuccess,
+		DurationMs: time.Since(startedAt).Milliseconds(),
+		StartedAt:  startedAt,
+	}
+	if err != nil {
+		run.Status = models.SnippetRunError
+		run.Error = err.Error()
+		h.logger.Warn(fmt.Sprintf("定时函数执行失败：%s/%s", snippet.Reference, snippet.Name), zap.Error(err))
+	} else {
+		run.Result = encodeRunResult(out)
+	}
+
+	if err := h.db.Create(&run).Error; err != nil {
+		h.logger.Warn("保存定时函数运行记录失败", zap.Error(err))
+		return
+	}
+	h.pruneSnippetRuns(snippet.ID)
+}
+
+func (h *Handler) pruneSnippetRuns(snippetID string) {
+	var stale []string
+	err := h.db.Model(&models.SnippetRunModel{}).
+		Where("snippet_id = ?", snippetID).
+		Order("started_at DESC").
+		Offset(snippetRunHistoryLimit).
+		Limit(1000).
+		Pluck("id", &stale).Error
+	if err != nil || len(stale) == 0 {
+		return
+	}
+	_ = h.db.Unscoped().Where("id IN ?", stale).Delete(&models.SnippetRunModel{}).Error
+}
+
+func encodeRunResult(out *executorResult) string {
+	if out == nil || !out.hasData {
+		return ""
+	}
+	var text string
+	switch payload := out.data.(type) {
+	case string:
+		text = payload
+	case []byte:
+		text = string(payload)
+	default:
+		text = string(out.encoded)
+	}
+	if len(text) > snippetRunResultLimit {
+		text = strings.ToValidUTF8(text[:snippetRunResultLimit], "")
+	}
+	return text
+}
@@ -8,11 +8,14 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/config"
 	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/modules/gateway/gateway"
+	"github.com/mx-space/core/internal/pkg/netguard"
 	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
@@ -22,28 +25,103 @@ type Handler struct {
 	rc         *pkgredis.Client
 	httpClient *http.Client
 
-	compiledMu sync.RWMutex
-	compiled   map[string]compiledSnippet
+	compiled *compileCache
 
 	builtInMu    sync.Mutex
 	builtInReady bool
+
+	scheduledMu  sync.Mutex
+	scheduledRun map[string]bool
+
+	logger *zap.Logger
+
+	// fetchMaxBytes configures the snippet fetch() global.
+	fetchMaxBytes int64
+
+	metrics       *metricsRecorder
+	slowThreshold time.Duration
+
+	maxMemoryBytes   int64
+	maxResponseBytes int64
+
+	// allowedModules are the require() names this deployment exposes.
+	allowedModules map[string]bool
+	unknownModules []string
+}
+
+// HandlerOption configures a serverless Handler.
+type HandlerOption func(*Handler)
+
+// WithAppConfig applies the startup config: the fetch() response size cap, the
+// slow execution threshold, the memory and response size limits and the
+// require() allowlist.
+func WithAppConfig(cfg *config.AppConfig) HandlerOption {
+	return func(h *Handler) {
+		if cfg == nil {
+			return
+		}
+		if sizeMB, ok := cfg.ServerlessFetchMaxSizeMB(); ok {
+			h.fetchMaxBytes = int64(sizeMB) << 20
+		}
+		if ms, ok := cfg.ServerlessSlowThresholdMs(); ok {
+			h.slowThreshold = time.Duration(ms) * time.Millisecond
+		}
+		if sizeMB, ok := cfg.ServerlessMaxMemoryMB(); ok {
+			h.maxMemoryBytes = int64(sizeMB) << 20
+		}
+		if sizeMB, ok := cfg.ServerlessMaxResponseMB(); ok {
+			h.maxResponseBytes = int64(sizeMB) << 20
+		}
+		if names, ok := cfg.ServerlessRequireAllowlist(); ok {
+			h.allowedModules, h.unknownModules = newModuleAllowlist(names)
+		}
+	}
+}
+
+// WithLogger sets the logger for the serverless handler.
+func WithLogger(l *zap.Logger) HandlerOption {
+	return func(h *Handler) {
+		if l != nil {
+			h.logger = l.Named("ServerlessService")
+		}
+	}
 }
 
-func NewHandler(db *gorm.DB, hub *gateway.Hub, rc *pkgredis.Client) *Handler {
-	return &Handler{
-		db:         db,
-		hub:        hub,
-		rc:         rc,
-		httpClient: &http.Client{Timeout: 8 * time.Second},
-		compiled:   map[string]compiledSnippet{},
+func NewHandler(db *gorm.DB, hub *gateway.Hub, rc *pkgredis.Client, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		db:           db,
+		hub:          hub,
+		rc:           rc,
+		httpClient:   &http.Client{Timeout: 8 * time.Second},
+		compiled:     newCompileCache(compileCacheLimit),
+		scheduledRun: map[string]bool{},
+		logger:       zap.NewNop(),
+	}
+	h.allowedModules, _ = newModuleAllowlist(defaultSandboxModules)
+	for _, o := range opts {
+		o(h)
+	}
+	if len(h.unknownModules) > 0 {
+		h.logger.Warn("未知的 require 模块已忽略", zap.Strings("modules", h.unknownModules))
 	}
+	// Snippets are admin code but run on request input; keep their requests
+	// off loopback and internal networks.
+	h.httpClient.Transport = netguard.NewTransport()
+	h.metrics = newMetricsRecorder(rc, h.logger)
+	return h
 }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
+	// Seed built-in functions up front so GET /snippets lists them before the first call.
+	if err := h.ensureBuiltInSnippets(); err != nil {
+		h.logger.Warn("初始化内置函数失败", zap.Error(err))
+	}
 	for _, prefix := range []string{"/serverless", "/fn"} {
 		g := rg.Group(prefix)
 		g.GET("/types", authMW, h.getTypes)
+		g.GET("/stats", authMW, h.stats)
 		g.DELETE("/reset/:id", authMW, h.reset)
+		g.GET("/logs/:id", authMW, h.listLogs)
 		g.Any("/:reference/:name/*path", h.run)
 		g.Any("/:reference/:name", h.run)
 	}
@@ -66,9 +144,32 @@ const defaultTypeDefinition = `type Context = {
     status: (code: number) => void
     json: (data: any) => void
     send: (data: any) => void
+    redirect: (url: string, status?: number) => void
   }
   isAuthenticated: boolean
 }
+
+declare function sleep(ms: number): Promise<void>
+
+declare function fetch(
+  input: string | { url: string } | { href: string },
+  init?: {
+    method?: string
+    headers?: Record<string, string>
+    body?: string | object
+    redirect?: 'follow' | 'manual' | 'error'
+  },
+): Promise<{
+  status: number
+  statusText: string
+  ok: boolean
+  url: string
+  redirected: boolean
+  headers: { get(name: string): string | null; has(name: string): boolean }
+  text(): Promise<string>
+  json(): Promise<any>
+  arrayBuffer(): Promise<ArrayBuffer>
+}>
 `
 
 func (h *Handler) reset(c *gin.Context) {
@@ -107,6 +208,7 @@ func (h *Handler) reset(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
+	h.publishInvalidation(id)
 	response.NoContent(c)
 }
 
@@ -129,6 +231,7 @@ func (h *Handler) run(c *gin.Context) {
 		Where("reference = ? AND name = ?", reference, name).
 		Where("LOWER(type) = ?", string(snippetTypeFunction)).
 		Where("(UPPER(method) = ? OR UPPER(method) = 'ALL' OR method = '' OR method IS NULL)", reqMethod).
+		Order("built_in ASC"). // user overrides win over built-ins
 		First(&snippet).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -148,15 +251,26 @@ func (h *Handler) run(c *gin.Context) {
 		return
 	}
 
+	if snippet.BuiltIn {
+		if preset := findBuiltInSnippet(snippet.Reference, snippet.Name); preset != nil && preset.Native != nil {
+			preset.Native(h, c)
+			return
+		}
+	}
+
 	runtimeCtx := h.buildRuntimeContext(c, &snippet)
 	out, runErr := h.executeSnippet(&snippet, runtimeCtx)
 	if runErr != nil {
 		var execErr *runtimeExecError
 		if ok := asRuntimeExecError(runErr, &execErr); ok {
-			c.AbortWithStatusJSON(execErr.Status, gin.H{
+			body := gin.H{
 				"message":     execErr.Message,
 				"status_code": execErr.Status,
-			})
+			}
+			if len(execErr.CompileErrors) > 0 {
+				body["errors"] = compileErrorsFor(c, execErr.CompileErrors)
+			}
+			c.AbortWithStatusJSON(execErr.Status, body)
 			return
 		}
 		response.InternalError(c, runErr)
@@ -166,6 +280,20 @@ func (h *Handler) run(c *gin.Context) {
 	h.writeServerlessResponse(c, out)
 }
 
+// compileErrorsFor drops the quoted source lines unless the caller is the
+// admin, so a broken public function does not leak its code.
+func compileErrorsFor(c *gin.Context, details []CompileErrorDetail) []CompileErrorDetail {
+	if middleware.IsAuthenticated(c) {
+		return details
+	}
+	out := make([]CompileErrorDetail, len(details))
+	for i, d := range details {
+		d.LineText = ""
+		out[i] = d
+	}
+	return out
+}
+
 func (h *Handler) hasFunctionAccess(c *gin.Context) bool {
 	if middleware.IsAuthenticated(c) {
 		return true
@@ -177,6 +305,6 @@ func (h *Handler) hasFunctionAccess(c *gin.Context) bool {
 	if strings.HasPrefix(strings.ToLower(token), "bearer ") {
 		token = strings.TrimSpace(token[7:])
 	}
-	_, err := middleware.ValidateTokenClaims(h.db, token)
+	_, err := middleware.ValidateScopedToken(h.db, token, middleware.APITokenScopeServerless)
 	return err == nil
 }
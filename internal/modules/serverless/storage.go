@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/dialect"
 	"gorm.io/gorm"
 )
 
@@ -57,7 +58,7 @@ func (h *Handler) storageGet(namespace, key string) interface{} {
 	}
 	var item models.ServerlessStorageModel
 	err := h.db.
-		Where("namespace = ? AND `key` = ?", namespace, key).
+		Where("namespace = ? AND "+dialect.Quote(h.db, "key")+" = ?", namespace, key).
 		First(&item).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -79,7 +80,7 @@ func (h *Handler) storageFind(namespace string, condition interface{}) interface
 		Where("namespace = ?", namespace).
 		Order("created_at DESC")
 	if keyFilter != "" {
-		tx = tx.Where("`key` = ?", keyFilter)
+		tx = tx.Where(dialect.Quote(h.db, "key")+" = ?", keyFilter)
 	}
 
 	var items []models.ServerlessStorageModel
@@ -106,7 +107,7 @@ func (h *Handler) storageSet(namespace, key string, value interface{}) {
 
 	var existing models.ServerlessStorageModel
 	err := h.db.
-		Where("namespace = ? AND `key` = ?", namespace, key).
+		Where("namespace = ? AND "+dialect.Quote(h.db, "key")+" = ?", namespace, key).
 		First(&existing).Error
 	if err == nil {
 		_ = h.db.Model(&existing).Update("value", encoded).Error
@@ -131,7 +132,7 @@ func (h *Handler) storageInsert(namespace, key string, value interface{}) error
 
 	var existing models.ServerlessStorageModel
 	err := h.db.
-		Where("namespace = ? AND `key` = ?", namespace, key).
+		Where("namespace = ? AND "+dialect.Quote(h.db, "key")+" = ?", namespace, key).
 		First(&existing).Error
 	if err == nil {
 		return errors.New("key already exists")
@@ -155,7 +156,7 @@ func (h *Handler) storageUpdate(namespace, key string, value interface{}) error
 
 	var existing models.ServerlessStorageModel
 	err := h.db.
-		Where("namespace = ? AND `key` = ?", namespace, key).
+		Where("namespace = ? AND "+dialect.Quote(h.db, "key")+" = ?", namespace, key).
 		First(&existing).Error
 	if err == gorm.ErrRecordNotFound {
 		return errors.New("key not exists")
@@ -171,7 +172,7 @@ func (h *Handler) storageDel(namespace, key string) {
 		return
 	}
 	_ = h.db.
-		Where("namespace = ? AND `key` = ?", namespace, key).
+		Where("namespace = ? AND "+dialect.Quote(h.db, "key")+" = ?", namespace, key).
 		Delete(&models.ServerlessStorageModel{}).Error
 }
 
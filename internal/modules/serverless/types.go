@@ -20,6 +20,8 @@ type runtimeResponseMeta struct {
 	Sent        bool
 	SentData    interface{}
 	SentHasData bool
+	// RedirectURL is set by res.redirect and sent as the Location header.
+	RedirectURL string
 }
 
 type runtimeContext struct {
@@ -35,10 +37,14 @@ type runtimeContext struct {
 	IsAuthenticated bool
 	Secret          map[string]interface{}
 	Model           map[string]interface{}
+	// TraceID is forwarded as X-Request-ID on the snippet's outbound requests.
+	TraceID string
 }
 
 type executorResult struct {
-	data    interface{}
+	data interface{}
+	// encoded is the JSON form of data when it is neither a string nor []byte.
+	encoded []byte
 	hasData bool
 	meta    runtimeResponseMeta
 }
@@ -46,6 +52,10 @@ type executorResult struct {
 type runtimeExecError struct {
 	Status  int
 	Message string
+	// Interrupted is set when the timeout or the memory limit stopped the execution.
+	Interrupted bool
+	// CompileErrors locates TypeScript errors so the editor can highlight them.
+	CompileErrors []CompileErrorDetail
 }
 
 func (e *runtimeExecError) Error() string { return e.Message }
@@ -0,0 +1,62 @@
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mx-space/core/internal/modules/system/core/configs"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"gorm.io/gorm"
+)
+
+// aggregateCachePrefix keys the serialized /aggregate response per theme.
+const (
+	aggregateCachePrefix = "mx:cache:aggregate:"
+	aggregateCacheTTL    = 60 * time.Second
+)
+
+// cachedAggregate returns the serialized /aggregate response for theme from
+// Redis, building and storing it on a miss. A Redis failure falls back to
+// building the response directly.
+func cachedAggregate(ctx context.Context, db *gorm.DB, cfgSvc *configs.Service, rc *pkgredis.Client, theme string) ([]byte, error) {
+	key := aggregateCachePrefix + theme
+	if rc != nil {
+		if raw, err := rc.Get(ctx, key); err == nil && raw != "" {
+			return []byte(raw), nil
+		}
+	}
+
+	data, err := buildAggregate(db, cfgSvc, theme)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		_ = rc.Set(ctx, key, body, aggregateCacheTTL)
+	}
+	return body, nil
+}
+
+// InvalidateCache drops every cached /aggregate response. Content services call
+// it after posts, notes, pages or categories change.
+func InvalidateCache(ctx context.Context, rc *pkgredis.Client) error {
+	if rc == nil {
+		return nil
+	}
+	iter := rc.Raw().Scan(ctx, 0, aggregateCachePrefix+"*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return rc.Del(ctx, keys...)
+}
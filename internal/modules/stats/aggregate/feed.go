@@ -0,0 +1,208 @@
+package aggregate
+
+import (
+	"encoding/xml"
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/system/core/configs"
+	"gorm.io/gorm"
+)
+
+type feedItem struct {
+	Created  *time.Time     `json:"created"`
+	Modified *time.Time     `json:"modified"`
+	Link     string         `json:"link"`
+	Title    string         `json:"title"`
+	Text     string         `json:"text"`
+	ID       string         `json:"id"`
+	Images   []models.Image `json:"images"`
+}
+
+type feedData struct {
+	Title       string
+	Description string
+	Author      string
+	URL         string
+	Items       []feedItem
+}
+
+// buildFeed collects the 10 latest published posts and public notes, newest first.
+func buildFeed(db *gorm.DB, cfgSvc *configs.Service) (*feedData, error) {
+	cfg, err := cfgSvc.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := strings.TrimRight(cfg.URL.WebURL, "/")
+	var user models.UserModel
+	_ = db.Select("name").First(&user).Error
+
+	feedItems := make([]feedItem, 0, 20)
+
+	var posts []models.PostModel
+	if err := db.Preload("Category").Where("is_published = ?", true).Order("created_at DESC").Limit(10).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range posts {
+		categorySlug := "uncategorized"
+		if p.Category != nil && p.Category.Slug != "" {
+			categorySlug = p.Category.Slug
+		}
+		created := p.CreatedAt
+		postModified := models.NullableModified(p.CreatedAt, p.UpdatedAt)
+		images := p.Images
+		if images == nil {
+			images = []models.Image{}
+		}
+		feedItems = append(feedItems, feedItem{
+			Created:  &created,
+			Modified: postModified,
+			Link:     baseURL + "/posts/" + categorySlug + "/" + p.Slug,
+			Title:    p.Title,
+			Text:     p.Text,
+			ID:       p.ID,
+			Images:   images,
+		})
+	}
+
+	var notes []models.NoteModel
+	if err := db.Where("is_published = ?", true).Order("created_at DESC").Limit(10).Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	for _, n := range notes {
+		if n.Password != "" {
+			continue
+		}
+		if n.PublicAt != nil && n.PublicAt.After(time.Now()) {
+			continue
+		}
+		created := n.CreatedAt
+		noteModified := models.NullableModified(n.CreatedAt, n.UpdatedAt)
+		images := n.Images
+		if images == nil {
+			images = []models.Image{}
+		}
+		feedItems = append(feedItems, feedItem{
+			Created:  &created,
+			Modified: noteModified,
+			Link:     baseURL + "/notes/" + strconv.Itoa(n.NID),
+			Title:    n.Title,
+			Text:     n.Text,
+			ID:       n.ID,
+			Images:   images,
+		})
+	}
+
+	sort.Slice(feedItems, func(i, j int) bool {
+		li := feedItems[i].Created
+		lj := feedItems[j].Created
+		if li == nil || lj == nil {
+			return false
+		}
+		return li.After(*lj)
+	})
+	if len(feedItems) > 10 {
+		feedItems = feedItems[:10]
+	}
+
+	return &feedData{
+		Title:       cfg.SEO.Title,
+		Description: cfg.SEO.Description,
+		Author:      user.Name,
+		URL:         cfg.URL.WebURL,
+		Items:       feedItems,
+	}, nil
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Author      string        `xml:"dc:creator,omitempty"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// renderFeedRSS renders feed as RSS 2.0. Item text is escaped by the encoder, so
+// readers show it as plain text.
+func renderFeedRSS(feed *feedData, now time.Time) ([]byte, error) {
+	doc := rssDocument{
+		Version: "2.0",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         feed.Title,
+			Link:          feed.URL,
+			Description:   feed.Description,
+			LastBuildDate: now.Format(time.RFC1123Z),
+			Generator:     "mx-space-core",
+			Items:         make([]rssItem, 0, len(feed.Items)),
+		},
+	}
+	for _, item := range feed.Items {
+		entry := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{Value: item.ID},
+			Author:      feed.Author,
+			Description: item.Text,
+		}
+		if item.Created != nil {
+			entry.PubDate = item.Created.Format(time.RFC1123Z)
+		}
+		if len(item.Images) > 0 && item.Images[0].Src != "" {
+			entry.Enclosure = &rssEnclosure{URL: item.Images[0].Src, Type: imageMimeType(item.Images[0])}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, entry)
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func imageMimeType(img models.Image) string {
+	if t := strings.TrimSpace(img.Type); strings.HasPrefix(t, "image/") {
+		return t
+	}
+	ext := path.Ext(strings.SplitN(img.Src, "?", 2)[0])
+	if t := mime.TypeByExtension(strings.ToLower(ext)); strings.HasPrefix(t, "image/") {
+		return t
+	}
+	return "image/jpeg"
+}
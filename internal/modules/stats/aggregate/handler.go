@@ -2,29 +2,34 @@ package aggregate
 
 import (
 	"encoding/json"
+	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/config"
 	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/modules/gateway/gateway"
 	"github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/pagination"
+	"github.com/mx-space/core/internal/pkg/readtime"
 	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/mx-space/core/internal/pkg/useragent"
 	"gorm.io/gorm"
 )
 
-func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, hub *gateway.Hub, rc *pkgredis.Client) {
+func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, cfg *config.AppConfig, hub *gateway.Hub, rc *pkgredis.Client, authMW gin.HandlerFunc) {
 	rg.GET("/aggregate", func(c *gin.Context) {
-		data, err := buildAggregate(db, cfgSvc, c.Query("theme"))
+		body, err := cachedAggregate(c.Request.Context(), db, cfgSvc, rc, c.Query("theme"))
 		if err != nil {
 			response.InternalError(c, err)
 			return
 		}
-		response.OK(c, data)
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 	})
 
 	rg.GET("/aggregate/top", middleware.OptionalAuth(db), func(c *gin.Context) {
@@ -70,12 +75,15 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 			if images == nil {
 				images = []models.Image{}
 			}
+			stats := readtime.Estimate(p.Text)
 			item := topPost{
-				ID:      p.ID,
-				Slug:    p.Slug,
-				Title:   p.Title,
-				Created: p.CreatedAt,
-				Images:  images,
+				ID:          p.ID,
+				Slug:        p.Slug,
+				Title:       p.Title,
+				Created:     p.CreatedAt,
+				Images:      images,
+				WordCount:   stats.WordCount,
+				ReadingTime: stats.Minutes,
 			}
 			if p.Category != nil {
 				item.Category = &struct {
@@ -95,12 +103,15 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 			if images == nil {
 				images = []models.Image{}
 			}
+			stats := readtime.Estimate(n.Text)
 			outNotes = append(outNotes, topNote{
-				ID:      n.ID,
-				NID:     n.NID,
-				Title:   n.Title,
-				Created: n.CreatedAt,
-				Images:  images,
+				ID:          n.ID,
+				NID:         n.NID,
+				Title:       n.Title,
+				Created:     n.CreatedAt,
+				Images:      images,
+				WordCount:   stats.WordCount,
+				ReadingTime: stats.Minutes,
 			})
 		}
 
@@ -137,6 +148,14 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 			order = "created_at DESC"
 		}
 
+		// page/size switch to paginated results; without them the full timeline is
+		// returned, capped at timelineMaxItems per type.
+		_, hasPage := c.GetQuery("page")
+		_, hasSize := c.GetQuery("size")
+		paginated := hasPage || hasSize
+		pq := pagination.FromContext(c)
+		var pages []response.Pagination
+
 		makeYearFilter := func(tx *gorm.DB) *gorm.DB {
 			if year <= 0 {
 				return tx
@@ -155,19 +174,29 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 				Where("is_published = ?", true).
 				Order(order)
 			postTx = makeYearFilter(postTx)
-			if err := postTx.Find(&posts).Error; err != nil {
+			if paginated {
+				pag, err := pagination.Paginate(postTx, pq, &posts)
+				if err != nil {
+					response.InternalError(c, err)
+					return
+				}
+				pages = append(pages, pag)
+			} else if err := postTx.Limit(timelineMaxItems).Find(&posts).Error; err != nil {
 				response.InternalError(c, err)
 				return
 			}
 			postOut := make([]timelinePost, 0, len(posts))
 			for _, p := range posts {
 				modified := models.NullableModified(p.CreatedAt, p.UpdatedAt)
+				stats := readtime.Estimate(p.Text)
 				item := timelinePost{
-					ID:       p.ID,
-					Title:    p.Title,
-					Slug:     p.Slug,
-					Created:  p.CreatedAt,
-					Modified: modified,
+					ID:          p.ID,
+					Title:       p.Title,
+					Slug:        p.Slug,
+					Created:     p.CreatedAt,
+					Modified:    modified,
+					WordCount:   stats.WordCount,
+					ReadingTime: stats.Minutes,
 				}
 				if p.Category != nil {
 					item.Category = &struct {
@@ -192,226 +221,94 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 				Where("is_published = ?", true).
 				Order(order)
 			noteTx = makeYearFilter(noteTx)
-			if err := noteTx.Find(&notes).Error; err != nil {
+			if paginated {
+				pag, err := pagination.Paginate(noteTx, pq, &notes)
+				if err != nil {
+					response.InternalError(c, err)
+					return
+				}
+				pages = append(pages, pag)
+			} else if err := noteTx.Limit(timelineMaxItems).Find(&notes).Error; err != nil {
 				response.InternalError(c, err)
 				return
 			}
 			noteOut := make([]timelineNote, 0, len(notes))
 			for _, n := range notes {
 				noteModified := models.NullableModified(n.CreatedAt, n.UpdatedAt)
+				stats := readtime.Estimate(n.Text)
 				noteOut = append(noteOut, timelineNote{
-					ID:       n.ID,
-					NID:      n.NID,
-					Title:    n.Title,
-					Weather:  n.Weather,
-					Mood:     n.Mood,
-					Created:  n.CreatedAt,
-					Modified: noteModified,
-					Bookmark: n.Bookmark,
+					ID:          n.ID,
+					NID:         n.NID,
+					Title:       n.Title,
+					Weather:     n.Weather,
+					Mood:        n.Mood,
+					Created:     n.CreatedAt,
+					Modified:    noteModified,
+					Bookmark:    n.Bookmark,
+					WordCount:   stats.WordCount,
+					ReadingTime: stats.Minutes,
 				})
 			}
 			data["notes"] = noteOut
 		}
 
-		response.OK(c, gin.H{"data": data})
-	})
-
-	rg.GET("/aggregate/sitemap", func(c *gin.Context) {
-		baseURL := ""
-		if cfg, err := cfgSvc.Get(); err == nil {
-			baseURL = strings.TrimRight(cfg.URL.WebURL, "/")
-		}
-
-		items := make([]sitemapItem, 0, 64)
-
-		var pages []models.PageModel
-		if err := db.Find(&pages).Error; err != nil {
-			response.InternalError(c, err)
-			return
-		}
-		for _, p := range pages {
-			path := "/" + strings.TrimLeft(p.Slug, "/")
-			items = append(items, sitemapItem{
-				URL:         baseURL + path,
-				PublishedAt: publishedAt(p.CreatedAt, p.UpdatedAt),
-			})
-		}
-
-		var notes []models.NoteModel
-		if err := db.Where("is_published = ?", true).Find(&notes).Error; err != nil {
-			response.InternalError(c, err)
+		if !paginated {
+			response.OK(c, gin.H{"data": data})
 			return
 		}
-		now := time.Now()
-		for _, n := range notes {
-			if n.PublicAt != nil && n.PublicAt.After(now) {
-				continue
-			}
-			items = append(items, sitemapItem{
-				URL:         baseURL + "/notes/" + strconv.Itoa(n.NID),
-				PublishedAt: publishedAt(n.CreatedAt, n.UpdatedAt),
-			})
-		}
+		response.OK(c, gin.H{"data": data, "pagination": mergeTimelinePages(pq, pages)})
+	})
 
-		var posts []models.PostModel
-		if err := db.Preload("Category").Where("is_published = ?", true).Find(&posts).Error; err != nil {
+	rg.GET("/aggregate/sitemap", func(c *gin.Context) {
+		items, err := BuildSitemapItems(db, cfgSvc)
+		if err != nil {
 			response.InternalError(c, err)
 			return
 		}
-		for _, p := range posts {
-			categorySlug := "uncategorized"
-			if p.Category != nil && p.Category.Slug != "" {
-				categorySlug = p.Category.Slug
-			}
-			items = append(items, sitemapItem{
-				URL:         baseURL + "/posts/" + categorySlug + "/" + p.Slug,
-				PublishedAt: publishedAt(p.CreatedAt, p.UpdatedAt),
-			})
-		}
-
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].PublishedAt.After(items[j].PublishedAt)
-		})
 		response.OK(c, gin.H{"data": items})
 	})
 
 	rg.GET("/aggregate/feed", func(c *gin.Context) {
-		cfg, err := cfgSvc.Get()
+		feed, err := buildFeed(db, cfgSvc)
 		if err != nil {
 			response.InternalError(c, err)
 			return
 		}
+		response.OK(c, gin.H{
+			"title":       feed.Title,
+			"description": feed.Description,
+			"author":      feed.Author,
+			"url":         feed.URL,
+			"data":        feed.Items,
+		})
+	})
 
-		baseURL := strings.TrimRight(cfg.URL.WebURL, "/")
-		var user models.UserModel
-		_ = db.Select("name").First(&user).Error
-		author := user.Name
-
-		type feedItem struct {
-			Created  *time.Time     `json:"created"`
-			Modified *time.Time     `json:"modified"`
-			Link     string         `json:"link"`
-			Title    string         `json:"title"`
-			Text     string         `json:"text"`
-			ID       string         `json:"id"`
-			Images   []models.Image `json:"images"`
-		}
-
-		feedItems := make([]feedItem, 0, 20)
-
-		var posts []models.PostModel
-		if err := db.Preload("Category").Where("is_published = ?", true).Order("created_at DESC").Limit(10).Find(&posts).Error; err != nil {
+	// Same items as /aggregate/feed for RSS readers. It is a separate route rather
+	// than Accept negotiation because the API cache keys on the URL only.
+	rg.GET("/aggregate/feed.xml", func(c *gin.Context) {
+		feed, err := buildFeed(db, cfgSvc)
+		if err != nil {
 			response.InternalError(c, err)
 			return
 		}
-		for _, p := range posts {
-			categorySlug := "uncategorized"
-			if p.Category != nil && p.Category.Slug != "" {
-				categorySlug = p.Category.Slug
-			}
-			created := p.CreatedAt
-			postModified := models.NullableModified(p.CreatedAt, p.UpdatedAt)
-			images := p.Images
-			if images == nil {
-				images = []models.Image{}
-			}
-			feedItems = append(feedItems, feedItem{
-				Created:  &created,
-				Modified: postModified,
-				Link:     baseURL + "/posts/" + categorySlug + "/" + p.Slug,
-				Title:    p.Title,
-				Text:     p.Text,
-				ID:       p.ID,
-				Images:   images,
-			})
-		}
-
-		var notes []models.NoteModel
-		if err := db.Where("is_published = ?", true).Order("created_at DESC").Limit(10).Find(&notes).Error; err != nil {
+		body, err := renderFeedRSS(feed, time.Now())
+		if err != nil {
 			response.InternalError(c, err)
 			return
 		}
-		for _, n := range notes {
-			if n.Password != "" {
-				continue
-			}
-			if n.PublicAt != nil && n.PublicAt.After(time.Now()) {
-				continue
-			}
-			created := n.CreatedAt
-			noteModified := models.NullableModified(n.CreatedAt, n.UpdatedAt)
-			images := n.Images
-			if images == nil {
-				images = []models.Image{}
-			}
-			feedItems = append(feedItems, feedItem{
-				Created:  &created,
-				Modified: noteModified,
-				Link:     baseURL + "/notes/" + strconv.Itoa(n.NID),
-				Title:    n.Title,
-				Text:     n.Text,
-				ID:       n.ID,
-				Images:   images,
-			})
-		}
+		c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", body)
+	})
 
-		sort.Slice(feedItems, func(i, j int) bool {
-			li := feedItems[i].Created
-			lj := feedItems[j].Created
-			if li == nil || lj == nil {
-				return false
-			}
-			return li.After(*lj)
+	rg.GET("/aggregate/stat", middleware.OptionalAuth(db), func(c *gin.Context) {
+		// Counts are cached; the online numbers below are always live.
+		stat, err := cachedStat(c.Request.Context(), rc, "stat", statCacheTTL(cfg, "stat"), wantsRefresh(c), func() (statResponse, error) {
+			return loadStatCounts(db), nil
 		})
-		if len(feedItems) > 10 {
-			feedItems = feedItems[:10]
+		if err != nil {
+			response.InternalError(c, err)
+			return
 		}
 
-		response.OK(c, gin.H{
-			"title":       cfg.SEO.Title,
-			"description": cfg.SEO.Description,
-			"author":      author,
-			"url":         cfg.URL.WebURL,
-			"data":        feedItems,
-		})
-	})
-
-	rg.GET("/aggregate/stat", func(c *gin.Context) {
-		var stat statResponse
-		db.Model(&models.PostModel{}).Count(&stat.Posts)
-		db.Model(&models.NoteModel{}).Count(&stat.Notes)
-		db.Model(&models.PageModel{}).Count(&stat.Pages)
-		db.Model(&models.CommentModel{}).
-			Where("parent_id IS NULL").
-			Where("state IN ?", []models.CommentState{models.CommentRead, models.CommentUnread}).
-			Count(&stat.Comments)
-		db.Model(&models.CommentModel{}).
-			Where("state IN ?", []models.CommentState{models.CommentRead, models.CommentUnread}).
-			Count(&stat.AllComments)
-		db.Model(&models.CommentModel{}).Where("state = ?", models.CommentUnread).Count(&stat.UnreadComments)
-		db.Model(&models.SayModel{}).Count(&stat.Says)
-		db.Model(&models.LinkModel{}).Where("state = ?", models.LinkPass).Count(&stat.Links)
-		db.Model(&models.LinkModel{}).Where("state = ?", models.LinkAudit).Count(&stat.LinkApply)
-		db.Model(&models.ProjectModel{}).Count(&stat.Projects)
-		db.Model(&models.SnippetModel{}).Count(&stat.Snippets)
-		db.Model(&models.CategoryModel{}).Count(&stat.Categories)
-		db.Model(&models.TopicModel{}).Count(&stat.Topics)
-		db.Model(&models.RecentlyModel{}).Count(&stat.Recently)
-
-		if callTime, ok := loadStatCounterFromOptions(db, "apiCallTime", "api_call_time", "call_time"); ok {
-			stat.CallTime = callTime
-		} else {
-			db.Model(&models.AnalyzeModel{}).Count(&stat.CallTime)
-		}
-		if uv, ok := loadStatCounterFromOptions(db, "uv"); ok {
-			stat.UV = uv
-		} else {
-			db.Model(&models.AnalyzeModel{}).Distinct("ip").Count(&stat.UV)
-		}
-
-		todayStart := beginningOfDay(time.Now())
-		db.Model(&models.AnalyzeModel{}).Where("timestamp >= ?", todayStart).Distinct("ip").Count(&stat.TodayIPAccessCount)
-
 		stat.TodayMaxOnline = "0"
 		stat.TodayOnlineTotal = "0"
 		stat.Online = 0
@@ -447,23 +344,12 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 		response.OK(c, counts)
 	})
 
-	rg.GET("/aggregate/count_site_words", func(c *gin.Context) {
-		postWords, err := loadTextLengthTotal(db.Model(&models.PostModel{}), "text")
-		if err != nil {
-			response.InternalError(c, err)
-			return
-		}
-		noteWords, err := loadTextLengthTotal(db.Model(&models.NoteModel{}), "text")
-		if err != nil {
-			response.InternalError(c, err)
-			return
-		}
-		pageWords, err := loadTextLengthTotal(db.Model(&models.PageModel{}), "text")
+	rg.GET("/aggregate/count_site_words", middleware.OptionalAuth(db), func(c *gin.Context) {
+		totalWords, err := loadSiteWords(c.Request.Context(), db, rc, statCacheTTL(cfg, "count_site_words"), wantsRefresh(c))
 		if err != nil {
 			response.InternalError(c, err)
 			return
 		}
-		totalWords := postWords + noteWords + pageWords
 		response.OK(c, wordCountResponse{Words: totalWords, Count: totalWords})
 	})
 
@@ -488,36 +374,13 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 		response.OK(c, out)
 	})
 
-	rg.GET("/aggregate/stat/tag-cloud", func(c *gin.Context) {
-		var rows []struct{ Tags string }
-		db.Model(&models.PostModel{}).Select("tags").Find(&rows)
-
-		counts := map[string]int64{}
-		for _, row := range rows {
-			var tags []string
-			if err := json.Unmarshal([]byte(row.Tags), &tags); err != nil {
-				continue
-			}
-			for _, t := range tags {
-				tag := strings.TrimSpace(t)
-				if tag == "" {
-					continue
-				}
-				counts[tag]++
-			}
-		}
-
-		type tagCount struct {
-			Tag   string `json:"tag"`
-			Count int64  `json:"count"`
-		}
-		out := make([]tagCount, 0, len(counts))
-		for tag, count := range counts {
-			out = append(out, tagCount{Tag: tag, Count: count})
-		}
-		sort.Slice(out, func(i, j int) bool { return out[i].Count > out[j].Count })
-		if len(out) > 20 {
-			out = out[:20]
+	rg.GET("/aggregate/stat/tag-cloud", middleware.OptionalAuth(db), func(c *gin.Context) {
+		out, err := cachedStat(c.Request.Context(), rc, "tag_cloud", statCacheTTL(cfg, "tag_cloud"), wantsRefresh(c), func() ([]tagCount, error) {
+			return loadTagCloud(db), nil
+		})
+		if err != nil {
+			response.InternalError(c, err)
+			return
 		}
 		response.OK(c, out)
 	})
@@ -525,7 +388,7 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 	rg.GET("/aggregate/stat/publication-trend", func(c *gin.Context) {
 		start := time.Now().In(time.Local)
 		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -11, 0)
-		end := start.AddDate(1, 12, 0)
+		end := start.AddDate(1, 0, 0)
 		postCounts, err := loadBucketCounts(db.Model(&models.PostModel{}), "created_at", start, end, "month")
 		if err != nil {
 			response.InternalError(c, err)
@@ -622,6 +485,86 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 		response.OK(c, out)
 	})
 
+	rg.GET("/aggregate/stat/visitor-trend", authMW, func(c *gin.Context) {
+		days := 30
+		if raw := c.Query("days"); raw != "" {
+			if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+				days = parsed
+			}
+		}
+		if days > heatmapMaxDays {
+			days = heatmapMaxDays
+		}
+		start := beginningOfDay(time.Now().AddDate(0, 0, -(days - 1)))
+		end := start.AddDate(0, 0, days)
+		buckets, err := loadVisitorBuckets(db.Model(&models.AnalyzeModel{}), start, end, "day")
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		type dayVisitors struct {
+			Date string `json:"date"`
+			PV   int64  `json:"pv"`
+			UV   int64  `json:"uv"`
+		}
+		out := make([]dayVisitors, 0, days)
+		for i := 0; i < days; i++ {
+			dayKey := start.AddDate(0, 0, i).Format("2006-01-02")
+			bucket := buckets[dayKey]
+			out = append(out, dayVisitors{Date: dayKey, PV: bucket.PV, UV: bucket.UV})
+		}
+		response.OK(c, out)
+	})
+
+	rg.GET("/aggregate/stat/activity-heatmap", func(c *gin.Context) {
+		days := heatmapDefaultDays
+		if raw := c.Query("days"); raw != "" {
+			if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+				days = parsed
+			}
+		}
+		if days > heatmapMaxDays {
+			days = heatmapMaxDays
+		}
+		start := beginningOfDay(time.Now().AddDate(0, 0, -(days - 1)))
+		end := start.AddDate(0, 0, days)
+		postCounts, err := loadBucketCounts(db.Model(&models.PostModel{}), "created_at", start, end, "day")
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		noteCounts, err := loadBucketCounts(db.Model(&models.NoteModel{}), "created_at", start, end, "day")
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		commentCounts, err := loadBucketCounts(db.Model(&models.CommentModel{}), "created_at", start, end, "day")
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		type dayActivity struct {
+			Date     string `json:"date"`
+			Posts    int64  `json:"posts"`
+			Notes    int64  `json:"notes"`
+			Comments int64  `json:"comments"`
+			Total    int64  `json:"total"`
+		}
+		out := make([]dayActivity, 0, days)
+		for i := 0; i < days; i++ {
+			dayKey := start.AddDate(0, 0, i).Format("2006-01-02")
+			item := dayActivity{
+				Date:     dayKey,
+				Posts:    postCounts[dayKey],
+				Notes:    noteCounts[dayKey],
+				Comments: commentCounts[dayKey],
+			}
+			item.Total = item.Posts + item.Notes + item.Comments
+			out = append(out, item)
+		}
+		response.OK(c, out)
+	})
+
 	rg.GET("/aggregate/stat/traffic-source", func(c *gin.Context) {
 		cutoff := time.Now().AddDate(0, 0, -7)
 		var rows []models.AnalyzeModel
@@ -629,12 +572,13 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 
 		osCount := map[string]int64{}
 		browserCount := map[string]int64{}
+		deviceCount := map[string]int64{}
 		for _, row := range rows {
 			raw, _ := row.UA["raw"].(string)
-			os := detectOS(raw)
-			browser := detectBrowser(raw)
-			osCount[os]++
-			browserCount[browser]++
+			info := useragent.Parse(raw)
+			osCount[info.OS]++
+			browserCount[info.Browser]++
+			deviceCount[info.Device]++
 		}
 
 		toList := func(m map[string]int64) []gin.H {
@@ -649,6 +593,80 @@ func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service, h
 		response.OK(c, gin.H{
 			"os":      toList(osCount),
 			"browser": toList(browserCount),
+			"device":  toList(deviceCount),
 		})
 	})
 }
+
+func loadStatCounts(db *gorm.DB) statResponse {
+	var stat statResponse
+	db.Model(&models.PostModel{}).Count(&stat.Posts)
+	db.Model(&models.NoteModel{}).Count(&stat.Notes)
+	db.Model(&models.PageModel{}).Count(&stat.Pages)
+	db.Model(&models.CommentModel{}).
+		Where("parent_id IS NULL").
+		Where("state IN ?", []models.CommentState{models.CommentRead, models.CommentUnread}).
+		Count(&stat.Comments)
+	db.Model(&models.CommentModel{}).
+		Where("state IN ?", []models.CommentState{models.CommentRead, models.CommentUnread}).
+		Count(&stat.AllComments)
+	db.Model(&models.CommentModel{}).Where("state = ?", models.CommentUnread).Count(&stat.UnreadComments)
+	db.Model(&models.SayModel{}).Count(&stat.Says)
+	db.Model(&models.LinkModel{}).Where("state = ?", models.LinkPass).Count(&stat.Links)
+	db.Model(&models.LinkModel{}).Where("state = ?", models.LinkAudit).Count(&stat.LinkApply)
+	db.Model(&models.ProjectModel{}).Count(&stat.Projects)
+	db.Model(&models.SnippetModel{}).Count(&stat.Snippets)
+	db.Model(&models.CategoryModel{}).Count(&stat.Categories)
+	db.Model(&models.TopicModel{}).Count(&stat.Topics)
+	db.Model(&models.RecentlyModel{}).Count(&stat.Recently)
+
+	if callTime, ok := loadStatCounterFromOptions(db, "apiCallTime", "api_call_time", "call_time"); ok {
+		stat.CallTime = callTime
+	} else {
+		db.Model(&models.AnalyzeModel{}).Count(&stat.CallTime)
+	}
+	if uv, ok := loadStatCounterFromOptions(db, "uv"); ok {
+		stat.UV = uv
+	} else {
+		db.Model(&models.AnalyzeModel{}).Distinct("ip").Count(&stat.UV)
+	}
+
+	todayStart := beginningOfDay(time.Now())
+	db.Model(&models.AnalyzeModel{}).Where("timestamp >= ?", todayStart).Distinct("ip").Count(&stat.TodayIPAccessCount)
+	return stat
+}
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+func loadTagCloud(db *gorm.DB) []tagCount {
+	var rows []struct{ Tags string }
+	db.Model(&models.PostModel{}).Select("tags").Find(&rows)
+
+	counts := map[string]int64{}
+	for _, row := range rows {
+		var tags []string
+		if err := json.Unmarshal([]byte(row.Tags), &tags); err != nil {
+			continue
+		}
+		for _, t := range tags {
+			tag := strings.TrimSpace(t)
+			if tag == "" {
+				continue
+			}
+			counts[tag]++
+		}
+	}
+
+	out := make([]tagCount, 0, len(counts))
+	for tag, count := range counts {
+		out = append(out, tagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	if len(out) > 20 {
+		out = out[:20]
+	}
+	return out
+}
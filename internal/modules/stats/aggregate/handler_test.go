@@ -0,0 +1,84 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestVisitorTrendUsesOneQuery(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	mock.ExpectQuery(regexp.QuoteMeta("COUNT(*) AS pv, COUNT(DISTINCT ip) AS uv")).
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "pv", "uv"}).
+			AddRow(yesterday, 5, 2).
+			AddRow(today, 7, 3))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	allow := func(c *gin.Context) { c.Next() }
+	RegisterRoutes(r.Group(""), db, nil, nil, nil, nil, allow)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/aggregate/stat/visitor-trend?days=7", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct {
+		Data []struct {
+			Date string `json:"date"`
+			PV   int64  `json:"pv"`
+			UV   int64  `json:"uv"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	days := body.Data
+	if len(days) != 7 {
+		t.Fatalf("got %d days, want 7: %s", len(days), w.Body.String())
+	}
+	if last := days[6]; last.Date != today || last.PV != 7 || last.UV != 3 {
+		t.Fatalf("today = %+v", last)
+	}
+	if days[0].PV != 0 || days[5].PV != 5 {
+		t.Fatalf("days = %+v", days)
+	}
+}
+
+func TestVisitorTrendRequiresAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	deny := func(c *gin.Context) { c.AbortWithStatus(http.StatusUnauthorized) }
+	RegisterRoutes(r.Group(""), nil, nil, nil, nil, nil, deny)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/aggregate/stat/visitor-trend", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+}
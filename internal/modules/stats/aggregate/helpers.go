@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/pagination"
+	"github.com/mx-space/core/internal/pkg/response"
 	"gorm.io/gorm"
 )
 
@@ -179,42 +181,6 @@ func buildReadLikeResponse(postTotals, noteTotals readLikeTotal, requestType int
 	}
 }
 
-func detectOS(ua string) string {
-	lower := strings.ToLower(ua)
-	switch {
-	case strings.Contains(lower, "windows"):
-		return "Windows"
-	case strings.Contains(lower, "mac os") || strings.Contains(lower, "macintosh"):
-		return "macOS"
-	case strings.Contains(lower, "android"):
-		return "Android"
-	case strings.Contains(lower, "iphone") || strings.Contains(lower, "ipad") || strings.Contains(lower, "ios"):
-		return "iOS"
-	case strings.Contains(lower, "linux"):
-		return "Linux"
-	default:
-		return "Unknown"
-	}
-}
-
-func detectBrowser(ua string) string {
-	lower := strings.ToLower(ua)
-	switch {
-	case strings.Contains(lower, "edg/"):
-		return "Edge"
-	case strings.Contains(lower, "chrome/"):
-		return "Chrome"
-	case strings.Contains(lower, "safari/") && !strings.Contains(lower, "chrome/"):
-		return "Safari"
-	case strings.Contains(lower, "firefox/"):
-		return "Firefox"
-	case strings.Contains(lower, "micromessenger"):
-		return "WeChat"
-	default:
-		return "Unknown"
-	}
-}
-
 type aggregateTotalRow struct {
 	Total int64 `gorm:"column:total"`
 }
@@ -257,6 +223,34 @@ func loadBucketCounts(tx *gorm.DB, timeColumn string, start, end time.Time, gran
 	return counts, nil
 }
 
+type visitorBucket struct {
+	Bucket string `gorm:"column:bucket"`
+	PV     int64  `gorm:"column:pv"`
+	UV     int64  `gorm:"column:uv"`
+}
+
+// loadVisitorBuckets groups analyze rows between start and end into page views
+// and distinct IPs per bucket with a single query.
+func loadVisitorBuckets(tx *gorm.DB, start, end time.Time, granularity string) (map[string]visitorBucket, error) {
+	buckets := map[string]visitorBucket{}
+	if tx == nil {
+		return buckets, nil
+	}
+	expr := aggregateTimeBucketExpr(tx, "timestamp", granularity)
+	var rows []visitorBucket
+	if err := tx.
+		Where("timestamp >= ? AND timestamp < ?", start, end).
+		Select(expr + " AS bucket, COUNT(*) AS pv, COUNT(DISTINCT ip) AS uv").
+		Group(expr).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		buckets[row.Bucket] = row
+	}
+	return buckets, nil
+}
+
 func aggregateTextLengthExpr(db *gorm.DB, column string) string {
 	column = strings.TrimSpace(column)
 	if column == "" {
@@ -300,3 +294,17 @@ func aggregateTimeBucketExpr(db *gorm.DB, column, granularity string) string {
 		}
 	}
 }
+
+// mergeTimelinePages combines the per-type pagination of a timeline page. Posts
+// and notes are paged side by side, so the timeline ends with the longer list.
+func mergeTimelinePages(q pagination.Query, pages []response.Pagination) response.Pagination {
+	merged := response.Pagination{CurrentPage: q.Page, Size: q.Size}
+	for _, p := range pages {
+		merged.Total += p.Total
+		if p.TotalPage > merged.TotalPage {
+			merged.TotalPage = p.TotalPage
+		}
+	}
+	merged.HasNextPage = merged.CurrentPage < merged.TotalPage
+	return merged
+}
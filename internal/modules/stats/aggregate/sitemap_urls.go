@@ -2,6 +2,8 @@ package aggregate
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -61,3 +63,61 @@ func GetSitemapURLs(db *gorm.DB, cfgSvc *appconfigs.Service) ([]string, error) {
 
 	return urls, nil
 }
+
+// BuildSitemapItems lists pages, public notes and published posts with their
+// last publish time, newest first. It backs both /aggregate/sitemap and /sitemap.xml.
+func BuildSitemapItems(db *gorm.DB, cfgSvc *appconfigs.Service) ([]SitemapItem, error) {
+	baseURL := ""
+	if cfg, err := cfgSvc.Get(); err == nil {
+		baseURL = strings.TrimRight(cfg.URL.WebURL, "/")
+	}
+
+	items := make([]SitemapItem, 0, 64)
+
+	var pages []models.PageModel
+	if err := db.Find(&pages).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range pages {
+		path := "/" + strings.TrimLeft(p.Slug, "/")
+		items = append(items, SitemapItem{
+			URL:         baseURL + path,
+			PublishedAt: publishedAt(p.CreatedAt, p.UpdatedAt),
+		})
+	}
+
+	var notes []models.NoteModel
+	if err := db.Where("is_published = ?", true).Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, n := range notes {
+		if n.PublicAt != nil && n.PublicAt.After(now) {
+			continue
+		}
+		items = append(items, SitemapItem{
+			URL:         baseURL + "/notes/" + strconv.Itoa(n.NID),
+			PublishedAt: publishedAt(n.CreatedAt, n.UpdatedAt),
+		})
+	}
+
+	var posts []models.PostModel
+	if err := db.Preload("Category").Where("is_published = ?", true).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range posts {
+		categorySlug := "uncategorized"
+		if p.Category != nil && p.Category.Slug != "" {
+			categorySlug = p.Category.Slug
+		}
+		items = append(items, SitemapItem{
+			URL:         baseURL + "/posts/" + categorySlug + "/" + p.Slug,
+			PublishedAt: publishedAt(p.CreatedAt, p.UpdatedAt),
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].PublishedAt.After(items[j].PublishedAt)
+	})
+	return items, nil
+}
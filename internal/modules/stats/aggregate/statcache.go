@@ -0,0 +1,114 @@
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/middleware"
+	"github.com/mx-space/core/internal/models"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	statCachePrefix = "mx:cache:stat:"
+	// siteWordsKey holds the running character count of posts, notes and pages.
+	siteWordsKey = "mx:stat:site_words"
+)
+
+// Default cache lifetimes in seconds, overridden by stat_cache_ttl in config.yml.
+var statCacheDefaults = map[string]int{
+	"stat":             60,
+	"tag_cloud":        300,
+	"count_site_words": 3600,
+}
+
+// adjustSiteWordsScript only moves a counter that is already seeded, so a
+// missing key is rebuilt from a full scan instead of starting from a delta.
+var adjustSiteWordsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("INCRBY", KEYS[1], ARGV[1])
+end
+return false
+`)
+
+func statCacheTTL(cfg *config.AppConfig, endpoint string) time.Duration {
+	seconds, ok := cfg.StatCacheTTLSeconds(endpoint)
+	if !ok {
+		seconds = statCacheDefaults[endpoint]
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// wantsRefresh reports whether an admin asked to skip cached stats with ?refresh=true.
+func wantsRefresh(c *gin.Context) bool {
+	return isTruthy(c.Query("refresh")) && middleware.IsAuthenticated(c)
+}
+
+// cachedStat returns the value cached under endpoint, or runs build and caches
+// its result for ttl. refresh skips the lookup but still stores the new value.
+func cachedStat[T any](ctx context.Context, rc *pkgredis.Client, endpoint string, ttl time.Duration, refresh bool, build func() (T, error)) (T, error) {
+	key := statCachePrefix + endpoint
+	if rc != nil && ttl > 0 && !refresh {
+		if raw, err := rc.Get(ctx, key); err == nil && raw != "" {
+			var cached T
+			if err := json.Unmarshal([]byte(raw), &cached); err == nil {
+				return cached, nil
+			}
+		}
+	}
+
+	value, err := build()
+	if err != nil {
+		return value, err
+	}
+	if rc != nil && ttl > 0 {
+		if body, err := json.Marshal(value); err == nil {
+			_ = rc.Set(ctx, key, body, ttl)
+		}
+	}
+	return value, nil
+}
+
+// loadSiteWords returns the running site word count, seeding it from a full
+// scan when it is missing, expired or refresh is set.
+func loadSiteWords(ctx context.Context, db *gorm.DB, rc *pkgredis.Client, ttl time.Duration, refresh bool) (int64, error) {
+	if rc != nil && ttl > 0 && !refresh {
+		if raw, err := rc.Get(ctx, siteWordsKey); err == nil && raw != "" {
+			if words, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				return words, nil
+			}
+		}
+	}
+
+	var total int64
+	for _, model := range []interface{}{&models.PostModel{}, &models.NoteModel{}, &models.PageModel{}} {
+		words, err := loadTextLengthTotal(db.Model(model), "text")
+		if err != nil {
+			return 0, err
+		}
+		total += words
+	}
+	if rc != nil && ttl > 0 {
+		_ = rc.Set(ctx, siteWordsKey, total, ttl)
+	}
+	return total, nil
+}
+
+// AdjustSiteWords moves the running site word count by delta. Content services
+// call it when post, note or page text changes; an unseeded count is left alone.
+func AdjustSiteWords(ctx context.Context, rc *pkgredis.Client, delta int64) error {
+	if rc == nil || delta == 0 {
+		return nil
+	}
+	err := adjustSiteWordsScript.Run(ctx, rc.Raw(), []string{siteWordsKey}, delta).Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
@@ -13,6 +13,13 @@ const (
 	readLikeTypePost = 0
 	readLikeTypeNote = 1
 	readLikeTypeAll  = 2
+
+	// timelineMaxItems caps each type of an unpaginated /aggregate/timeline.
+	timelineMaxItems = 1000
+
+	// heatmapDefaultDays and heatmapMaxDays bound ?days= of the activity heatmap.
+	heatmapDefaultDays = 365
+	heatmapMaxDays     = 730
 )
 
 type aggregateData struct {
@@ -104,11 +111,13 @@ type readLikeTotal struct {
 }
 
 type topNote struct {
-	ID      string         `json:"id"`
-	NID     int            `json:"nid"`
-	Title   string         `json:"title"`
-	Created time.Time      `json:"created"`
-	Images  []models.Image `json:"images"`
+	ID          string         `json:"id"`
+	NID         int            `json:"nid"`
+	Title       string         `json:"title"`
+	Created     time.Time      `json:"created"`
+	Images      []models.Image `json:"images"`
+	WordCount   int            `json:"word_count"`
+	ReadingTime int            `json:"reading_time"`
 }
 
 type topPost struct {
@@ -121,6 +130,8 @@ type topPost struct {
 		Name string `json:"name"`
 		Slug string `json:"slug"`
 	} `json:"category"`
+	WordCount   int `json:"word_count"`
+	ReadingTime int `json:"reading_time"`
 }
 
 type timelineNote struct {
@@ -132,6 +143,9 @@ type timelineNote struct {
 	Created  time.Time  `json:"created"`
 	Modified *time.Time `json:"modified"`
 	Bookmark bool       `json:"bookmark"`
+
+	WordCount   int `json:"word_count"`
+	ReadingTime int `json:"reading_time"`
 }
 
 type timelinePost struct {
@@ -145,9 +159,12 @@ type timelinePost struct {
 		Name string `json:"name"`
 		Slug string `json:"slug"`
 	} `json:"category"`
+	WordCount   int `json:"word_count"`
+	ReadingTime int `json:"reading_time"`
 }
 
-type sitemapItem struct {
+// SitemapItem is one public URL with the time it was last published or edited.
+type SitemapItem struct {
 	URL         string    `json:"url"`
 	PublishedAt time.Time `json:"published_at"`
 }
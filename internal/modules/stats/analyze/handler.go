@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/config"
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
@@ -18,9 +19,12 @@ import (
 )
 
 // Handler exposes analytics endpoints to admin users.
-type Handler struct{ db *gorm.DB }
+type Handler struct {
+	db  *gorm.DB
+	cfg *config.AppConfig
+}
 
-func NewHandler(db *gorm.DB) *Handler { return &Handler{db: db} }
+func NewHandler(db *gorm.DB, cfg *config.AppConfig) *Handler { return &Handler{db: db, cfg: cfg} }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g := rg.Group("/analyze", authMW)
@@ -34,6 +38,9 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g.GET("/total", h.total)
 	g.GET("/paths", h.topPaths)
 	g.DELETE("", h.cleanOld)
+
+	// Dashboard alias of GET /analyze: paginated rows with from/to filters.
+	rg.GET("/analyzes", authMW, h.list)
 }
 
 func (h *Handler) like(c *gin.Context) {
@@ -441,7 +448,7 @@ func (h *Handler) aggregate(c *gin.Context) {
 	})
 }
 
-// cleanOld deletes analytics older than 90 days (or the specified filter range).
+// cleanOld deletes analytics past the retention period (or the specified filter range).
 func (h *Handler) cleanOld(c *gin.Context) {
 	var aq analyzeQuery
 	if err := c.ShouldBindQuery(&aq); err != nil {
@@ -453,8 +460,7 @@ func (h *Handler) cleanOld(c *gin.Context) {
 	if aq.From != nil || aq.To != nil || aq.StartAt != nil || aq.EndAt != nil {
 		tx = applyFilter(tx, aq)
 	} else {
-		cutoff := time.Now().AddDate(0, 0, -90)
-		tx = tx.Where("timestamp < ?", cutoff)
+		tx = tx.Where("timestamp < ?", RetentionCutoff(h.cfg, time.Now()))
 	}
 	result := tx.Delete(&models.AnalyzeModel{})
 	response.OK(c, gin.H{"deleted": result.RowsAffected})
@@ -1,23 +1,25 @@
 package analyze
 
 import (
+	"net/http"
+	pathpkg "path"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/middleware"
 	"github.com/mx-space/core/internal/models"
-	"go.uber.org/zap"
-	"gorm.io/gorm"
+	"github.com/mx-space/core/internal/pkg/useragent"
 )
 
-// Middleware records each non-admin, non-bot public GET request as an analytics event.
-func Middleware(db *gorm.DB) gin.HandlerFunc {
-	logger := zap.L().Named("Analyze")
+// Middleware records each non-admin, non-bot public GET request as an analytics
+// event, handing it to rec for a batched insert.
+func Middleware(rec *Recorder) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next() // handle request first to get status code
 
-		// Track successful public GET requests.
-		if c.Request.Method != "GET" {
+		// Track successful public GET requests; OPTIONS and HEAD never count.
+		if c.Request.Method != http.MethodGet {
 			return
 		}
 		rawPath := strings.TrimSpace(c.Request.URL.Path)
@@ -26,8 +28,8 @@ func Middleware(db *gorm.DB) gin.HandlerFunc {
 		}
 		path := normalizeAnalyzePath(rawPath)
 
-		// Skip proxy paths
-		if strings.HasPrefix(path, "/proxy") {
+		// Skip proxy paths, health checks and static assets
+		if strings.HasPrefix(path, "/proxy") || isHealthPath(path) || isStaticAsset(path) {
 			return
 		}
 		if c.Writer.Status() < 200 || c.Writer.Status() >= 300 {
@@ -39,8 +41,8 @@ func Middleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Skip authenticated users (has Authorization header)
-		if c.GetHeader("Authorization") != "" {
+		// Skip admin requests (any auth token, valid or not)
+		if middleware.HasToken(c) || middleware.IsAuthenticated(c) {
 			return
 		}
 
@@ -49,23 +51,33 @@ func Middleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		ua := parseUA(c.GetHeader("User-Agent"))
-		referer := c.GetHeader("Referer")
-
-		go func() {
-			if err := db.Create(&models.AnalyzeModel{
-				IP:        ip,
-				UA:        ua,
-				Path:      path,
-				Referer:   referer,
-				Timestamp: time.Now(),
-			}).Error; err != nil {
-				logger.Warn("persist analyze event failed", zap.String("path", path), zap.String("ip", ip), zap.Error(err))
-			}
-		}()
+		rec.Record(models.AnalyzeModel{
+			IP:        ip,
+			UA:        parseUA(c.GetHeader("User-Agent")),
+			Path:      path,
+			Referer:   c.GetHeader("Referer"),
+			Timestamp: time.Now(),
+		})
 	}
 }
 
+// isHealthPath matches liveness probes and uptime checks.
+func isHealthPath(path string) bool {
+	return path == "/ping" || path == "/health" || strings.HasPrefix(path, "/health/")
+}
+
+var staticAssetExts = map[string]struct{}{
+	".js": {}, ".mjs": {}, ".css": {}, ".map": {}, ".ico": {},
+	".png": {}, ".jpg": {}, ".jpeg": {}, ".gif": {}, ".svg": {}, ".webp": {}, ".avif": {},
+	".woff": {}, ".woff2": {}, ".ttf": {},
+}
+
+// isStaticAsset matches file downloads such as scripts, styles, images and fonts.
+func isStaticAsset(path string) bool {
+	_, ok := staticAssetExts[strings.ToLower(pathpkg.Ext(path))]
+	return ok
+}
+
 // isBotUA returns true if the User-Agent string indicates a bot/crawler.
 func isBotUA(ua string) bool {
 	lower := strings.ToLower(ua)
@@ -126,48 +138,16 @@ func isDigits(raw string) bool {
 
 // parseUA extracts browser, OS, and device-type information from a UA string.
 func parseUA(ua string) map[string]interface{} {
-	result := map[string]interface{}{
+	info := useragent.Parse(ua)
+	deviceType := info.Device
+	if isBotUA(ua) {
+		deviceType = "bot"
+	}
+	return map[string]interface{}{
 		"ua":      ua,
 		"raw":     ua,
-		"type":    "desktop",
-		"browser": map[string]interface{}{"name": "Unknown"},
-		"os":      map[string]interface{}{"name": "Unknown"},
-	}
-	lower := strings.ToLower(ua)
-
-	switch {
-	case strings.Contains(lower, "edg/"):
-		result["browser"] = map[string]interface{}{"name": "Edge"}
-	case strings.Contains(lower, "chrome/"):
-		result["browser"] = map[string]interface{}{"name": "Chrome"}
-	case strings.Contains(lower, "safari/") && strings.Contains(lower, "version/"):
-		result["browser"] = map[string]interface{}{"name": "Safari"}
-	case strings.Contains(lower, "firefox/"):
-		result["browser"] = map[string]interface{}{"name": "Firefox"}
-	}
-
-	switch {
-	case strings.Contains(lower, "windows"):
-		result["os"] = map[string]interface{}{"name": "Windows"}
-	case strings.Contains(lower, "mac os"):
-		result["os"] = map[string]interface{}{"name": "macOS"}
-	case strings.Contains(lower, "android"):
-		result["os"] = map[string]interface{}{"name": "Android"}
-	case strings.Contains(lower, "iphone") || strings.Contains(lower, "ipad") || strings.Contains(lower, "ios"):
-		result["os"] = map[string]interface{}{"name": "iOS"}
-	case strings.Contains(lower, "linux"):
-		result["os"] = map[string]interface{}{"name": "Linux"}
-	}
-
-	switch {
-	case strings.Contains(lower, "bot") || strings.Contains(lower, "crawler") || strings.Contains(lower, "spider"):
-		result["type"] = "bot"
-	case strings.Contains(lower, "tablet") || strings.Contains(lower, "ipad"):
-		result["type"] = "tablet"
-	case strings.Contains(lower, "mobile"):
-		result["type"] = "mobile"
-	default:
-		result["type"] = "desktop"
+		"type":    deviceType,
+		"browser": map[string]interface{}{"name": info.Browser},
+		"os":      map[string]interface{}{"name": info.OS},
 	}
-	return result
 }
@@ -0,0 +1,95 @@
+package analyze
+
+import (
+	"context"
+	"time"
+
+	"github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	recordBufferSize    = 2048
+	recordBatchSize     = 200
+	recordFlushInterval = 5 * time.Second
+
+	// DefaultRetentionDays applies when analyze_retention_days is not configured.
+	DefaultRetentionDays = 90
+)
+
+// Recorder buffers analytics events and writes them in batches, so a page view
+// does not cost a database write on the request path.
+type Recorder struct {
+	db     *gorm.DB
+	events chan models.AnalyzeModel
+	logger *zap.Logger
+}
+
+func NewRecorder(db *gorm.DB) *Recorder {
+	return &Recorder{
+		db:     db,
+		events: make(chan models.AnalyzeModel, recordBufferSize),
+		logger: zap.L().Named("Analyze"),
+	}
+}
+
+// Record queues an event without blocking. Events are dropped while the buffer
+// is full.
+func (r *Recorder) Record(event models.AnalyzeModel) {
+	select {
+	case r.events <- event:
+	default:
+		r.logger.Debug("analyze buffer full, event dropped", zap.String("path", event.Path))
+	}
+}
+
+// Run writes queued events every few seconds or whenever a batch fills up. It
+// returns once ctx is done, after writing what is still buffered.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(recordFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.AnalyzeModel, 0, recordBatchSize)
+	for {
+		select {
+		case event := <-r.events:
+			batch = append(batch, event)
+			if len(batch) >= recordBatchSize {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-r.events:
+					batch = append(batch, event)
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) flush(batch []models.AnalyzeModel) []models.AnalyzeModel {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := r.db.CreateInBatches(batch, recordBatchSize).Error; err != nil {
+		r.logger.Warn("persist analyze events failed", zap.Int("count", len(batch)), zap.Error(err))
+	}
+	return batch[:0]
+}
+
+// RetentionCutoff is the timestamp before which analytics are purged.
+func RetentionCutoff(cfg *config.AppConfig, now time.Time) time.Time {
+	days, ok := cfg.AnalyzeRetentionDays()
+	if !ok {
+		days = DefaultRetentionDays
+	}
+	return now.AddDate(0, 0, -days)
+}
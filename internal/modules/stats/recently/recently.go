@@ -1,7 +1,10 @@
 package recently
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -9,11 +12,18 @@ import (
 	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/modules/gateway/gateway"
 	"github.com/mx-space/core/internal/pkg/pagination"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
 	"gorm.io/gorm"
 )
 
-var errRecentlyRefModelNotFound = errors.New("ref model not found")
+// attitudePrefix keys a hash per item mapping each voter IP to its attitude.
+const attitudePrefix = "mx:recently:attitude:"
+
+var (
+	errRecentlyRefModelNotFound = errors.New("ref model not found")
+	errAlreadyVoted             = errors.New("already voted")
+)
 
 type CreateRecentlyDTO struct {
 	Content      string          `json:"content"       binding:"required"`
@@ -37,6 +47,7 @@ type recentlyResponse struct {
 	UpCount      int             `json:"up"`
 	DownCount    int             `json:"down"`
 	AllowComment bool            `json:"allow_comment"`
+	Comments     int64           `json:"comments"`
 	Created      time.Time       `json:"created"`
 	Modified     *time.Time      `json:"modified"`
 }
@@ -52,10 +63,45 @@ func toResponse(r *models.RecentlyModel) recentlyResponse {
 	}
 }
 
-type Service struct{ db *gorm.DB }
+type Service struct {
+	db       *gorm.DB
+	rc       *pkgredis.Client
+	onCreate func(*models.RecentlyModel)
+}
 
 func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 
+// SetRedis enables deduping attitudes per IP (optional).
+func (s *Service) SetRedis(rc *pkgredis.Client) { s.rc = rc }
+
+// SetOnCreate registers a callback run in the background after a recently
+// is created.
+func (s *Service) SetOnCreate(fn func(*models.RecentlyModel)) { s.onCreate = fn }
+
+// CommentCounts returns the number of non-junk comments per item in one
+// grouped query.
+func (s *Service) CommentCounts(ids []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		RefID string
+		Count int64
+	}
+	if err := s.db.Model(&models.CommentModel{}).
+		Select("ref_id, COUNT(*) AS count").
+		Where("ref_id IN ? AND state <> ?", ids, models.CommentJunk).
+		Group("ref_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.RefID] = row.Count
+	}
+	return counts, nil
+}
+
 func (s *Service) List(q pagination.Query) ([]models.RecentlyModel, response.Pagination, error) {
 	tx := s.db.Model(&models.RecentlyModel{}).Order("created_at DESC")
 	var items []models.RecentlyModel
@@ -115,7 +161,13 @@ func (s *Service) Create(dto *CreateRecentlyDTO) (*models.RecentlyModel, error)
 	if dto.AllowComment != nil {
 		r.AllowComment = *dto.AllowComment
 	}
-	return &r, s.db.Create(&r).Error
+	if err := s.db.Create(&r).Error; err != nil {
+		return nil, err
+	}
+	if s.onCreate != nil {
+		go s.onCreate(&r)
+	}
+	return &r, nil
 }
 
 func (s *Service) Delete(id string) error {
@@ -126,6 +178,9 @@ func (s *Service) Delete(id string) error {
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
+	if s.rc != nil {
+		_ = s.rc.Del(context.Background(), attitudePrefix+id)
+	}
 	return nil
 }
 
@@ -153,10 +208,26 @@ func (s *Service) Update(id string, dto *UpdateRecentlyDTO) (*models.RecentlyMod
 	return r, s.db.Model(r).Updates(updates).Error
 }
 
-func (s *Service) Vote(id string, up bool) error {
-	col := "down_count"
+// Vote counts one attitude from ip on an item. With Redis it returns
+// errAlreadyVoted when ip has voted on the item before, and
+// gorm.ErrRecordNotFound when the item does not exist.
+func (s *Service) Vote(ctx context.Context, id, ip string, up bool) error {
+	col, attitude := "down_count", "down"
 	if up {
-		col = "up_count"
+		col, attitude = "up_count", "up"
+	}
+	var count int64
+	if err := s.db.Model(&models.RecentlyModel{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if s.rc != nil {
+		set, err := s.rc.Raw().HSetNX(ctx, attitudePrefix+id, ip, attitude).Result()
+		if err == nil && !set {
+			return errAlreadyVoted
+		}
 	}
 	return s.db.Model(&models.RecentlyModel{}).Where("id = ?", id).
 		UpdateColumn(col, gorm.Expr(col+" + 1")).Error
@@ -213,6 +284,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 		g.GET("/all", h.listAll)
 		g.GET("/latest", h.latest)
 		g.GET("/attitude/:id", h.attitude)
+		g.POST("/attitude/:id", h.attitude)
 		g.GET("/:id", h.get)
 		g.POST("/:id/up", h.voteUp)
 		g.POST("/:id/down", h.voteDown)
@@ -231,9 +303,10 @@ func (h *Handler) list(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
-	out := make([]recentlyResponse, len(items))
-	for i, r := range items {
-		out[i] = toResponse(&r)
+	out, err := h.toResponses(items)
+	if err != nil {
+		response.InternalError(c, err)
+		return
 	}
 	response.Paged(c, out, pag)
 }
@@ -248,7 +321,12 @@ func (h *Handler) get(c *gin.Context) {
 		response.NotFoundMsg(c, "内容不存在")
 		return
 	}
-	response.OK(c, toResponse(r))
+	out, err := h.toResponses([]models.RecentlyModel{*r})
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, out[0])
 }
 
 func (h *Handler) listAll(c *gin.Context) {
@@ -257,9 +335,10 @@ func (h *Handler) listAll(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
-	out := make([]recentlyResponse, len(items))
-	for i, r := range items {
-		out[i] = toResponse(&r)
+	out, err := h.toResponses(items)
+	if err != nil {
+		response.InternalError(c, err)
+		return
 	}
 	response.OK(c, out)
 }
@@ -274,36 +353,80 @@ func (h *Handler) latest(c *gin.Context) {
 		response.NotFoundMsg(c, "内容不存在")
 		return
 	}
-	response.OK(c, toResponse(r))
+	out, err := h.toResponses([]models.RecentlyModel{*r})
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, out[0])
+}
+
+// toResponses converts items, filling comment counts with one query.
+func (h *Handler) toResponses(items []models.RecentlyModel) ([]recentlyResponse, error) {
+	ids := make([]string, len(items))
+	for i := range items {
+		ids[i] = items[i].ID
+	}
+	counts, err := h.svc.CommentCounts(ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]recentlyResponse, len(items))
+	for i := range items {
+		out[i] = toResponse(&items[i])
+		out[i].Comments = counts[items[i].ID]
+	}
+	return out, nil
 }
 
 func (h *Handler) voteUp(c *gin.Context) {
-	if err := h.svc.Vote(c.Param("id"), true); err != nil {
-		response.InternalError(c, err)
-		return
+	if h.vote(c, true) {
+		response.NoContent(c)
 	}
-	response.NoContent(c)
 }
 
 func (h *Handler) voteDown(c *gin.Context) {
-	if err := h.svc.Vote(c.Param("id"), false); err != nil {
+	if h.vote(c, false) {
+		response.NoContent(c)
+	}
+}
+
+// vote records an attitude from the client IP, reporting whether it counted.
+func (h *Handler) vote(c *gin.Context, up bool) bool {
+	err := h.svc.Vote(c.Request.Context(), c.Param("id"), c.ClientIP(), up)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NotFoundMsg(c, "内容不存在")
+	case errors.Is(err, errAlreadyVoted):
+		response.BadRequest(c, "你已经表过态了")
+	default:
 		response.InternalError(c, err)
-		return
 	}
-	response.NoContent(c)
+	return false
 }
 
+// GET|POST /recently/attitude/:id — attitude comes from the query, or for POST
+// from a JSON body {"attitude": "up"}.
 func (h *Handler) attitude(c *gin.Context) {
-	isUp, ok := parseAttitude(c.Query("attitude"))
+	raw := c.Query("attitude")
+	if raw == "" && c.Request.Method == http.MethodPost {
+		var body struct {
+			Attitude interface{} `json:"attitude"`
+		}
+		if err := c.ShouldBindJSON(&body); err == nil && body.Attitude != nil {
+			raw = fmt.Sprint(body.Attitude)
+		}
+	}
+	isUp, ok := parseAttitude(raw)
 	if !ok {
 		response.BadRequest(c, "attitude must be up|down|0|1")
 		return
 	}
-	if err := h.svc.Vote(c.Param("id"), isUp); err != nil {
-		response.InternalError(c, err)
-		return
+	if h.vote(c, isUp) {
+		response.OK(c, gin.H{"code": 1})
 	}
-	response.OK(c, gin.H{"code": 1})
 }
 
 func parseAttitude(raw string) (isUp bool, ok bool) {
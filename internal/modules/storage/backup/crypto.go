@@ -0,0 +1,235 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted archive layout:
+//
+//	magic(8) | version(1) | salt(16) | nonce(12) | body
+//
+// Version 1 body is a single AES-256-GCM ciphertext over the whole archive.
+// Version 2 body is a sequence of chunks so archives can be encrypted while streaming:
+//
+//	final(1) | length(4, big endian) | ciphertext
+//
+// Each chunk uses the base nonce XOR its counter and authenticates header+final,
+// so reordering, truncation and flag flipping all fail decryption.
+const (
+	encryptedBackupMagic   = "MXBAKENC"
+	encryptedBackupV1      = 1
+	encryptedBackupV2      = 2
+	encryptedBackupSuffix  = ".enc"
+	encryptionSaltSize     = 16
+	encryptionKeySize      = 32
+	encryptionChunkSize    = 64 << 10
+	encryptionChunkMaxSize = encryptionChunkSize + 64
+	scryptN                = 1 << 15
+	scryptR                = 8
+	scryptP                = 1
+)
+
+var (
+	errBackupPassphraseRequired = errors.New("backup is encrypted, passphrase is required")
+	errBackupPassphraseInvalid  = errors.New("wrong passphrase or corrupted encrypted backup")
+)
+
+// isEncryptedBackup reports whether payload is an encrypted backup container.
+func isEncryptedBackup(payload []byte) bool {
+	return bytes.HasPrefix(payload, []byte(encryptedBackupMagic))
+}
+
+// encryptWriter encrypts everything written to it into a version 2 container.
+type encryptWriter struct {
+	dst     io.Writer
+	gcm     cipher.AEAD
+	header  []byte
+	nonce   []byte
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+// newEncryptWriter writes the container header to dst and returns a writer
+// whose Close flushes the final chunk. It does not close dst.
+func newEncryptWriter(dst io.Writer, passphrase string) (*encryptWriter, error) {
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newBackupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(encryptedBackupMagic)+1+len(salt)+len(nonce))
+	header = append(header, encryptedBackupMagic...)
+	header = append(header, encryptedBackupV2)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		dst:    dst,
+		gcm:    gcm,
+		header: header,
+		nonce:  nonce,
+		buf:    make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		// Keep a full buffer pending until more data arrives so the last chunk can carry the final flag.
+		if len(w.buf) == cap(w.buf) && len(p) > 0 {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+func (w *encryptWriter) flush(final bool) error {
+	flag := byte(0)
+	if final {
+		flag = 1
+	}
+	sealed := w.gcm.Seal(nil, chunkNonce(w.nonce, w.counter), w.buf, chunkAAD(w.header, flag))
+	w.counter++
+	w.buf = w.buf[:0]
+
+	prefix := [5]byte{flag}
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(sealed)))
+	if _, err := w.dst.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.dst.Write(sealed)
+	return err
+}
+
+func decryptBackup(payload []byte, passphrase string) ([]byte, error) {
+	if !isEncryptedBackup(payload) {
+		return payload, nil
+	}
+	if passphrase == "" {
+		return nil, errBackupPassphraseRequired
+	}
+
+	offset := len(encryptedBackupMagic)
+	if len(payload) < offset+1+encryptionSaltSize {
+		return nil, errBackupPassphraseInvalid
+	}
+	version := payload[offset]
+	if version != encryptedBackupV1 && version != encryptedBackupV2 {
+		return nil, fmt.Errorf("unsupported encrypted backup version %d", version)
+	}
+	offset++
+	salt := payload[offset : offset+encryptionSaltSize]
+	offset += encryptionSaltSize
+
+	gcm, err := newBackupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < offset+gcm.NonceSize() {
+		return nil, errBackupPassphraseInvalid
+	}
+	nonce := payload[offset : offset+gcm.NonceSize()]
+	header := payload[:offset+gcm.NonceSize()]
+	body := payload[len(header):]
+
+	if version == encryptedBackupV1 {
+		plain, err := gcm.Open(nil, nonce, body, header)
+		if err != nil {
+			return nil, errBackupPassphraseInvalid
+		}
+		return plain, nil
+	}
+
+	plain := make([]byte, 0, len(body))
+	for counter := uint64(0); ; counter++ {
+		if len(body) < 5 {
+			return nil, errBackupPassphraseInvalid
+		}
+		flag := body[0]
+		size := int(binary.BigEndian.Uint32(body[1:5]))
+		body = body[5:]
+		if flag > 1 || size > encryptionChunkMaxSize || size > len(body) {
+			return nil, errBackupPassphraseInvalid
+		}
+		plain, err = gcm.Open(plain, chunkNonce(nonce, counter), body[:size], chunkAAD(header, flag))
+		if err != nil {
+			return nil, errBackupPassphraseInvalid
+		}
+		body = body[size:]
+		if flag == 1 {
+			if len(body) != 0 {
+				return nil, errBackupPassphraseInvalid
+			}
+			return plain, nil
+		}
+	}
+}
+
+func chunkNonce(base []byte, counter uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	var ctr [8]byte
+	binary.BigEndian.PutUint64(ctr[:], counter)
+	tail := nonce[len(nonce)-8:]
+	for i := range tail {
+		tail[i] ^= ctr[i]
+	}
+	return nonce
+}
+
+func chunkAAD(header []byte, flag byte) []byte {
+	aad := make([]byte, len(header)+1)
+	copy(aad, header)
+	aad[len(header)] = flag
+	return aad
+}
+
+func newBackupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, encryptionKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -3,16 +3,22 @@ package backup
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/modules/gateway/gateway"
 	"github.com/mx-space/core/internal/modules/system/core/configs"
+	pkgcron "github.com/mx-space/core/internal/pkg/cron"
 	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"github.com/mx-space/core/internal/pkg/response"
 	"go.uber.org/zap"
@@ -20,10 +26,13 @@ import (
 )
 
 func NewHandler(db *gorm.DB, cfgSvc *configs.Service, rc *pkgredis.Client, opts ...HandlerOption) *Handler {
-	h := &Handler{db: db, cfgSvc: cfgSvc, rc: rc, logger: zap.NewNop()}
+	h := &Handler{db: db, cfgSvc: cfgSvc, rc: rc, logger: zap.NewNop(), jobs: newRestoreJobs()}
 	for _, o := range opts {
 		o(h)
 	}
+	if h.sched == nil {
+		h.sched = &Scheduler{h: h}
+	}
 	return h
 }
 
@@ -39,14 +48,45 @@ func WithLogger(l *zap.Logger) HandlerOption {
 	}
 }
 
+// WithScheduler makes the run-now and status endpoints use the process's
+// backup scheduler, so they share its run guard.
+func WithScheduler(s *Scheduler) HandlerOption {
+	return func(h *Handler) {
+		h.sched = s
+	}
+}
+
+// WithHub sets the gateway hub used for restore progress events.
+func WithHub(hub *gateway.Hub) HandlerOption {
+	return func(h *Handler) {
+		h.hub = hub
+	}
+}
+
+// WithSearchReindex sets the function that rebuilds the search index after
+// a restore, returning the number of documents indexed.
+func WithSearchReindex(fn func() (int, error)) HandlerOption {
+	return func(h *Handler) {
+		h.reindex = fn
+	}
+}
+
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g := rg.Group("/backups", authMW)
 
 	g.GET("", h.list)
 	g.GET("/new", h.createAndDownload)
+	g.GET("/status", h.scheduleStatus)
+	g.POST("/run-now", h.runNow)
+	g.GET("/restore/:jobId", h.restoreStatus)
+	g.GET("/remote", h.listRemote)
+	g.GET("/remote/:key/download", h.downloadRemote)
+	g.POST("/remote/:key/restore", h.restoreRemote)
 	g.GET("/:filename", h.download)
 	g.POST("", h.uploadAndRestore)
 	g.POST("/rollback", h.uploadAndRestore)
+	g.POST("/rollback/stream", h.uploadAndRestoreStream)
+	g.POST("/validate", h.validate)
 	g.POST("/upload-to-s3", h.uploadToS3)
 	g.PATCH("/rollback/:filename", h.rollback)
 	g.PATCH("/:filename", h.rollback)
@@ -63,34 +103,71 @@ func (h *Handler) list(c *gin.Context) {
 // GET /backups/new
 func (h *Handler) createAndDownload(c *gin.Context) {
 	h.logger.Info("备份数据库中...")
-	buf, err := h.createBackupZip()
+	now := time.Now()
+	passphrase := h.backupPassphrase(c)
+	filename := backupFilename(now, passphrase != "")
+
+	// The archive is streamed to the client while it is written to disk.
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Content-Type", backupContentType(filename))
+	artifact, err := h.createLocalBackupArtifact(now, passphrase, c.Writer)
 	if err != nil {
 		h.logger.Warn("备份失败", zap.Error(err))
+		if c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		c.Header("Content-Disposition", "")
+		c.Header("Content-Type", "")
 		response.InternalError(c, err)
 		return
 	}
+	h.logger.Info(fmt.Sprintf("备份成功：%s", artifact.Filename))
+}
 
-	backupDir := resolveBackupDir()
-	if err := os.MkdirAll(backupDir, 0o755); err != nil {
-		response.InternalError(c, err)
+// GET /backups/status
+func (h *Handler) scheduleStatus(c *gin.Context) {
+	st := h.sched.loadStatus(c.Request.Context())
+	if h.cfgSvc != nil {
+		if cfg, err := h.cfgSvc.Get(); err == nil && cfg != nil {
+			st.Enabled = cfg.BackupOptions.Enable
+			st.Cron = backupCronSpec(cfg.BackupOptions.Cron)
+			st.NextRunAt = nil
+			if st.Enabled {
+				if schedule, err := pkgcron.ParseExpr(st.Cron); err == nil {
+					if next := schedule.Next(time.Now()); !next.IsZero() {
+						st.NextRunAt = &next
+					}
+				}
+			}
+		}
+	}
+	response.OK(c, st)
+}
+
+// POST /backups/run-now
+func (h *Handler) runNow(c *gin.Context) {
+	if h.cfgSvc == nil {
+		response.InternalError(c, fmt.Errorf("config service is unavailable"))
 		return
 	}
-	filename := fmt.Sprintf("backup-%s.zip", time.Now().Format("2006-01-02T15-04-05"))
-	path := filepath.Join(backupDir, filename)
-	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+	sched := h.sched
+	// Detach from the request so a closed tab does not abort a half-written backup.
+	if err := sched.Run(context.WithoutCancel(c.Request.Context())); err != nil {
+		if errors.Is(err, errBackupRunning) {
+			response.Conflict(c, "备份正在进行中")
+			return
+		}
 		response.InternalError(c, err)
 		return
 	}
-
-	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
-	c.Data(http.StatusOK, "application/zip", buf.Bytes())
-	h.logger.Info(fmt.Sprintf("备份成功：%s", filename))
+	response.OK(c, sched.loadStatus(c.Request.Context()))
 }
 
 // GET /backups/:filename
 func (h *Handler) download(c *gin.Context) {
 	filename := filepath.Base(c.Param("filename"))
-	if !strings.HasSuffix(filename, ".zip") {
+	if !isBackupFilename(filename) {
 		response.BadRequest(c, "invalid filename")
 		return
 	}
@@ -106,7 +183,7 @@ func (h *Handler) download(c *gin.Context) {
 		return
 	}
 	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
-	c.Data(http.StatusOK, "application/zip", data)
+	c.Data(http.StatusOK, backupContentType(filename), data)
 }
 
 // POST /backups/rollback
@@ -130,20 +207,176 @@ func (h *Handler) uploadAndRestore(c *gin.Context) {
 		return
 	}
 
-	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	opts, ok := restoreOptionsFromRequest(c)
+	if !ok {
+		return
+	}
+	zr, ok := h.openBackupArchive(c, data)
+	if !ok {
+		return
+	}
+
+	if opts.DryRun {
+		report, err := RestoreFromZipWithOptions(h.db, zr, opts)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		response.OK(c, report)
+		return
+	}
+	h.logger.Info("数据恢复（上传文件）")
+	h.acceptRestoreJob(c, file.Filename, zr, opts)
+}
+
+// POST /backups/rollback/stream
+//
+// Same as POST /backups/rollback but holds the request open and reports progress
+// as server-sent events: `progress` per table step, then `done` or `error`.
+func (h *Handler) uploadAndRestoreStream(c *gin.Context) {
+	file, err := c.FormFile("file")
 	if err != nil {
-		response.BadRequest(c, "invalid zip file")
+		response.BadRequest(c, "missing file")
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		response.InternalError(c, err)
 		return
 	}
+	defer src.Close()
 
-	if err := RestoreFromZip(h.db, zr); err != nil {
-		h.logger.Warn("数据恢复失败", zap.Error(err))
+	data, err := io.ReadAll(src)
+	if err != nil {
 		response.InternalError(c, err)
 		return
 	}
-	h.invalidateRuntimeCaches(c)
-	h.logger.Info("数据恢复成功（上传文件）")
-	response.OK(c, gin.H{"message": "restore successful"})
+	opts, ok := restoreOptionsFromRequest(c)
+	if !ok {
+		return
+	}
+	if opts.DryRun {
+		response.BadRequest(c, "dry_run is not supported when streaming")
+		return
+	}
+	zr, ok := h.openBackupArchive(c, data)
+	if !ok {
+		return
+	}
+
+	// Progress must never block the restore; a slow client only misses steps.
+	events := make(chan RestoreProgress, 64)
+	opts.Progress = func(p RestoreProgress) {
+		select {
+		case events <- p:
+		default:
+		}
+	}
+	job, err := h.startRestoreJob(c.Request.Context(), file.Filename, zr, opts)
+	if err != nil {
+		if errors.Is(err, errRestoreRunning) {
+			response.Conflict(c, "数据恢复正在进行中")
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	h.logger.Info("数据恢复（上传文件，SSE）")
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(event string, payload interface{}) {
+		data, _ := json.Marshal(payload)
+		fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data)
+		c.Writer.Flush()
+	}
+	send("job", gin.H{"job_id": job.ID})
+	for {
+		select {
+		case p := <-events:
+			send("progress", p)
+		case <-job.done:
+			// Drain what was reported before completion.
+			for len(events) > 0 {
+				send("progress", <-events)
+			}
+			final, _ := h.restoreJob(context.WithoutCancel(c.Request.Context()), job.ID)
+			if final == nil || final.Status != restoreJobStatusSucceeded {
+				message := "restore failed"
+				if final != nil && final.Error != "" {
+					message = final.Error
+				}
+				send("error", gin.H{"message": message})
+				return
+			}
+			send("done", final)
+			return
+		case <-c.Request.Context().Done():
+			// The job keeps running; GET /backups/restore/:jobId still reports it.
+			return
+		}
+	}
+}
+
+// acceptRestoreJob starts a background restore and answers 202 with its job,
+// or 409 while another restore is running.
+func (h *Handler) acceptRestoreJob(c *gin.Context, source string, zr *zip.Reader, opts RestoreOptions) {
+	job, err := h.startRestoreJob(c.Request.Context(), source, zr, opts)
+	if err != nil {
+		if errors.Is(err, errRestoreRunning) {
+			response.Conflict(c, "数据恢复正在进行中")
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "job": job})
+}
+
+// GET /backups/restore/:jobId
+func (h *Handler) restoreStatus(c *gin.Context) {
+	job, ok := h.restoreJob(c.Request.Context(), c.Param("jobId"))
+	if !ok {
+		response.NotFoundMsg(c, "恢复任务不存在")
+		return
+	}
+	response.OK(c, job)
+}
+
+// POST /backups/validate
+func (h *Handler) validate(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		response.BadRequest(c, "missing file")
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	zr, ok := h.openBackupArchive(c, data)
+	if !ok {
+		return
+	}
+
+	report, err := ValidateBackupZip(h.db, zr)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, report)
 }
 
 // PATCH /backups/rollback/:filename
@@ -161,28 +394,115 @@ func (h *Handler) rollback(c *gin.Context) {
 		return
 	}
 
+	opts, ok := restoreOptionsFromRequest(c)
+	if !ok {
+		return
+	}
+	zr, ok := h.openBackupArchive(c, data)
+	if !ok {
+		return
+	}
+
+	if opts.DryRun {
+		report, err := RestoreFromZipWithOptions(h.db, zr, opts)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		response.OK(c, report)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("回滚备份：%s", filename))
+	h.acceptRestoreJob(c, filename, zr, opts)
+}
+
+// restoreOptionsFromRequest reads `tables`, `dry_run` and `reindex` (default
+// true) from the query string or multipart form. It writes a 400 response and reports false on unknown tables.
+func restoreOptionsFromRequest(c *gin.Context) (RestoreOptions, bool) {
+	var opts RestoreOptions
+	tables := c.Query("tables")
+	if tables == "" {
+		tables = c.PostForm("tables")
+	}
+	if tables != "" {
+		opts.Tables = strings.Split(tables, ",")
+		if _, err := resolveRestoreTables(opts.Tables); err != nil {
+			response.BadRequest(c, err.Error())
+			return opts, false
+		}
+	}
+	dryRun := c.Query("dry_run")
+	if dryRun == "" {
+		dryRun = c.PostForm("dry_run")
+	}
+	opts.DryRun, _ = strconv.ParseBool(strings.TrimSpace(dryRun))
+	reindex := c.Query("reindex")
+	if reindex == "" {
+		reindex = c.PostForm("reindex")
+	}
+	opts.Reindex = true
+	if v, err := strconv.ParseBool(strings.TrimSpace(reindex)); err == nil {
+		opts.Reindex = v
+	}
+	return opts, true
+}
+
+// openBackupArchive decrypts an encrypted container when needed and opens the ZIP.
+// Tarballs, such as a packed mongodump directory, are repacked as ZIP first.
+// It writes the error response itself and reports false on failure.
+func (h *Handler) openBackupArchive(c *gin.Context, data []byte) (*zip.Reader, bool) {
+	if isEncryptedBackup(data) {
+		plain, err := decryptBackup(data, h.backupPassphrase(c))
+		if err != nil {
+			response.BadRequest(c, err.Error())
+			return nil, false
+		}
+		data = plain
+	}
+
+	data, err := archiveToZip(data)
+	if err != nil {
+		response.BadRequest(c, "invalid tar archive: "+err.Error())
+		return nil, false
+	}
 	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
 		response.BadRequest(c, "invalid zip file")
-		return
+		return nil, false
 	}
+	return zr, true
+}
 
-	h.logger.Info(fmt.Sprintf("回滚备份：%s", filename))
-	if err := RestoreFromZip(h.db, zr); err != nil {
-		h.logger.Warn("回滚失败", zap.Error(err))
-		response.InternalError(c, err)
-		return
+// backupPassphrase prefers an explicit ?passphrase= (or form field) over BackupOptions.Passphrase.
+func (h *Handler) backupPassphrase(c *gin.Context) string {
+	if v := c.Query("passphrase"); v != "" {
+		return v
+	}
+	if v := c.PostForm("passphrase"); v != "" {
+		return v
 	}
-	h.invalidateRuntimeCaches(c)
-	h.logger.Info("回滚成功")
-	response.OK(c, gin.H{"message": "rollback successful"})
+	return h.configuredPassphrase()
 }
 
-func (h *Handler) invalidateRuntimeCaches(c *gin.Context) {
+func (h *Handler) configuredPassphrase() string {
+	if h.cfgSvc == nil {
+		return ""
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return ""
+	}
+	return cfg.BackupOptions.Passphrase
+}
+
+func (h *Handler) invalidateRuntimeCaches(ctx context.Context) {
 	if h.cfgSvc != nil {
 		h.cfgSvc.Invalidate()
 	}
-	_ = h.rc.Raw().FlushDB(c.Request.Context())
+	if h.rc != nil {
+		_ = h.rc.Raw().FlushDB(ctx)
+	}
 }
 
 // DELETE /backups
@@ -205,7 +525,7 @@ func (h *Handler) delete(c *gin.Context) {
 	filenames := strings.Split(files, ",")
 	for _, name := range filenames {
 		name = strings.TrimSpace(filepath.Base(name))
-		if name == "" || !strings.HasSuffix(name, ".zip") {
+		if name == "" || !isBackupFilename(name) {
 			continue
 		}
 		os.Remove(filepath.Join(backupDir, name))
@@ -215,7 +535,7 @@ func (h *Handler) delete(c *gin.Context) {
 
 func (h *Handler) deleteOne(c *gin.Context) {
 	filename := strings.TrimSpace(filepath.Base(c.Param("filename")))
-	if filename == "" || !strings.HasSuffix(filename, ".zip") {
+	if filename == "" || !isBackupFilename(filename) {
 		response.BadRequest(c, "invalid filename")
 		return
 	}
@@ -253,7 +573,7 @@ func (h *Handler) uploadToS3(c *gin.Context) {
 	}
 
 	now := time.Now()
-	artifact, err := h.createLocalBackupArtifact(now)
+	artifact, err := h.createLocalBackupArtifact(now, h.backupPassphrase(c), nil)
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -261,7 +581,7 @@ func (h *Handler) uploadToS3(c *gin.Context) {
 
 	key := renderBackupObjectKey(cfg.BackupOptions.Path, artifact.Filename, now)
 	h.logger.Info(fmt.Sprintf("上传备份到 S3：%s", key))
-	if _, err := uploader.Upload(c.Request.Context(), key, artifact.Buffer.Bytes(), "application/zip"); err != nil {
+	if _, err := uploader.UploadFile(c.Request.Context(), key, artifact.Path, backupContentType(artifact.Filename)); err != nil {
 		h.logger.Warn("S3 上传失败", zap.Error(err))
 		response.InternalError(c, err)
 		return
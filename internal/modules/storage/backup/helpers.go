@@ -1,16 +1,13 @@
 package backup
 
 import (
-	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"math"
 	"strings"
 	"time"
 	"unicode"
 
-	mysqlDriver "github.com/go-sql-driver/mysql"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -51,6 +48,9 @@ func renderBackupObjectKey(template, filename string, now time.Time) string {
 	if key == "" {
 		return filename
 	}
+	if strings.HasSuffix(filename, encryptedBackupSuffix) && !strings.HasSuffix(key, encryptedBackupSuffix) {
+		key += encryptedBackupSuffix
+	}
 	return key
 }
 
@@ -163,20 +163,6 @@ func isTimeLikeType(dbType string) bool {
 		strings.Contains(dbType, "YEAR")
 }
 
-func isDuplicateConstraintError(err error) bool {
-	if err == nil {
-		return false
-	}
-	var mysqlErr *mysqlDriver.MySQLError
-	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
-		return true
-	}
-	msg := strings.ToLower(err.Error())
-	return strings.Contains(msg, "duplicate entry") ||
-		strings.Contains(msg, "duplicate key") ||
-		strings.Contains(msg, "unique constraint")
-}
-
 func normalizeBSONValue(value interface{}) interface{} {
 	switch v := value.(type) {
 	case nil:
@@ -257,25 +243,12 @@ func normalizeBackupValue(value interface{}) interface{} {
 	}
 }
 
-func encodeBSONRows(rows []map[string]interface{}) ([]byte, error) {
-	if len(rows) == 0 {
-		return []byte{}, nil
-	}
-	buffer := bytes.NewBuffer(nil)
-	for _, row := range rows {
-		doc := make(map[string]interface{}, len(row))
-		for key, value := range row {
-			doc[key] = normalizeBackupValue(value)
-		}
-		b, err := bson.Marshal(doc)
-		if err != nil {
-			return nil, err
-		}
-		if _, err := buffer.Write(b); err != nil {
-			return nil, err
-		}
+func encodeBSONRow(row map[string]interface{}) ([]byte, error) {
+	doc := make(map[string]interface{}, len(row))
+	for key, value := range row {
+		doc[key] = normalizeBackupValue(value)
 	}
-	return buffer.Bytes(), nil
+	return bson.Marshal(doc)
 }
 
 func decodeBSONRows(payload []byte) ([]map[string]interface{}, error) {
@@ -2,16 +2,22 @@ package backup
 
 import (
 	"archive/zip"
-	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/pkg/dialect"
 	"gorm.io/gorm"
 )
 
@@ -33,7 +39,7 @@ func listBackups() []backupItem {
 	}
 	var items []backupItem
 	for _, e := range entries {
-		if e.IsDir() || !strings.HasSuffix(e.Name(), ".zip") {
+		if e.IsDir() || !isBackupFilename(e.Name()) {
 			continue
 		}
 		info, err := e.Info()
@@ -51,81 +57,277 @@ func listBackups() []backupItem {
 	return items
 }
 
-func (h *Handler) createLocalBackupArtifact(now time.Time) (*backupArtifact, error) {
-	buf, err := h.createBackupZip()
+// pruneLocalBackups removes backup archives beyond the newest `keep` copies or
+// older than `maxAgeDays`. A non-positive value disables the respective rule.
+func pruneLocalBackups(keep, maxAgeDays int) []string {
+	if keep <= 0 && maxAgeDays <= 0 {
+		return nil
+	}
+	backupDir := resolveBackupDir()
+	entries, err := os.ReadDir(backupDir)
 	if err != nil {
-		return nil, err
+		return nil
+	}
+
+	type backupFile struct {
+		name    string
+		modTime time.Time
+	}
+	files := make([]backupFile, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !isBackupFilename(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, backupFile{name: e.Name(), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	var cutoff time.Time
+	if maxAgeDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -maxAgeDays)
 	}
+	removed := make([]string, 0)
+	for i, f := range files {
+		expired := !cutoff.IsZero() && f.modTime.Before(cutoff)
+		if !expired && (keep <= 0 || i < keep) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(backupDir, f.name)); err == nil {
+			removed = append(removed, f.name)
+		}
+	}
+	return removed
+}
+
+// isBackupFilename accepts plain and encrypted backup archives.
+func isBackupFilename(name string) bool {
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".zip"+encryptedBackupSuffix)
+}
+
+func backupContentType(filename string) string {
+	if strings.HasSuffix(filename, encryptedBackupSuffix) {
+		return "application/octet-stream"
+	}
+	return "application/zip"
+}
+
+func backupFilename(now time.Time, encrypted bool) string {
+	filename := fmt.Sprintf("backup-%s.zip", now.Format("2006-01-02T15-04-05"))
+	if encrypted {
+		filename += encryptedBackupSuffix
+	}
+	return filename
+}
+
+// createLocalBackupArtifact streams a new backup into the backup directory, and
+// into mirror (e.g. an HTTP response) when non-nil. The archive is encrypted into
+// a .zip.enc container when passphrase is set.
+func (h *Handler) createLocalBackupArtifact(now time.Time, passphrase string, mirror io.Writer) (*backupArtifact, error) {
 	backupDir := resolveBackupDir()
 	if err := os.MkdirAll(backupDir, 0o755); err != nil {
 		return nil, err
 	}
+	tmp, err := os.CreateTemp(backupDir, ".backup-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
 
-	filename := fmt.Sprintf("backup-%s.zip", now.Format("2006-01-02T15-04-05"))
+	var dst io.Writer = tmp
+	if mirror != nil {
+		dst = io.MultiWriter(tmp, mirror)
+	}
+	counter := &countingWriter{w: dst}
+	var sink io.Writer = counter
+	var enc *encryptWriter
+	if passphrase != "" {
+		if enc, err = newEncryptWriter(counter, passphrase); err != nil {
+			return nil, fmt.Errorf("encrypt backup: %w", err)
+		}
+		sink = enc
+	}
+
+	manifest, err := h.writeBackupZip(sink)
+	if err != nil {
+		return nil, err
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return nil, fmt.Errorf("encrypt backup: %w", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	filename := backupFilename(now, passphrase != "")
 	filePath := filepath.Join(backupDir, filename)
-	if err := os.WriteFile(filePath, buf.Bytes(), 0o644); err != nil {
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
 		return nil, err
 	}
+	committed = true
+	_ = os.Chmod(filePath, 0o644)
 
 	return &backupArtifact{
 		Filename: filename,
 		Path:     filePath,
-		Buffer:   buf,
+		Size:     counter.n,
+		Manifest: manifest,
 	}, nil
 }
 
-// createBackupZip exports all tables as BSON into a ZIP archive.
-func (h *Handler) createBackupZip() (*bytes.Buffer, error) {
-	buf := &bytes.Buffer{}
-	w := zip.NewWriter(buf)
+// writeBackupZip streams every table as BSON into a ZIP archive written to w.
+// Rows are read through a cursor, so at most one row is held in memory at a time.
+func (h *Handler) writeBackupZip(w io.Writer) (*backupManifest, error) {
+	zw := zip.NewWriter(w)
+	compress := h.compressTables()
+
+	manifest := &backupManifest{
+		Format:    backupFormat,
+		Version:   backupFormatVersion,
+		Engine:    dialect.Name(h.db),
+		CreatedAt: time.Now().UTC(),
+		Tables:    make([]string, 0, len(backupTableNames)),
+		RowCounts: make(map[string]int64, len(backupTableNames)),
+		Checksums: make(map[string]string, len(backupTableNames)),
+	}
+	if compress {
+		manifest.Compression = backupCompressionGzip
+	}
 
-	exportedTables := make([]string, 0, len(backupTableNames))
 	for _, table := range backupTableNames {
-		var rows []map[string]interface{}
-		if err := h.db.Table(table).Find(&rows).Error; err != nil {
+		rows, err := h.db.Table(table).Rows()
+		if err != nil {
+			// Tables missing from this schema are simply not exported.
 			continue
 		}
+		count, sum, err := h.writeBackupTable(zw, table, rows, compress)
+		_ = rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("export table %s: %w", table, err)
+		}
+		manifest.Tables = append(manifest.Tables, table)
+		manifest.RowCounts[table] = count
+		manifest.Checksums[table] = sum
+	}
+	manifest.ArchiveSHA256 = archiveChecksum(manifest)
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	mf, err := zw.Create(backupManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mf.Write(manifestData); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
 
-		payload, err := encodeBSONRows(rows)
+// writeBackupTable writes one table entry and returns its row count and the
+// hex SHA-256 of the uncompressed BSON payload.
+func (h *Handler) writeBackupTable(zw *zip.Writer, table string, rows *sql.Rows, compress bool) (int64, string, error) {
+	var (
+		entry io.Writer
+		gz    *gzip.Writer
+		err   error
+	)
+	if compress {
+		// Already gzipped; deflating again only costs CPU.
+		entry, err = zw.CreateHeader(&zip.FileHeader{
+			Name:     path.Join(backupDBDir, table+".bson.gz"),
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
 		if err != nil {
-			continue
+			return 0, "", err
 		}
+		gz = gzip.NewWriter(entry)
+		entry = gz
+	} else if entry, err = zw.Create(path.Join(backupDBDir, table+".bson")); err != nil {
+		return 0, "", err
+	}
+	hasher := sha256.New()
+	entry = io.MultiWriter(entry, hasher)
 
-		f, err := w.Create(path.Join(backupDBDir, table+".bson"))
+	var count int64
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := h.db.ScanRows(rows, &row); err != nil {
+			return count, "", err
+		}
+		doc, err := encodeBSONRow(row)
 		if err != nil {
-			continue
+			return count, "", err
 		}
-		if len(payload) > 0 {
-			if _, err := f.Write(payload); err != nil {
-				continue
-			}
+		if _, err := entry.Write(doc); err != nil {
+			return count, "", err
 		}
-
-		exportedTables = append(exportedTables, table)
+		count++
 	}
-
-	manifest := backupManifest{
-		Format:    backupFormat,
-		Version:   backupFormatVersion,
-		Engine:    "mysql",
-		CreatedAt: time.Now().UTC(),
-		Tables:    exportedTables,
+	if err := rows.Err(); err != nil {
+		return count, "", err
 	}
-	if manifestData, err := json.Marshal(manifest); err == nil {
-		if mf, err := w.Create(backupManifestFile); err == nil {
-			_, _ = mf.Write(manifestData)
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return count, "", err
 		}
 	}
+	return count, hex.EncodeToString(hasher.Sum(nil)), nil
+}
 
-	if err := w.Close(); err != nil {
-		return nil, err
+// archiveChecksum hashes the table list and per-table checksums in manifest
+// order, so a manifest edited or cut short no longer matches.
+func archiveChecksum(manifest *backupManifest) string {
+	hasher := sha256.New()
+	for _, table := range manifest.Tables {
+		fmt.Fprintf(hasher, "%s:%s\n", table, manifest.Checksums[table])
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressTables reports whether BackupOptions asks for gzipped table entries.
+func (h *Handler) compressTables() bool {
+	if h.cfgSvc == nil {
+		return false
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return false
 	}
-	return buf, nil
+	return cfg.BackupOptions.Compress
 }
 
 // CreateLocalBackup creates a backup ZIP in the default backup directory.
 func CreateLocalBackup(db *gorm.DB) error {
 	h := &Handler{db: db}
-	_, err := h.createLocalBackupArtifact(time.Now())
+	_, err := h.createLocalBackupArtifact(time.Now(), "", nil)
 	return err
 }
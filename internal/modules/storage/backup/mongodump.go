@@ -0,0 +1,132 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	// archiveMaxBytes caps the unpacked size of a tar or tar.gz upload, so a
+	// small compressed file cannot expand without bound in memory.
+	archiveMaxBytes = 1 << 30
+	// archiveMaxEntries caps the number of tar entries read.
+	archiveMaxEntries = 10000
+)
+
+var (
+	errArchiveTooLarge       = fmt.Errorf("archive expands beyond %d MB", archiveMaxBytes>>20)
+	errArchiveTooManyEntries = fmt.Errorf("archive has more than %d entries", archiveMaxEntries)
+)
+
+// mongodumpDatabaseDir detects a mongodump layout (dump/<db>/<collection>.bson with
+// .metadata.json sidecars) and returns the directory of the database to restore.
+// When the dump holds several databases (e.g. admin next to mx-space) the one
+// with the most known collections wins.
+func mongodumpDatabaseDir(zr *zip.Reader) (string, bool) {
+	sidecars := make(map[string]bool)
+	known := make(map[string]int)
+	for _, file := range zr.File {
+		name := strings.ToLower(file.Name)
+		dir := path.Dir(file.Name)
+		switch {
+		case strings.HasSuffix(name, ".metadata.json"), strings.HasSuffix(name, ".metadata.json.gz"):
+			sidecars[dir] = true
+		case strings.HasSuffix(name, ".bson"), strings.HasSuffix(name, ".bson.gz"):
+			if table, _, ok := parseBackupEntry(file.Name); ok && resolveRestoreTableName(table) != "" {
+				known[dir]++
+			}
+		}
+	}
+
+	best, bestCount := "", 0
+	for dir, count := range known {
+		if !sidecars[dir] {
+			continue
+		}
+		if count > bestCount || (count == bestCount && dir < best) {
+			best, bestCount = dir, count
+		}
+	}
+	return best, bestCount > 0
+}
+
+// archiveToZip repacks a tar or tar.gz upload (how mongodump output is usually
+// shipped) into an in-memory ZIP so the restore path only deals with one format.
+// Data that is not a tarball is returned unchanged. It aborts once the
+// unpacked data passes archiveMaxBytes or the tar holds more than
+// archiveMaxEntries entries.
+func archiveToZip(data []byte) ([]byte, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		plain, err := io.ReadAll(io.LimitReader(gz, archiveMaxBytes+1))
+		_ = gz.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(plain) > archiveMaxBytes {
+			return nil, errArchiveTooLarge
+		}
+		data = plain
+	}
+	if !isTarball(data) {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	tr := tar.NewReader(bytes.NewReader(data))
+	var entries, total int64
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entries++; entries > archiveMaxEntries {
+			return nil, errArchiveTooManyEntries
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Already-compressed entries are stored as is.
+		method := zip.Deflate
+		if strings.HasSuffix(hdr.Name, ".gz") {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     strings.TrimPrefix(path.Clean("/"+hdr.Name), "/"),
+			Method:   method,
+			Modified: hdr.ModTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+		n, err := io.Copy(w, io.LimitReader(tr, archiveMaxBytes-total+1))
+		if err != nil {
+			return nil, err
+		}
+		if total += n; total > archiveMaxBytes {
+			return nil, errArchiveTooLarge
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isTarball(data []byte) bool {
+	return len(data) > 262 && string(data[257:262]) == "ustar"
+}
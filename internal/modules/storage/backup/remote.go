@@ -0,0 +1,182 @@
+package backup
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/response"
+)
+
+// remoteBackupItem is a backup object in the configured S3 bucket. ID is the
+// URL-safe base64 of Key, used as :key in the remote routes because object
+// keys contain slashes.
+type remoteBackupItem struct {
+	ID           string    `json:"id"`
+	Key          string    `json:"key"`
+	Filename     string    `json:"filename"`
+	Size         string    `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	URL          string    `json:"url"`
+}
+
+// backupObjectPrefix returns the static part of the path template before its
+// first placeholder, cut back to a directory boundary.
+func backupObjectPrefix(template string) string {
+	tpl := strings.TrimSpace(template)
+	if tpl == "" {
+		tpl = defaultS3PathTemplate
+	}
+	if idx := strings.Index(tpl, "{"); idx >= 0 {
+		tpl = tpl[:idx]
+	}
+	tpl = normalizeObjectKey(tpl)
+	if idx := strings.LastIndex(tpl, "/"); idx >= 0 {
+		return tpl[:idx+1]
+	}
+	return ""
+}
+
+// remoteBackupKey resolves the :key param to an object key under the backup prefix.
+// Plain keys without slashes are accepted as well as base64 IDs.
+func remoteBackupKey(param, prefix string) (string, bool) {
+	key := param
+	if decoded, err := base64.RawURLEncoding.DecodeString(param); err == nil {
+		key = string(decoded)
+	}
+	key = normalizeObjectKey(key)
+	if key == "" || !strings.HasPrefix(key, prefix) || strings.Contains(key, "..") {
+		return "", false
+	}
+	return key, isBackupFilename(path.Base(key))
+}
+
+// remoteUploader builds the S3 client from the current options. It writes a
+// response and reports false when S3 is not usable.
+func (h *Handler) remoteUploader(c *gin.Context) (*s3Uploader, string, bool) {
+	if h.cfgSvc == nil {
+		response.InternalError(c, fmt.Errorf("config service is unavailable"))
+		return nil, "", false
+	}
+	cfg, err := h.cfgSvc.Get()
+	if err != nil {
+		response.InternalError(c, err)
+		return nil, "", false
+	}
+	if cfg == nil {
+		response.InternalError(c, fmt.Errorf("configs not initialized"))
+		return nil, "", false
+	}
+	uploader, err := newS3Uploader(cfg.S3Options)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return nil, "", false
+	}
+	return uploader, backupObjectPrefix(cfg.BackupOptions.Path), true
+}
+
+// GET /backups/remote
+func (h *Handler) listRemote(c *gin.Context) {
+	uploader, prefix, ok := h.remoteUploader(c)
+	if !ok {
+		return
+	}
+	objects, err := uploader.List(c.Request.Context(), prefix)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	items := make([]remoteBackupItem, 0, len(objects))
+	for _, obj := range objects {
+		filename := path.Base(obj.Key)
+		if !isBackupFilename(filename) {
+			continue
+		}
+		items = append(items, remoteBackupItem{
+			ID:           base64.RawURLEncoding.EncodeToString([]byte(obj.Key)),
+			Key:          obj.Key,
+			Filename:     filename,
+			Size:         formatSize(obj.Size),
+			LastModified: obj.LastModified,
+			URL:          uploader.publicURL(obj.Key),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].LastModified.After(items[j].LastModified) })
+	response.OK(c, items)
+}
+
+// GET /backups/remote/:key/download
+func (h *Handler) downloadRemote(c *gin.Context) {
+	uploader, prefix, ok := h.remoteUploader(c)
+	if !ok {
+		return
+	}
+	key, ok := remoteBackupKey(c.Param("key"), prefix)
+	if !ok {
+		response.BadRequest(c, "invalid backup key")
+		return
+	}
+	body, size, err := uploader.Open(c.Request.Context(), key)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	defer body.Close()
+
+	filename := path.Base(key)
+	c.DataFromReader(http.StatusOK, size, backupContentType(filename), body, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, filename),
+	})
+}
+
+// POST /backups/remote/:key/restore
+func (h *Handler) restoreRemote(c *gin.Context) {
+	uploader, prefix, ok := h.remoteUploader(c)
+	if !ok {
+		return
+	}
+	key, ok := remoteBackupKey(c.Param("key"), prefix)
+	if !ok {
+		response.BadRequest(c, "invalid backup key")
+		return
+	}
+	opts, ok := restoreOptionsFromRequest(c)
+	if !ok {
+		return
+	}
+
+	body, _, err := uploader.Open(c.Request.Context(), key)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	data, err := io.ReadAll(body)
+	_ = body.Close()
+	if err != nil {
+		response.BadRequest(c, fmt.Sprintf("s3 download failed: %s", err.Error()))
+		return
+	}
+	zr, ok := h.openBackupArchive(c, data)
+	if !ok {
+		return
+	}
+
+	if opts.DryRun {
+		report, err := RestoreFromZipWithOptions(h.db, zr, opts)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		response.OK(c, report)
+		return
+	}
+	h.logger.Info(fmt.Sprintf("从 S3 回滚备份：%s", key))
+	h.acceptRestoreJob(c, "s3://"+uploader.bucket+"/"+key, zr, opts)
+}
@@ -3,46 +3,79 @@ package backup
 import (
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/pkg/dialect"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"gorm.io/gorm"
 )
 
+// restoreProgressEvery is how many inserted rows pass between progress callbacks.
+const restoreProgressEvery = 500
+
 // RestoreFromZip imports table dumps from a backup ZIP.
 func RestoreFromZip(db *gorm.DB, zr *zip.Reader) error {
+	_, err := RestoreFromZipWithOptions(db, zr, RestoreOptions{})
+	return err
+}
+
+// RestoreFromZipWithOptions imports the selected table dumps from a backup ZIP.
+// In dry-run mode the archive is decoded and normalized against the live schema,
+// but nothing is deleted or inserted.
+func RestoreFromZipWithOptions(db *gorm.DB, zr *zip.Reader, opts RestoreOptions) (*RestoreReport, error) {
 	if db == nil || zr == nil {
-		return fmt.Errorf("invalid restore input")
+		return nil, fmt.Errorf("invalid restore input")
+	}
+	selected, err := resolveRestoreTables(opts.Tables)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := readBackupManifest(zr)
+	if err != nil {
+		return nil, err
+	}
+	tableEntries := collectBackupEntries(zr, selected)
+	// Fail before touching the database rather than on a half-decoded table.
+	if err := verifyBackupChecksums(manifest, selected, tableEntries); err != nil {
+		return nil, err
+	}
+	report := &RestoreReport{
+		DryRun:        opts.DryRun,
+		EngineWarning: backupEngineWarning(db, manifest),
+		Tables:        make([]TableRestoreReport, 0, len(tableEntries)),
 	}
 
-	tableEntries := make(map[string]backupEntryCandidate)
-	for _, file := range zr.File {
-		table, format, ok := parseBackupEntry(file.Name)
-		if !ok {
-			continue
-		}
-
-		table = resolveRestoreTableName(table)
-		if table == "" {
-			continue
-		}
-
-		exist, has := tableEntries[table]
-		if !has || (exist.Format != "bson" && format == "bson") {
-			tableEntries[table] = backupEntryCandidate{File: file, Format: format}
+	if opts.DryRun {
+		for _, table := range backupTableNames {
+			entry, ok := tableEntries[table]
+			if !ok {
+				continue
+			}
+			_, tableReport, err := prepareRestoreTable(db, table, entry)
+			if err != nil {
+				return nil, err
+			}
+			report.Tables = append(report.Tables, tableReport)
 		}
+		return report, nil
 	}
 
 	tx := db.Begin()
 	if tx.Error != nil {
-		return tx.Error
+		return nil, tx.Error
 	}
 	shouldRollback := true
 	defer func() {
@@ -51,89 +84,377 @@ func RestoreFromZip(db *gorm.DB, zr *zip.Reader) error {
 		}
 	}()
 
-	fkCheckDisabled := false
-	if strings.EqualFold(tx.Dialector.Name(), "mysql") {
-		if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
-			return err
+	enableForeignKeys, err := dialect.DisableForeignKeys(tx)
+	if err != nil {
+		return nil, err
+	}
+	fkCheckDisabled := true
+	defer func() {
+		if fkCheckDisabled {
+			_ = enableForeignKeys()
 		}
-		fkCheckDisabled = true
-		defer func() {
-			if fkCheckDisabled {
-				_ = tx.Exec("SET FOREIGN_KEY_CHECKS = 1").Error
-			}
-		}()
+	}()
+
+	progress := RestoreProgress{TablesTotal: len(tableEntries)}
+	notify := func() {
+		if opts.Progress == nil {
+			return
+		}
+		// A finished table is already counted in TablesDone.
+		fraction := 0.0
+		if progress.RowsDone < progress.RowsTotal {
+			fraction = float64(progress.RowsDone) / float64(progress.RowsTotal)
+		}
+		if progress.TablesTotal > 0 {
+			progress.Percent = math.Round((float64(progress.TablesDone)+fraction)/float64(progress.TablesTotal)*10000) / 100
+		}
+		opts.Progress(progress)
 	}
 
-	columnCache := make(map[string]map[string]tableColumn, len(tableEntries))
+	// PostgreSQL aborts the whole transaction on any failed statement, so a
+	// skipped duplicate must be rolled back to a savepoint to go on.
+	useSavepoints := dialect.Name(tx) == dialect.Postgres
+
 	for _, table := range backupTableNames {
 		entry, ok := tableEntries[table]
 		if !ok {
 			continue
 		}
-		rows, err := decodeBackupRows(entry.File, entry.Format)
+		rows, tableReport, err := prepareRestoreTable(tx, table, entry)
 		if err != nil {
-			return fmt.Errorf("decode backup rows for table %s failed: %w", table, err)
+			return nil, err
 		}
+		// Real inserts decide duplicates; drop the dry-run estimate.
+		tableReport.RowsToInsert = 0
+		tableReport.RowsSkipped -= tableReport.SkipReasons[skipReasonDuplicateKey]
+		delete(tableReport.SkipReasons, skipReasonDuplicateKey)
 
-		columns, hasColumns := columnCache[table]
-		if !hasColumns {
-			columns, err = loadTableColumns(tx, table)
-			if err != nil {
-				return fmt.Errorf("load table columns for %s failed: %w", table, err)
+		progress.Table, progress.RowsDone, progress.RowsTotal = table, 0, len(rows)
+		notify()
+		if err := tx.Exec("DELETE FROM " + dialect.Quote(tx, table)).Error; err != nil {
+			return nil, err
+		}
+		for idx, row := range rows {
+			progress.RowsDone = idx + 1
+			if progress.RowsDone%restoreProgressEvery == 0 && progress.RowsDone < len(rows) {
+				notify()
+			}
+			if err := insertRestoreRow(tx, table, row, useSavepoints); err != nil {
+				if dialect.IsDuplicateKeyError(err) {
+					tableReport.skip(skipReasonDuplicateKey)
+					continue
+				}
+				return nil, fmt.Errorf("insert row #%d into %s failed: %w", idx+1, table, err)
 			}
-			columnCache[table] = columns
+			tableReport.RowsToInsert++
+			progress.RowsInserted++
+		}
+		report.Tables = append(report.Tables, tableReport)
+		progress.TablesDone++
+		progress.RowsDone = len(rows)
+		notify()
+	}
+
+	fkCheckDisabled = false
+	if err := enableForeignKeys(); err != nil {
+		return nil, err
+	}
+	// Both steps rewrite rows of the options table.
+	if selected == nil || selected["options"] {
+		if err := migrateLegacyOptions(tx); err != nil {
+			return nil, err
+		}
+		if err := importLegacyEmailTemplates(tx, zr); err != nil {
+			return nil, err
 		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	shouldRollback = false
+	return report, nil
+}
+
+const restoreSavepoint = "restore_row"
 
-		normalizedRows := make([]map[string]interface{}, 0, len(rows))
-		for _, row := range rows {
-			normalized := normalizeRestoreRow(table, row, columns)
-			if len(normalized) == 0 {
+// insertRestoreRow inserts row into table. With useSavepoints a failed insert
+// is rolled back on its own, leaving tx usable.
+func insertRestoreRow(tx *gorm.DB, table string, row map[string]interface{}, useSavepoints bool) error {
+	if !useSavepoints {
+		return tx.Table(table).Create(row).Error
+	}
+	if err := tx.SavePoint(restoreSavepoint).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(table).Create(row).Error; err != nil {
+		if rbErr := tx.RollbackTo(restoreSavepoint).Error; rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	return tx.Exec("RELEASE SAVEPOINT " + restoreSavepoint).Error
+}
+
+// ValidateBackupZip previews a restore of every table against the live schema
+// without writing. Unlike a dry run it keeps going past tables that fail to decode
+// and records the error on that table instead.
+func ValidateBackupZip(db *gorm.DB, zr *zip.Reader) (*RestoreReport, error) {
+	if db == nil || zr == nil {
+		return nil, fmt.Errorf("invalid restore input")
+	}
+	manifest, err := readBackupManifest(zr)
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil && manifest.ArchiveSHA256 != "" && archiveChecksum(manifest) != manifest.ArchiveSHA256 {
+		return nil, errBackupManifestChecksum
+	}
+	tableEntries := collectBackupEntries(zr, nil)
+	report := &RestoreReport{
+		DryRun:        true,
+		EngineWarning: backupEngineWarning(db, manifest),
+		Tables:        make([]TableRestoreReport, 0, len(tableEntries)),
+	}
+	for _, table := range backupTableNames {
+		entry, ok := tableEntries[table]
+		if !ok {
+			continue
+		}
+		if manifest != nil && manifest.Checksums[table] != "" {
+			if err := verifyTableChecksum(table, entry, manifest.Checksums[table]); err != nil {
+				report.Tables = append(report.Tables, TableRestoreReport{Table: table, Error: err.Error()})
 				continue
 			}
-			normalizedRows = append(normalizedRows, normalized)
 		}
+		_, tableReport, err := prepareRestoreTable(db, table, entry)
+		if err != nil {
+			tableReport.Error = err.Error()
+		}
+		report.Tables = append(report.Tables, tableReport)
+	}
+	return report, nil
+}
 
-		if err := tx.Exec("DELETE FROM `" + table + "`").Error; err != nil {
-			return err
+var errBackupManifestChecksum = errors.New("backup manifest checksum mismatch, the archive is corrupted")
+
+// readBackupManifest returns nil without error for archives that carry no
+// manifest, such as legacy or mongodump backups.
+func readBackupManifest(zr *zip.Reader) (*backupManifest, error) {
+	for _, file := range zr.File {
+		if file.Name != backupManifestFile {
+			continue
 		}
-		for idx, row := range normalizedRows {
-			if err := tx.Table(table).Create(row).Error; err != nil {
-				if isDuplicateConstraintError(err) {
-					continue
-				}
-				return fmt.Errorf("insert row #%d into %s failed: %w", idx+1, table, err)
-			}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("open backup manifest: %w", err)
 		}
+		defer rc.Close()
+		var manifest backupManifest
+		if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("decode backup manifest: %w", err)
+		}
+		return &manifest, nil
+	}
+	return nil, nil
+}
+
+// backupEngineWarning describes an archive taken from another database engine.
+// Its rows are still normalized against the live schema, so the restore goes on
+// and the mismatch is only reported. Archives without a manifest, and version 1
+// manifests whose engine was always "mysql", yield no warning.
+func backupEngineWarning(db *gorm.DB, manifest *backupManifest) string {
+	if manifest == nil || manifest.Version < 2 {
+		return ""
+	}
+	engine := strings.ToLower(strings.TrimSpace(manifest.Engine))
+	if current := dialect.Name(db); engine != current {
+		return fmt.Sprintf("backup was taken from %s but the database is %s", manifest.Engine, current)
 	}
+	return ""
+}
 
-	if fkCheckDisabled {
-		if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 1").Error; err != nil {
+// verifyBackupChecksums checks the selected tables against the manifest checksums.
+// Archives written before checksums were recorded pass unchecked.
+func verifyBackupChecksums(manifest *backupManifest, selected map[string]bool, entries map[string]backupEntryCandidate) error {
+	if manifest == nil || len(manifest.Checksums) == 0 {
+		return nil
+	}
+	if manifest.ArchiveSHA256 != "" && archiveChecksum(manifest) != manifest.ArchiveSHA256 {
+		return errBackupManifestChecksum
+	}
+	for _, table := range manifest.Tables {
+		want := manifest.Checksums[table]
+		if want == "" || (selected != nil && !selected[table]) {
+			continue
+		}
+		entry, ok := entries[table]
+		if !ok {
+			return fmt.Errorf("table %s listed in the backup manifest is missing, the archive is truncated", table)
+		}
+		if err := verifyTableChecksum(table, entry, want); err != nil {
 			return err
 		}
-		fkCheckDisabled = false
 	}
-	if err := migrateLegacyOptions(tx); err != nil {
-		return err
+	return nil
+}
+
+func verifyTableChecksum(table string, entry backupEntryCandidate, want string) error {
+	if !isBSONFormat(entry.Format) {
+		return fmt.Errorf("table %s: expected a BSON entry, got %s", table, entry.Format)
 	}
-	if err := importLegacyEmailTemplates(tx, zr); err != nil {
-		return err
+	rc, err := entry.File.Open()
+	if err != nil {
+		return fmt.Errorf("open backup entry for table %s: %w", table, err)
 	}
-	if err := tx.Commit().Error; err != nil {
-		return err
+	defer rc.Close()
+
+	var reader io.Reader = rc
+	if strings.HasSuffix(entry.Format, ".gz") {
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return fmt.Errorf("table %s is corrupted: %w", table, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return fmt.Errorf("table %s is corrupted: %w", table, err)
+	}
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for table %s, the archive is corrupted or truncated", table)
 	}
-	shouldRollback = false
 	return nil
 }
 
+// resolveRestoreTables validates requested table names (aliases allowed).
+// A nil result means every table.
+func resolveRestoreTables(names []string) (map[string]bool, error) {
+	var selected map[string]bool
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		table := resolveRestoreTableName(name)
+		if table == "" {
+			return nil, fmt.Errorf("unknown table: %s", name)
+		}
+		if selected == nil {
+			selected = make(map[string]bool)
+		}
+		selected[table] = true
+	}
+	return selected, nil
+}
+
+// collectBackupEntries picks one entry per known table, preferring BSON over JSON.
+// For mongodump archives only the detected database directory is considered.
+func collectBackupEntries(zr *zip.Reader, selected map[string]bool) map[string]backupEntryCandidate {
+	dumpDir, isMongodump := mongodumpDatabaseDir(zr)
+	tableEntries := make(map[string]backupEntryCandidate)
+	for _, file := range zr.File {
+		if isMongodump && path.Dir(file.Name) != dumpDir {
+			continue
+		}
+		table, format, ok := parseBackupEntry(file.Name)
+		if !ok {
+			continue
+		}
+
+		table = resolveRestoreTableName(table)
+		if table == "" || (selected != nil && !selected[table]) {
+			continue
+		}
+
+		exist, has := tableEntries[table]
+		if !has || (!isBSONFormat(exist.Format) && isBSONFormat(format)) {
+			tableEntries[table] = backupEntryCandidate{File: file, Format: format}
+		}
+	}
+	return tableEntries
+}
+
+// prepareRestoreTable decodes and normalizes one table's rows without writing.
+func prepareRestoreTable(db *gorm.DB, table string, entry backupEntryCandidate) ([]map[string]interface{}, TableRestoreReport, error) {
+	report := TableRestoreReport{Table: table}
+	rows, err := decodeBackupRows(entry.File, entry.Format)
+	if err != nil {
+		return nil, report, fmt.Errorf("decode backup rows for table %s failed: %w", table, err)
+	}
+	columns, err := loadTableColumns(db, table)
+	if err != nil {
+		return nil, report, fmt.Errorf("load table columns for %s failed: %w", table, err)
+	}
+
+	report.RowsFound = len(rows)
+	normalizedRows := make([]map[string]interface{}, 0, len(rows))
+	seenIDs := make(map[string]struct{}, len(rows))
+	dropped := make(map[string]struct{})
+	for _, row := range rows {
+		collectDroppedColumns(table, row, columns, dropped)
+		normalized := normalizeRestoreRow(table, row, columns)
+		if len(normalized) == 0 {
+			report.skip(skipReasonNoColumns)
+			continue
+		}
+		normalizedRows = append(normalizedRows, normalized)
+		if id, ok := normalized["id"]; ok && id != nil {
+			key := fmt.Sprint(id)
+			if _, dup := seenIDs[key]; dup {
+				report.skip(skipReasonDuplicateKey)
+				continue
+			}
+			seenIDs[key] = struct{}{}
+		}
+		report.RowsToInsert++
+	}
+	report.DroppedColumns = sortedKeys(dropped)
+	return normalizedRows, report, nil
+}
+
+// collectDroppedColumns records archive fields that map to no column in the live schema.
+func collectDroppedColumns(table string, row map[string]interface{}, columns map[string]tableColumn, dropped map[string]struct{}) {
+	for key := range row {
+		column := normalizeRestoreColumnName(table, key)
+		if column == "" || column == "count" {
+			continue
+		}
+		if _, ok := columns[column]; !ok {
+			dropped[key] = struct{}{}
+		}
+	}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func parseBackupEntry(name string) (table string, format string, ok bool) {
 	base := strings.ToLower(strings.TrimSpace(path.Base(name)))
 	if base == "" {
 		return "", "", false
 	}
-	if base == "prelude.json" || base == "manifest.json" || strings.HasSuffix(base, ".metadata.json") {
+	if base == "prelude.json" || base == "manifest.json" || strings.HasSuffix(base, ".metadata.json") ||
+		strings.HasPrefix(base, "system.") {
 		return "", "", false
 	}
 
+	if strings.HasSuffix(base, ".bson.gz") {
+		table = strings.TrimSuffix(base, ".bson.gz")
+		if table == "" {
+			return "", "", false
+		}
+		return table, "bson.gz", true
+	}
 	if strings.HasSuffix(base, ".bson") {
 		table = strings.TrimSuffix(base, ".bson")
 		if table == "" {
@@ -172,7 +493,18 @@ func decodeBackupRows(file *zip.File, format string) ([]map[string]interface{},
 	}
 	defer rc.Close()
 
-	data, err := io.ReadAll(rc)
+	var reader io.Reader = rc
+	if strings.HasSuffix(format, ".gz") {
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip entry %s: %w", file.Name, err)
+		}
+		defer gz.Close()
+		reader = gz
+		format = strings.TrimSuffix(format, ".gz")
+	}
+
+	data, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, err
 	}
@@ -194,6 +526,10 @@ func decodeBackupRows(file *zip.File, format string) ([]map[string]interface{},
 	}
 }
 
+func isBSONFormat(format string) bool {
+	return format == "bson" || format == "bson.gz"
+}
+
 func loadTableColumns(db *gorm.DB, table string) (map[string]tableColumn, error) {
 	columnTypes, err := db.Migrator().ColumnTypes(table)
 	if err != nil {
@@ -478,7 +814,7 @@ func migrateLegacyOptions(tx *gorm.DB) error {
 		return err
 	}
 
-	if err := tx.Exec("DELETE FROM `options` WHERE `name` = ?", "configs").Error; err != nil {
+	if err := tx.Exec("DELETE FROM "+dialect.Quote(tx, "options")+" WHERE "+dialect.Quote(tx, "name")+" = ?", "configs").Error; err != nil {
 		return err
 	}
 	return tx.Table("options").Create(map[string]interface{}{
@@ -580,7 +916,7 @@ func importLegacyEmailTemplates(tx *gorm.DB, zr *zip.Reader) error {
 			continue
 		}
 
-		if err := tx.Exec("DELETE FROM `options` WHERE `name` = ?", optionName).Error; err != nil {
+		if err := tx.Exec("DELETE FROM "+dialect.Quote(tx, "options")+" WHERE "+dialect.Quote(tx, "name")+" = ?", optionName).Error; err != nil {
 			return err
 		}
 		if err := tx.Table("options").Create(map[string]interface{}{
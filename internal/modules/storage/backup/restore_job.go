@@ -0,0 +1,263 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	restoreProgressEvent      = "backup#restore-progress"
+	redisRestoreLockKey       = "mx:backup:restore:lock"
+	redisRestoreJobKeyPrefix  = "mx:backup:restore:job:"
+	restoreLockTTL            = 2 * time.Hour
+	restoreJobTTL             = 24 * time.Hour
+	restoreProgressMinPeriod  = 500 * time.Millisecond
+	restoreJobStatusRunning   = "running"
+	restoreJobStatusSucceeded = "succeeded"
+	restoreJobStatusFailed    = "failed"
+)
+
+var errRestoreRunning = errors.New("restore is already running")
+
+// restoreJob is the state of a background restore, shared through Redis so any
+// worker can answer GET /backups/restore/:jobId.
+type restoreJob struct {
+	ID         string          `json:"id"`
+	Source     string          `json:"source"`
+	Status     string          `json:"status"`
+	Progress   RestoreProgress `json:"progress"`
+	Report     *RestoreReport  `json:"report,omitempty"`
+	Warnings   []string        `json:"warnings,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+
+	// done is closed when the job finishes; only set on the worker running it.
+	done chan struct{}
+}
+
+// restoreJobs tracks restore jobs started by this process and allows only one at a time.
+type restoreJobs struct {
+	mu     sync.Mutex
+	active string
+	jobs   map[string]*restoreJob
+}
+
+func newRestoreJobs() *restoreJobs {
+	return &restoreJobs{jobs: make(map[string]*restoreJob)}
+}
+
+// startRestoreJob runs the restore in the background and returns the new job,
+// or errRestoreRunning when another restore is in progress on any worker.
+func (h *Handler) startRestoreJob(ctx context.Context, source string, zr *zip.Reader, opts RestoreOptions) (*restoreJob, error) {
+	jobs := h.jobs
+	jobs.mu.Lock()
+	if jobs.active != "" {
+		jobs.mu.Unlock()
+		return nil, errRestoreRunning
+	}
+	job := &restoreJob{
+		ID:        uuid.NewString(),
+		Source:    source,
+		Status:    restoreJobStatusRunning,
+		StartedAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+	if rc := h.rc; rc != nil {
+		lockCtx, cancel := context.WithTimeout(ctx, backupStatusTimeout)
+		ok, err := rc.Raw().SetNX(lockCtx, redisRestoreLockKey, job.ID, restoreLockTTL).Result()
+		cancel()
+		if err == nil && !ok {
+			jobs.mu.Unlock()
+			return nil, errRestoreRunning
+		}
+	}
+	for id, old := range jobs.jobs {
+		if old.FinishedAt != nil && time.Since(*old.FinishedAt) > restoreJobTTL {
+			delete(jobs.jobs, id)
+		}
+	}
+	jobs.active = job.ID
+	jobs.jobs[job.ID] = job
+	snapshot := *job
+	jobs.mu.Unlock()
+
+	// The request context ends with the 202 response; the restore must outlive it.
+	runCtx := context.WithoutCancel(ctx)
+	h.saveRestoreJob(runCtx, &snapshot)
+	go h.runRestoreJob(runCtx, job.ID, zr, opts)
+	return &snapshot, nil
+}
+
+func (h *Handler) runRestoreJob(ctx context.Context, id string, zr *zip.Reader, opts RestoreOptions) {
+	var (
+		lastSent time.Time
+		lastStep string
+	)
+	callerProgress := opts.Progress
+	opts.Progress = func(p RestoreProgress) {
+		if callerProgress != nil {
+			callerProgress(p)
+		}
+		job := h.updateRestoreJob(id, func(j *restoreJob) { j.Progress = p })
+		// Rows arrive much faster than clients need them; table boundaries always go out.
+		step := fmt.Sprintf("%s/%d", p.Table, p.TablesDone)
+		if step == lastStep && time.Since(lastSent) < restoreProgressMinPeriod {
+			return
+		}
+		lastSent, lastStep = time.Now(), step
+		h.saveRestoreJob(ctx, job)
+		h.broadcastRestoreJob(job)
+	}
+
+	h.logger.Info("数据恢复任务开始", zap.String("job_id", id))
+	report, err := RestoreFromZipWithOptions(h.db, zr, opts)
+	var reindexWarning string
+	if err == nil {
+		h.invalidateRuntimeCaches(ctx)
+		if opts.Reindex && h.reindex != nil {
+			reindexWarning = h.reindexAfterRestore(id)
+		}
+	}
+
+	finishedAt := time.Now()
+	job := h.updateRestoreJob(id, func(j *restoreJob) {
+		j.FinishedAt = &finishedAt
+		if err != nil {
+			j.Status = restoreJobStatusFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = restoreJobStatusSucceeded
+		j.Report = report
+		j.Warnings = restoreReportWarnings(report)
+		if reindexWarning != "" {
+			j.Warnings = append(j.Warnings, reindexWarning)
+		}
+		j.Progress.Percent = 100
+	})
+	if err != nil {
+		h.logger.Warn("数据恢复任务失败", zap.String("job_id", id), zap.Error(err))
+	} else {
+		if report.EngineWarning != "" {
+			h.logger.Warn("备份来自其他数据库引擎", zap.String("job_id", id), zap.String("warning", report.EngineWarning))
+		}
+		h.logger.Info("数据恢复任务完成", zap.String("job_id", id))
+	}
+
+	h.saveRestoreJob(ctx, job)
+	h.broadcastRestoreJob(job)
+
+	h.jobs.mu.Lock()
+	h.jobs.active = ""
+	h.jobs.mu.Unlock()
+	if job.done != nil {
+		close(job.done)
+	}
+	if rc := h.rc; rc != nil {
+		lockCtx, cancel := context.WithTimeout(ctx, backupStatusTimeout)
+		_ = rc.Del(lockCtx, redisRestoreLockKey)
+		cancel()
+	}
+}
+
+// reindexAfterRestore rebuilds the search index so restored content is
+// searchable. A failure does not fail the restore; it is returned as a
+// warning for the job instead.
+func (h *Handler) reindexAfterRestore(id string) string {
+	count, err := h.reindex()
+	if err != nil {
+		h.logger.Warn("恢复后重建搜索索引失败", zap.String("job_id", id), zap.Error(err))
+		return "搜索索引重建失败：" + err.Error()
+	}
+	h.logger.Info("恢复后已重建搜索索引", zap.String("job_id", id), zap.Int("documents", count))
+	return ""
+}
+
+// updateRestoreJob applies fn under lock and returns a copy of the job.
+func (h *Handler) updateRestoreJob(id string, fn func(*restoreJob)) *restoreJob {
+	h.jobs.mu.Lock()
+	defer h.jobs.mu.Unlock()
+	job, ok := h.jobs.jobs[id]
+	if !ok {
+		return &restoreJob{ID: id}
+	}
+	fn(job)
+	snapshot := *job
+	return &snapshot
+}
+
+// restoreJob looks the job up locally first, then in Redis for jobs started by another worker.
+func (h *Handler) restoreJob(ctx context.Context, id string) (*restoreJob, bool) {
+	h.jobs.mu.Lock()
+	if job, ok := h.jobs.jobs[id]; ok {
+		snapshot := *job
+		h.jobs.mu.Unlock()
+		return &snapshot, true
+	}
+	h.jobs.mu.Unlock()
+
+	rc := h.rc
+	if rc == nil {
+		return nil, false
+	}
+	readCtx, cancel := context.WithTimeout(ctx, backupStatusTimeout)
+	defer cancel()
+	raw, err := rc.Get(readCtx, redisRestoreJobKeyPrefix+id)
+	if err != nil || raw == "" {
+		return nil, false
+	}
+	var job restoreJob
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		return nil, false
+	}
+	return &job, true
+}
+
+func (h *Handler) saveRestoreJob(ctx context.Context, job *restoreJob) {
+	rc := h.rc
+	if rc == nil {
+		return
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	saveCtx, cancel := context.WithTimeout(ctx, backupStatusTimeout)
+	defer cancel()
+	if err := rc.Set(saveCtx, redisRestoreJobKeyPrefix+job.ID, data, restoreJobTTL); err != nil {
+		h.logger.Warn("保存恢复任务状态失败", zap.Error(err))
+	}
+}
+
+func (h *Handler) broadcastRestoreJob(job *restoreJob) {
+	if h.hub == nil {
+		return
+	}
+	h.hub.BroadcastAdmin(restoreProgressEvent, job)
+}
+
+// restoreReportWarnings lists tables whose rows were skipped as duplicates.
+func restoreReportWarnings(report *RestoreReport) []string {
+	if report == nil {
+		return nil
+	}
+	var warnings []string
+	if report.EngineWarning != "" {
+		warnings = append(warnings, report.EngineWarning)
+	}
+	for _, table := range report.Tables {
+		if n := table.SkipReasons[skipReasonDuplicateKey]; n > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped %d duplicate rows", table.Table, n))
+		}
+	}
+	return warnings
+}
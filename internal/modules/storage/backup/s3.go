@@ -3,24 +3,49 @@ package backup
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	appcfg "github.com/mx-space/core/internal/config"
 )
 
+const (
+	// Objects larger than s3MultipartThreshold are uploaded in parts of at
+	// least s3MultipartPartSize, so no single request carries more than a
+	// part and a failed part is retried alone.
+	s3MultipartThreshold = 16 << 20
+	s3MultipartPartSize  = 16 << 20
+	s3MaxParts           = 10000
+
+	// Transient S3 errors are retried up to s3MaxAttempts times in all,
+	// waiting s3RetryBaseDelay before the first retry and doubling it after.
+	s3MaxAttempts    = 4
+	s3RetryBaseDelay = time.Second
+	s3AbortTimeout   = 30 * time.Second
+)
+
 type s3Uploader struct {
 	endpoint     *url.URL
 	bucket       string
 	region       string
 	customDomain string
 	pathStyle    bool
+	storageClass types.StorageClass
+	sse          types.ServerSideEncryption
+	sseKMSKeyID  string
 	client       *s3.Client
 }
 
@@ -34,6 +59,19 @@ func NewS3Uploader(opts appcfg.S3Options) (S3Uploader, error) {
 	return newS3Uploader(opts)
 }
 
+// S3Configured reports whether opts has enough settings to build an uploader.
+func S3Configured(opts appcfg.S3Options) bool {
+	return s3Configured(opts)
+}
+
+// s3Configured reports whether the S3 options carry the fields newS3Uploader requires.
+func s3Configured(opts appcfg.S3Options) bool {
+	return strings.TrimSpace(opts.Bucket) != "" &&
+		strings.TrimSpace(opts.Region) != "" &&
+		strings.TrimSpace(opts.AccessKeyID) != "" &&
+		strings.TrimSpace(opts.SecretAccessKey) != ""
+}
+
 func newS3Uploader(opts appcfg.S3Options) (*s3Uploader, error) {
 	bucket := strings.TrimSpace(opts.Bucket)
 	region := strings.TrimSpace(opts.Region)
@@ -66,6 +104,8 @@ func newS3Uploader(opts appcfg.S3Options) (*s3Uploader, error) {
 		Region:      region,
 		HTTPClient:  &http.Client{Timeout: 45 * time.Second},
 		Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
+		// Uploads retry with their own backoff in withS3Retry.
+		Retryer: func() aws.Retryer { return aws.NopRetryer{} },
 	}
 	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
 		o.UsePathStyle = pathStyle
@@ -80,6 +120,9 @@ func newS3Uploader(opts appcfg.S3Options) (*s3Uploader, error) {
 		region:       region,
 		customDomain: strings.TrimRight(strings.TrimSpace(opts.CustomDomain), "/"),
 		pathStyle:    pathStyle,
+		storageClass: types.StorageClass(strings.ToUpper(strings.TrimSpace(opts.StorageClass))),
+		sse:          s3Encryption(opts.ServerSideEncryption),
+		sseKMSKeyID:  strings.TrimSpace(opts.SSEKMSKeyID),
 		client:       client,
 	}, nil
 }
@@ -93,20 +136,238 @@ func (u *s3Uploader) Upload(ctx context.Context, objectKey string, payload []byt
 		contentType = "application/octet-stream"
 	}
 
-	_, err := u.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:        aws.String(u.bucket),
-		Key:           aws.String(key),
-		Body:          bytes.NewReader(payload),
-		ContentType:   aws.String(contentType),
-		ContentLength: aws.Int64(int64(len(payload))),
-	})
+	if err := u.put(ctx, key, bytes.NewReader(payload), int64(len(payload)), contentType); err != nil {
+		return "", fmt.Errorf("s3 upload failed: %w", err)
+	}
+
+	return u.publicURL(key), nil
+}
+
+// UploadFile streams a local file to S3 without loading it into memory.
+func (u *s3Uploader) UploadFile(ctx context.Context, objectKey, filePath, contentType string) (string, error) {
+	key := normalizeObjectKey(objectKey)
+	if key == "" {
+		return "", fmt.Errorf("invalid s3 object key")
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	f, err := os.Open(filePath)
 	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if err := u.put(ctx, key, f, info.Size(), contentType); err != nil {
 		return "", fmt.Errorf("s3 upload failed: %w", err)
 	}
 
 	return u.publicURL(key), nil
 }
 
+// put uploads size bytes of body, in parts when it is over the multipart
+// threshold. Every request reads its own section of body, so retries resend
+// exactly what failed.
+func (u *s3Uploader) put(ctx context.Context, key string, body io.ReaderAt, size int64, contentType string) error {
+	if size > s3MultipartThreshold {
+		return u.putMultipart(ctx, key, body, size, contentType)
+	}
+	return withS3Retry(ctx, func() error {
+		_, err := u.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:               aws.String(u.bucket),
+			Key:                  aws.String(key),
+			Body:                 io.NewSectionReader(body, 0, size),
+			ContentType:          aws.String(contentType),
+			ContentLength:        aws.Int64(size),
+			StorageClass:         u.storageClass,
+			ServerSideEncryption: u.sse,
+			SSEKMSKeyId:          u.kmsKeyID(),
+		})
+		return err
+	})
+}
+
+func (u *s3Uploader) putMultipart(ctx context.Context, key string, body io.ReaderAt, size int64, contentType string) error {
+	var created *s3.CreateMultipartUploadOutput
+	err := withS3Retry(ctx, func() error {
+		var err error
+		created, err = u.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:               aws.String(u.bucket),
+			Key:                  aws.String(key),
+			ContentType:          aws.String(contentType),
+			StorageClass:         u.storageClass,
+			ServerSideEncryption: u.sse,
+			SSEKMSKeyId:          u.kmsKeyID(),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("create multipart upload: %w", err)
+	}
+	uploadID := created.UploadId
+
+	partSize := int64(s3MultipartPartSize)
+	if minSize := (size + s3MaxParts - 1) / s3MaxParts; minSize > partSize {
+		partSize = minSize
+	}
+	parts := make([]types.CompletedPart, 0, (size+partSize-1)/partSize)
+	for offset, partNumber := int64(0), int32(1); offset < size; offset, partNumber = offset+partSize, partNumber+1 {
+		length := min(partSize, size-offset)
+		var out *s3.UploadPartOutput
+		err := withS3Retry(ctx, func() error {
+			var err error
+			out, err = u.client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:        aws.String(u.bucket),
+				Key:           aws.String(key),
+				UploadId:      uploadID,
+				PartNumber:    aws.Int32(partNumber),
+				Body:          io.NewSectionReader(body, offset, length),
+				ContentLength: aws.Int64(length),
+			})
+			return err
+		})
+		if err != nil {
+			u.abortMultipart(key, uploadID)
+			return fmt.Errorf("upload part %d: %w", partNumber, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(partNumber)})
+	}
+
+	err = withS3Retry(ctx, func() error {
+		_, err := u.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(u.bucket),
+			Key:             aws.String(key),
+			UploadId:        uploadID,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+		return err
+	})
+	if err != nil {
+		u.abortMultipart(key, uploadID)
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// abortMultipart discards the uploaded parts so the bucket is not billed for
+// them. It runs even when the upload's context is done.
+func (u *s3Uploader) abortMultipart(key string, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3AbortTimeout)
+	defer cancel()
+	_, _ = u.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(u.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+}
+
+// s3Encryption normalizes the configured encryption to the header value.
+func s3Encryption(value string) types.ServerSideEncryption {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "aes256" {
+		return types.ServerSideEncryptionAes256
+	}
+	return types.ServerSideEncryption(value)
+}
+
+func (u *s3Uploader) kmsKeyID() *string {
+	if u.sseKMSKeyID == "" {
+		return nil
+	}
+	return aws.String(u.sseKMSKeyID)
+}
+
+// withS3Retry runs op, retrying transient failures with exponential backoff.
+func withS3Retry(ctx context.Context, op func() error) error {
+	delay := s3RetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt == s3MaxAttempts || ctx.Err() != nil || !retryableS3Error(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// retryableS3Error reports whether err is a throttling, server side or
+// network failure that may succeed when retried.
+func retryableS3Error(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable", "Throttling", "ThrottlingException":
+			return true
+		}
+	}
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		return status >= 500 || status == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// remoteObject is one object returned by List.
+type remoteObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// List returns every object under prefix.
+func (u *s3Uploader) List(ctx context.Context, prefix string) ([]remoteObject, error) {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(u.bucket)}
+	if prefix = normalizeObjectKey(prefix); prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	objects := make([]remoteObject, 0)
+	paginator := s3.NewListObjectsV2Paginator(u.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list failed: %w", err)
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, remoteObject{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// Open streams an object. The caller must close the returned body.
+func (u *s3Uploader) Open(ctx context.Context, objectKey string) (io.ReadCloser, int64, error) {
+	key := normalizeObjectKey(objectKey)
+	if key == "" {
+		return nil, 0, fmt.Errorf("invalid s3 object key")
+	}
+	out, err := u.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("s3 download failed: %w", err)
+	}
+	return out.Body, aws.ToInt64(out.ContentLength), nil
+}
+
 func (u *s3Uploader) publicURL(objectKey string) string {
 	encodedKey := encodeObjectKey(objectKey)
 	if u.customDomain != "" {
@@ -0,0 +1,351 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mx-space/core/internal/modules/system/core/configs"
+	pkgcron "github.com/mx-space/core/internal/pkg/cron"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// schedulerPollInterval bounds how long config changes (enable/cron) take to apply.
+	schedulerPollInterval = time.Minute
+	redisBackupStatusKey  = "mx:backup:status"
+	redisBackupLockKey    = "mx:backup:lock"
+	backupLockTTL         = 30 * time.Minute
+	backupStatusTimeout   = 5 * time.Second
+)
+
+var errBackupRunning = errors.New("backup is already running")
+
+// Scheduler runs automatic backups according to BackupOptions.Cron. There is
+// one per process, shared by the backup Handler and the auto_backup cron job.
+type Scheduler struct {
+	h *Handler
+
+	mu      sync.Mutex
+	running bool
+	status  scheduleStatus
+}
+
+// scheduleStatus is shared through Redis so every worker can report it.
+type scheduleStatus struct {
+	Enabled       bool       `json:"enabled"`
+	Cron          string     `json:"cron"`
+	Running       bool       `json:"running"`
+	LastRunAt     *time.Time `json:"last_run_at"`
+	LastSuccessAt *time.Time `json:"last_success_at"`
+	LastError     string     `json:"last_error"`
+	LastFilename  string     `json:"last_filename"`
+	NextRunAt     *time.Time `json:"next_run_at"`
+}
+
+// NewScheduler creates a backup scheduler. Start it on a single instance only.
+func NewScheduler(db *gorm.DB, cfgSvc *configs.Service, rc *pkgredis.Client, logger *zap.Logger) *Scheduler {
+	h := &Handler{db: db, cfgSvc: cfgSvc, rc: rc, logger: zap.NewNop()}
+	if logger != nil {
+		h.logger = logger.Named("BackupScheduler")
+	}
+	return &Scheduler{h: h}
+}
+
+// Start blocks until ctx is done, running a backup at every scheduled time.
+func (s *Scheduler) Start(ctx context.Context) {
+	var (
+		spec     string
+		schedule *pkgcron.Schedule
+		next     time.Time
+	)
+	for {
+		cfg, err := s.h.cfgSvc.Get()
+		switch {
+		case err != nil || cfg == nil || !cfg.BackupOptions.Enable:
+			if spec != "" || s.loadStatus(ctx).Enabled {
+				s.updateStatus(ctx, func(st *scheduleStatus) {
+					st.Enabled = false
+					st.NextRunAt = nil
+				})
+			}
+			spec, schedule, next = "", nil, time.Time{}
+		case backupCronSpec(cfg.BackupOptions.Cron) != spec:
+			spec = backupCronSpec(cfg.BackupOptions.Cron)
+			schedule, next = nil, time.Time{}
+			parsed, err := pkgcron.ParseExpr(spec)
+			if err != nil {
+				s.h.logger.Warn("备份计划表达式无效", zap.String("cron", spec), zap.Error(err))
+				s.updateStatus(ctx, func(st *scheduleStatus) {
+					st.Enabled = true
+					st.Cron = spec
+					st.NextRunAt = nil
+					st.LastError = err.Error()
+				})
+				break
+			}
+			schedule = parsed
+			next = schedule.Next(time.Now())
+			s.h.logger.Info(fmt.Sprintf("下次自动备份时间：%s", next.Format(time.DateTime)))
+			s.updateStatus(ctx, func(st *scheduleStatus) {
+				st.Enabled = true
+				st.Cron = spec
+				st.NextRunAt = timePtr(next)
+			})
+		}
+
+		wait := schedulerPollInterval
+		if !next.IsZero() {
+			if until := time.Until(next); until < wait {
+				wait = until
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if schedule != nil && !next.IsZero() && !time.Now().Before(next) {
+			next = schedule.Next(time.Now())
+			s.updateStatus(ctx, func(st *scheduleStatus) { st.NextRunAt = timePtr(next) })
+			_ = s.Run(ctx)
+		}
+	}
+}
+
+func backupCronSpec(raw string) string {
+	if spec := strings.TrimSpace(raw); spec != "" {
+		return spec
+	}
+	return defaultBackupCron
+}
+
+// Run creates a local backup, uploads it to S3 when configured and prunes old copies.
+// Scheduled runs and POST /backups/run-now share this path.
+func (s *Scheduler) Run(ctx context.Context) error {
+	token, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.release(ctx, token)
+	defer s.keepLock(ctx, token)()
+
+	startedAt := time.Now()
+	s.updateStatus(ctx, func(st *scheduleStatus) {
+		st.Running = true
+		st.LastRunAt = timePtr(startedAt)
+	})
+
+	filename, err := s.run(ctx, startedAt)
+
+	s.updateStatus(ctx, func(st *scheduleStatus) {
+		st.Running = false
+		if err != nil {
+			st.LastError = err.Error()
+			return
+		}
+		st.LastError = ""
+		st.LastSuccessAt = timePtr(time.Now())
+		st.LastFilename = filename
+	})
+	return err
+}
+
+func (s *Scheduler) run(ctx context.Context, now time.Time) (string, error) {
+	h := s.h
+	cfg, err := h.cfgSvc.Get()
+	if err != nil {
+		return "", err
+	}
+
+	h.logger.Info("备份数据库中...")
+	artifact, err := h.createLocalBackupArtifact(now, cfg.BackupOptions.Passphrase, nil)
+	if err != nil {
+		h.logger.Warn("备份失败", zap.Error(err))
+		return "", err
+	}
+	h.logger.Info(fmt.Sprintf("备份成功：%s", artifact.Filename))
+
+	if s3Configured(cfg.S3Options) {
+		uploader, err := newS3Uploader(cfg.S3Options)
+		if err != nil {
+			h.logger.Warn("S3 配置无效", zap.Error(err))
+			return artifact.Filename, err
+		}
+		key := renderBackupObjectKey(cfg.BackupOptions.Path, artifact.Filename, now)
+		h.logger.Info(fmt.Sprintf("上传备份到 S3：%s", key))
+		if _, err := uploader.UploadFile(ctx, key, artifact.Path, backupContentType(artifact.Filename)); err != nil {
+			h.logger.Warn("S3 上传失败", zap.Error(err))
+			return artifact.Filename, err
+		}
+		h.logger.Info("S3 上传成功")
+	}
+
+	removed := pruneLocalBackups(cfg.BackupOptions.Retention, cfg.BackupOptions.RetentionDays)
+	if len(removed) > 0 {
+		h.logger.Info(fmt.Sprintf("已清理 %d 个旧备份", len(removed)))
+	}
+	return artifact.Filename, nil
+}
+
+// releaseLockScript deletes the lock only while it still holds the caller's
+// token, so a run whose lock expired cannot drop the lock of the run after it.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// refreshLockScript extends the lock to ARGV[2] milliseconds while it still
+// holds the caller's token. It returns 0 once the lock was lost.
+var refreshLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// acquire guards against concurrent runs on this process and across workers and
+// returns the token the Redis lock was taken with ("" without Redis). When Redis
+// cannot be reached the run is refused rather than risking two workers writing
+// the same backup; the next scheduled run tries again.
+func (s *Scheduler) acquire(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return "", errBackupRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	rc := s.h.rc
+	if rc == nil {
+		return "", nil
+	}
+	token := uuid.NewString()
+	lockCtx, cancel := context.WithTimeout(ctx, backupStatusTimeout)
+	defer cancel()
+	ok, err := rc.Raw().SetNX(lockCtx, redisBackupLockKey, token, backupLockTTL).Result()
+	if err != nil || !ok {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+		if err != nil {
+			return "", fmt.Errorf("acquire backup lock: %w", err)
+		}
+		return "", errBackupRunning
+	}
+	return token, nil
+}
+
+// keepLock refreshes the Redis lock until the returned function is called, so a
+// backup running longer than backupLockTTL keeps it.
+func (s *Scheduler) keepLock(ctx context.Context, token string) (stop func()) {
+	rc := s.h.rc
+	if rc == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(backupLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			lockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backupStatusTimeout)
+			kept, err := refreshLockScript.Run(lockCtx, rc.Raw(), []string{redisBackupLockKey},
+				token, backupLockTTL.Milliseconds()).Int()
+			cancel()
+			switch {
+			case err != nil:
+				s.h.logger.Warn("续期备份锁失败", zap.Error(err))
+			case kept == 0:
+				s.h.logger.Warn("备份锁已失效")
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (s *Scheduler) release(ctx context.Context, token string) {
+	if rc := s.h.rc; rc != nil && token != "" {
+		lockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backupStatusTimeout)
+		if err := releaseLockScript.Run(lockCtx, rc.Raw(), []string{redisBackupLockKey}, token).Err(); err != nil {
+			s.h.logger.Warn("释放备份锁失败", zap.Error(err))
+		}
+		cancel()
+	}
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) updateStatus(ctx context.Context, fn func(*scheduleStatus)) {
+	st := s.loadStatus(ctx)
+	fn(&st)
+
+	s.mu.Lock()
+	s.status = st
+	s.mu.Unlock()
+
+	rc := s.h.rc
+	if rc == nil {
+		return
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return
+	}
+	statusCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backupStatusTimeout)
+	defer cancel()
+	if err := rc.Set(statusCtx, redisBackupStatusKey, data, 0); err != nil {
+		s.h.logger.Warn("保存备份状态失败", zap.Error(err))
+	}
+}
+
+func (s *Scheduler) loadStatus(ctx context.Context) scheduleStatus {
+	s.mu.Lock()
+	st := s.status
+	s.mu.Unlock()
+
+	rc := s.h.rc
+	if rc == nil {
+		return st
+	}
+	statusCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backupStatusTimeout)
+	defer cancel()
+	raw, err := rc.Get(statusCtx, redisBackupStatusKey)
+	if err != nil || raw == "" {
+		return st
+	}
+	var shared scheduleStatus
+	if err := json.Unmarshal([]byte(raw), &shared); err != nil {
+		return st
+	}
+	return shared
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,56 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+)
+
+func newTestScheduler(t *testing.T) (*Scheduler, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := pkgredis.Connect("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = rc.Raw().Close() })
+	return NewScheduler(nil, nil, rc, nil), mr
+}
+
+func TestReleaseKeepsAnotherRunsLock(t *testing.T) {
+	s, mr := newTestScheduler(t)
+	ctx := context.Background()
+
+	token, err := s.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Our lock expired and another worker took it over.
+	if err := mr.Set(redisBackupLockKey, "other-worker"); err != nil {
+		t.Fatal(err)
+	}
+	s.release(ctx, token)
+
+	if got, _ := mr.Get(redisBackupLockKey); got != "other-worker" {
+		t.Fatalf("lock = %q, want the other worker's token", got)
+	}
+	if _, err := s.acquire(ctx); !errors.Is(err, errBackupRunning) {
+		t.Fatalf("acquire while another worker holds the lock: err = %v, want errBackupRunning", err)
+	}
+}
+
+func TestAcquireRefusesWhenRedisFails(t *testing.T) {
+	s, mr := newTestScheduler(t)
+	mr.SetError("LOADING")
+
+	_, err := s.acquire(context.Background())
+	if err == nil || errors.Is(err, errBackupRunning) {
+		t.Fatalf("err = %v, want the Redis error", err)
+	}
+	if s.running {
+		t.Fatal("a failed acquire must not leave the scheduler marked running")
+	}
+}
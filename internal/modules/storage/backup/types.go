@@ -2,9 +2,9 @@ package backup
 
 import (
 	"archive/zip"
-	"bytes"
 	"time"
 
+	"github.com/mx-space/core/internal/modules/gateway/gateway"
 	"github.com/mx-space/core/internal/modules/system/core/configs"
 	pkgredis "github.com/mx-space/core/internal/pkg/redis"
 	"go.uber.org/zap"
@@ -15,8 +15,13 @@ const backupRootDir = "mx-space-go"
 const backupDBDir = backupRootDir + "/db"
 const backupManifestFile = backupRootDir + "/manifest.json"
 const backupFormat = "mx-core-go-bson"
-const backupFormatVersion = 1
+
+// backupFormatVersion 2 records the real database engine; version 1 archives
+// always claimed "mysql".
+const backupFormatVersion = 2
 const defaultS3PathTemplate = "backups/{Y}/{m}/{filename}"
+const defaultBackupCron = "0 1 * * *"
+const backupCompressionGzip = "gzip"
 const EnvBackupDir = "MX_BACKUP_DIR"
 
 var backupTableNames = []string{
@@ -69,6 +74,16 @@ var restoreTableAliases = map[string]string{
 	"analyze_logs":       "analyzes",
 	"recently":           "recentlies",
 	"subscribers":        "subscribes",
+	// Collection names as created by mongoose in the original mx-space.
+	"slugtrackers":     "slug_trackers",
+	"aisummaries":      "ai_summaries",
+	"aideepreadings":   "ai_deep_readings",
+	"filereferences":   "file_references",
+	"webhookevents":    "webhook_events",
+	"drafthistories":   "draft_histories",
+	"apitokens":        "api_tokens",
+	"oauth2tokens":     "oauth2_tokens",
+	"authncredentials": "authn_credentials",
 }
 
 var restoreColumnAliases = map[string]string{
@@ -144,7 +159,12 @@ type Handler struct {
 	db     *gorm.DB
 	cfgSvc *configs.Service
 	rc     *pkgredis.Client
+	hub    *gateway.Hub
 	logger *zap.Logger
+	jobs   *restoreJobs
+	sched  *Scheduler
+	// reindex rebuilds the search index after a restore.
+	reindex func() (int, error)
 }
 
 type backupManifest struct {
@@ -153,6 +173,72 @@ type backupManifest struct {
 	Engine    string    `json:"engine"`
 	CreatedAt time.Time `json:"created_at"`
 	Tables    []string  `json:"tables"`
+	// Compression is "gzip" when table entries are stored as .bson.gz.
+	Compression string           `json:"compression,omitempty"`
+	RowCounts   map[string]int64 `json:"row_counts,omitempty"`
+	// Checksums holds the hex SHA-256 of each table's uncompressed BSON payload.
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// ArchiveSHA256 covers Tables and Checksums, see archiveChecksum.
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+}
+
+// RestoreOptions narrows or previews a restore.
+type RestoreOptions struct {
+	// Tables restricts the restore to these tables; empty restores every table.
+	Tables []string
+	// DryRun decodes and normalizes the archive without writing anything.
+	DryRun bool
+	// Reindex rebuilds the search index once the restore has committed.
+	Reindex bool
+	// Progress, when set, is called as tables are restored. Dry runs do not report progress.
+	Progress func(RestoreProgress)
+}
+
+// RestoreProgress is a snapshot of a running restore.
+type RestoreProgress struct {
+	Table string `json:"table"`
+	// RowsDone counts rows of Table processed so far, out of RowsTotal.
+	RowsDone     int     `json:"rows_done"`
+	RowsTotal    int     `json:"rows_total"`
+	TablesDone   int     `json:"tables_done"`
+	TablesTotal  int     `json:"tables_total"`
+	RowsInserted int     `json:"rows_inserted"`
+	Percent      float64 `json:"percent"`
+}
+
+// RestoreReport summarizes a restore (or what a dry run would do) per table.
+type RestoreReport struct {
+	DryRun bool `json:"dry_run"`
+	// EngineWarning is set when the archive was taken from another database engine.
+	EngineWarning string               `json:"engine_warning,omitempty"`
+	Tables        []TableRestoreReport `json:"tables"`
+}
+
+// TableRestoreReport counts the rows of one table. RowsToInsert is the number of
+// rows that would be inserted in a dry run and the number actually inserted otherwise.
+type TableRestoreReport struct {
+	Table        string         `json:"table"`
+	RowsFound    int            `json:"rows_found"`
+	RowsToInsert int            `json:"rows_to_insert"`
+	RowsSkipped  int            `json:"rows_skipped"`
+	SkipReasons  map[string]int `json:"skip_reasons,omitempty"`
+	// DroppedColumns lists archive fields with no matching column in the live schema.
+	DroppedColumns []string `json:"dropped_columns,omitempty"`
+	// Error is set by ValidateBackupZip when the table could not be decoded.
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	skipReasonNoColumns    = "no matching columns"
+	skipReasonDuplicateKey = "duplicate key"
+)
+
+func (r *TableRestoreReport) skip(reason string) {
+	r.RowsSkipped++
+	if r.SkipReasons == nil {
+		r.SkipReasons = make(map[string]int)
+	}
+	r.SkipReasons[reason]++
 }
 
 type backupEntryCandidate struct {
@@ -172,5 +258,6 @@ type backupItem struct {
 type backupArtifact struct {
 	Filename string
 	Path     string
-	Buffer   *bytes.Buffer
+	Size     int64
+	Manifest *backupManifest
 }
@@ -1,7 +1,7 @@
 package file
 
 import (
-	"io"
+	"errors"
 	"net/http"
 	"net/url"
 	"os"
@@ -14,7 +14,6 @@ import (
 	"github.com/gin-gonic/gin"
 	appcfg "github.com/mx-space/core/internal/config"
 	"github.com/mx-space/core/internal/models"
-	"github.com/mx-space/core/internal/modules/storage/backup"
 	"github.com/mx-space/core/internal/modules/storage/imagesync"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
 	"github.com/mx-space/core/internal/pkg/pagination"
@@ -57,8 +56,13 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 		g.POST("/orphans/cleanup", authMW, h.cleanupOrphans)
 
 		g.POST("/upload", authMW, h.upload)
+		g.GET("", authMW, h.listReferences)
+		g.GET("/"+imageBedDir+"/*path", h.getImageBed)
 		g.GET("/:type", authMW, h.listByType)
 		g.GET("/:type/:name", h.get)
+		// Wildcards at one position share a name in gin, so /:type here is a
+		// file reference ID.
+		g.DELETE("/:type", authMW, h.deleteReference)
 		g.DELETE("/:type/:name", authMW, h.delete)
 		g.PATCH("/:type/:name/rename", authMW, h.rename)
 	}
@@ -136,52 +140,9 @@ func (h *Handler) upload(c *gin.Context) {
 		return
 	}
 
-	if typ == "photo" {
-		cfg, err := h.loadConfig()
-		if err != nil {
-			response.InternalError(c, err)
-			return
-		}
-		if cfg != nil && cfg.ImageBedOptions.Enable {
-			if err := validateImageBedFile(fileHeader.Filename, fileHeader.Size, cfg.ImageBedOptions.AllowedFormats, cfg.ImageBedOptions.MaxSizeMB); err != nil {
-				response.BadRequest(c, err.Error())
-				return
-			}
-			file, err := fileHeader.Open()
-			if err != nil {
-				response.InternalError(c, err)
-				return
-			}
-			defer file.Close()
-			payload, err := io.ReadAll(file)
-			if err != nil {
-				response.InternalError(c, err)
-				return
-			}
-			if err := validateImageBedFile(fileHeader.Filename, int64(len(payload)), cfg.ImageBedOptions.AllowedFormats, cfg.ImageBedOptions.MaxSizeMB); err != nil {
-				response.BadRequest(c, err.Error())
-				return
-			}
-			uploader, err := backup.NewS3Uploader(cfg.S3Options)
-			if err != nil {
-				response.BadRequest(c, err.Error())
-				return
-			}
-			now := time.Now()
-			objectKey := renderImageBedObjectKey(cfg.ImageBedOptions.Path, fileHeader.Filename, payload, now)
-			contentType := detectContentType(fileHeader.Filename, payload, fileHeader.Header.Get("Content-Type"))
-			s3URL, err := uploader.Upload(c.Request.Context(), objectKey, payload, contentType)
-			if err != nil {
-				response.InternalError(c, err)
-				return
-			}
-			response.OK(c, gin.H{
-				"url":     s3URL,
-				"name":    filepath.Base(objectKey),
-				"storage": "s3",
-			})
-			return
-		}
+	if typ == imageBedType {
+		h.uploadImageBed(c, fileHeader)
+		return
 	}
 
 	filename := buildFileName(fileHeader.Filename)
@@ -379,6 +340,47 @@ func (h *Handler) listOrphans(c *gin.Context) {
 	})
 }
 
+// listReferences pages through recorded uploads, optionally by ?status=.
+func (h *Handler) listReferences(c *gin.Context) {
+	q := pagination.FromContext(c)
+	tx := h.db.Model(&models.FileReferenceModel{}).Order("created_at DESC")
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+
+	var refs []models.FileReferenceModel
+	pag, err := pagination.Paginate(tx, q, &refs)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.Paged(c, refs, pag)
+}
+
+// deleteReference removes a recorded upload and its local file.
+func (h *Handler) deleteReference(c *gin.Context) {
+	var ref models.FileReferenceModel
+	if err := h.db.First(&ref, "id = ?", c.Param("type")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFoundMsg(c, "文件不存在")
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	if path, ok := h.pathFromFileURL(ref.FileURL); ok {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			response.InternalError(c, err)
+			return
+		}
+	}
+	if err := h.db.Delete(&ref).Error; err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.NoContent(c)
+}
+
 func (h *Handler) countOrphans(c *gin.Context) {
 	var count int64
 	if err := h.db.Model(&models.FileReferenceModel{}).Where("status = ?", "pending").Count(&count).Error; err != nil {
@@ -442,6 +444,10 @@ func (h *Handler) pathFromFileURL(raw string) (string, bool) {
 		if seg != "objects" && seg != "files" {
 			continue
 		}
+		if strings.EqualFold(parts[i+1], imageBedDir) {
+			full, err := h.imageBedPath(strings.Join(parts[i+2:], "/"))
+			return full, err == nil
+		}
 		typ := normalizeType(parts[i+1])
 		name := safeName(parts[i+2])
 		if typ == "" || name == "" {
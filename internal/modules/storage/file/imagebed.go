@@ -0,0 +1,293 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	appcfg "github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/storage/backup"
+	"github.com/mx-space/core/internal/pkg/response"
+)
+
+const (
+	// imageBedType is the upload type handled by the image bed.
+	imageBedType = "photo"
+	// imageBedDir holds image bed uploads under the static dir when S3 is not
+	// configured, laid out by ImageBedOptions.Path.
+	imageBedDir = "imagebed"
+)
+
+var errUnsafeObjectKey = errors.New("invalid image path")
+
+// uploadImageBed stores an image bed upload in S3 when it is configured and
+// under the static dir otherwise, and records it as a pending file reference.
+func (h *Handler) uploadImageBed(c *gin.Context, fileHeader *multipart.FileHeader) {
+	cfg, err := h.loadConfig()
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if cfg == nil || !cfg.ImageBedOptions.Enable {
+		response.ForbiddenMsg(c, "图床功能未开启")
+		return
+	}
+	opts := cfg.ImageBedOptions
+	if err := validateImageBedFile(fileHeader.Filename, fileHeader.Size, opts.AllowedFormats, opts.MaxSizeMB); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	defer file.Close()
+	payload, err := io.ReadAll(file)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if err := validateImageBedFile(fileHeader.Filename, int64(len(payload)), opts.AllowedFormats, opts.MaxSizeMB); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if opts.StripEXIF {
+		payload = stripImageMetadata(fileHeader.Filename, payload)
+	}
+
+	objectKey := renderImageBedObjectKey(opts.Path, fileHeader.Filename, payload, time.Now())
+	storage := "local"
+	var fileURL string
+	if backup.S3Configured(cfg.S3Options) {
+		uploader, err := backup.NewS3Uploader(cfg.S3Options)
+		if err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		contentType := detectContentType(fileHeader.Filename, payload, fileHeader.Header.Get("Content-Type"))
+		fileURL, err = uploader.Upload(c.Request.Context(), objectKey, payload, contentType)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		storage = "s3"
+	} else {
+		savePath, err := h.imageBedPath(objectKey)
+		if err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(savePath), 0o755); err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		if err := os.WriteFile(savePath, payload, 0o644); err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		fileURL = imageBedURL(cfg, detectRoot(c.Request.URL.Path), objectKey)
+	}
+
+	ref := models.FileReferenceModel{
+		FileURL:  fileURL,
+		FileName: path.Base(objectKey),
+		Status:   "pending",
+	}
+	if err := h.db.Create(&ref).Error; err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, gin.H{
+		"id":      ref.ID,
+		"url":     fileURL,
+		"name":    ref.FileName,
+		"storage": storage,
+	})
+}
+
+// getImageBed serves a locally stored image bed file.
+func (h *Handler) getImageBed(c *gin.Context) {
+	p, err := h.imageBedPath(c.Param("path"))
+	if err != nil {
+		response.NotFoundMsg(c, "文件不存在")
+		return
+	}
+	if info, err := os.Stat(p); err != nil || info.IsDir() {
+		response.NotFoundMsg(c, "文件不存在")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=31536000")
+	c.File(p)
+}
+
+// imageBedPath maps an object key to a path inside the image bed dir,
+// rejecting keys that would escape it.
+func (h *Handler) imageBedPath(key string) (string, error) {
+	key = strings.Trim(strings.ReplaceAll(key, "\\", "/"), "/")
+	if key == "" {
+		return "", errUnsafeObjectKey
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", errUnsafeObjectKey
+		}
+	}
+	root := filepath.Join(h.staticDir, imageBedDir)
+	full := filepath.Join(root, filepath.FromSlash(key))
+	if !strings.HasPrefix(full, root+string(filepath.Separator)) {
+		return "", errUnsafeObjectKey
+	}
+	return full, nil
+}
+
+// imageBedURL builds the public URL of a local image bed file from
+// URL.ServerURL, or a site-relative one when it is unset.
+func imageBedURL(cfg *appcfg.FullConfig, root, key string) string {
+	rel := "/" + root + "/" + imageBedDir + "/" + key
+	base := strings.TrimRight(strings.TrimSpace(cfg.URL.ServerURL), "/")
+	if base == "" {
+		return rel
+	}
+	return base + "/api/v2" + rel
+}
+
+// stripImageMetadata re-encodes JPEG and PNG payloads, which drops EXIF and
+// other metadata. A JPEG's EXIF orientation is applied to the pixels first so
+// the photo keeps displaying upright without the tag. Other formats, and
+// payloads that fail to decode, are returned unchanged.
+func stripImageMetadata(filename string, payload []byte) []byte {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return payload
+	}
+	img, format, err := image.Decode(bytes.NewReader(payload))
+	if err != nil {
+		return payload
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		img = applyOrientation(img, jpegOrientation(payload))
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 92})
+	case "png":
+		err = png.Encode(&buf, img)
+	default:
+		return payload
+	}
+	if err != nil {
+		return payload
+	}
+	return buf.Bytes()
+}
+
+// jpegOrientation returns the EXIF Orientation tag (1-8) of a JPEG, or 1 when
+// it has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // image data starts, no EXIF seen
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation reads the Orientation tag from IFD0 of a TIFF block.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation transforms img so that it displays upright with the given
+// EXIF orientation removed.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // 5-8 swap width and height
+		dw, dh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs 90° counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			out.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return out
+}
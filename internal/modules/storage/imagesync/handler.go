@@ -0,0 +1,39 @@
+package imagesync
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/response"
+)
+
+// Handler exposes manual image sync.
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
+	g := rg.Group("/images", authMW)
+	g.POST("/sync/:refId", h.syncRef)
+}
+
+// POST /images/sync/:refId
+func (h *Handler) syncRef(c *gin.Context) {
+	result, err := h.svc.SyncRef(c.Param("refId"))
+	switch {
+	case errors.Is(err, ErrRefNotFound):
+		response.NotFoundMsg(c, "文章不存在")
+	case errors.Is(err, errStorageDisabled):
+		response.BadRequest(c, "图片存储未开启")
+	case errors.Is(err, errTextChanged):
+		response.Conflict(c, "同步期间文章已被修改，请重试")
+	case err != nil:
+		response.InternalError(c, err)
+	default:
+		response.OK(c, result)
+	}
+}
@@ -2,8 +2,10 @@ package imagesync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -11,28 +13,58 @@ import (
 	"time"
 
 	appcfg "github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/models"
 	"github.com/mx-space/core/internal/modules/storage/backup"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
-// localImagePattern matches local image URLs like /objects/image/... or /files/image/...
-var localImagePattern = regexp.MustCompile(`(?:(/(?:objects|files)/image/[^\s"')\]]+))`)
+// localImagePattern matches local image URLs like /objects/image/... or
+// /files/image/..., optionally prefixed with a scheme and host.
+var localImagePattern = regexp.MustCompile(`(?:https?://[^\s"'()<>\]/]+(?:/[^\s"'()<>\]]*?)?)?/(?:objects|files)/image/[^\s"'()<>\]]+`)
+
+var (
+	errStorageDisabled = errors.New("image storage not enabled")
+	// ErrRefNotFound is returned by SyncRef when no post or note has the ID.
+	ErrRefNotFound = errors.New("post or note not found")
+	// errTextChanged means the article was edited while its images uploaded;
+	// the rewrite is dropped and local files are kept for the next run.
+	errTextChanged = errors.New("article text changed during image sync")
+)
 
 // Service handles syncing local images to S3-compatible object storage.
 type Service struct {
 	db        *gorm.DB
 	cfgSvc    *appconfigs.Service
+	logger    *zap.Logger
 	staticDir string
 }
 
+// ServiceOption configures a Service.
+type ServiceOption func(*Service)
+
+// WithLogger sets the logger for the image sync service.
+func WithLogger(l *zap.Logger) ServiceOption {
+	return func(s *Service) {
+		if l != nil {
+			s.logger = l.Named("ImageSyncService")
+		}
+	}
+}
+
 // NewService creates a new image sync service.
-func NewService(db *gorm.DB, cfgSvc *appconfigs.Service) *Service {
-	return &Service{
+func NewService(db *gorm.DB, cfgSvc *appconfigs.Service, opts ...ServiceOption) *Service {
+	s := &Service{
 		db:        db,
 		cfgSvc:    cfgSvc,
+		logger:    zap.NewNop(),
 		staticDir: resolveStaticDir(),
 	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
 }
 
 // SyncURLs uploads a list of local image URLs to S3 and returns a mapping
@@ -42,7 +74,7 @@ func (s *Service) SyncURLs(urls []string) []SyncResult {
 	if err != nil || cfg == nil || !cfg.ImageStorageOptions.Enable {
 		results := make([]SyncResult, len(urls))
 		for i, u := range urls {
-			results[i] = SyncResult{OriginalURL: u, Error: "image storage not enabled"}
+			results[i] = SyncResult{OriginalURL: u, Error: errStorageDisabled.Error()}
 		}
 		return results
 	}
@@ -59,6 +91,9 @@ func (s *Service) SyncURLs(urls []string) []SyncResult {
 	results := make([]SyncResult, len(urls))
 	for i, u := range urls {
 		results[i] = s.syncSingleURL(cfg, uploader, u)
+		if results[i].S3URL != "" && cfg.ImageStorageOptions.DeleteLocalAfterSync {
+			s.removeLocalCopy(u, "")
+		}
 	}
 	return results
 }
@@ -95,16 +130,13 @@ func (s *Service) syncSingleURL(cfg *appcfg.FullConfig, uploader backup.S3Upload
 	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
 	defer cancel()
 
+	// The object key only depends on the file name, so uploading the same
+	// image again overwrites the earlier object instead of duplicating it.
 	s3URL, err := uploader.Upload(ctx, objectKey, data, contentType)
 	if err != nil {
 		return SyncResult{OriginalURL: localURL, Error: fmt.Sprintf("upload: %s", err.Error())}
 	}
 
-	// Optionally delete local file after sync.
-	if cfg.ImageStorageOptions.DeleteLocalAfterSync {
-		_ = os.Remove(localPath)
-	}
-
 	return SyncResult{OriginalURL: localURL, S3URL: s3URL}
 }
 
@@ -142,13 +174,21 @@ func (s *Service) localPathFromURL(rawURL string) string {
 		if seg == "objects" || seg == "files" {
 			typ := parts[i+1]
 			name := parts[i+2]
+			if !safeSegment(typ) || !safeSegment(name) {
+				return ""
+			}
 			return filepath.Join(s.staticDir, typ, name)
 		}
 	}
 	return ""
 }
 
-// ExtractLocalImageURLs finds all local image URLs in a markdown text.
+func safeSegment(seg string) bool {
+	return seg != "" && seg != "." && seg != ".." && !strings.ContainsAny(seg, `/\`)
+}
+
+// ExtractLocalImageURLs finds all /objects/image and /files/image URLs in a
+// markdown text. Absolute URLs are returned whatever their host.
 func ExtractLocalImageURLs(text string) []string {
 	matches := localImagePattern.FindAllString(text, -1)
 	seen := make(map[string]struct{}, len(matches))
@@ -170,40 +210,29 @@ func resolveStaticDir() string {
 	return dir
 }
 
-// ReplaceMarkdownImageURLs replaces local image URLs in text with their S3 counterparts.
+// ReplaceMarkdownImageURLs replaces local image URLs in text with their S3
+// counterparts. Only whole URL matches are replaced, so a relative URL is
+// never rewritten inside a longer absolute one.
 func ReplaceMarkdownImageURLs(text string, replacements map[string]string) string {
-	for original, s3URL := range replacements {
-		text = strings.ReplaceAll(text, original, s3URL)
-	}
-	return text
-}
-
-// SyncMarkdownImages extracts local images from text, uploads them to S3,
-// and returns the text with URLs replaced.
-func (s *Service) SyncMarkdownImages(text string) (string, error) {
-	localURLs := ExtractLocalImageURLs(text)
-	if len(localURLs) == 0 {
-		return text, nil
-	}
-
-	results := s.SyncURLs(localURLs)
-	replacements := make(map[string]string, len(results))
-	for _, r := range results {
-		if r.S3URL != "" {
-			replacements[r.OriginalURL] = r.S3URL
+	return localImagePattern.ReplaceAllStringFunc(text, func(m string) string {
+		if s3URL, ok := replacements[m]; ok {
+			return s3URL
 		}
-	}
-
-	if len(replacements) > 0 {
-		text = ReplaceMarkdownImageURLs(text, replacements)
-	}
-	return text, nil
+		return m
+	})
 }
 
 // SyncFunc is a function type for syncing images, used by the notify service.
 type SyncFunc func(contentID, contentType string) error
 
-// SyncContentImages syncs images for a given content item (post or note).
+// RefSyncResult reports a SyncRef run.
+type RefSyncResult struct {
+	RefType string       `json:"refType"`
+	Images  []SyncResult `json:"images"`
+}
+
+// SyncContentImages syncs images for a given content item (post or note)
+// when ImageStorageOptions.SyncOnPublish is on.
 func (s *Service) SyncContentImages(contentID, contentType string) error {
 	cfg, err := s.cfgSvc.Get()
 	if err != nil || cfg == nil || !cfg.ImageStorageOptions.Enable || !cfg.ImageStorageOptions.SyncOnPublish {
@@ -212,40 +241,207 @@ func (s *Service) SyncContentImages(contentID, contentType string) error {
 
 	switch contentType {
 	case "post":
-		return s.syncPostImages(contentID)
+		_, err = s.syncArticle(cfg, &models.PostModel{}, contentType, contentID)
 	case "note":
-		return s.syncNoteImages(contentID)
-	default:
-		return nil
+		_, err = s.syncArticle(cfg, &models.NoteModel{}, contentType, contentID)
 	}
+	return err
 }
 
-func (s *Service) syncPostImages(id string) error {
-	var text string
-	if err := s.db.Raw("SELECT text FROM posts WHERE id = ?", id).Scan(&text).Error; err != nil {
-		return err
+// SyncRef uploads the local images of the post or note with the given ID and
+// rewrites its text, regardless of SyncOnPublish. Running it again is safe:
+// already rewritten URLs no longer match as local.
+func (s *Service) SyncRef(refID string) (*RefSyncResult, error) {
+	cfg, err := s.cfgSvc.Get()
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil || !cfg.ImageStorageOptions.Enable {
+		return nil, errStorageDisabled
+	}
+
+	var count int64
+	if err := s.db.Model(&models.PostModel{}).Where("id = ?", refID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		images, err := s.syncArticle(cfg, &models.PostModel{}, "post", refID)
+		return &RefSyncResult{RefType: "post", Images: images}, err
+	}
+	if err := s.db.Model(&models.NoteModel{}).Where("id = ?", refID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		images, err := s.syncArticle(cfg, &models.NoteModel{}, "note", refID)
+		return &RefSyncResult{RefType: "note", Images: images}, err
+	}
+	return nil, ErrRefNotFound
+}
+
+// syncArticle uploads the local images of one row, rewrites its text, and
+// only after that update commits records the new URLs in file_references
+// and removes the local copies when DeleteLocalAfterSync is set. The update
+// is conditional on the text being unchanged so a concurrent edit is never
+// overwritten.
+func (s *Service) syncArticle(cfg *appcfg.FullConfig, model interface{}, refType, id string) ([]SyncResult, error) {
+	var row struct{ Text string }
+	res := s.db.Model(model).Select("text").Where("id = ?", id).Limit(1).Find(&row)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	localURLs := s.localImageURLs(cfg, row.Text)
+	if len(localURLs) == 0 {
+		return []SyncResult{}, nil
 	}
-	newText, err := s.SyncMarkdownImages(text)
+	uploader, err := s.buildUploader(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if newText != text {
-		return s.db.Exec("UPDATE posts SET text = ? WHERE id = ?", newText, id).Error
+
+	results := make([]SyncResult, len(localURLs))
+	replacements := make(map[string]string, len(localURLs))
+	for i, u := range localURLs {
+		results[i] = s.syncSingleURL(cfg, uploader, u)
+		if results[i].S3URL != "" {
+			replacements[u] = results[i].S3URL
+		} else {
+			s.logger.Warn("image sync failed", zap.String("id", id), zap.String("url", u), zap.String("error", results[i].Error))
+		}
 	}
-	return nil
+	if len(replacements) == 0 {
+		return results, nil
+	}
+
+	update := s.db.Model(model).Where("id = ? AND text = ?", id, row.Text).
+		UpdateColumn("text", ReplaceMarkdownImageURLs(row.Text, replacements))
+	if update.Error != nil {
+		return results, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return results, errTextChanged
+	}
+
+	s.recordReferences(refType, id, replacements)
+	if cfg.ImageStorageOptions.DeleteLocalAfterSync {
+		for original := range replacements {
+			s.removeLocalCopy(original, id)
+		}
+	}
+	return results, nil
 }
 
-func (s *Service) syncNoteImages(id string) error {
-	var text string
-	if err := s.db.Raw("SELECT text FROM notes WHERE id = ?", id).Scan(&text).Error; err != nil {
-		return err
+// textModels are the tables whose text may embed local image URLs.
+var textModels = []interface{}{&models.PostModel{}, &models.NoteModel{}, &models.PageModel{}, &models.DraftModel{}}
+
+// likeEscaper escapes LIKE wildcards with '!', which every supported
+// database accepts as an ESCAPE character without string literal quirks.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// removeLocalCopy deletes the local file behind localURL once it has been
+// uploaded, unless another post, note, page or draft still embeds it, or a
+// file_references row of an article other than exceptRef still points at the
+// local copy. Lookup errors keep the file.
+func (s *Service) removeLocalCopy(localURL, exceptRef string) {
+	p := s.localPathFromURL(localURL)
+	if p == "" {
+		return
+	}
+	name := likeEscaper.Replace(filepath.Base(p))
+	objects, files := "%/objects/image/"+name+"%", "%/files/image/"+name+"%"
+	for _, model := range textModels {
+		var n int64
+		err := s.db.Model(model).
+			Where("text LIKE ? ESCAPE '!' OR text LIKE ? ESCAPE '!'", objects, files).
+			Count(&n).Error
+		if err != nil || n > 0 {
+			return
+		}
+	}
+	var n int64
+	err := s.db.Model(&models.FileReferenceModel{}).
+		Where("ref_id <> ? AND (file_url LIKE ? ESCAPE '!' OR file_url LIKE ? ESCAPE '!')", exceptRef, objects, files).
+		Count(&n).Error
+	if err != nil || n > 0 {
+		return
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("remove local image failed", zap.String("path", p), zap.Error(err))
 	}
-	newText, err := s.SyncMarkdownImages(text)
+}
+
+// recordReferences gives the article an active file_references row for each
+// synced image, at its object storage URL, so orphan cleanup leaves it alone.
+// The article's own row, or an unclaimed one left by the upload, is reused;
+// rows of other articles sharing the image are left as they are, so every
+// article keeps a reference of its own.
+func (s *Service) recordReferences(refType, id string, replacements map[string]string) {
+	for original, s3URL := range replacements {
+		if err := s.recordReference(refType, id, original, s3URL); err != nil {
+			s.logger.Warn("record image reference failed", zap.String("id", id), zap.String("url", original), zap.Error(err))
+		}
+	}
+}
+
+func (s *Service) recordReference(refType, id, original, s3URL string) error {
+	fileName := filepath.Base(s.localPathFromURL(original))
+	active := map[string]interface{}{
+		"file_url": s3URL,
+		"status":   "active",
+		"ref_id":   id,
+		"ref_type": refType,
+	}
+
+	var existing models.FileReferenceModel
+	err := s.db.Where("ref_id = ? AND file_url = ?", id, s3URL).Limit(1).Find(&existing).Error
 	if err != nil {
 		return err
 	}
-	if newText != text {
-		return s.db.Exec("UPDATE notes SET text = ? WHERE id = ?", newText, id).Error
+	if existing.ID == "" {
+		err = s.db.
+			Where("file_url = ? OR (file_name = ? AND file_url LIKE ? ESCAPE '!')",
+				original, fileName, "%/image/"+likeEscaper.Replace(fileName)).
+			Where("ref_id = ? OR ref_id = '' OR ref_id IS NULL", id).
+			Order("ref_id DESC").Limit(1).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+	}
+	if existing.ID != "" {
+		return s.db.Model(&models.FileReferenceModel{}).Where("id = ?", existing.ID).Updates(active).Error
+	}
+	return s.db.Create(&models.FileReferenceModel{
+		FileURL:  s3URL,
+		FileName: fileName,
+		Status:   "active",
+		RefID:    id,
+		RefType:  refType,
+	}).Error
+}
+
+// localImageURLs returns the image URLs in text served from this site's
+// static dir: site-relative ones, and absolute ones whose host matches
+// URL.ServerURL or URL.WebURL.
+func (s *Service) localImageURLs(cfg *appcfg.FullConfig, text string) []string {
+	hosts := map[string]bool{}
+	for _, raw := range []string{cfg.URL.ServerURL, cfg.URL.WebURL} {
+		if u, err := url.Parse(strings.TrimSpace(raw)); err == nil && u.Host != "" {
+			hosts[strings.ToLower(u.Host)] = true
+		}
+	}
+
+	var out []string
+	for _, m := range ExtractLocalImageURLs(text) {
+		if strings.HasPrefix(m, "/") {
+			out = append(out, m)
+			continue
+		}
+		if u, err := url.Parse(m); err == nil && hosts[strings.ToLower(u.Host)] {
+			out = append(out, m)
+		}
 	}
-	return nil
+	return out
 }
@@ -48,6 +48,9 @@ func (h *Handler) list(c *gin.Context) {
 	out := make([]readerResponse, 0, len(rows))
 	for _, row := range rows {
 		provider, accountType := inferProviderAndType(row.Handle)
+		if row.Provider != "" {
+			provider, accountType = row.Provider, "oauth"
+		}
 		out = append(out, readerResponse{
 			ID:       row.ID,
 			Provider: provider,
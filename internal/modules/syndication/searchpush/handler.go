@@ -0,0 +1,47 @@
+package searchpush
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/response"
+)
+
+// Handler exposes the search push token check.
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
+	g := rg.Group("/search-push", authMW)
+	g.POST("/test", h.test)
+}
+
+type testDTO struct {
+	URL string `json:"url" binding:"required"`
+}
+
+// POST /search-push/test — push one URL and return each engine's raw reply
+func (h *Handler) test(c *gin.Context) {
+	var dto testDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	u, err := url.Parse(strings.TrimSpace(dto.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		response.BadRequest(c, "URL 格式不正确")
+		return
+	}
+	results, err := h.svc.Test(c.Request.Context(), u.String())
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, gin.H{"results": results})
+}
@@ -0,0 +1,335 @@
+// Package searchpush submits newly published URLs to the Baidu and Bing URL
+// push APIs.
+package searchpush
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	appcfg "github.com/mx-space/core/internal/config"
+	"github.com/mx-space/core/internal/models"
+	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/tracing"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	EngineBaidu = "baidu"
+	EngineBing  = "bing"
+
+	pushTimeout  = 30 * time.Second
+	maxAttempts  = 3
+	retryBackoff = 2 * time.Second
+	// maxResponseBytes bounds how much of an engine's reply is kept.
+	maxResponseBytes = 64 << 10
+)
+
+var engines = []string{EngineBaidu, EngineBing}
+
+// errQuotaExceeded marks a reply saying the daily push quota is used up.
+var errQuotaExceeded = errors.New("daily push quota exceeded")
+
+// EngineResult is the outcome of pushing to one engine. Response holds the
+// engine's raw reply body.
+type EngineResult struct {
+	Engine   string `json:"engine"`
+	Status   int    `json:"status,omitempty"`
+	Response string `json:"response,omitempty"`
+	Skipped  string `json:"skipped,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Service pushes URLs to search engines. Engines that report an exhausted
+// quota are skipped until the next local midnight.
+type Service struct {
+	db     *gorm.DB
+	cfgSvc *appconfigs.Service
+	logger *zap.Logger
+	client *http.Client
+
+	mu           sync.Mutex
+	blockedUntil map[string]time.Time
+}
+
+// ServiceOption configures a Service.
+type ServiceOption func(*Service)
+
+// WithLogger sets the logger for the search push service.
+func WithLogger(l *zap.Logger) ServiceOption {
+	return func(s *Service) {
+		if l != nil {
+			s.logger = l.Named("SearchPushService")
+		}
+	}
+}
+
+func NewService(db *gorm.DB, cfgSvc *appconfigs.Service, opts ...ServiceOption) *Service {
+	s := &Service{
+		db:           db,
+		cfgSvc:       cfgSvc,
+		logger:       zap.NewNop(),
+		client:       &http.Client{Timeout: pushTimeout, Transport: tracing.Transport(nil)},
+		blockedUntil: map[string]time.Time{},
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Push submits urls to every enabled engine, retrying transient failures.
+func (s *Service) Push(ctx context.Context, urls []string) ([]EngineResult, error) {
+	cfg, err := s.cfgSvc.Get()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]EngineResult, 0, len(engines))
+	for _, engine := range engines {
+		results = append(results, s.PushEngine(ctx, cfg, engine, urls))
+	}
+	return results, nil
+}
+
+// PushEngine submits urls to one engine when it is enabled and has a token,
+// retrying transient failures. A quota-exceeded reply stops pushes to that
+// engine for the rest of the day.
+func (s *Service) PushEngine(ctx context.Context, cfg *appcfg.FullConfig, engine string, urls []string) EngineResult {
+	result := EngineResult{Engine: engine}
+	enabled, token := engineToken(cfg, engine)
+	switch {
+	case !enabled:
+		result.Skipped = "disabled"
+		return result
+	case token == "":
+		result.Skipped = "no token"
+		return result
+	case len(urls) == 0:
+		result.Skipped = "no urls"
+		return result
+	}
+	if until := s.blocked(engine); !until.IsZero() {
+		result.Skipped = "quota exceeded until " + until.Format(time.RFC3339)
+		return result
+	}
+
+	for attempt := 1; ; attempt++ {
+		var (
+			retry bool
+			err   error
+		)
+		result.Status, result.Response, retry, err = s.submit(ctx, cfg, engine, token, urls)
+		if err == nil {
+			result.Error = ""
+			return result
+		}
+		result.Error = err.Error()
+		if errors.Is(err, errQuotaExceeded) {
+			s.block(engine)
+			s.logger.Warn("搜索引擎推送配额已用完，今日不再推送", zap.String("engine", engine), zap.String("response", result.Response))
+			return result
+		}
+		if !retry || attempt >= maxAttempts {
+			s.logger.Warn("搜索引擎推送失败", zap.String("engine", engine), zap.Int("attempts", attempt), zap.Error(err))
+			return result
+		}
+		select {
+		case <-ctx.Done():
+			result.Error = ctx.Err().Error()
+			return result
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
+	}
+}
+
+// Test pushes rawURL once to every engine with a token, whether or not the
+// engine is enabled or backing off, so admins can check their tokens.
+func (s *Service) Test(ctx context.Context, rawURL string) ([]EngineResult, error) {
+	cfg, err := s.cfgSvc.Get()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]EngineResult, 0, len(engines))
+	for _, engine := range engines {
+		result := EngineResult{Engine: engine}
+		if _, token := engineToken(cfg, engine); token == "" {
+			result.Skipped = "no token"
+		} else {
+			result.Status, result.Response, _, err = s.submit(ctx, cfg, engine, token, []string{rawURL})
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// PushRef pushes the canonical URL of a post, note or page. Rows that are
+// missing or not publicly visible are ignored.
+func (s *Service) PushRef(ctx context.Context, refType, id string) error {
+	cfg, err := s.cfgSvc.Get()
+	if err != nil {
+		return err
+	}
+	if !cfg.BaiduSearchOptions.Enable && !cfg.BingSearchOptions.Enable {
+		return nil
+	}
+	u, err := s.refURL(cfg, refType, id)
+	if err != nil || u == "" {
+		return err
+	}
+	results, err := s.Push(ctx, []string{u})
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Error == "" && r.Skipped == "" {
+			s.logger.Info("搜索引擎推送成功", zap.String("engine", r.Engine), zap.String("url", u))
+		}
+	}
+	return nil
+}
+
+// refURL builds the canonical URL of a public row from URL.WebURL the same
+// way the sitemap does. It returns "" when there is nothing to push.
+func (s *Service) refURL(cfg *appcfg.FullConfig, refType, id string) (string, error) {
+	base := strings.TrimRight(cfg.URL.WebURL, "/")
+	if base == "" {
+		return "", nil
+	}
+	switch refType {
+	case "post":
+		var p models.PostModel
+		res := s.db.Preload("Category").Select("id, slug, category_id, is_published").Where("id = ?", id).Limit(1).Find(&p)
+		if res.Error != nil || res.RowsAffected == 0 || !p.IsPublished {
+			return "", res.Error
+		}
+		categorySlug := "uncategorized"
+		if p.Category != nil && strings.TrimSpace(p.Category.Slug) != "" {
+			categorySlug = strings.TrimSpace(p.Category.Slug)
+		}
+		return fmt.Sprintf("%s/posts/%s/%s", base, categorySlug, p.Slug), nil
+	case "note":
+		var n models.NoteModel
+		res := s.db.Select("id, n_id, is_published, public_at, password_hash").Where("id = ?", id).Limit(1).Find(&n)
+		if res.Error != nil || res.RowsAffected == 0 || !n.IsPublished || n.Password != "" {
+			return "", res.Error
+		}
+		if n.PublicAt != nil && n.PublicAt.After(time.Now()) {
+			return "", nil
+		}
+		return fmt.Sprintf("%s/notes/%d", base, n.NID), nil
+	case "page":
+		var p models.PageModel
+		res := s.db.Select("id, slug").Where("id = ?", id).Limit(1).Find(&p)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return "", res.Error
+		}
+		return fmt.Sprintf("%s/%s", base, p.Slug), nil
+	}
+	return "", nil
+}
+
+// submit makes one push request. retry reports whether a failure is worth
+// another attempt.
+func (s *Service) submit(ctx context.Context, cfg *appcfg.FullConfig, engine, token string, urls []string) (status int, body string, retry bool, err error) {
+	var req *http.Request
+	webURL := strings.TrimRight(cfg.URL.WebURL, "/")
+	switch engine {
+	case EngineBaidu:
+		apiURL := fmt.Sprintf("http://data.zz.baidu.com/urls?site=%s&token=%s", url.QueryEscape(webURL), url.QueryEscape(token))
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(strings.Join(urls, "\n")))
+		if err == nil {
+			req.Header.Set("Content-Type", "text/plain")
+		}
+	case EngineBing:
+		payload, _ := json.Marshal(map[string]interface{}{"siteUrl": webURL, "urlList": urls})
+		apiURL := "https://ssl.bing.com/webmaster/api.svc/json/SubmitUrlbatch?apikey=" + url.QueryEscape(token)
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(payload))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	default:
+		return 0, "", false, fmt.Errorf("unknown search engine %q", engine)
+	}
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", true, err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	body = string(raw)
+
+	msg := engineMessage(raw)
+	if strings.Contains(strings.ToLower(msg), "quota") {
+		return resp.StatusCode, body, false, fmt.Errorf("%w: %s", errQuotaExceeded, msg)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && msg == "" {
+		return resp.StatusCode, body, false, nil
+	}
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return resp.StatusCode, body, retry, fmt.Errorf("HTTP %d: %s", resp.StatusCode, msg)
+}
+
+// engineMessage pulls the error message out of a Baidu ({"message": ...}) or
+// Bing ({"Message": ...}) reply.
+func engineMessage(raw []byte) string {
+	var reply struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(reply.Message)
+}
+
+func engineToken(cfg *appcfg.FullConfig, engine string) (enabled bool, token string) {
+	var t *string
+	switch engine {
+	case EngineBaidu:
+		enabled, t = cfg.BaiduSearchOptions.Enable, cfg.BaiduSearchOptions.Token
+	case EngineBing:
+		enabled, t = cfg.BingSearchOptions.Enable, cfg.BingSearchOptions.Token
+	}
+	if t != nil {
+		token = strings.TrimSpace(*t)
+	}
+	return enabled, token
+}
+
+func (s *Service) blocked(engine string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until := s.blockedUntil[engine]
+	if !until.IsZero() && time.Now().After(until) {
+		delete(s.blockedUntil, engine)
+		return time.Time{}
+	}
+	return until
+}
+
+// block skips engine until the next local midnight, when quotas reset.
+func (s *Service) block(engine string) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	s.mu.Lock()
+	s.blockedUntil[engine] = midnight
+	s.mu.Unlock()
+}
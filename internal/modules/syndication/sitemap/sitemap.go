@@ -1,116 +1,137 @@
 package sitemap
 
 import (
+	"encoding/xml"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/modules/stats/aggregate"
 	"github.com/mx-space/core/internal/modules/system/core/configs"
 	"gorm.io/gorm"
 )
 
+// maxURLsPerSitemap is the sitemaps.org limit for one urlset. Larger sites get a
+// sitemap index at /sitemap.xml pointing to /sitemap/<n>.xml.
+const maxURLsPerSitemap = 50000
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
 func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfgSvc *configs.Service) {
 	render := func(c *gin.Context) {
-		xml, err := buildSitemap(db, cfgSvc)
+		items, err := aggregate.BuildSitemapItems(db, cfgSvc)
 		if err != nil {
 			c.String(500, "error generating sitemap")
 			return
 		}
-		c.Header("Content-Type", "application/xml; charset=utf-8")
-		c.String(200, xml)
+		if len(items) <= maxURLsPerSitemap {
+			writeXML(c, renderURLSet(items))
+			return
+		}
+		base := requestBase(c) + strings.TrimSuffix(strings.TrimSuffix(c.Request.URL.Path, ".xml"), "/sitemap") + "/sitemap/"
+		writeXML(c, renderIndex(base, chunk(items)))
 	}
 	rg.GET("/sitemap.xml", render)
 	rg.GET("/sitemap", render)
+	rg.GET("/sitemap/:page", func(c *gin.Context) {
+		page, err := strconv.Atoi(strings.TrimSuffix(c.Param("page"), ".xml"))
+		if err != nil || page < 1 {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		items, err := aggregate.BuildSitemapItems(db, cfgSvc)
+		if err != nil {
+			c.String(500, "error generating sitemap")
+			return
+		}
+		chunks := chunk(items)
+		if page > len(chunks) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		writeXML(c, renderURLSet(chunks[page-1]))
+	})
 }
 
-type sitemapURL struct {
-	Loc        string
-	LastMod    time.Time
-	ChangeFreq string
-	Priority   float64
+type urlSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	NS      string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
 }
 
-func buildSitemap(db *gorm.DB, cfgSvc *configs.Service) (string, error) {
-	cfg, err := cfgSvc.Get()
-	if err != nil {
-		return "", err
-	}
-	base := cfg.URL.WebURL
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
 
-	var urls []sitemapURL
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	NS       string         `xml:"xmlns,attr"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
 
-	urls = append(urls, sitemapURL{
-		Loc: base, LastMod: time.Now(),
-		ChangeFreq: "daily", Priority: 1.0,
-	})
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
 
-	var posts []models.PostModel
-	db.Where("is_published = ?", true).Select("slug, updated_at").Find(&posts)
-	for _, p := range posts {
-		urls = append(urls, sitemapURL{
-			Loc:        fmt.Sprintf("%s/posts/%s", base, p.Slug),
-			LastMod:    p.UpdatedAt,
-			ChangeFreq: "weekly",
-			Priority:   0.8,
-		})
+func renderURLSet(items []aggregate.SitemapItem) interface{} {
+	set := urlSet{NS: sitemapNS, URLs: make([]sitemapURL, 0, len(items))}
+	for _, item := range items {
+		set.URLs = append(set.URLs, sitemapURL{Loc: item.URL, LastMod: lastMod(item.PublishedAt)})
 	}
+	return set
+}
 
-	var notes []models.NoteModel
-	db.Where("is_published = ?", true).Select("n_id, updated_at").Find(&notes)
-	for _, n := range notes {
-		urls = append(urls, sitemapURL{
-			Loc:        fmt.Sprintf("%s/notes/%d", base, n.NID),
-			LastMod:    n.UpdatedAt,
-			ChangeFreq: "monthly",
-			Priority:   0.6,
+// renderIndex lists one sitemap per chunk. Items are sorted newest first, so the
+// first item of a chunk is its latest change.
+func renderIndex(base string, chunks [][]aggregate.SitemapItem) interface{} {
+	index := sitemapIndex{NS: sitemapNS, Sitemaps: make([]sitemapEntry, 0, len(chunks))}
+	for i, items := range chunks {
+		index.Sitemaps = append(index.Sitemaps, sitemapEntry{
+			Loc:     fmt.Sprintf("%s%d.xml", base, i+1),
+			LastMod: lastMod(items[0].PublishedAt),
 		})
 	}
+	return index
+}
 
-	var pages []models.PageModel
-	db.Select("slug, updated_at").Find(&pages)
-	for _, pg := range pages {
-		urls = append(urls, sitemapURL{
-			Loc:        fmt.Sprintf("%s/%s", base, pg.Slug),
-			LastMod:    pg.UpdatedAt,
-			ChangeFreq: "monthly",
-			Priority:   0.5,
-		})
+func chunk(items []aggregate.SitemapItem) [][]aggregate.SitemapItem {
+	var out [][]aggregate.SitemapItem
+	for len(items) > maxURLsPerSitemap {
+		out = append(out, items[:maxURLsPerSitemap])
+		items = items[maxURLsPerSitemap:]
 	}
+	return append(out, items)
+}
 
-	return renderXML(urls), nil
+// lastMod formats t as the W3C datetime sitemaps expect.
+func lastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
 }
 
-func renderXML(urls []sitemapURL) string {
-	xml := `<?xml version="1.0" encoding="UTF-8"?>
-<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
-`
-	for _, u := range urls {
-		xml += fmt.Sprintf(`  <url>
-    <loc>%s</loc>
-    <lastmod>%s</lastmod>
-    <changefreq>%s</changefreq>
-    <priority>%.1f</priority>
-  </url>
-`, escapeXML(u.Loc), u.LastMod.Format("2006-01-02"), u.ChangeFreq, u.Priority)
+func requestBase(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
 	}
-	xml += `</urlset>`
-	return xml
+	if proto := strings.TrimSpace(strings.Split(c.GetHeader("X-Forwarded-Proto"), ",")[0]); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
 }
 
-func escapeXML(s string) string {
-	out := ""
-	for _, r := range s {
-		switch r {
-		case '&':
-			out += "&amp;"
-		case '<':
-			out += "&lt;"
-		case '>':
-			out += "&gt;"
-		default:
-			out += string(r)
-		}
+func writeXML(c *gin.Context, doc interface{}) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		c.String(500, "error generating sitemap")
+		return
 	}
-	return out
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), body...))
 }
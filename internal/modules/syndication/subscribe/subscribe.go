@@ -1,16 +1,21 @@
 package subscribe
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/models"
 	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/jwt"
 	pkgmail "github.com/mx-space/core/internal/pkg/mail"
 	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
@@ -49,40 +54,59 @@ type ListQuery struct {
 	SortOrder *int    `form:"sortOrder"`
 }
 
+// verifyTokenTTL is how long a confirmation link stays valid.
+const verifyTokenTTL = 48 * time.Hour
+
+var errInvalidVerifyToken = errors.New("invalid or expired token")
+
 type Service struct{ db *gorm.DB }
 
 func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 
-func (s *Service) Subscribe(dto *SubscribeDTO) (*models.SubscribeModel, error) {
-	token := make([]byte, 16)
-	if _, err := rand.Read(token); err != nil {
-		return nil, err
+// Subscribe records dto.Email as an unconfirmed subscriber and returns the
+// signed token for its confirmation link. An existing row is left untouched
+// until the new choice of topics is confirmed, so nobody can change or
+// unconfirm someone else's subscription by resubmitting their address.
+func (s *Service) Subscribe(dto *SubscribeDTO) (string, error) {
+	cancelToken, err := newCancelToken()
+	if err != nil {
+		return "", err
 	}
-	cancelToken := hex.EncodeToString(token)
-
+	email := strings.ToLower(strings.TrimSpace(dto.Email))
 	sub := models.SubscribeModel{
-		Email:       dto.Email,
+		Email:       email,
 		CancelToken: cancelToken,
 		Subscribe:   normalizeSubscribe(dto),
 		Verified:    false,
 	}
-
-	result := s.db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "email"}},
-		DoUpdates: clause.AssignmentColumns([]string{"subscribe", "cancel_token", "verified"}),
-	}).Create(&sub)
-
-	return &sub, result.Error
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&sub).Error; err != nil {
+		return "", err
+	}
+	return signVerifyToken(email, sub.Subscribe, time.Now().Add(verifyTokenTTL)), nil
 }
 
-func (s *Service) Verify(cancelToken string) error {
-	result := s.db.Model(&models.SubscribeModel{}).
-		Where("cancel_token = ?", cancelToken).
-		Update("verified", true)
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("invalid token")
+// Verify confirms the subscription carried by a signed token, applying the
+// topics chosen when it was issued.
+func (s *Service) Verify(token string) error {
+	email, mask, err := parseVerifyToken(token)
+	if err != nil {
+		return err
 	}
-	return result.Error
+	sub, err := s.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		// Unsubscribed since the link was sent; clicking it subscribes again.
+		cancelToken, err := newCancelToken()
+		if err != nil {
+			return err
+		}
+		return s.db.Create(&models.SubscribeModel{
+			Email: email, CancelToken: cancelToken, Subscribe: mask, Verified: true,
+		}).Error
+	}
+	return s.db.Model(sub).Updates(map[string]interface{}{"subscribe": mask, "verified": true}).Error
 }
 
 func (s *Service) Unsubscribe(cancelToken string) error {
@@ -125,6 +149,34 @@ func (s *Service) GetByEmail(email string) (*models.SubscribeModel, error) {
 	return &sub, nil
 }
 
+// SubscribeCounts summarises the subscriber table for the admin list.
+type SubscribeCounts struct {
+	Total    int64            `json:"total"`
+	Verified int64            `json:"verified"`
+	Types    map[string]int64 `json:"types"` // verified subscribers per topic
+}
+
+func (s *Service) Counts() (*SubscribeCounts, error) {
+	counts := &SubscribeCounts{Types: map[string]int64{}}
+	if err := s.db.Model(&models.SubscribeModel{}).Count(&counts.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.SubscribeModel{}).Where("verified = ?", true).Count(&counts.Verified).Error; err != nil {
+		return nil, err
+	}
+	for name, bit := range subscribeTypeToBitMap {
+		if name == "all" {
+			continue
+		}
+		var n int64
+		if err := s.db.Model(&models.SubscribeModel{}).Where("verified = ? AND (subscribe & ?) != 0", true, bit).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		counts.Types[name] = n
+	}
+	return counts, nil
+}
+
 // GetSubscribers returns all verified subscribers for a given topic bit.
 func (s *Service) GetSubscribers(bit int) ([]models.SubscribeModel, error) {
 	var subs []models.SubscribeModel
@@ -165,6 +217,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g.GET("/verify", h.verify)      // ?token=...
 	g.GET("/cancel", h.unsubscribe) // ?token=...
 	g.GET("/unsubscribe", h.unsubscribe)
+	g.POST("/unsubscribe", h.unsubscribe) // RFC 8058 one-click from mail clients
 	g.DELETE("/unsubscribe/batch", authMW, h.unsubscribeBatch)
 	g.GET("", authMW, h.list)
 }
@@ -175,13 +228,7 @@ func (h *Handler) subscribe(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
-	enabled, err := h.isSubscribeEnabled()
-	if err != nil {
-		response.InternalError(c, err)
-		return
-	}
-	if !enabled {
-		response.BadRequest(c, "订阅功能未开启")
+	if !h.requireEnabled(c) {
 		return
 	}
 	mask, hasInvalidType := normalizeSubscribeWithValidation(&dto)
@@ -193,19 +240,18 @@ func (h *Handler) subscribe(c *gin.Context) {
 		response.BadRequest(c, "订阅类型不能为空")
 		return
 	}
-	sub, err := h.svc.Subscribe(&dto)
+	token, err := h.svc.Subscribe(&dto)
 	if err != nil {
 		response.InternalError(c, err)
 		return
 	}
-	if err := h.sendVerifyEmail(sub.Email, sub.CancelToken); err != nil {
+	// The token is only ever emailed: handing it back would let anyone
+	// confirm an address they don't own.
+	if err := h.sendVerifyEmail(dto.Email, token); err != nil {
 		response.InternalError(c, err)
 		return
 	}
-	response.Created(c, gin.H{
-		"email":        sub.Email,
-		"cancel_token": sub.CancelToken, // return for dev/testing
-	})
+	response.Created(c, gin.H{"email": dto.Email})
 }
 
 func (h *Handler) sendVerifyEmail(to, token string) error {
@@ -262,35 +308,39 @@ func firstNonEmpty(values ...string) string {
 }
 
 func (h *Handler) verify(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
 	token := c.Query("token")
 	if token == "" {
 		response.BadRequest(c, "missing token")
 		return
 	}
 	if err := h.svc.Verify(token); err != nil {
-		response.BadRequest(c, err.Error())
+		if errors.Is(err, errInvalidVerifyToken) {
+			response.BadRequest(c, "验证链接无效或已过期")
+			return
+		}
+		response.InternalError(c, err)
 		return
 	}
 	response.OK(c, gin.H{"message": "subscription verified"})
 }
 
 func (h *Handler) unsubscribe(c *gin.Context) {
+	if !h.requireEnabled(c) {
+		return
+	}
 	token := c.Query("token")
 	if token == "" {
 		token = c.Query("cancelToken")
 	}
-	email := c.Query("email")
-
-	var err error
-	if token != "" {
-		err = h.svc.Unsubscribe(token)
-	} else if email != "" {
-		err = h.svc.UnsubscribeByEmail(email)
-	} else {
-		response.BadRequest(c, "missing token or email")
+	// An email alone is not enough: anyone could unsubscribe anyone.
+	if token == "" {
+		response.BadRequest(c, "missing token")
 		return
 	}
-	if err != nil {
+	if err := h.svc.Unsubscribe(token); err != nil {
 		response.NotFoundMsg(c, err.Error())
 		return
 	}
@@ -316,7 +366,16 @@ func (h *Handler) list(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
-	response.Paged(c, subs, pag)
+	counts, err := h.svc.Counts()
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, gin.H{
+		"data":       subs,
+		"pagination": pag,
+		"counts":     counts,
+	})
 }
 
 func subscribeListOrders(lq ListQuery) []string {
@@ -362,7 +421,7 @@ func (h *Handler) status(c *gin.Context) {
 		"recently_c": SubscribeRecentCreateBit,
 		"all":        SubscribeAllBit,
 	}
-	allowTypes := []string{"note_c", "post_c"}
+	allowTypes := []string{"note_c", "post_c", "say_c", "recently_c"}
 	enabled, err := h.isSubscribeEnabled()
 	if err != nil {
 		response.InternalError(c, err)
@@ -372,7 +431,7 @@ func (h *Handler) status(c *gin.Context) {
 		"enable":      enabled,
 		"bit_map":     bitMap,
 		"allow_types": allowTypes,
-		"allow_bits":  []int{SubscribeNoteCreateBit, SubscribePostCreateBit},
+		"allow_bits":  []int{SubscribeNoteCreateBit, SubscribePostCreateBit, SubscribeSayCreateBit, SubscribeRecentCreateBit},
 	})
 }
 
@@ -419,6 +478,21 @@ func normalizeSubscribeWithValidation(dto *SubscribeDTO) (mask int, hasInvalidTy
 	return mask, hasInvalidType
 }
 
+// requireEnabled answers 422 and reports false while subscriptions are off,
+// so the public endpoints stay inert.
+func (h *Handler) requireEnabled(c *gin.Context) bool {
+	enabled, err := h.isSubscribeEnabled()
+	if err != nil {
+		response.InternalError(c, err)
+		return false
+	}
+	if !enabled {
+		response.UnprocessableEntity(c, "订阅功能未开启")
+		return false
+	}
+	return true
+}
+
 func (h *Handler) isSubscribeEnabled() (bool, error) {
 	if h.cfgSvc == nil {
 		return true, nil
@@ -432,3 +506,47 @@ func (h *Handler) isSubscribeEnabled() (bool, error) {
 	}
 	return cfg.FeatureList.EmailSubscribe && cfg.MailOptions.Enable, nil
 }
+
+func newCancelToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// signVerifyToken signs email, the chosen topics and an expiry into a
+// confirmation token, so nothing has to be stored until it is used.
+func signVerifyToken(email string, mask int, exp time.Time) string {
+	payload := fmt.Sprintf("%s\n%d\n%d", email, mask, exp.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(jwt.Sum("subscribe:"+payload))
+}
+
+func parseVerifyToken(token string) (email string, mask int, err error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", 0, errInvalidVerifyToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", 0, errInvalidVerifyToken
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, jwt.Sum("subscribe:"+string(raw))) {
+		return "", 0, errInvalidVerifyToken
+	}
+	parts := strings.Split(string(raw), "\n")
+	if len(parts) != 3 {
+		return "", 0, errInvalidVerifyToken
+	}
+	mask, err = strconv.Atoi(parts[1])
+	if err != nil || mask <= 0 {
+		return "", 0, errInvalidVerifyToken
+	}
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", 0, errInvalidVerifyToken
+	}
+	return parts[0], mask, nil
+}
@@ -3,6 +3,7 @@ package configs
 import (
 	"encoding/json"
 	"errors"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/config"
@@ -24,11 +25,13 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	a.PATCH("", h.patch)
 
 	// /options/:key - used by admin panel (e.g. PATCH /options/oauth)
+	// Reads mask secrets; ?reveal=true with the X-Reveal-Secrets header returns them raw.
 	opts := rg.Group("/options", authMW)
 	opts.GET("", h.getOptionsAll)
 	opts.GET("/email/template", h.getEmailTemplate)
 	opts.GET("/:key", h.getOption)
 	opts.PATCH("/:key", h.patchOption)
+	opts.POST("/validate", h.validateOptions)
 	opts.PUT("/email/template", h.putEmailTemplate)
 	opts.DELETE("/email/template", h.deleteEmailTemplate)
 	cfgLegacy := rg.Group("/config", authMW)
@@ -51,14 +54,15 @@ func (h *Handler) getPublic(c *gin.Context) {
 	})
 }
 
-// getAll returns the full config (admin only). Sensitive fields like API keys are included.
+// getAll returns the full config (admin only). Secrets are masked unless
+// ?reveal=true is confirmed with the X-Reveal-Secrets header.
 func (h *Handler) getAll(c *gin.Context) {
 	cfg, err := h.svc.Get()
 	if err != nil {
 		response.InternalError(c, err)
 		return
 	}
-	response.OK(c, cfg)
+	response.OK(c, configMap(cfg, wantsReveal(c)))
 }
 
 // patch merges a partial config update.
@@ -70,6 +74,11 @@ func (h *Handler) patch(c *gin.Context) {
 	}
 	updated, err := h.svc.Patch(partial)
 	if err != nil {
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			abortInvalidConfig(c, verr.Errors)
+			return
+		}
 		if errors.Is(err, errAIReviewProviderNotEnabled) {
 			response.BadRequest(c, "没有配置启用的 AI Provider，无法启用 AI 评论审核")
 			return
@@ -77,7 +86,7 @@ func (h *Handler) patch(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
-	response.OK(c, updated)
+	response.OK(c, configMap(updated, false))
 }
 
 // getOption returns a specific top-level config key (e.g. GET /options/oauth).
@@ -88,14 +97,8 @@ func (h *Handler) getOption(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
-	// Re-marshal and pick the key
-	full, _ := json.Marshal(cfg)
-	var m map[string]json.RawMessage
-	json.Unmarshal(full, &m)
-	if val, ok := m[key]; ok {
-		var result interface{}
-		json.Unmarshal(val, &result)
-		response.OK(c, gin.H{"data": convertMapKeys(result, snakeToCamelKey)})
+	if val, ok := configMap(cfg, wantsReveal(c))[key]; ok {
+		response.OK(c, gin.H{"data": convertMapKeys(val, snakeToCamelKey)})
 		return
 	}
 	response.NotFoundMsg(c, "设置不存在")
@@ -116,6 +119,11 @@ func (h *Handler) patchOption(c *gin.Context) {
 	}
 	updated, err := h.svc.Patch(map[string]json.RawMessage{key: normalizedBody})
 	if err != nil {
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			abortInvalidConfig(c, camelFieldErrors(verr.Errors))
+			return
+		}
 		if errors.Is(err, errAIReviewProviderNotEnabled) {
 			response.BadRequest(c, "没有配置启用的 AI Provider，无法启用 AI 评论审核")
 			return
@@ -124,16 +132,50 @@ func (h *Handler) patchOption(c *gin.Context) {
 		return
 	}
 
-	full, _ := json.Marshal(updated)
-	var m map[string]json.RawMessage
-	json.Unmarshal(full, &m)
+	m := configMap(updated, false)
 	if val, ok := m[key]; ok {
-		var result interface{}
-		json.Unmarshal(val, &result)
-		response.OK(c, convertMapKeys(result, snakeToCamelKey))
+		response.OK(c, convertMapKeys(val, snakeToCamelKey))
+		return
+	}
+	response.OK(c, convertMapKeys(m, snakeToCamelKey))
+}
+
+// validateOptions runs the PATCH checks on {section: value, ...} without saving.
+// POST /options/validate
+func (h *Handler) validateOptions(c *gin.Context) {
+	var body json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.BadRequest(c, err.Error())
 		return
 	}
-	response.OK(c, convertMapKeys(updated, snakeToCamelKey))
+	normalizedBody, err := normalizeJSONKeys(body, camelToSnakeKey)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	var partial map[string]json.RawMessage
+	if err := json.Unmarshal(normalizedBody, &partial); err != nil {
+		response.BadRequest(c, "body must be an object of config sections")
+		return
+	}
+	errs, err := h.svc.Validate(partial)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.OK(c, gin.H{"valid": len(errs) == 0, "errors": camelFieldErrors(errs)})
+}
+
+// abortInvalidConfig answers 422 with the invalid fields.
+func abortInvalidConfig(c *gin.Context, errs []FieldError) {
+	message := "设置项校验失败"
+	response.SetResponseMessage(c, message)
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+		"ok":      0,
+		"code":    http.StatusUnprocessableEntity,
+		"message": message,
+		"errors":  errs,
+	})
 }
 
 func (h *Handler) getOptionsAll(c *gin.Context) {
@@ -142,7 +184,7 @@ func (h *Handler) getOptionsAll(c *gin.Context) {
 		response.InternalError(c, err)
 		return
 	}
-	response.OK(c, convertMapKeys(cfg, snakeToCamelKey))
+	response.OK(c, convertMapKeys(configMap(cfg, wantsReveal(c)), snakeToCamelKey))
 }
 
 func (h *Handler) getFormSchema(c *gin.Context) {
@@ -0,0 +1,178 @@
+package configs
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/config"
+)
+
+const (
+	secretMask = "****"
+	// revealHeader must accompany ?reveal=true for read endpoints to return raw secrets.
+	revealHeader = "X-Reveal-Secrets"
+)
+
+// secretPaths locate secret values in the snake_case JSON form of FullConfig.
+// "*" matches every array item or object value.
+var secretPaths = [][]string{
+	{"ai", "providers", "*", "api_key"},
+	{"mail_options", "smtp", "pass"},
+	{"mail_options", "smtp", "socks5", "pass"},
+	{"mail_options", "smtp", "options", "socks5", "pass"},
+	{"mail_options", "resend", "api_key"},
+	{"s3_options", "secret_access_key"},
+	{"image_storage_options", "secret_key"},
+	{"third_party_service_integration", "github_token"},
+	{"backup_options", "passphrase"},
+	{"algolia_search_options", "api_key"},
+	{"meili_search_options", "api_key"},
+	{"baidu_search_options", "token"},
+	{"bing_search_options", "token"},
+	{"bark_options", "key"},
+	{"oauth", "secrets", "*"},
+	{"oauth", "secrets", "*", "*"},
+}
+
+// MaskSecret hides all but the first 3 and last 4 characters, e.g. "sk-****abcd".
+// Short secrets are fully masked.
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	runes := []rune(secret)
+	if len(runes) <= 12 {
+		return secretMask
+	}
+	return string(runes[:3]) + secretMask + string(runes[len(runes)-4:])
+}
+
+// IsMaskedSecret reports whether value is a placeholder produced by MaskSecret.
+func IsMaskedSecret(value string) bool {
+	return strings.Contains(value, secretMask)
+}
+
+// walkSecrets calls fn with every string found at path below v. fn returns the
+// replacement value.
+func walkSecrets(v interface{}, path []string, fn func(string) interface{}) interface{} {
+	if len(path) == 0 {
+		if s, ok := v.(string); ok {
+			return fn(s)
+		}
+		return v
+	}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if path[0] == "*" {
+			for k, child := range node {
+				node[k] = walkSecrets(child, path[1:], fn)
+			}
+		} else if child, ok := node[path[0]]; ok {
+			node[path[0]] = walkSecrets(child, path[1:], fn)
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			for i, child := range node {
+				node[i] = walkSecrets(child, path[1:], fn)
+			}
+		}
+	}
+	return v
+}
+
+// configMap returns cfg as a snake_case JSON map, with secrets masked unless reveal.
+func configMap(cfg *config.FullConfig, reveal bool) map[string]interface{} {
+	out := map[string]interface{}{}
+	raw, err := json.Marshal(cfg)
+	if err != nil || json.Unmarshal(raw, &out) != nil {
+		return out
+	}
+	if reveal {
+		return out
+	}
+	var root interface{} = out
+	for _, path := range secretPaths {
+		walkSecrets(root, path, func(s string) interface{} { return MaskSecret(s) })
+	}
+	return out
+}
+
+// wantsReveal reports whether the request asked for raw secrets and confirmed it.
+func wantsReveal(c *gin.Context) bool {
+	return c.Query("reveal") == "true" && strings.EqualFold(c.GetHeader(revealHeader), "true")
+}
+
+// restoreMaskedSecrets replaces masked placeholders sent back in a patch with the
+// stored values they stand for. Each placeholder is compared with the secret
+// stored at the same place only, so one entry's secret never ends up in
+// another. A placeholder not matching it is an error, so asterisks are never
+// saved.
+func restoreMaskedSecrets(incoming map[string]interface{}, current map[string]interface{}) []FieldError {
+	var errs []FieldError
+	for _, path := range secretPaths {
+		field := strings.Join(path, ".")
+		restoreAt(incoming, current, path, func(value, stored string, found bool) interface{} {
+			if found && stored != "" && value == MaskSecret(stored) {
+				return stored
+			}
+			if IsMaskedSecret(value) {
+				errs = append(errs, FieldError{Field: field, Message: "masked secret does not match the stored value"})
+			}
+			return value
+		})
+	}
+	return errs
+}
+
+// restoreAt walks incoming and stored together along path and replaces every
+// string found in incoming with fn's result. fn gets the stored string at the
+// same place, if any.
+func restoreAt(incoming, stored interface{}, path []string, fn func(value, stored string, found bool) interface{}) interface{} {
+	if len(path) == 0 {
+		value, ok := incoming.(string)
+		if !ok {
+			return incoming
+		}
+		storedValue, found := stored.(string)
+		return fn(value, storedValue, found)
+	}
+	switch node := incoming.(type) {
+	case map[string]interface{}:
+		storedNode, _ := stored.(map[string]interface{})
+		if path[0] == "*" {
+			for k, child := range node {
+				node[k] = restoreAt(child, storedNode[k], path[1:], fn)
+			}
+		} else if child, ok := node[path[0]]; ok {
+			node[path[0]] = restoreAt(child, storedNode[path[0]], path[1:], fn)
+		}
+	case []interface{}:
+		storedItems, _ := stored.([]interface{})
+		if path[0] == "*" {
+			for i, child := range node {
+				node[i] = restoreAt(child, storedItem(storedItems, child, i), path[1:], fn)
+			}
+		}
+	}
+	return incoming
+}
+
+// storedItem finds the stored counterpart of the i-th incoming array item:
+// the item with the same "id" when it has one, else the one at index i.
+func storedItem(items []interface{}, incoming interface{}, i int) interface{} {
+	if obj, ok := incoming.(map[string]interface{}); ok {
+		if id, ok := obj["id"].(string); ok && id != "" {
+			for _, item := range items {
+				if stored, ok := item.(map[string]interface{}); ok && stored["id"] == id {
+					return stored
+				}
+			}
+			return nil
+		}
+	}
+	if i < len(items) {
+		return items[i]
+	}
+	return nil
+}
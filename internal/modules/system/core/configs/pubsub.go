@@ -0,0 +1,140 @@
+package configs
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	redisConfigInvalidateChannel = "mx:configs:invalidate"
+	invalidateAllSections        = "*"
+	resubscribeMinBackoff        = time.Second
+	resubscribeMaxBackoff        = 30 * time.Second
+)
+
+// invalidateMessage is broadcast to every worker after a config write.
+type invalidateMessage struct {
+	Origin   string   `json:"origin"`
+	Sections []string `json:"sections"`
+}
+
+var instanceID = uuid.NewString()
+
+// publishInvalidate notifies other workers that the given sections changed.
+func (s *Service) publishInvalidate(sections []string) {
+	rc := s.redisClient()
+	if rc == nil {
+		return
+	}
+	if len(sections) == 0 {
+		sections = []string{invalidateAllSections}
+	}
+
+	data, err := json.Marshal(invalidateMessage{Origin: instanceID, Sections: sections})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisConfigVersionTimeout)
+	defer cancel()
+	if err := rc.Publish(ctx, redisConfigInvalidateChannel, string(data)); err != nil {
+		s.logger.Warn("广播配置变更失败", zap.Error(err))
+	}
+}
+
+// Subscribe listens for config invalidations from other workers until ctx is done.
+// A dropped subscription is re-established and followed by a one-time resync.
+func (s *Service) Subscribe(ctx context.Context) {
+	backoff := resubscribeMinBackoff
+	first := true
+	for {
+		rc := s.redisClient()
+		if rc == nil {
+			return
+		}
+		if !first {
+			s.logger.Info("配置变更订阅已重连，重新同步配置")
+			s.invalidateLocal()
+		}
+		first = false
+
+		if s.listenInvalidate(ctx, rc.Subscribe(ctx, redisConfigInvalidateChannel)) {
+			backoff = resubscribeMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > resubscribeMaxBackoff {
+			backoff = resubscribeMaxBackoff
+		}
+	}
+}
+
+// listenInvalidate consumes one subscription and reports whether it was ever established.
+func (s *Service) listenInvalidate(ctx context.Context, pubsub *redis.PubSub) bool {
+	defer pubsub.Close()
+
+	established := false
+	ch := pubsub.ChannelWithSubscriptions()
+	for {
+		select {
+		case <-ctx.Done():
+			return established
+		case raw, ok := <-ch:
+			if !ok {
+				return established
+			}
+			switch msg := raw.(type) {
+			case *redis.Subscription:
+				if msg.Kind != "subscribe" {
+					continue
+				}
+				// go-redis resubscribes transparently after a dropped connection;
+				// anything published in between was missed, so resync once.
+				if established {
+					s.logger.Info("配置变更订阅已重连，重新同步配置")
+					s.invalidateLocal()
+				}
+				established = true
+			case *redis.Message:
+				s.handleInvalidateMessage(msg.Payload)
+			}
+		}
+	}
+}
+
+func (s *Service) handleInvalidateMessage(payload string) {
+	var msg invalidateMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		s.logger.Warn("解析配置变更消息失败", zap.Error(err))
+		return
+	}
+	if msg.Origin == instanceID {
+		return
+	}
+	s.logger.Info("收到配置变更通知", zap.Strings("sections", msg.Sections))
+	s.invalidateLocal()
+}
+
+func changedSections(partial map[string]json.RawMessage) []string {
+	sections := make([]string, 0, len(partial))
+	for key, value := range partial {
+		if len(strings.TrimSpace(string(value))) == 0 {
+			continue
+		}
+		sections = append(sections, key)
+	}
+	sort.Strings(sections)
+	return sections
+}
@@ -118,7 +118,55 @@ func (s *Service) load() (*config.FullConfig, error) {
 }
 
 // Patch merges the given partial JSON update into the current config and persists it.
+// An update that does not fit FullConfig is rejected with a *ValidationError.
 func (s *Service) Patch(partial map[string]json.RawMessage) (*config.FullConfig, error) {
+	updated, err := s.merge(partial)
+	if err != nil {
+		return nil, err
+	}
+	if shouldEnableCommentAIReview(partial) &&
+		updated.CommentOptions.AIReview &&
+		!hasEnabledAIProvider(updated.AI.Providers) {
+		return nil, errAIReviewProviderNotEnabled
+	}
+
+	if err := s.persist(updated); err != nil {
+		return nil, err
+	}
+
+	cacheVersion := s.bumpCacheVersion()
+
+	s.mu.Lock()
+	s.cfg = updated
+	s.cacheVersion = cacheVersion
+	s.mu.Unlock()
+
+	s.publishInvalidate(changedSections(partial))
+
+	return updated, nil
+}
+
+// Validate runs the checks of Patch without persisting and returns the field
+// errors, if any.
+func (s *Service) Validate(partial map[string]json.RawMessage) ([]FieldError, error) {
+	_, err := s.merge(partial)
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return verr.Errors, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []FieldError{}, nil
+}
+
+// merge applies partial on top of the current config and validates the result.
+func (s *Service) merge(partial map[string]json.RawMessage) (*config.FullConfig, error) {
+	incoming, err := decodePartial(partial)
+	if err != nil {
+		return nil, err
+	}
+
 	current, err := s.Get()
 	if err != nil {
 		return nil, err
@@ -136,20 +184,20 @@ func (s *Service) Patch(partial map[string]json.RawMessage) (*config.FullConfig,
 		merged[key] = normalizeConfigSection(key, section)
 	}
 
-	for k, v := range partial {
-		if len(strings.TrimSpace(string(v))) == 0 {
-			continue
-		}
-		var incoming interface{}
-		if err := json.Unmarshal(v, &incoming); err != nil {
-			return nil, err
-		}
-		incoming = normalizeConfigSection(k, incoming)
+	errs := restoreMaskedSecrets(incoming, merged)
+	errs = append(errs, checkPartial(incoming)...)
+	if len(errs) > 0 {
+		return nil, newValidationError(errs)
+	}
+
+	sections := make([]string, 0, len(incoming))
+	for k, v := range incoming {
+		sections = append(sections, k)
 		if existing, ok := merged[k]; ok {
-			merged[k] = deepMergeJSON(existing, incoming)
+			merged[k] = deepMergeJSON(existing, v)
 			continue
 		}
-		merged[k] = incoming
+		merged[k] = v
 	}
 
 	mergedJSON, err := json.Marshal(merged)
@@ -161,23 +209,9 @@ func (s *Service) Patch(partial map[string]json.RawMessage) (*config.FullConfig,
 	if err := json.Unmarshal(mergedJSON, &updated); err != nil {
 		return nil, err
 	}
-	if shouldEnableCommentAIReview(partial) &&
-		updated.CommentOptions.AIReview &&
-		!hasEnabledAIProvider(updated.AI.Providers) {
-		return nil, errAIReviewProviderNotEnabled
+	if errs := validateConfig(&updated, sections); len(errs) > 0 {
+		return nil, newValidationError(errs)
 	}
-
-	if err := s.persist(&updated); err != nil {
-		return nil, err
-	}
-
-	cacheVersion := s.bumpCacheVersion()
-
-	s.mu.Lock()
-	s.cfg = &updated
-	s.cacheVersion = cacheVersion
-	s.mu.Unlock()
-
 	return &updated, nil
 }
 
@@ -198,9 +232,18 @@ func (s *Service) Invalidate() {
 	cacheVersion := s.bumpCacheVersion()
 
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	s.cfg = nil
 	s.cacheVersion = cacheVersion
+	s.mu.Unlock()
+
+	s.publishInvalidate(nil)
+}
+
+// invalidateLocal drops this worker's cached config without notifying others.
+func (s *Service) invalidateLocal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = nil
 }
 
 func (s *Service) redisClient() *pkgredis.Client {
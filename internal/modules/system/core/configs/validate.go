@@ -0,0 +1,361 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mx-space/core/internal/config"
+	pkgcron "github.com/mx-space/core/internal/pkg/cron"
+)
+
+// FieldError is one invalid field of a config update. Field is a dotted path
+// such as "comment_options.ai_review_threshold".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by Patch when the update does not fit FullConfig;
+// handlers answer it with 422 and the field list.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func newValidationError(errs []FieldError) *ValidationError {
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return &ValidationError{Errors: errs}
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid config: " + strings.Join(parts, "; ")
+}
+
+var (
+	aiReviewTypes    = map[string]bool{"binary": true, "score": true}
+	mailProviders    = map[string]bool{"smtp": true, "resend": true}
+	oauthProviders   = map[string]bool{"github": true, "google": true}
+	aiProviderTypes  = map[string]bool{"openai": true, "openai-compatible": true, "openaicompatible": true, "anthropic": true, "openrouter": true}
+	s3StorageClasses = map[string]bool{
+		"standard": true, "standard_ia": true, "onezone_ia": true, "intelligent_tiering": true,
+		"reduced_redundancy": true, "glacier": true, "glacier_ir": true, "deep_archive": true,
+	}
+	s3Encryptions = map[string]bool{"aes256": true, "aws:kms": true, "aws:kms:dsse": true}
+)
+
+// looseFields are keys the config types' UnmarshalJSON accept beyond their
+// struct fields (legacy aliases or mixed types); their values are not checked.
+var looseFields = map[reflect.Type]map[string]bool{
+	reflect.TypeOf(config.SMTPConfig{}):      {"auth": true, "host": true, "port": true, "secure": true, "socks5": true},
+	reflect.TypeOf(config.SMTPProxyConfig{}): {"username": true, "password": true},
+	reflect.TypeOf(config.ImageBedOptions{}): {"allowed_formats": true}, // string or list
+}
+
+// aiModelAssignmentType may also be given as a bare model name.
+var aiModelAssignmentType = reflect.TypeOf(config.AIModelAssignment{})
+
+// sectionTypes maps the json name of every FullConfig section to its struct type.
+var sectionTypes = func() map[string]reflect.Type {
+	out := map[string]reflect.Type{}
+	t := reflect.TypeOf(config.FullConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		out[jsonFieldName(t.Field(i))] = t.Field(i).Type
+	}
+	return out
+}()
+
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// checkPartial verifies that every section of a partial update exists and that
+// its keys and value types match the section struct. Unknown keys are errors
+// rather than being dropped on decode. Sections must already be normalized.
+func checkPartial(partial map[string]interface{}) []FieldError {
+	var errs []FieldError
+	for key, value := range partial {
+		t, ok := sectionTypes[key]
+		if !ok {
+			errs = append(errs, FieldError{Field: key, Message: "unknown config section"})
+			continue
+		}
+		checkJSONShape(key, value, t, &errs)
+	}
+	return errs
+}
+
+func checkJSONShape(path string, value interface{}, t reflect.Type, errs *[]FieldError) {
+	if value == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	mismatch := func(want string) {
+		*errs = append(*errs, FieldError{Field: path, Message: "must be " + want})
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := value.(string); ok && t == aiModelAssignmentType {
+			return
+		}
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			mismatch("an object")
+			return
+		}
+		fields := map[string]reflect.StructField{}
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && t.Field(i).Tag.Get("json") != "-" {
+				fields[jsonFieldName(t.Field(i))] = t.Field(i)
+			}
+		}
+		for key, child := range obj {
+			if looseFields[t][key] {
+				continue
+			}
+			f, ok := fields[key]
+			if !ok {
+				*errs = append(*errs, FieldError{Field: path + "." + key, Message: "unknown field"})
+				continue
+			}
+			checkJSONShape(path+"."+key, child, f.Type, errs)
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			mismatch("an object")
+			return
+		}
+		for key, child := range obj {
+			checkJSONShape(path+"."+key, child, t.Elem(), errs)
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			mismatch("an array")
+			return
+		}
+		for i, child := range items {
+			checkJSONShape(path+"."+strconv.Itoa(i), child, t.Elem(), errs)
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			mismatch("a string")
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			mismatch("a boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			mismatch("an integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(float64); !ok {
+			mismatch("a number")
+		}
+	}
+}
+
+// validateConfig runs the field-level rules of the given sections of cfg.
+func validateConfig(cfg *config.FullConfig, sections []string) []FieldError {
+	v := &configValidator{}
+	for _, section := range sections {
+		switch section {
+		case "url":
+			v.url("url.web_url", cfg.URL.WebURL, "http", "https")
+			v.url("url.admin_url", cfg.URL.AdminURL, "http", "https")
+			v.url("url.server_url", cfg.URL.ServerURL, "http", "https")
+			v.url("url.ws_url", cfg.URL.WSURL, "ws", "wss", "http", "https")
+		case "mail_options":
+			if cfg.MailOptions.Provider != "" {
+				v.oneOf("mail_options.provider", cfg.MailOptions.Provider, mailProviders)
+			}
+			if smtp := cfg.MailOptions.SMTP; smtp != nil {
+				v.port("mail_options.smtp.options.port", smtp.Options.Port)
+				if smtp.Options.Socks5 != nil {
+					v.port("mail_options.smtp.options.socks5.port", smtp.Options.Socks5.Port)
+				}
+			}
+		case "comment_options":
+			if cfg.CommentOptions.AIReviewType != "" {
+				v.oneOf("comment_options.ai_review_type", cfg.CommentOptions.AIReviewType, aiReviewTypes)
+			}
+			v.between("comment_options.ai_review_threshold", cfg.CommentOptions.AIReviewThreshold, 1, 10)
+			v.nonNegative("comment_options.min_dwell_seconds", cfg.CommentOptions.MinDwellSeconds)
+		case "backup_options":
+			if spec := strings.TrimSpace(cfg.BackupOptions.Cron); spec != "" {
+				if _, err := pkgcron.ParseExpr(spec); err != nil {
+					v.add("backup_options.cron", err.Error())
+				}
+			}
+			v.nonNegative("backup_options.retention", cfg.BackupOptions.Retention)
+			v.nonNegative("backup_options.retention_days", cfg.BackupOptions.RetentionDays)
+		case "algolia_search_options":
+			v.nonNegative("algolia_search_options.max_truncate_size", cfg.AlgoliaSearchOptions.MaxTruncateSize)
+		case "admin_extra":
+			v.url("admin_extra.waline_server_url", cfg.AdminExtra.WalineServerURL, "http", "https")
+		case "s3_options":
+			v.url("s3_options.endpoint", cfg.S3Options.Endpoint, "http", "https")
+			if cfg.S3Options.StorageClass != "" {
+				v.oneOf("s3_options.storage_class", cfg.S3Options.StorageClass, s3StorageClasses)
+			}
+			if cfg.S3Options.ServerSideEncryption != "" {
+				v.oneOf("s3_options.server_side_encryption", cfg.S3Options.ServerSideEncryption, s3Encryptions)
+			}
+		case "image_bed_options":
+			v.nonNegative("image_bed_options.max_size_mb", cfg.ImageBedOptions.MaxSizeMB)
+		case "image_storage_options":
+			if cfg.ImageStorageOptions.Endpoint != nil {
+				v.url("image_storage_options.endpoint", *cfg.ImageStorageOptions.Endpoint, "http", "https")
+			}
+		case "meili_search_options":
+			v.url("meili_search_options.host", cfg.MeiliSearchOptions.Host, "http", "https")
+			v.nonNegative("meili_search_options.search_cache_ttl", cfg.MeiliSearchOptions.SearchCacheTTL)
+		case "bark_options":
+			v.url("bark_options.server_url", cfg.BarkOptions.ServerURL, "http", "https")
+		case "ai":
+			v.aiConfig(cfg.AI)
+		case "oauth":
+			for i, p := range cfg.OAuth.Providers {
+				v.oneOf(fmt.Sprintf("oauth.providers.%d.type", i), p.Type, oauthProviders)
+			}
+		}
+	}
+	return v.errs
+}
+
+type configValidator struct {
+	errs []FieldError
+}
+
+func (v *configValidator) add(field, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+// url accepts an empty value; otherwise it must be an absolute URL with one of schemes.
+func (v *configValidator) url(field, raw string, schemes ...string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		v.add(field, "must be an absolute URL")
+		return
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return
+		}
+	}
+	v.add(field, "scheme must be one of "+strings.Join(schemes, ", "))
+}
+
+// port accepts 0 as unset.
+func (v *configValidator) port(field string, port int) {
+	if port < 0 || port > 65535 {
+		v.add(field, "must be a port between 1 and 65535")
+	}
+}
+
+func (v *configValidator) between(field string, n, min, max int) {
+	if n < min || n > max {
+		v.add(field, fmt.Sprintf("must be between %d and %d", min, max))
+	}
+}
+
+func (v *configValidator) nonNegative(field string, n int) {
+	if n < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+func (v *configValidator) oneOf(field, value string, allowed map[string]bool) {
+	if allowed[strings.ToLower(strings.TrimSpace(value))] {
+		return
+	}
+	options := make([]string, 0, len(allowed))
+	for option := range allowed {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+	v.add(field, "must be one of "+strings.Join(options, ", "))
+}
+
+func (v *configValidator) aiConfig(ai config.AIConfig) {
+	ids := map[string]bool{}
+	for i, p := range ai.Providers {
+		prefix := fmt.Sprintf("ai.providers.%d", i)
+		id := strings.TrimSpace(p.ID)
+		switch {
+		case id == "":
+			v.add(prefix+".id", "is required")
+		case ids[id]:
+			v.add(prefix+".id", "is duplicated")
+		}
+		ids[id] = true
+		providerType := strings.ReplaceAll(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(p.Type)), "_", "-"), " ", "")
+		if !aiProviderTypes[providerType] {
+			v.add(prefix+".type", "must be one of OpenAI, OpenAI-Compatible, Anthropic, OpenRouter")
+		}
+		v.url(prefix+".endpoint", p.Endpoint, "http", "https")
+	}
+	for field, assignment := range map[string]*config.AIModelAssignment{
+		"ai.summary_model":        ai.SummaryModel,
+		"ai.comment_review_model": ai.CommentReviewModel,
+	} {
+		if assignment == nil || strings.TrimSpace(assignment.ProviderID) == "" {
+			continue
+		}
+		if !ids[strings.TrimSpace(assignment.ProviderID)] {
+			v.add(field+".provider_id", "does not match any provider")
+		}
+	}
+}
+
+// camelFieldErrors rewrites field paths for the camelCase /options API.
+func camelFieldErrors(errs []FieldError) []FieldError {
+	out := make([]FieldError, len(errs))
+	for i, fe := range errs {
+		parts := strings.Split(fe.Field, ".")
+		for j, part := range parts {
+			parts[j] = snakeToCamelKey(part)
+		}
+		out[i] = FieldError{Field: strings.Join(parts, "."), Message: fe.Message}
+	}
+	return out
+}
+
+// decodePartial parses and normalizes the sections of a partial update, skipping
+// empty ones like Patch does.
+func decodePartial(partial map[string]json.RawMessage) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(partial))
+	for k, v := range partial {
+		if len(strings.TrimSpace(string(v))) == 0 {
+			continue
+		}
+		var incoming interface{}
+		if err := json.Unmarshal(v, &incoming); err != nil {
+			return nil, err
+		}
+		out[k] = normalizeConfigSection(k, incoming)
+	}
+	return out, nil
+}
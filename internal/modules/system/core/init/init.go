@@ -4,8 +4,10 @@ import (
 	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/config"
@@ -17,12 +19,28 @@ import (
 
 // Handler handles setup wizard endpoints.
 type Handler struct {
-	db     *gorm.DB
-	cfgSvc *appconfigs.Service
+	db      *gorm.DB
+	cfgSvc  *appconfigs.Service
+	reindex func() (int, error)
 }
 
-func NewHandler(db *gorm.DB, cfgSvc *appconfigs.Service) *Handler {
-	return &Handler{db: db, cfgSvc: cfgSvc}
+func NewHandler(db *gorm.DB, cfgSvc *appconfigs.Service, opts ...HandlerOption) *Handler {
+	h := &Handler{db: db, cfgSvc: cfgSvc}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// HandlerOption configures an init Handler.
+type HandlerOption func(*Handler)
+
+// WithSearchReindex sets the function that rebuilds the search index after
+// the setup restore.
+func WithSearchReindex(fn func() (int, error)) HandlerOption {
+	return func(h *Handler) {
+		h.reindex = fn
+	}
 }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
@@ -70,6 +88,11 @@ func (h *Handler) patchConfigKey(c *gin.Context) {
 	}
 	updated, err := h.cfgSvc.Patch(map[string]json.RawMessage{key: body})
 	if err != nil {
+		var verr *appconfigs.ValidationError
+		if errors.As(err, &verr) {
+			response.UnprocessableEntity(c, verr.Error())
+			return
+		}
 		response.InternalError(c, err)
 		return
 	}
@@ -126,5 +149,16 @@ func (h *Handler) restore(c *gin.Context) {
 		h.cfgSvc.Invalidate()
 	}
 
-	response.OK(c, gin.H{"message": "restore successful"})
+	result := gin.H{"message": "restore successful"}
+	if reindex, err := strconv.ParseBool(c.DefaultQuery("reindex", "true")); h.reindex != nil && (err != nil || reindex) {
+		// The restored configs may enable search, so this runs after the
+		// config cache is dropped.
+		count, err := h.reindex()
+		if err != nil {
+			result["warning"] = "搜索索引重建失败：" + err.Error()
+		} else {
+			result["reindexed"] = count
+		}
+	}
+	response.OK(c, result)
 }
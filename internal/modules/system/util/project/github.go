@@ -0,0 +1,194 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+const githubAPITimeout = 10 * time.Second
+
+var errNoGitHubRepo = errors.New("project has no github repository")
+
+// errRepoNotFound is returned by fetchRepo when GitHub answers 404.
+var errRepoNotFound = errors.New("github repository not found")
+
+var githubClient = &http.Client{Timeout: githubAPITimeout, Transport: tracing.Transport(nil)}
+
+type githubRepo struct {
+	Description     string     `json:"description"`
+	StargazersCount int        `json:"stargazers_count"`
+	ForksCount      int        `json:"forks_count"`
+	Language        string     `json:"language"`
+	PushedAt        *time.Time `json:"pushed_at"`
+}
+
+// SyncResult summarizes a SyncAllGitHub run.
+type SyncResult struct {
+	Synced  int `json:"synced"`
+	Missing int `json:"missing"`
+	Failed  int `json:"failed"`
+}
+
+// parseGitHubRepo extracts "owner/repo" from a GitHub URL or an owner/repo
+// shorthand. It returns "" for anything else.
+func parseGitHubRepo(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	path := raw
+	if strings.Contains(raw, "://") || strings.HasPrefix(raw, "github.com/") {
+		if !strings.Contains(raw, "://") {
+			raw = "https://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return ""
+		}
+		host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		if host != "github.com" {
+			return ""
+		}
+		path = u.Path
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+	return parts[0] + "/" + strings.TrimSuffix(parts[1], ".git")
+}
+
+// repoOf returns the GitHub repository of p, preferring RepoURL and falling
+// back to ProjectURL when it points at GitHub.
+func repoOf(p *models.ProjectModel) string {
+	if repo := parseGitHubRepo(p.RepoURL); repo != "" {
+		return repo
+	}
+	if strings.Contains(strings.ToLower(p.ProjectURL), "github.com/") {
+		return parseGitHubRepo(p.ProjectURL)
+	}
+	return ""
+}
+
+func (s *Service) githubToken() string {
+	if s.cfgSvc == nil {
+		return ""
+	}
+	cfg, err := s.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return ""
+	}
+	return strings.TrimSpace(cfg.ThirdPartyServiceIntegration.GitHubToken)
+}
+
+func (s *Service) fetchRepo(ctx context.Context, repo, token string) (*githubRepo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/repos/"+repo, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errRepoNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("github api returned %d", resp.StatusCode)
+	}
+	var out githubRepo
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// syncProject refreshes p from GitHub. A repository that no longer exists is
+// flagged as missing rather than reported as an error.
+func (s *Service) syncProject(ctx context.Context, p *models.ProjectModel, token string) (missing bool, err error) {
+	repo := repoOf(p)
+	if repo == "" {
+		return false, errNoGitHubRepo
+	}
+	now := time.Now()
+	updates := map[string]interface{}{"repo_synced_at": &now}
+
+	info, err := s.fetchRepo(ctx, repo, token)
+	switch {
+	case errors.Is(err, errRepoNotFound):
+		missing = true
+		updates["repo_missing"] = true
+	case err != nil:
+		return false, err
+	default:
+		updates["repo_missing"] = false
+		updates["stars"] = info.StargazersCount
+		updates["forks"] = info.ForksCount
+		updates["language"] = info.Language
+		updates["pushed_at"] = info.PushedAt
+		if strings.TrimSpace(p.Description) == "" && info.Description != "" {
+			updates["description"] = info.Description
+		}
+	}
+	return missing, s.db.Model(p).Updates(updates).Error
+}
+
+// SyncGitHub refreshes one project from GitHub and returns the updated row,
+// or nil when the project does not exist.
+func (s *Service) SyncGitHub(ctx context.Context, id string) (*models.ProjectModel, error) {
+	p, err := s.GetByID(id)
+	if err != nil || p == nil {
+		return p, err
+	}
+	if _, err := s.syncProject(ctx, p, s.githubToken()); err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// SyncAllGitHub refreshes every project linked to a GitHub repository. One
+// failing project does not stop the rest of the batch.
+func (s *Service) SyncAllGitHub(ctx context.Context) (SyncResult, error) {
+	var result SyncResult
+	var items []models.ProjectModel
+	if err := s.db.Find(&items).Error; err != nil {
+		return result, err
+	}
+	token := s.githubToken()
+	for i := range items {
+		p := &items[i]
+		if repoOf(p) == "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		missing, err := s.syncProject(ctx, p, token)
+		if err != nil {
+			s.logger.Warn("同步 GitHub 项目信息失败", zap.String("project", p.Name), zap.Error(err))
+			result.Failed++
+			continue
+		}
+		if missing {
+			result.Missing++
+		} else {
+			result.Synced++
+		}
+	}
+	return result, nil
+}
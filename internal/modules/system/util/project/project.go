@@ -3,12 +3,15 @@ package project
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/models"
+	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
 	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
@@ -21,6 +24,7 @@ type CreateProjectDTO struct {
 	Images      []string `json:"images"`
 	Avatar      string   `json:"avatar"`
 	Text        string   `json:"text"`
+	RepoURL     string   `json:"repo_url"`
 }
 
 type UpdateProjectDTO struct {
@@ -32,6 +36,12 @@ type UpdateProjectDTO struct {
 	Images      []string `json:"images"`
 	Avatar      *string  `json:"avatar"`
 	Text        *string  `json:"text"`
+	RepoURL     *string  `json:"repo_url"`
+}
+
+type ListQuery struct {
+	SortBy    *string `form:"sortBy"`
+	SortOrder *int    `form:"sortOrder"`
 }
 
 type projectResponse struct {
@@ -44,6 +54,13 @@ type projectResponse struct {
 	Images      []string   `json:"images"`
 	Avatar      string     `json:"avatar"`
 	Text        string     `json:"text"`
+	RepoURL     string     `json:"repo_url"`
+	Stars       int        `json:"stars"`
+	Forks       int        `json:"forks"`
+	Language    string     `json:"language"`
+	PushedAt    *time.Time `json:"pushed_at"`
+	RepoMissing bool       `json:"repo_missing"`
+	SyncedAt    *time.Time `json:"repo_synced_at"`
 	Created     time.Time  `json:"created"`
 	Modified    *time.Time `json:"modified"`
 }
@@ -58,24 +75,69 @@ func toResponse(p *models.ProjectModel) projectResponse {
 		ID: p.ID, Name: p.Name, Description: p.Description,
 		PreviewURL: p.PreviewURL, DocURL: p.DocURL, ProjectURL: p.ProjectURL,
 		Images: images, Avatar: p.Avatar, Text: p.Text,
+		RepoURL: p.RepoURL, Stars: p.Stars, Forks: p.Forks, Language: p.Language,
+		PushedAt: p.PushedAt, RepoMissing: p.RepoMissing, SyncedAt: p.RepoSyncedAt,
 		Created: p.CreatedAt, Modified: modified,
 	}
 }
 
-type Service struct{ db *gorm.DB }
+// listOrder maps ?sortBy=star|created and ?sortOrder=1 (ascending) to an
+// ORDER BY clause, newest first by default.
+func listOrder(lq ListQuery) string {
+	direction := "DESC"
+	if lq.SortOrder != nil && *lq.SortOrder == 1 {
+		direction = "ASC"
+	}
+	if lq.SortBy != nil {
+		switch strings.ToLower(strings.TrimSpace(*lq.SortBy)) {
+		case "star", "stars":
+			return "stars " + direction + ", created_at DESC"
+		}
+	}
+	return "created_at " + direction
+}
+
+type Service struct {
+	db     *gorm.DB
+	cfgSvc *appconfigs.Service
+	logger *zap.Logger
+}
+
+func NewService(db *gorm.DB, opts ...ServiceOption) *Service {
+	s := &Service{db: db, logger: zap.NewNop()}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// ServiceOption configures a project Service.
+type ServiceOption func(*Service)
 
-func NewService(db *gorm.DB) *Service { return &Service{db: db} }
+// WithConfig lets GitHub syncs authenticate with the configured GitHubToken.
+func WithConfig(cfgSvc *appconfigs.Service) ServiceOption {
+	return func(s *Service) { s.cfgSvc = cfgSvc }
+}
 
-func (s *Service) List(q pagination.Query) ([]models.ProjectModel, response.Pagination, error) {
-	tx := s.db.Model(&models.ProjectModel{}).Order("created_at DESC")
+// WithLogger sets the logger for the project service.
+func WithLogger(l *zap.Logger) ServiceOption {
+	return func(s *Service) {
+		if l != nil {
+			s.logger = l.Named("ProjectService")
+		}
+	}
+}
+
+func (s *Service) List(q pagination.Query, lq ListQuery) ([]models.ProjectModel, response.Pagination, error) {
+	tx := s.db.Model(&models.ProjectModel{}).Order(listOrder(lq))
 	var items []models.ProjectModel
 	pag, err := pagination.Paginate(tx, q, &items)
 	return items, pag, err
 }
 
-func (s *Service) ListAll() ([]models.ProjectModel, error) {
+func (s *Service) ListAll(lq ListQuery) ([]models.ProjectModel, error) {
 	var items []models.ProjectModel
-	err := s.db.Order("created_at DESC").Find(&items).Error
+	err := s.db.Order(listOrder(lq)).Find(&items).Error
 	return items, err
 }
 
@@ -100,6 +162,7 @@ func (s *Service) Create(dto *CreateProjectDTO) (*models.ProjectModel, error) {
 		Name: dto.Name, Description: dto.Description,
 		PreviewURL: dto.PreviewURL, DocURL: dto.DocURL, ProjectURL: dto.ProjectURL,
 		Images: models.StringArray(dto.Images), Avatar: dto.Avatar, Text: dto.Text,
+		RepoURL: strings.TrimSpace(dto.RepoURL),
 	}
 	return &p, s.db.Create(&p).Error
 }
@@ -134,6 +197,10 @@ func (s *Service) Update(id string, dto *UpdateProjectDTO) (*models.ProjectModel
 	if dto.Text != nil {
 		updates["text"] = *dto.Text
 	}
+	if dto.RepoURL != nil {
+		updates["repo_url"] = strings.TrimSpace(*dto.RepoURL)
+		updates["repo_missing"] = false
+	}
 	return p, s.db.Model(p).Updates(updates).Error
 }
 
@@ -153,6 +220,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 
 	a := g.Group("", authMW)
 	a.POST("", h.create)
+	a.POST("/:id/sync-github", h.syncGitHub)
 	a.PUT("/:id", h.update)
 	a.PATCH("/:id", h.patch)
 	a.DELETE("/:id", h.delete)
@@ -160,7 +228,9 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 
 func (h *Handler) list(c *gin.Context) {
 	q := pagination.FromContext(c)
-	items, pag, err := h.svc.List(q)
+	var lq ListQuery
+	_ = c.ShouldBindQuery(&lq)
+	items, pag, err := h.svc.List(q, lq)
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -173,7 +243,9 @@ func (h *Handler) list(c *gin.Context) {
 }
 
 func (h *Handler) listAll(c *gin.Context) {
-	items, err := h.svc.ListAll()
+	var lq ListQuery
+	_ = c.ShouldBindQuery(&lq)
+	items, err := h.svc.ListAll(lq)
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -259,3 +331,21 @@ func (h *Handler) delete(c *gin.Context) {
 	}
 	response.NoContent(c)
 }
+
+// POST /projects/:id/sync-github — refresh stars, forks, language and last push
+func (h *Handler) syncGitHub(c *gin.Context) {
+	p, err := h.svc.SyncGitHub(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, errNoGitHubRepo) {
+			response.UnprocessableEntity(c, "项目未关联 GitHub 仓库")
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	if p == nil {
+		response.NotFoundMsg(c, "项目不存在")
+		return
+	}
+	response.OK(c, toResponse(p))
+}
@@ -2,18 +2,34 @@ package slugtracker
 
 import (
 	"errors"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mx-space/core/internal/models"
+	appconfigs "github.com/mx-space/core/internal/modules/system/core/configs"
+	"github.com/mx-space/core/internal/pkg/pagination"
 	"github.com/mx-space/core/internal/pkg/response"
 	"gorm.io/gorm"
 )
 
 // Service provides slug tracking operations.
-type Service struct{ db *gorm.DB }
+type Service struct {
+	db     *gorm.DB
+	cfgSvc *appconfigs.Service
+}
 
 func NewService(db *gorm.DB) *Service { return &Service{db: db} }
 
+// SetConfigService makes redirects absolute, on the configured web URL (optional).
+func (s *Service) SetConfigService(cfgSvc *appconfigs.Service) { s.cfgSvc = cfgSvc }
+
+// PostPath is the tracked slug of a post, "/<category>/<slug>", since moving a
+// post to another category changes its URL too.
+func PostPath(categorySlug, slug string) string {
+	return "/" + categorySlug + "/" + slug
+}
+
 // Track records that oldSlug for the given content type now points to targetID.
 func (s *Service) Track(oldSlug, refType, targetID string) error {
 	tracker := models.SlugTrackerModel{
@@ -40,6 +56,104 @@ func (s *Service) FindBySlug(slug, refType string) (string, error) {
 	return tracker.TargetID, nil
 }
 
+// Untrack removes trackers for slugs that live content now occupies again, so
+// that content never redirects away from itself.
+func (s *Service) Untrack(refType string, slugs ...string) error {
+	if len(slugs) == 0 {
+		return nil
+	}
+	return s.db.Where("type = ? AND slug IN ?", refType, slugs).Delete(&models.SlugTrackerModel{}).Error
+}
+
+// Resolve returns the current canonical URL of the content the first tracked
+// slug points to, or "" when none is tracked or the target is gone.
+func (s *Service) Resolve(refType string, slugs ...string) (string, error) {
+	for _, slug := range slugs {
+		targetID, err := s.FindBySlug(slug, refType)
+		if err != nil {
+			return "", err
+		}
+		if targetID == "" {
+			continue
+		}
+		path, err := s.canonicalPath(refType, targetID)
+		if err != nil || path == "" {
+			return "", err
+		}
+		return s.webURL() + path, nil
+	}
+	return "", nil
+}
+
+// RedirectIfTracked answers with a 301 to where a tracked slug moved and
+// reports whether it did. Lookup errors count as untracked.
+func (s *Service) RedirectIfTracked(c *gin.Context, refType string, slugs ...string) bool {
+	if s == nil {
+		return false
+	}
+	location, err := s.Resolve(refType, slugs...)
+	if err != nil || location == "" {
+		return false
+	}
+	c.Redirect(http.StatusMovedPermanently, location)
+	return true
+}
+
+func (s *Service) canonicalPath(refType, targetID string) (string, error) {
+	switch refType {
+	case "post":
+		var post models.PostModel
+		if err := s.db.Preload("Category").Select("id, slug, category_id").
+			Where("id = ? AND is_published = ?", targetID, true).
+			Limit(1).Find(&post).Error; err != nil {
+			return "", err
+		}
+		if post.ID == "" || post.Category == nil {
+			return "", nil
+		}
+		return "/posts" + PostPath(post.Category.Slug, post.Slug), nil
+	case "page":
+		var page models.PageModel
+		if err := s.db.Select("id, slug").Where("id = ?", targetID).
+			Limit(1).Find(&page).Error; err != nil {
+			return "", err
+		}
+		if page.ID == "" {
+			return "", nil
+		}
+		return "/" + page.Slug, nil
+	}
+	return "", nil
+}
+
+func (s *Service) webURL() string {
+	if s.cfgSvc == nil {
+		return ""
+	}
+	cfg, err := s.cfgSvc.Get()
+	if err != nil || cfg == nil {
+		return ""
+	}
+	return strings.TrimRight(cfg.URL.WebURL, "/")
+}
+
+// List pages through trackers, newest first, optionally of one type.
+func (s *Service) List(q pagination.Query, refType string) ([]models.SlugTrackerModel, response.Pagination, error) {
+	tx := s.db.Model(&models.SlugTrackerModel{}).Order("created_at DESC")
+	if refType != "" {
+		tx = tx.Where("type = ?", refType)
+	}
+	var trackers []models.SlugTrackerModel
+	pag, err := pagination.Paginate(tx, q, &trackers)
+	return trackers, pag, err
+}
+
+// Delete removes one tracker, reporting whether it existed.
+func (s *Service) Delete(id string) (bool, error) {
+	result := s.db.Delete(&models.SlugTrackerModel{}, "id = ?", id)
+	return result.RowsAffected > 0, result.Error
+}
+
 // DeleteByTargetID removes all tracker entries for a given content item.
 func (s *Service) DeleteByTargetID(targetID string) error {
 	return s.db.Where("target_id = ?", targetID).Delete(&models.SlugTrackerModel{}).Error
@@ -54,6 +168,34 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, authMW gin.HandlerFunc) {
 	g.GET("/redirect/:type/:slug", h.redirect)
 	g.GET("/:type/:slug", authMW, h.lookup)
 	g.DELETE("/:type/:slug", authMW, h.remove)
+
+	a := rg.Group("/slug-trackers", authMW)
+	a.GET("", h.list)
+	a.DELETE("/:id", h.delete)
+}
+
+// GET /slug-trackers?type= — paginated trackers for manual cleanup
+func (h *Handler) list(c *gin.Context) {
+	trackers, pag, err := h.svc.List(pagination.FromContext(c), c.Query("type"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.Paged(c, trackers, pag)
+}
+
+// DELETE /slug-trackers/:id
+func (h *Handler) delete(c *gin.Context) {
+	found, err := h.svc.Delete(c.Param("id"))
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	if !found {
+		response.NotFoundMsg(c, "记录不存在")
+		return
+	}
+	response.NoContent(c)
 }
 
 // GET /slug-tracker/redirect/:type/:slug — public redirect lookup
@@ -1,7 +1,6 @@
 package crontask
 
 import (
-	"encoding/json"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -67,7 +66,10 @@ func (h *Handler) run(c *gin.Context) {
 
 // GET /cron-task/tasks
 func (h *Handler) listTasks(c *gin.Context) {
-	q := pagination.FromContext(c)
+	q, ok := pagination.FromContextWithCursor(c)
+	if !ok {
+		return
+	}
 	taskType := c.Query("type")
 	statusStr := c.Query("status")
 
@@ -81,6 +83,16 @@ func (h *Handler) listTasks(c *gin.Context) {
 		statusPtr = &s
 	}
 
+	if q.Cursor != nil {
+		tasks, pag, err := h.taskSvc.ListAfter(c.Request.Context(), q, taskTypePtr, statusPtr)
+		if err != nil {
+			response.InternalError(c, err)
+			return
+		}
+		response.CursorPaged(c, tasks, pag)
+		return
+	}
+
 	tasks, total, err := h.taskSvc.List(c.Request.Context(), q.Page, q.Size, taskTypePtr, statusPtr)
 	if err != nil {
 		response.InternalError(c, err)
@@ -126,13 +138,7 @@ func (h *Handler) retryTask(c *gin.Context) {
 		response.NotFoundMsg(c, "任务不存在")
 		return
 	}
-	// Re-enqueue with same type + payload, clearing dedupKey
-	var rawPayload interface{}
-	if err := json.Unmarshal(task.Payload, &rawPayload); err != nil {
-		response.BadRequest(c, "invalid task payload")
-		return
-	}
-	newTask, err := h.taskSvc.Enqueue(c.Request.Context(), task.Type, rawPayload, "", task.GroupKey)
+	newTask, err := h.taskSvc.Retry(c.Request.Context(), task)
 	if err != nil {
 		response.InternalError(c, err)
 		return
@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"os/signal"
 	"runtime"
+	"sort"
 	"strconv"
 	"syscall"
 	"time"
@@ -17,9 +18,10 @@ import (
 )
 
 type workerExit struct {
-	id   int
-	pid  int
-	code int
+	id    int
+	pid   int
+	code  int
+	cause string
 }
 
 // Run starts cluster mode when enabled; otherwise runs workerMain directly.
@@ -38,10 +40,26 @@ func Run(logger *zap.Logger, opts Options, workerMain func() error) error {
 	if IsWorker() {
 		return workerMain()
 	}
+	if !ShouldLogBootstrap() {
+		logger = quietLogger(logger)
+	}
 
 	return runMaster(logger, opts.Workers)
 }
 
+// workerProc is a running worker process with its table row.
+type workerProc struct {
+	cmd  *exec.Cmd
+	info WorkerInfo
+}
+
+// rollResult reports whether a replacement started by a rolling restart is serving.
+type rollResult struct {
+	id   int
+	proc *workerProc
+	err  error
+}
+
 func runMaster(logger *zap.Logger, requestedWorkers int) error {
 	workerCount := normalizedWorkers(requestedWorkers)
 	if logger != nil {
@@ -52,15 +70,36 @@ func runMaster(logger *zap.Logger, requestedWorkers int) error {
 		)
 	}
 
+	statePath := stateFilePath()
+	defer os.Remove(statePath)
+
 	exitCh := make(chan workerExit, workerCount*2)
-	workers := make(map[int]*exec.Cmd, workerCount)
+	respawnCh := make(chan int, workerCount)
+	rollCh := make(chan rollResult, 1)
+	// drainCh carries retired workers whose drain window has run out.
+	drainCh := make(chan *exec.Cmd, workerCount)
+	workers := make(map[int]*workerProc, workerCount)
+	// retired holds replaced or rejected workers that are still shutting down.
+	retired := make(map[*exec.Cmd]int)
+	guard := newCrashGuard()
+	restarts := make(map[int]int, workerCount)
+
+	saveState := func() {
+		table := make(map[int]WorkerInfo, len(workers))
+		for id, proc := range workers {
+			table[id] = proc.info
+		}
+		if err := writeState(statePath, table); err != nil && logger != nil {
+			logger.Warn("failed to write cluster state", zap.Error(err))
+		}
+	}
 
-	startWorker := func(id int) error {
-		cmd, err := spawnWorker(id)
+	startWorker := func(id int, waitReady bool) (*workerProc, <-chan error, error) {
+		cmd, ready, err := spawnWorker(id, statePath, waitReady)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		workers[id] = cmd
+		proc := &workerProc{cmd: cmd, info: WorkerInfo{ID: id, PID: cmd.Process.Pid, StartedAt: time.Now()}}
 
 		if logger != nil {
 			logger.Info("worker started", zap.Int("worker_id", id), zap.Int("pid", cmd.Process.Pid))
@@ -69,76 +108,238 @@ func runMaster(logger *zap.Logger, requestedWorkers int) error {
 		go func(workerID int, processID int, c *exec.Cmd) {
 			err := c.Wait()
 			exitCh <- workerExit{
-				id:   workerID,
-				pid:  processID,
-				code: exitCode(err),
+				id:    workerID,
+				pid:   processID,
+				code:  exitCode(err),
+				cause: exitCause(err),
 			}
 		}(id, cmd.Process.Pid, cmd)
 
-		return nil
+		return proc, ready, nil
+	}
+
+	allCmds := func() map[int]*exec.Cmd {
+		out := make(map[int]*exec.Cmd, len(workers))
+		for id, proc := range workers {
+			out[id] = proc.cmd
+		}
+		return out
 	}
 
 	for i := 1; i <= workerCount; i++ {
-		if err := startWorker(i); err != nil {
-			killAllWorkers(workers, nil)
+		proc, _, err := startWorker(i, false)
+		if err != nil {
+			killAllWorkers(allCmds(), nil)
 			return err
 		}
+		workers[i] = proc
 	}
+	saveState()
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(sigCh)
 
+	// SIGHUP is passed on so every worker reloads config.yml.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	// SIGUSR2 replaces the workers one at a time.
+	usr2Ch := make(chan os.Signal, 1)
+	signal.Notify(usr2Ch, syscall.SIGUSR2)
+	defer signal.Stop(usr2Ch)
+
 	stopping := false
 	var killTimer <-chan time.Time
+	var rollQueue []int
+	var rolling *workerProc
+	// respawning counts exited workers waiting out their backoff.
+	respawning := 0
+
+	rollNext := func() {
+		for len(rollQueue) > 0 {
+			id := rollQueue[0]
+			rollQueue = rollQueue[1:]
+			if _, ok := workers[id]; !ok {
+				continue
+			}
+			proc, ready, err := startWorker(id, true)
+			if err != nil {
+				if logger != nil {
+					logger.Warn("rolling restart aborted", zap.Int("worker_id", id), zap.Error(err))
+				}
+				rollQueue = nil
+				return
+			}
+			rolling = proc
+			go func() {
+				select {
+				case err := <-ready:
+					rollCh <- rollResult{id: id, proc: proc, err: err}
+				case <-time.After(ReadyTimeout):
+					rollCh <- rollResult{id: id, proc: proc, err: fmt.Errorf("not ready after %s", ReadyTimeout)}
+				}
+			}()
+			return
+		}
+		if logger != nil {
+			logger.Info("rolling restart finished")
+		}
+	}
 
-	for len(workers) > 0 {
+	for len(workers) > 0 || len(retired) > 0 || rolling != nil || (respawning > 0 && !stopping) {
 		select {
 		case sig := <-sigCh:
 			if stopping {
 				continue
 			}
 			stopping = true
+			rollQueue = nil
 			if logger != nil {
 				logger.Info("cluster shutting down", zap.String("signal", sig.String()))
 			}
-			interruptAllWorkers(workers, logger)
-			killTimer = time.After(8 * time.Second)
+			interruptAllWorkers(allCmds(), logger)
+			if rolling != nil {
+				interruptAllWorkers(map[int]*exec.Cmd{rolling.info.ID: rolling.cmd}, logger)
+			}
+			killTimer = time.After(DrainTimeout + drainGrace)
+
+		case <-hupCh:
+			if !stopping {
+				signalAllWorkers(allCmds(), syscall.SIGHUP, logger)
+			}
+
+		case <-usr2Ch:
+			if stopping {
+				continue
+			}
+			if rolling != nil || len(rollQueue) > 0 {
+				if logger != nil {
+					logger.Warn("rolling restart already in progress")
+				}
+				continue
+			}
+			for id := range workers {
+				rollQueue = append(rollQueue, id)
+			}
+			sort.Ints(rollQueue)
+			if logger != nil {
+				logger.Info("rolling restart started", zap.Int("workers", len(rollQueue)))
+			}
+			rollNext()
+
+		case res := <-rollCh:
+			if rolling != res.proc {
+				continue
+			}
+			rolling = nil
+			if stopping {
+				continue
+			}
+			if res.err != nil {
+				if logger != nil {
+					logger.Warn("replacement worker is not ready, keeping the old one",
+						zap.Int("worker_id", res.id), zap.Int("pid", res.proc.info.PID), zap.Error(res.err))
+				}
+				_ = res.proc.cmd.Process.Kill()
+				rollQueue = nil
+				continue
+			}
+			if old, ok := workers[res.id]; ok {
+				// The old worker stops accepting and finishes in-flight
+				// requests; the new one already shares the port.
+				res.proc.info.Restarts = old.info.Restarts + 1
+				retired[old.cmd] = res.id
+				interruptAllWorkers(map[int]*exec.Cmd{res.id: old.cmd}, logger)
+				time.AfterFunc(DrainTimeout+drainGrace, func() { drainCh <- old.cmd })
+			}
+			workers[res.id] = res.proc
+			saveState()
+			rollNext()
+
+		case id := <-respawnCh:
+			respawning--
+			if stopping {
+				continue
+			}
+			if _, ok := workers[id]; ok {
+				continue
+			}
+			proc, _, err := startWorker(id, false)
+			if err != nil {
+				interruptAllWorkers(allCmds(), logger)
+				killAllWorkers(allCmds(), logger)
+				return err
+			}
+			proc.info.Restarts = restarts[id]
+			workers[id] = proc
+			saveState()
+
+		case cmd := <-drainCh:
+			if id, ok := retired[cmd]; ok {
+				if logger != nil {
+					logger.Warn("retired worker did not drain in time", zap.Int("worker_id", id), zap.Int("pid", cmd.Process.Pid))
+				}
+				killAllWorkers(map[int]*exec.Cmd{id: cmd}, logger)
+			}
 
 		case <-killTimer:
-			killAllWorkers(workers, logger)
+			killAllWorkers(allCmds(), logger)
+			for cmd, id := range retired {
+				killAllWorkers(map[int]*exec.Cmd{id: cmd}, logger)
+			}
+			if rolling != nil {
+				killAllWorkers(map[int]*exec.Cmd{rolling.info.ID: rolling.cmd}, logger)
+			}
 			killTimer = nil
 
 		case ex := <-exitCh:
-			cmd, ok := workers[ex.id]
-			if !ok || cmd == nil || cmd.Process == nil {
+			for cmd := range retired {
+				if cmd.Process.Pid == ex.pid {
+					delete(retired, cmd)
+				}
+			}
+			proc, ok := workers[ex.id]
+			if !ok || proc.cmd == nil || proc.cmd.Process == nil {
 				continue
 			}
-			if cmd.Process.Pid != ex.pid {
+			if proc.cmd.Process.Pid != ex.pid {
 				continue
 			}
 			delete(workers, ex.id)
 
 			if logger != nil {
 				if ex.code == 0 {
-					logger.Info("worker exited", zap.Int("worker_id", ex.id), zap.Int("pid", ex.pid), zap.Int("code", ex.code))
+					logger.Info("worker exited", zap.Int("worker_id", ex.id), zap.Int("pid", ex.pid), zap.Int("code", ex.code), zap.String("cause", ex.cause))
 				} else {
-					logger.Warn("worker exited", zap.Int("worker_id", ex.id), zap.Int("pid", ex.pid), zap.Int("code", ex.code))
+					logger.Warn("worker exited", zap.Int("worker_id", ex.id), zap.Int("pid", ex.pid), zap.Int("code", ex.code), zap.String("cause", ex.cause))
 				}
 			}
 
 			if stopping {
 				continue
 			}
+			saveState()
 
-			if ex.code != 0 {
+			restarts[ex.id] = proc.info.Restarts + 1
+			recent := guard.record(ex.id, time.Now())
+			if recent >= crashLoopLimit {
 				if logger != nil {
-					logger.Warn("worker crashed, restarting", zap.Int("worker_id", ex.id))
-				}
-				if err := startWorker(ex.id); err != nil {
-					return err
+					logger.Error("worker is crash looping, giving up",
+						zap.Int("worker_id", ex.id), zap.Int("exits", recent), zap.Duration("window", crashLoopWindow))
 				}
+				interruptAllWorkers(allCmds(), logger)
+				killAllWorkers(allCmds(), logger)
+				return fmt.Errorf("worker %d exited %d times within %s", ex.id, recent, crashLoopWindow)
+			}
+			delay := respawnDelay(recent)
+			if logger != nil {
+				logger.Warn("worker exited unexpectedly, restarting",
+					zap.Int("worker_id", ex.id), zap.Int("restarts", restarts[ex.id]), zap.Duration("backoff", delay))
 			}
+			respawning++
+			time.AfterFunc(delay, func() { respawnCh <- ex.id })
 		}
 	}
 
@@ -148,10 +349,10 @@ func runMaster(logger *zap.Logger, requestedWorkers int) error {
 	return nil
 }
 
-func spawnWorker(id int) (*exec.Cmd, error) {
+func spawnWorker(id int, statePath string, waitReady bool) (*exec.Cmd, <-chan error, error) {
 	executable, err := os.Executable()
 	if err != nil {
-		return nil, fmt.Errorf("resolve executable: %w", err)
+		return nil, nil, fmt.Errorf("resolve executable: %w", err)
 	}
 
 	args := append([]string{}, os.Args[1:]...)
@@ -160,17 +361,46 @@ func spawnWorker(id int) (*exec.Cmd, error) {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = workerEnv(os.Environ(), id)
+	cmd.Env = append(cmd.Env, EnvStateFile+"="+statePath)
+
+	var readR, readW *os.File
+	if waitReady {
+		if readR, readW, err = os.Pipe(); err != nil {
+			return nil, nil, fmt.Errorf("create ready pipe for worker %d: %w", id, err)
+		}
+		cmd.ExtraFiles = []*os.File{readW}
+		cmd.Env = append(cmd.Env, EnvReadyFD+"=3")
+	}
 
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("start worker %d: %w", id, err)
+		if readR != nil {
+			readR.Close()
+			readW.Close()
+		}
+		return nil, nil, fmt.Errorf("start worker %d: %w", id, err)
+	}
+	if readR == nil {
+		return cmd, nil, nil
 	}
-	return cmd, nil
+
+	readW.Close()
+	ready := make(chan error, 1)
+	go func() {
+		defer readR.Close()
+		buf := make([]byte, 1)
+		if _, err := readR.Read(buf); err != nil {
+			ready <- fmt.Errorf("worker exited before it was ready: %w", err)
+			return
+		}
+		ready <- nil
+	}()
+	return cmd, ready, nil
 }
 
 func workerEnv(base []string, id int) []string {
 	env := make([]string, 0, len(base)+2)
 	for _, kv := range base {
-		if hasEnvKey(kv, EnvRole) || hasEnvKey(kv, EnvWorkerID) {
+		if hasEnvKey(kv, EnvRole) || hasEnvKey(kv, EnvWorkerID) || hasEnvKey(kv, EnvStateFile) || hasEnvKey(kv, EnvReadyFD) {
 			continue
 		}
 		env = append(env, kv)
@@ -201,6 +431,17 @@ func interruptAllWorkers(workers map[int]*exec.Cmd, logger *zap.Logger) {
 	}
 }
 
+func signalAllWorkers(workers map[int]*exec.Cmd, sig os.Signal, logger *zap.Logger) {
+	for id, cmd := range workers {
+		if cmd == nil || cmd.Process == nil {
+			continue
+		}
+		if err := cmd.Process.Signal(sig); err != nil && logger != nil {
+			logger.Warn("failed to forward signal to worker", zap.Int("worker_id", id), zap.Int("pid", cmd.Process.Pid), zap.String("signal", sig.String()), zap.Error(err))
+		}
+	}
+}
+
 func killAllWorkers(workers map[int]*exec.Cmd, logger *zap.Logger) {
 	for id, cmd := range workers {
 		if cmd == nil || cmd.Process == nil {
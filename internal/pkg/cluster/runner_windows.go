@@ -26,9 +26,10 @@ import (
 )
 
 type workerExit struct {
-	id   int
-	pid  int
-	code int
+	id    int
+	pid   int
+	code  int
+	cause string
 }
 
 // Run starts cluster mode when enabled; otherwise runs workerMain directly.
@@ -46,6 +47,9 @@ func Run(logger *zap.Logger, opts Options, workerMain func() error) error {
 	if IsWorker() {
 		return workerMain()
 	}
+	if !ShouldLogBootstrap() {
+		logger = quietLogger(logger)
+	}
 
 	return runMasterWindows(logger, opts.Workers, opts.ListenAddr)
 }
@@ -75,18 +79,35 @@ func runMasterWindows(logger *zap.Logger, requestedWorkers int, listenAddr strin
 		)
 	}
 
+	statePath := stateFilePath()
+	defer os.Remove(statePath)
+
 	exitCh := make(chan workerExit, workerCount*2)
+	respawnCh := make(chan int, workerCount)
 	workers := make(map[int]*exec.Cmd, workerCount)
 	workerTargets := make(map[int]string, workerCount)
+	table := make(map[int]WorkerInfo, workerCount)
+	guard := newCrashGuard()
+	restarts := make(map[int]int, workerCount)
+
+	saveState := func() {
+		if err := writeState(statePath, table); err != nil && logger != nil {
+			logger.Warn("failed to write cluster state", zap.Error(err))
+		}
+	}
 
+	// Rolling restarts need SO_REUSEPORT and SIGUSR2, so Windows only respawns
+	// exited workers.
 	startWorker := func(id int) error {
 		addr := internalWorkerAddr(workerHost, port, id)
-		cmd, err := spawnWorkerWindows(id, addr)
+		cmd, err := spawnWorkerWindows(id, addr, statePath)
 		if err != nil {
 			return err
 		}
 		workers[id] = cmd
 		workerTargets[id] = "http://" + addr
+		table[id] = WorkerInfo{ID: id, PID: cmd.Process.Pid, StartedAt: time.Now(), Restarts: restarts[id]}
+		saveState()
 
 		if logger != nil {
 			logger.Info("worker started", zap.Int("worker_id", id), zap.Int("pid", cmd.Process.Pid), zap.String("addr", addr))
@@ -95,9 +116,10 @@ func runMasterWindows(logger *zap.Logger, requestedWorkers int, listenAddr strin
 		go func(workerID int, processID int, c *exec.Cmd) {
 			err := c.Wait()
 			exitCh <- workerExit{
-				id:   workerID,
-				pid:  processID,
-				code: exitCode(err),
+				id:    workerID,
+				pid:   processID,
+				code:  exitCode(err),
+				cause: exitCause(err),
 			}
 		}(id, cmd.Process.Pid, cmd)
 
@@ -141,7 +163,9 @@ func runMasterWindows(logger *zap.Logger, requestedWorkers int, listenAddr strin
 	stopping := false
 	var killTimer <-chan time.Time
 
-	for len(workers) > 0 {
+	// respawning counts exited workers waiting out their backoff.
+	respawning := 0
+	for len(workers) > 0 || (respawning > 0 && !stopping) {
 		select {
 		case err := <-serveErrCh:
 			if err != nil {
@@ -167,7 +191,7 @@ func runMasterWindows(logger *zap.Logger, requestedWorkers int, listenAddr strin
 			_ = srv.Shutdown(ctx)
 			cancel()
 			interruptAllWorkers(workers, logger)
-			killTimer = time.After(8 * time.Second)
+			killTimer = time.After(DrainTimeout + drainGrace)
 
 		case <-killTimer:
 			killAllWorkers(workers, logger)
@@ -183,13 +207,14 @@ func runMasterWindows(logger *zap.Logger, requestedWorkers int, listenAddr strin
 			}
 			delete(workers, ex.id)
 			delete(workerTargets, ex.id)
+			delete(table, ex.id)
 			targetPicker.Reset(workerTargets)
 
 			if logger != nil {
 				if ex.code == 0 {
-					logger.Info("worker exited", zap.Int("worker_id", ex.id), zap.Int("pid", ex.pid), zap.Int("code", ex.code))
+					logger.Info("worker exited", zap.Int("worker_id", ex.id), zap.Int("pid", ex.pid), zap.Int("code", ex.code), zap.String("cause", ex.cause))
 				} else {
-					logger.Warn("worker exited", zap.Int("worker_id", ex.id), zap.Int("pid", ex.pid), zap.Int("code", ex.code))
+					logger.Warn("worker exited", zap.Int("worker_id", ex.id), zap.Int("pid", ex.pid), zap.Int("code", ex.code), zap.String("cause", ex.cause))
 				}
 			}
 
@@ -197,15 +222,39 @@ func runMasterWindows(logger *zap.Logger, requestedWorkers int, listenAddr strin
 				continue
 			}
 
-			if ex.code != 0 {
+			saveState()
+			restarts[ex.id]++
+			recent := guard.record(ex.id, time.Now())
+			if recent >= crashLoopLimit {
 				if logger != nil {
-					logger.Warn("worker crashed, restarting", zap.Int("worker_id", ex.id))
+					logger.Error("worker is crash looping, giving up",
+						zap.Int("worker_id", ex.id), zap.Int("exits", recent), zap.Duration("window", crashLoopWindow))
 				}
-				if err := startWorker(ex.id); err != nil {
-					return err
-				}
-				targetPicker.Reset(workerTargets)
+				_ = srv.Close()
+				interruptAllWorkers(workers, logger)
+				killAllWorkers(workers, logger)
+				return fmt.Errorf("worker %d exited %d times within %s", ex.id, recent, crashLoopWindow)
+			}
+			delay := respawnDelay(recent)
+			if logger != nil {
+				logger.Warn("worker exited unexpectedly, restarting",
+					zap.Int("worker_id", ex.id), zap.Int("restarts", restarts[ex.id]), zap.Duration("backoff", delay))
 			}
+			respawning++
+			time.AfterFunc(delay, func() { respawnCh <- ex.id })
+
+		case id := <-respawnCh:
+			respawning--
+			if stopping {
+				continue
+			}
+			if _, ok := workers[id]; ok {
+				continue
+			}
+			if err := startWorker(id); err != nil {
+				return err
+			}
+			targetPicker.Reset(workerTargets)
 		}
 	}
 
@@ -215,7 +264,7 @@ func runMasterWindows(logger *zap.Logger, requestedWorkers int, listenAddr strin
 	return nil
 }
 
-func spawnWorkerWindows(id int, workerAddr string) (*exec.Cmd, error) {
+func spawnWorkerWindows(id int, workerAddr string, statePath string) (*exec.Cmd, error) {
 	executable, err := os.Executable()
 	if err != nil {
 		return nil, fmt.Errorf("resolve executable: %w", err)
@@ -227,6 +276,7 @@ func spawnWorkerWindows(id int, workerAddr string) (*exec.Cmd, error) {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = workerEnvWindows(os.Environ(), id, workerAddr)
+	cmd.Env = append(cmd.Env, EnvStateFile+"="+statePath)
 
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("start worker %d: %w", id, err)
@@ -237,7 +287,7 @@ func spawnWorkerWindows(id int, workerAddr string) (*exec.Cmd, error) {
 func workerEnvWindows(base []string, id int, workerAddr string) []string {
 	env := make([]string, 0, len(base)+3)
 	for _, kv := range base {
-		if hasEnvKey(kv, EnvRole) || hasEnvKey(kv, EnvWorkerID) || hasEnvKey(kv, EnvWorkerAddr) {
+		if hasEnvKey(kv, EnvRole) || hasEnvKey(kv, EnvWorkerID) || hasEnvKey(kv, EnvWorkerAddr) || hasEnvKey(kv, EnvStateFile) {
 			continue
 		}
 		env = append(env, kv)
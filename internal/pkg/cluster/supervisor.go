@@ -0,0 +1,178 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// EnvStateFile points workers at the worker table the master keeps on disk.
+	EnvStateFile = "MX_CLUSTER_STATE_FILE"
+	// EnvReadyFD is the inherited pipe a worker writes to once it is serving.
+	EnvReadyFD = "MX_CLUSTER_READY_FD"
+
+	respawnBaseDelay = time.Second
+	respawnMaxDelay  = 30 * time.Second
+	// A worker exiting crashLoopLimit times within crashLoopWindow stops the cluster.
+	crashLoopLimit  = 5
+	crashLoopWindow = time.Minute
+)
+
+const (
+	// ReadyTimeout bounds how long a rolling restart waits for a new worker.
+	ReadyTimeout = 30 * time.Second
+	// DrainTimeout is how long a worker has to finish in-flight requests
+	// after it stops accepting new ones.
+	DrainTimeout = 10 * time.Second
+	// drainGrace is how long past DrainTimeout the master waits before
+	// killing a worker that has not exited.
+	drainGrace = 2 * time.Second
+)
+
+// WorkerInfo is one row of the worker table.
+type WorkerInfo struct {
+	ID        int       `json:"id"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	Restarts  int       `json:"restarts"`
+}
+
+// State is the worker table written by the master.
+type State struct {
+	MasterPID int          `json:"master_pid"`
+	Workers   []WorkerInfo `json:"workers"`
+}
+
+// ReadState returns the worker table of the master that spawned this process.
+// It returns nil outside cluster mode.
+func ReadState() (*State, error) {
+	path := strings.TrimSpace(os.Getenv(EnvStateFile))
+	if path == "" || !IsWorker() {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// NotifyReady tells the master this worker is serving. It is a no-op unless the
+// master is waiting for it during a rolling restart.
+func NotifyReady() error {
+	raw := strings.TrimSpace(os.Getenv(EnvReadyFD))
+	if raw == "" {
+		return nil
+	}
+	fd, err := strconv.Atoi(raw)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", EnvReadyFD, raw)
+	}
+	_ = os.Unsetenv(EnvReadyFD)
+	pipe := os.NewFile(uintptr(fd), "cluster-ready")
+	if pipe == nil {
+		return errors.New("ready pipe is not open")
+	}
+	defer pipe.Close()
+	_, err = pipe.Write([]byte{1})
+	return err
+}
+
+func stateFilePath() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("mx-cluster-%d.json", os.Getpid()))
+}
+
+func writeState(path string, workers map[int]WorkerInfo) error {
+	state := State{MasterPID: os.Getpid(), Workers: make([]WorkerInfo, 0, len(workers))}
+	for _, info := range workers {
+		state.Workers = append(state.Workers, info)
+	}
+	sort.Slice(state.Workers, func(i, j int) bool { return state.Workers[i].ID < state.Workers[j].ID })
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// crashGuard counts recent exits per worker ID to back off respawns and stop
+// a crash loop.
+type crashGuard struct {
+	exits map[int][]time.Time
+}
+
+func newCrashGuard() *crashGuard {
+	return &crashGuard{exits: map[int][]time.Time{}}
+}
+
+// record notes an exit of worker id and returns how many happened within the window.
+func (g *crashGuard) record(id int, now time.Time) int {
+	recent := g.exits[id][:0]
+	for _, at := range g.exits[id] {
+		if now.Sub(at) < crashLoopWindow {
+			recent = append(recent, at)
+		}
+	}
+	g.exits[id] = append(recent, now)
+	return len(g.exits[id])
+}
+
+// respawnDelay doubles with every recent exit: 1s, 2s, 4s … up to respawnMaxDelay.
+func respawnDelay(recentExits int) time.Duration {
+	delay := respawnBaseDelay
+	for i := 1; i < recentExits && delay < respawnMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > respawnMaxDelay {
+		delay = respawnMaxDelay
+	}
+	return delay
+}
+
+// exitCause describes how a worker process ended, for the exit log.
+func exitCause(err error) string {
+	if err == nil {
+		return "exited cleanly"
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err.Error()
+	}
+	cause := exitErr.ProcessState.String()
+	switch {
+	case strings.Contains(cause, "signal: killed"):
+		cause += " (possibly the OOM killer)"
+	case exitErr.ExitCode() == 2:
+		cause += " (possibly a panic, see the worker output)"
+	}
+	return cause
+}
+
+// quietLogger keeps the master's warnings and errors but drops its info logs
+// in processes that should not print bootstrap output, such as secondary pm2
+// instances.
+func quietLogger(logger *zap.Logger) *zap.Logger {
+	if logger == nil {
+		return nil
+	}
+	return logger.WithOptions(zap.IncreaseLevel(zapcore.WarnLevel))
+}
@@ -31,8 +31,10 @@ const (
 type Job struct {
 	Name        string
 	Description string
-	Interval    time.Duration
-	Fn          func(ctx context.Context) error
+	// Interval is the time between runs. A zero Interval makes the job
+	// manual: it only runs when triggered through Run.
+	Interval time.Duration
+	Fn       func(ctx context.Context) error
 }
 
 // JobState holds runtime state for a registered job.
@@ -116,8 +118,10 @@ func (s *Scheduler) SetBaseContext(ctx context.Context) {
 func (s *Scheduler) Register(job Job) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	now := time.Now()
-	next := now.Add(job.Interval)
+	var next time.Time
+	if job.Interval > 0 {
+		next = time.Now().Add(job.Interval)
+	}
 	s.jobs[job.Name] = &JobState{
 		Job:       job,
 		Status:    StatusIdle,
@@ -139,7 +143,9 @@ func (s *Scheduler) Start(ctx context.Context) {
 		go s.listenRunRequests(ctx)
 	}
 	for _, js := range s.jobs {
-		go s.runLoop(ctx, js)
+		if js.Interval > 0 {
+			go s.runLoop(ctx, js)
+		}
 	}
 }
 
@@ -271,7 +277,7 @@ func (s *Scheduler) List() []ListItem {
 	for _, js := range s.jobs {
 		js.mu.Lock()
 		var next *time.Time
-		if enabled {
+		if enabled && !js.NextRunAt.IsZero() {
 			nextDate := js.NextRunAt
 			next = &nextDate
 		}
@@ -0,0 +1,190 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five-field cron expression (minute hour dom month dow).
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type exprField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = exprField{name: "minute", min: 0, max: 59}
+	hourField   = exprField{name: "hour", min: 0, max: 23}
+	domField    = exprField{name: "day of month", min: 1, max: 31}
+	monthField  = exprField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = exprField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var exprDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseExpr parses a standard five-field cron expression or a descriptor such as @daily.
+func ParseExpr(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := exprDescriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, err = parseExprField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseExprField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseExprField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseExprField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseExprField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	// Sunday may be written as 0 or 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = isWildcard(fields[2])
+	s.dowAny = isWildcard(fields[4])
+	return s, nil
+}
+
+// Next returns the first activation time strictly after t, or the zero time
+// when the expression can never match (e.g. "0 0 31 2 *").
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows Vixie cron: when both day fields are restricted, either may match.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+func parseExprField(raw string, f exprField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(raw, ",") {
+		b, err := parseExprRange(part, f)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+func parseExprRange(part string, f exprField) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		n, err := strconv.Atoi(stepPart)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid %s step %q", f.name, part)
+		}
+		step = n
+	}
+
+	lo, hi := f.min, f.max
+	switch {
+	case rangePart == "*" || rangePart == "?":
+	case strings.Contains(rangePart, "-"):
+		loText, hiText, _ := strings.Cut(rangePart, "-")
+		var err error
+		if lo, err = parseExprValue(loText, f); err != nil {
+			return 0, err
+		}
+		if hi, err = parseExprValue(hiText, f); err != nil {
+			return 0, err
+		}
+	default:
+		v, err := parseExprValue(rangePart, f)
+		if err != nil {
+			return 0, err
+		}
+		lo = v
+		if !hasStep {
+			hi = v
+		}
+	}
+	if lo > hi {
+		return 0, fmt.Errorf("invalid %s range %q", f.name, part)
+	}
+
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func parseExprValue(raw string, f exprField) (int, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if v, ok := f.names[raw]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s value %q", f.name, raw)
+	}
+	return v, nil
+}
@@ -0,0 +1,90 @@
+// Package dialect hides the SQL differences between MySQL, PostgreSQL and SQLite
+// for the few places that write raw SQL.
+package dialect
+
+import (
+	"errors"
+	"strings"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Name returns the normalized dialect name of db.
+func Name(db *gorm.DB) string {
+	name := strings.ToLower(strings.TrimSpace(db.Dialector.Name()))
+	if name == "sqlite3" {
+		return SQLite
+	}
+	return name
+}
+
+// Quote quotes an identifier (table or column) for db, e.g. `key` or "key".
+func Quote(db *gorm.DB, name string) string {
+	var b strings.Builder
+	db.Dialector.QuoteTo(&b, name)
+	return b.String()
+}
+
+// DisableForeignKeys turns off foreign key enforcement for the session behind tx.
+// The returned function turns it back on and must be called on the same tx.
+func DisableForeignKeys(tx *gorm.DB) (enable func() error, err error) {
+	noop := func() error { return nil }
+	switch Name(tx) {
+	case MySQL:
+		if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+			return noop, err
+		}
+		return func() error { return tx.Exec("SET FOREIGN_KEY_CHECKS = 1").Error }, nil
+	case Postgres:
+		// Skips FK triggers; requires a superuser or a role allowed to set it.
+		if err := tx.Exec("SET session_replication_role = replica").Error; err != nil {
+			return noop, err
+		}
+		return func() error { return tx.Exec("SET session_replication_role = DEFAULT").Error }, nil
+	case SQLite:
+		// PRAGMA foreign_keys is a no-op inside a transaction; deferring moves the
+		// checks to COMMIT and resets itself when the transaction ends.
+		if err := tx.Exec("PRAGMA defer_foreign_keys = ON").Error; err != nil {
+			return noop, err
+		}
+		return noop, nil
+	default:
+		return noop, nil
+	}
+}
+
+// IsDuplicateKeyError reports whether err is a unique or primary key violation.
+func IsDuplicateKeyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var mysqlErr *mysqlDriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	// pgconn.PgError
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "23505"
+	}
+	// modernc.org/sqlite: SQLITE_CONSTRAINT_PRIMARYKEY and SQLITE_CONSTRAINT_UNIQUE.
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		return code == 1555 || code == 2067
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "duplicate entry") ||
+		strings.Contains(msg, "duplicate key") ||
+		strings.Contains(msg, "unique constraint")
+}
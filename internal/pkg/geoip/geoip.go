@@ -0,0 +1,205 @@
+// Package geoip resolves IP addresses to readable locations such as
+// "China · Beijing", from a local MaxMind DB file or an HTTP lookup service.
+package geoip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const (
+	separator      = " · "
+	cachePrefix    = "mx:ip_location:"
+	cacheTTL       = 7 * 24 * time.Hour
+	unknownTTL     = 24 * time.Hour
+	unknownMarker  = "-"
+	apiTimeout     = 5 * time.Second
+	apiMaxBodySize = 64 << 10
+)
+
+// Locator resolves an IP address to a location; "" means unknown.
+type Locator interface {
+	Locate(ctx context.Context, ip string) (string, error)
+}
+
+// Options selects the lookup backend. MMDBPath wins over APIURL.
+type Options struct {
+	// MMDBPath is a GeoLite2/GeoIP2 City or Country .mmdb file.
+	MMDBPath string
+	// APIURL is an HTTP endpoint with an {ip} placeholder answering JSON with
+	// country, regionName (or region) and city fields, like ip-api.com.
+	APIURL string
+	// Language picks localized names from the mmdb file, default "en".
+	Language string
+}
+
+// New returns the Locator configured by opts, or nil when none is.
+func New(opts Options) (Locator, error) {
+	lang := strings.TrimSpace(opts.Language)
+	if lang == "" {
+		lang = "en"
+	}
+	if path := strings.TrimSpace(opts.MMDBPath); path != "" {
+		r, err := maxminddb.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: %w", err)
+		}
+		return &mmdbLocator{reader: r, lang: lang}, nil
+	}
+	if api := strings.TrimSpace(opts.APIURL); api != "" {
+		if !strings.Contains(api, "{ip}") {
+			return nil, errors.New("geoip: api url needs an {ip} placeholder")
+		}
+		return &apiLocator{url: api, client: &http.Client{Timeout: apiTimeout}}, nil
+	}
+	return nil, nil
+}
+
+// IsPublic reports whether ip is a routable address worth looking up.
+func IsPublic(ip string) bool {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	return parsed != nil &&
+		!parsed.IsLoopback() &&
+		!parsed.IsPrivate() &&
+		!parsed.IsUnspecified() &&
+		!parsed.IsLinkLocalUnicast() &&
+		!parsed.IsMulticast()
+}
+
+// join formats location parts, skipping blanks and repeats such as
+// "Beijing · Beijing".
+func join(parts ...string) string {
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" || (len(out) > 0 && out[len(out)-1] == p) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return strings.Join(out, separator)
+}
+
+type mmdbLocator struct {
+	reader *maxminddb.Reader
+	lang   string
+}
+
+// mmdbPlace is a country, subdivision or city of a GeoIP2 record.
+type mmdbPlace struct {
+	Names map[string]string `maxminddb:"names"`
+}
+
+type mmdbRecord struct {
+	Country      mmdbPlace   `maxminddb:"country"`
+	Subdivisions []mmdbPlace `maxminddb:"subdivisions"`
+	City         mmdbPlace   `maxminddb:"city"`
+}
+
+func (l *mmdbLocator) Locate(_ context.Context, ip string) (string, error) {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return "", nil
+	}
+	var record mmdbRecord
+	if err := l.reader.Lookup(parsed, &record); err != nil {
+		return "", err
+	}
+	var region string
+	if len(record.Subdivisions) > 0 {
+		region = l.name(record.Subdivisions[0])
+	}
+	return join(l.name(record.Country), region, l.name(record.City)), nil
+}
+
+// name picks the localized name of a GeoIP2 place, falling back to English.
+func (l *mmdbLocator) name(place mmdbPlace) string {
+	if v := place.Names[l.lang]; v != "" {
+		return v
+	}
+	return place.Names["en"]
+}
+
+type apiLocator struct {
+	url    string
+	client *http.Client
+}
+
+func (l *apiLocator) Locate(ctx context.Context, ip string) (string, error) {
+	endpoint := strings.ReplaceAll(l.url, "{ip}", url.PathEscape(strings.TrimSpace(ip)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geoip: lookup service returned %d", resp.StatusCode)
+	}
+	var body struct {
+		Status     string `json:"status"`
+		Country    string `json:"country"`
+		RegionName string `json:"regionName"`
+		Region     string `json:"region"`
+		City       string `json:"city"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, apiMaxBodySize)).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Status == "fail" {
+		return "", nil
+	}
+	region := body.RegionName
+	if region == "" {
+		region = body.Region
+	}
+	return join(body.Country, region, body.City), nil
+}
+
+// Cached wraps l so each IP is looked up at most once a week, remembering
+// unknown addresses for a day.
+func Cached(l Locator, rc *pkgredis.Client) Locator {
+	if l == nil || rc == nil {
+		return l
+	}
+	return &cachedLocator{next: l, rc: rc}
+}
+
+type cachedLocator struct {
+	next Locator
+	rc   *pkgredis.Client
+}
+
+func (l *cachedLocator) Locate(ctx context.Context, ip string) (string, error) {
+	key := cachePrefix + ip
+	if cached, err := l.rc.Get(ctx, key); err == nil && cached != "" {
+		if cached == unknownMarker {
+			return "", nil
+		}
+		return cached, nil
+	}
+	location, err := l.next.Locate(ctx, ip)
+	if err != nil {
+		return "", err
+	}
+	if location == "" {
+		_ = l.rc.Set(ctx, key, unknownMarker, unknownTTL)
+	} else {
+		_ = l.rc.Set(ctx, key, location, cacheTTL)
+	}
+	return location, nil
+}
@@ -1,6 +1,8 @@
 package jwt
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"fmt"
 	"time"
 
@@ -73,3 +75,54 @@ func Parse(tokenStr string) (*Claims, error) {
 	}
 	return claims, nil
 }
+
+// readerAudience marks reader tokens so they are never mistaken for admin
+// tokens, and admin tokens are never accepted as reader ones.
+const readerAudience = "reader"
+
+// ReaderClaims is the JWT payload of a comment reader.
+type ReaderClaims struct {
+	ReaderID string `json:"rid"`
+	jwtlib.RegisteredClaims
+}
+
+// SignReader creates a signed reader token for the given reader ID.
+func SignReader(readerID string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := ReaderClaims{
+		ReaderID: readerID,
+		RegisteredClaims: jwtlib.RegisteredClaims{
+			Audience:  jwtlib.ClaimStrings{readerAudience},
+			ExpiresAt: jwtlib.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwtlib.NewNumericDate(now),
+		},
+	}
+	return jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// ParseReader validates a reader token string and returns its claims.
+func ParseReader(tokenStr string) (*ReaderClaims, error) {
+	token, err := jwtlib.ParseWithClaims(tokenStr, &ReaderClaims{}, func(t *jwtlib.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwtlib.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return secret, nil
+	}, jwtlib.WithAudience(readerAudience))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*ReaderClaims)
+	if !ok || !token.Valid || claims.ReaderID == "" {
+		return nil, fmt.Errorf("invalid reader token")
+	}
+	return claims, nil
+}
+
+// Sum returns the HMAC-SHA256 of data keyed with the signing secret, for short
+// signed values that don't need to be full JWTs.
+func Sum(data string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
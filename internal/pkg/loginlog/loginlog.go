@@ -0,0 +1,186 @@
+// Package loginlog records owner password login attempts, locks out IPs
+// that keep failing and reports sign-ins from unfamiliar addresses.
+//
+// The lockout counts attempts per IP in Redis, atomically and before the
+// password is checked, so parallel requests cannot all slip past it. A
+// successful login resets the count.
+package loginlog
+
+import (
+	"context"
+	"time"
+
+	"github.com/mx-space/core/internal/models"
+	"github.com/mx-space/core/internal/pkg/geoip"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxFailures attempts from one IP without a successful login lock
+	// password login for that IP until FailureWindow after the first one.
+	MaxFailures   = 5
+	FailureWindow = 15 * time.Minute
+
+	// Retention is how long login_logs rows are kept; see Prune.
+	Retention = 90 * 24 * time.Hour
+
+	attemptPrefix = "mx:login:attempts:"
+	locateTimeout = 2 * time.Second
+	redisTimeout  = 2 * time.Second
+)
+
+// Failure reasons stored on failed attempts.
+const (
+	ReasonUnknownUser   = "unknown_user"
+	ReasonWrongPassword = "wrong_password"
+)
+
+// countAttemptScript increments the attempt counter in KEYS[1], starting its
+// ARGV[1] millisecond window on the first attempt, and returns the count.
+var countAttemptScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// Recorder writes login_logs rows. A nil *Recorder records nothing and never
+// locks, so handlers can use it unconditionally.
+type Recorder struct {
+	db      *gorm.DB
+	rc      *pkgredis.Client
+	locator geoip.Locator
+	onNewIP func(*models.LoginLog)
+	logger  *zap.Logger
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithRedis enables the per-IP lockout; without it attempts are only logged.
+func WithRedis(rc *pkgredis.Client) Option {
+	return func(r *Recorder) { r.rc = rc }
+}
+
+// WithLocator resolves the location stored with each attempt.
+func WithLocator(l geoip.Locator) Option {
+	return func(r *Recorder) { r.locator = l }
+}
+
+// WithNewIPNotifier sets the callback run, in its own goroutine, when the
+// owner signs in from an IP with no earlier successful login.
+func WithNewIPNotifier(fn func(*models.LoginLog)) Option {
+	return func(r *Recorder) { r.onNewIP = fn }
+}
+
+// WithLogger sets the logger.
+func WithLogger(l *zap.Logger) Option {
+	return func(r *Recorder) {
+		if l != nil {
+			r.logger = l.Named("LoginLog")
+		}
+	}
+}
+
+// New creates a Recorder.
+func New(db *gorm.DB, opts ...Option) *Recorder {
+	r := &Recorder{db: db, logger: zap.NewNop()}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Attempt counts a password login attempt from ip and reports whether it may
+// go ahead. Blocked attempts are not written to login_logs. Redis errors
+// let the attempt through.
+func (r *Recorder) Attempt(ip string) bool {
+	if r == nil || r.rc == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := countAttemptScript.Run(ctx, r.rc.Raw(), []string{attemptPrefix + ip},
+		FailureWindow.Milliseconds()).Int()
+	if err != nil {
+		r.logger.Warn("count login attempt failed", zap.String("ip", ip), zap.Error(err))
+		return true
+	}
+	if n == MaxFailures+1 {
+		r.logger.Warn("登录失败次数过多，已临时锁定该 IP 的密码登录",
+			zap.String("ip", ip), zap.Int("failures", MaxFailures), zap.Duration("window", FailureWindow))
+	}
+	return n <= MaxFailures
+}
+
+// Failed records a failed attempt.
+func (r *Recorder) Failed(ip, username, ua, reason string) {
+	if r == nil {
+		return
+	}
+	r.insert(&models.LoginLog{Username: username, IP: ip, UA: ua, Reason: reason})
+}
+
+// Succeeded records a successful login and notifies when it comes from an
+// IP the user has not signed in from before. Users without any earlier
+// successful login are not reported, so the first login after setup or an
+// upgrade stays quiet.
+func (r *Recorder) Succeeded(ip, username, ua, userID string) {
+	if r == nil {
+		return
+	}
+	var total, seen int64
+	err := r.db.Model(&models.LoginLog{}).Where("user_id = ? AND success = ?", userID, true).Count(&total).Error
+	if err == nil && total > 0 {
+		err = r.db.Model(&models.LoginLog{}).
+			Where("user_id = ? AND success = ? AND ip = ?", userID, true, ip).Count(&seen).Error
+	}
+	if err != nil {
+		r.logger.Warn("count login history failed", zap.String("user", userID), zap.Error(err))
+		total = 0
+	}
+
+	if r.rc != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		_ = r.rc.Del(ctx, attemptPrefix+ip)
+		cancel()
+	}
+
+	row := &models.LoginLog{UserID: userID, Username: username, IP: ip, UA: ua, Success: true}
+	r.insert(row)
+	if total > 0 && seen == 0 && r.onNewIP != nil {
+		go r.onNewIP(row)
+	}
+}
+
+// Prune deletes login_logs rows older than Retention and returns how many
+// it removed.
+func Prune(db *gorm.DB, now time.Time) (int64, error) {
+	res := db.Where("created_at < ?", now.Add(-Retention)).Delete(&models.LoginLog{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *Recorder) insert(row *models.LoginLog) {
+	row.Location = r.locate(row.IP)
+	if err := r.db.Create(row).Error; err != nil {
+		r.logger.Warn("save login log failed", zap.String("ip", row.IP), zap.Error(err))
+	}
+}
+
+func (r *Recorder) locate(ip string) string {
+	if r.locator == nil || !geoip.IsPublic(ip) {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), locateTimeout)
+	defer cancel()
+	location, err := r.locator.Locate(ctx, ip)
+	if err != nil {
+		r.logger.Debug("locate login ip failed", zap.String("ip", ip), zap.Error(err))
+		return ""
+	}
+	return location
+}
@@ -0,0 +1,121 @@
+package mail
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ejsTimeout bounds how long a custom template may run.
+const ejsTimeout = 2 * time.Second
+
+var errUnclosedEJSTag = errors.New("ejs: unclosed tag")
+
+// RenderEJS renders an EJS template, as stored in the email_template_*
+// options, with props as its locals. It supports <%= %> (escaped), <%- %>
+// (raw), <% %> (scriptlet) and <%# %> (comment) tags, the -%> and _%>
+// whitespace trimming closers, and <%% as a literal "<%".
+func RenderEJS(src string, props map[string]interface{}) (string, error) {
+	code, err := compileEJS(src)
+	if err != nil {
+		return "", err
+	}
+	if props == nil {
+		props = map[string]interface{}{}
+	}
+	vm := goja.New()
+	if err := vm.Set("locals", props); err != nil {
+		return "", err
+	}
+	if err := vm.Set("__escape", func(v goja.Value) string {
+		if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+			return ""
+		}
+		return html.EscapeString(v.String())
+	}); err != nil {
+		return "", err
+	}
+	timer := time.AfterFunc(ejsTimeout, func() { vm.Interrupt("template timeout") })
+	defer timer.Stop()
+	v, err := vm.RunString(code)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// compileEJS turns an EJS template into a script evaluating to its output.
+func compileEJS(src string) (string, error) {
+	var b strings.Builder
+	b.WriteString("(function(){var __out='';with(locals){\n")
+	emit := func(text string) {
+		if text == "" {
+			return
+		}
+		quoted, _ := json.Marshal(text)
+		b.WriteString("__out+=")
+		b.Write(quoted)
+		b.WriteString(";\n")
+	}
+
+	trimNext := ""
+	for src != "" {
+		start := strings.Index(src, "<%")
+		if start < 0 {
+			emit(trimLeading(src, trimNext))
+			break
+		}
+		emit(trimLeading(src[:start], trimNext))
+		trimNext = ""
+		src = src[start+2:]
+		if strings.HasPrefix(src, "%") {
+			emit("<%")
+			src = src[1:]
+			continue
+		}
+
+		end := strings.Index(src, "%>")
+		if end < 0 {
+			return "", errUnclosedEJSTag
+		}
+		body := src[:end]
+		src = src[end+2:]
+		switch {
+		case strings.HasSuffix(body, "-"):
+			body, trimNext = body[:len(body)-1], "-"
+		case strings.HasSuffix(body, "_"):
+			body, trimNext = body[:len(body)-1], "_"
+		}
+
+		switch {
+		case strings.HasPrefix(body, "="):
+			b.WriteString("__out+=__escape(" + body[1:] + ");\n")
+		case strings.HasPrefix(body, "-"):
+			b.WriteString("__out+=((v)=>v==null?'':String(v))(" + body[1:] + ");\n")
+		case strings.HasPrefix(body, "#"):
+		default:
+			b.WriteString(strings.TrimPrefix(body, "_") + "\n")
+		}
+	}
+	b.WriteString("}return __out;})()")
+	return b.String(), nil
+}
+
+// trimLeading applies the trimming requested by the previous tag's closer:
+// "-" drops one following newline, "_" all following whitespace.
+func trimLeading(text, mode string) string {
+	switch mode {
+	case "-":
+		if strings.HasPrefix(text, "\r\n") {
+			return text[2:]
+		}
+		return strings.TrimPrefix(text, "\n")
+	case "_":
+		return strings.TrimLeft(text, " \t\r\n")
+	}
+	return text
+}
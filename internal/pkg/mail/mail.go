@@ -409,6 +409,23 @@ const commentNotifyTpl = `<!DOCTYPE html>
 </body>
 </html>`
 
+const loginAlertTpl = `<!DOCTYPE html>
+<html>
+<body style="font-family:sans-serif;background:#f5f5f5;padding:20px">
+<div style="max-width:600px;margin:0 auto;background:#fff;border-radius:8px;padding:24px">
+  <h2 style="color:#333">新 IP 登录提醒</h2>
+  <p>{{.Master}}，你的账号 <strong>{{.Username}}</strong> 刚刚在一个新的 IP 上登录了 {{.SiteName}} 后台。</p>
+  <table style="color:#555;font-size:14px;margin-top:16px">
+    <tr><td style="padding:4px 12px 4px 0;color:#999">时间</td><td>{{.Time}}</td></tr>
+    <tr><td style="padding:4px 12px 4px 0;color:#999">IP</td><td>{{.IP}}</td></tr>
+    <tr><td style="padding:4px 12px 4px 0;color:#999">位置</td><td>{{if .Location}}{{.Location}}{{else}}未知{{end}}</td></tr>
+    <tr><td style="padding:4px 12px 4px 0;color:#999">UA</td><td>{{.UA}}</td></tr>
+  </table>
+  <p style="color:#999;font-size:12px;margin-top:24px">如果不是您本人操作，请立即修改密码并注销其他会话。</p>
+</div>
+</body>
+</html>`
+
 const subscribeVerifyTpl = `<!DOCTYPE html>
 <html>
 <body style="font-family:sans-serif;background:#f5f5f5;padding:20px">
@@ -516,6 +533,17 @@ type SubscribeVerifyData struct {
 	VerifyURL string
 }
 
+// LoginAlertData is the data for new-IP login alert emails.
+type LoginAlertData struct {
+	Master   string
+	Username string
+	SiteName string
+	Time     string
+	IP       string
+	Location string
+	UA       string
+}
+
 // ReplyNotifyData is the data for reply notification emails.
 type ReplyNotifyData struct {
 	Title           string
@@ -536,6 +564,42 @@ type NewsletterData struct {
 	DetailURL      string
 	UnsubscribeURL string
 	SiteName       string
+
+	// Template is the EJS source of email_template_newsletter. When empty,
+	// or when it fails to render, the built-in template is used.
+	Template  string
+	RefID     string
+	Created   time.Time
+	Subscribe int
+}
+
+// ejsProps builds the locals a newsletter EJS template renders with, in the
+// shape the template editor previews.
+func (d NewsletterData) ejsProps(to string) map[string]interface{} {
+	return map[string]interface{}{
+		"text":             d.Text,
+		"title":            d.Title,
+		"author":           d.OwnerName,
+		"detail_link":      d.DetailURL,
+		"unsubscribe_link": d.UnsubscribeURL,
+		"master":           d.OwnerName,
+		"aggregate": map[string]interface{}{
+			"owner": map[string]interface{}{
+				"name":   d.OwnerName,
+				"avatar": d.OwnerAvatar,
+			},
+			"subscriber": map[string]interface{}{
+				"email":     to,
+				"subscribe": d.Subscribe,
+			},
+			"post": map[string]interface{}{
+				"text":    d.Text,
+				"title":   d.Title,
+				"id":      d.RefID,
+				"created": d.Created.UTC().Format("2006-01-02T15:04:05.000Z"),
+			},
+		},
+	}
 }
 
 func renderTemplate(tpl string, data interface{}) (string, error) {
@@ -599,6 +663,19 @@ func (s *Sender) SendSubscribeVerify(to string, data SubscribeVerifyData) error
 	})
 }
 
+// SendLoginAlert tells the owner about a login from an IP not seen before.
+func (s *Sender) SendLoginAlert(to string, data LoginAlertData) error {
+	html, err := renderTemplate(loginAlertTpl, data)
+	if err != nil {
+		return err
+	}
+	return s.Send(Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("[%s] 新 IP 登录提醒", data.SiteName),
+		HTML:    html,
+	})
+}
+
 // SendReplyNotify sends a reply notification to the original commenter.
 func (s *Sender) SendReplyNotify(to string, data ReplyNotifyData) error {
 	if strings.TrimSpace(data.Master) == "" {
@@ -634,14 +711,26 @@ func (s *Sender) SendNewsletter(to string, data NewsletterData) error {
 	if siteName == "" {
 		siteName = "Mix Space"
 	}
-	html, err := renderTemplate(newsletterTpl, data)
-	if err != nil {
-		return err
+	var html string
+	if strings.TrimSpace(data.Template) != "" {
+		rendered, err := RenderEJS(data.Template, data.ejsProps(to))
+		if err != nil {
+			s.logger.Warn("自定义订阅邮件模板渲染失败，改用内置模板", zap.Error(err))
+		}
+		html = rendered
+	}
+	if html == "" {
+		rendered, err := renderTemplate(newsletterTpl, data)
+		if err != nil {
+			return err
+		}
+		html = rendered
 	}
 	var headers map[string]string
 	if strings.TrimSpace(data.UnsubscribeURL) != "" {
 		headers = map[string]string{
-			"List-Unsubscribe": fmt.Sprintf("<%s>", data.UnsubscribeURL),
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", data.UnsubscribeURL),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
 		}
 	}
 	return s.Send(Message{
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	dbQueryDuration = NewHistogram("mx_db_query_duration_seconds",
+		"Duration of gorm statements by operation and table.", nil, "operation", "table")
+	dbQueryErrors = NewCounter("mx_db_query_errors_total",
+		"Failed gorm statements by operation and table, not counting record-not-found.", "operation", "table")
+	redisCommandErrors = NewCounter("mx_redis_command_errors_total",
+		"Failed Redis commands by command name, not counting nil replies.", "command")
+)
+
+// --- gorm ---
+
+const gormStartKey = "metrics:started_at"
+
+type gormPlugin struct{}
+
+// GormPlugin times every statement run through db. Register it with db.Use.
+func GormPlugin() gorm.Plugin { return gormPlugin{} }
+
+func (gormPlugin) Name() string { return "metrics" }
+
+func (gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	register := []struct {
+		op     string
+		before func(name string, fn func(*gorm.DB)) error
+		after  func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("*").Register, cb.Create().After("*").Register},
+		{"query", cb.Query().Before("*").Register, cb.Query().After("*").Register},
+		{"update", cb.Update().Before("*").Register, cb.Update().After("*").Register},
+		{"delete", cb.Delete().Before("*").Register, cb.Delete().After("*").Register},
+		{"row", cb.Row().Before("*").Register, cb.Row().After("*").Register},
+		{"raw", cb.Raw().Before("*").Register, cb.Raw().After("*").Register},
+	}
+	for _, r := range register {
+		if err := r.before("metrics:before_"+r.op, gormBefore); err != nil {
+			return err
+		}
+		if err := r.after("metrics:after_"+r.op, gormAfter(r.op)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gormBefore(db *gorm.DB) {
+	db.InstanceSet(gormStartKey, time.Now())
+}
+
+func gormAfter(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(gormStartKey)
+		if !ok {
+			return
+		}
+		started, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+		table := ""
+		if db.Statement != nil {
+			table = db.Statement.Table
+		}
+		dbQueryDuration.Observe(time.Since(started).Seconds(), op, table)
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			dbQueryErrors.Inc(op, table)
+		}
+	}
+}
+
+// --- redis ---
+
+type redisHook struct{}
+
+// RedisHook counts failed commands. Register it with client.AddHook.
+func RedisHook() redis.Hook { return redisHook{} }
+
+func (redisHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		countRedisError(cmd.Name(), err)
+		return err
+	}
+}
+
+func (redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			countRedisError(cmd.Name(), cmd.Err())
+		}
+		return err
+	}
+}
+
+func countRedisError(command string, err error) {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return
+	}
+	redisCommandErrors.Inc(strings.ToLower(command))
+}
@@ -0,0 +1,326 @@
+// Package metrics is a small Prometheus registry: counters, histograms and
+// gauges computed at scrape time, exposed in the text exposition format.
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the Prometheus client default latency buckets in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the process-wide registry.
+var Default = NewRegistry()
+
+type family interface {
+	write(w io.Writer)
+}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+	order    []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]family{}}
+}
+
+// register returns the family already registered under name, so packages can
+// register their metrics more than once (e.g. one App per test).
+func (r *Registry) register(name string, f family) family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.families[name]; ok {
+		return existing
+	}
+	r.families[name] = f
+	r.order = append(r.order, name)
+	return f
+}
+
+// Write writes every family in the text exposition format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	families := make([]family, 0, len(r.order))
+	for _, name := range r.order {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// Handler serves the registry. A non-empty token must be sent as a Bearer
+// token; without one only direct connections from loopback are served.
+func (r *Registry) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token != "" {
+			got := strings.TrimSpace(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if !isLocalRequest(req) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// isLocalRequest reports whether req came straight from a loopback address.
+// Requests carrying forwarding headers went through a proxy on this host and
+// may come from anywhere, so they don't count.
+func isLocalRequest(req *http.Request) bool {
+	if req.Header.Get("X-Forwarded-For") != "" || req.Header.Get("X-Real-IP") != "" || req.Header.Get("Forwarded") != "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.Unmap().IsLoopback()
+}
+
+// series keeps label values next to their joined map key.
+type series struct {
+	values []string
+}
+
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func checkLabels(name string, labels, values []string) {
+	if len(labels) != len(values) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", name, len(labels), len(values)))
+	}
+}
+
+// --- counter ---
+
+// Counter is a monotonically increasing value per label set.
+type Counter struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]*counterSeries
+}
+
+type counterSeries struct {
+	series
+	value float64
+}
+
+// NewCounter registers a counter on the Default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: map[string]*counterSeries{}}
+	return r.register(name, c).(*Counter)
+}
+
+// Inc adds 1 to the series of the given label values.
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds v to the series of the given label values.
+func (c *Counter) Add(v float64, values ...string) {
+	checkLabels(c.name, c.labels, values)
+	key := seriesKey(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.values[key]
+	if s == nil {
+		s = &counterSeries{series: series{values: append([]string{}, values...)}}
+		c.values[key] = s
+	}
+	s.value += v
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		s := c.values[key]
+		writeSample(w, c.name, c.labels, s.values, nil, s.value)
+	}
+}
+
+// --- histogram ---
+
+// Histogram counts observations into cumulative buckets per label set.
+type Histogram struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	values     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	series
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram on the Default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, values: map[string]*histogramSeries{}}
+	return r.register(name, h).(*Histogram)
+}
+
+// Observe records v for the series of the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	checkLabels(h.name, h.labels, values)
+	key := seriesKey(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.values[key]
+	if s == nil {
+		s = &histogramSeries{series: series{values: append([]string{}, values...)}, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		s := h.values[key]
+		for i, bound := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.labels, s.values, []string{"le", formatFloat(bound)}, float64(s.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.values, []string{"le", "+Inf"}, float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.values, nil, s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.values, nil, float64(s.count))
+	}
+}
+
+// --- gauge ---
+
+// Sample is one gauge value with its label values.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+type gaugeFunc struct {
+	name, help string
+	labels     []string
+	collect    func() []Sample
+}
+
+// NewGaugeFunc registers a gauge on the Default registry whose samples are
+// computed by collect on every scrape.
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) {
+	Default.NewGaugeFunc(name, help, labels, collect)
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func() []Sample) {
+	r.register(name, &gaugeFunc{name: name, help: help, labels: labels, collect: collect})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	samples := g.collect()
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, s := range samples {
+		if len(s.Labels) != len(g.labels) {
+			continue
+		}
+		writeSample(w, g.name, g.labels, s.Labels, nil, s.Value)
+	}
+}
+
+// --- exposition ---
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+}
+
+func writeSample(w io.Writer, name string, labels, values []string, extra []string, v float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 || len(extra) > 0 {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, label, escapeLabel(values[i]))
+		}
+		if len(extra) == 2 {
+			if len(labels) > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, extra[0], extra[1])
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+	_, _ = io.WriteString(w, b.String())
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+package nativelog
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// EntryBacklogSize is how many recent entries are kept for replay to new
+// entry subscribers.
+const EntryBacklogSize = 500
+
+// Entry is a structured log entry as streamed to the admin console.
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	// Worker is the cluster worker that wrote the entry, 0 outside cluster
+	// mode. It is filled in by the consumer streaming the entry.
+	Worker int `json:"worker,omitempty"`
+}
+
+// LevelEnabled reports whether the entry is at least min.
+func (e Entry) LevelEnabled(min zapcore.Level) bool {
+	level, err := zapcore.ParseLevel(e.Level)
+	return err != nil || level >= min
+}
+
+type entryHub struct {
+	mu          sync.Mutex
+	ring        []Entry
+	next        int
+	nextID      int
+	subscribers map[int]chan Entry
+}
+
+var globalEntryHub = &entryHub{
+	ring:        make([]Entry, 0, EntryBacklogSize),
+	subscribers: make(map[int]chan Entry),
+}
+
+// SubscribeEntries subscribes to structured log entries. It also returns the
+// buffered recent entries, oldest first, taken atomically with the
+// subscription so none are missed or repeated.
+func SubscribeEntries(buffer int) (int, <-chan Entry, []Entry) {
+	if buffer <= 0 {
+		buffer = defaultSubBufSize
+	}
+	return globalEntryHub.subscribe(buffer)
+}
+
+// UnsubscribeEntries ends a subscription made with SubscribeEntries.
+func UnsubscribeEntries(id int) {
+	globalEntryHub.unsubscribe(id)
+}
+
+func (h *entryHub) subscribe(buffer int) (int, <-chan Entry, []Entry) {
+	ch := make(chan Entry, buffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := h.nextID
+	h.nextID++
+	h.subscribers[id] = ch
+
+	backlog := make([]Entry, 0, len(h.ring))
+	if len(h.ring) == EntryBacklogSize {
+		backlog = append(backlog, h.ring[h.next:]...)
+		backlog = append(backlog, h.ring[:h.next]...)
+	} else {
+		backlog = append(backlog, h.ring...)
+	}
+	return id, ch, backlog
+}
+
+func (h *entryHub) unsubscribe(id int) {
+	h.mu.Lock()
+	ch, ok := h.subscribers[id]
+	if ok {
+		delete(h.subscribers, id)
+	}
+	h.mu.Unlock()
+
+	if ok {
+		close(ch)
+	}
+}
+
+func (h *entryHub) publish(entry Entry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.ring) < EntryBacklogSize {
+		h.ring = append(h.ring, entry)
+	} else {
+		h.ring[h.next] = entry
+		h.next = (h.next + 1) % EntryBacklogSize
+	}
+	for _, ch := range h.subscribers {
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// entryCore is a zap core feeding the structured entry stream.
+type entryCore struct {
+	zapcore.LevelEnabler
+	fields []zapcore.Field
+}
+
+func newEntryCore(level zapcore.LevelEnabler) zapcore.Core {
+	return &entryCore{LevelEnabler: level}
+}
+
+func (c *entryCore) With(fields []zapcore.Field) zapcore.Core {
+	merged := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	merged = append(merged, c.fields...)
+	merged = append(merged, fields...)
+	return &entryCore{LevelEnabler: c.LevelEnabler, fields: merged}
+}
+
+func (c *entryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *entryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	entry := Entry{
+		Time:    ent.Time,
+		Level:   ent.Level.String(),
+		Logger:  ent.LoggerName,
+		Message: ent.Message,
+	}
+	if len(c.fields)+len(fields) > 0 {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range c.fields {
+			f.AddTo(enc)
+		}
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+		entry.Fields = enc.Fields
+	}
+	globalEntryHub.publish(entry)
+	return nil
+}
+
+func (c *entryCore) Sync() error {
+	return nil
+}
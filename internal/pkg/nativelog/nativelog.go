@@ -30,6 +30,11 @@ const (
 
 var sessionStartedAt = time.Now()
 
+var (
+	writersMu sync.Mutex
+	writers   []*Writer
+)
+
 // ResolveDir resolves native log directory path.
 func ResolveDir() string {
 	if dir := strings.TrimSpace(os.Getenv(EnvLogDir)); dir != "" {
@@ -72,9 +77,25 @@ func NewWriter() (*Writer, error) {
 	if err := w.prepareTodayFile(); err != nil {
 		return nil, err
 	}
+	writersMu.Lock()
+	writers = append(writers, w)
+	writersMu.Unlock()
 	return w, nil
 }
 
+// ReloadRotateSettings re-reads the rotation env values into every live writer.
+func ReloadRotateSettings() {
+	maxSize, keep := resolveRotateMaxSize(), resolveRotateKeep()
+	writersMu.Lock()
+	defer writersMu.Unlock()
+	for _, w := range writers {
+		w.mu.Lock()
+		w.rotateMaxSize = maxSize
+		w.rotateKeep = keep
+		w.mu.Unlock()
+	}
+}
+
 func (w *Writer) Write(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
@@ -368,7 +389,7 @@ func parseSessionFileIndex(todayName, fileName string) (int, bool) {
 	return index, true
 }
 
-// NewZapLogger creates a zap logger with native log file output and realtime stream.
+// NewZapLogger creates a zap logger with native log file output and realtime streams.
 // Both console and file output use the pretty encoder with ANSI colors, because the
 // file output is also consumed by the real-time log stream (WebSocket) which renders
 // ANSI escape codes in the browser.
@@ -386,6 +407,7 @@ func NewZapLogger() (*zap.Logger, error) {
 	core := zapcore.NewTee(
 		zapcore.NewCore(consoleEncoder, zapcore.Lock(os.Stdout), level),
 		zapcore.NewCore(fileEncoder, zapcore.AddSync(writer), level),
+		newEntryCore(level),
 	)
 
 	logger := zap.New(core)
@@ -0,0 +1,136 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/jwt"
+	"github.com/mx-space/core/internal/pkg/response"
+	"gorm.io/gorm"
+)
+
+// Cursor mode is opt-in: a request with ?cursor= gets the page after the
+// cursor's (created_at, id) position instead of an OFFSET page, so deep pages
+// stay cheap and rows added meanwhile don't shift it. An empty ?cursor=
+// starts at the first page. Cursors are signed so clients can only pass
+// back positions the server handed out.
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a keyset position: the created_at and id of the last row of the
+// previous page. The zero Cursor is the start of the list.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// IsZero reports whether c is the start of the list.
+func (c Cursor) IsZero() bool {
+	return c.CreatedAt.IsZero() && c.ID == ""
+}
+
+// FromContextWithCursor is FromContext for lists that support cursor mode.
+// In cursor mode the returned Query has a non-nil Cursor. An invalid cursor,
+// or one combined with ?page=, gets a 400 response and false.
+func FromContextWithCursor(c *gin.Context) (Query, bool) {
+	q := FromContext(c)
+	raw, ok := c.GetQuery("cursor")
+	if !ok {
+		return q, true
+	}
+	if _, hasPage := c.GetQuery("page"); hasPage {
+		response.BadRequest(c, "cursor cannot be combined with page")
+		return q, false
+	}
+	cursor, err := DecodeCursor(raw)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return q, false
+	}
+	q.Page = DefaultPage
+	q.Cursor = &cursor
+	return q, true
+}
+
+// EncodeCursor signs c into an opaque cursor string.
+func EncodeCursor(c Cursor) string {
+	payload := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + "\n" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(jwt.Sum("cursor:"+payload))
+}
+
+// DecodeCursor verifies and decodes a cursor made by EncodeCursor. The empty
+// string decodes to the zero Cursor.
+func DecodeCursor(s string) (Cursor, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Cursor{}, nil
+	}
+	encoded, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return Cursor{}, errInvalidCursor
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, jwt.Sum("cursor:"+string(raw))) {
+		return Cursor{}, errInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), "\n")
+	if !ok {
+		return Cursor{}, errInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+	return Cursor{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+// After reports whether key comes after c in a list ordered by
+// (created_at, id), descending when desc is set.
+func (c Cursor) After(key Cursor, desc bool) bool {
+	if c.IsZero() {
+		return true
+	}
+	if !key.CreatedAt.Equal(c.CreatedAt) {
+		return key.CreatedAt.Before(c.CreatedAt) == desc
+	}
+	if desc {
+		return key.ID < c.ID
+	}
+	return key.ID > c.ID
+}
+
+// PaginateKeyset loads the page after q.Cursor. db must be ordered by
+// created_at, descending when desc is set; id is added as the tie-breaker.
+// key returns the position of a row.
+func PaginateKeyset[T any](db *gorm.DB, q Query, desc bool, dest *[]T, key func(T) Cursor) (response.CursorPagination, error) {
+	op, order := ">", "id ASC"
+	if desc {
+		op, order = "<", "id DESC"
+	}
+	tx := db.Order(order)
+	if q.Cursor != nil && !q.Cursor.IsZero() {
+		tx = tx.Where("(created_at "+op+" ? OR (created_at = ? AND id "+op+" ?))",
+			q.Cursor.CreatedAt, q.Cursor.CreatedAt, q.Cursor.ID)
+	}
+	if err := tx.Limit(q.Size + 1).Find(dest).Error; err != nil {
+		return response.CursorPagination{}, err
+	}
+
+	pag := response.CursorPagination{Size: q.Size}
+	if len(*dest) > q.Size {
+		*dest = (*dest)[:q.Size]
+		pag.HasNext = true
+		pag.NextCursor = EncodeCursor(key((*dest)[q.Size-1]))
+	}
+	return pag, nil
+}
@@ -18,6 +18,8 @@ const (
 type Query struct {
 	Page int
 	Size int
+	// Cursor is set in cursor mode; see FromContextWithCursor.
+	Cursor *Cursor
 }
 
 // FromContext extracts and validates pagination params from the request.
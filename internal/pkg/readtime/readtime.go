@@ -0,0 +1,61 @@
+// Package readtime estimates how long an article takes to read.
+package readtime
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// cjkPerMinute is the reading speed for Chinese, Japanese and Korean, counted
+	// per character.
+	cjkPerMinute = 300
+	// wordsPerMinute is the reading speed for space-separated languages.
+	wordsPerMinute = 200
+)
+
+// Stats is the size and estimated reading time of a text.
+type Stats struct {
+	// WordCount is the number of characters, matching the site word count.
+	WordCount int
+	// Minutes is rounded up; any non-empty text takes at least one minute.
+	Minutes int
+}
+
+// Estimate counts CJK characters and other words separately, since a CJK
+// character reads roughly like a word elsewhere.
+func Estimate(text string) Stats {
+	var cjk, words int
+	inWord := false
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			cjk++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if !inWord {
+				words++
+				inWord = true
+			}
+		default:
+			inWord = false
+		}
+	}
+
+	stats := Stats{WordCount: utf8.RuneCountInString(text)}
+	if cjk == 0 && words == 0 {
+		return stats
+	}
+	// Minutes = ceil(cjk/cjkPerMinute + words/wordsPerMinute), in integers.
+	const scale = cjkPerMinute * wordsPerMinute
+	units := cjk*wordsPerMinute + words*cjkPerMinute
+	stats.Minutes = (units + scale - 1) / scale
+	return stats
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	"go.uber.org/zap"
 )
 
@@ -59,6 +60,14 @@ type Pagination struct {
 	HasNextPage bool  `json:"has_next_page"`
 }
 
+// CursorPagination is the metadata of a cursor paginated response. Pass
+// NextCursor as ?cursor= to get the next page.
+type CursorPagination struct {
+	Size       int    `json:"size"`
+	HasNext    bool   `json:"has_next"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
 // pagedResponse is the envelope for paginated list responses.
 type pagedResponse struct {
 	Data       interface{} `json:"data"`
@@ -85,6 +94,14 @@ func Paged(c *gin.Context, data interface{}, pagination Pagination) {
 	})
 }
 
+// CursorPaged sends a cursor paginated response.
+func CursorPaged(c *gin.Context, data interface{}, pagination CursorPagination) {
+	c.JSON(http.StatusOK, gin.H{
+		"data":       data,
+		"pagination": pagination,
+	})
+}
+
 // Created sends a 201 response.
 func Created(c *gin.Context, data interface{}) {
 	c.JSON(http.StatusCreated, data)
@@ -143,7 +160,7 @@ func InternalError(c *gin.Context, err error) {
 	message := http.StatusText(http.StatusInternalServerError)
 	if err != nil {
 		message = err.Error()
-		zap.L().Named("HTTPResponse").Error("request failed",
+		tracing.GetLogger(c).Named("HTTPResponse").Error("request failed",
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.RequestURI()),
 			zap.String("ip", c.ClientIP()),
@@ -211,7 +228,13 @@ func ErrorLogged(c *gin.Context) bool {
 	return logged
 }
 
+// abortWithMessage writes the error envelope. It carries the request ID so a
+// user reporting an error can quote it and it can be found in the logs.
 func abortWithMessage(c *gin.Context, status int, message string) {
 	SetResponseMessage(c, message)
-	c.AbortWithStatusJSON(status, gin.H{"ok": 0, "code": status, "message": message})
+	body := gin.H{"ok": 0, "code": status, "message": message}
+	if id := tracing.TraceID(c); id != "" {
+		body["request_id"] = id
+	}
+	c.AbortWithStatusJSON(status, body)
 }
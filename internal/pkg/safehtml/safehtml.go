@@ -0,0 +1,211 @@
+// Package safehtml renders untrusted markdown, such as visitor comments, into
+// HTML that is safe to embed in a page.
+package safehtml
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	htmlrenderer "github.com/yuin/goldmark/renderer/html"
+	"golang.org/x/net/html"
+)
+
+// engine leaves raw HTML out of the output; Sanitize still runs afterwards so
+// safety does not hinge on renderer options.
+var engine = goldmark.New(
+	goldmark.WithExtensions(
+		extension.Strikethrough,
+		extension.Table,
+		extension.Linkify,
+	),
+	goldmark.WithRendererOptions(
+		htmlrenderer.WithHardWraps(),
+	),
+)
+
+// Markdown renders src and sanitizes the result. Rendering errors yield "".
+func Markdown(src string) string {
+	if strings.TrimSpace(src) == "" {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := engine.Convert([]byte(src), &buf); err != nil {
+		return ""
+	}
+	return Sanitize(buf.String())
+}
+
+// allowedAttrs lists the permitted elements and, for each, its permitted
+// attributes. Anything else is dropped, keeping the text inside.
+var allowedAttrs = map[string][]string{
+	"a":          {"href", "title"},
+	"p":          nil,
+	"br":         nil,
+	"hr":         nil,
+	"strong":     nil,
+	"b":          nil,
+	"em":         nil,
+	"i":          nil,
+	"del":        nil,
+	"s":          nil,
+	"code":       {"class"},
+	"pre":        nil,
+	"blockquote": nil,
+	"ul":         nil,
+	"ol":         {"start"},
+	"li":         nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"table":      nil,
+	"thead":      nil,
+	"tbody":      nil,
+	"tr":         nil,
+	"th":         {"align"},
+	"td":         {"align"},
+	"img":        {"src", "alt", "title"},
+}
+
+// droppedWithContent are removed along with everything inside them.
+var droppedWithContent = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+	"svg":      true,
+	"math":     true,
+}
+
+var (
+	codeClassPattern = regexp.MustCompile(`^language-[A-Za-z0-9_+#-]+$`)
+	alignPattern     = regexp.MustCompile(`^(left|right|center)$`)
+	startPattern     = regexp.MustCompile(`^[0-9]{1,9}$`)
+)
+
+// Sanitize keeps only allowlisted elements and attributes of s. Event handlers
+// and styles never pass, and links and images must use http(s), mailto for
+// links, or a relative URL. External links get rel="nofollow noopener".
+func Sanitize(s string) string {
+	z := html.NewTokenizer(strings.NewReader(s))
+	var out strings.Builder
+	skipping := ""
+	depth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return out.String()
+		}
+		tok := z.Token()
+		name := tok.Data
+
+		if skipping != "" {
+			switch {
+			case tt == html.StartTagToken && name == skipping:
+				depth++
+			case tt == html.EndTagToken && name == skipping:
+				depth--
+				if depth == 0 {
+					skipping = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			out.WriteString(html.EscapeString(tok.Data))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedWithContent[name] {
+				if tt == html.StartTagToken {
+					skipping, depth = name, 1
+				}
+				continue
+			}
+			if _, ok := allowedAttrs[name]; ok {
+				writeStartTag(&out, tok)
+			}
+		case html.EndTagToken:
+			if _, ok := allowedAttrs[name]; ok && !isVoid(name) {
+				out.WriteString("</" + name + ">")
+			}
+		}
+	}
+}
+
+func writeStartTag(out *strings.Builder, tok html.Token) {
+	out.WriteString("<" + tok.Data)
+	for _, attr := range tok.Attr {
+		if attr.Namespace != "" || !attrAllowed(tok.Data, attr.Key) {
+			continue
+		}
+		val, ok := attrValue(tok.Data, attr.Key, attr.Val)
+		if !ok {
+			continue
+		}
+		out.WriteString(" " + attr.Key + `="` + html.EscapeString(val) + `"`)
+	}
+	if tok.Data == "a" {
+		out.WriteString(` rel="nofollow noopener noreferrer"`)
+	}
+	out.WriteString(">")
+}
+
+func attrAllowed(tag, key string) bool {
+	for _, allowed := range allowedAttrs[tag] {
+		if key == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func attrValue(tag, key, val string) (string, bool) {
+	val = strings.TrimSpace(val)
+	switch key {
+	case "href":
+		return val, safeURL(val, true)
+	case "src":
+		return val, safeURL(val, false)
+	case "class":
+		return val, tag == "code" && codeClassPattern.MatchString(val)
+	case "align":
+		return val, alignPattern.MatchString(val)
+	case "start":
+		return val, startPattern.MatchString(val)
+	}
+	return val, true
+}
+
+// safeURL accepts relative URLs and http(s) ones, plus mailto when allowMail.
+func safeURL(raw string, allowMail bool) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "":
+		// Reject scheme-like prefixes url.Parse did not treat as a scheme.
+		return !strings.Contains(strings.SplitN(raw, "/", 2)[0], ":")
+	case "http", "https":
+		return true
+	case "mailto":
+		return allowMail
+	}
+	return false
+}
+
+func isVoid(tag string) bool {
+	return tag == "br" || tag == "hr" || tag == "img"
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+)
+
+const (
+	redisStatePrefix = "mx:session:state:"
+	// stateTTL bounds how long an active session is trusted without a DB
+	// check. Revocations write the cache directly, so this only matters
+	// when a revocation bypassed this package.
+	stateTTL      = 5 * time.Minute
+	revokedTTL    = DefaultTTL
+	stateTimeout  = time.Second
+	touchInterval = time.Minute
+	stateActive   = "1"
+	stateRevoked  = "0"
+)
+
+var lastTouch sync.Map // session ID -> time.Time
+
+// cachedState returns the cached state of a session; ok is false on a miss
+// or when Redis is unavailable.
+func cachedState(sessionID string) (active, ok bool) {
+	if pkgredis.Default == nil {
+		return false, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+	v, err := pkgredis.Default.Raw().Get(ctx, redisStatePrefix+sessionID).Result()
+	if err != nil {
+		return false, false
+	}
+	return v == stateActive, true
+}
+
+// cacheActive records the session as active until it expires, for at most
+// stateTTL. A session that has already expired is not cached.
+func cacheActive(sessionID string, expiresAt time.Time) {
+	if pkgredis.Default == nil {
+		return
+	}
+	ttl := min(stateTTL, time.Until(expiresAt))
+	if ttl <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+	// NX: a revocation racing with the DB check must win.
+	_ = pkgredis.Default.Raw().SetNX(ctx, redisStatePrefix+sessionID, stateActive, ttl).Err()
+}
+
+// cacheRevoked records the sessions as revoked on every worker.
+func cacheRevoked(sessionIDs ...string) {
+	if pkgredis.Default == nil || len(sessionIDs) == 0 {
+		return
+	}
+	for _, id := range sessionIDs {
+		lastTouch.Delete(id)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+	pipe := pkgredis.Default.Raw().Pipeline()
+	for _, id := range sessionIDs {
+		pipe.Set(ctx, redisStatePrefix+id, stateRevoked, revokedTTL)
+	}
+	_, _ = pipe.Exec(ctx)
+}
+
+// touchDue reports whether the session's last-seen time should be written,
+// and if so claims the write for this worker.
+func touchDue(sessionID string) bool {
+	now := time.Now()
+	if v, ok := lastTouch.Load(sessionID); ok && now.Sub(v.(time.Time)) < touchInterval {
+		return false
+	}
+	lastTouch.Store(sessionID, now)
+	return true
+}
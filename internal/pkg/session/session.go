@@ -40,26 +40,39 @@ func Issue(db *gorm.DB, userID, ip, ua string, ttl time.Duration) (string, *mode
 	return token, s, nil
 }
 
+// IsActive reports whether the session is neither revoked nor expired. The
+// answer is cached in Redis, so the hot path costs one GET; revocations
+// overwrite the cached state and take effect on every worker at once.
 func IsActive(db *gorm.DB, userID, sessionID string) (bool, error) {
 	sessionID = strings.TrimSpace(sessionID)
 	if sessionID == "" {
 		// Legacy token without sid.
 		return true, nil
 	}
+	if active, ok := cachedState(sessionID); ok {
+		return active, nil
+	}
 
-	var count int64
-	err := db.Model(&models.UserSession{}).
+	var s models.UserSession
+	err := db.Select("id, expires_at").
 		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
-		Count(&count).Error
+		Limit(1).Find(&s).Error
 	if err != nil {
 		return false, err
 	}
-	return count > 0, nil
+	if s.ID == "" {
+		cacheRevoked(sessionID)
+		return false, nil
+	}
+	cacheActive(sessionID, s.ExpiresAt)
+	return true, nil
 }
 
+// Touch records the session as seen now. Writes are throttled to one per
+// touchInterval per session and worker.
 func Touch(db *gorm.DB, userID, sessionID string) {
 	sessionID = strings.TrimSpace(sessionID)
-	if sessionID == "" {
+	if sessionID == "" || !touchDue(sessionID) {
 		return
 	}
 	_ = db.Model(&models.UserSession{}).
@@ -86,6 +99,7 @@ func Revoke(db *gorm.DB, userID, sessionID string) error {
 	if res.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
+	cacheRevoked(sessionID)
 	return nil
 }
 
@@ -104,11 +118,25 @@ func RevokeAfter(db *gorm.DB, userID, sessionID string, delay time.Duration) {
 }
 
 func RevokeAllExcept(db *gorm.DB, userID, keepSessionID string) error {
-	now := time.Now()
 	query := db.Model(&models.UserSession{}).
 		Where("user_id = ? AND revoked_at IS NULL", userID)
 	if strings.TrimSpace(keepSessionID) != "" {
 		query = query.Where("id <> ?", keepSessionID)
 	}
-	return query.Update("revoked_at", &now).Error
+	var ids []string
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now()
+	err := db.Model(&models.UserSession{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Update("revoked_at", &now).Error
+	if err != nil {
+		return err
+	}
+	cacheRevoked(ids...)
+	return nil
 }
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	pkgredis "github.com/mx-space/core/internal/pkg/redis"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestRedis points pkgredis.Default at a fresh miniredis for the test.
+func useTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	prev := pkgredis.Default
+	rc, err := pkgredis.Connect("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = rc.Raw().Close()
+		pkgredis.Default = prev
+	})
+	return mr
+}
+
+func TestIsActiveDoesNotCacheSessionPastItsExpiry(t *testing.T) {
+	mr := useTestRedis(t)
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The session expires well inside the stateTTL cache window.
+	expiresAt := time.Now().Add(2 * time.Second)
+	query := regexp.QuoteMeta("SELECT id, expires_at FROM `user_sessions`")
+	mock.ExpectQuery(query).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "expires_at"}).AddRow("s1", expiresAt))
+	mock.ExpectQuery(query).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "expires_at"}))
+
+	if active, err := IsActive(db, "u1", "s1"); err != nil || !active {
+		t.Fatalf("IsActive = %v, %v; want true", active, err)
+	}
+	if ttl := mr.TTL(redisStatePrefix + "s1"); ttl <= 0 || ttl > 2*time.Second {
+		t.Fatalf("cached for %v, want at most until the session expires", ttl)
+	}
+
+	mr.FastForward(3 * time.Second)
+	if active, err := IsActive(db, "u1", "s1"); err != nil || active {
+		t.Fatalf("IsActive after expiry = %v, %v; want false", active, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheActiveSkipsExpiredSession(t *testing.T) {
+	mr := useTestRedis(t)
+
+	cacheActive("s1", time.Now().Add(-time.Second))
+	if mr.Exists(redisStatePrefix + "s1") {
+		t.Fatal("an expired session must not be cached as active")
+	}
+}
@@ -0,0 +1,317 @@
+package taskqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mx-space/core/internal/pkg/tracing"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Task execution. Modules register a handler per task type at startup and
+// Enqueue only stores the task; the dispatcher started with Run claims
+// pending tasks oldest first and runs them, within the per-type concurrency
+// limit of this process. A task is claimed by removing it from the pending
+// set, so in cluster mode each task runs on exactly one worker.
+//
+// While a task runs its worker keeps a short-lived lease on it. A running
+// task without a lease was interrupted by a crash: it is put back to pending,
+// or failed once it has been interrupted MaxResets times.
+const (
+	keyPending     = "mx:tasks:pending" // sorted set: score=created_at, member=task_id
+	keyLeasePrefix = "mx:task:lease:"
+
+	leaseTTL             = 30 * time.Second
+	leaseRefreshInterval = 10 * time.Second
+	dispatchInterval     = time.Second
+	recoverInterval      = time.Minute
+
+	// MaxResets is how many times an interrupted task is put back to
+	// pending before it is failed instead.
+	MaxResets = 3
+)
+
+// HandlerFunc runs a task. The result is stored on the task when it
+// completes; an error fails the task with the error's message. ctx carries
+// the trace ID of the request that enqueued the task and is cancelled when
+// the task is cancelled or deleted while running.
+type HandlerFunc func(ctx context.Context, task *Task) (interface{}, error)
+
+type registration struct {
+	handler     HandlerFunc
+	concurrency int
+}
+
+// RegisterOption configures a registered task type.
+type RegisterOption func(*registration)
+
+// WithConcurrency limits how many tasks of the type run at once in each
+// process. The default is 1.
+func WithConcurrency(n int) RegisterOption {
+	return func(r *registration) {
+		if n > 0 {
+			r.concurrency = n
+		}
+	}
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*registration{}
+)
+
+// Register sets the handler running tasks of taskType. Registering a type
+// again replaces its handler. Tasks of types without a handler stay pending.
+func Register(taskType string, handler HandlerFunc, opts ...RegisterOption) {
+	r := &registration{handler: handler, concurrency: 1}
+	for _, o := range opts {
+		o(r)
+	}
+	registryMu.Lock()
+	registry[taskType] = r
+	registryMu.Unlock()
+}
+
+func lookup(taskType string) (*registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[taskType]
+	return r, ok
+}
+
+func (s *Service) leaseKey(id string) string { return keyLeasePrefix + id }
+
+// Run recovers interrupted tasks and dispatches pending tasks to their
+// handlers until ctx is done. Tasks still running then are put back to
+// pending for the next process to pick up.
+func (s *Service) Run(ctx context.Context) {
+	if err := s.BackfillIndexes(ctx); err != nil {
+		s.logger.Warn("backfill task indexes failed", zap.Error(err))
+	}
+	s.recoverInterrupted(ctx)
+
+	dispatchTicker := time.NewTicker(dispatchInterval)
+	defer dispatchTicker.Stop()
+	recoverTicker := time.NewTicker(recoverInterval)
+	defer recoverTicker.Stop()
+	for {
+		s.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-recoverTicker.C:
+			s.recoverInterrupted(ctx)
+		case <-dispatchTicker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// notify wakes the local dispatcher after an enqueue.
+func (s *Service) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) dispatch(ctx context.Context) {
+	ids, err := s.rc.Raw().ZRange(ctx, keyPending, 0, -1).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warn("list pending tasks failed", zap.Error(err))
+		}
+		return
+	}
+	for _, id := range ids {
+		task, err := s.GetByID(ctx, id)
+		if err != nil {
+			continue
+		}
+		if task == nil || task.Status != TaskPending {
+			// Expired, or finished without going through the dispatcher.
+			s.rc.Raw().ZRem(ctx, keyPending, id)
+			continue
+		}
+		reg, ok := lookup(task.Type)
+		if !ok || !s.acquire(task.Type, reg.concurrency) {
+			continue
+		}
+		claimed, err := s.rc.Raw().ZRem(ctx, keyPending, id).Result()
+		if err != nil || claimed == 0 {
+			s.release(task.Type)
+			continue
+		}
+		go s.execute(ctx, task, reg.handler)
+	}
+}
+
+func (s *Service) acquire(taskType string, limit int) bool {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	if s.running[taskType] >= limit {
+		return false
+	}
+	s.running[taskType]++
+	return true
+}
+
+func (s *Service) release(taskType string) {
+	s.runningMu.Lock()
+	s.running[taskType]--
+	s.runningMu.Unlock()
+}
+
+// execute runs claimed, which the dispatcher has already removed from
+// pending and holds a concurrency slot for.
+func (s *Service) execute(ctx context.Context, claimed *Task, handler HandlerFunc) {
+	defer s.release(claimed.Type)
+	id := claimed.ID
+	task, err := s.GetByID(ctx, id)
+	if err != nil {
+		s.logger.Warn("load claimed task failed", zap.String("task_id", id), zap.Error(err))
+		s.unclaim(context.Background(), claimed)
+		return
+	}
+	// Deleted, or cancelled between the dispatcher reading it and claiming it.
+	if task == nil || task.Status != TaskPending {
+		return
+	}
+	// Take the lease before marking the task running, so recovery never
+	// sees it running without one.
+	if err := s.rc.Raw().Set(ctx, s.leaseKey(id), s.instanceID, leaseTTL).Err(); err != nil {
+		s.logger.Warn("lease task failed", zap.String("task_id", id), zap.Error(err))
+		s.unclaim(context.Background(), task)
+		return
+	}
+	task.Status = TaskRunning
+	task.UpdatedAt = time.Now()
+	if err := s.save(ctx, task); err != nil {
+		s.logger.Warn("start task failed", zap.String("task_id", id), zap.Error(err))
+		s.rc.Raw().Del(context.Background(), s.leaseKey(id))
+		s.requeue(context.Background(), task)
+		return
+	}
+	s.publishProgress(task)
+
+	runCtx, cancel := context.WithCancel(tracing.WithTraceID(ctx, task.TraceID))
+	defer cancel()
+	done := make(chan struct{})
+	go s.keepLease(runCtx, cancel, id, done)
+	result, err := runHandler(runCtx, handler, task)
+	close(done)
+
+	// ctx may be done by now; the final writes must still happen.
+	bg := context.Background()
+	s.rc.Raw().Del(bg, s.leaseKey(id))
+	if err != nil && ctx.Err() != nil {
+		s.requeue(bg, task)
+		return
+	}
+	current, getErr := s.GetByID(bg, id)
+	if getErr != nil || current == nil || current.Status != TaskRunning {
+		// Cancelled or deleted while running.
+		return
+	}
+	if err != nil {
+		tracing.GetLogger(runCtx).Warn("task failed", zap.String("task_id", id),
+			zap.String("type", task.Type), zap.Error(err))
+		s.UpdateStatus(bg, id, TaskFailed, nil, err.Error())
+		return
+	}
+	s.UpdateStatus(bg, id, TaskCompleted, result, "")
+}
+
+func runHandler(ctx context.Context, handler HandlerFunc, task *Task) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return handler(ctx, task)
+}
+
+// keepLease refreshes the lease of a running task until done, and cancels
+// the task's context once it is no longer running.
+func (s *Service) keepLease(ctx context.Context, cancel context.CancelFunc, id string, done <-chan struct{}) {
+	ticker := time.NewTicker(leaseRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.rc.Raw().Set(ctx, s.leaseKey(id), s.instanceID, leaseTTL)
+			task, err := s.GetByID(ctx, id)
+			if err == nil && (task == nil || task.Status != TaskRunning) {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// requeue puts task back to pending, dropping the progress of the
+// interrupted run.
+func (s *Service) requeue(ctx context.Context, task *Task) {
+	task.Status = TaskPending
+	task.Progress = 0
+	task.ProgressMessage = ""
+	task.UpdatedAt = time.Now()
+	s.forgetProgress(task.ID)
+	if err := s.save(ctx, task); err != nil {
+		s.logger.Warn("requeue task failed", zap.String("task_id", task.ID), zap.Error(err))
+		return
+	}
+	s.publishProgress(task)
+	s.rc.Raw().ZAdd(ctx, keyPending, redis.Z{
+		Score:  float64(task.CreatedAt.UnixMilli()),
+		Member: task.ID,
+	})
+	s.notify()
+}
+
+// unclaim puts a claimed task that never started back to pending.
+func (s *Service) unclaim(ctx context.Context, task *Task) {
+	s.rc.Raw().ZAdd(ctx, keyPending, redis.Z{
+		Score:  float64(task.CreatedAt.UnixMilli()),
+		Member: task.ID,
+	})
+}
+
+// recoverInterrupted resets running tasks whose worker no longer holds
+// their lease.
+func (s *Service) recoverInterrupted(ctx context.Context) {
+	ids, err := s.rc.Raw().ZRange(ctx, keyIndex, 0, -1).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warn("list tasks for recovery failed", zap.Error(err))
+		}
+		return
+	}
+	for _, id := range ids {
+		task, err := s.GetByID(ctx, id)
+		if err != nil || task == nil || task.Status != TaskRunning {
+			continue
+		}
+		leased, err := s.rc.Raw().Exists(ctx, s.leaseKey(id)).Result()
+		if err != nil || leased > 0 {
+			continue
+		}
+		if task.Resets >= MaxResets {
+			s.logger.Warn("task interrupted too many times, giving up",
+				zap.String("task_id", id), zap.String("type", task.Type), zap.Int("resets", task.Resets))
+			s.UpdateStatus(ctx, id, TaskFailed, nil, "task interrupted too many times")
+			continue
+		}
+		task.Resets++
+		s.logger.Info("resuming interrupted task",
+			zap.String("task_id", id), zap.String("type", task.Type), zap.Int("resets", task.Resets))
+		s.requeue(ctx, task)
+	}
+}
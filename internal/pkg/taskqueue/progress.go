@@ -0,0 +1,129 @@
+package taskqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// EventProgress is broadcast to the admin room on every progress or
+	// status change of a task.
+	EventProgress = "task#progress"
+
+	// progressInterval is the minimum time between two stored progress
+	// updates of a task; updates in between are dropped.
+	progressInterval = 500 * time.Millisecond
+
+	// progressMaxRetries bounds how often UpdateProgress retries after the
+	// task changed between its read and write.
+	progressMaxRetries = 3
+)
+
+var errTaskNotFound = errors.New("task not found")
+
+// ProgressEvent is the payload of EventProgress.
+type ProgressEvent struct {
+	ID       string     `json:"id"`
+	Type     string     `json:"type"`
+	Status   TaskStatus `json:"status"`
+	Progress int        `json:"progress"`
+	Message  string     `json:"message,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// WithBroadcaster sets the function publishing EventProgress, normally the
+// gateway's admin broadcast.
+func WithBroadcaster(fn func(event string, payload interface{})) ServiceOption {
+	return func(s *Service) { s.broadcast = fn }
+}
+
+// UpdateProgress records how far a running task has got, as a percentage
+// with an optional message. Updates less than progressInterval after the
+// previous one are dropped, except for 100. Updates of tasks that are no
+// longer running are ignored. The read and write run under WATCH, so a
+// concurrent cancel or completion is never overwritten with the old status.
+func (s *Service) UpdateProgress(ctx context.Context, id string, progress int, message string) error {
+	progress = max(0, min(progress, 100))
+
+	now := time.Now()
+	s.progressMu.Lock()
+	if progress < 100 && now.Sub(s.progressAt[id]) < progressInterval {
+		s.progressMu.Unlock()
+		return nil
+	}
+	s.progressAt[id] = now
+	s.progressMu.Unlock()
+
+	key := s.taskKey(id)
+	var updated *Task
+	update := func(tx *redis.Tx) error {
+		updated = nil
+		data, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return errTaskNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var task Task
+		if err := json.Unmarshal(data, &task); err != nil {
+			return err
+		}
+		if task.Status != TaskRunning {
+			return nil
+		}
+		task.Progress = progress
+		task.ProgressMessage = message
+		task.UpdatedAt = now
+		encoded, err := json.Marshal(&task)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, encoded, taskTTL)
+			return nil
+		})
+		if err == nil {
+			updated = &task
+		}
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt < progressMaxRetries; attempt++ {
+		if err = s.rc.Raw().Watch(ctx, update, key); err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if updated != nil {
+		s.publishProgress(updated)
+	}
+	return nil
+}
+
+func (s *Service) forgetProgress(id string) {
+	s.progressMu.Lock()
+	delete(s.progressAt, id)
+	s.progressMu.Unlock()
+}
+
+func (s *Service) publishProgress(task *Task) {
+	if s.broadcast == nil {
+		return
+	}
+	s.broadcast(EventProgress, ProgressEvent{
+		ID:       task.ID,
+		Type:     task.Type,
+		Status:   task.Status,
+		Progress: task.Progress,
+		Message:  task.ProgressMessage,
+		Error:    task.Error,
+	})
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mx-space/core/internal/pkg/pagination"
 	redisc "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/mx-space/core/internal/pkg/response"
+	"github.com/mx-space/core/internal/pkg/tracing"
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
 // TaskStatus represents the lifecycle state of a task.
@@ -24,37 +30,90 @@ const (
 
 // Task is a unit of background work stored in Redis.
 type Task struct {
-	ID        string          `json:"id"`
-	Type      string          `json:"type"`
-	Payload   json.RawMessage `json:"payload"`
-	Status    TaskStatus      `json:"status"`
-	Result    json.RawMessage `json:"result,omitempty"`
-	Error     string          `json:"error,omitempty"`
-	DedupKey  string          `json:"dedup_key,omitempty"`
-	GroupKey  string          `json:"group_key,omitempty"`
-	CreatedAt time.Time       `json:"created_at"`
-	UpdatedAt time.Time       `json:"updated_at"`
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Payload         json.RawMessage `json:"payload"`
+	Status          TaskStatus      `json:"status"`
+	Progress        int             `json:"progress"` // 0-100, reported by the handler
+	ProgressMessage string          `json:"progress_message,omitempty"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	DedupKey        string          `json:"dedup_key,omitempty"`
+	GroupKey        string          `json:"group_key,omitempty"`
+	TraceID         string          `json:"trace_id,omitempty"` // request that enqueued the task
+	Resets          int             `json:"resets,omitempty"`   // times put back to pending after a crash
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
 }
 
 const (
 	keyPrefix   = "mx:task:"
-	keyIndex    = "mx:tasks:index"   // sorted set: score=created_at, member=task_id
-	keyDedupSet = "mx:tasks:dedup:"  // hash: dedup_key -> task_id
-	taskTTL     = 7 * 24 * time.Hour // tasks expire after 7 days
+	keyIndex    = "mx:tasks:index"  // sorted set: score=created_at, member=task_id
+	keyDedupSet = "mx:tasks:dedup:" // hash: dedup_key -> task_id
+	// keyDedupLast keeps the latest task per dedup key past completion, for
+	// lookups; keyDedupSet only holds unfinished tasks.
+	keyDedupLast = "mx:tasks:dedup-last:" // hash: dedup_key -> task_id
+	keyGroup     = "mx:tasks:group:"      // sorted set: score=created_at, member=task_id
+	taskTTL      = 7 * 24 * time.Hour     // tasks expire after 7 days
+	// keyIndexesBuilt marks that tasks stored before the group and dedup-last
+	// indexes existed have been added to them.
+	keyIndexesBuilt = "mx:tasks:indexes-built"
+
+	groupBatchSize = 500
 )
 
 // Service manages the Redis-backed task queue.
 type Service struct {
-	rc *redisc.Client
+	rc         *redisc.Client
+	logger     *zap.Logger
+	instanceID string
+	wake       chan struct{}
+	broadcast  func(event string, payload interface{})
+
+	progressMu sync.Mutex
+	progressAt map[string]time.Time // task ID -> last stored progress update
+
+	runningMu sync.Mutex
+	running   map[string]int // task type -> tasks running in this process
 }
 
-func NewService(rc *redisc.Client) *Service {
-	return &Service{rc: rc}
+// ServiceOption configures a Service.
+type ServiceOption func(*Service)
+
+// WithLogger sets the logger for the task queue.
+func WithLogger(l *zap.Logger) ServiceOption {
+	return func(s *Service) {
+		if l != nil {
+			s.logger = l.Named("TaskQueue")
+		}
+	}
+}
+
+func NewService(rc *redisc.Client, opts ...ServiceOption) *Service {
+	s := &Service{
+		rc:         rc,
+		logger:     zap.NewNop(),
+		instanceID: uuid.New().String(),
+		wake:       make(chan struct{}, 1),
+		running:    make(map[string]int),
+		progressAt: make(map[string]time.Time),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
 }
 
 func (s *Service) taskKey(id string) string { return keyPrefix + id }
 
-// Enqueue creates a new task, respecting deduplication.
+// Context returns a background context carrying the trace ID of the request that
+// enqueued t, so task logs and outbound calls can be joined back to it.
+func (t *Task) Context() context.Context {
+	return tracing.WithTraceID(context.Background(), t.TraceID)
+}
+
+// Enqueue creates a new pending task, respecting deduplication. It runs once
+// the dispatcher picks it up; see Register.
 func (s *Service) Enqueue(ctx context.Context, taskType string, payload interface{}, dedupKey, groupKey string) (*Task, error) {
 	if dedupKey != "" {
 		existing, err := s.rc.Raw().HGet(ctx, keyDedupSet+taskType, dedupKey).Result()
@@ -75,6 +134,7 @@ func (s *Service) Enqueue(ctx context.Context, taskType string, payload interfac
 		Status:    TaskPending,
 		DedupKey:  dedupKey,
 		GroupKey:  groupKey,
+		TraceID:   tracing.TraceID(ctx),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -90,12 +150,34 @@ func (s *Service) Enqueue(ctx context.Context, taskType string, payload interfac
 		Score:  float64(task.CreatedAt.UnixMilli()),
 		Member: task.ID,
 	})
+	pipe.ZAdd(ctx, keyPending, redis.Z{
+		Score:  float64(task.CreatedAt.UnixMilli()),
+		Member: task.ID,
+	})
 	if dedupKey != "" {
 		pipe.HSet(ctx, keyDedupSet+taskType, dedupKey, task.ID)
 		pipe.Expire(ctx, keyDedupSet+taskType, taskTTL)
+		pipe.HSet(ctx, keyDedupLast+taskType, dedupKey, task.ID)
+		pipe.Expire(ctx, keyDedupLast+taskType, taskTTL)
 	}
-	_, err = pipe.Exec(ctx)
-	return task, err
+	if groupKey != "" {
+		pipe.ZAdd(ctx, keyGroup+groupKey, redis.Z{
+			Score:  float64(task.CreatedAt.UnixMilli()),
+			Member: task.ID,
+		})
+		pipe.Expire(ctx, keyGroup+groupKey, taskTTL)
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return task, err
+	}
+	s.notify()
+	return task, nil
+}
+
+// Retry enqueues task again under its type with its original payload and
+// keys.
+func (s *Service) Retry(ctx context.Context, task *Task) (*Task, error) {
+	return s.Enqueue(ctx, task.Type, task.Payload, task.DedupKey, task.GroupKey)
 }
 
 // GetByID retrieves a task by its ID.
@@ -125,25 +207,94 @@ func (s *Service) UpdateStatus(ctx context.Context, id string, status TaskStatus
 	if result != nil {
 		task.Result, _ = json.Marshal(result)
 	}
+	if status == TaskCompleted {
+		task.Progress = 100
+	}
 
-	if (status == TaskCompleted || status == TaskFailed || status == TaskCancelled) && task.DedupKey != "" {
-		s.rc.Raw().HDel(ctx, keyDedupSet+task.Type, task.DedupKey)
+	if status == TaskCompleted || status == TaskFailed || status == TaskCancelled {
+		s.rc.Raw().ZRem(ctx, keyPending, id)
+		if task.DedupKey != "" {
+			s.rc.Raw().HDel(ctx, keyDedupSet+task.Type, task.DedupKey)
+		}
+		s.forgetProgress(id)
+	}
+	if err := s.save(ctx, task); err != nil {
+		return err
 	}
+	s.publishProgress(task)
+	return nil
+}
 
+func (s *Service) save(ctx context.Context, task *Task) error {
 	data, err := json.Marshal(task)
 	if err != nil {
 		return err
 	}
-	return s.rc.Raw().Set(ctx, s.taskKey(id), data, taskTTL).Err()
+	return s.rc.Raw().Set(ctx, s.taskKey(task.ID), data, taskTTL).Err()
 }
 
 // List returns tasks matching optional filters, ordered by creation time descending.
 func (s *Service) List(ctx context.Context, page, size int, taskType *string, status *TaskStatus) ([]*Task, int64, error) {
-	ids, err := s.rc.Raw().ZRevRange(ctx, keyIndex, 0, -1).Result()
+	tasks, err := s.filtered(ctx, taskType, status)
 	if err != nil {
 		return nil, 0, err
 	}
 
+	total := int64(len(tasks))
+	start := (page - 1) * size
+	end := start + size
+	if start >= len(tasks) {
+		return []*Task{}, total, nil
+	}
+	if end > len(tasks) {
+		end = len(tasks)
+	}
+	return tasks[start:end], total, nil
+}
+
+// ListAfter is List in cursor mode: it returns the tasks matching the
+// optional filters after q.Cursor in (created_at, id) descending order.
+func (s *Service) ListAfter(ctx context.Context, q pagination.Query, taskType *string, status *TaskStatus) ([]*Task, response.CursorPagination, error) {
+	tasks, err := s.filtered(ctx, taskType, status)
+	if err != nil {
+		return nil, response.CursorPagination{}, err
+	}
+	// The index scores are milliseconds, so order exactly by the keys here.
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return taskCursor(tasks[j]).After(taskCursor(tasks[i]), true)
+	})
+
+	var cursor pagination.Cursor
+	if q.Cursor != nil {
+		cursor = *q.Cursor
+	}
+	pag := response.CursorPagination{Size: q.Size}
+	page := make([]*Task, 0, q.Size)
+	for _, task := range tasks {
+		if !cursor.After(taskCursor(task), true) {
+			continue
+		}
+		if len(page) == q.Size {
+			pag.HasNext = true
+			pag.NextCursor = pagination.EncodeCursor(taskCursor(page[len(page)-1]))
+			break
+		}
+		page = append(page, task)
+	}
+	return page, pag, nil
+}
+
+func taskCursor(t *Task) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: t.CreatedAt, ID: t.ID}
+}
+
+// filtered loads the tasks matching the optional filters, newest first.
+func (s *Service) filtered(ctx context.Context, taskType *string, status *TaskStatus) ([]*Task, error) {
+	ids, err := s.rc.Raw().ZRevRange(ctx, keyIndex, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
 	var tasks []*Task
 	for _, id := range ids {
 		task, err := s.GetByID(ctx, id)
@@ -158,17 +309,171 @@ func (s *Service) List(ctx context.Context, page, size int, taskType *string, st
 		}
 		tasks = append(tasks, task)
 	}
+	return tasks, nil
+}
 
-	total := int64(len(tasks))
-	start := (page - 1) * size
-	end := start + size
-	if start >= len(tasks) {
+// CountByStatus counts tasks per type and status in one round trip.
+func (s *Service) CountByStatus(ctx context.Context) (map[string]map[TaskStatus]int, error) {
+	ids, err := s.rc.Raw().ZRange(ctx, keyIndex, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.loadTasks(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]map[TaskStatus]int{}
+	for _, task := range tasks {
+		if task == nil {
+			continue
+		}
+		if counts[task.Type] == nil {
+			counts[task.Type] = map[TaskStatus]int{}
+		}
+		counts[task.Type][task.Status]++
+	}
+	return counts, nil
+}
+
+// ListByGroup returns a page of the tasks enqueued with groupKey, newest
+// first, and how many there are.
+func (s *Service) ListByGroup(ctx context.Context, groupKey string, page, size int) ([]*Task, int64, error) {
+	key := keyGroup + groupKey
+	total, err := s.rc.Raw().ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	start := int64((page - 1) * size)
+	if start >= total {
 		return []*Task{}, total, nil
 	}
-	if end > len(tasks) {
-		end = len(tasks)
+	ids, err := s.rc.Raw().ZRevRange(ctx, key, start, start+int64(size)-1).Result()
+	if err != nil {
+		return nil, 0, err
 	}
-	return tasks[start:end], total, nil
+	loaded, err := s.loadTasks(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	tasks := make([]*Task, 0, len(loaded))
+	for i, task := range loaded {
+		if task == nil {
+			// Expired: drop it from the group.
+			s.rc.Raw().ZRem(ctx, key, ids[i])
+			total--
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, total, nil
+}
+
+// GetByDedupKey returns the latest task of taskType enqueued with dedupKey,
+// finished or not, or nil if there is none.
+func (s *Service) GetByDedupKey(ctx context.Context, taskType, dedupKey string) (*Task, error) {
+	id, err := s.rc.Raw().HGet(ctx, keyDedupLast+taskType, dedupKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	task, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		s.rc.Raw().HDel(ctx, keyDedupLast+taskType, dedupKey)
+	}
+	return task, nil
+}
+
+// CancelGroup cancels the pending and running tasks enqueued with groupKey
+// and returns how many it cancelled. Tasks are read and written in batches
+// of groupBatchSize.
+func (s *Service) CancelGroup(ctx context.Context, groupKey string) (int, error) {
+	ids, err := s.rc.Raw().ZRange(ctx, keyGroup+groupKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	cancelled := 0
+	for start := 0; start < len(ids); start += groupBatchSize {
+		end := min(start+groupBatchSize, len(ids))
+		n, err := s.cancelBatch(ctx, ids[start:end])
+		cancelled += n
+		if err != nil {
+			return cancelled, err
+		}
+	}
+	return cancelled, nil
+}
+
+func (s *Service) cancelBatch(ctx context.Context, ids []string) (int, error) {
+	tasks, err := s.loadTasks(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	var changed []*Task
+	pipe := s.rc.Raw().TxPipeline()
+	for _, task := range tasks {
+		if task == nil || (task.Status != TaskPending && task.Status != TaskRunning) {
+			continue
+		}
+		task.Status = TaskCancelled
+		task.Error = "cancelled by group"
+		task.UpdatedAt = now
+		data, err := json.Marshal(task)
+		if err != nil {
+			continue
+		}
+		pipe.Set(ctx, s.taskKey(task.ID), data, taskTTL)
+		pipe.ZRem(ctx, keyPending, task.ID)
+		if task.DedupKey != "" {
+			pipe.HDel(ctx, keyDedupSet+task.Type, task.DedupKey)
+		}
+		changed = append(changed, task)
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	for _, task := range changed {
+		s.forgetProgress(task.ID)
+		s.publishProgress(task)
+	}
+	return len(changed), nil
+}
+
+// loadTasks reads the tasks with ids in one round trip. Missing tasks are
+// nil in the result.
+func (s *Service) loadTasks(ctx context.Context, ids []string) ([]*Task, error) {
+	tasks := make([]*Task, len(ids))
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.taskKey(id)
+	}
+	values, err := s.rc.Raw().MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var task Task
+		if err := json.Unmarshal([]byte(raw), &task); err != nil {
+			continue
+		}
+		tasks[i] = &task
+	}
+	return tasks, nil
 }
 
 // Cancel marks a task as cancelled if it is still pending.
@@ -192,9 +497,8 @@ func (s *Service) DeleteByID(ctx context.Context, id string) error {
 	pipe := s.rc.Raw().TxPipeline()
 	pipe.Del(ctx, s.taskKey(id))
 	pipe.ZRem(ctx, keyIndex, id)
-	if task.DedupKey != "" {
-		pipe.HDel(ctx, keyDedupSet+task.Type, task.DedupKey)
-	}
+	pipe.ZRem(ctx, keyPending, id)
+	s.unindex(ctx, pipe, task)
 	_, err = pipe.Exec(ctx)
 	return err
 }
@@ -216,10 +520,72 @@ func (s *Service) DeleteCompleted(ctx context.Context, beforeMS int64) error {
 		}
 		pipe.Del(ctx, s.taskKey(id))
 		pipe.ZRem(ctx, keyIndex, id)
+		s.unindex(ctx, pipe, task)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// BackfillIndexes adds the tasks in the main index to the group and
+// dedup-last indexes, for tasks enqueued before those indexes existed. It
+// runs once per Redis database; later calls return right away.
+func (s *Service) BackfillIndexes(ctx context.Context) error {
+	ok, err := s.rc.Raw().SetNX(ctx, keyIndexesBuilt, time.Now().Unix(), 0).Result()
+	if err != nil || !ok {
+		return err
+	}
+	// Oldest first, so the newest task of each dedup key is written last.
+	ids, err := s.rc.Raw().ZRange(ctx, keyIndex, 0, -1).Result()
+	if err != nil {
+		s.rc.Raw().Del(ctx, keyIndexesBuilt)
+		return err
+	}
+	for start := 0; start < len(ids); start += groupBatchSize {
+		end := min(start+groupBatchSize, len(ids))
+		if err := s.backfillBatch(ctx, ids[start:end]); err != nil {
+			s.rc.Raw().Del(ctx, keyIndexesBuilt)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) backfillBatch(ctx context.Context, ids []string) error {
+	tasks, err := s.loadTasks(ctx, ids)
+	if err != nil {
+		return err
+	}
+	pipe := s.rc.Raw().Pipeline()
+	for _, task := range tasks {
+		if task == nil {
+			continue
+		}
 		if task.DedupKey != "" {
-			pipe.HDel(ctx, keyDedupSet+task.Type, task.DedupKey)
+			pipe.HSet(ctx, keyDedupLast+task.Type, task.DedupKey, task.ID)
+			pipe.Expire(ctx, keyDedupLast+task.Type, taskTTL)
+		}
+		if task.GroupKey != "" {
+			pipe.ZAdd(ctx, keyGroup+task.GroupKey, redis.Z{
+				Score:  float64(task.CreatedAt.UnixMilli()),
+				Member: task.ID,
+			})
+			pipe.Expire(ctx, keyGroup+task.GroupKey, taskTTL)
 		}
 	}
-	_, err := pipe.Exec(ctx)
+	_, err = pipe.Exec(ctx)
 	return err
 }
+
+// unindex removes a deleted task from the dedup and group indexes.
+func (s *Service) unindex(ctx context.Context, pipe redis.Pipeliner, task *Task) {
+	if task.DedupKey != "" {
+		pipe.HDel(ctx, keyDedupSet+task.Type, task.DedupKey)
+		// Keep the entry if a newer task took the key over.
+		if last, _ := s.rc.Raw().HGet(ctx, keyDedupLast+task.Type, task.DedupKey).Result(); last == task.ID {
+			pipe.HDel(ctx, keyDedupLast+task.Type, task.DedupKey)
+		}
+	}
+	if task.GroupKey != "" {
+		pipe.ZRem(ctx, keyGroup+task.GroupKey, task.ID)
+	}
+}
@@ -0,0 +1,221 @@
+package taskqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redisc "github.com/mx-space/core/internal/pkg/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestService(t *testing.T) (*Service, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := redisc.Connect("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = rc.Raw().Close() })
+	return NewService(rc), mr
+}
+
+const manyTasks = 1200
+
+func TestListByGroupPagesPastThousand(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	for i := 0; i < manyTasks; i++ {
+		if _, err := s.Enqueue(ctx, "ai:summary", i, "", "article-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Enqueue(ctx, "ai:summary", "other", "", "article-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, total, err := s.ListByGroup(ctx, "article-1", 12, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != manyTasks {
+		t.Fatalf("total = %d, want %d", total, manyTasks)
+	}
+	if len(tasks) != 100 {
+		t.Fatalf("last page has %d tasks, want 100", len(tasks))
+	}
+	for _, task := range tasks {
+		if task.GroupKey != "article-1" {
+			t.Fatalf("task %s has group %q", task.ID, task.GroupKey)
+		}
+	}
+	tasks, _, err = s.ListByGroup(ctx, "article-1", 13, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("page past the end has %d tasks", len(tasks))
+	}
+}
+
+func TestGetByDedupKeyReturnsLatestAfterCompletion(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	var last *Task
+	for i := 0; i < manyTasks; i++ {
+		task, err := s.Enqueue(ctx, "ai:translation", i, fmt.Sprintf("key-%d", i%10), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpdateStatus(ctx, task.ID, TaskCompleted, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+		last = task
+	}
+
+	got, err := s.GetByDedupKey(ctx, "ai:translation", "key-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ID != last.ID {
+		t.Fatalf("GetByDedupKey = %v, want task %s", got, last.ID)
+	}
+	if got.Status != TaskCompleted {
+		t.Fatalf("status = %s, want completed", got.Status)
+	}
+	if got, _ := s.GetByDedupKey(ctx, "ai:translation", "missing"); got != nil {
+		t.Fatalf("unknown key returned task %s", got.ID)
+	}
+}
+
+func TestCancelGroupCancelsEveryBatch(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	var done *Task
+	for i := 0; i < manyTasks; i++ {
+		task, err := s.Enqueue(ctx, "ai:summary", i, "", "article-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			done = task
+		}
+	}
+	if err := s.UpdateStatus(ctx, done.ID, TaskCompleted, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Enqueue(ctx, "ai:summary", "other", "", "article-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.CancelGroup(ctx, "article-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != manyTasks-1 {
+		t.Fatalf("cancelled %d tasks, want %d", n, manyTasks-1)
+	}
+	pending, err := s.rc.Raw().ZRange(ctx, keyPending, 0, -1).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != other.ID {
+		t.Fatalf("pending = %v, want only %s", pending, other.ID)
+	}
+	if got, _ := s.GetByID(ctx, done.ID); got.Status != TaskCompleted {
+		t.Fatalf("completed task became %s", got.Status)
+	}
+}
+
+func TestBackfillIndexes(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	// Store tasks the way releases without the group and dedup-last
+	// indexes did.
+	created := time.Now().Add(-time.Hour)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		task := &Task{
+			ID:        fmt.Sprintf("old-%d", i),
+			Type:      "ai:summary",
+			Status:    TaskCompleted,
+			DedupKey:  "article-1:en",
+			GroupKey:  "article-1",
+			CreatedAt: created.Add(time.Duration(i) * time.Minute),
+		}
+		data, _ := json.Marshal(task)
+		s.rc.Raw().Set(ctx, s.taskKey(task.ID), data, taskTTL)
+		s.rc.Raw().ZAdd(ctx, keyIndex, redis.Z{Score: float64(task.CreatedAt.UnixMilli()), Member: task.ID})
+		ids = append(ids, task.ID)
+	}
+
+	if err := s.BackfillIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tasks, total, err := s.ListByGroup(ctx, "article-1", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(tasks) != 3 || tasks[0].ID != ids[2] {
+		t.Fatalf("ListByGroup after backfill = %d tasks, total %d", len(tasks), total)
+	}
+	got, err := s.GetByDedupKey(ctx, "ai:summary", "article-1:en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ID != ids[2] {
+		t.Fatalf("GetByDedupKey after backfill = %v, want %s", got, ids[2])
+	}
+
+	// The backfill only runs once.
+	s.rc.Raw().Del(ctx, keyGroup+"article-1")
+	if err := s.BackfillIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.rc.Raw().ZCard(ctx, keyGroup+"article-1").Result(); n != 0 {
+		t.Fatalf("second backfill re-added %d tasks", n)
+	}
+}
+
+func TestUpdateProgressNeverRevivesCancelledTask(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	task, err := s.Enqueue(ctx, "ai:summary", "payload", "", "article-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateStatus(ctx, task.ID, TaskRunning, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateProgress(ctx, task.ID, 100, "done soon"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.GetByID(ctx, task.ID)
+	if got.Progress != 100 || got.ProgressMessage != "done soon" {
+		t.Fatalf("progress = %d %q, want 100 %q", got.Progress, got.ProgressMessage, "done soon")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := s.UpdateProgress(ctx, task.ID, 100, "late"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	if err := s.UpdateStatus(ctx, task.ID, TaskCancelled, nil, "cancelled by user"); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	got, _ = s.GetByID(ctx, task.ID)
+	if got.Status != TaskCancelled {
+		t.Fatalf("status = %s, want %s", got.Status, TaskCancelled)
+	}
+}
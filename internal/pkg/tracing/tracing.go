@@ -0,0 +1,121 @@
+// Package tracing carries a per-request trace ID through contexts, logs and
+// outbound HTTP calls so one request can be followed across handlers, tasks
+// and provider calls.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// Header is read from incoming requests and set on responses and outbound calls.
+	Header = "X-Request-ID"
+	// GinKey is where the middleware stores the ID in the gin context.
+	GinKey = "trace_id"
+
+	maxIDLength = 128
+)
+
+type traceIDKey struct{}
+
+// NewID returns a fresh trace ID.
+func NewID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// Sanitize returns raw if it is usable as a propagated trace ID, or "".
+func Sanitize(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > maxIDLength {
+		return ""
+	}
+	for _, r := range raw {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return ""
+		}
+	}
+	return raw
+}
+
+// WithTraceID returns ctx carrying id. An empty id returns ctx unchanged.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceID returns the trace ID carried by ctx. A *gin.Context works too: its
+// Value looks up GinKey in the request keys.
+func TraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(traceIDKey{}).(string); ok {
+		return id
+	}
+	if id, ok := ctx.Value(GinKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// Detach keeps the trace ID of ctx but drops its deadline and cancellation, for
+// work that outlives the request (background tasks).
+func Detach(ctx context.Context) context.Context {
+	return WithTraceID(context.Background(), TraceID(ctx))
+}
+
+// GetLogger returns the global logger tagged with the trace ID of ctx.
+func GetLogger(ctx context.Context) *zap.Logger {
+	logger := zap.L()
+	if id := TraceID(ctx); id != "" {
+		logger = logger.With(zap.String(GinKey, id))
+	}
+	return logger
+}
+
+// Inject sets the trace ID of req's context as its X-Request-ID header, unless
+// the caller already set one.
+func Inject(req *http.Request) {
+	if req == nil || req.Header.Get(Header) != "" {
+		return
+	}
+	if id := TraceID(req.Context()); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
+
+// Transport wraps base (nil means http.DefaultTransport) so every request it
+// sends carries the trace ID of its context.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper{base: base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := TraceID(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return t.base.RoundTrip(req)
+	}
+	clone := req.Clone(req.Context())
+	clone.Header.Set(Header, id)
+	return t.base.RoundTrip(clone)
+}
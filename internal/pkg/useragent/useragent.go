@@ -0,0 +1,111 @@
+// Package useragent classifies User-Agent strings into the coarse OS, browser
+// and device buckets shown on the analytics dashboard.
+package useragent
+
+import "strings"
+
+const (
+	OSWindows = "Windows"
+	OSMacOS   = "macOS"
+	OSIOS     = "iOS"
+	OSAndroid = "Android"
+	OSLinux   = "Linux"
+
+	BrowserChrome  = "Chrome"
+	BrowserEdge    = "Edge"
+	BrowserFirefox = "Firefox"
+	BrowserSafari  = "Safari"
+
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+
+	// Other is used for any OS or browser outside the buckets above.
+	Other = "Other"
+)
+
+// Info is the classification of one User-Agent.
+type Info struct {
+	OS      string
+	Browser string
+	Device  string
+}
+
+// Parse classifies ua. Unrecognized values fall into Other and desktop.
+func Parse(ua string) Info {
+	lower := strings.ToLower(ua)
+	return Info{
+		OS:      detectOS(lower),
+		Browser: detectBrowser(lower),
+		Device:  detectDevice(lower),
+	}
+}
+
+// Tokens that identify Chromium and WebKit forks, which also claim to be
+// Chrome or Safari in their UA.
+var otherBrowserTokens = []string{
+	"opr/", "opera", "vivaldi", "yabrowser", "samsungbrowser", "ucbrowser",
+	"qqbrowser", "micromessenger", "miuibrowser", "huaweibrowser", "whale/",
+}
+
+func detectBrowser(lower string) string {
+	switch {
+	case containsAny(lower, "edg/", "edge/", "edga/", "edgios/"):
+		return BrowserEdge
+	case containsAny(lower, "firefox/", "fxios/"):
+		return BrowserFirefox
+	case containsAny(lower, otherBrowserTokens...):
+		return Other
+	case containsAny(lower, "chrome/", "crios/", "chromium/"):
+		return BrowserChrome
+	case strings.Contains(lower, "safari/") || (strings.Contains(lower, "applewebkit/") && isAppleMobile(lower)):
+		return BrowserSafari
+	default:
+		return Other
+	}
+}
+
+func detectOS(lower string) string {
+	switch {
+	case strings.Contains(lower, "windows"):
+		return OSWindows
+	// iOS UAs also contain "like Mac OS X", so check them first.
+	case isAppleMobile(lower):
+		return OSIOS
+	case strings.Contains(lower, "android"):
+		return OSAndroid
+	case containsAny(lower, "macintosh", "mac os x"):
+		return OSMacOS
+	case containsAny(lower, "linux", "x11", "cros "):
+		return OSLinux
+	default:
+		return Other
+	}
+}
+
+func detectDevice(lower string) string {
+	switch {
+	case containsAny(lower, "ipad", "tablet", "kindle", "silk/"):
+		return DeviceTablet
+	// Android phones say "Mobile"; Android without it is a tablet.
+	case strings.Contains(lower, "android") && !strings.Contains(lower, "mobile"):
+		return DeviceTablet
+	case containsAny(lower, "mobi", "iphone", "ipod", "windows phone"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+func isAppleMobile(lower string) bool {
+	return containsAny(lower, "iphone", "ipad", "ipod")
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}